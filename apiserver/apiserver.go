@@ -0,0 +1,697 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package apiserver
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/clearlinux/clr-installer/args"
+	"github.com/clearlinux/clr-installer/controller"
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/log"
+	"github.com/clearlinux/clr-installer/metrics"
+	"github.com/clearlinux/clr-installer/model"
+	"github.com/clearlinux/clr-installer/multiinstall"
+	"github.com/clearlinux/clr-installer/progress"
+	"github.com/clearlinux/clr-installer/storage"
+)
+
+const (
+	// BasePath prefixes the API endpoints, it's versioned so the provisioning
+	// controllers keep working across installer updates
+	BasePath = "/v1"
+
+	// StateIdle is the state of a server waiting for a descriptor
+	StateIdle = "idle"
+
+	// StateReady is the state of a server holding a valid descriptor
+	StateReady = "ready"
+
+	// StateRunning is the state of a server running an install
+	StateRunning = "running"
+
+	// StateSucceeded is the state of a server whose install succeeded
+	StateSucceeded = "succeeded"
+
+	// StateFailed is the state of a server whose install failed, a new
+	// descriptor may be uploaded and installed
+	StateFailed = "failed"
+
+	// EventProgress is streamed when an install task starts
+	EventProgress = "progress"
+
+	// EventPartial is streamed when an install task progresses
+	EventPartial = "partial"
+
+	// EventSuccess is streamed when an install task succeeds
+	EventSuccess = "success"
+
+	// EventFailure is streamed when an install task fails
+	EventFailure = "failure"
+
+	// EventDone is streamed when the install finished, successfully or not
+	EventDone = "done"
+
+	// maxDescriptorSize is the size limit of an uploaded descriptor
+	maxDescriptorSize = 1 << 20
+
+	// maxTargetsSize is the size limit of the uploaded target descriptors
+	maxTargetsSize = 16 * maxDescriptorSize
+
+	// closeTimeout is how long the pending responses are waited for when
+	// the server is closed
+	closeTimeout = 5 * time.Second
+)
+
+var (
+	// targetNameExp matches the valid target names, they name the target
+	// descriptor and log files
+	targetNameExp = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+)
+
+// Event is a change of the install state streamed to the API clients
+type Event struct {
+	ID      int       `json:"id"`
+	Time    time.Time `json:"time"`
+	Kind    string    `json:"kind"`
+	Text    string    `json:"text,omitempty"`
+	Percent float64   `json:"percent,omitempty"`
+	Error   string    `json:"error,omitempty"`
+
+	// RecoveryKey is the disk encryption recovery key of the succeeded
+	// install, only reported to the clients authenticated by the API token
+	RecoveryKey string `json:"recoveryKey,omitempty"`
+}
+
+// Status is the install state reported to the API clients
+type Status struct {
+	State   string  `json:"state"`
+	Task    string  `json:"task,omitempty"`
+	Percent float64 `json:"percent"`
+	Error   string  `json:"error,omitempty"`
+
+	// RecoveryKey is the recovery key of the done event
+	RecoveryKey string `json:"recoveryKey,omitempty"`
+}
+
+// APIServer is the frontend implementation driven by a REST API, so a
+// provisioning controller can install headless machines; it also implements
+// the progress interface: progress.Client
+type APIServer struct {
+	listener net.Listener
+	http     *http.Server
+	token    string
+	options  args.Args
+
+	mutex   sync.Mutex
+	status  Status
+	model   *model.SystemInstall
+	events  []*Event
+	changed chan struct{}
+
+	// firstEvent is the id of the first event of the current install, the
+	// ids keep increasing across the installs of the session
+	firstEvent int
+
+	start   chan *model.SystemInstall
+	targets chan []string
+	finish  chan bool
+}
+
+// New creates a new instance of APIServer frontend implementation
+func New() *APIServer {
+	return &APIServer{
+		status:  Status{State: StateIdle},
+		changed: make(chan struct{}),
+		start:   make(chan *model.SystemInstall, 1),
+		targets: make(chan []string, 1),
+		finish:  make(chan bool, 1),
+	}
+}
+
+// MustRun is part of the Frontend implementation and tells the core implementation that this
+// frontend wants or should be executed
+func (as *APIServer) MustRun(args *args.Args) bool {
+	return args.APIServer != ""
+}
+
+// Start serves the API on the options address, i.e ":8080"; the requests
+// must hold the token of the options token file, any local user could drive
+// the install otherwise
+func (as *APIServer) Start(options args.Args) error {
+	as.options = options
+
+	if options.APITokenFile == "" {
+		return errors.Errorf("The REST API requires --api-token-file")
+	}
+
+	content, err := ioutil.ReadFile(options.APITokenFile)
+	if err != nil {
+		return errors.Wrap(err)
+	}
+
+	if as.token = strings.TrimSpace(string(content)); as.token == "" {
+		return errors.Errorf("Empty API token file: %s", options.APITokenFile)
+	}
+
+	listener, err := net.Listen("tcp", options.APIServer)
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	as.listener = listener
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(BasePath+"/descriptor", as.authorized(as.serveDescriptor))
+	mux.HandleFunc(BasePath+"/install", as.authorized(as.serveInstall))
+	mux.HandleFunc(BasePath+"/targets", as.authorized(as.serveTargets))
+	mux.HandleFunc(BasePath+"/status", as.authorized(as.serveStatus))
+	mux.HandleFunc(BasePath+"/progress", as.authorized(as.serveProgress))
+	mux.HandleFunc(BasePath+"/logs", as.authorized(as.serveLogs))
+	mux.HandleFunc(BasePath+"/finish", as.authorized(as.serveFinish))
+
+	// no write timeout, the progress is streamed for the whole install
+	as.http = &http.Server{Handler: mux, ReadTimeout: 30 * time.Second}
+
+	go func() {
+		if errServe := as.http.Serve(listener); errServe != nil && errServe != http.ErrServerClosed {
+			log.Warning("API server stopped: %v", errServe)
+		}
+	}()
+
+	log.Info("Serving the REST API on %s%s", listener.Addr(), BasePath)
+
+	return nil
+}
+
+// Close stops serving the API once the pending responses are written, i.e
+// the response of the finish request
+func (as *APIServer) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), closeTimeout)
+	defer cancel()
+
+	if err := as.http.Shutdown(ctx); err == nil {
+		return nil
+	}
+
+	if err := as.http.Close(); err != nil {
+		return errors.Wrap(err)
+	}
+
+	return nil
+}
+
+// Addr returns the address the API is served on
+func (as *APIServer) Addr() net.Addr {
+	return as.listener.Addr()
+}
+
+// Run is part of the Frontend implementation and is the actual entry point for the
+// REST API frontend, it installs the uploaded descriptors until a client
+// finishes the session
+func (as *APIServer) Run(md *model.SystemInstall, rootDir string, options args.Args) (bool, error) {
+	var instError error
+
+	// the targets installs never reboot the orchestrating system
+	targets := false
+
+	if err := as.Start(options); err != nil {
+		return false, err
+	}
+	defer func() { _ = as.Close() }()
+
+	// the metrics are only recorded if the server was started
+	progress.Set(metrics.NewProgress(progress.NewThrottle(as, progress.DefaultUpdateInterval)))
+
+	for {
+		select {
+		case installed := <-as.start:
+			// the post install action is the one of the installed descriptor
+			*md = *installed
+			targets = false
+			instError = as.install(md, rootDir, options)
+		case configs := <-as.targets:
+			targets = true
+			instError = as.installTargets(configs, options)
+		case <-as.finish:
+			if instError != nil {
+				return false, instError
+			}
+
+			if targets || as.getStatus().State != StateSucceeded {
+				return false, nil
+			}
+
+			if md.PostAction != "" {
+				return md.PostAction != model.PostActionStay, nil
+			}
+
+			return md.PostReboot, nil
+		}
+	}
+}
+
+// install installs md, the install result is reported to the clients
+func (as *APIServer) install(md *model.SystemInstall, rootDir string, options args.Args) error {
+	// Need to ensure the partitioner knows we are running headless
+	// and will be using the whole disk
+	md.InstallSelected = storage.InstallTarget{WholeDisk: true}
+
+	log.Debug("Starting install requested by the API")
+
+	err := controller.Install(rootDir, md, options)
+	metrics.Finish(err)
+
+	recoveryKey := ""
+	if md.CryptKeys != nil {
+		recoveryKey = md.CryptKeys.RecoveryKey
+	}
+
+	as.done(err, recoveryKey)
+
+	return err
+}
+
+// installTargets installs the configs targets concurrently, each by its own
+// installer process, their output is streamed to the clients
+func (as *APIServer) installTargets(configs []string, options args.Args) error {
+	defer func() { _ = os.RemoveAll(filepath.Dir(configs[0])) }()
+
+	log.Debug("Starting the install of %d targets requested by the API", len(configs))
+
+	// the targets installs print their own recovery keys
+	err := multiinstall.RunTo(configs, options, os.Args[1:], &eventWriter{as: as})
+	as.done(err, "")
+
+	return err
+}
+
+// done reports the install result to the clients, with the recovery key of
+// a succeeded install since it's exported nowhere else without recoveryFile
+func (as *APIServer) done(err error, recoveryKey string) {
+	as.mutex.Lock()
+	defer as.mutex.Unlock()
+
+	ev := &Event{Kind: EventDone, Text: StateSucceeded, RecoveryKey: recoveryKey}
+	as.status.State = StateSucceeded
+	as.status.Percent = 100
+	as.status.RecoveryKey = recoveryKey
+
+	if err != nil {
+		as.status.State = StateFailed
+		as.status.Error = errors.Message(err)
+		as.status.RecoveryKey = ""
+		ev.Text = StateFailed
+		ev.Error = errors.Message(err)
+		ev.RecoveryKey = ""
+	}
+
+	as.publish(ev)
+}
+
+// eventWriter streams the lines written to it to the clients as progress
+// events, i.e the output of the targets installs
+type eventWriter struct {
+	as *APIServer
+}
+
+func (ew *eventWriter) Write(p []byte) (int, error) {
+	ew.as.mutex.Lock()
+	defer ew.as.mutex.Unlock()
+
+	for _, line := range strings.Split(string(p), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			ew.as.status.Task = line
+			ew.as.publish(&Event{Kind: EventProgress, Text: line})
+		}
+	}
+
+	return len(p), nil
+}
+
+// publish streams ev to the clients, the caller holds the mutex
+func (as *APIServer) publish(ev *Event) {
+	ev.ID = as.firstEvent + len(as.events)
+	ev.Time = time.Now()
+	as.events = append(as.events, ev)
+
+	// wake up the streaming clients
+	close(as.changed)
+	as.changed = make(chan struct{})
+}
+
+// resetEvents drops the events of the previous install, the clients only
+// receive the ones of the next install; the caller holds the mutex
+func (as *APIServer) resetEvents() {
+	as.firstEvent += len(as.events)
+	as.events = nil
+}
+
+// since returns the events of the current install from id, the channel closed
+// by the next event and whether the stream is complete
+func (as *APIServer) since(id int) ([]*Event, chan struct{}, bool) {
+	as.mutex.Lock()
+	defer as.mutex.Unlock()
+
+	idx := id - as.firstEvent
+	if idx < 0 {
+		idx = 0
+	} else if idx > len(as.events) {
+		idx = len(as.events)
+	}
+
+	events := append([]*Event{}, as.events[idx:]...)
+	complete := as.status.State == StateSucceeded || as.status.State == StateFailed
+
+	return events, as.changed, complete
+}
+
+func (as *APIServer) getStatus() Status {
+	as.mutex.Lock()
+	defer as.mutex.Unlock()
+
+	return as.status
+}
+
+// loadDescriptor loads and validates an uploaded descriptor
+func (as *APIServer) loadDescriptor(content []byte) (*model.SystemInstall, error) {
+	file, err := ioutil.TempFile("", "clr-installer-api-")
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	defer func() { _ = os.Remove(file.Name()) }()
+
+	_, err = file.Write(content)
+	if errClose := file.Close(); err == nil {
+		err = errClose
+	}
+
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+
+	md, err := model.LoadFile(file.Name(), as.options)
+	if err != nil {
+		return nil, errors.ValidationErrorf("Invalid descriptor: %s", errors.Message(err))
+	}
+
+	if err = md.Validate(); err != nil {
+		return nil, err
+	}
+
+	return md, nil
+}
+
+// authorized returns handler requiring the bearer token
+func (as *APIServer) authorized(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")),
+			[]byte("Bearer "+as.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, "Invalid or missing API token")
+			return
+		}
+
+		handler(w, r)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		log.Warning("Failed to write the API response: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, code int, msg string) {
+	writeJSON(w, code, map[string]string{"error": msg})
+}
+
+// serveDescriptor validates the descriptor uploaded with PUT or POST, it's
+// installed by the next install request
+func (as *APIServer) serveDescriptor(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut && r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "Use PUT or POST to upload a descriptor")
+		return
+	}
+
+	content, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxDescriptorSize))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Could not read the descriptor: %v", err))
+		return
+	}
+
+	md, err := as.loadDescriptor(content)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errors.Message(err))
+		return
+	}
+
+	as.mutex.Lock()
+	defer as.mutex.Unlock()
+
+	switch as.status.State {
+	case StateRunning:
+		writeError(w, http.StatusConflict, "An install is running")
+		return
+	case StateSucceeded:
+		writeError(w, http.StatusConflict, "The target is already installed")
+		return
+	}
+
+	as.model = md
+	as.status = Status{State: StateReady}
+	as.resetEvents()
+
+	log.Info("Descriptor uploaded by %s", r.RemoteAddr)
+	writeJSON(w, http.StatusOK, as.status)
+}
+
+// serveInstall starts the install of the uploaded descriptor
+func (as *APIServer) serveInstall(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "Use POST to start the install")
+		return
+	}
+
+	as.mutex.Lock()
+	defer as.mutex.Unlock()
+
+	switch as.status.State {
+	case StateRunning:
+		writeError(w, http.StatusConflict, "An install is running")
+		return
+	case StateSucceeded:
+		writeError(w, http.StatusConflict, "The target is already installed")
+		return
+	}
+
+	if as.model == nil {
+		writeError(w, http.StatusBadRequest, "No descriptor uploaded")
+		return
+	}
+
+	as.start <- as.model
+	as.model = nil
+	as.status = Status{State: StateRunning}
+	as.resetEvents()
+
+	log.Info("Install started by %s", r.RemoteAddr)
+	writeJSON(w, http.StatusAccepted, as.status)
+}
+
+// writeTargets writes the descriptors of the targets to a new directory,
+// named by the targets; their files are returned
+func writeTargets(descriptors map[string]string) ([]string, error) {
+	names := []string{}
+	for name := range descriptors {
+		if !targetNameExp.MatchString(name) {
+			return nil, errors.Errorf("Invalid target name: %q", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	dir, err := ioutil.TempDir("", "clr-installer-api-targets-")
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+
+	configs := []string{}
+	for _, name := range names {
+		file := filepath.Join(dir, name+".yaml")
+
+		if err = ioutil.WriteFile(file, []byte(descriptors[name]), 0600); err != nil {
+			_ = os.RemoveAll(dir)
+			return nil, errors.Wrap(err)
+		}
+		configs = append(configs, file)
+	}
+
+	return configs, nil
+}
+
+// serveTargets starts the concurrent install of the targets uploaded with
+// POST as a JSON object of their descriptors by name, i.e {"web": "...",
+// "db": "..."}; the descriptors are validated first, see multiinstall.Run
+func (as *APIServer) serveTargets(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "Use POST to install the targets")
+		return
+	}
+
+	content, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxTargetsSize))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Could not read the targets: %v", err))
+		return
+	}
+
+	descriptors := map[string]string{}
+	if err = json.Unmarshal(content, &descriptors); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid targets: %v", err))
+		return
+	}
+
+	if len(descriptors) == 0 {
+		writeError(w, http.StatusBadRequest, "No target descriptor uploaded")
+		return
+	}
+
+	configs, err := writeTargets(descriptors)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errors.Message(err))
+		return
+	}
+
+	started := false
+	defer func() {
+		if !started {
+			_ = os.RemoveAll(filepath.Dir(configs[0]))
+		}
+	}()
+
+	if err = multiinstall.Validate(configs, as.options); err != nil {
+		writeError(w, http.StatusBadRequest, errors.Message(err))
+		return
+	}
+
+	as.mutex.Lock()
+	defer as.mutex.Unlock()
+
+	switch as.status.State {
+	case StateRunning:
+		writeError(w, http.StatusConflict, "An install is running")
+		return
+	case StateSucceeded:
+		writeError(w, http.StatusConflict, "The target is already installed")
+		return
+	}
+
+	as.targets <- configs
+	started = true
+	as.model = nil
+	as.status = Status{State: StateRunning}
+	as.resetEvents()
+
+	log.Info("Install of %d targets started by %s", len(configs), r.RemoteAddr)
+	writeJSON(w, http.StatusAccepted, as.status)
+}
+
+func (as *APIServer) serveStatus(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, as.getStatus())
+}
+
+// serveProgress streams the install events as Server-Sent Events, the events
+// after the Last-Event-ID of a reconnecting client or all of them; the stream
+// ends with the done event
+func (as *APIServer) serveProgress(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Streaming not supported")
+		return
+	}
+
+	next := 0
+	if last, err := strconv.Atoi(r.Header.Get("Last-Event-ID")); err == nil {
+		next = last + 1
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	for {
+		events, changed, complete := as.since(next)
+
+		for _, ev := range events {
+			data, err := json.Marshal(ev)
+			if err != nil {
+				log.Warning("Failed to encode the API event: %v", err)
+				return
+			}
+
+			if _, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.ID, ev.Kind, data); err != nil {
+				return
+			}
+
+			next = ev.ID + 1
+		}
+		flusher.Flush()
+
+		if complete {
+			return
+		}
+
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// serveLogs returns the installer log file
+func (as *APIServer) serveLogs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	http.ServeFile(w, r, as.options.LogFile)
+}
+
+// serveFinish ends the API session, the installer runs the post install
+// action of a successful install and exits
+func (as *APIServer) serveFinish(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "Use POST to finish the session")
+		return
+	}
+
+	status := as.getStatus()
+	if status.State == StateRunning {
+		writeError(w, http.StatusConflict, "An install is running")
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, status)
+
+	select {
+	case as.finish <- true:
+		log.Info("API session finished by %s", r.RemoteAddr)
+	default:
+	}
+}
@@ -0,0 +1,346 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package apiserver
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/clearlinux/clr-installer/args"
+	"github.com/clearlinux/clr-installer/errors"
+)
+
+const testToken = "s3cr3t"
+
+func startTestServer(t *testing.T) (*APIServer, string, func()) {
+	dir, err := ioutil.TempDir("", "clr-installer-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	options := args.Args{
+		APIServer:    "127.0.0.1:0",
+		APITokenFile: filepath.Join(dir, "token"),
+		LogFile:      filepath.Join(dir, "clr-installer.log"),
+	}
+
+	if err = ioutil.WriteFile(options.APITokenFile, []byte(testToken+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = ioutil.WriteFile(options.LogFile, []byte("install log\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	as := New()
+	if err = as.Start(options); err != nil {
+		t.Fatal(err)
+	}
+
+	return as, "http://" + as.Addr().String() + BasePath, func() {
+		_ = as.Close()
+		_ = os.RemoveAll(dir)
+	}
+}
+
+func request(t *testing.T, method string, url string, token string, body io.Reader,
+	headers map[string]string) (int, string) {
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return resp.StatusCode, string(content)
+}
+
+func TestEmptyTokenFile(t *testing.T) {
+	file, err := ioutil.TempFile("", "clr-installer-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.Remove(file.Name()) }()
+	_ = file.Close()
+
+	if err = New().Start(args.Args{APIServer: "127.0.0.1:0", APITokenFile: file.Name()}); err == nil {
+		t.Fatal("Should have failed with an empty token file")
+	}
+}
+
+func TestNoTokenFile(t *testing.T) {
+	// any local user could drive the install of a loopback address too
+	for _, addr := range []string{":8080", "0.0.0.0:0", "127.0.0.1:0", "localhost:0", "[::1]:0"} {
+		if err := New().Start(args.Args{APIServer: addr}); err == nil {
+			t.Fatalf("Serving %q without a token file should have failed", addr)
+		}
+	}
+}
+
+func TestAuthorization(t *testing.T) {
+	_, url, cleanup := startTestServer(t)
+	defer cleanup()
+
+	for _, token := range []string{"", "invalid"} {
+		if code, _ := request(t, http.MethodGet, url+"/status", token, nil, nil); code != http.StatusUnauthorized {
+			t.Fatalf("Token %q should be rejected, got %d", token, code)
+		}
+	}
+
+	code, body := request(t, http.MethodGet, url+"/status", testToken, nil, nil)
+	if code != http.StatusOK {
+		t.Fatalf("Unexpected status response: %d %s", code, body)
+	}
+
+	status := &Status{}
+	if err := json.Unmarshal([]byte(body), status); err != nil {
+		t.Fatal(err)
+	}
+
+	if status.State != StateIdle {
+		t.Fatalf("Expected the %s state, got: %s", StateIdle, status.State)
+	}
+}
+
+func TestInstallRequests(t *testing.T) {
+	as, url, cleanup := startTestServer(t)
+	defer cleanup()
+
+	if code, _ := request(t, http.MethodGet, url+"/install", testToken, nil, nil); code != http.StatusMethodNotAllowed {
+		t.Fatalf("GET should not start an install, got %d", code)
+	}
+
+	if code, _ := request(t, http.MethodPost, url+"/install", testToken, nil, nil); code != http.StatusBadRequest {
+		t.Fatalf("Install without descriptor should be rejected, got %d", code)
+	}
+
+	code, body := request(t, http.MethodPut, url+"/descriptor", testToken, strings.NewReader("targetMedia: [invalid"), nil)
+	if code != http.StatusBadRequest || !strings.Contains(body, "error") {
+		t.Fatalf("Invalid descriptor should be rejected, got %d %s", code, body)
+	}
+
+	if as.getStatus().State != StateIdle {
+		t.Fatalf("Invalid descriptor should not change the state: %+v", as.getStatus())
+	}
+
+	as.status.State = StateRunning
+	if code, _ = request(t, http.MethodPost, url+"/finish", testToken, nil, nil); code != http.StatusConflict {
+		t.Fatalf("Finishing during an install should be rejected, got %d", code)
+	}
+
+	as.status.State = StateFailed
+	if code, _ = request(t, http.MethodPost, url+"/finish", testToken, nil, nil); code != http.StatusAccepted {
+		t.Fatalf("Unexpected finish response: %d", code)
+	}
+
+	select {
+	case <-as.finish:
+	default:
+		t.Fatal("The session should be finished")
+	}
+}
+
+const testDescriptor = `targetMedia:
+- name: sda
+  size: "30752636928"
+  type: disk
+  children:
+  - name: sda1
+    fstype: vfat
+    mountpoint: /boot
+    size: "157286400"
+    type: part
+  - name: sda2
+    fstype: ext4
+    mountpoint: /
+    size: "28447866880"
+    type: part
+bundles: [os-core, os-core-update]
+telemetry: false
+keyboard: us
+language: en_US.UTF-8
+kernel: kernel-native
+`
+
+func TestTargetsRequests(t *testing.T) {
+	as, url, cleanup := startTestServer(t)
+	defer cleanup()
+
+	if code, _ := request(t, http.MethodGet, url+"/targets", testToken, nil, nil); code != http.StatusMethodNotAllowed {
+		t.Fatalf("GET should not start an install, got %d", code)
+	}
+
+	descriptor, err := json.Marshal(testDescriptor)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	invalid := []string{
+		"[invalid",
+		"{}",
+		`{"../web": ` + string(descriptor) + `}`,
+		`{"web": "targetMedia: [invalid"}`,
+		// both targets install to sda
+		`{"web": ` + string(descriptor) + `, "db": ` + string(descriptor) + `}`,
+	}
+
+	for _, curr := range invalid {
+		code, body := request(t, http.MethodPost, url+"/targets", testToken, strings.NewReader(curr), nil)
+		if code != http.StatusBadRequest || !strings.Contains(body, "error") {
+			t.Fatalf("Invalid targets %s should be rejected, got %d %s", curr, code, body)
+		}
+	}
+
+	if as.getStatus().State != StateIdle {
+		t.Fatalf("Invalid targets should not change the state: %+v", as.getStatus())
+	}
+
+	as.status.State = StateRunning
+	body := `{"web": ` + string(descriptor) + `}`
+	if code, _ := request(t, http.MethodPost, url+"/targets", testToken, strings.NewReader(body), nil); code != http.StatusConflict {
+		t.Fatalf("Targets should not be installed during an install, got %d", code)
+	}
+
+	select {
+	case <-as.targets:
+		t.Fatal("The targets install should not have been started")
+	default:
+	}
+}
+
+func TestEventWriter(t *testing.T) {
+	as := New()
+	ew := &eventWriter{as: as}
+
+	if _, err := ew.Write([]byte("[web] Installing bundles\n\n[db] Installed\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	events, _, _ := as.since(0)
+	if len(events) != 2 || events[0].Text != "[web] Installing bundles" || events[1].Kind != EventProgress {
+		t.Fatalf("Expected a progress event per line, got: %v", events)
+	}
+
+	if as.getStatus().Task != "[db] Installed" {
+		t.Fatalf("The last line should be the current task: %+v", as.getStatus())
+	}
+}
+
+func TestProgressStream(t *testing.T) {
+	as, url, cleanup := startTestServer(t)
+	defer cleanup()
+
+	as.Desc("Installing bundles")
+	as.Partial(4, 1)
+	as.Success()
+
+	as.mutex.Lock()
+	as.status.State = StateFailed
+	as.publish(&Event{Kind: EventDone, Text: StateFailed, Error: "boom"})
+	as.mutex.Unlock()
+
+	// the stream ends with the done event of the finished install
+	code, body := request(t, http.MethodGet, url+"/progress", testToken, nil, nil)
+	if code != http.StatusOK {
+		t.Fatalf("Unexpected progress response: %d", code)
+	}
+
+	kinds := []string{}
+	for _, line := range strings.Split(body, "\n") {
+		if strings.HasPrefix(line, "event: ") {
+			kinds = append(kinds, strings.TrimPrefix(line, "event: "))
+		}
+	}
+
+	expected := []string{EventProgress, EventPartial, EventSuccess, EventDone}
+	if strings.Join(kinds, ",") != strings.Join(expected, ",") {
+		t.Fatalf("Expected the %v events, got: %v", expected, kinds)
+	}
+
+	if !strings.Contains(body, `"percent":25`) || !strings.Contains(body, `"error":"boom"`) {
+		t.Fatalf("Missing event data: %s", body)
+	}
+
+	// a reconnecting client only receives the events it missed
+	_, body = request(t, http.MethodGet, url+"/progress", testToken, nil, map[string]string{"Last-Event-ID": "2"})
+	if strings.Count(body, "event: ") != 1 || !strings.Contains(body, "event: "+EventDone) {
+		t.Fatalf("Expected the done event only, got: %s", body)
+	}
+
+	// a new install drops the events of the previous one
+	code, _ = request(t, http.MethodPut, url+"/descriptor", testToken, strings.NewReader(testDescriptor), nil)
+	if code != http.StatusOK {
+		t.Fatalf("Unexpected descriptor response: %d", code)
+	}
+
+	as.mutex.Lock()
+	as.status.State = StateSucceeded
+	as.publish(&Event{Kind: EventDone, Text: StateSucceeded})
+	as.mutex.Unlock()
+
+	for _, last := range []string{"", "2"} {
+		_, body = request(t, http.MethodGet, url+"/progress", testToken, nil, map[string]string{"Last-Event-ID": last})
+		if strings.Count(body, "event: ") != 1 || !strings.Contains(body, "id: 4\n") ||
+			!strings.Contains(body, StateSucceeded) {
+			t.Fatalf("Expected the done event of the new install only, got: %s", body)
+		}
+	}
+}
+
+func TestLogs(t *testing.T) {
+	_, url, cleanup := startTestServer(t)
+	defer cleanup()
+
+	code, body := request(t, http.MethodGet, url+"/logs", testToken, nil, nil)
+	if code != http.StatusOK || body != "install log\n" {
+		t.Fatalf("Unexpected logs response: %d %q", code, body)
+	}
+}
+
+func TestRecoveryKey(t *testing.T) {
+	as, url, cleanup := startTestServer(t)
+	defer cleanup()
+
+	as.done(nil, "1234-5678")
+
+	// the authenticated clients receive the key of the succeeded install
+	_, body := request(t, http.MethodGet, url+"/status", testToken, nil, nil)
+	if !strings.Contains(body, `"recoveryKey":"1234-5678"`) {
+		t.Fatalf("The status should hold the recovery key, got: %s", body)
+	}
+
+	_, body = request(t, http.MethodGet, url+"/progress", testToken, nil, nil)
+	if !strings.Contains(body, `"recoveryKey":"1234-5678"`) {
+		t.Fatalf("The done event should hold the recovery key, got: %s", body)
+	}
+
+	as.done(errors.Errorf("boom"), "1234-5678")
+	if as.getStatus().RecoveryKey != "" {
+		t.Fatal("A failed install should not report the recovery key")
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package apiserver
+
+import (
+	"time"
+)
+
+// Desc is part of the progress.Client implementation
+func (as *APIServer) Desc(desc string) {
+	as.mutex.Lock()
+	defer as.mutex.Unlock()
+
+	as.status.Task = desc
+	as.status.Percent = 0
+	as.publish(&Event{Kind: EventProgress, Text: desc})
+}
+
+// Partial is part of the progress.Client implementation
+func (as *APIServer) Partial(total int, step int) {
+	if total <= 0 {
+		return
+	}
+
+	as.mutex.Lock()
+	defer as.mutex.Unlock()
+
+	as.status.Percent = float64(step) / float64(total) * 100
+	as.publish(&Event{Kind: EventPartial, Text: as.status.Task, Percent: as.status.Percent})
+}
+
+// Step is part of the progress.Client implementation, the loop steps only
+// animate the local frontends
+func (as *APIServer) Step() {}
+
+// Success is part of the progress.Client implementation
+func (as *APIServer) Success() {
+	as.mutex.Lock()
+	defer as.mutex.Unlock()
+
+	as.status.Percent = 100
+	as.publish(&Event{Kind: EventSuccess, Text: as.status.Task})
+}
+
+// Failure is part of the progress.Client implementation
+func (as *APIServer) Failure() {
+	as.mutex.Lock()
+	defer as.mutex.Unlock()
+
+	as.publish(&Event{Kind: EventFailure, Text: as.status.Task})
+}
+
+// LoopWaitDuration is part of the progress.Client implementation
+func (as *APIServer) LoopWaitDuration() time.Duration {
+	return time.Second
+}
@@ -27,10 +27,14 @@ import (
 )
 
 const (
-	kernelCmdlineConf = "clri.descriptor"
-	kernelCmdlineDemo = "clri.demo"
-	kernelCmdlineLog  = "clri.loglevel"
-	logFileEnvironVar = "CLR_INSTALLER_LOG_FILE"
+	kernelCmdlineConf    = "clri.descriptor"
+	kernelCmdlineDemo    = "clri.demo"
+	kernelCmdlineLog     = "clri.loglevel"
+	kernelCmdlineNoMouse = "clri.nomouse"
+	kernelCmdlineVNC     = "clri.vnc"
+	kernelCmdlineMetrics = "clri.metrics"
+	kernelCmdlineFacts   = "clri.facts"
+	logFileEnvironVar    = "CLR_INSTALLER_LOG_FILE"
 )
 
 var (
@@ -42,9 +46,13 @@ type Args struct {
 	Version                 bool
 	Reboot                  bool
 	RebootSet               bool
+	PostAction              string
 	LogFile                 string
 	ConfigFile              string
+	ConfigOverlays          []string
 	CfDownloaded            bool
+	NoDefaultConfig         bool
+	GenerateConfig          string
 	CryptPassFile           string
 	SwupdMirror             string
 	SwupdStateDir           string
@@ -61,18 +69,43 @@ type Args struct {
 	PamSalt                 string
 	LogLevel                int
 	ForceTUI                bool
+	NoMouse                 bool
+	NoIOTune                bool
 	Archive                 bool
 	ArchiveSet              bool
 	DemoMode                bool
 	BlockDevices            []string
 	StubImage               bool
+	FakeInstall             bool
+	FakeInstallSeed         int64
+	FakeInstallFailAt       int
 	ConvertConfigFile       string
+	Kickstart               string
 	MakeISO                 bool
 	MakeISOSet              bool
 	KeepImage               bool
 	KeepImageSet            bool
 	SystemCheck             bool
+	SystemInfo              bool
+	SelfUpdate              bool
+	UsageMetrics            string
+	UsageExport             bool
 	CopyNetwork             bool
+	RemoteSession           string
+	Attach                  bool
+	RemoteDisplay           bool
+	MetricsAddress          string
+	Targets                 []string
+	FactsMap                string
+	Resume                  bool
+	APIServer               string
+	APITokenFile            string
+	DBusService             bool
+	Progress                string
+	InstallToDir            string
+	RootfsTarball           string
+	OCIImage                string
+	OCITag                  string
 }
 
 func (args *Args) setKernelArgs() (err error) {
@@ -92,6 +125,14 @@ func (args *Args) setKernelArgs() (err error) {
 			url = strings.Split(curr, "=")[1]
 		} else if strings.HasPrefix(curr, kernelCmdlineDemo) {
 			args.DemoMode = true
+		} else if strings.HasPrefix(curr, kernelCmdlineNoMouse) {
+			args.NoMouse = true
+		} else if curr == kernelCmdlineVNC {
+			args.RemoteDisplay = true
+		} else if strings.HasPrefix(curr, kernelCmdlineMetrics+"=") {
+			args.MetricsAddress = strings.TrimPrefix(curr, kernelCmdlineMetrics+"=")
+		} else if strings.HasPrefix(curr, kernelCmdlineFacts+"=") {
+			args.FactsMap = strings.TrimPrefix(curr, kernelCmdlineFacts+"=")
 		} else if strings.HasPrefix(curr, kernelCmdlineLog) {
 			logLevelString := strings.Split(curr, "=")[1]
 			if logLevel, _ := strconv.Atoi(logLevelString); err != nil {
@@ -135,10 +176,24 @@ func (args *Args) setCommandLineArgs() (err error) {
 		&args.Reboot, "reboot", true, "Reboot after finishing",
 	)
 
+	flag.StringVar(
+		&args.PostAction, "post-action", args.PostAction,
+		"Action after a successful install: stay, reboot, poweroff or kexec",
+	)
+
 	flag.BoolVar(
 		&args.ForceTUI, "tui", false, "Use TUI frontend",
 	)
 
+	flag.BoolVar(
+		&args.NoMouse, "no-mouse", args.NoMouse, "Disable mouse support in the TUI frontend (i.e serial terminals)",
+	)
+
+	flag.BoolVar(
+		&args.NoIOTune, "no-io-tune", args.NoIOTune,
+		"Disable the target media I/O scheduler tuning and the content install I/O priority",
+	)
+
 	flag.StringSliceVarP(
 		&args.BlockDevices, "block-device", "b", args.BlockDevices,
 		"Adds a new block-device's entry to configuration file. Format: <alias:filename>",
@@ -148,6 +203,26 @@ func (args *Args) setCommandLineArgs() (err error) {
 		&args.ConfigFile, "config", "c", args.ConfigFile, "Installation configuration file",
 	)
 
+	flag.StringArrayVar(
+		&args.ConfigOverlays, "config-overlay", args.ConfigOverlays,
+		"Installation configuration file applied on top of the configuration file, repeatable",
+	)
+
+	flag.BoolVar(
+		&args.NoDefaultConfig, "no-default-config", false,
+		"Skip the OEM partition, /etc and install media lookup and use the built-in default configuration file",
+	)
+
+	flag.StringVar(
+		&args.GenerateConfig, "generate-config", args.GenerateConfig,
+		"Interactively generate a configuration file, written to the given path, without installing",
+	)
+	// --generate-config may be used without a path, defaults to the current directory
+	fflag := flag.Lookup("generate-config")
+	if fflag != nil {
+		fflag.NoOptDefVal = conf.ConfigFile
+	}
+
 	flag.StringVar(
 		&args.CryptPassFile, "crypt-file", args.CryptPassFile, "File containing the cryptsetup password",
 	)
@@ -196,6 +271,11 @@ func (args *Args) setCommandLineArgs() (err error) {
 		&args.ConvertConfigFile, "json-yaml", "j", args.ConvertConfigFile, "Converts ister JSON config to clr-installer YAML config",
 	)
 
+	flag.StringVar(
+		&args.Kickstart, "kickstart", args.Kickstart,
+		"Kickstart (Anaconda ks.cfg) installation descriptor, used instead of the configuration file",
+	)
+
 	flag.StringVar(
 		&args.TelemetryURL, "telemetry-url", args.TelemetryURL, "Telemetry server URL",
 	)
@@ -229,11 +309,32 @@ func (args *Args) setCommandLineArgs() (err error) {
 		&args.DemoMode, "demo", args.DemoMode, "Demonstration mode for documentation generation",
 	)
 	// We do not want this flag to be shown as part of the standard help message
-	fflag := flag.Lookup("demo")
+	fflag = flag.Lookup("demo")
 	if fflag != nil {
 		fflag.Hidden = true
 	}
 
+	flag.BoolVar(
+		&args.FakeInstall, "fake-install", args.FakeInstall,
+		"Developer mode, replaces the install with a scripted fake one, nothing is written to the disks",
+	)
+
+	flag.Int64Var(
+		&args.FakeInstallSeed, "fake-install-seed", 1, "Seed of the fake install steps timing",
+	)
+
+	flag.IntVar(
+		&args.FakeInstallFailAt, "fake-install-fail-at", args.FakeInstallFailAt,
+		"Fake install step number to fail at, 0 never fails",
+	)
+
+	// The developer flags are not shown as part of the standard help message
+	for _, name := range []string{"fake-install", "fake-install-seed", "fake-install-fail-at"} {
+		if fflag = flag.Lookup(name); fflag != nil {
+			fflag.Hidden = true
+		}
+	}
+
 	usr, err := user.Current()
 	if err != nil {
 		return err
@@ -262,10 +363,101 @@ func (args *Args) setCommandLineArgs() (err error) {
 		&args.SystemCheck, "system-check", false, "Verify current system is compatible with Clear Linux and exit",
 	)
 
+	flag.BoolVar(
+		&args.SelfUpdate, "self-update", false, "Check for a newer installer on the update server and run it instead",
+	)
+
+	flag.BoolVar(
+		&args.SystemInfo, "system-info", false, "Print the detected hardware, medias and network interfaces as JSON and exit",
+	)
+
+	flag.StringVar(
+		&args.UsageMetrics, "usage-metrics", "",
+		"Record the visited pages and the time spent on them to a local file, nothing is transmitted",
+	)
+
+	flag.BoolVar(
+		&args.UsageExport, "usage-export", false, "Print the report of the --usage-metrics file as JSON and exit",
+	)
+
 	flag.BoolVar(
 		&args.CopyNetwork, "copy-network", true, "Copy the network interface configuration files to target",
 	)
 
+	flag.StringVar(
+		&args.RemoteSession, "remote-session", "",
+		"Let a root SSH login attach to the interactive install, read-only (ro) or read-write (rw)",
+	)
+
+	flag.BoolVar(
+		&args.Attach, "attach", false, "Attach to the remote session of a running install and mirror it",
+	)
+
+	flag.BoolVar(
+		&args.RemoteDisplay, "remote-display", args.RemoteDisplay,
+		"Run the GUI on a VNC server protected by a random password printed on the console",
+	)
+
+	flag.StringVar(
+		&args.MetricsAddress, "metrics-address", args.MetricsAddress,
+		"Serve the unattended install metrics in the Prometheus format on this address, i.e :9100",
+	)
+
+	flag.BoolVar(
+		&args.Resume, "resume", args.Resume,
+		"Resume a failed install, skipping the phases it completed",
+	)
+
+	flag.StringVar(
+		&args.FactsMap, "facts-map", args.FactsMap,
+		"CSV or JSON file mapping the machines serial numbers to the descriptor template variables",
+	)
+
+	flag.StringVar(
+		&args.APIServer, "api-server", args.APIServer,
+		"Serve the REST API driving a headless install on this address, i.e :8080",
+	)
+
+	flag.StringVar(
+		&args.APITokenFile, "api-token-file", args.APITokenFile,
+		"File holding the bearer token required by the REST API requests, required by --api-server",
+	)
+
+	flag.StringVar(
+		&args.Progress, "progress", args.Progress,
+		"Progress output of the unattended installs: auto, plain or tty; auto prints plain lines when stdout is not a terminal",
+	)
+
+	flag.BoolVar(
+		&args.DBusService, "dbus-service", args.DBusService,
+		"Serve the install progress and control interface on the system bus as org.clearlinux.Installer",
+	)
+
+	flag.StringVar(
+		&args.InstallToDir, "install-to-dir", args.InstallToDir,
+		"Install the software and the configuration into this directory, without any storage or boot loader work",
+	)
+
+	flag.StringVar(
+		&args.RootfsTarball, "rootfs-tarball", args.RootfsTarball,
+		"Archive the directory of --install-to-dir into this tarball, compressed by its suffix: .gz, .xz or .zst",
+	)
+
+	flag.StringVar(
+		&args.OCIImage, "oci-image", args.OCIImage,
+		"Export the directory of --install-to-dir as an image of this OCI image layout directory",
+	)
+
+	flag.StringVar(
+		&args.OCITag, "oci-tag", "latest",
+		"Tag of the image exported by --oci-image",
+	)
+
+	flag.StringArrayVar(
+		&args.Targets, "target", args.Targets,
+		"Installation configuration file of a target installed concurrently with the other targets, repeatable",
+	)
+
 	flag.ErrHelp = errors.New("Clear Linux Installer program")
 
 	saveConfigFile := args.ConfigFile
@@ -273,6 +465,7 @@ func (args *Args) setCommandLineArgs() (err error) {
 	// If we have a downloaded file, but it is overridden by command line, remove the tempfile
 	if args.CfDownloaded && args.ConfigFile != saveConfigFile {
 		_ = os.Remove(saveConfigFile)
+		args.CfDownloaded = false
 	}
 
 	fflag = flag.Lookup("telemetry")
@@ -314,6 +507,48 @@ func (args *Args) setCommandLineArgs() (err error) {
 		return errors.New("Telemetry requires both --telemetry-url and --telemetry-tid")
 	}
 
+	if args.Kickstart != "" && args.ConfigFile != "" && !args.CfDownloaded {
+		return errors.New("--kickstart and --config can not be used together")
+	}
+
+	if len(args.Targets) > 0 && ((args.ConfigFile != "" && !args.CfDownloaded) || args.Kickstart != "") {
+		return errors.New("--target can not be used with --config or --kickstart")
+	}
+
+	if args.APIServer != "" && len(args.Targets) > 0 {
+		return errors.New("--api-server can not be used with --target")
+	}
+
+	if args.DBusService && (args.APIServer != "" || len(args.Targets) > 0) {
+		return errors.New("--dbus-service can not be used with --api-server or --target")
+	}
+
+	if args.APITokenFile != "" && args.APIServer == "" {
+		return errors.New("--api-token-file requires --api-server")
+	}
+
+	if args.APIServer != "" && args.APITokenFile == "" {
+		return errors.New("--api-server requires --api-token-file")
+	}
+
+	if args.InstallToDir != "" {
+		if args.ConfigFile == "" && args.Kickstart == "" {
+			return errors.New("--install-to-dir requires --config or --kickstart")
+		}
+
+		if len(args.Targets) > 0 || args.APIServer != "" || args.DBusService || args.StubImage {
+			return errors.New("--install-to-dir can not be used with --target, --api-server, --dbus-service or --stub-image")
+		}
+	}
+
+	if args.RootfsTarball != "" && args.InstallToDir == "" {
+		return errors.New("--rootfs-tarball requires --install-to-dir")
+	}
+
+	if args.OCIImage != "" && args.InstallToDir == "" {
+		return errors.New("--oci-image requires --install-to-dir")
+	}
+
 	return nil
 }
 
@@ -172,6 +172,112 @@ func TestKernelCmdDemoFalse(t *testing.T) {
 	}
 }
 
+func TestKernelCmdNoMouse(t *testing.T) {
+	var testArgs Args
+	var kernelCmd string
+	var err error
+
+	kernelCmd = "root=PARTUUID=694da991-29f6-4cbd-ab72-6da064a799c0 quiet console=tty0 console=ttyS0,115200n8 rw" + " " + kernelCmdlineNoMouse
+	kernelCmdlineFile, err = makeTestKernelCmd(kernelCmd)
+	defer func() {
+		_ = os.Remove(kernelCmdlineFile)
+	}()
+	if err != nil {
+		t.Errorf("Failed to makeTestKernelCmd with error %q", err)
+		return
+	}
+
+	err = testArgs.setKernelArgs()
+	if err != nil {
+		t.Errorf("Failed to setKernelArgs with error %q", err)
+		return
+	}
+
+	if !testArgs.NoMouse {
+		t.Errorf("Failed to detect No Mouse with kernel command %q", kernelCmd)
+	}
+}
+
+func TestKernelCmdVNC(t *testing.T) {
+	var testArgs Args
+	var kernelCmd string
+	var err error
+
+	kernelCmd = "root=PARTUUID=694da991-29f6-4cbd-ab72-6da064a799c0 quiet console=ttyS0,115200n8 rw" + " " + kernelCmdlineVNC
+	kernelCmdlineFile, err = makeTestKernelCmd(kernelCmd)
+	defer func() {
+		_ = os.Remove(kernelCmdlineFile)
+	}()
+	if err != nil {
+		t.Errorf("Failed to makeTestKernelCmd with error %q", err)
+		return
+	}
+
+	err = testArgs.setKernelArgs()
+	if err != nil {
+		t.Errorf("Failed to setKernelArgs with error %q", err)
+		return
+	}
+
+	if !testArgs.RemoteDisplay {
+		t.Errorf("Failed to detect the remote display with kernel command %q", kernelCmd)
+	}
+}
+
+func TestKernelCmdMetrics(t *testing.T) {
+	var testArgs Args
+	var kernelCmd string
+	var err error
+
+	kernelCmd = "root=PARTUUID=694da991-29f6-4cbd-ab72-6da064a799c0 quiet rw" + " " + kernelCmdlineMetrics + "=:9100"
+	kernelCmdlineFile, err = makeTestKernelCmd(kernelCmd)
+	defer func() {
+		_ = os.Remove(kernelCmdlineFile)
+	}()
+	if err != nil {
+		t.Errorf("Failed to makeTestKernelCmd with error %q", err)
+		return
+	}
+
+	err = testArgs.setKernelArgs()
+	if err != nil {
+		t.Errorf("Failed to setKernelArgs with error %q", err)
+		return
+	}
+
+	if testArgs.MetricsAddress != ":9100" {
+		t.Errorf("Failed to detect the metrics address with kernel command %q, got %q", kernelCmd,
+			testArgs.MetricsAddress)
+	}
+}
+
+func TestKernelCmdFacts(t *testing.T) {
+	var testArgs Args
+	var kernelCmd string
+	var err error
+
+	kernelCmd = "root=PARTUUID=694da991-29f6-4cbd-ab72-6da064a799c0 quiet rw" + " " + kernelCmdlineFacts + "=/run/machines.csv"
+	kernelCmdlineFile, err = makeTestKernelCmd(kernelCmd)
+	defer func() {
+		_ = os.Remove(kernelCmdlineFile)
+	}()
+	if err != nil {
+		t.Errorf("Failed to makeTestKernelCmd with error %q", err)
+		return
+	}
+
+	err = testArgs.setKernelArgs()
+	if err != nil {
+		t.Errorf("Failed to setKernelArgs with error %q", err)
+		return
+	}
+
+	if testArgs.FactsMap != "/run/machines.csv" {
+		t.Errorf("Failed to detect the facts mapping file with kernel command %q, got %q", kernelCmd,
+			testArgs.FactsMap)
+	}
+}
+
 func TestKernelCmdConfPresent(t *testing.T) {
 
 	var testArgs Args
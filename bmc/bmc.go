@@ -0,0 +1,259 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package bmc
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/log"
+	"github.com/clearlinux/clr-installer/utils"
+)
+
+const (
+	// BootTarget is the Redfish boot source override of the installed
+	// system, the disk instead of the PXE boot which started the install
+	BootTarget = "Hdd"
+
+	// systemsPath is the Redfish collection of the computer systems
+	systemsPath = "/redfish/v1/Systems"
+
+	// requestTimeout is the timeout of each Redfish request
+	requestTimeout = 30 * time.Second
+)
+
+// Config is the BMC the install completion is registered to, the password is
+// a secret reference: "env:NAME" or "file:PATH"
+type Config struct {
+	Address  string `yaml:"address,omitempty,flow"`
+	User     string `yaml:"user,omitempty,flow"`
+	Password string `yaml:"password,omitempty,flow"`
+
+	// CACert is the PEM file of the CA verifying the BMC certificate, the
+	// system ones are used if not set
+	CACert string `yaml:"caCert,omitempty,flow"`
+
+	// Insecure skips the BMC certificate verification, the BMCs commonly
+	// have a self-signed one
+	Insecure bool `yaml:"insecure,omitempty,flow"`
+
+	// AssetTag is written to the system asset tag once the install is
+	// completed, the asset tag is left alone if not set
+	AssetTag string `yaml:"assetTag,omitempty,flow"`
+}
+
+// redfishCollection is a Redfish resource collection
+type redfishCollection struct {
+	Members []struct {
+		ID string `json:"@odata.id"`
+	} `json:"Members"`
+}
+
+// client is a Redfish session of the BMC
+type client struct {
+	http     *http.Client
+	base     string
+	user     string
+	password string
+}
+
+// Validate checks the BMC address and credentials, the password is only read
+// when registering
+func (cfg *Config) Validate() error {
+	if cfg.Address == "" {
+		return errors.ValidationErrorf("The BMC address is required")
+	}
+
+	u, err := url.Parse(cfg.baseURL())
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return errors.ValidationErrorf("Invalid BMC address %q, expected a host or an https URL", cfg.Address)
+	}
+
+	if cfg.User == "" || cfg.Password == "" {
+		return errors.ValidationErrorf("The BMC user and password are required")
+	}
+
+	if !strings.HasPrefix(cfg.Password, "env:") && !strings.HasPrefix(cfg.Password, "file:") {
+		return errors.ValidationErrorf("Invalid secret reference %q, expected env:NAME or file:PATH", cfg.Password)
+	}
+
+	if cfg.CACert != "" && cfg.Insecure {
+		return errors.ValidationErrorf("The BMC CA certificate can not be used by an insecure connection")
+	}
+
+	return nil
+}
+
+// baseURL returns the BMC URL, a bare host is reached with https
+func (cfg *Config) baseURL() string {
+	if strings.Contains(cfg.Address, "://") {
+		return strings.TrimSuffix(cfg.Address, "/")
+	}
+
+	return "https://" + strings.TrimSuffix(cfg.Address, "/")
+}
+
+// newClient returns a Redfish client of the BMC, the BMC is on the
+// management network so the proxies are never used
+func (cfg *Config) newClient() (*client, error) {
+	password, err := utils.ReadSecret(cfg.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: cfg.Insecure}
+
+	if cfg.CACert != "" {
+		pem, err := ioutil.ReadFile(cfg.CACert)
+		if err != nil {
+			return nil, errors.Wrap(err)
+		}
+
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.Errorf("No certificate found in %s", cfg.CACert)
+		}
+	}
+
+	return &client{
+		http: &http.Client{
+			Timeout:   requestTimeout,
+			Transport: &http.Transport{Proxy: nil, TLSClientConfig: tlsConfig},
+		},
+		base:     cfg.baseURL(),
+		user:     cfg.User,
+		password: strings.TrimRight(string(password), "\n"),
+	}, nil
+}
+
+// do sends a Redfish request to path, the JSON response is decoded to result
+// if not nil; the response ETag is returned
+func (c *client) do(method string, path string, etag string, payload interface{},
+	result interface{}) (string, error) {
+	var body []byte
+
+	if payload != nil {
+		var err error
+
+		if body, err = json.Marshal(payload); err != nil {
+			return "", errors.Wrap(err)
+		}
+	}
+
+	req, err := http.NewRequest(method, c.base+path, bytes.NewReader(body))
+	if err != nil {
+		return "", errors.Wrap(err)
+	}
+
+	req.SetBasicAuth(c.user, c.password)
+	req.Header.Set("Accept", "application/json")
+
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	// some BMCs reject the updates of a resource without its ETag
+	if etag != "" {
+		req.Header.Set("If-Match", etag)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return "", errors.Wrap(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", errors.Errorf("Redfish %s %s failed: %s", method, path, resp.Status)
+	}
+
+	if result != nil {
+		if err = json.NewDecoder(resp.Body).Decode(result); err != nil {
+			return "", errors.Wrap(err)
+		}
+	}
+
+	return resp.Header.Get("ETag"), nil
+}
+
+// patch updates the resource of path, its current ETag is sent along
+func (c *client) patch(path string, payload interface{}) error {
+	etag, err := c.do(http.MethodGet, path, "", nil, nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.do(http.MethodPatch, path, etag, payload, nil)
+	return err
+}
+
+// system returns the path of the computer system managed by the BMC
+func (c *client) system() (string, error) {
+	systems := &redfishCollection{}
+
+	if _, err := c.do(http.MethodGet, systemsPath, "", nil, systems); err != nil {
+		return "", err
+	}
+
+	if len(systems.Members) == 0 {
+		return "", errors.Errorf("The BMC manages no computer system")
+	}
+
+	if len(systems.Members) > 1 {
+		log.Warning("The BMC manages %d computer systems, using: %s", len(systems.Members), systems.Members[0].ID)
+	}
+
+	return systems.Members[0].ID, nil
+}
+
+// Register sets the next boot device of the system back to the disk, so a
+// PXE provisioned system doesn't install again. The install completion of
+// release is written to the system asset tag only if AssetTag is set, the
+// inventory fields are otherwise left alone and the completion is logged.
+func Register(cfg *Config, release string) error {
+	c, err := cfg.newClient()
+	if err != nil {
+		return err
+	}
+
+	system, err := c.system()
+	if err != nil {
+		return err
+	}
+
+	boot := map[string]interface{}{
+		"Boot": map[string]string{
+			"BootSourceOverrideEnabled": "Once",
+			"BootSourceOverrideTarget":  BootTarget,
+		},
+	}
+
+	if err = c.patch(system, boot); err != nil {
+		return err
+	}
+
+	log.Info("BMC next boot device set to: %s", BootTarget)
+
+	if cfg.AssetTag == "" {
+		log.Info("BMC system %s registered the install of %s", system, release)
+		return nil
+	}
+
+	if err = c.patch(system, map[string]string{"AssetTag": cfg.AssetTag}); err != nil {
+		return err
+	}
+
+	log.Info("BMC asset tag set to: %s", cfg.AssetTag)
+
+	return nil
+}
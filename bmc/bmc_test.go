@@ -0,0 +1,118 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package bmc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		cfg   *Config
+		valid bool
+	}{
+		{&Config{Address: "bmc.example.com", User: "admin", Password: "env:BMC_PASSWORD"}, true},
+		{&Config{Address: "https://10.0.0.2/", User: "admin", Password: "file:/run/bmc"}, true},
+		{&Config{Address: "bmc", User: "admin", Password: "env:P", Insecure: true}, true},
+		{&Config{User: "admin", Password: "env:BMC_PASSWORD"}, false},
+		{&Config{Address: "http://bmc", User: "admin", Password: "env:BMC_PASSWORD"}, false},
+		{&Config{Address: "bmc", Password: "env:BMC_PASSWORD"}, false},
+		{&Config{Address: "bmc", User: "admin", Password: "secret"}, false},
+		{&Config{Address: "bmc", User: "admin", Password: "env:P", Insecure: true, CACert: "/ca.pem"}, false},
+	}
+
+	for i, curr := range tests {
+		err := curr.cfg.Validate()
+
+		if curr.valid && err != nil {
+			t.Fatalf("Test %d should pass: %v", i, err)
+		}
+
+		if !curr.valid && err == nil {
+			t.Fatalf("Test %d should fail", i)
+		}
+	}
+}
+
+func TestRegister(t *testing.T) {
+	patches := []map[string]interface{}{}
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, password, ok := r.BasicAuth(); !ok || user != "admin" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == systemsPath:
+			_, _ = w.Write([]byte(`{"Members": [{"@odata.id": "/redfish/v1/Systems/1"}]}`))
+		case r.Method == http.MethodGet && r.URL.Path == "/redfish/v1/Systems/1":
+			w.Header().Set("ETag", `W/"1"`)
+			_, _ = w.Write([]byte(`{"Id": "1"}`))
+		case r.Method == http.MethodPatch && r.URL.Path == "/redfish/v1/Systems/1":
+			if r.Header.Get("If-Match") != `W/"1"` {
+				w.WriteHeader(http.StatusPreconditionFailed)
+				return
+			}
+
+			payload := map[string]interface{}{}
+			if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			patches = append(patches, payload)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	if err := os.Setenv("CLR_INSTALLER_TEST_BMC", "secret\n"); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.Unsetenv("CLR_INSTALLER_TEST_BMC") }()
+
+	cfg := &Config{Address: server.URL, User: "admin", Password: "env:CLR_INSTALLER_TEST_BMC"}
+
+	// the test server certificate is self-signed
+	if err := Register(cfg, "clear-linux-os"); err == nil {
+		t.Fatal("Register should fail to verify the BMC certificate")
+	}
+
+	cfg.Insecure = true
+	if err := Register(cfg, "clear-linux-os"); err != nil {
+		t.Fatalf("Register should pass: %v", err)
+	}
+
+	// the inventory asset tag is kept unless one is configured
+	if len(patches) != 1 {
+		t.Fatalf("Expected only the boot device update, got: %+v", patches)
+	}
+
+	boot, ok := patches[0]["Boot"].(map[string]interface{})
+	if !ok || boot["BootSourceOverrideTarget"] != BootTarget || boot["BootSourceOverrideEnabled"] != "Once" {
+		t.Fatalf("Unexpected boot override: %+v", patches[0])
+	}
+
+	cfg.AssetTag = "rack42-installed"
+	if err := Register(cfg, "clear-linux-os"); err != nil {
+		t.Fatalf("Register should pass: %v", err)
+	}
+
+	if len(patches) != 3 || patches[2]["AssetTag"] != "rack42-installed" {
+		t.Fatalf("Expected the configured asset tag, got: %+v", patches)
+	}
+
+	cfg.User = "root"
+	if err := Register(cfg, "clear-linux-os"); err == nil {
+		t.Fatal("Register should fail with invalid credentials")
+	}
+}
@@ -7,6 +7,8 @@
 package main
 
 import (
+	"github.com/clearlinux/clr-installer/apiserver"
+	"github.com/clearlinux/clr-installer/dbusserver"
 	"github.com/clearlinux/clr-installer/frontend"
 	"github.com/clearlinux/clr-installer/gui"
 	"github.com/clearlinux/clr-installer/massinstall"
@@ -16,6 +18,8 @@ import (
 // The list of possible frontends to run for GUI
 func initFrontendList() {
 	frontEndImpls = []frontend.Frontend{
+		apiserver.New(),
+		dbusserver.New(),
 		massinstall.New(),
 		gui.New(),
 		tui.New(),
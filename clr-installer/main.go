@@ -19,15 +19,18 @@ import (
 	"github.com/nightlyone/lockfile"
 
 	"github.com/clearlinux/clr-installer/args"
-	"github.com/clearlinux/clr-installer/cmd"
 	"github.com/clearlinux/clr-installer/conf"
+	"github.com/clearlinux/clr-installer/controller"
 	"github.com/clearlinux/clr-installer/encrypt"
 	"github.com/clearlinux/clr-installer/errors"
 	"github.com/clearlinux/clr-installer/frontend"
 	"github.com/clearlinux/clr-installer/keyboard"
 	"github.com/clearlinux/clr-installer/language"
 	"github.com/clearlinux/clr-installer/log"
+	"github.com/clearlinux/clr-installer/metrics"
 	"github.com/clearlinux/clr-installer/model"
+	"github.com/clearlinux/clr-installer/multiinstall"
+	"github.com/clearlinux/clr-installer/remote"
 	"github.com/clearlinux/clr-installer/swupd"
 	"github.com/clearlinux/clr-installer/syscheck"
 	"github.com/clearlinux/clr-installer/telemetry"
@@ -145,6 +148,38 @@ func main() {
 		return
 	}
 
+	// Print the system information and exit, it needs neither the lock nor
+	// a Clear Linux system
+	if options.SystemInfo {
+		info, errInfo := syscheck.GetSystemInfo()
+		if errInfo != nil {
+			fatal(errInfo)
+		}
+
+		out, errInfo := info.JSON()
+		if errInfo != nil {
+			fatal(errInfo)
+		}
+
+		fmt.Println(out)
+		return
+	}
+
+	// Print the usage metrics report and exit
+	if options.UsageExport {
+		if options.UsageMetrics == "" {
+			fatal(errors.Errorf("--usage-export requires --usage-metrics"))
+		}
+
+		out, errExport := telemetry.ExportUsage(options.UsageMetrics)
+		if errExport != nil {
+			fatal(errExport)
+		}
+
+		fmt.Println(out)
+		return
+	}
+
 	if options.ConvertConfigFile != "" {
 		if filepath.Ext(options.ConvertConfigFile) == ".json" {
 			_, err = model.JSONtoYAMLConfig(options.ConvertConfigFile)
@@ -165,6 +200,21 @@ func main() {
 		return
 	}
 
+	// Attach to the running install, its lock is not taken
+	if options.Attach {
+		if err = remote.Attach(remote.SocketFile); err != nil {
+			fatal(err)
+		}
+		return
+	}
+
+	// Self update before taking the lock, the updated installer takes it
+	if options.SelfUpdate {
+		if err = controller.SelfUpdate(options); err != nil {
+			log.Warning("Could not update the installer, proceeding with the running one: %v", err)
+		}
+	}
+
 	lockFile = strings.TrimSuffix(options.LogFile, ".log") + ".lock"
 	lock, err := lockfile.New(lockFile)
 	if err != nil {
@@ -180,6 +230,14 @@ func main() {
 
 	defer func() { _ = lock.Unlock() }()
 
+	// Each target is installed by its own installer process
+	if len(options.Targets) > 0 {
+		if err = multiinstall.Run(options.Targets, options, os.Args[1:]); err != nil {
+			fatal(err)
+		}
+		return
+	}
+
 	initFrontendList()
 
 	sigs := make(chan os.Signal, 1)
@@ -198,10 +256,34 @@ func main() {
 	var md *model.SystemInstall
 	cf := options.ConfigFile
 
-	if options.ConfigFile == "" {
+	if options.ConfigFile != "" {
+		source := "command line"
+		if options.CfDownloaded {
+			source = "kernel command line"
+		}
+		log.Info("Using config file from %s: %s", source, cf)
+	} else if options.Kickstart != "" {
+		log.Info("Using kickstart file from command line: %s", options.Kickstart)
+	} else if options.NoDefaultConfig {
 		if cf, err = conf.LookupDefaultConfig(); err != nil {
 			fatal(err)
 		}
+		log.Info("Default config discovery disabled, using built-in default: %s", cf)
+	} else {
+		dc, dcErr := conf.DiscoverDefaultConfig()
+		if dcErr != nil {
+			fatal(dcErr)
+		}
+
+		for _, curr := range dc.Skipped {
+			log.Warning("Skipping default config source: %v", curr)
+		}
+
+		cf = dc.Path
+		if dc.Temporary {
+			defer func() { _ = os.Remove(dc.Path) }()
+		}
+		log.Info("Using default config file from %s: %s", dc.Source, cf)
 	}
 	if options.CfDownloaded {
 		defer func() { _ = os.Remove(cf) }()
@@ -214,14 +296,44 @@ func main() {
 		}
 	}
 
-	log.Debug("Loading config file: %s", cf)
-	if md, err = model.LoadFile(cf, options); err != nil {
-		fatal(err)
+	if options.Kickstart != "" {
+		log.Debug("Loading kickstart file: %s", options.Kickstart)
+		if md, err = model.LoadKickstart(options.Kickstart, options); err != nil {
+			fatal(err)
+		}
+	} else {
+		log.Debug("Loading config file: %s", cf)
+		if md, err = model.LoadFile(cf, options); err != nil {
+			fatal(err)
+		}
+	}
+
+	for _, curr := range options.ConfigOverlays {
+		log.Debug("Loading config overlay file: %s", curr)
+		merged, mergeErr := model.LoadOverlay(md, curr, options)
+		if mergeErr != nil {
+			fatal(mergeErr)
+		}
+
+		changes, mergeErr := model.Diff(md, merged)
+		if mergeErr != nil {
+			fatal(mergeErr)
+		}
+
+		for _, change := range changes {
+			log.Info("Config overlay %s: %s", curr, change)
+		}
+
+		md = merged
 	}
 
 	log.Info("Querying Clear Linux version")
 	if err := utils.ParseOSClearVersion(); err != nil {
-		fatal(err)
+		// Configuration files may be generated on a non Clear Linux system
+		if options.GenerateConfig == "" {
+			fatal(err)
+		}
+		log.Warning("Generating configuration file on a non Clear Linux system: %v", err)
 	}
 
 	if options.CryptPassFile != "" {
@@ -237,6 +349,10 @@ func main() {
 		md.PostReboot = options.Reboot
 	}
 
+	if options.PostAction != "" {
+		md.PostAction = options.PostAction
+	}
+
 	if options.ArchiveSet {
 		md.PostArchive = options.Archive
 	}
@@ -289,16 +405,18 @@ func main() {
 		fatal(fmt.Errorf("Invalid Time Zone '%s'", md.Timezone.Code))
 	}
 
-	if md.Language != nil && !language.IsValidLanguage(md.Language) {
-		fatal(fmt.Errorf("Invalid Language '%s'", md.Language.Code))
+	for _, curr := range []*language.Language{md.Language, md.InstallerLanguage, md.TargetLocale} {
+		if curr != nil && !language.IsValidLanguage(curr) {
+			fatal(fmt.Errorf("Invalid Language '%s'", curr.Code))
+		}
 	}
 
 	// Set locale
-	utils.SetLocale(md.Language.Code)
+	utils.SetLocale(md.GetInstallerLanguage().Code)
 
 	// Run system check and exit
 	if options.SystemCheck {
-		err = syscheck.RunSystemCheck(false)
+		err = syscheck.RunSystemCheck(false, md.PreChecks)
 		if err != nil {
 			os.Exit(1)
 		} else {
@@ -306,6 +424,30 @@ func main() {
 		}
 	}
 
+	if options.RemoteSession != "" {
+		session, errSession := remote.Start(remote.SocketFile, options.RemoteSession)
+		if errSession != nil {
+			fatal(errSession)
+		}
+		defer func() { _ = session.Close() }()
+	}
+
+	if options.RemoteDisplay {
+		display, errDisplay := remote.StartDisplay()
+		if errDisplay != nil {
+			fatal(errDisplay)
+		}
+		defer func() { _ = display.Close() }()
+	}
+
+	if options.MetricsAddress != "" {
+		server, errMetrics := metrics.Start(options.MetricsAddress)
+		if errMetrics != nil {
+			fatal(errMetrics)
+		}
+		defer func() { _ = server.Close() }()
+	}
+
 	installReboot := false
 
 	go func() {
@@ -314,12 +456,16 @@ func main() {
 				continue
 			}
 
+			feName := classExp.FindString(reflect.TypeOf(fe).String())
+			if feName == "" {
+				feName = "unknown"
+			}
+
+			telemetry.StartUsage(options.UsageMetrics, feName)
 			installReboot, err = fe.Run(md, rootDir, options)
+			telemetry.StopUsage()
+
 			if err != nil {
-				feName := classExp.FindString(reflect.TypeOf(fe).String())
-				if feName == "" {
-					feName = "unknown"
-				}
 				if errLog := md.Telemetry.LogRecord(feName, 3, err.Error()); errLog != nil {
 					log.Error("Failed to log Telemetry fail record: %s", feName)
 				}
@@ -343,6 +489,7 @@ func main() {
 	go func() {
 		s := <-sigs
 		fmt.Println("Leaving...")
+		telemetry.StopUsage()
 		if errLog := md.Telemetry.LogRecord("signaled", 2, "Interrupted by signal: "+s.String()); errLog != nil {
 			log.Error("Failed to log Telemetry signal handler for: %s", s.String())
 		}
@@ -355,10 +502,20 @@ func main() {
 	// or we get a SIGTERM from reboot
 	signal.Reset()
 
+	if options.FakeInstall && installReboot {
+		log.Info("Fake install, skipping the post install action")
+		installReboot = false
+	}
+
 	if options.Reboot && installReboot {
-		if err := cmd.RunAndLog("reboot"); err != nil {
-			if errLog := md.Telemetry.LogRecord("reboot", 1, err.Error()); errLog != nil {
-				log.Error("Failed to log Telemetry fail record: reboot")
+		action := md.PostAction
+		if action == "" {
+			action = model.PostActionReboot
+		}
+
+		if err := controller.RunPostAction(action); err != nil {
+			if errLog := md.Telemetry.LogRecord(action, 1, err.Error()); errLog != nil {
+				log.Error("Failed to log Telemetry fail record: %s", action)
 			}
 			fatal(err)
 		}
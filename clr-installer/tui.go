@@ -7,6 +7,8 @@
 package main
 
 import (
+	"github.com/clearlinux/clr-installer/apiserver"
+	"github.com/clearlinux/clr-installer/dbusserver"
 	"github.com/clearlinux/clr-installer/frontend"
 	"github.com/clearlinux/clr-installer/massinstall"
 	"github.com/clearlinux/clr-installer/tui"
@@ -15,6 +17,8 @@ import (
 // The list of possible frontends to run for TUI
 func initFrontendList() {
 	frontEndImpls = []frontend.Frontend{
+		apiserver.New(),
+		dbusserver.New(),
 		massinstall.New(),
 		tui.New(),
 	}
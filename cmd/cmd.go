@@ -10,6 +10,8 @@ import (
 	"os"
 	"os/exec"
 	"strings"
+	"sync"
+	"syscall"
 
 	"github.com/clearlinux/clr-installer/log"
 )
@@ -18,6 +20,11 @@ type runLogger struct{}
 
 var (
 	httpsProxy string
+	noProxy    string
+
+	// running are the commands started and not yet completed
+	running      = map[*exec.Cmd]bool{}
+	runningMutex sync.Mutex
 )
 
 // SetHTTPSProxy defines the HTTPS_PROXY env var value for all the cmd executions
@@ -25,6 +32,11 @@ func SetHTTPSProxy(addr string) {
 	httpsProxy = addr
 }
 
+// SetNoProxy defines the NO_PROXY env var value for all the cmd executions
+func SetNoProxy(value string) {
+	noProxy = value
+}
+
 func (rl runLogger) Write(p []byte) (n int, err error) {
 	for _, curr := range strings.Split(string(p), "\n") {
 		if curr == "" {
@@ -69,6 +81,15 @@ func PipeRunAndLog(in string, args ...string) error {
 	}, runLogger{}, nil, args...)
 }
 
+// PipeRun is similar to Run but also writes in to the process stdin, neither
+// in nor the output are logged, i.e the secrets checked by the process
+func PipeRun(in string, writer io.Writer, args ...string) error {
+	return run(func(cmd *exec.Cmd) error {
+		cmd.Stdin = strings.NewReader(in)
+		return nil
+	}, writer, nil, args...)
+}
+
 func run(sw func(cmd *exec.Cmd) error, writer io.Writer, env map[string]string, args ...string) error {
 	var exe string
 	var cmdArgs []string
@@ -84,6 +105,10 @@ func run(sw func(cmd *exec.Cmd) error, writer io.Writer, env map[string]string,
 		cmd.Env = append(cmd.Env, fmt.Sprintf("https_proxy=%s", httpsProxy))
 	}
 
+	if noProxy != "" {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("no_proxy=%s", noProxy))
+	}
+
 	if sw != nil {
 		if err := sw(cmd); err != nil {
 			return err
@@ -91,7 +116,9 @@ func run(sw func(cmd *exec.Cmd) error, writer io.Writer, env map[string]string,
 	}
 
 	cmd.Stdout = writer
-	cmd.Stderr = writer
+	if cmd.Stderr == nil {
+		cmd.Stderr = writer
+	}
 
 	if cmd.Stdin == nil {
 		cmd.Stdin = os.Stdin
@@ -103,7 +130,20 @@ func run(sw func(cmd *exec.Cmd) error, writer io.Writer, env map[string]string,
 		cmd.Env = append(cmd.Env, curr)
 	}
 
-	err := cmd.Run()
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	runningMutex.Lock()
+	running[cmd] = true
+	runningMutex.Unlock()
+
+	err := cmd.Wait()
+
+	runningMutex.Lock()
+	delete(running, cmd)
+	runningMutex.Unlock()
+
 	if err != nil {
 		return err
 	}
@@ -111,6 +151,33 @@ func run(sw func(cmd *exec.Cmd) error, writer io.Writer, env map[string]string,
 	return nil
 }
 
+// Interrupt terminates the running commands, i.e the download of an aborted
+// install, the commands started afterwards are run normally
+func Interrupt() {
+	runningMutex.Lock()
+	defer runningMutex.Unlock()
+
+	for curr := range running {
+		log.Debug("Interrupting: %s", strings.Join(curr.Args, " "))
+		_ = curr.Process.Signal(syscall.SIGTERM)
+	}
+}
+
+// RunWithEnv is similar to Run but also sets the env variables to the
+// command environment
+func RunWithEnv(writer io.Writer, env map[string]string, args ...string) error {
+	return run(nil, writer, env, args...)
+}
+
+// RunWithEnvAndStderr is similar to RunWithEnv but writes the command stderr
+// to stderr instead of writer
+func RunWithEnvAndStderr(writer io.Writer, stderr io.Writer, env map[string]string, args ...string) error {
+	return run(func(cmd *exec.Cmd) error {
+		cmd.Stderr = stderr
+		return nil
+	}, writer, env, args...)
+}
+
 // Run executes a command and uses writer to write both stdout and stderr
 // args are the actual command and its arguments
 func Run(writer io.Writer, args ...string) error {
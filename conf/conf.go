@@ -37,6 +37,10 @@ const (
 
 	// SourcePath is the source path (within the .gopath)
 	SourcePath = "src/github.com/clearlinux/clr-installer"
+
+	// OfflineContentDir is the swupd content shipped with the install media,
+	// used by the offline installs
+	OfflineContentDir = "/run/media/iso/swupd"
 )
 
 func isRunningFromSourceTree() (bool, string, error) {
@@ -101,3 +105,20 @@ func LookupDefaultConfig() (string, error) {
 func LookupChpasswdConfig() (string, error) {
 	return lookupDefaultFile(ChpasswdPAMFile)
 }
+
+// IsOfflineContent returns true if dir holds a swupd content, the content
+// is expected to publish its latest version like the update server does
+func IsOfflineContent(dir string) bool {
+	ok, _ := utils.FileExists(filepath.Join(dir, "version", "latest_version"))
+	return ok
+}
+
+// LookupOfflineContent returns the swupd content directory of the install
+// media, an empty string if the media has no content
+func LookupOfflineContent() string {
+	if IsOfflineContent(OfflineContentDir) {
+		return OfflineContentDir
+	}
+
+	return ""
+}
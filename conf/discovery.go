@@ -0,0 +1,186 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package conf
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/utils"
+)
+
+const (
+	// EtcConfigDir is the administrator provided configuration directory
+	EtcConfigDir = "/etc/clr-installer"
+
+	// OEMPartitionLabel is the filesystem label of the OEM provided partition
+	// holding a default install descriptor in its root directory
+	OEMPartitionLabel = "CLR_OEM"
+
+	// InstallMediaLabel is the filesystem label of the install media, see
+	// the iso_templates/initrd_init_template
+	InstallMediaLabel = "CLR_ISO"
+
+	// filesystemsFile lists the filesystems supported by the kernel
+	filesystemsFile = "/proc/filesystems"
+)
+
+var (
+	// labelDevDir is the directory holding the filesystem label links
+	labelDevDir = "/dev/disk/by-label"
+
+	// etcConfigDir is where EtcConfigDir is looked up
+	etcConfigDir = EtcConfigDir
+
+	// mountLabel mounts the labeled filesystem device read only
+	mountLabel = mountReadOnly
+
+	// unmountLabel unmounts the labeled filesystem mounted by mountLabel
+	unmountLabel = func(mountPoint string) error {
+		return syscall.Unmount(mountPoint, syscall.MNT_DETACH)
+	}
+)
+
+// DefaultConfig is a discovered default install descriptor
+type DefaultConfig struct {
+	// Source is a human readable description of where the descriptor was found
+	Source string
+
+	// Path is the descriptor file path
+	Path string
+
+	// Temporary is true if Path is a temporary copy the caller must remove
+	Temporary bool
+
+	// Skipped are the errors of the sources which could not be read, the
+	// discovery falls through to the next source and the caller logs them
+	Skipped []error
+}
+
+// DiscoverDefaultConfig looks up the default install descriptor, the first
+// descriptor found in the following order wins:
+//  1. the root directory of the partition labeled OEMPartitionLabel
+//  2. the EtcConfigDir directory
+//  3. the root directory of the install media labeled InstallMediaLabel
+//  4. the built-in default, see LookupDefaultConfig
+//
+// A descriptor URL provided in the kernel command line takes precedence
+// over all of these and is handled by the args package. A labeled filesystem
+// which can not be read is skipped, see DefaultConfig.Skipped.
+func DiscoverDefaultConfig() (*DefaultConfig, error) {
+	skipped := []error{}
+
+	if path, err := copyFromLabel(OEMPartitionLabel, ConfigFile); err != nil {
+		skipped = append(skipped, err)
+	} else if path != "" {
+		return &DefaultConfig{Source: "OEM partition", Path: path, Temporary: true, Skipped: skipped}, nil
+	}
+
+	etc := filepath.Join(etcConfigDir, ConfigFile)
+	if ok, _ := utils.FileExists(etc); ok {
+		return &DefaultConfig{Source: EtcConfigDir, Path: etc, Skipped: skipped}, nil
+	}
+
+	if path, err := copyFromLabel(InstallMediaLabel, ConfigFile); err != nil {
+		skipped = append(skipped, err)
+	} else if path != "" {
+		return &DefaultConfig{Source: "install media", Path: path, Temporary: true, Skipped: skipped}, nil
+	}
+
+	path, err := LookupDefaultConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return &DefaultConfig{Source: "built-in default", Path: path, Skipped: skipped}, nil
+}
+
+// copyFromLabel mounts, read only, the filesystem labeled label and copies file from
+// its root directory to a temporary file, an empty path is returned if there is no
+// such filesystem or file
+func copyFromLabel(label string, file string) (string, error) {
+	device := filepath.Join(labelDevDir, label)
+
+	if ok, _ := utils.FileExists(device); !ok {
+		return "", nil
+	}
+
+	mountPoint, err := ioutil.TempDir("", "clr-installer-"+strings.ToLower(label)+"-")
+	if err != nil {
+		return "", errors.Wrap(err)
+	}
+	defer func() { _ = os.RemoveAll(mountPoint) }()
+
+	if err = mountLabel(device, mountPoint); err != nil {
+		return "", errors.Errorf("Could not read the %s filesystem: %v", label, err)
+	}
+	defer func() { _ = unmountLabel(mountPoint) }()
+
+	src := filepath.Join(mountPoint, file)
+	if ok, _ := utils.FileExists(src); !ok {
+		return "", nil
+	}
+
+	dest, err := ioutil.TempFile("", "clr-installer-*"+filepath.Ext(file))
+	if err != nil {
+		return "", errors.Wrap(err)
+	}
+	_ = dest.Close()
+
+	if err = utils.CopyFile(src, dest.Name()); err != nil {
+		_ = os.Remove(dest.Name())
+		return "", err
+	}
+
+	return dest.Name(), nil
+}
+
+// mountReadOnly tries to mount device with each of the block device
+// filesystems supported by the kernel, the same way mount(8) does when
+// no filesystem type is given
+func mountReadOnly(device string, mountPoint string) error {
+	fsTypes, err := blockFilesystems()
+	if err != nil {
+		return err
+	}
+
+	for _, fsType := range fsTypes {
+		if err = syscall.Mount(device, mountPoint, fsType, syscall.MS_RDONLY, ""); err == nil {
+			return nil
+		}
+	}
+
+	return errors.Errorf("Could not mount %s: no supported filesystem found", device)
+}
+
+// blockFilesystems returns the filesystems which require a block device
+func blockFilesystems() ([]string, error) {
+	f, err := os.Open(filesystemsFile)
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	defer func() { _ = f.Close() }()
+
+	result := []string{}
+	scanner := bufio.NewScanner(f)
+
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 1 {
+			result = append(result, fields[0])
+		}
+	}
+
+	if err = scanner.Err(); err != nil {
+		return nil, errors.Wrap(err)
+	}
+
+	return result, nil
+}
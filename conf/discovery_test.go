@@ -0,0 +1,182 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package conf
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testFilesystem is a labeled filesystem of the stubbed label lookups, a nil
+// content has no descriptor
+type testFilesystem struct {
+	content []byte
+	broken  bool
+}
+
+// setupDiscovery stubs the label lookups with the labels filesystems and the
+// EtcConfigDir with a directory holding etc, if not nil
+func setupDiscovery(t *testing.T, labels map[string]*testFilesystem, etc []byte) func() {
+	dir, err := ioutil.TempDir("", "clr-installer-discovery-")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	savedLabelDir, savedEtc := labelDevDir, etcConfigDir
+	savedMount, savedUnmount := mountLabel, unmountLabel
+
+	labelDevDir = filepath.Join(dir, "by-label")
+	etcConfigDir = filepath.Join(dir, "etc")
+
+	for _, curr := range []string{labelDevDir, etcConfigDir} {
+		if err = os.Mkdir(curr, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for label := range labels {
+		if err = ioutil.WriteFile(filepath.Join(labelDevDir, label), nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if etc != nil {
+		if err = ioutil.WriteFile(filepath.Join(etcConfigDir, ConfigFile), etc, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// mounting writes the filesystem descriptor to the mount point
+	mountLabel = func(device string, mountPoint string) error {
+		fs := labels[filepath.Base(device)]
+		if fs.broken {
+			return fmt.Errorf("no supported filesystem found")
+		}
+
+		if fs.content == nil {
+			return nil
+		}
+
+		return ioutil.WriteFile(filepath.Join(mountPoint, ConfigFile), fs.content, 0600)
+	}
+
+	unmountLabel = func(mountPoint string) error {
+		return nil
+	}
+
+	return func() {
+		labelDevDir, etcConfigDir = savedLabelDir, savedEtc
+		mountLabel, unmountLabel = savedMount, savedUnmount
+		_ = os.RemoveAll(dir)
+	}
+}
+
+// discover runs the discovery with the stubbed lookups, it returns the
+// discovered descriptor and its content, but the built-in default one
+func discover(t *testing.T, labels map[string]*testFilesystem, etc []byte) (*DefaultConfig, string) {
+	defer setupDiscovery(t, labels, etc)()
+
+	dc, err := DiscoverDefaultConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the built-in default may not be installed
+	if dc.Source == "built-in default" {
+		return dc, ""
+	}
+
+	content, err := ioutil.ReadFile(dc.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the labeled filesystems descriptors are copied
+	if dc.Temporary {
+		_ = os.Remove(dc.Path)
+	}
+
+	return dc, string(content)
+}
+
+func TestDiscoverDefaultConfig(t *testing.T) {
+	builtin, err := LookupDefaultConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oem := []byte("hostname: oem\n")
+	etc := []byte("hostname: etc\n")
+	iso := []byte("hostname: iso\n")
+
+	tests := []struct {
+		name    string
+		labels  map[string]*testFilesystem
+		etc     []byte
+		source  string
+		content []byte
+		skipped int
+	}{
+		{"oem", map[string]*testFilesystem{
+			OEMPartitionLabel: {content: oem},
+			InstallMediaLabel: {content: iso},
+		}, etc, "OEM partition", oem, 0},
+		{"etc", map[string]*testFilesystem{
+			InstallMediaLabel: {content: iso},
+		}, etc, EtcConfigDir, etc, 0},
+		{"oem without descriptor", map[string]*testFilesystem{
+			OEMPartitionLabel: {},
+		}, etc, EtcConfigDir, etc, 0},
+		{"iso", map[string]*testFilesystem{
+			InstallMediaLabel: {content: iso},
+		}, nil, "install media", iso, 0},
+		{"built-in", nil, nil, "built-in default", nil, 0},
+		{"iso without descriptor", map[string]*testFilesystem{
+			InstallMediaLabel: {},
+		}, nil, "built-in default", nil, 0},
+		// a filesystem which can't be read falls through to the next source
+		{"broken oem", map[string]*testFilesystem{
+			OEMPartitionLabel: {broken: true},
+			InstallMediaLabel: {content: iso},
+		}, nil, "install media", iso, 1},
+		{"broken oem and iso", map[string]*testFilesystem{
+			OEMPartitionLabel: {broken: true},
+			InstallMediaLabel: {broken: true},
+		}, nil, "built-in default", nil, 2},
+		{"broken iso", map[string]*testFilesystem{
+			InstallMediaLabel: {broken: true},
+		}, etc, EtcConfigDir, etc, 0},
+	}
+
+	for _, curr := range tests {
+		dc, content := discover(t, curr.labels, curr.etc)
+
+		if dc.Source != curr.source {
+			t.Fatalf("%s: expected the %s source, got: %s", curr.name, curr.source, dc.Source)
+		}
+
+		if len(dc.Skipped) != curr.skipped {
+			t.Fatalf("%s: expected %d skipped sources, got: %v", curr.name, curr.skipped, dc.Skipped)
+		}
+
+		for _, skipped := range dc.Skipped {
+			if !strings.Contains(skipped.Error(), "Could not read the") {
+				t.Fatalf("%s: unexpected skipped error: %v", curr.name, skipped)
+			}
+		}
+
+		if curr.content == nil {
+			if dc.Path != builtin || dc.Temporary {
+				t.Fatalf("%s: expected the built-in default %s, got: %s", curr.name, builtin, dc.Path)
+			}
+		} else if content != string(curr.content) {
+			t.Fatalf("%s: expected %q, got: %q", curr.name, curr.content, content)
+		}
+	}
+}
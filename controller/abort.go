@@ -0,0 +1,44 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package controller
+
+import (
+	"sync/atomic"
+
+	"github.com/clearlinux/clr-installer/cmd"
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/log"
+)
+
+var (
+	// aborted is set to 1 once the running install is aborted
+	aborted int32
+)
+
+// Abort stops the running install before its next task, the running
+// commands are interrupted so a long download doesn't delay it; the target
+// media is left partially installed
+func Abort() {
+	if !atomic.CompareAndSwapInt32(&aborted, 0, 1) {
+		return
+	}
+
+	log.Warning("Aborting the install")
+	cmd.Interrupt()
+}
+
+// resetAborted clears the abort of a previous install
+func resetAborted() {
+	atomic.StoreInt32(&aborted, 0)
+}
+
+// checkAborted returns an error if the install was aborted
+func checkAborted() error {
+	if atomic.LoadInt32(&aborted) == 1 {
+		return errors.Errorf("Install aborted")
+	}
+
+	return nil
+}
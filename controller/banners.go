@@ -0,0 +1,122 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package controller
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/clearlinux/clr-installer/cmd"
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/log"
+	"github.com/clearlinux/clr-installer/model"
+)
+
+const (
+	issueFile     = "etc/issue"
+	motdFile      = "etc/motd"
+	gdmProfile    = "etc/dconf/profile/gdm"
+	gdmBannerFile = "etc/dconf/db/gdm.d/01-clr-installer-banner"
+)
+
+var (
+	// versionIDExp matches the VERSION_ID of an os-release file
+	versionIDExp = regexp.MustCompile(`(?m)^VERSION_ID=([0-9]+)`)
+)
+
+// installedVersion returns the OS version installed to rootDir, the version
+// requested by the model if the target os-release can't be read
+func installedVersion(rootDir string, model *model.SystemInstall) string {
+	content, err := ioutil.ReadFile(filepath.Join(rootDir, "usr/lib/os-release"))
+	if err == nil {
+		if match := versionIDExp.FindStringSubmatch(string(content)); match != nil {
+			return match[1]
+		}
+	}
+
+	return targetVersion(model)
+}
+
+// dconfString quotes text as a dconf string value
+func dconfString(text string) string {
+	text = strings.Replace(text, `\`, `\\`, -1)
+	text = strings.Replace(text, `'`, `\'`, -1)
+	text = strings.Replace(text, "\n", `\n`, -1)
+
+	return "'" + text + "'"
+}
+
+// withNewline returns text terminated by a newline
+func withNewline(text string) string {
+	if strings.HasSuffix(text, "\n") {
+		return text
+	}
+
+	return text + "\n"
+}
+
+// configureBanners writes the console and graphical login banners and the
+// message of the day of the target, their variables resolved
+func configureBanners(rootDir string, md *model.SystemInstall) error {
+	bn := md.Banners
+	if bn == nil || bn.IsEmpty() {
+		return nil
+	}
+
+	host := md.Hostname
+	if host == "" {
+		host = "localhost"
+	}
+
+	vars := map[string]string{
+		model.BannerHostname:    host,
+		model.BannerInstallDate: time.Now().Format("2006-01-02"),
+		model.BannerVersion:     installedVersion(rootDir, md),
+	}
+
+	if bn.Issue != "" {
+		if err := writeDropIn(rootDir, issueFile, withNewline(bn.Expand(bn.Issue, vars))); err != nil {
+			return err
+		}
+	}
+
+	if bn.Motd != "" {
+		if err := writeDropIn(rootDir, motdFile, withNewline(bn.Expand(bn.Motd, vars))); err != nil {
+			return err
+		}
+	}
+
+	if bn.GDM == "" {
+		return nil
+	}
+
+	// the gdm profile adds the gdm database to the greeter defaults
+	profile := "user-db:user\nsystem-db:gdm\nfile-db:/usr/share/gdm/greeter-dconf-defaults\n"
+	if err := writeDropIn(rootDir, gdmProfile, profile); err != nil {
+		return err
+	}
+
+	banner := "[org/gnome/login-screen]\nbanner-message-enable=true\nbanner-message-text=" +
+		dconfString(strings.TrimSuffix(bn.Expand(bn.GDM, vars), "\n")) + "\n"
+	if err := writeDropIn(rootDir, gdmBannerFile, banner); err != nil {
+		return err
+	}
+
+	// the database is compiled on the target, without a desktop it's unused
+	if _, err := os.Stat(filepath.Join(rootDir, "usr/bin/dconf")); err != nil {
+		log.Warning("No dconf installed, the GDM banner is only shown once a desktop is installed")
+		return nil
+	}
+
+	if err := cmd.RunAndLog("chroot", rootDir, "dconf", "update"); err != nil {
+		return errors.Wrap(err)
+	}
+
+	return nil
+}
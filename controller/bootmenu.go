@@ -0,0 +1,95 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package controller
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/clearlinux/clr-installer/cmd"
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/model"
+	"github.com/clearlinux/clr-installer/storage"
+)
+
+// setBootMenuTimeout stores the boot menu timeout in the target so
+// clr-boot-manager writes it to loader.conf on every update
+func setBootMenuTimeout(rootDir string, bm *model.BootMenu) error {
+	if bm == nil || bm.Timeout == 0 {
+		return nil
+	}
+
+	return cmd.RunAndLog(
+		fmt.Sprintf("%s/usr/bin/clr-boot-manager", rootDir),
+		"set-timeout",
+		fmt.Sprintf("%d", bm.Timeout),
+		fmt.Sprintf("--path=%s", rootDir),
+	)
+}
+
+// configureBootMenu renames the installed boot entries and sets the default
+// entry, it must run after clr-boot-manager wrote the boot loader configuration
+func configureBootMenu(rootDir string, bm *model.BootMenu) error {
+	if bm == nil {
+		return nil
+	}
+
+	dir := filepath.Join(rootDir, loaderDir)
+
+	if bm.Title != "" {
+		entries, err := filepath.Glob(filepath.Join(dir, "entries", storage.ClearBootEntryPrefix+"*.conf"))
+		if err != nil {
+			return errors.Wrap(err)
+		}
+
+		for _, curr := range entries {
+			if err = setLoaderValue(curr, "title", bm.Title); err != nil {
+				return err
+			}
+		}
+	}
+
+	if bm.Default != "" {
+		if err := setLoaderValue(filepath.Join(dir, "loader.conf"), "default", bm.Default); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// setLoaderValue sets key to value in the systemd-boot configuration file
+// path, replacing its current value or appending it if not set
+func setLoaderValue(path string, key string, value string) error {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return errors.Wrap(err)
+	}
+
+	lines := strings.Split(strings.TrimRight(string(content), "\n"), "\n")
+	found := false
+
+	for i, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || fields[0] != key {
+			continue
+		}
+
+		lines[i] = key + " " + value
+		found = true
+	}
+
+	if !found {
+		lines = append(lines, key+" "+value)
+	}
+
+	if err = ioutil.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		return errors.Wrap(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,218 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package controller
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/clearlinux/clr-installer/args"
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/log"
+	"github.com/clearlinux/clr-installer/model"
+	"github.com/clearlinux/clr-installer/progress"
+	"github.com/clearlinux/clr-installer/storage"
+	"github.com/clearlinux/clr-installer/utils"
+)
+
+const (
+	// phasePartitioning is the install phase writing the partition tables
+	// and the file systems of the target medias
+	phasePartitioning = "partitioning"
+
+	// phaseBundles is the install phase installing the OS content
+	phaseBundles = "bundles"
+
+	// phaseBootloader is the install phase installing the boot loader
+	phaseBootloader = "bootloader"
+
+	// phaseConfiguration is the install phase configuring the target system
+	// and running the post-install hooks
+	phaseConfiguration = "configuration"
+)
+
+var (
+	// phases are the install phases in their completion order, a phase is
+	// only skipped by a resumed install if the previous ones are completed
+	phases = []string{phasePartitioning, phaseBundles, phaseBootloader, phaseConfiguration}
+
+	// phaseTitles are the progress descriptions of the skipped phases
+	phaseTitles = map[string]string{
+		phasePartitioning:  "Partitioning the target media",
+		phaseBundles:       "Installing base OS and configured bundles",
+		phaseBootloader:    "Installing boot loader",
+		phaseConfiguration: "Configuring the target system",
+	}
+)
+
+// checkpoint records the phases completed by an install so a failed install
+// can be resumed, i.e after swupd failed on a flaky network. The checkpoint
+// file lives next to the log file, it's removed once the install succeeds.
+type checkpoint struct {
+	file  string
+	mutex sync.Mutex
+
+	// Layout is the fingerprint of the target medias, an install is only
+	// resumed onto the same layout
+	Layout    string   `yaml:"layout"`
+	Completed []string `yaml:"completed,flow"`
+}
+
+// checkpointFile returns the checkpoint file of the install logging to the
+// options log file
+func checkpointFile(options args.Args) string {
+	return strings.TrimSuffix(options.LogFile, ".log") + ".checkpoint"
+}
+
+// writeLayout writes the fields of bd and its children defining the layout
+func writeLayout(sb *strings.Builder, bd *storage.BlockDevice) {
+	fmt.Fprintf(sb, "%s %s %s %s %d %s %s %s %s %v %v;", bd.Name, bd.Type, bd.FsType, bd.MountPoint,
+		bd.Size, bd.Encryption, bd.VolumeGroup, bd.RAIDLevel, strings.Join(bd.Members, ","),
+		bd.MakePartition, bd.FormatPartition)
+
+	for _, ch := range bd.Children {
+		writeLayout(sb, ch)
+	}
+}
+
+// layoutFingerprint returns the fingerprint of the target medias layout
+func layoutFingerprint(md *model.SystemInstall) string {
+	sb := &strings.Builder{}
+
+	for _, curr := range md.TargetMedias {
+		writeLayout(sb, curr)
+	}
+
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(sb.String())))
+}
+
+// newCheckpoint returns the checkpoint of the md install, the one of the
+// previous failed install if resumed. A new install discards the previous
+// checkpoint.
+func newCheckpoint(md *model.SystemInstall, options args.Args) (*checkpoint, error) {
+	result := &checkpoint{
+		file:   checkpointFile(options),
+		Layout: layoutFingerprint(md),
+	}
+
+	if !options.Resume {
+		if err := os.Remove(result.file); err != nil && !os.IsNotExist(err) {
+			return nil, errors.Wrap(err)
+		}
+
+		return result, nil
+	}
+
+	content, err := ioutil.ReadFile(result.file)
+	if os.IsNotExist(err) {
+		log.Warning("No install to resume, %s not found: installing from scratch", result.file)
+		return result, nil
+	} else if err != nil {
+		return nil, errors.Wrap(err)
+	}
+
+	previous := &checkpoint{}
+	if err = yaml.Unmarshal(content, previous); err != nil {
+		return nil, errors.Errorf("Invalid install checkpoint %s: %v", result.file, err)
+	}
+
+	if previous.Layout != result.Layout {
+		return nil, errors.Errorf("The install to resume used other target media, install from scratch")
+	}
+
+	result.Completed = previous.Completed
+	log.Info("Resuming the install, completed phases: %s", strings.Join(result.Completed, ", "))
+
+	return result, nil
+}
+
+// Done returns true if phase and the phases before it were completed by
+// the resumed install
+func (cp *checkpoint) Done(phase string) bool {
+	cp.mutex.Lock()
+	defer cp.mutex.Unlock()
+
+	for _, curr := range phases {
+		if !utils.StringSliceContains(cp.Completed, curr) {
+			return false
+		}
+
+		if curr == phase {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Complete records phase as completed, failing to write the checkpoint only
+// prevents resuming the install
+func (cp *checkpoint) Complete(phase string) {
+	cp.mutex.Lock()
+	defer cp.mutex.Unlock()
+
+	if utils.StringSliceContains(cp.Completed, phase) {
+		return
+	}
+
+	cp.Completed = append(cp.Completed, phase)
+
+	content, err := yaml.Marshal(cp)
+	if err == nil {
+		err = ioutil.WriteFile(cp.file, content, 0600)
+	}
+
+	if err != nil {
+		log.Warning("Failed to write the install checkpoint %s: %v", cp.file, err)
+		return
+	}
+
+	log.Debug("Install checkpoint: %s completed", phase)
+}
+
+// Skip reports phase as completed by the resumed install, so the install
+// page shows it done, and returns true if it's to be skipped
+func (cp *checkpoint) Skip(phase string) bool {
+	if !cp.Done(phase) {
+		return false
+	}
+
+	msg := utils.Locale.Get("%s: completed by the previous install", utils.Locale.Get(phaseTitles[phase]))
+	prg := progress.NewLoop(msg)
+	log.Info(msg)
+	prg.Success()
+
+	return true
+}
+
+// Remove removes the checkpoint file of the completed install
+func (cp *checkpoint) Remove() {
+	if err := os.Remove(cp.file); err != nil && !os.IsNotExist(err) {
+		log.Warning("Failed to remove the install checkpoint: %v", err)
+	}
+}
+
+// Exists returns true if the checkpoint file of a failed install, which may
+// be resumed, exists
+func (cp *checkpoint) Exists() bool {
+	_, err := os.Stat(cp.file)
+	return err == nil
+}
+
+// Restart discards the completed phases and the checkpoint file, the resumed
+// install runs from scratch
+func (cp *checkpoint) Restart() {
+	cp.mutex.Lock()
+	cp.Completed = nil
+	cp.mutex.Unlock()
+
+	cp.Remove()
+}
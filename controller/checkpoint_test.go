@@ -0,0 +1,214 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package controller
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/clearlinux/clr-installer/args"
+	"github.com/clearlinux/clr-installer/model"
+	"github.com/clearlinux/clr-installer/storage"
+)
+
+func checkpointModel(rootSize uint64) *model.SystemInstall {
+	md := &model.SystemInstall{}
+
+	md.AddTargetMedia(&storage.BlockDevice{
+		Name: "sda",
+		Type: storage.BlockDeviceTypeDisk,
+		Children: []*storage.BlockDevice{
+			{Name: "sda1", Type: storage.BlockDeviceTypePart, FsType: "vfat", MountPoint: "/boot", Size: 157286400},
+			{Name: "sda2", Type: storage.BlockDeviceTypePart, FsType: "ext4", MountPoint: "/", Size: rootSize},
+		},
+	})
+
+	return md
+}
+
+func checkpointOptions(t *testing.T, resume bool) (args.Args, func()) {
+	dir, err := ioutil.TempDir("", "clr-installer-checkpoint-")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	options := args.Args{LogFile: filepath.Join(dir, "clr-installer.log"), Resume: resume}
+
+	return options, func() { _ = os.RemoveAll(dir) }
+}
+
+func TestCheckpointDone(t *testing.T) {
+	tests := []struct {
+		completed []string
+		done      []string
+	}{
+		{nil, nil},
+		{[]string{phasePartitioning}, []string{phasePartitioning}},
+		{[]string{phasePartitioning, phaseBundles}, []string{phasePartitioning, phaseBundles}},
+		// a phase is only done if the previous ones are
+		{[]string{phaseBundles, phaseBootloader}, nil},
+		{[]string{phasePartitioning, phaseBootloader}, []string{phasePartitioning}},
+		{phases, phases},
+	}
+
+	for _, curr := range tests {
+		cp := &checkpoint{Completed: curr.completed}
+
+		for _, phase := range phases {
+			expected := false
+			for _, done := range curr.done {
+				if done == phase {
+					expected = true
+				}
+			}
+
+			if cp.Done(phase) != expected {
+				t.Fatalf("Completed %v: %s should be done: %v", curr.completed, phase, expected)
+			}
+		}
+
+		if cp.Done("unknown") {
+			t.Fatalf("Completed %v: an unknown phase should never be done", curr.completed)
+		}
+	}
+}
+
+func TestCheckpointComplete(t *testing.T) {
+	options, cleanup := checkpointOptions(t, false)
+	defer cleanup()
+
+	md := checkpointModel(28447866880)
+
+	cp, err := newCheckpoint(md, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cp.Complete(phasePartitioning)
+	cp.Complete(phaseBundles)
+	cp.Complete(phasePartitioning)
+
+	// the resumed install reads the completed phases back
+	options.Resume = true
+	resumed, err := newCheckpoint(md, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Join(resumed.Completed, ",") != phasePartitioning+","+phaseBundles {
+		t.Fatalf("Expected the partitioning and bundles phases completed once, got: %v", resumed.Completed)
+	}
+
+	if !resumed.Done(phaseBundles) || resumed.Done(phaseBootloader) {
+		t.Fatalf("Only the completed phases should be done, got: %v", resumed.Completed)
+	}
+
+	// a new install discards the checkpoint of the previous one
+	options.Resume = false
+	if _, err = newCheckpoint(md, options); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = os.Stat(checkpointFile(options)); !os.IsNotExist(err) {
+		t.Fatalf("A new install should remove the checkpoint, got: %v", err)
+	}
+
+	if cp.Exists() {
+		t.Fatal("The discarded checkpoint should not exist")
+	}
+
+	cp.Complete(phaseBootloader)
+	if !cp.Exists() {
+		t.Fatal("The checkpoint of the failed install should exist")
+	}
+
+	cp.Remove()
+	if cp.Exists() {
+		t.Fatal("The removed checkpoint should not exist")
+	}
+
+	if _, err = os.Stat(checkpointFile(options)); !os.IsNotExist(err) {
+		t.Fatalf("The completed install should remove the checkpoint, got: %v", err)
+	}
+}
+
+func TestCheckpointLayout(t *testing.T) {
+	options, cleanup := checkpointOptions(t, false)
+	defer cleanup()
+
+	cp, err := newCheckpoint(checkpointModel(28447866880), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cp.Complete(phasePartitioning)
+
+	if cp.Layout != layoutFingerprint(checkpointModel(28447866880)) {
+		t.Fatal("The same layout should have the same fingerprint")
+	}
+
+	// the install is never resumed onto other partitions
+	options.Resume = true
+	if _, err = newCheckpoint(checkpointModel(20000000000), options); err == nil {
+		t.Fatal("Resuming onto another layout should fail")
+	}
+
+	if err = ioutil.WriteFile(checkpointFile(options), []byte("completed: [invalid"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = newCheckpoint(checkpointModel(28447866880), options); err == nil {
+		t.Fatal("Resuming from an invalid checkpoint should fail")
+	}
+}
+
+func TestCheckpointRestart(t *testing.T) {
+	options, cleanup := checkpointOptions(t, false)
+	defer cleanup()
+
+	cp, err := newCheckpoint(checkpointModel(28447866880), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cp.Complete(phasePartitioning)
+	cp.Complete(phaseBundles)
+
+	// i.e the image of the resumed install is missing
+	cp.Restart()
+	for _, phase := range phases {
+		if cp.Done(phase) {
+			t.Fatalf("No phase should be done once restarted, %s is", phase)
+		}
+	}
+
+	if cp.Exists() {
+		t.Fatal("The restarted install should remove the checkpoint")
+	}
+
+	cp.Complete(phasePartitioning)
+	if !cp.Done(phasePartitioning) || cp.Done(phaseBundles) {
+		t.Fatalf("Only the partitioning should be done, got: %v", cp.Completed)
+	}
+}
+
+func TestCheckpointResumeMissing(t *testing.T) {
+	options, cleanup := checkpointOptions(t, true)
+	defer cleanup()
+
+	// nothing to resume, the install runs from scratch
+	cp, err := newCheckpoint(checkpointModel(28447866880), options)
+	if err != nil {
+		t.Fatalf("Resuming without checkpoint should not fail: %v", err)
+	}
+
+	for _, phase := range phases {
+		if cp.Done(phase) {
+			t.Fatalf("No phase should be done, %s is", phase)
+		}
+	}
+}
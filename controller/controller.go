@@ -6,56 +6,150 @@ package controller
 
 import (
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
-	"sort"
 	"strings"
 	"time"
 
 	"gopkg.in/yaml.v2"
 
 	"github.com/clearlinux/clr-installer/args"
+	"github.com/clearlinux/clr-installer/bmc"
 	"github.com/clearlinux/clr-installer/cmd"
 	"github.com/clearlinux/clr-installer/conf"
 	"github.com/clearlinux/clr-installer/errors"
 	"github.com/clearlinux/clr-installer/hostname"
 	"github.com/clearlinux/clr-installer/isoutils"
+	"github.com/clearlinux/clr-installer/kernel"
 	"github.com/clearlinux/clr-installer/keyboard"
 	"github.com/clearlinux/clr-installer/language"
 	"github.com/clearlinux/clr-installer/log"
 	"github.com/clearlinux/clr-installer/model"
 	"github.com/clearlinux/clr-installer/network"
+	"github.com/clearlinux/clr-installer/power"
 	"github.com/clearlinux/clr-installer/progress"
 	"github.com/clearlinux/clr-installer/storage"
 	"github.com/clearlinux/clr-installer/swupd"
+	"github.com/clearlinux/clr-installer/syscheck"
 	"github.com/clearlinux/clr-installer/telemetry"
 	"github.com/clearlinux/clr-installer/timezone"
+	"github.com/clearlinux/clr-installer/tpm"
 	cuser "github.com/clearlinux/clr-installer/user"
 	"github.com/clearlinux/clr-installer/utils"
 )
 
+const (
+	// maxHookStderrLines is how many of the last stderr lines of a failing
+	// hook are reported
+	maxHookStderrLines = 3
+
+	// maxHookStderrLength truncates the reported stderr lines of a hook
+	maxHookStderrLength = 200
+)
+
 var (
 	// NetworkPassing is used to track if the latest network configuration
 	// is passing; changes in proxy, etc.
 	NetworkPassing bool
 )
 
-func sortMountPoint(bds []*storage.BlockDevice) []*storage.BlockDevice {
-	sort.Slice(bds[:], func(i, j int) bool {
-		return filepath.HasPrefix(bds[j].MountPoint, bds[i].MountPoint)
-	})
+// Install is the main install controller, this is the entry point for a full
+// installation, the model's webhook is notified with the install summary once
+// the installation completes or fails. In fake install mode the install is
+// replaced by a scripted one, see fakeInstall()
+func Install(rootDir string, model *model.SystemInstall, options args.Args) error {
+	telemetry.UsageInstalled()
+
+	if options.FakeInstall {
+		return fakeInstall(model, options)
+	}
+
+	// Prevent the system from suspending in the middle of the install
+	if inhibitor, err := power.Inhibit("clr-installer", "Installing Clear Linux* OS"); err != nil {
+		log.Warning("Could not inhibit the system suspend: %v", err)
+	} else {
+		defer func() {
+			if err := inhibitor.Release(); err != nil {
+				log.Warning("Could not release the suspend inhibitor: %v", err)
+			}
+		}()
+	}
+
+	// a previous install of the session may have been aborted
+	resetAborted()
+
+	start := time.Now()
+
+	var err error
+	if options.InstallToDir != "" {
+		err = installToDir(options.InstallToDir, model, options)
+	} else {
+		err = install(rootDir, model, options)
+	}
+
+	// the BMC is the installing system one, the images and directories have none
+	if err == nil && model.BMC != nil && !model.MakeISO && !options.StubImage && options.InstallToDir == "" {
+		err = registerBMC(model)
+	}
 
-	return bds
+	if model.Webhook != "" && !options.StubImage {
+		notifyWebhook(model, start, err)
+	}
+
+	return err
 }
 
-// Install is the main install controller, this is the entry point for a full
-// installation
-func Install(rootDir string, model *model.SystemInstall, options args.Args) error {
+// askPassphrase sets the encryption passphrase following the passphrase policy:
+// read from a device, generated for the TPM enrollment, or taken from the
+// scripted answers; the user is prompted interactively if the model has no
+// answers
+func askPassphrase(md *model.SystemInstall) error {
+	var err error
+
+	switch md.CryptKeys.PassphrasePolicy() {
+	case storage.PassphraseTPM:
+		if err = tpm.CheckDevice(); err != nil {
+			return errors.Errorf("The %s passphrase policy requires a TPM: %v", storage.PassphraseTPM, err)
+		}
+		fallthrough
+	case storage.PassphraseUSBKeyFile:
+		if md.CryptPass, err = md.CryptKeys.ReadPassphrase(); err != nil {
+			return err
+		}
+		return nil
+	}
+
+	ref, ok, err := md.Answer(model.PromptCryptPassphrase)
+	if err != nil {
+		return err
+	}
+
+	if ok {
+		secret, err := utils.ReadSecret(ref)
+		if err != nil {
+			return err
+		}
+		md.CryptPass = strings.TrimRight(string(secret), "\n")
+	} else if storage.CanPromptPassphrase() {
+		md.CryptPass = storage.GetPassPhrase()
+	} else {
+		return errors.Errorf("No console to prompt the encryption passphrase, use the %s or %s passphrase policy",
+			storage.PassphraseUSBKeyFile, storage.PassphraseTPM)
+	}
+
+	if md.CryptPass == "" {
+		return errors.Errorf("Can not create encrypted file system, no passphrase")
+	}
+
+	return nil
+}
+
+func install(rootDir string, model *model.SystemInstall, options args.Args) error {
 	var err error
 	var version string
 	var prg progress.Progress
-	var encryptedUsed bool
 
 	vars := map[string]string{
 		"chrootDir": rootDir,
@@ -66,6 +160,12 @@ func Install(rootDir string, model *model.SystemInstall, options args.Args) erro
 		vars[k] = v
 	}
 
+	// every install logs its tasks to a new run directory
+	if err = log.StartRun(); err != nil {
+		log.Warning("Failed to create the task logs run directory: %v", err)
+	}
+	defer log.EndRun()
+
 	preConfFile := log.GetPreConfFile()
 
 	if err = model.WriteFile(preConfFile); err != nil {
@@ -73,9 +173,8 @@ func Install(rootDir string, model *model.SystemInstall, options args.Args) erro
 	}
 
 	if model.EncryptionRequiresPassphrase() && model.CryptPass == "" {
-		model.CryptPass = storage.GetPassPhrase()
-		if model.CryptPass == "" {
-			return errors.Errorf("Can not create encrypted file system, no passphrase")
+		if err = askPassphrase(model); err != nil {
+			return err
 		}
 	}
 
@@ -99,11 +198,7 @@ func Install(rootDir string, model *model.SystemInstall, options args.Args) erro
 		}
 	}
 
-	if model.Version == 0 {
-		version = utils.ClearVersion
-	} else {
-		version = fmt.Sprintf("%d", model.Version)
-	}
+	version = targetVersion(model)
 
 	log.Debug("Clear Linux version: %s", version)
 
@@ -112,8 +207,23 @@ func Install(rootDir string, model *model.SystemInstall, options args.Args) erro
 		return err
 	}
 
+	// the layout is fingerprinted before the image aliases are expanded
+	cp, err := newCheckpoint(model, options)
+	if err != nil {
+		return err
+	}
+	partitioned := cp.Done(phasePartitioning)
+
+	// the offline installs use the install media content, never the network
+	if model.Offline && !options.StubImage {
+		if options.SwupdContentURL, err = offlineContentURL(model); err != nil {
+			return err
+		}
+		options.SwupdVersionURL = options.SwupdContentURL
+	}
+
 	// Using MassInstaller (non-UI) the network will not have been checked yet
-	if !NetworkPassing && !options.StubImage {
+	if !NetworkPassing && !model.Offline && !options.StubImage {
 		if err = ConfigureNetwork(model); err != nil {
 			return err
 		}
@@ -124,6 +234,21 @@ func Install(rootDir string, model *model.SystemInstall, options args.Args) erro
 	removeMe := []string{}
 	aliasMap := map[string]string{}
 
+	// the image of a resumed install may have been removed, it's partitioned
+	// from scratch then
+	for _, alias := range model.StorageAlias {
+		if !partitioned || alias.DeviceFile {
+			continue
+		}
+
+		if _, err := os.Stat(alias.File); os.IsNotExist(err) {
+			log.Warning("The image %s of the resumed install is missing: installing from scratch",
+				alias.File)
+			cp.Restart()
+			partitioned = false
+		}
+	}
+
 	// prepare image file, case the user has declared image alias then create
 	// the image, setup the loop device, prepare the variable expansion
 	for _, alias := range model.StorageAlias {
@@ -133,11 +258,14 @@ func Install(rootDir string, model *model.SystemInstall, options args.Args) erro
 			continue
 		}
 
-		// create the image and add the alias name to the variable expansion list
+		// create the image and add the alias name to the variable expansion list,
+		// the image of a resumed install is already partitioned
 		for _, tm := range model.TargetMedias {
 			if tm.Name == fmt.Sprintf("${%s}", alias.Name) {
-				if err = storage.MakeImage(tm, alias.File); err != nil {
-					return err
+				if !partitioned {
+					if err = storage.MakeImage(tm, alias.File); err != nil {
+						return err
+					}
 				}
 
 				expandMe = append(expandMe, tm)
@@ -155,26 +283,13 @@ func Install(rootDir string, model *model.SystemInstall, options args.Args) erro
 			removeMe = append(removeMe, alias.File)
 		}
 
-		retry := 5
-
-		// wait the loop device to be prepared and available with 5 retry attempts
-		for {
-			var ok bool
-
-			if ok, err = utils.FileExists(file); err != nil {
-				for _, file := range detachMe {
-					storage.DetachLoopDevice(file)
-				}
-
-				return errors.Wrap(err)
+		// wait the loop device to be prepared and available
+		if err = storage.WaitForDevice(file, storage.DeviceWaitTimeout); err != nil {
+			for _, file := range detachMe {
+				storage.DetachLoopDevice(file)
 			}
 
-			if ok || retry == 0 {
-				break
-			}
-
-			retry--
-			time.Sleep(time.Second * 1)
+			return err
 		}
 	}
 
@@ -183,6 +298,11 @@ func Install(rootDir string, model *model.SystemInstall, options args.Args) erro
 		for _, file := range detachMe {
 			storage.DetachLoopDevice(file)
 		}
+		// the images of a failed install are kept until it's resumed
+		if cp.Exists() {
+			return
+		}
+
 		for _, file := range removeMe {
 			log.Debug("Removing raw image file: %s", file)
 			if err = os.Remove(file); err != nil {
@@ -196,168 +316,233 @@ func Install(rootDir string, model *model.SystemInstall, options args.Args) erro
 		tm.ExpandName(aliasMap)
 	}
 
-	mountPoints := []*storage.BlockDevice{}
-
-	// prepare all the target block devices
-	for _, curr := range model.TargetMedias {
-		// based on the description given, write the partition table
-		if err = curr.WritePartitionTable(model.LegacyBios, model.InstallSelected.WholeDisk); err != nil {
+	// the CPUs are isolated on the installing system topology, checked before
+	// the medias are touched
+	if model.HPC != nil && !model.HPC.IsEmpty() {
+		if err = model.HPC.ValidateTopology(kernel.OnlineCPUs()); err != nil {
 			return err
 		}
 
-		// prepare the blockdevice's partitions filesystem
-		for _, ch := range curr.Children {
-			if ch.Type == storage.BlockDeviceTypeCrypt {
-				encryptedUsed = true
+		model.AddExtraKernelArguments(model.HPC.KernelArguments())
+	}
 
-				if ch.FsTypeNotSwap() {
-					msg := utils.Locale.Get("Mapping %s partition to an encrypted partition", ch.Name)
-					prg = progress.NewLoop(msg)
-					log.Info(msg)
-					if err = ch.MapEncrypted(model.CryptPass); err != nil {
-						return err
-					}
-					prg.Success()
-				}
-			}
+	// the headless systems would boot silent without a serial console
+	console := SerialConsole(model)
+	if console != nil {
+		log.Info("Adding serial console: %s", console)
+		model.AddExtraKernelArguments([]string{console.KernelArgument()})
+	}
 
-			// Do not overwrite File System content for pre-existing
-			if !ch.FormatPartition {
-				msg := utils.Locale.Get("Skipping new file system for %s", ch.Name)
-				log.Debug(msg)
-				continue
-			}
+	// the profile kernel is only used if published for the installed version
+	if pr := kernel.GetProfile(model.KernelProfile); pr != nil {
+		available := false
 
-			msg := utils.Locale.Get("Writing %s file system to %s", ch.FsType, ch.Name)
-			if ch.MountPoint != "" {
-				msg = msg + fmt.Sprintf(" '%s'", ch.MountPoint)
-			}
-			prg = progress.NewLoop(msg)
-			log.Info(msg)
-			if err = ch.MakeFs(); err != nil {
-				return err
+		if !options.StubImage {
+			mirror := model.SwupdMirror
+			if model.Offline {
+				mirror = options.SwupdContentURL
 			}
-			prg.Success()
 
-			// if we have a mount point set it for future mounting
-			if ch.MountPoint != "" {
-				mountPoints = append(mountPoints, ch)
+			available, err = swupd.BundleAvailable(mirror, installVersion(version, model), pr.Bundle)
+			if err != nil {
+				log.Warning("Could not check the %s bundle availability: %v", pr.Bundle, err)
+			} else if !available {
+				log.Warning("The %s bundle is not available for the version %s, keeping the %s kernel",
+					pr.Bundle, installVersion(version, model), model.Kernel.Bundle)
 			}
 		}
+
+		model.ApplyKernelProfile(available)
 	}
 
-	// Update the target devices current labels and UUIDs
-	if scanErr := storage.UpdateBlockDevices(model.TargetMedias); scanErr != nil {
-		return scanErr
+	// release the busy target devices, existing LUKS, LVM and RAID stacks
+	// are never silently reused
+	if err = prepareTargetMedias(model, partitioned); err != nil {
+		return err
 	}
 
-	if options.StubImage {
-		return nil
+	// the reused EFI System Partitions must fit the new kernels
+	if err = storage.ValidateESPReuse(model.TargetMedias); err != nil {
+		return err
 	}
 
-	// mount all the prepared partitions
-	for _, curr := range sortMountPoint(mountPoints) {
-		log.Info("Mounting: %s", curr.MountPoint)
+	// fail before the medias are touched rather than when swupd runs out of space
+	if bundles, errList := swupd.LoadBundleList(model); errList == nil {
+		if problem := swupd.CheckContentSize(model, bundles); problem != nil {
+			return errors.Errorf("%s", problem.Message())
+		}
+	}
 
-		if err = curr.Mount(rootDir); err != nil {
+	// generate or read the extra LUKS keys before any partition is encrypted
+	if model.CryptKeys != nil && model.EncryptionRequiresPassphrase() {
+		if err = model.CryptKeys.Prepare(); err != nil {
 			return err
 		}
 	}
 
-	defer func() {
-		log.Info("Umounting rootDir: %s", rootDir)
-		if storage.UmountAll() != nil {
-			log.Warning("Failed to umount volumes")
-			return
-		}
+	if storage.EncryptionUsed(model.TargetMedias) {
+		model.AddBundle(storage.RequiredBundle)
 
-		log.Info("Removing rootDir: %s", rootDir)
-		if err = os.RemoveAll(rootDir); err != nil {
-			log.Warning("Failed to remove rootDir: %s", rootDir)
+		if model.CryptKeys.PassphrasePolicy() == storage.PassphraseTPM {
+			storage.EnableTPMUnlock(model.TargetMedias)
+			model.AddExtraKernelArguments([]string{storage.TPMKernelArgument})
 		}
-	}()
-
-	err = storage.MountMetaFs(rootDir)
-	if err != nil {
-		return err
 	}
 
-	// If we are using NetworkManager add the basic bundle
-	if network.IsNetworkManagerActive() {
-		model.AddBundle(network.RequiredBundle)
+	if model.HomeEncryption == storage.HomeEncryptionFscrypt {
+		storage.EnableFscrypt(model.TargetMedias)
+		model.AddBundle(storage.FscryptRequiredBundle)
 	}
 
-	// Add in the User Defined bundles
-	for _, curr := range model.UserBundles {
-		model.AddBundle(curr)
-	}
-
-	if model.Telemetry.Enabled {
-		model.AddBundle(telemetry.RequiredBundle)
-	}
+	// the root logical volume is activated and mounted by the initrd
+	if storage.VolumeGroupsUsed(model.TargetMedias) {
+		model.AddBundle(storage.LVMRequiredBundle)
 
-	if len(model.Users) > 0 {
-		model.AddBundle(cuser.RequiredBundle)
+		if len(storage.LVMKernelArguments(model.TargetMedias)) > 0 {
+			model.AddBundle(storage.RequiredBundle)
+		}
 	}
 
-	if model.Timezone.Code != timezone.DefaultTimezone {
-		model.AddBundle(timezone.RequiredBundle)
+	if model.UKI != nil && model.UKI.Enabled {
+		for _, curr := range model.UKI.RequiredBundles() {
+			model.AddBundle(curr)
+		}
 	}
 
-	if model.Keyboard.Code != keyboard.DefaultKeyboard {
-		model.AddBundle(keyboard.RequiredBundle)
+	if storage.BtrfsUsed(model.TargetMedias) {
+		model.AddBundle(storage.BtrfsRequiredBundle)
 	}
 
-	if model.Language.Code != language.DefaultLanguage {
-		model.AddBundle(language.RequiredBundle)
+	// the arrays are assembled and the root partition of an array mounted by
+	// the initrd
+	if storage.RAIDArraysUsed(model.TargetMedias) {
+		model.AddBundle(storage.RAIDRequiredBundle)
 	}
 
-	if encryptedUsed {
-		model.AddBundle(storage.RequiredBundle)
-		kernelArgs := []string{storage.KernelArgument}
+	// the boot of the encrypted, LVM, RAID and persistent memory roots
+	if kernelArgs := storage.KernelArguments(model.TargetMedias); len(kernelArgs) > 0 {
 		model.AddExtraKernelArguments(kernelArgs)
 	}
 
-	msg := utils.Locale.Get("Writing mount files")
-	prg = progress.NewLoop(msg)
-	log.Info(msg)
-	if err = storage.GenerateTabFiles(rootDir, model.TargetMedias); err != nil {
-		return err
+	if model.Diagnostics != nil && model.Diagnostics.Kdump {
+		model.AddExtraKernelArguments([]string{model.Diagnostics.CrashKernelArgument()})
 	}
-	prg.Success()
 
-	if model.KernelArguments != nil && len(model.KernelArguments.Add) > 0 {
-		cmdlineDir := filepath.Join(rootDir, "etc", "kernel")
-		cmdlineFile := filepath.Join(cmdlineDir, "cmdline")
-		cmdline := strings.Join(model.KernelArguments.Add, " ")
+	// the bundles must be known before the content is prefetched
+	addRequiredBundles(model)
 
-		if err = utils.MkdirAll(cmdlineDir, 0755); err != nil {
+	if !options.StubImage {
+		// the mirror certificates are needed before any content is fetched
+		if err = swupd.ConfigureTLS("/", model.SwupdTLS); err != nil {
 			return err
 		}
 
-		if err = ioutil.WriteFile(cmdlineFile, []byte(cmdline), 0644); err != nil {
-			return err
+		// the content is downloaded to a staging state directory while the
+		// target medias are partitioned and formatted
+		if options.SwupdStateDir == "" {
+			if options.SwupdStateDir, err = ioutil.TempDir("", "clr-installer-swupd-"); err != nil {
+				return errors.Wrap(err)
+			}
+
+			stagingDir := options.SwupdStateDir
+			defer func() { _ = os.RemoveAll(stagingDir) }()
 		}
+
+		defer func() {
+			log.Info("Umounting rootDir: %s", rootDir)
+			if storage.UmountAll() != nil {
+				log.Warning("Failed to umount volumes")
+				return
+			}
+
+			log.Info("Removing rootDir: %s", rootDir)
+			if err = os.RemoveAll(rootDir); err != nil {
+				log.Warning("Failed to remove rootDir: %s", rootDir)
+			}
+		}()
+	}
+
+	if !options.NoIOTune {
+		defer tuneTargetMedias(model)()
+	}
+
+	// the install page shows the phases completed by the resumed install
+	cp.Skip(phasePartitioning)
+
+	tasks := installTasks(rootDir, version, model, options, cp)
+	written := targetBytesWritten(model)
+	tasksStart := time.Now()
+
+	err = runTasks(tasks)
+	logTimingReport(tasks, time.Since(tasksStart), targetBytesWritten(model)-written)
+
+	if err != nil {
+		return err
+	}
+
+	if options.StubImage {
+		cp.Remove()
+		return nil
 	}
 
-	if model.KernelArguments != nil && len(model.KernelArguments.Remove) > 0 {
-		cmdlineDir := filepath.Join(rootDir, "etc", "kernel", "cmdline-removal.d")
-		cmdlineFile := filepath.Join(cmdlineDir, "clr-installer.conf")
-		cmdline := strings.Join(model.KernelArguments.Remove, " ")
+	if err = checkAborted(); err != nil {
+		return err
+	}
 
-		if err = utils.MkdirAll(cmdlineDir, 0755); err != nil {
+	// the fstab of the tab files task is rewritten by a resumed install, the
+	// swap file is always allocated again
+	if model.SwapFileSize != "" {
+		msg := utils.Locale.Get("Creating the swap file")
+		prg = progress.NewLoop(msg)
+		log.Info(msg)
+		if err = storage.CreateSwapFile(rootDir, model.TargetMedias, model.SwapFileSize); err != nil {
+			prg.Failure()
 			return err
 		}
+		prg.Success()
+	}
 
-		if err = ioutil.WriteFile(cmdlineFile, []byte(cmdline), 0644); err != nil {
+	if !cp.Skip(phaseConfiguration) {
+		if err = configureTarget(rootDir, vars, model, console); err != nil {
 			return err
 		}
+		cp.Complete(phaseConfiguration)
 	}
 
-	if prg, err = contentInstall(rootDir, version, model, options); err != nil {
-		prg.Failure()
-		return err
+	msg := utils.Locale.Get("Saving the installation results")
+	prg = progress.NewLoop(msg)
+	log.Info(msg)
+	if err = saveInstallResults(rootDir, model); err != nil {
+		log.ErrorError(err)
 	}
+	prg.Success()
+
+	if model.MakeISO {
+		msg = "Generating ISO image"
+		prg = progress.NewLoop(msg)
+		log.Info(msg)
+		if err = generateISO(rootDir, model, options); err != nil {
+			log.ErrorError(err)
+		}
+		prg.Success()
+	}
+
+	prepareKexec(rootDir, model)
+	cp.Remove()
+
+	msg = utils.Locale.Get("Installation completed")
+	prg = progress.NewLoop(msg)
+	log.Info(msg)
+	prg.Success()
+
+	return nil
+}
+
+// configureTarget configures the installed target system and runs the
+// post-install hooks
+func configureTarget(rootDir string, vars map[string]string, model *model.SystemInstall,
+	console *syscheck.SerialConsole) error {
+	var err error
 
 	if err = configureTimezone(rootDir, model); err != nil {
 		// Just log the error, not setting the timezone is not reason to fail the install
@@ -378,18 +563,78 @@ func Install(rootDir string, model *model.SystemInstall, options args.Args) erro
 		return err
 	}
 
+	if model.HomeEncryption == storage.HomeEncryptionFscrypt {
+		home := storage.HomeFilesystem(model.TargetMedias)
+		if err = cuser.EncryptHomes(rootDir, home.MountPoint, model.Users); err != nil {
+			return err
+		}
+	}
+
 	if model.Hostname != "" {
 		if err = hostname.SetTargetHostname(rootDir, model.Hostname); err != nil {
 			return err
 		}
 	}
 
+	if err = configureBanners(rootDir, model); err != nil {
+		return err
+	}
+
 	if model.CopyNetwork {
 		if err = network.CopyNetworkInterfaces(rootDir); err != nil {
 			return err
 		}
 	}
 
+	// the declared files win over the copied ones
+	if err = network.WriteNetworkdFiles(rootDir, model.NetworkdFiles); err != nil {
+		return err
+	}
+
+	// the wireless network is the only one of most laptops, always joined
+	if model.Wireless != nil {
+		if err = model.Wireless.WriteProfile(rootDir); err != nil {
+			return err
+		}
+	}
+
+	if err = network.WriteNoProxy(rootDir, model.NoProxy); err != nil {
+		return err
+	}
+
+	if err = configureEnvironment(rootDir, model.TargetEnv); err != nil {
+		return err
+	}
+
+	if model.KernelModules != nil && !model.KernelModules.IsEmpty() {
+		if err = model.KernelModules.Write(rootDir); err != nil {
+			return err
+		}
+	}
+
+	if err = kernel.WriteSysctl(rootDir, model.SysctlProfile, model.Sysctl); err != nil {
+		return err
+	}
+
+	if err = kernel.WriteUdevRules(rootDir, model.UdevRules); err != nil {
+		return err
+	}
+
+	if err = configureDiagnostics(rootDir, model.Diagnostics); err != nil {
+		return err
+	}
+
+	if console != nil {
+		// Just log the error, systemd also starts a getty on the kernel console
+		if err = cmd.RunAndLog("chroot", rootDir, "systemctl", "enable", console.GettyService()); err != nil {
+			log.Error("Error enabling the serial console getty: %v", err)
+		}
+	}
+
+	if err = configureTmpfiles(rootDir, model.Tmpfiles); err != nil {
+		return err
+	}
+
 	if model.Telemetry.URL != "" {
 		if err = model.Telemetry.CreateTelemetryConf(rootDir); err != nil {
 			return err
@@ -400,51 +645,112 @@ func Install(rootDir string, model *model.SystemInstall, options args.Args) erro
 		return err
 	}
 
-	msg = utils.Locale.Get("Saving the installation results")
-	prg = progress.NewLoop(msg)
-	log.Info(msg)
-	if err = saveInstallResults(rootDir, model); err != nil {
-		log.ErrorError(err)
+	// the boot chain is final once the post-install hooks ran
+	if model.MeasuredBoot != "" {
+		if err = verifyMeasuredBoot(rootDir, model); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// addRequiredBundles adds to the model the bundles required by the configured
+// features, i.e network manager, users, telemetry and localization
+func addRequiredBundles(model *model.SystemInstall) {
+	// If we are using NetworkManager, or joining a wireless network, add the
+	// basic bundle
+	if model.Wireless != nil || network.IsNetworkManagerActive() {
+		model.AddBundle(network.RequiredBundle)
+	}
+
+	// Add in the User Defined bundles
+	for _, curr := range model.UserBundles {
+		model.AddBundle(curr)
+	}
+
+	if model.Telemetry.Enabled {
+		model.AddBundle(telemetry.RequiredBundle)
+	}
+
+	if len(model.Users) > 0 {
+		model.AddBundle(cuser.RequiredBundle)
+	}
+
+	if model.Timezone.Code != timezone.DefaultTimezone {
+		model.AddBundle(timezone.RequiredBundle)
+	}
+
+	if model.Keyboard.Code != keyboard.DefaultKeyboard {
+		model.AddBundle(keyboard.RequiredBundle)
+	}
+
+	if model.GetTargetLocale().Code != language.DefaultLanguage {
+		model.AddBundle(language.RequiredBundle)
+	}
+
+	for _, curr := range FirmwareBundles(model) {
+		log.Info("Adding firmware bundle: %s", curr)
+		model.AddBundle(curr.Bundle)
+	}
+}
+
+// FirmwareBundles returns the microcode and firmware bundles automatically
+// added for the running hardware, none if the user opted out or the target
+// is an ISO image meant to boot on other hardware
+func FirmwareBundles(md *model.SystemInstall) []*syscheck.FirmwareBundle {
+	if md.SkipFirmwareBundles || md.MakeISO {
+		return nil
+	}
+
+	return syscheck.DetectFirmwareBundles()
+}
+
+// SerialConsole returns the serial console automatically configured for a
+// headless installing system, none if the user opted out, already set a
+// console or the target is an ISO image meant to boot on other hardware
+func SerialConsole(md *model.SystemInstall) *syscheck.SerialConsole {
+	if md.SkipSerialConsole || md.MakeISO {
+		return nil
 	}
-	prg.Success()
 
-	if model.MakeISO {
-		msg = "Generating ISO image"
-		prg = progress.NewLoop(msg)
-		log.Info(msg)
-		if err = generateISO(rootDir, model, options); err != nil {
-			log.ErrorError(err)
+	if md.KernelArguments != nil {
+		for _, curr := range md.KernelArguments.Add {
+			if strings.HasPrefix(curr, "console=") {
+				return nil
+			}
 		}
-		prg.Success()
 	}
 
-	msg = utils.Locale.Get("Installation completed")
-	prg = progress.NewLoop(msg)
-	log.Info(msg)
-	prg.Success()
-
-	return nil
+	return syscheck.DetectSerialConsole()
 }
 
-func applyHooks(name string, vars map[string]string, hooks []*model.InstallHook) error {
+func applyHooks(name string, vars map[string]string, hooks []*model.InstallHook) (err error) {
+	logTask := "hooks/" + name
+	log.BeginTask(logTask)
+	defer func() { log.EndTask(logTask, err) }()
+
 	locName := utils.Locale.Get(name)
 	msg := utils.Locale.Get("Running %s hooks", locName)
 	prg := progress.MultiStep(len(hooks), msg)
 	log.Info(msg)
 
 	for idx, curr := range hooks {
-		if err := runInstallHook(vars, curr); err != nil {
+		if err = runInstallHook(name, logTask, vars, curr); err != nil {
 			prg.Failure()
 			return err
 		}
-		prg.Partial(idx)
+		prg.Partial(idx + 1)
 	}
 
 	prg.Success()
 	return nil
 }
 
-func runInstallHook(vars map[string]string, hook *model.InstallHook) error {
+// runInstallHook runs the hook of the name hooks, a failing hook aborts the
+// install with the end of its stderr, i.e the reason a pre-install check
+// refused the install. The hook output is written to the logTask task log.
+func runInstallHook(name string, logTask string, vars map[string]string, hook *model.InstallHook) error {
 	args := []string{}
 	vars["chrooted"] = "0"
 
@@ -456,31 +762,158 @@ func runInstallHook(vars map[string]string, hook *model.InstallHook) error {
 	exec := utils.ExpandVariables(vars, hook.Cmd)
 	args = append(args, []string{"bash", "-l", "-c", exec}...)
 
-	if err := cmd.RunAndLogWithEnv(vars, args...); err != nil {
-		return errors.Wrap(err)
+	stderr := &hookStderr{}
+	stdout := hookLogger{logTask: logTask}
+
+	if err := cmd.RunWithEnvAndStderr(stdout, io.MultiWriter(stdout, stderr), vars, args...); err != nil {
+		if msg := stderr.String(); msg != "" {
+			return errors.Errorf("The %s hook failed (%v): %s", name, err, msg)
+		}
+
+		return errors.Errorf("The %s hook failed (%v)", name, err)
 	}
 
 	return nil
 }
 
-// use the current host's version to bootstrap the sysroot, then update to the
-// latest one and start adding new bundles
-// for the bootstrap we use the hosts's swupd and the following operations are
-// executed using the target swupd
-func contentInstall(rootDir string, version string, model *model.SystemInstall, options args.Args) (progress.Progress, error) {
+// hookStderr keeps the last lines of a hook stderr
+type hookStderr struct {
+	lines []string
+}
 
-	sw := swupd.New(rootDir, options)
+func (hs *hookStderr) Write(p []byte) (int, error) {
+	for _, curr := range strings.Split(string(p), "\n") {
+		curr = strings.TrimSpace(curr)
+		if curr == "" {
+			continue
+		}
+
+		if len(curr) > maxHookStderrLength {
+			curr = curr[:maxHookStderrLength] + "..."
+		}
+
+		hs.lines = append(hs.lines, curr)
+		if len(hs.lines) > maxHookStderrLines {
+			hs.lines = hs.lines[1:]
+		}
+	}
+
+	return len(p), nil
+}
+
+// String returns the kept lines on a single line, the install pages only
+// show the first line of the errors
+func (hs *hookStderr) String() string {
+	return strings.Join(hs.lines, "; ")
+}
+
+// hookLogger writes the hooks output to the installer log and the logTask
+// task log, unlike the other commands output it's kept with the default log level
+type hookLogger struct {
+	logTask string
+}
+
+func (hl hookLogger) Write(p []byte) (int, error) {
+	for _, curr := range strings.Split(string(p), "\n") {
+		if curr == "" {
+			continue
+		}
+
+		log.Info("hook: %s", curr)
+		log.TaskPrintf(hl.logTask, "hook: %s", curr)
+	}
+
+	return len(p), nil
+}
 
-	bundles := model.Bundles
+// installBundles returns the bundles to install, including the kernel bundle
+func installBundles(model *model.SystemInstall) []string {
+	bundles := append([]string{}, model.Bundles...)
 
 	if model.Kernel.Bundle != "none" {
 		bundles = append(bundles, model.Kernel.Bundle)
 	}
 
+	return bundles
+}
+
+// installVersion returns the OS version to install, the latest one if the
+// target is automatically updated
+func installVersion(version string, model *model.SystemInstall) string {
 	if model.AutoUpdate {
-		version = "latest"
+		return "latest"
+	}
+
+	return version
+}
+
+// offlineContentURL returns the swupd content URL of the offline install
+// content directory
+func offlineContentURL(model *model.SystemInstall) (string, error) {
+	dir := model.OfflineContentDir()
+
+	if !conf.IsOfflineContent(dir) {
+		return "", errors.Errorf("No swupd content found in the offline content directory: %s", dir)
+	}
+
+	log.Info("Installing from the offline content: %s", dir)
+
+	return "file://" + dir, nil
+}
+
+// targetVersion returns the OS version the model installs, the running one
+// unless the model sets it
+func targetVersion(model *model.SystemInstall) string {
+	if model.Version == 0 {
+		return utils.ClearVersion
 	}
 
+	return fmt.Sprintf("%d", model.Version)
+}
+
+// PrefetchContent downloads the content installed by model to the swupd state
+// directory of options, so installs sharing it don't download it again
+func PrefetchContent(model *model.SystemInstall, options args.Args) {
+	addRequiredBundles(model)
+	prefetchContent(targetVersion(model), model, options)
+}
+
+// prefetchContent downloads the content to install to the swupd state directory
+// so the content install doesn't wait for the network, it's only an optimization
+// therefore failures are logged and the content is downloaded during the install
+func prefetchContent(version string, model *model.SystemInstall, options args.Args) {
+	// the offline content is local, there's nothing to gain
+	if model.Offline {
+		return
+	}
+
+	stagingRoot, err := ioutil.TempDir("", "clr-installer-prefetch-")
+	if err != nil {
+		log.Warning("Failed to create the prefetch staging directory: %v", err)
+		return
+	}
+	defer func() { _ = os.RemoveAll(stagingRoot) }()
+
+	log.Info("Prefetching the OS content to: %s", options.SwupdStateDir)
+
+	sw := swupd.New(stagingRoot, options)
+	sw.SetTaskLog(log.TaskWriter(swupdLogTask))
+	if err = sw.Prefetch(installVersion(version, model), model.SwupdMirror, installBundles(model)); err != nil {
+		log.Warning("Failed to prefetch the OS content: %v", err)
+	}
+}
+
+// use the current host's version to bootstrap the sysroot, then update to the
+// latest one and start adding new bundles
+// for the bootstrap we use the hosts's swupd and the following operations are
+// executed using the target swupd
+func contentInstall(rootDir string, version string, model *model.SystemInstall, options args.Args) (progress.Progress, error) {
+
+	sw := swupd.New(rootDir, options)
+	sw.SetTaskLog(log.TaskWriter(swupdLogTask))
+	bundles := installBundles(model)
+	version = installVersion(version, model)
+
 	msg := utils.Locale.Get("Installing base OS and configured bundles")
 	prg := progress.NewLoop(msg)
 	log.Info(msg)
@@ -490,6 +923,46 @@ func contentInstall(rootDir string, version string, model *model.SystemInstall,
 	}
 	prg.Success()
 
+	if model.SwupdTLS != nil {
+		msg := utils.Locale.Get("Storing the swupd mirror certificates")
+		prg := progress.NewLoop(msg)
+		log.Info(msg)
+		if err := swupd.ConfigureTLS(rootDir, model.SwupdTLS); err != nil {
+			return prg, err
+		}
+		prg.Success()
+	}
+
+	if model.AutoUpdate && model.UpdatePolicy != nil {
+		msg := utils.Locale.Get("Configuring automatic updates")
+		prg := progress.NewLoop(msg)
+		log.Info(msg)
+		if err := sw.ConfigureUpdatePolicy(model.UpdatePolicy); err != nil {
+			return prg, err
+		}
+		prg.Success()
+	}
+
+	if model.Trim == storage.TrimPolicyTimer {
+		msg := utils.Locale.Get("Enabling the periodic TRIM")
+		prg := progress.NewLoop(msg)
+		log.Info(msg)
+		if err := storage.EnableTrimTimer(rootDir); err != nil {
+			return prg, err
+		}
+		prg.Success()
+	}
+
+	if model.Snapshots {
+		msg := utils.Locale.Get("Configuring the automatic snapshots")
+		prg := progress.NewLoop(msg)
+		log.Info(msg)
+		if err := storage.EnableSnapshots(rootDir); err != nil {
+			return prg, err
+		}
+		prg.Success()
+	}
+
 	if !model.AutoUpdate {
 		msg := utils.Locale.Get("Disabling automatic updates")
 		prg := progress.NewLoop(msg)
@@ -502,9 +975,30 @@ func contentInstall(rootDir string, version string, model *model.SystemInstall,
 		prg.Success()
 	}
 
-	msg = utils.Locale.Get("Installing boot loader")
-	prg = progress.NewLoop(msg)
+	// Clean-up State Directory content
+	if options.SwupdStateClean {
+		msg = utils.Locale.Get("Cleaning Swupd state directory")
+		prg = progress.NewLoop(msg)
+		log.Info(msg)
+		if err := sw.CleanUpState(); err != nil {
+			log.ErrorError(err)
+		}
+		prg.Success()
+	}
+
+	return nil, nil
+}
+
+// bootloaderInstall installs the boot loader and the boot entries of the
+// installed kernels
+func bootloaderInstall(rootDir string, model *model.SystemInstall) (progress.Progress, error) {
+	msg := utils.Locale.Get("Installing boot loader")
+	prg := progress.NewLoop(msg)
 	log.Info(msg)
+	if err := setBootMenuTimeout(rootDir, model.BootMenu); err != nil {
+		return prg, errors.Wrap(err)
+	}
+
 	args := []string{
 		fmt.Sprintf("%s/usr/bin/clr-boot-manager", rootDir),
 		"update",
@@ -515,15 +1009,24 @@ func contentInstall(rootDir string, version string, model *model.SystemInstall,
 	if err != nil {
 		return prg, errors.Wrap(err)
 	}
+
+	if err = configureBootMenu(rootDir, model.BootMenu); err != nil {
+		return prg, err
+	}
 	prg.Success()
 
-	// Clean-up State Directory content
-	if options.SwupdStateClean {
-		msg = utils.Locale.Get("Cleaning Swupd state directory")
+	// the unified kernel images are built from the boot entries written
+	// by clr-boot-manager
+	if model.UKI != nil && model.UKI.Enabled {
+		msg = utils.Locale.Get("Building the unified kernel images")
 		prg = progress.NewLoop(msg)
 		log.Info(msg)
-		if err = sw.CleanUpState(); err != nil {
-			log.ErrorError(err)
+		if err = kernel.WriteUKIConfig(rootDir, model.UKI); err != nil {
+			return prg, err
+		}
+
+		if err = kernel.GenerateUKI(rootDir, model.UKI); err != nil {
+			return prg, err
 		}
 		prg.Success()
 	}
@@ -531,9 +1034,40 @@ func contentInstall(rootDir string, version string, model *model.SystemInstall,
 	return nil, nil
 }
 
+// correctClock corrects the installer clock when it's too far off for the
+// update server certificate to validate, i.e a dead CMOS battery
+func correctClock() (progress.Progress, error) {
+	skew, err := network.ClockSkew()
+	if err != nil {
+		log.Warning("Could not check the system clock: %v", err)
+		return nil, nil
+	}
+
+	if !network.IsClockSkewed(skew) {
+		return nil, nil
+	}
+
+	msg := utils.Locale.Get("Correcting the system clock")
+	prg := progress.NewLoop(msg)
+	log.Info("%s, off by %v", msg, skew)
+	if err = network.CorrectClock(); err != nil {
+		return prg, errors.Errorf("%s", utils.Locale.Get("The system clock is wrong, set it and retry: %v", err))
+	}
+	prg.Success()
+
+	return nil, nil
+}
+
 // ConfigureNetwork applies the model/configured network interfaces
 func ConfigureNetwork(model *model.SystemInstall) error {
-	prg, err := configureNetwork(model)
+	return applyNetwork(model, true)
+}
+
+// applyNetwork configures the installer network and records whether it's
+// passing, the host name resolution, interfaces and clock are only touched if
+// host is set, otherwise only the proxy is configured
+func applyNetwork(model *model.SystemInstall, host bool) error {
+	prg, err := configureNetwork(model, host)
 	if err != nil {
 		prg.Success()
 		NetworkPassing = false
@@ -545,25 +1079,14 @@ func ConfigureNetwork(model *model.SystemInstall) error {
 	return nil
 }
 
-func configureNetwork(model *model.SystemInstall) (progress.Progress, error) {
+func configureNetwork(model *model.SystemInstall, host bool) (progress.Progress, error) {
 	cmd.SetHTTPSProxy(model.HTTPSProxy)
+	cmd.SetNoProxy(network.NoProxyValue(model.NoProxy, model.SwupdMirror))
 
-	if len(model.NetworkInterfaces) > 0 {
-		msg := "Applying network settings"
-		prg := progress.NewLoop(msg)
-		log.Info(msg)
-		if err := network.Apply("/", model.NetworkInterfaces); err != nil {
-			return prg, err
-		}
-		prg.Success()
-
-		msg = utils.Locale.Get("Restarting network interfaces")
-		prg = progress.NewLoop(msg)
-		log.Info(msg)
-		if err := network.Restart(); err != nil {
+	if host {
+		if prg, err := configureHostNetwork(model); err != nil {
 			return prg, err
 		}
-		prg.Success()
 	}
 
 	msg := utils.Locale.Get("Testing connectivity")
@@ -581,6 +1104,10 @@ func configureNetwork(model *model.SystemInstall) (progress.Progress, error) {
 		}
 		log.Warning("Attempt to verify connectivity failed")
 
+		if !host {
+			continue
+		}
+
 		// Restart networking if we failed
 		// The likely gain is restarting pacdiscovery to fix autoproxy
 		if err := network.Restart(); err != nil {
@@ -591,7 +1118,7 @@ func configureNetwork(model *model.SystemInstall) (progress.Progress, error) {
 	}
 
 	if !ok {
-		return prg, errors.Errorf(utils.Locale.Get("Network is not working."))
+		return prg, errors.Errorf("%s", utils.Locale.Get("Network is not working."))
 	}
 
 	prg.Success()
@@ -599,6 +1126,50 @@ func configureNetwork(model *model.SystemInstall) (progress.Progress, error) {
 	return nil, nil
 }
 
+// configureHostNetwork applies the installer name resolution, wireless network
+// and interfaces to the host and corrects its clock
+func configureHostNetwork(model *model.SystemInstall) (progress.Progress, error) {
+	if len(model.InstallerDNS) > 0 || len(model.InstallerHosts) > 0 {
+		msg := utils.Locale.Get("Configuring the installer name resolution")
+		prg := progress.NewLoop(msg)
+		log.Info(msg)
+		if err := network.ApplyInstallerResolution(model.InstallerDNS, model.InstallerHosts); err != nil {
+			return prg, err
+		}
+		prg.Success()
+	}
+
+	if model.Wireless != nil {
+		msg := utils.Locale.Get("Joining the wireless network %s", model.Wireless.SSID)
+		prg := progress.NewLoop(msg)
+		log.Info(msg)
+		if err := model.Wireless.Connect(); err != nil {
+			return prg, err
+		}
+		prg.Success()
+	}
+
+	if len(model.NetworkInterfaces) > 0 {
+		msg := "Applying network settings"
+		prg := progress.NewLoop(msg)
+		log.Info(msg)
+		if err := network.Apply("/", model.NetworkInterfaces); err != nil {
+			return prg, err
+		}
+		prg.Success()
+
+		msg = utils.Locale.Get("Restarting network interfaces")
+		prg = progress.NewLoop(msg)
+		log.Info(msg)
+		if err := network.Restart(); err != nil {
+			return prg, err
+		}
+		prg.Success()
+	}
+
+	return correctClock()
+}
+
 // configureTimezone applies the model/configured Timezone to the target
 func configureTimezone(rootDir string, model *model.SystemInstall) error {
 	if model.Timezone.Code == timezone.DefaultTimezone {
@@ -620,19 +1191,33 @@ func configureTimezone(rootDir string, model *model.SystemInstall) error {
 	return nil
 }
 
-// configureKeyboard applies the model/configured keyboard to the target
+// configureKeyboard applies the model/configured console keymap and X11
+// keyboard to the target
 func configureKeyboard(rootDir string, model *model.SystemInstall) error {
 	if model.Keyboard.Code == keyboard.DefaultKeyboard {
 		log.Debug("Skipping setting keyboard " + model.Keyboard.Code)
+	} else {
+		msg := "Setting Keyboard to " + model.Keyboard.Code
+		prg := progress.NewLoop(msg)
+		log.Info(msg)
+
+		err := keyboard.SetTargetKeyboard(rootDir, model.Keyboard.Code)
+		if err != nil {
+			prg.Failure()
+			return err
+		}
+		prg.Success()
+	}
+
+	if model.X11Keyboard == nil {
 		return nil
 	}
 
-	msg := "Setting Keyboard to " + model.Keyboard.Code
+	msg := "Setting X11 Keyboard to " + model.X11Keyboard.String()
 	prg := progress.NewLoop(msg)
 	log.Info(msg)
 
-	err := keyboard.SetTargetKeyboard(rootDir, model.Keyboard.Code)
-	if err != nil {
+	if err := keyboard.SetTargetX11Keyboard(rootDir, model.X11Keyboard); err != nil {
 		prg.Failure()
 		return err
 	}
@@ -643,21 +1228,72 @@ func configureKeyboard(rootDir string, model *model.SystemInstall) error {
 
 // configureLanguage applies the model/configured language to the target
 func configureLanguage(rootDir string, model *model.SystemInstall) error {
-	if model.Language.Code == language.DefaultLanguage {
-		log.Debug("Skipping setting language locale " + model.Language.Code)
+	locale := model.GetTargetLocale()
+	if locale.Code == language.DefaultLanguage {
+		log.Debug("Skipping setting language locale " + locale.Code)
 		return nil
 	}
 
-	msg := utils.Locale.Get("Setting Language locale to %s", model.Language.Code)
+	msg := utils.Locale.Get("Setting Language locale to %s", locale.Code)
+	prg := progress.NewLoop(msg)
+	log.Info(msg)
+
+	err := language.SetTargetLanguage(rootDir, locale.Code)
+	if err != nil {
+		prg.Failure()
+		return err
+	}
+	prg.Success()
+
+	return nil
+}
+
+// verifyMeasuredBoot checks the system supports the measured boot and records
+// the expected measurements of the installed boot chain, a missing support
+// only fails the install with the fail policy
+func verifyMeasuredBoot(rootDir string, md *model.SystemInstall) error {
+	msg := utils.Locale.Get("Verifying the measured boot")
 	prg := progress.NewLoop(msg)
 	log.Info(msg)
 
-	err := language.SetTargetLanguage(rootDir, model.Language.Code)
-	//utils.SetLocale(model.Language.Code)
+	if err := tpm.Check(); err != nil {
+		if md.MeasuredBoot == syscheck.PolicyFail {
+			prg.Failure()
+			return err
+		}
+		log.Warning("Measured boot is not supported: %v", err)
+	}
+
+	ms, err := tpm.Measure(rootDir)
 	if err != nil {
 		prg.Failure()
 		return err
 	}
+
+	if err = ms.Write(rootDir); err != nil {
+		prg.Failure()
+		return err
+	}
+
+	log.Info("Recorded the expected measurements to: %s", tpm.MeasurementsFile)
+	prg.Success()
+
+	return nil
+}
+
+// registerBMC sets the next boot device back to the disk and records the
+// install completion with the BMC Redfish service, a failure fails the install
+// so a PXE provisioned system doesn't reboot to a new install
+func registerBMC(md *model.SystemInstall) error {
+	msg := utils.Locale.Get("Registering the install with the BMC")
+	prg := progress.NewLoop(msg)
+	log.Info(msg)
+
+	if err := bmc.Register(md.BMC, fmt.Sprintf("clear-linux-os-%s", utils.ClearVersion)); err != nil {
+		prg.Failure()
+		return err
+	}
+
 	prg.Success()
 
 	return nil
@@ -687,6 +1323,8 @@ func saveInstallResults(rootDir string, md *model.SystemInstall) error {
 	cleanModel.Hostname = ""           // Remove user defined hostname
 	cleanModel.HTTPSProxy = ""         // Remove user defined Proxy
 	cleanModel.SwupdMirror = ""        // Remove user defined Swupd Mirror
+	cleanModel.SwupdTLS = nil          // Remove the Swupd Mirror certificates
+	cleanModel.TargetEnv = nil         // Remove the target environment
 	cleanModel.NetworkInterfaces = nil // Remove Network information
 
 	// Remove the Serial number from the target media
@@ -730,6 +1368,13 @@ func saveInstallResults(rootDir string, md *model.SystemInstall) error {
 			errMsgs = append(errMsgs, "Failed to archive log file")
 		}
 
+		if runDir := log.GetRunDir(); runDir != "" {
+			if err := log.ExportTasks(filepath.Join(saveDir, filepath.Base(runDir)), nil); err != nil {
+				log.Error("Failed to archive the task logs (%v)", err)
+				errMsgs = append(errMsgs, "Failed to archive the task logs")
+			}
+		}
+
 	} else {
 		log.Info("Skipping archiving of Installation results")
 	}
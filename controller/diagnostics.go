@@ -0,0 +1,81 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package controller
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/clearlinux/clr-installer/cmd"
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/log"
+	"github.com/clearlinux/clr-installer/model"
+)
+
+const (
+	journaldDropIn = "etc/systemd/journald.conf.d/clr-installer.conf"
+	coredumpDropIn = "etc/systemd/coredump.conf.d/clr-installer.conf"
+	systemDropIn   = "etc/systemd/system.conf.d/clr-installer-coredump.conf"
+	kdumpService   = "usr/lib/systemd/system/kdump.service"
+)
+
+// configureDiagnostics writes the target configuration of the enabled
+// diagnostics, the kdump crash kernel argument is added before the install
+func configureDiagnostics(rootDir string, dg *model.Diagnostics) error {
+	if dg == nil {
+		return nil
+	}
+
+	if dg.PersistentJournal {
+		// journald only persists the logs if the journal directory exists
+		if err := os.MkdirAll(filepath.Join(rootDir, "var/log/journal"), 0755); err != nil {
+			return errors.Wrap(err)
+		}
+
+		if err := writeDropIn(rootDir, journaldDropIn, "[Journal]\nStorage=persistent\n"); err != nil {
+			return err
+		}
+	}
+
+	if dg.CoreDumps {
+		if err := writeDropIn(rootDir, coredumpDropIn, "[Coredump]\nStorage=external\n"); err != nil {
+			return err
+		}
+
+		// the core dumps are disabled by the default resource limit
+		if err := writeDropIn(rootDir, systemDropIn, "[Manager]\nDefaultLimitCORE=infinity\n"); err != nil {
+			return err
+		}
+	}
+
+	if dg.Kdump {
+		if _, err := os.Stat(filepath.Join(rootDir, kdumpService)); err != nil {
+			log.Warning("No kdump service installed, only the crash kernel memory is reserved")
+			return nil
+		}
+
+		if err := cmd.RunAndLog("chroot", rootDir, "systemctl", "enable", "kdump.service"); err != nil {
+			return errors.Wrap(err)
+		}
+	}
+
+	return nil
+}
+
+// writeDropIn writes a target configuration drop-in file
+func writeDropIn(rootDir string, file string, content string) error {
+	path := filepath.Join(rootDir, file)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return errors.Wrap(err)
+	}
+
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		return errors.Wrap(err)
+	}
+
+	return nil
+}
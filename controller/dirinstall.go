@@ -0,0 +1,223 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package controller
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/clearlinux/clr-installer/args"
+	"github.com/clearlinux/clr-installer/cmd"
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/log"
+	"github.com/clearlinux/clr-installer/model"
+	"github.com/clearlinux/clr-installer/oci"
+	"github.com/clearlinux/clr-installer/progress"
+	"github.com/clearlinux/clr-installer/storage"
+	"github.com/clearlinux/clr-installer/swupd"
+	"github.com/clearlinux/clr-installer/utils"
+)
+
+// installToDir installs the software and the configuration of the model into
+// the plain directory dir, the target medias and the boot loader are left out;
+// the directory is kept, archived to options.RootfsTarball and exported to the
+// image layout options.OCIImage if set
+func installToDir(dir string, md *model.SystemInstall, options args.Args) error {
+	var err error
+
+	if dir, err = filepath.Abs(dir); err != nil {
+		return errors.Wrap(err)
+	}
+
+	vars := map[string]string{
+		"chrootDir": dir,
+		"yamlDir":   filepath.Dir(options.ConfigFile),
+	}
+
+	for k, v := range md.Environment {
+		vars[k] = v
+	}
+
+	if err = md.ValidateContent(); err != nil {
+		return err
+	}
+
+	if options.OCIImage != "" {
+		if err = oci.ValidateTag(options.OCITag); err != nil {
+			return err
+		}
+	}
+
+	// they require the target medias or their boot chain
+	if md.Snapshots {
+		log.Warning("The automatic snapshots are not configured by an install to a directory")
+		md.Snapshots = false
+	}
+
+	if md.SwapFileSize != "" {
+		log.Warning("The swap file is not created by an install to a directory")
+		md.SwapFileSize = ""
+	}
+
+	if md.MeasuredBoot != "" {
+		log.Warning("The measured boot is not verified by an install to a directory")
+		md.MeasuredBoot = ""
+	}
+
+	if md.HomeEncryption != "" {
+		log.Warning("The home directories are not encrypted by an install to a directory")
+		md.HomeEncryption = ""
+	}
+
+	if len(md.InstallerDNS) > 0 || len(md.InstallerHosts) > 0 || md.Wireless != nil ||
+		len(md.NetworkInterfaces) > 0 {
+		log.Warning("The host network is not configured by an install to a directory")
+	}
+
+	if err = utils.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	version := targetVersion(md)
+	log.Debug("Clear Linux version: %s", version)
+
+	// the offline installs use the install media content, never the network
+	if md.Offline {
+		if options.SwupdContentURL, err = offlineContentURL(md); err != nil {
+			return err
+		}
+		options.SwupdVersionURL = options.SwupdContentURL
+	}
+
+	// the host network belongs to the running system, only the proxy is set
+	if !NetworkPassing && !md.Offline {
+		if err = applyNetwork(md, false); err != nil {
+			return err
+		}
+	}
+
+	if err = applyHooks("pre-install", vars, md.PreInstall); err != nil {
+		return err
+	}
+
+	addRequiredBundles(md)
+
+	if err = swupd.ConfigureTLS("/", md.SwupdTLS); err != nil {
+		return err
+	}
+
+	if options.SwupdStateDir == "" {
+		if options.SwupdStateDir, err = ioutil.TempDir("", "clr-installer-swupd-"); err != nil {
+			return errors.Wrap(err)
+		}
+
+		stagingDir := options.SwupdStateDir
+		defer func() { _ = os.RemoveAll(stagingDir) }()
+	}
+
+	if err = installDirContent(dir, version, vars, md, options); err != nil {
+		return err
+	}
+
+	if options.RootfsTarball != "" {
+		msg := utils.Locale.Get("Archiving the root file system")
+		prg := progress.NewLoop(msg)
+		log.Info(msg)
+		if err = archiveRootfs(dir, options.RootfsTarball); err != nil {
+			prg.Failure()
+			return err
+		}
+		prg.Success()
+	}
+
+	if options.OCIImage != "" {
+		msg := utils.Locale.Get("Exporting the container image")
+		prg := progress.NewLoop(msg)
+		log.Info(msg)
+		if err = exportImage(dir, options.OCIImage, options.OCITag); err != nil {
+			prg.Failure()
+			return err
+		}
+		prg.Success()
+	}
+
+	msg := utils.Locale.Get("Installation completed")
+	prg := progress.NewLoop(msg)
+	log.Info(msg)
+	prg.Success()
+
+	return nil
+}
+
+// installDirContent installs the bundles and configures the system at dir,
+// the meta file systems are only mounted meanwhile
+func installDirContent(dir string, version string, vars map[string]string,
+	md *model.SystemInstall, options args.Args) error {
+	if err := storage.MountMetaFs(dir); err != nil {
+		return err
+	}
+
+	defer func() {
+		log.Info("Umounting the meta file systems of: %s", dir)
+		if storage.UmountAll() != nil {
+			log.Warning("Failed to umount volumes")
+		}
+	}()
+
+	prg, err := contentInstall(dir, version, md, options)
+	if err != nil {
+		prg.Failure()
+		return err
+	}
+
+	if err = checkAborted(); err != nil {
+		return err
+	}
+
+	if err = configureTarget(dir, vars, md, nil); err != nil {
+		return err
+	}
+
+	msg := utils.Locale.Get("Saving the installation results")
+	prg = progress.NewLoop(msg)
+	log.Info(msg)
+	if err = saveInstallResults(dir, md); err != nil {
+		log.ErrorError(err)
+	}
+	prg.Success()
+
+	return nil
+}
+
+// archiveRootfs writes the tarball file of the root file system at dir, the
+// owners are kept numeric since the users are the ones of the target; the
+// tarball is compressed following the file suffix
+func archiveRootfs(dir string, file string) error {
+	if err := cmd.RunAndLog("tar", "--numeric-owner", "--xattrs", "--auto-compress",
+		"-C", dir, "-cf", file, "."); err != nil {
+		return errors.Wrap(err)
+	}
+
+	return nil
+}
+
+// exportImage adds the root file system at dir as the image tag of the OCI
+// image layout at layout
+func exportImage(dir string, layout string, tag string) error {
+	// the uncompressed layer may not fit a tmpfs /tmp
+	tmpDir, err := ioutil.TempDir(filepath.Dir(layout), "clr-installer-oci-")
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	defer func() { _ = os.RemoveAll(tmpDir) }()
+
+	layer := filepath.Join(tmpDir, "rootfs.tar")
+	if err = archiveRootfs(dir, layer); err != nil {
+		return err
+	}
+
+	return oci.WriteLayout(layout, layer, tag)
+}
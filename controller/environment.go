@@ -0,0 +1,94 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package controller
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/model"
+)
+
+const (
+	environmentFile = "etc/environment"
+	profileScript   = "etc/profile.d/clr-installer.sh"
+)
+
+// configureEnvironment writes the target environment variables, the
+// /etc/environment ones are merged with the existing file and the profile
+// ones are exported by a profile.d script
+func configureEnvironment(rootDir string, vars []*model.EnvVariable) error {
+	env := map[string]string{}
+	names := []string{}
+	exports := []string{}
+
+	for _, curr := range vars {
+		if curr.Profile {
+			value := strings.Replace(curr.Value, "'", `'\''`, -1)
+			exports = append(exports, fmt.Sprintf("export %s='%s'", curr.Name, value))
+			continue
+		}
+
+		env[curr.Name] = curr.Value
+		names = append(names, curr.Name)
+	}
+
+	if len(names) > 0 {
+		if err := mergeEnvironment(rootDir, names, env); err != nil {
+			return err
+		}
+	}
+
+	if len(exports) > 0 {
+		content := "# Environment declared in the installer configuration\n" +
+			strings.Join(exports, "\n") + "\n"
+
+		if err := writeDropIn(rootDir, profileScript, content); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// mergeEnvironment replaces the variables of the target /etc/environment,
+// the other variables, i.e no_proxy, are kept
+func mergeEnvironment(rootDir string, names []string, env map[string]string) error {
+	file := filepath.Join(rootDir, environmentFile)
+
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return errors.Wrap(err)
+	}
+
+	content, err := ioutil.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err)
+	}
+
+	lines := []string{}
+	for _, curr := range strings.Split(strings.TrimRight(string(content), "\n"), "\n") {
+		if curr == "" {
+			continue
+		}
+
+		if _, ok := env[strings.SplitN(curr, "=", 2)[0]]; !ok {
+			lines = append(lines, curr)
+		}
+	}
+
+	for _, curr := range names {
+		lines = append(lines, fmt.Sprintf("%s=%s", curr, env[curr]))
+	}
+
+	if err = ioutil.WriteFile(file, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		return errors.Wrap(err)
+	}
+
+	return nil
+}
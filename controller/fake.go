@@ -0,0 +1,157 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package controller
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/clearlinux/clr-installer/args"
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/log"
+	"github.com/clearlinux/clr-installer/model"
+	"github.com/clearlinux/clr-installer/progress"
+	"github.com/clearlinux/clr-installer/storage"
+	"github.com/clearlinux/clr-installer/utils"
+)
+
+// fakeStep is a scripted step of the fake install, partials is the number of
+// Partial updates sent by the step, 0 meaning a Loop progress
+type fakeStep struct {
+	desc     string
+	partials int
+}
+
+// fakeInstall replaces the install with a scripted sequence of steps for the
+// frontends development, nothing is written to the target medias. The steps
+// timing is derived from options.FakeInstallSeed so every run with the same
+// seed is identical, and the install fails at step options.FakeInstallFailAt
+func fakeInstall(md *model.SystemInstall, options args.Args) error {
+	rnd := rand.New(rand.NewSource(options.FakeInstallSeed))
+
+	log.Info("Fake install, seed: %d fail at step: %d", options.FakeInstallSeed, options.FakeInstallFailAt)
+
+	// nothing is read from a device nor enrolled to the TPM
+	if md.EncryptionRequiresPassphrase() && md.CryptPass == "" &&
+		md.CryptKeys.PassphrasePolicy() == storage.PassphrasePrompt {
+		if err := askPassphrase(md); err != nil {
+			return err
+		}
+	}
+
+	if md.CryptKeys != nil && md.CryptKeys.Recovery && md.CryptKeys.RecoveryKey == "" {
+		md.CryptKeys.RecoveryKey = fakeRecoveryKey(rnd)
+	}
+
+	for i, step := range fakeSteps(md) {
+		num := i + 1
+		duration := time.Duration(500+rnd.Intn(2500)) * time.Millisecond
+		failed := num == options.FakeInstallFailAt
+
+		log.Info("Fake install step %d: %s", num, step.desc)
+
+		var prg progress.Progress
+		if step.partials == 0 {
+			prg = progress.NewLoop(step.desc)
+			time.Sleep(duration)
+		} else {
+			prg = progress.MultiStep(step.partials, step.desc)
+			for j := 1; j <= step.partials; j++ {
+				// stop half way through the failing step
+				if failed && j > step.partials/2 {
+					break
+				}
+				time.Sleep(duration / time.Duration(step.partials))
+				prg.Partial(j)
+			}
+		}
+
+		if failed {
+			prg.Failure()
+			return errors.Errorf("Fake install failure at step %d: %s", num, step.desc)
+		}
+
+		prg.Success()
+	}
+
+	prg := progress.NewLoop(utils.Locale.Get("Installation completed"))
+	prg.Success()
+
+	return nil
+}
+
+// fakeSteps returns the fake install steps, following the real install
+// sequence for the model's target medias and bundles
+func fakeSteps(md *model.SystemInstall) []fakeStep {
+	steps := []fakeStep{}
+
+	for _, disk := range md.TargetMedias {
+		desc := utils.Locale.Get("Writing partition table to: %s", disk.Name)
+		if disk.IsVolumeGroup() {
+			desc = utils.Locale.Get("Creating the volume group: %s", disk.Name)
+		} else if disk.IsRAIDArray() {
+			desc = utils.Locale.Get("Creating the RAID array: %s", disk.Name)
+		}
+		steps = append(steps, fakeStep{desc: desc})
+
+		for _, part := range disk.Children {
+			if part.Type == storage.BlockDeviceTypeCrypt && part.FsTypeNotSwap() {
+				steps = append(steps, fakeStep{
+					desc: utils.Locale.Get("Mapping %s partition to an encrypted partition", part.Name),
+				})
+			}
+
+			if !part.FormatPartition {
+				continue
+			}
+
+			desc := utils.Locale.Get("Writing %s file system to %s", part.FsType, part.Name)
+			if part.MountPoint != "" {
+				desc = desc + fmt.Sprintf(" '%s'", part.MountPoint)
+			}
+			steps = append(steps, fakeStep{desc: desc})
+		}
+	}
+
+	bundles := 1 + len(md.Bundles)
+	if md.Kernel != nil && md.Kernel.Bundle != "" {
+		bundles++
+	}
+
+	steps = append(steps,
+		fakeStep{desc: utils.Locale.Get("Installing base OS and configured bundles"), partials: bundles * 100},
+		fakeStep{desc: utils.Locale.Get("Writing mount files")},
+		fakeStep{desc: utils.Locale.Get("Installing boot loader")},
+	)
+
+	if len(md.PostInstall) > 0 {
+		steps = append(steps, fakeStep{desc: utils.Locale.Get("Running %s hooks", "post-install")})
+	}
+
+	if md.MeasuredBoot != "" {
+		steps = append(steps, fakeStep{desc: utils.Locale.Get("Verifying the measured boot")})
+	}
+
+	steps = append(steps, fakeStep{desc: utils.Locale.Get("Saving the installation results")})
+
+	if md.BMC != nil {
+		steps = append(steps, fakeStep{desc: utils.Locale.Get("Registering the install with the BMC")})
+	}
+
+	return steps
+}
+
+// fakeRecoveryKey returns a recovery key like value derived from rnd
+func fakeRecoveryKey(rnd *rand.Rand) string {
+	groups := []string{}
+
+	for i := 0; i < 8; i++ {
+		groups = append(groups, fmt.Sprintf("%04x", rnd.Intn(0x10000)))
+	}
+
+	return strings.Join(groups, "-")
+}
@@ -0,0 +1,565 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package controller
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/clearlinux/clr-installer/args"
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/log"
+	"github.com/clearlinux/clr-installer/model"
+	"github.com/clearlinux/clr-installer/progress"
+	"github.com/clearlinux/clr-installer/storage"
+	"github.com/clearlinux/clr-installer/utils"
+)
+
+const (
+	// partitioningLogTask is the task log file of the target medias partitioning,
+	// formatting and mounting
+	partitioningLogTask = "partitioning"
+
+	// swupdLogTask is the task log file of the OS content install
+	swupdLogTask = "swupd"
+)
+
+var (
+	// contentIndependentMounts are the mount points the OS content is never
+	// installed to, their partitions are prepared while the content is installed
+	contentIndependentMounts = []string{"/home", "/srv"}
+)
+
+// newTaskLoop logs msg and creates a Loop progress, the background tasks
+// must not report progress
+func newTaskLoop(background bool, msg string) progress.Progress {
+	log.Info(msg)
+
+	return progress.Reporter{Quiet: background}.NewLoop("%s", msg)
+}
+
+// installTasks returns the install tasks from partitioning the target medias
+// to installing the OS content, the resources passed between tasks are:
+//   - table:<disk> the disk partition table is written
+//   - fs:<partition> the partition is mapped and formatted
+//   - mount:<mount point> the partition is mounted to the target root
+//   - scan, raidconf, tabfiles, metafs, cmdline, prefetch and content for the
+//     remaining steps, the content task requires all the other ones
+//   - partitioned once the partitions not required by the content, see
+//     contentIndependentMounts, are formatted and the tab files updated
+//
+// The tasks of a disk are serialized, with multiple target medias the disks are
+// prepared concurrently, see mediasTask(). In stub image mode only the target
+// medias are prepared. The phases completed by a resumed install, see cp, are
+// skipped: its partitions are only reopened.
+func installTasks(rootDir string, version string, md *model.SystemInstall, options args.Args,
+	cp *checkpoint) []*task {
+	tasks := []*task{}
+	diskTasks := []*task{}
+	formatted := []string{}
+	lateFormatted := []string{}
+	mounts := []*storage.BlockDevice{}
+	multiDisk := len(md.TargetMedias) > 1
+	partitioned := cp.Done(phasePartitioning)
+
+	for _, curr := range md.TargetMedias {
+		disk := curr
+		table := "table:" + disk.Name
+
+		// the output of the commands preparing the disk is in the
+		// partitioning task log
+		disk.SetTaskLog(log.TaskWriter(partitioningLogTask))
+
+		if disk.IsVolumeGroup() {
+			diskTasks = append(diskTasks, volumeGroupTask(disk, md, multiDisk, partitioned))
+		} else if disk.IsRAIDArray() {
+			diskTasks = append(diskTasks, raidArrayTask(disk, md, multiDisk, partitioned))
+		} else {
+			diskTasks = append(diskTasks, &task{
+				name:       "partition " + disk.Name,
+				outputs:    []string{table},
+				background: multiDisk,
+				device:     disk.Name,
+				logTask:    partitioningLogTask,
+				run: func() error {
+					if partitioned {
+						return nil
+					}
+
+					return disk.WritePartitionTable(md.LegacyBios, md.InstallSelected.WholeDisk,
+						progress.Reporter{Quiet: multiDisk})
+				},
+			})
+		}
+
+		for _, ch := range disk.Children {
+			part := ch
+			background := multiDisk || !requiredByContent(part)
+
+			format := &task{
+				name:       "format " + part.Name,
+				inputs:     []string{table},
+				outputs:    []string{"fs:" + part.Name},
+				background: background,
+				device:     disk.Name,
+				logTask:    partitioningLogTask,
+				run: func() error {
+					return formatPartition(part, md, background, partitioned)
+				},
+			}
+
+			// the partitions not required by the content are formatted
+			// while the content is installed, the physical volumes and
+			// RAID members are required by their volume group or array
+			if requiredByContent(part) || part.IsPhysicalVolume() || part.IsRAIDMember() {
+				diskTasks = append(diskTasks, format)
+				formatted = append(formatted, "fs:"+part.Name)
+			} else {
+				tasks = append(tasks, format)
+				lateFormatted = append(lateFormatted, "fs:"+part.Name)
+			}
+
+			// only the new file systems are mounted
+			if part.FormatPartition && part.MountPoint != "" {
+				mounts = append(mounts, part)
+			}
+		}
+	}
+
+	if multiDisk {
+		tasks = append([]*task{mediasTask(diskTasks, len(md.TargetMedias))}, tasks...)
+	} else {
+		tasks = append(diskTasks, tasks...)
+	}
+
+	// Update the target devices current labels and UUIDs, the content only
+	// waits for the partitions it requires
+	tasks = append(tasks, &task{
+		name:       "scan",
+		inputs:     formatted,
+		outputs:    []string{"scan"},
+		background: true,
+		logTask:    partitioningLogTask,
+		run: func() error {
+			return storage.UpdateBlockDevices(md.TargetMedias)
+		},
+	})
+
+	// the remaining partitions are scanned once formatted and their fstab
+	// entries written, the tab files are then complete
+	partitionedInputs := append([]string{"scan"}, lateFormatted...)
+	if !options.StubImage {
+		partitionedInputs = append(partitionedInputs, "tabfiles")
+	}
+
+	tasks = append(tasks, &task{
+		name:       "partitioned",
+		inputs:     partitionedInputs,
+		outputs:    []string{"partitioned"},
+		background: true,
+		logTask:    partitioningLogTask,
+		run: func() error {
+			if len(lateFormatted) > 0 {
+				if err := storage.UpdateBlockDevices(md.TargetMedias); err != nil {
+					return err
+				}
+
+				if !options.StubImage {
+					if err := storage.GenerateTabFiles(rootDir, md.TargetMedias); err != nil {
+						return err
+					}
+				}
+			}
+
+			cp.Complete(phasePartitioning)
+			return nil
+		},
+	})
+
+	if options.StubImage {
+		return tasks
+	}
+
+	rootMounted := []string{}
+	contentInputs := []string{"metafs", "cmdline", "prefetch"}
+
+	for _, curr := range mounts {
+		bd := curr
+		inputs := []string{"fs:" + bd.Name}
+
+		if parent := parentMount(bd, mounts); parent != nil {
+			inputs = append(inputs, "mount:"+parent.MountPoint)
+		}
+
+		if bd.MountPoint == "/" {
+			rootMounted = append(rootMounted, "mount:/")
+		}
+
+		if requiredByContent(bd) {
+			contentInputs = append(contentInputs, "mount:"+bd.MountPoint)
+		}
+
+		tasks = append(tasks, &task{
+			name:       "mount " + bd.MountPoint,
+			inputs:     inputs,
+			outputs:    []string{"mount:" + bd.MountPoint},
+			background: true,
+			logTask:    partitioningLogTask,
+			run: func() error {
+				log.Info("Mounting: %s", bd.MountPoint)
+				return bd.Mount(rootDir)
+			},
+		})
+	}
+
+	// the arrays are assembled by the initrd from their mdadm.conf, it's
+	// written before clr-boot-manager installs the kernel
+	if storage.RAIDArraysUsed(md.TargetMedias) {
+		inputs := append([]string{}, rootMounted...)
+		for _, curr := range md.TargetMedias {
+			if curr.IsRAIDArray() {
+				inputs = append(inputs, "table:"+curr.Name)
+			}
+		}
+
+		tasks = append(tasks, &task{
+			name:       "raid conf",
+			inputs:     inputs,
+			outputs:    []string{"raidconf"},
+			background: true,
+			logTask:    partitioningLogTask,
+			run: func() error {
+				return storage.WriteRAIDConf(rootDir, md.TargetMedias)
+			},
+		})
+		contentInputs = append(contentInputs, "raidconf")
+	}
+
+	// fstab and crypttab are written before swupd and clr-boot-manager run,
+	// the partitions not scanned yet are updated by the partitioned task
+	tasks = append(tasks, &task{
+		name:    "tab files",
+		inputs:  append([]string{"scan"}, rootMounted...),
+		outputs: []string{"tabfiles"},
+		run: func() error {
+			prg := newTaskLoop(false, utils.Locale.Get("Writing mount files"))
+			if err := storage.GenerateTabFiles(rootDir, md.TargetMedias); err != nil {
+				prg.Failure()
+				return err
+			}
+			prg.Success()
+			return nil
+		},
+	})
+	contentInputs = append(contentInputs, "tabfiles")
+
+	tasks = append(tasks,
+		&task{
+			name:       "metafs",
+			inputs:     rootMounted,
+			outputs:    []string{"metafs"},
+			background: true,
+			run: func() error {
+				return storage.MountMetaFs(rootDir)
+			},
+		},
+		&task{
+			name:       "cmdline",
+			inputs:     rootMounted,
+			outputs:    []string{"cmdline"},
+			background: true,
+			run: func() error {
+				return writeKernelCmdline(rootDir, md)
+			},
+		},
+		&task{
+			name:       "prefetch",
+			outputs:    []string{"prefetch"},
+			background: true,
+			logTask:    swupdLogTask,
+			run: func() error {
+				if !cp.Done(phaseBundles) {
+					prefetchContent(version, md, options)
+				}
+				return nil
+			},
+		},
+		&task{
+			name:    "content",
+			inputs:  contentInputs,
+			outputs: []string{"content"},
+			run: func() error {
+				if !cp.Skip(phaseBundles) {
+					log.BeginTask(swupdLogTask)
+					prg, err := contentInstall(rootDir, version, md, options)
+					log.EndTask(swupdLogTask, err)
+					if err != nil {
+						prg.Failure()
+						return err
+					}
+					cp.Complete(phaseBundles)
+				}
+
+				if !cp.Skip(phaseBootloader) {
+					prg, err := bootloaderInstall(rootDir, md)
+					if err != nil {
+						prg.Failure()
+						return err
+					}
+					cp.Complete(phaseBootloader)
+				}
+
+				return nil
+			},
+		},
+	)
+
+	return tasks
+}
+
+// mediasTask wraps the tasks preparing multiple target medias in a single
+// foreground task, the wrapped tasks run concurrently across the disks but
+// serialized per disk, and their completion is reported as an aggregated progress
+func mediasTask(tasks []*task, disks int) *task {
+	outputs := []string{}
+
+	for _, curr := range tasks {
+		outputs = append(outputs, curr.outputs...)
+	}
+
+	return &task{
+		name:    "target medias",
+		outputs: outputs,
+		run: func() error {
+			msg := utils.Locale.Get("Preparing %d target medias", disks)
+			log.Info(msg)
+			prg := progress.MultiStep(len(tasks), "%s", msg)
+
+			var mutex sync.Mutex
+			completed := 0
+
+			for _, curr := range tasks {
+				run := curr.run
+				curr.run = func() error {
+					if err := run(); err != nil {
+						return err
+					}
+
+					mutex.Lock()
+					defer mutex.Unlock()
+
+					completed++
+					prg.Partial(completed)
+					return nil
+				}
+			}
+
+			if err := runTasks(tasks); err != nil {
+				prg.Failure()
+				return err
+			}
+			prg.Success()
+
+			return nil
+		},
+	}
+}
+
+// requiredByContent returns true if the OS content install requires the partition
+func requiredByContent(bd *storage.BlockDevice) bool {
+	if bd.MountPoint == "" {
+		return false
+	}
+
+	for _, curr := range contentIndependentMounts {
+		if bd.MountPoint == curr || strings.HasPrefix(bd.MountPoint, curr+"/") {
+			return false
+		}
+	}
+
+	return true
+}
+
+// parentMount returns the partition mounted to the closest parent
+// directory of bd's mount point, nil if there is none
+func parentMount(bd *storage.BlockDevice, mounts []*storage.BlockDevice) *storage.BlockDevice {
+	var result *storage.BlockDevice
+
+	for _, curr := range mounts {
+		if curr == bd || curr.MountPoint == bd.MountPoint {
+			continue
+		}
+
+		if curr.MountPoint != "/" && !strings.HasPrefix(bd.MountPoint, curr.MountPoint+"/") {
+			continue
+		}
+
+		if result == nil || len(curr.MountPoint) > len(result.MountPoint) {
+			result = curr
+		}
+	}
+
+	return result
+}
+
+// volumeGroupTask returns the task creating the volume group vg and its logical
+// volumes, or activating them if partitioned, it waits for its physical volumes
+// to be initialized. Its output is the "table:<vg>" resource the logical volumes
+// are formatted from.
+func volumeGroupTask(vg *storage.BlockDevice, md *model.SystemInstall, background bool, partitioned bool) *task {
+	inputs := []string{}
+	for _, pv := range storage.PhysicalVolumes(md.TargetMedias, vg.Name) {
+		inputs = append(inputs, "fs:"+pv.Name)
+	}
+
+	return &task{
+		name:       "volume group " + vg.Name,
+		inputs:     inputs,
+		outputs:    []string{"table:" + vg.Name},
+		background: background,
+		device:     vg.Name,
+		logTask:    partitioningLogTask,
+		run: func() error {
+			if partitioned {
+				return vg.ActivateVolumeGroup()
+			}
+
+			return vg.CreateVolumeGroup(md.TargetMedias, progress.Reporter{Quiet: background})
+		},
+	}
+}
+
+// raidArrayTask returns the task creating the RAID array and its partitions, or
+// assembling it if partitioned, it waits for its members to be wiped. Its output
+// is the "table:<array>" resource the array partitions are formatted from.
+func raidArrayTask(array *storage.BlockDevice, md *model.SystemInstall, background bool, partitioned bool) *task {
+	inputs := []string{}
+	for _, member := range storage.RAIDMembers(md.TargetMedias, array) {
+		inputs = append(inputs, "fs:"+member.Name)
+	}
+
+	return &task{
+		name:       "raid array " + array.Name,
+		inputs:     inputs,
+		outputs:    []string{"table:" + array.Name},
+		background: background,
+		device:     array.Name,
+		logTask:    partitioningLogTask,
+		run: func() error {
+			if partitioned {
+				return array.AssembleRAIDArray(md.TargetMedias)
+			}
+
+			return array.CreateRAIDArray(md.TargetMedias, progress.Reporter{Quiet: background})
+		},
+	}
+}
+
+// formatPartition maps the encrypted partitions and creates the new file systems,
+// the partitions of a resumed partitioned install are only reopened
+func formatPartition(bd *storage.BlockDevice, md *model.SystemInstall, background bool, partitioned bool) error {
+	if partitioned {
+		if bd.Type == storage.BlockDeviceTypeCrypt && bd.FsTypeNotSwap() {
+			// the generated passphrase slot was removed once enrolled
+			if md.CryptKeys.PassphrasePolicy() == storage.PassphraseTPM {
+				return errors.Errorf("An install with the %s passphrase policy can not be resumed after partitioning",
+					storage.PassphraseTPM)
+			}
+
+			return bd.OpenEncrypted(md.CryptPass)
+		}
+
+		return nil
+	}
+
+	if bd.Type == storage.BlockDeviceTypeCrypt && bd.FsTypeNotSwap() {
+		prg := newTaskLoop(background,
+			utils.Locale.Get("Mapping %s partition to an encrypted partition", bd.Name))
+
+		if err := bd.MapEncrypted(md.CryptPass); err != nil {
+			prg.Failure()
+			return err
+		}
+
+		if err := bd.AddKeySlots(md.CryptPass, md.CryptKeys); err != nil {
+			prg.Failure()
+			return err
+		}
+
+		if err := bd.EnrollTPM(md.CryptPass, md.CryptKeys); err != nil {
+			prg.Failure()
+			return err
+		}
+		prg.Success()
+	}
+
+	// Do not overwrite File System content for pre-existing
+	if !bd.FormatPartition {
+		log.Debug(utils.Locale.Get("Skipping new file system for %s", bd.Name))
+		return nil
+	}
+
+	msg := utils.Locale.Get("Writing %s file system to %s", bd.FsType, bd.Name)
+	if bd.MountPoint != "" {
+		msg = msg + fmt.Sprintf(" '%s'", bd.MountPoint)
+	}
+
+	prg := newTaskLoop(background, msg)
+	if err := bd.MakeFs(); err != nil {
+		prg.Failure()
+		return err
+	}
+	prg.Success()
+
+	// the install doesn't rely on the by-uuid symlinks, a timeout isn't fatal
+	if bd.NewUUID != "" {
+		if err := storage.WaitForUUID(bd.NewUUID, storage.DeviceWaitTimeout); err != nil {
+			log.Warning("%v", err)
+		}
+	}
+
+	return nil
+}
+
+// writeKernelCmdline writes the kernel arguments to be added and removed
+// by clr-boot-manager
+func writeKernelCmdline(rootDir string, md *model.SystemInstall) error {
+	if md.KernelArguments == nil {
+		return nil
+	}
+
+	if len(md.KernelArguments.Add) > 0 {
+		cmdlineDir := filepath.Join(rootDir, "etc", "kernel")
+		cmdlineFile := filepath.Join(cmdlineDir, "cmdline")
+		cmdline := strings.Join(md.KernelArguments.Add, " ")
+
+		if err := utils.MkdirAll(cmdlineDir, 0755); err != nil {
+			return err
+		}
+
+		if err := ioutil.WriteFile(cmdlineFile, []byte(cmdline), 0644); err != nil {
+			return err
+		}
+	}
+
+	if len(md.KernelArguments.Remove) > 0 {
+		cmdlineDir := filepath.Join(rootDir, "etc", "kernel", "cmdline-removal.d")
+		cmdlineFile := filepath.Join(cmdlineDir, "clr-installer.conf")
+		cmdline := strings.Join(md.KernelArguments.Remove, " ")
+
+		if err := utils.MkdirAll(cmdlineDir, 0755); err != nil {
+			return err
+		}
+
+		if err := ioutil.WriteFile(cmdlineFile, []byte(cmdline), 0644); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
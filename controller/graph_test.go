@@ -0,0 +1,101 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package controller
+
+import (
+	"testing"
+
+	"github.com/clearlinux/clr-installer/model"
+	"github.com/clearlinux/clr-installer/storage"
+)
+
+// findTask returns the task named name, nil if there is none
+func findTask(tasks []*task, name string) *task {
+	for _, curr := range tasks {
+		if curr.name == name {
+			return curr
+		}
+	}
+
+	return nil
+}
+
+// dependsOn returns true if t transitively requires an output of dep
+func (graph taskGraph) dependsOn(t *task, dep *task) bool {
+	for _, curr := range graph[t] {
+		if curr == dep || graph.dependsOn(curr, dep) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func TestInstallTasksIndependentMounts(t *testing.T) {
+	options, cleanup := checkpointOptions(t, false)
+	defer cleanup()
+
+	md := &model.SystemInstall{}
+	md.AddTargetMedia(&storage.BlockDevice{
+		Name: "sda",
+		Type: storage.BlockDeviceTypeDisk,
+		Children: []*storage.BlockDevice{
+			{Name: "sda1", Type: storage.BlockDeviceTypePart, FsType: "vfat", MountPoint: "/boot",
+				FormatPartition: true},
+			{Name: "sda2", Type: storage.BlockDeviceTypePart, FsType: "ext4", MountPoint: "/",
+				FormatPartition: true},
+			{Name: "sda3", Type: storage.BlockDeviceTypePart, FsType: "ext4", MountPoint: "/home",
+				FormatPartition: true},
+		},
+	})
+
+	cp, err := newCheckpoint(md, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tasks := installTasks("/tmp/install-root", "10", md, options, cp)
+
+	graph, err := newTaskGraph(tasks)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content := findTask(tasks, "content")
+	partitioned := findTask(tasks, "partitioned")
+	if content == nil || partitioned == nil {
+		t.Fatal("The install tasks should have the content and partitioned tasks")
+	}
+
+	for _, curr := range []struct {
+		name     string
+		required bool
+	}{
+		{"format sda1", true},
+		{"format sda2", true},
+		{"mount /", true},
+		{"tab files", true},
+		// the /home partition is prepared while the content is installed
+		{"format sda3", false},
+		{"mount /home", false},
+		{"partitioned", false},
+	} {
+		dep := findTask(tasks, curr.name)
+		if dep == nil {
+			t.Fatalf("The install tasks should have the %s task", curr.name)
+		}
+
+		if graph.dependsOn(content, dep) != curr.required {
+			t.Fatalf("The content should require %s: %v", curr.name, curr.required)
+		}
+	}
+
+	// the partitioning completes once every partition is formatted
+	for _, curr := range []string{"format sda1", "format sda3", "tab files"} {
+		if !graph.dependsOn(partitioned, findTask(tasks, curr)) {
+			t.Fatalf("The partitioned task should require %s", curr)
+		}
+	}
+}
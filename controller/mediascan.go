@@ -0,0 +1,138 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package controller
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/log"
+	"github.com/clearlinux/clr-installer/model"
+	"github.com/clearlinux/clr-installer/storage"
+)
+
+// mediaScan is a media scan result and the scan generation it belongs to
+type mediaScan struct {
+	generation uint64
+	signature  string
+	devices    []*storage.BlockDevice
+}
+
+var (
+	scanMutex      sync.Mutex
+	scanGeneration uint64 = 1
+	lastScan       *mediaScan
+)
+
+// ScanGeneration returns the current media scan generation, it's bumped
+// every time the scan is invalidated or the block devices changed
+func ScanGeneration() uint64 {
+	scanMutex.Lock()
+	defer scanMutex.Unlock()
+
+	return scanGeneration
+}
+
+// InvalidateScan drops the cached media scan, the next ScanMedia rescans
+func InvalidateScan() {
+	scanMutex.Lock()
+	defer scanMutex.Unlock()
+
+	scanGeneration++
+}
+
+// ScanMedia returns the available block devices, the scan is slow on large
+// SANs so its result is reused until invalidated or a block device is
+// plugged, removed or has its media changed
+func ScanMedia(userDefined []*storage.BlockDevice) ([]*storage.BlockDevice, error) {
+	scanMutex.Lock()
+	defer scanMutex.Unlock()
+
+	signature := storage.BlockDevicesSignature()
+
+	if lastScan != nil && lastScan.generation == scanGeneration {
+		if lastScan.signature == signature {
+			return lastScan.devices, nil
+		}
+
+		log.Info("The block devices changed, rescanning the media")
+		scanGeneration++
+	}
+
+	devices, err := storage.RescanBlockDevices(userDefined)
+	if err != nil {
+		return nil, err
+	}
+
+	lastScan = &mediaScan{generation: scanGeneration, signature: signature, devices: devices}
+
+	return devices, nil
+}
+
+// RescanMedia invalidates the cached media scan and rescans, i.e on the user
+// request or once new storage drivers are loaded
+func RescanMedia(userDefined []*storage.BlockDevice) ([]*storage.BlockDevice, error) {
+	InvalidateScan()
+
+	return ScanMedia(userDefined)
+}
+
+// WipeMedia deactivates the LUKS, LVM and RAID stacks of bd and wipes their
+// signatures, the cached scan is invalidated as the block devices changed
+func WipeMedia(bd *storage.BlockDevice) error {
+	defer InvalidateScan()
+
+	return bd.DeactivateAndWipe()
+}
+
+// prepareTargetMedias releases the current devices the target medias would
+// overwrite, i.e the partitions auto-mounted by the live session. The existing
+// LUKS, LVM and RAID signatures are only wiped if the configuration asks for it,
+// otherwise the install is refused, as are the MBR and hybrid partition tables
+// without a partition table policy. The TRIM policy is suggested from the
+// current disks if unset. The stacks of a resumed partitioned install are its
+// own, they're stopped to be reopened but never refused nor wiped.
+func prepareTargetMedias(md *model.SystemInstall, partitioned bool) error {
+	current, err := storage.ListBlockDevices(nil)
+	if err != nil {
+		return err
+	}
+
+	var conflicts []*storage.StackSignature
+	if !partitioned {
+		conflicts = storage.FindStackConflicts(md.TargetMedias, current, md.InstallSelected.WholeDisk)
+	}
+
+	if len(conflicts) > 0 && !md.WipeSignatures {
+		found := []string{}
+		for _, curr := range conflicts {
+			found = append(found, curr.String())
+		}
+
+		return errors.Errorf("Target media has existing signatures, deactivate and wipe them first: %s",
+			strings.Join(found, ", "))
+	}
+
+	if err = storage.PlanPartitionTables(md.TargetMedias, current, md.InstallSelected.WholeDisk,
+		md.PartitionTable); err != nil {
+		return err
+	}
+
+	// the SSDs are trimmed periodically unless told otherwise
+	if md.Trim == "" {
+		md.Trim = storage.SuggestTrimPolicy(md.TargetMedias, current)
+		log.Info("Using the %q TRIM policy", md.Trim)
+	}
+	storage.ApplyTrimPolicy(md.TargetMedias, md.Trim)
+
+	defer InvalidateScan()
+
+	if err = storage.TeardownTargets(md.TargetMedias, current, md.InstallSelected.WholeDisk); err != nil {
+		return err
+	}
+
+	return storage.WipeStackSignatures(conflicts)
+}
@@ -0,0 +1,158 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package controller
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/clearlinux/clr-installer/cmd"
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/log"
+	"github.com/clearlinux/clr-installer/model"
+)
+
+const (
+	// PostActionCountdown is the number of seconds interactive frontends wait,
+	// allowing the user to cancel, before running the post install action
+	PostActionCountdown = 10
+
+	// loaderDir is the systemd-boot configuration directory in the ESP
+	loaderDir = "boot/loader"
+
+	// kexecLoadedFile reports if a kernel is loaded for kexec
+	kexecLoadedFile = "/sys/kernel/kexec_loaded"
+)
+
+// RunPostAction executes the post install action, if the installed kernel
+// was not loaded for kexec during the install we fallback to reboot
+func RunPostAction(action string) error {
+	switch action {
+	case model.PostActionStay, "":
+		return nil
+	case model.PostActionReboot:
+		return cmd.RunAndLog("reboot")
+	case model.PostActionPoweroff:
+		return cmd.RunAndLog("poweroff")
+	case model.PostActionKexec:
+		if content, err := ioutil.ReadFile(kexecLoadedFile); err != nil ||
+			strings.TrimSpace(string(content)) != "1" {
+			log.Warning("No kernel loaded for kexec, rebooting")
+			return cmd.RunAndLog("reboot")
+		}
+		return cmd.RunAndLog("systemctl", "kexec")
+	}
+
+	return errors.Errorf("Invalid post install action: %s", action)
+}
+
+// prepareKexec loads the installed kernel when the post install action is
+// kexec, failures are only logged since RunPostAction falls back to reboot
+func prepareKexec(rootDir string, md *model.SystemInstall) {
+	if md.PostAction != model.PostActionKexec {
+		return
+	}
+
+	if err := loadKexecKernel(rootDir); err != nil {
+		log.Warning("Failed to load the installed kernel for kexec: %v", err)
+	}
+}
+
+// loadKexecKernel loads the target's default boot loader entry kernel, initrd
+// and command line so the post install kexec boots straight into it
+func loadKexecKernel(rootDir string) error {
+	entry, err := defaultLoaderEntry(filepath.Join(rootDir, loaderDir))
+	if err != nil {
+		return err
+	}
+
+	values, err := readLoaderEntry(entry)
+	if err != nil {
+		return err
+	}
+
+	esp := filepath.Join(rootDir, "boot")
+
+	if values["linux"] == "" {
+		return errors.Errorf("No kernel declared in the boot loader entry: %s", entry)
+	}
+
+	args := []string{
+		"kexec",
+		"-l",
+		filepath.Join(esp, values["linux"]),
+		"--append=" + values["options"],
+	}
+
+	if values["initrd"] != "" {
+		args = append(args, "--initrd="+filepath.Join(esp, values["initrd"]))
+	}
+
+	return cmd.RunAndLog(args...)
+}
+
+// defaultLoaderEntry returns the boot loader entry file set as default in
+// loader.conf, or the last entry file when no default is set
+func defaultLoaderEntry(dir string) (string, error) {
+	entriesDir := filepath.Join(dir, "entries")
+
+	conf, err := readLoaderEntry(filepath.Join(dir, "loader.conf"))
+	if err == nil && conf["default"] != "" {
+		entry := filepath.Join(entriesDir, strings.TrimSuffix(conf["default"], ".conf")+".conf")
+		if _, err = os.Stat(entry); err == nil {
+			return entry, nil
+		}
+	}
+
+	files, err := ioutil.ReadDir(entriesDir)
+	if err != nil {
+		return "", errors.Wrap(err)
+	}
+
+	entries := []string{}
+	for _, curr := range files {
+		if !curr.IsDir() && filepath.Ext(curr.Name()) == ".conf" {
+			entries = append(entries, curr.Name())
+		}
+	}
+
+	if len(entries) == 0 {
+		return "", errors.Errorf("No boot loader entry found in: %s", entriesDir)
+	}
+
+	sort.Strings(entries)
+
+	return filepath.Join(entriesDir, entries[len(entries)-1]), nil
+}
+
+// readLoaderEntry parses a systemd-boot configuration file into a key/value map
+func readLoaderEntry(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	defer func() { _ = f.Close() }()
+
+	result := map[string]string{}
+	scanner := bufio.NewScanner(f)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.SplitN(line, " ", 2)
+		if len(fields) == 2 {
+			result[fields[0]] = strings.TrimSpace(fields[1])
+		}
+	}
+
+	return result, scanner.Err()
+}
@@ -0,0 +1,119 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package controller
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/clearlinux/clr-installer/args"
+	"github.com/clearlinux/clr-installer/cmd"
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/log"
+	"github.com/clearlinux/clr-installer/model"
+	"github.com/clearlinux/clr-installer/network"
+	"github.com/clearlinux/clr-installer/swupd"
+	"github.com/clearlinux/clr-installer/utils"
+)
+
+const (
+	// selfUpdateBundle is the bundle shipping the installer
+	selfUpdateBundle = "clr-installer"
+
+	// selfUpdatedEnv is set in the environment of the updated installer so
+	// it doesn't try to update itself again
+	selfUpdatedEnv = "CLR_INSTALLER_SELF_UPDATED"
+)
+
+// SelfUpdate checks the update server for a newer installer than the one
+// running from the install media, when found the installer bundle of the latest
+// release is installed to a staging directory and the updated installer is
+// executed in place of the running one, with the same arguments.
+//
+// SelfUpdate only returns if the running installer is kept, the staging
+// directory is left behind since the updated installer runs from it.
+func SelfUpdate(options args.Args) error {
+	if os.Getenv(selfUpdatedEnv) != "" {
+		log.Info("Running the self updated installer")
+		return nil
+	}
+
+	if utils.ClearVersion == "" {
+		if err := utils.ParseOSClearVersion(); err != nil {
+			return err
+		}
+	}
+
+	latest, err := network.GetLatestVersion()
+	if err != nil {
+		return err
+	}
+
+	behind, err := network.ReleasesBehind(utils.ClearVersion, latest)
+	if err != nil {
+		return err
+	}
+
+	if behind == 0 {
+		log.Info("The installer is up to date with Clear Linux OS %s", latest)
+		return nil
+	}
+
+	stagingDir, err := ioutil.TempDir("", "clr-installer-self-update-")
+	if err != nil {
+		return errors.Wrap(err)
+	}
+
+	log.Info("Downloading the installer of Clear Linux OS %s", latest)
+
+	// the staging directory has its own state directory, the swupd state
+	// directory option is meant for the target content
+	options.SwupdStateDir = ""
+	sw := swupd.New(stagingDir, options)
+
+	if err = sw.InstallBundle(latest, selfUpdateBundle); err != nil {
+		return err
+	}
+
+	binary := filepath.Join(stagingDir, "usr", "bin", filepath.Base(os.Args[0]))
+	if _, err = os.Stat(binary); err != nil {
+		return errors.Errorf("Bundle %s has no %s", selfUpdateBundle, filepath.Base(binary))
+	}
+
+	// make sure the new installer runs and is actually a different version
+	w := bytes.NewBuffer(nil)
+	if err = cmd.Run(w, binary, "--version"); err != nil {
+		return err
+	}
+
+	version := strings.TrimSpace(w.String())
+	if strings.HasSuffix(version, ": "+model.Version) {
+		log.Info("The installer of Clear Linux OS %s is the running version: %s", latest, version)
+		return nil
+	}
+
+	env := append(os.Environ(), selfUpdatedEnv+"=1")
+
+	// the updated installer uses its own data files
+	dataDirs := map[string]string{
+		"CLR_INSTALLER_THEME_DIR":        filepath.Join(stagingDir, "usr", "share", "clr-installer", "themes"),
+		"CLR_INSTALLER_LOCALE_DIR":       filepath.Join(stagingDir, "usr", "share", "locale"),
+		"CLR_INSTALLER_ISO_TEMPLATE_DIR": filepath.Join(stagingDir, "usr", "share", "clr-installer", "iso_templates"),
+	}
+
+	for k, v := range dataDirs {
+		if _, err = os.Stat(v); err == nil {
+			env = append(env, k+"="+v)
+		}
+	}
+
+	log.Info("Running the updated installer: %s", version)
+
+	return errors.Wrap(syscall.Exec(binary, os.Args, env))
+}
@@ -0,0 +1,210 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package controller
+
+import (
+	"time"
+
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/log"
+)
+
+// task is a named install step, a task declares the resources it requires
+// (inputs) and the ones it provides (outputs) and only runs once all the tasks
+// providing its inputs have successfully completed
+//
+// Foreground tasks report their own progress and therefore run one at a time,
+// background tasks must not report progress and run concurrently with any
+// other task. Tasks operating on the same device are serialized regardless.
+type task struct {
+	name       string
+	inputs     []string
+	outputs    []string
+	background bool
+	device     string
+	run        func() error
+
+	// logTask is the task log file the task is logged to, see log.BeginTask
+	logTask string
+
+	// duration is set by runTasks once the task completes
+	duration time.Duration
+}
+
+// taskResult is the completion notification of a task
+type taskResult struct {
+	task *task
+	err  error
+}
+
+// taskGraph maps the tasks to the tasks providing their inputs
+type taskGraph map[*task][]*task
+
+// newTaskGraph resolves the tasks dependencies, every input must be provided
+// by exactly one task and the graph must not have cycles
+func newTaskGraph(tasks []*task) (taskGraph, error) {
+	providers := map[string]*task{}
+
+	for _, curr := range tasks {
+		for _, output := range curr.outputs {
+			if prev, ok := providers[output]; ok {
+				return nil, errors.Errorf("Install tasks %s and %s both provide: %s",
+					prev.name, curr.name, output)
+			}
+			providers[output] = curr
+		}
+	}
+
+	graph := taskGraph{}
+
+	for _, curr := range tasks {
+		graph[curr] = []*task{}
+
+		for _, input := range curr.inputs {
+			provider, ok := providers[input]
+			if !ok {
+				return nil, errors.Errorf("No install task provides %s required by: %s", input, curr.name)
+			}
+			graph[curr] = append(graph[curr], provider)
+		}
+	}
+
+	if err := graph.checkCycles(tasks); err != nil {
+		return nil, err
+	}
+
+	return graph, nil
+}
+
+// checkCycles walks the graph in topological order, the tasks never reached
+// are part of, or depend on, a cycle
+func (graph taskGraph) checkCycles(tasks []*task) error {
+	done := map[*task]bool{}
+
+	for progressed := true; progressed; {
+		progressed = false
+
+		for _, curr := range tasks {
+			if !done[curr] && graph.ready(curr, done) {
+				done[curr] = true
+				progressed = true
+			}
+		}
+	}
+
+	for _, curr := range tasks {
+		if !done[curr] {
+			return errors.Errorf("Install task %s has circular dependencies", curr.name)
+		}
+	}
+
+	return nil
+}
+
+// ready returns true if all the tasks providing t's inputs are done
+func (graph taskGraph) ready(t *task, done map[*task]bool) bool {
+	for _, dep := range graph[t] {
+		if !done[dep] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// runTasks runs the tasks respecting their dependencies, the tasks are started
+// in the given order whenever ready and their device is idle, the first error
+// stops the scheduling of new tasks and is returned once the running tasks complete
+func runTasks(tasks []*task) error {
+	graph, err := newTaskGraph(tasks)
+	if err != nil {
+		return err
+	}
+
+	done := map[*task]bool{}
+	started := map[*task]bool{}
+	busy := map[string]bool{}
+	results := make(chan taskResult)
+	running := 0
+	foreground := false
+	var firstErr error
+
+	for {
+		for _, curr := range tasks {
+			if firstErr == nil {
+				firstErr = checkAborted()
+			}
+
+			if firstErr != nil {
+				break
+			}
+
+			if started[curr] || !graph.ready(curr, done) || (!curr.background && foreground) {
+				continue
+			}
+
+			if busy[curr.device] {
+				continue
+			}
+
+			started[curr] = true
+			if curr.device != "" {
+				busy[curr.device] = true
+			}
+			running++
+
+			if !curr.background {
+				foreground = true
+			}
+
+			log.Debug("Starting install task: %s", curr.name)
+			go func(t *task) {
+				start := time.Now()
+				if t.logTask != "" {
+					log.BeginTask(t.logTask)
+				}
+
+				err := t.run()
+				t.duration = time.Since(start)
+
+				if t.logTask != "" {
+					log.EndTask(t.logTask, err)
+				}
+				results <- taskResult{task: t, err: err}
+			}(curr)
+		}
+
+		if running == 0 {
+			break
+		}
+
+		res := <-results
+		running--
+		delete(busy, res.task.device)
+
+		if !res.task.background {
+			foreground = false
+		}
+
+		if res.err != nil {
+			log.Debug("Install task %s failed: %v", res.task.name, res.err)
+
+			// the task failed because its commands were interrupted
+			if errAbort := checkAborted(); errAbort != nil {
+				res.err = errAbort
+			}
+
+			if firstErr == nil {
+				firstErr = res.err
+			}
+			continue
+		}
+
+		log.Debug("Install task %s completed", res.task.name)
+		done[res.task] = true
+	}
+
+	return firstErr
+}
@@ -0,0 +1,320 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package controller
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// taskRecorder records the tasks start order and how many of them, in total
+// and per device, run at the same time
+type taskRecorder struct {
+	mutex         sync.Mutex
+	order         []string
+	running       int
+	maxRunning    int
+	foreground    int
+	maxForeground int
+	devices       map[string]int
+	maxDevice     int
+}
+
+func newTaskRecorder() *taskRecorder {
+	return &taskRecorder{devices: map[string]int{}}
+}
+
+// newTask returns a task recording its run, it lasts delay and fails with err
+func (rec *taskRecorder) newTask(name string, inputs []string, outputs []string, background bool,
+	device string, delay time.Duration, err error) *task {
+	t := &task{
+		name:       name,
+		inputs:     inputs,
+		outputs:    outputs,
+		background: background,
+		device:     device,
+	}
+
+	t.run = func() error {
+		rec.begin(t)
+		time.Sleep(delay)
+		rec.end(t)
+		return err
+	}
+
+	return t
+}
+
+func (rec *taskRecorder) begin(t *task) {
+	rec.mutex.Lock()
+	defer rec.mutex.Unlock()
+
+	rec.order = append(rec.order, t.name)
+
+	rec.running++
+	if rec.running > rec.maxRunning {
+		rec.maxRunning = rec.running
+	}
+
+	if !t.background {
+		rec.foreground++
+		if rec.foreground > rec.maxForeground {
+			rec.maxForeground = rec.foreground
+		}
+	}
+
+	if t.device != "" {
+		rec.devices[t.device]++
+		if rec.devices[t.device] > rec.maxDevice {
+			rec.maxDevice = rec.devices[t.device]
+		}
+	}
+}
+
+func (rec *taskRecorder) end(t *task) {
+	rec.mutex.Lock()
+	defer rec.mutex.Unlock()
+
+	rec.running--
+	if !t.background {
+		rec.foreground--
+	}
+	if t.device != "" {
+		rec.devices[t.device]--
+	}
+}
+
+func (rec *taskRecorder) started(name string) bool {
+	rec.mutex.Lock()
+	defer rec.mutex.Unlock()
+
+	for _, curr := range rec.order {
+		if curr == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (rec *taskRecorder) index(name string) int {
+	rec.mutex.Lock()
+	defer rec.mutex.Unlock()
+
+	for idx, curr := range rec.order {
+		if curr == name {
+			return idx
+		}
+	}
+
+	return -1
+}
+
+func TestNewTaskGraph(t *testing.T) {
+	newTask := func(name string, inputs []string, outputs []string) *task {
+		return &task{name: name, inputs: inputs, outputs: outputs, run: func() error { return nil }}
+	}
+
+	tests := []struct {
+		name  string
+		tasks []*task
+		valid bool
+	}{
+		{"chain", []*task{
+			newTask("c", []string{"b"}, nil),
+			newTask("b", []string{"a"}, []string{"b"}),
+			newTask("a", nil, []string{"a"}),
+		}, true},
+		{"shared input", []*task{
+			newTask("a", nil, []string{"a"}),
+			newTask("b", []string{"a"}, nil),
+			newTask("c", []string{"a"}, nil),
+		}, true},
+		{"duplicate provider", []*task{
+			newTask("a", nil, []string{"a"}),
+			newTask("b", nil, []string{"a"}),
+		}, false},
+		{"missing input", []*task{
+			newTask("a", []string{"b"}, []string{"a"}),
+		}, false},
+		{"self cycle", []*task{
+			newTask("a", []string{"a"}, []string{"a"}),
+		}, false},
+		{"cycle", []*task{
+			newTask("a", []string{"c"}, []string{"a"}),
+			newTask("b", []string{"a"}, []string{"b"}),
+			newTask("c", []string{"b"}, []string{"c"}),
+		}, false},
+		{"depends on cycle", []*task{
+			newTask("a", []string{"b"}, []string{"a"}),
+			newTask("b", []string{"a"}, []string{"b"}),
+			newTask("c", []string{"a"}, nil),
+			newTask("d", nil, []string{"d"}),
+		}, false},
+	}
+
+	for _, curr := range tests {
+		graph, err := newTaskGraph(curr.tasks)
+
+		if curr.valid && err != nil {
+			t.Fatalf("%s: should be valid: %v", curr.name, err)
+		}
+
+		if !curr.valid && err == nil {
+			t.Fatalf("%s: should be invalid", curr.name)
+		}
+
+		if curr.valid && len(graph) != len(curr.tasks) {
+			t.Fatalf("%s: expected a node per task, got: %d", curr.name, len(graph))
+		}
+	}
+
+	// a graph failing to resolve never runs a task
+	rec := newTaskRecorder()
+	if err := runTasks([]*task{rec.newTask("a", []string{"b"}, nil, false, "", 0, nil)}); err == nil {
+		t.Fatal("runTasks should fail with a missing input")
+	}
+
+	if len(rec.order) != 0 {
+		t.Fatalf("No task should run, got: %v", rec.order)
+	}
+}
+
+func TestRunTasksDependencies(t *testing.T) {
+	rec := newTaskRecorder()
+
+	tasks := []*task{
+		rec.newTask("content", []string{"mount", "prefetch"}, nil, false, "", 0, nil),
+		rec.newTask("mount", []string{"fs"}, []string{"mount"}, true, "", time.Millisecond, nil),
+		rec.newTask("prefetch", nil, []string{"prefetch"}, true, "", 5*time.Millisecond, nil),
+		rec.newTask("fs", []string{"table"}, []string{"fs"}, false, "sda", time.Millisecond, nil),
+		rec.newTask("table", nil, []string{"table"}, false, "sda", time.Millisecond, nil),
+	}
+
+	if err := runTasks(tasks); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rec.order) != len(tasks) {
+		t.Fatalf("Every task should run once, got: %v", rec.order)
+	}
+
+	for _, curr := range []struct{ before, after string }{
+		{"table", "fs"},
+		{"fs", "mount"},
+		{"mount", "content"},
+		{"prefetch", "content"},
+	} {
+		if rec.index(curr.before) > rec.index(curr.after) {
+			t.Fatalf("%s should start before %s, got: %v", curr.before, curr.after, rec.order)
+		}
+	}
+
+	for _, curr := range tasks {
+		if curr.duration == 0 {
+			t.Fatalf("The duration of %s should be set", curr.name)
+		}
+	}
+}
+
+func TestRunTasksScheduling(t *testing.T) {
+	tests := []struct {
+		name          string
+		background    bool
+		devices       []string
+		maxRunning    int
+		maxForeground int
+		maxDevice     int
+	}{
+		// the foreground tasks report progress, one at a time
+		{"foreground", false, []string{"", "", ""}, 1, 1, 0},
+		// the background tasks run concurrently
+		{"background", true, []string{"", "", ""}, 3, 0, 0},
+		// unless they operate on the same device
+		{"same device", true, []string{"sda", "sda", "sda"}, 1, 0, 1},
+		{"other devices", true, []string{"sda", "sdb", "sdc"}, 3, 0, 1},
+	}
+
+	for _, curr := range tests {
+		rec := newTaskRecorder()
+		tasks := []*task{}
+
+		for idx, device := range curr.devices {
+			tasks = append(tasks, rec.newTask(fmt.Sprintf("task%d", idx), nil, nil,
+				curr.background, device, 20*time.Millisecond, nil))
+		}
+
+		if err := runTasks(tasks); err != nil {
+			t.Fatalf("%s: %v", curr.name, err)
+		}
+
+		if rec.maxRunning != curr.maxRunning || rec.maxForeground != curr.maxForeground ||
+			rec.maxDevice != curr.maxDevice {
+			t.Fatalf("%s: expected %d running, %d foreground and %d per device, got: %d %d %d",
+				curr.name, curr.maxRunning, curr.maxForeground, curr.maxDevice,
+				rec.maxRunning, rec.maxForeground, rec.maxDevice)
+		}
+	}
+}
+
+func TestRunTasksBackgroundWithForeground(t *testing.T) {
+	started := make(chan bool)
+
+	// the foreground task only completes once the background one started
+	tasks := []*task{
+		{name: "foreground", run: func() error {
+			select {
+			case <-started:
+				return nil
+			case <-time.After(5 * time.Second):
+				return fmt.Errorf("The background task should run with the foreground one")
+			}
+		}},
+		{name: "background", background: true, run: func() error {
+			close(started)
+			return nil
+		}},
+	}
+
+	if err := runTasks(tasks); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRunTasksFirstError(t *testing.T) {
+	rec := newTaskRecorder()
+	first := fmt.Errorf("first failure")
+	second := fmt.Errorf("second failure")
+
+	tasks := []*task{
+		rec.newTask("failing", nil, []string{"failing"}, true, "", time.Millisecond, first),
+		rec.newTask("running", nil, nil, true, "", 30*time.Millisecond, second),
+		rec.newTask("dependent", []string{"failing"}, nil, false, "", 0, nil),
+		rec.newTask("late", []string{"slow"}, nil, false, "", 0, nil),
+		rec.newTask("slow", nil, []string{"slow"}, false, "", 10*time.Millisecond, nil),
+	}
+
+	err := runTasks(tasks)
+	if err != first {
+		t.Fatalf("Expected the first failure, got: %v", err)
+	}
+
+	// the running tasks complete, no new task is started
+	if !rec.started("running") {
+		t.Fatal("The independent task should have run")
+	}
+
+	for _, curr := range []string{"dependent", "late"} {
+		if rec.started(curr) {
+			t.Fatalf("%s should not start once a task failed, got: %v", curr, rec.order)
+		}
+	}
+
+	if rec.running != 0 {
+		t.Fatalf("runTasks should wait for the running tasks, %d still running", rec.running)
+	}
+}
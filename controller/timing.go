@@ -0,0 +1,67 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package controller
+
+import (
+	"time"
+
+	"github.com/clearlinux/clr-installer/log"
+	"github.com/clearlinux/clr-installer/model"
+	"github.com/clearlinux/clr-installer/storage"
+)
+
+// tuneTargetMedias tunes the target medias I/O scheduler for the install, the
+// returned function restores the previous settings
+func tuneTargetMedias(md *model.SystemInstall) func() {
+	tunings := []*storage.DeviceTuning{}
+
+	for _, curr := range md.TargetMedias {
+		tuning, err := storage.TuneDevice(curr)
+		if err != nil {
+			log.Warning("Failed to tune the %s I/O scheduler: %v", curr.Name, err)
+			continue
+		}
+		tunings = append(tunings, tuning)
+	}
+
+	return func() {
+		for _, curr := range tunings {
+			if err := curr.Restore(); err != nil {
+				log.Warning("Failed to restore the I/O scheduler: %v", err)
+			}
+		}
+	}
+}
+
+// targetBytesWritten returns the number of bytes written to the target medias,
+// medias without statistics (i.e image files) are ignored
+func targetBytesWritten(md *model.SystemInstall) uint64 {
+	var result uint64
+
+	for _, curr := range md.TargetMedias {
+		if written, err := storage.BytesWritten(curr); err == nil {
+			result += written
+		}
+	}
+
+	return result
+}
+
+// logTimingReport logs the duration of each install task and the average
+// write throughput to the target medias
+func logTimingReport(tasks []*task, elapsed time.Duration, written uint64) {
+	log.Info("Timing report:")
+
+	for _, curr := range tasks {
+		log.Info("  %-24s %s", curr.name, curr.duration.Round(time.Millisecond))
+	}
+
+	log.Info("  %-24s %s", "total", elapsed.Round(time.Millisecond))
+
+	if elapsed > 0 && written > 0 {
+		mb := float64(written) / (1024 * 1024)
+		log.Info("  %-24s %.1f MiB, %.1f MiB/s", "written", mb, mb/elapsed.Seconds())
+	}
+}
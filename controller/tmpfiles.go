@@ -0,0 +1,42 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package controller
+
+import (
+	"strings"
+
+	"github.com/clearlinux/clr-installer/cmd"
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/model"
+)
+
+const (
+	tmpfilesDropIn = "etc/tmpfiles.d/clr-installer.conf"
+)
+
+// configureTmpfiles writes the tmpfiles.d configuration of the declared
+// directories and creates them, the users must be created beforehand so
+// systemd-tmpfiles can resolve the owners
+func configureTmpfiles(rootDir string, dirs []*model.Directory) error {
+	if len(dirs) == 0 {
+		return nil
+	}
+
+	lines := []string{"# Directories declared in the installer configuration"}
+	for _, curr := range dirs {
+		lines = append(lines, curr.TmpfilesLine())
+	}
+
+	if err := writeDropIn(rootDir, tmpfilesDropIn, strings.Join(lines, "\n")+"\n"); err != nil {
+		return err
+	}
+
+	args := []string{"chroot", rootDir, "systemd-tmpfiles", "--create", "/" + tmpfilesDropIn}
+	if err := cmd.RunAndLog(args...); err != nil {
+		return errors.Wrap(err)
+	}
+
+	return nil
+}
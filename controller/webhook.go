@@ -0,0 +1,70 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package controller
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/clearlinux/clr-installer/log"
+	"github.com/clearlinux/clr-installer/model"
+	"github.com/clearlinux/clr-installer/network"
+	"github.com/clearlinux/clr-installer/utils"
+)
+
+// InstallSummary is the payload POSTed to the model's webhook when
+// the installation completes or fails
+type InstallSummary struct {
+	Status           string   `json:"status"`
+	Error            string   `json:"error,omitempty"`
+	InstallerVersion string   `json:"installerVersion"`
+	ClearVersion     string   `json:"clearVersion"`
+	Hostname         string   `json:"hostname,omitempty"`
+	TargetMedias     []string `json:"targetMedias,omitempty"`
+	Bundles          []string `json:"bundles,omitempty"`
+	StartTime        string   `json:"startTime"`
+	Duration         int64    `json:"duration"`
+}
+
+// newInstallSummary builds the summary of an installation started at start,
+// instError is the error returned by the installation if any
+func newInstallSummary(md *model.SystemInstall, start time.Time, instError error) *InstallSummary {
+	summary := &InstallSummary{
+		Status:           "success",
+		InstallerVersion: model.Version,
+		ClearVersion:     utils.ClearVersion,
+		Hostname:         md.Hostname,
+		Bundles:          md.Bundles,
+		StartTime:        start.UTC().Format(time.RFC3339),
+		Duration:         int64(time.Since(start).Seconds()),
+	}
+
+	if instError != nil {
+		summary.Status = "failure"
+		summary.Error = instError.Error()
+	}
+
+	for _, curr := range md.TargetMedias {
+		summary.TargetMedias = append(summary.TargetMedias, curr.GetDeviceFile())
+	}
+
+	return summary
+}
+
+// notifyWebhook POSTs the install summary to the model's webhook, failures
+// are only logged since the installation result must not be affected
+func notifyWebhook(md *model.SystemInstall, start time.Time, instError error) {
+	payload, err := json.Marshal(newInstallSummary(md, start, instError))
+	if err != nil {
+		log.Warning("Failed to encode the install summary: %v", err)
+		return
+	}
+
+	log.Info("Notifying install webhook: %s", md.Webhook)
+
+	if err = network.PostJSON(md.Webhook, payload); err != nil {
+		log.Warning("Failed to notify the install webhook %s: %v", md.Webhook, err)
+	}
+}
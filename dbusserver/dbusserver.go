@@ -0,0 +1,382 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package dbusserver
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus"
+
+	"github.com/clearlinux/clr-installer/args"
+	"github.com/clearlinux/clr-installer/controller"
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/log"
+	"github.com/clearlinux/clr-installer/metrics"
+	"github.com/clearlinux/clr-installer/model"
+	"github.com/clearlinux/clr-installer/progress"
+	"github.com/clearlinux/clr-installer/storage"
+)
+
+const (
+	// BusName is the name owned by the installer on the system bus
+	BusName = "org.clearlinux.Installer"
+
+	// ObjectPath is the path of the installer object
+	ObjectPath = dbus.ObjectPath("/org/clearlinux/Installer")
+
+	// Interface is the interface of the installer object
+	Interface = "org.clearlinux.Installer"
+
+	// StateIdle is the state of a service waiting for Start
+	StateIdle = "idle"
+
+	// StateRunning is the state of a service running an install
+	StateRunning = "running"
+
+	// StateSucceeded is the state of a service whose install succeeded
+	StateSucceeded = "succeeded"
+
+	// StateFailed is the state of a service whose install failed, the
+	// install may be started again
+	StateFailed = "failed"
+
+	// errorName is the D-Bus error of the rejected method calls
+	errorName = Interface + ".Error"
+)
+
+// introspection describes the installer object to the D-Bus clients
+const introspection = `<node>
+  <interface name="` + Interface + `">
+    <method name="Start">
+      <arg name="config" type="s" direction="in"/>
+    </method>
+    <method name="Abort"/>
+    <method name="GetStatus">
+      <arg name="state" type="s" direction="out"/>
+      <arg name="task" type="s" direction="out"/>
+      <arg name="percent" type="d" direction="out"/>
+    </method>
+    <signal name="Desc">
+      <arg name="desc" type="s"/>
+    </signal>
+    <signal name="Partial">
+      <arg name="total" type="i"/>
+      <arg name="step" type="i"/>
+    </signal>
+    <signal name="Success"/>
+    <signal name="Failure"/>
+    <signal name="Finished">
+      <arg name="succeeded" type="b"/>
+      <arg name="error" type="s"/>
+    </signal>
+  </interface>
+  <interface name="org.freedesktop.DBus.Introspectable">
+    <method name="Introspect">
+      <arg name="data" type="s" direction="out"/>
+    </method>
+  </interface>
+</node>`
+
+// DBusServer is the frontend implementation driven over the system bus, so a
+// kiosk or GNOME Initial Setup embeds its own progress UI; it also implements
+// the progress interface: progress.Client
+type DBusServer struct {
+	conn    *dbus.Conn
+	options args.Args
+
+	// emit sends a signal of the installer interface
+	emit func(name string, values ...interface{})
+
+	mutex   sync.Mutex
+	state   string
+	task    string
+	percent float64
+	startup *model.SystemInstall
+
+	start chan *model.SystemInstall
+	quit  chan bool
+}
+
+// installer is the object exported on the bus, its methods are the D-Bus
+// methods of the installer interface
+type installer struct {
+	server *DBusServer
+}
+
+// introspectable implements org.freedesktop.DBus.Introspectable
+type introspectable string
+
+// New creates a new instance of DBusServer frontend implementation
+func New() *DBusServer {
+	return &DBusServer{
+		state: StateIdle,
+		emit:  func(name string, values ...interface{}) {},
+		start: make(chan *model.SystemInstall, 1),
+		quit:  make(chan bool, 1),
+	}
+}
+
+// MustRun is part of the Frontend implementation and tells the core implementation that this
+// frontend wants or should be executed
+func (ds *DBusServer) MustRun(args *args.Args) bool {
+	return args.DBusService
+}
+
+// Start owns BusName on the system bus and exports the installer object
+func (ds *DBusServer) Start(options args.Args) error {
+	ds.options = options
+
+	conn, err := dbus.SystemBus()
+	if err != nil {
+		return errors.Wrap(err)
+	}
+
+	reply, err := conn.RequestName(BusName, dbus.NameFlagDoNotQueue)
+	if err != nil {
+		return errors.Wrap(err)
+	}
+
+	if reply != dbus.RequestNameReplyPrimaryOwner {
+		return errors.Errorf("%s is already owned on the system bus, is another installer running?", BusName)
+	}
+
+	if err = conn.Export(&installer{server: ds}, ObjectPath, Interface); err != nil {
+		return errors.Wrap(err)
+	}
+
+	if err = conn.Export(introspectable(introspection), ObjectPath,
+		"org.freedesktop.DBus.Introspectable"); err != nil {
+		return errors.Wrap(err)
+	}
+
+	ds.conn = conn
+	ds.emit = func(name string, values ...interface{}) {
+		if errEmit := conn.Emit(ObjectPath, Interface+"."+name, values...); errEmit != nil {
+			log.Warning("Failed to emit the %s signal: %v", name, errEmit)
+		}
+	}
+
+	log.Info("Serving %s on the system bus", BusName)
+
+	return nil
+}
+
+// Close releases BusName
+func (ds *DBusServer) Close() error {
+	if ds.conn == nil {
+		return nil
+	}
+
+	if _, err := ds.conn.ReleaseName(BusName); err != nil {
+		return errors.Wrap(err)
+	}
+
+	return nil
+}
+
+// Run is part of the Frontend implementation and is the actual entry point for the
+// D-Bus frontend, it installs on Start until an install succeeds or Abort is
+// called without a running install
+func (ds *DBusServer) Run(md *model.SystemInstall, rootDir string, options args.Args) (bool, error) {
+	ds.startup = md
+
+	if err := ds.Start(options); err != nil {
+		return false, err
+	}
+	defer func() { _ = ds.Close() }()
+
+	// the metrics are only recorded if the server was started
+	progress.Set(metrics.NewProgress(progress.NewThrottle(ds, progress.DefaultUpdateInterval)))
+
+	for {
+		select {
+		case installed := <-ds.start:
+			// the post install action is the one of the installed descriptor
+			*md = *installed
+
+			if err := ds.install(md, rootDir, options); err != nil {
+				continue
+			}
+
+			if md.PostAction != "" {
+				return md.PostAction != model.PostActionStay, nil
+			}
+
+			return md.PostReboot, nil
+		case <-ds.quit:
+			return false, nil
+		}
+	}
+}
+
+// install installs md, the install result is signaled to the clients
+func (ds *DBusServer) install(md *model.SystemInstall, rootDir string, options args.Args) error {
+	// Need to ensure the partitioner knows we are running headless
+	// and will be using the whole disk
+	md.InstallSelected = storage.InstallTarget{WholeDisk: true}
+
+	log.Debug("Starting install requested over D-Bus")
+
+	err := controller.Install(rootDir, md, options)
+	metrics.Finish(err)
+
+	ds.finish(err)
+
+	return err
+}
+
+// finish records and signals the install result
+func (ds *DBusServer) finish(err error) {
+	ds.mutex.Lock()
+	defer ds.mutex.Unlock()
+
+	msg := ""
+	ds.state = StateSucceeded
+
+	if err != nil {
+		msg = errors.Message(err)
+		ds.state = StateFailed
+	}
+
+	ds.emit("Finished", err == nil, msg)
+}
+
+// loadDescriptor returns the descriptor installed by Start, the startup one
+// if config is empty
+func (ds *DBusServer) loadDescriptor(config string) (*model.SystemInstall, error) {
+	if config == "" {
+		if ds.startup == nil {
+			return nil, errors.Errorf("No descriptor to install")
+		}
+
+		return ds.startup, nil
+	}
+
+	md, err := model.LoadFile(config, ds.options)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = md.Validate(); err != nil {
+		return nil, err
+	}
+
+	return md, nil
+}
+
+// dbusError returns the D-Bus error of a rejected method call
+func dbusError(format string, a ...interface{}) *dbus.Error {
+	return dbus.NewError(errorName, []interface{}{fmt.Sprintf(format, a...)})
+}
+
+// Start installs the config descriptor file, the one the installer was
+// started with if empty
+func (obj *installer) Start(config string) *dbus.Error {
+	ds := obj.server
+
+	md, err := ds.loadDescriptor(config)
+	if err != nil {
+		return dbusError("Invalid descriptor: %s", errors.Message(err))
+	}
+
+	ds.mutex.Lock()
+	defer ds.mutex.Unlock()
+
+	switch ds.state {
+	case StateRunning:
+		return dbusError("An install is running")
+	case StateSucceeded:
+		return dbusError("The target is already installed")
+	}
+
+	ds.state = StateRunning
+	ds.task = ""
+	ds.percent = 0
+	ds.start <- md
+
+	return nil
+}
+
+// Abort aborts the running install, or ends the session if none is running
+func (obj *installer) Abort() *dbus.Error {
+	ds := obj.server
+
+	ds.mutex.Lock()
+	defer ds.mutex.Unlock()
+
+	if ds.state == StateRunning {
+		controller.Abort()
+		return nil
+	}
+
+	select {
+	case ds.quit <- true:
+		log.Info("D-Bus session ended")
+	default:
+	}
+
+	return nil
+}
+
+// GetStatus returns the install state, the running task and its progress
+func (obj *installer) GetStatus() (string, string, float64, *dbus.Error) {
+	ds := obj.server
+
+	ds.mutex.Lock()
+	defer ds.mutex.Unlock()
+
+	return ds.state, ds.task, ds.percent, nil
+}
+
+// Introspect is part of the org.freedesktop.DBus.Introspectable implementation
+func (data introspectable) Introspect() (string, *dbus.Error) {
+	return string(data), nil
+}
+
+// Desc is part of the progress.Client implementation
+func (ds *DBusServer) Desc(desc string) {
+	ds.mutex.Lock()
+	ds.task = desc
+	ds.percent = 0
+	ds.mutex.Unlock()
+
+	ds.emit("Desc", desc)
+}
+
+// Partial is part of the progress.Client implementation
+func (ds *DBusServer) Partial(total int, step int) {
+	if total > 0 {
+		ds.mutex.Lock()
+		ds.percent = float64(step) / float64(total) * 100
+		ds.mutex.Unlock()
+	}
+
+	ds.emit("Partial", int32(total), int32(step))
+}
+
+// Step is part of the progress.Client implementation, the loop steps only
+// animate the local frontends
+func (ds *DBusServer) Step() {}
+
+// Success is part of the progress.Client implementation
+func (ds *DBusServer) Success() {
+	ds.mutex.Lock()
+	ds.percent = 100
+	ds.mutex.Unlock()
+
+	ds.emit("Success")
+}
+
+// Failure is part of the progress.Client implementation
+func (ds *DBusServer) Failure() {
+	ds.emit("Failure")
+}
+
+// LoopWaitDuration is part of the progress.Client implementation
+func (ds *DBusServer) LoopWaitDuration() time.Duration {
+	return time.Second
+}
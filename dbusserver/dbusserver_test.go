@@ -0,0 +1,107 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package dbusserver
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/model"
+)
+
+// recordSignals returns a server recording its signals to the returned slice
+func recordSignals() (*DBusServer, *[]string) {
+	signals := []string{}
+
+	ds := New()
+	ds.emit = func(name string, values ...interface{}) {
+		signals = append(signals, strings.TrimSpace(fmt.Sprintln(append([]interface{}{name}, values...)...)))
+	}
+
+	return ds, &signals
+}
+
+func TestProgressSignals(t *testing.T) {
+	ds, signals := recordSignals()
+
+	ds.Desc("Installing bundles")
+	ds.Partial(4, 1)
+	ds.Success()
+	ds.Desc("Installing boot loader")
+	ds.Failure()
+	ds.finish(errors.Errorf("bootctl failed"))
+
+	expected := []string{
+		"Desc Installing bundles",
+		"Partial 4 1",
+		"Success",
+		"Desc Installing boot loader",
+		"Failure",
+		"Finished false bootctl failed",
+	}
+
+	if strings.Join(*signals, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("Expected the signals:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(*signals, "\n"))
+	}
+
+	state, task, _, err := (&installer{server: ds}).GetStatus()
+	if err != nil || state != StateFailed || task != "Installing boot loader" {
+		t.Fatalf("Unexpected status: %s %s %v", state, task, err)
+	}
+}
+
+func TestStart(t *testing.T) {
+	ds, _ := recordSignals()
+	obj := &installer{server: ds}
+
+	if err := obj.Start(""); err == nil {
+		t.Fatal("Start should fail without a startup descriptor")
+	}
+
+	if err := obj.Start("/nonexistent/descriptor.yaml"); err == nil {
+		t.Fatal("Start should fail with a missing descriptor")
+	}
+
+	ds.startup = &model.SystemInstall{}
+	if err := obj.Start(""); err != nil {
+		t.Fatalf("Start should install the startup descriptor: %v", err)
+	}
+
+	if md := <-ds.start; md != ds.startup {
+		t.Fatal("The startup descriptor should be installed")
+	}
+
+	if err := obj.Start(""); err == nil {
+		t.Fatal("Start should fail during an install")
+	}
+
+	ds.finish(nil)
+	if err := obj.Start(""); err == nil {
+		t.Fatal("Start should fail once the target is installed")
+	}
+}
+
+func TestAbortEndsSession(t *testing.T) {
+	ds, _ := recordSignals()
+
+	if err := (&installer{server: ds}).Abort(); err != nil {
+		t.Fatalf("Abort should end the idle session: %v", err)
+	}
+
+	select {
+	case <-ds.quit:
+	default:
+		t.Fatal("The session should be ended")
+	}
+}
+
+func TestIntrospect(t *testing.T) {
+	data, err := introspectable(introspection).Introspect()
+	if err != nil || !strings.Contains(data, `<interface name="`+Interface+`">`) {
+		t.Fatalf("Unexpected introspection data: %s %v", data, err)
+	}
+}
@@ -102,6 +102,16 @@ func ValidationErrorf(format string, a ...interface{}) error {
 	}
 }
 
+// Message returns the message of err without its stack information, i.e
+// to report it to a remote client
+func Message(err error) string {
+	if e, ok := err.(TraceableError); ok {
+		return e.What
+	}
+
+	return err.Error()
+}
+
 // IsValidationError returns true if err is a ValidationError
 // returns false otherwise
 func IsValidationError(err error) bool {
@@ -65,3 +65,13 @@ func TestValidationError(t *testing.T) {
 		t.Fatal("IsValidationError() should return false for a TraceableError")
 	}
 }
+
+func TestMessage(t *testing.T) {
+	if msg := Message(Errorf("traceable %s", "error")); msg != "traceable error" {
+		t.Fatalf("Message() should not return the trace info: %q", msg)
+	}
+
+	if msg := Message(fmt.Errorf("plain error")); msg != "plain error" {
+		t.Fatalf("Message() should return the plain error message: %q", msg)
+	}
+}
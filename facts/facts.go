@@ -0,0 +1,160 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package facts
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/log"
+)
+
+const (
+	// Serial is the variable of the system serial number
+	Serial = "dmiSerial"
+
+	// AssetTag is the variable of the chassis asset tag
+	AssetTag = "dmiAssetTag"
+
+	// Product is the variable of the system product name
+	Product = "dmiProduct"
+
+	// Vendor is the variable of the system vendor
+	Vendor = "dmiVendor"
+
+	// UUID is the variable of the system UUID
+	UUID = "dmiUUID"
+)
+
+var (
+	// sysDMIDir is the sysfs directory holding the SMBIOS/DMI fields
+	sysDMIDir = "/sys/class/dmi/id"
+
+	// dmiFiles maps the DMI variables to their sysfs files
+	dmiFiles = map[string]string{
+		Serial:   "product_serial",
+		AssetTag: "chassis_asset_tag",
+		Product:  "product_name",
+		Vendor:   "sys_vendor",
+		UUID:     "product_uuid",
+	}
+
+	variableExp = regexp.MustCompile(`\$\{([A-Za-z0-9_]+)\}`)
+)
+
+// Facts are the template variables describing the installing machine, its
+// DMI fields and its entry of the optional mapping file
+type Facts struct {
+	values map[string]string
+
+	// mapped are the mapping file columns, the descriptors using them can't
+	// be installed on machines missing from the mapping
+	mapped   []string
+	mapFile  string
+	matching bool
+}
+
+// readDMI returns the DMI fields of the machine, the unset or unreadable
+// ones are left undefined
+func readDMI() map[string]string {
+	values := map[string]string{}
+
+	for name, file := range dmiFiles {
+		content, err := ioutil.ReadFile(filepath.Join(sysDMIDir, file))
+		if err != nil {
+			log.Debug("Could not read the DMI field %s: %v", file, err)
+			continue
+		}
+
+		if value := strings.TrimSpace(string(content)); value != "" {
+			values[name] = value
+		}
+	}
+
+	return values
+}
+
+// Load returns the facts of the machine, mapFile is the CSV or JSON mapping
+// file keyed by the machine serial number, if any
+func Load(mapFile string) (*Facts, error) {
+	result := &Facts{values: readDMI(), mapFile: mapFile}
+
+	if mapFile == "" {
+		return result, nil
+	}
+
+	mapping, err := loadMapping(mapFile)
+	if err != nil {
+		return nil, err
+	}
+
+	result.mapped = mapping.columns
+
+	entry := mapping.lookup(result.values[Serial], result.values[AssetTag])
+	if entry == nil {
+		log.Warning("No entry of %s matches the serial %q", mapFile, result.values[Serial])
+		return result, nil
+	}
+
+	result.matching = true
+	for k, v := range entry {
+		result.values[k] = v
+	}
+
+	return result, nil
+}
+
+// Get returns the value of the name variable, if defined
+func (f *Facts) Get(name string) (string, bool) {
+	value, ok := f.values[name]
+	return value, ok
+}
+
+// Names returns the defined variables, sorted
+func (f *Facts) Names() []string {
+	names := []string{}
+
+	for k := range f.values {
+		names = append(names, k)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// Expand replaces the ${name} variables of content with the facts values,
+// the other variables are left for their consumers, i.e the storage aliases
+// and the hooks. It fails if content uses a mapping column and the machine
+// has no mapping entry.
+func (f *Facts) Expand(content string) (string, error) {
+	var err error
+
+	result := variableExp.ReplaceAllStringFunc(content, func(match string) string {
+		name := variableExp.FindStringSubmatch(match)[1]
+
+		if value, ok := f.values[name]; ok {
+			return value
+		}
+
+		for _, curr := range f.mapped {
+			if curr == name && err == nil {
+				err = errors.Errorf("No entry of %s for this machine (serial %q) to set ${%s}",
+					f.mapFile, f.values[Serial], name)
+			}
+		}
+
+		return match
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	return result, nil
+}
@@ -0,0 +1,153 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package facts
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func setupDMI(t *testing.T, fields map[string]string) func() {
+	dir, err := ioutil.TempDir("", "clr-installer-dmi-")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for file, value := range fields {
+		if err = ioutil.WriteFile(filepath.Join(dir, file), []byte(value+"\n"), 0400); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	saved := sysDMIDir
+	sysDMIDir = dir
+
+	return func() {
+		sysDMIDir = saved
+		_ = os.RemoveAll(dir)
+	}
+}
+
+func writeMapping(t *testing.T, name string, content string) string {
+	file := filepath.Join(sysDMIDir, name)
+
+	if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return file
+}
+
+func TestLoadDMI(t *testing.T) {
+	defer setupDMI(t, map[string]string{
+		"product_serial":    "SN-0042",
+		"chassis_asset_tag": " ",
+		"product_name":      "NUC7i5BNH",
+	})()
+
+	mf, err := Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if value, _ := mf.Get(Serial); value != "SN-0042" {
+		t.Fatalf("Expected the serial SN-0042, got: %q", value)
+	}
+
+	if _, ok := mf.Get(AssetTag); ok {
+		t.Fatal("The blank asset tag should be undefined")
+	}
+
+	if strings.Join(mf.Names(), ",") != "dmiProduct,dmiSerial" {
+		t.Fatalf("Unexpected facts: %v", mf.Names())
+	}
+
+	result, err := mf.Expand("hostname: host-${dmiSerial}\ncmd: ${chrootDir}/bin/true ${dmiAssetTag}")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result != "hostname: host-SN-0042\ncmd: ${chrootDir}/bin/true ${dmiAssetTag}" {
+		t.Fatalf("Unexpected expansion: %q", result)
+	}
+}
+
+func TestMapping(t *testing.T) {
+	defer setupDMI(t, map[string]string{
+		"product_serial":    "SN-0042",
+		"chassis_asset_tag": "RACK7-U12",
+	})()
+
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"machines.csv", "# inventory\nserial, hostname, role\nSN-0001,web1,web\nSN-0042,db1,db\n"},
+		{"machines.json", `{"SN-0001": {"hostname": "web1", "role": "web"}, "SN-0042": {"hostname": "db1", "role": "db"}}`},
+		{"tags.csv", "assetTag,hostname,role\nRACK7-U11,web1,web\nRACK7-U12,db1,db\n"},
+	}
+
+	for _, curr := range tests {
+		mf, err := Load(writeMapping(t, curr.name, curr.content))
+		if err != nil {
+			t.Fatalf("Failed to load %s: %v", curr.name, err)
+		}
+
+		result, err := mf.Expand("hostname: ${hostname}-${role}")
+		if err != nil {
+			t.Fatalf("Failed to expand with %s: %v", curr.name, err)
+		}
+
+		if result != "hostname: db1-db" {
+			t.Fatalf("Unexpected expansion with %s: %q", curr.name, result)
+		}
+	}
+}
+
+func TestMappingNoEntry(t *testing.T) {
+	defer setupDMI(t, map[string]string{"product_serial": "SN-0099"})()
+
+	mf, err := Load(writeMapping(t, "machines.csv", "serial,hostname\nSN-0001,web1\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = mf.Expand("hostname: ${hostname}"); err == nil {
+		t.Fatal("Expanding a mapping column without entry should fail")
+	}
+
+	if _, err = mf.Expand("hostname: ${dmiSerial}"); err != nil {
+		t.Fatalf("The DMI variables should expand without entry: %v", err)
+	}
+}
+
+func TestInvalidMapping(t *testing.T) {
+	defer setupDMI(t, nil)()
+
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"missing.csv", ""},
+		{"short.csv", "serial,hostname\nSN-0001\n"},
+		{"nokey.csv", "hostname,role\nweb1,web\n"},
+		{"column.csv", "serial,host name\nSN-0001,web1\n"},
+		{"multiline.csv", "serial,hostname\nSN-0001,\"web1\nrole: db\"\n"},
+		{"malformed.json", `{"SN-0001": "web1"}`},
+	}
+
+	for _, curr := range tests {
+		if _, err := Load(writeMapping(t, curr.name, curr.content)); err == nil {
+			t.Fatalf("Loading %s should fail", curr.name)
+		}
+	}
+
+	if _, err := Load(filepath.Join(sysDMIDir, "nonexistent.csv")); err == nil {
+		t.Fatal("Loading a nonexistent mapping should fail")
+	}
+}
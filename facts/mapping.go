@@ -0,0 +1,153 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package facts
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/clearlinux/clr-installer/errors"
+)
+
+const (
+	// serialColumn is the mapping column matched against the machine serial
+	serialColumn = "serial"
+
+	// assetTagColumn is the optional mapping column matched against the
+	// chassis asset tag, for machines without a meaningful serial
+	assetTagColumn = "assetTag"
+)
+
+// mapping holds the entries of a mapping file
+type mapping struct {
+	columns []string
+	entries []map[string]string
+}
+
+// lookup returns the entry of the machine serial or assetTag, nil if none
+func (m *mapping) lookup(serial string, assetTag string) map[string]string {
+	for _, curr := range m.entries {
+		if serial != "" && curr[serialColumn] == serial {
+			return curr
+		}
+
+		if assetTag != "" && curr[assetTagColumn] == assetTag {
+			return curr
+		}
+	}
+
+	return nil
+}
+
+// add validates and adds entry to the mapping
+func (m *mapping) add(entry map[string]string) error {
+	for k, v := range entry {
+		if !variableExp.MatchString("${" + k + "}") {
+			return errors.ValidationErrorf("Invalid mapping column name: %q", k)
+		}
+
+		// the values are expanded in the descriptor text
+		if strings.ContainsAny(v, "\r\n") {
+			return errors.ValidationErrorf("Invalid multi-line mapping value of %s: %q", k, v)
+		}
+	}
+
+	if entry[serialColumn] == "" && entry[assetTagColumn] == "" {
+		return errors.ValidationErrorf("Mapping entry %d has no %s or %s", len(m.entries)+1,
+			serialColumn, assetTagColumn)
+	}
+
+	m.entries = append(m.entries, entry)
+	return nil
+}
+
+// parseCSV parses a mapping whose first line holds the columns names
+func parseCSV(content []byte) (*mapping, error) {
+	reader := csv.NewReader(strings.NewReader(string(content)))
+	reader.Comment = '#'
+	reader.TrimLeadingSpace = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, errors.ValidationErrorf("Invalid CSV mapping: %v", err)
+	}
+
+	if len(records) == 0 {
+		return nil, errors.ValidationErrorf("Empty CSV mapping, the first line must name the columns")
+	}
+
+	result := &mapping{columns: records[0]}
+
+	for _, record := range records[1:] {
+		entry := map[string]string{}
+
+		for idx, curr := range record {
+			entry[result.columns[idx]] = strings.TrimSpace(curr)
+		}
+
+		if err = result.add(entry); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// parseJSON parses a mapping object keyed by the machines serial numbers
+func parseJSON(content []byte) (*mapping, error) {
+	root := map[string]map[string]string{}
+
+	if err := json.Unmarshal(content, &root); err != nil {
+		return nil, errors.ValidationErrorf("Invalid JSON mapping: %v", err)
+	}
+
+	result := &mapping{}
+	columns := map[string]bool{serialColumn: true}
+
+	serials := []string{}
+	for k := range root {
+		serials = append(serials, k)
+	}
+	sort.Strings(serials)
+
+	for _, serial := range serials {
+		entry := map[string]string{serialColumn: serial}
+
+		for k, v := range root[serial] {
+			entry[k] = v
+			columns[k] = true
+		}
+
+		if err := result.add(entry); err != nil {
+			return nil, err
+		}
+	}
+
+	for k := range columns {
+		result.columns = append(result.columns, k)
+	}
+	sort.Strings(result.columns)
+
+	return result, nil
+}
+
+// loadMapping loads the file mapping, a JSON file if its extension is
+// .json, a CSV file otherwise
+func loadMapping(file string) (*mapping, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+
+	if strings.ToLower(filepath.Ext(file)) == ".json" {
+		return parseJSON(content)
+	}
+
+	return parseCSV(content)
+}
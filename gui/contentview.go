@@ -100,6 +100,27 @@ func (view *ContentView) UpdateView(page pages.Page) {
 	view.widgets[page.GetID()].Update()
 }
 
+// UpdateAll will update the summary of all the pages, since storing
+// the changes of a page may affect the state of the others
+func (view *ContentView) UpdateAll() {
+	for _, page := range view.views {
+		widget := view.widgets[page.GetID()]
+		widget.Update()
+		widget.SetHighlight(page.IsRequired() && !page.IsDone())
+	}
+}
+
+// GetIncomplete returns the summaries of the pages not yet completed
+func (view *ContentView) GetIncomplete() []string {
+	incomplete := []string{}
+	for i := 0; i < len(view.views); i++ {
+		if page := view.views[i]; !page.IsDone() {
+			incomplete = append(incomplete, page.GetSummary())
+		}
+	}
+	return incomplete
+}
+
 // IsDone returns true if all components have been completed
 func (view *ContentView) IsDone() bool {
 	for _, page := range view.views {
@@ -42,7 +42,8 @@ func New() *Gui {
 // MustRun is part of the Frontend interface implementation and tells the core that this
 // frontend wants/must run.
 func (gui *Gui) MustRun(args *args.Args) bool {
-	if args.ForceTUI {
+	// The config generation mode is only supported by the TUI
+	if args.ForceTUI || args.GenerateConfig != "" {
 		return false
 	}
 	return gtk.InitCheck(nil) == nil
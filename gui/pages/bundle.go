@@ -6,14 +6,18 @@ package pages
 
 import (
 	"fmt"
+	"html"
 	"os"
 	"path/filepath"
 	"strings"
 
 	"github.com/gotk3/gotk3/gdk"
+	"github.com/gotk3/gotk3/glib"
 	"github.com/gotk3/gotk3/gtk"
 
+	"github.com/clearlinux/clr-installer/log"
 	"github.com/clearlinux/clr-installer/model"
+	"github.com/clearlinux/clr-installer/storage"
 	"github.com/clearlinux/clr-installer/swupd"
 	"github.com/clearlinux/clr-installer/utils"
 )
@@ -40,8 +44,12 @@ type Bundle struct {
 	box        *gtk.Box            // Main layout
 	checks     *gtk.FlowBox        // Where to store checks
 	scroll     *gtk.ScrolledWindow // Scroll the checks
+	search     *gtk.SearchEntry    // Filter the checks
+	sizeLabel  *gtk.Label          // Estimated download size
+	loading    bool                // The catalog is loaded or being loaded
 
 	selections []*gtk.CheckButton
+	labels     []*gtk.Label
 }
 
 // LookupBundleIcon attempts to find the icon for the given bundle.
@@ -57,18 +65,31 @@ func LookupBundleIcon(bundle *swupd.Bundle) (string, bool) {
 	return "", false
 }
 
+// bundleMarkup returns the label markup of bundle: its name, category,
+// estimated size once known and description
+func bundleMarkup(bundle *swupd.Bundle) string {
+	details := utils.Locale.Get(bundle.Category)
+	if bundle.Size > 0 {
+		size, _ := storage.HumanReadableSize(bundle.Size)
+		details = details + ", " + size
+	}
+
+	return fmt.Sprintf("<b>%s</b> <small>%s</small>\n%s", html.EscapeString(bundle.Name),
+		html.EscapeString(details), html.EscapeString(utils.Locale.Get(bundle.Desc)))
+}
+
 // createBundleWidget creates new displayable widget for the given bundle
-func createBundleWidget(bundle *swupd.Bundle) (*gtk.CheckButton, error) {
+func createBundleWidget(bundle *swupd.Bundle) (*gtk.CheckButton, *gtk.Label, error) {
 	// Create the root layout
 	root, err := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 0)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	// Create display check
 	check, err := gtk.CheckButtonNew()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	check.SetMarginTop(6)
 	check.SetMarginStart(12)
@@ -78,7 +99,7 @@ func createBundleWidget(bundle *swupd.Bundle) (*gtk.CheckButton, error) {
 	img.SetMarginStart(12)
 	img.SetMarginEnd(6)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	icon, set := LookupBundleIcon(bundle)
 	if set {
@@ -98,10 +119,9 @@ func createBundleWidget(bundle *swupd.Bundle) (*gtk.CheckButton, error) {
 	img.SetSizeRequest(48, 48)
 	root.PackStart(img, false, false, 0)
 
-	txt := fmt.Sprintf("<b>%s</b>\n%s", bundle.Name, utils.Locale.Get(bundle.Desc))
-	label, err := gtk.LabelNew(txt)
+	label, err := gtk.LabelNew(bundleMarkup(bundle))
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	label.SetMarginStart(6)
 	label.SetMarginEnd(12)
@@ -110,7 +130,7 @@ func createBundleWidget(bundle *swupd.Bundle) (*gtk.CheckButton, error) {
 	label.SetUseMarkup(true)
 
 	check.Add(root)
-	return check, nil
+	return check, label, nil
 }
 
 // NewBundlePage returns a new BundlePage
@@ -121,18 +141,23 @@ func NewBundlePage(controller Controller, model *model.SystemInstall) (Page, err
 		model:      model,
 	}
 
-	// Load our bundles
-	bundle.bundles, err = swupd.LoadBundleList(model)
+	// main layout
+	bundle.box, err = gtk.BoxNew(gtk.ORIENTATION_VERTICAL, 0)
 	if err != nil {
 		return nil, err
 	}
+	bundle.box.SetBorderWidth(8)
 
-	// main layout
-	bundle.box, err = gtk.BoxNew(gtk.ORIENTATION_VERTICAL, 0)
+	// search as you type
+	bundle.search, err = setSearchEntry("search-entry")
 	if err != nil {
 		return nil, err
 	}
-	bundle.box.SetBorderWidth(8)
+	bundle.box.PackStart(bundle.search, false, false, 0)
+
+	if _, err := bundle.search.Connect("search-changed", bundle.onSearch); err != nil {
+		return nil, err
+	}
 
 	// check list
 	bundle.checks, err = gtk.FlowBoxNew()
@@ -149,17 +174,131 @@ func NewBundlePage(controller Controller, model *model.SystemInstall) (Page, err
 	bundle.scroll.Add(bundle.checks)
 	bundle.box.PackStart(bundle.scroll, true, true, 0)
 
-	// Match the bundle set to our ticks
-	for _, b := range bundle.bundles {
-		wid, err := createBundleWidget(b)
+	bundle.sizeLabel, err = setLabel("", "label-rules", 0.0)
+	if err != nil {
+		return nil, err
+	}
+	bundle.box.PackStart(bundle.sizeLabel, false, false, 0)
+
+	return bundle, nil
+}
+
+// loadCatalog loads the bundle catalog in the background, it may be fetched
+// from the mirror; the checks are created once it's loaded
+func (bundle *Bundle) loadCatalog() {
+	bundle.loading = true
+	bundle.sizeLabel.SetText(utils.Locale.Get("Loading the bundle catalog..."))
+
+	go func() {
+		bundles, err := swupd.LoadBundleCatalog(bundle.model)
+
+		if _, iErr := glib.IdleAdd(func() {
+			if err != nil {
+				log.Error("Failed to load the bundle catalog: %v", err)
+				bundle.sizeLabel.SetText(utils.Locale.Get("Failed to load the bundle catalog"))
+				bundle.loading = false
+				return
+			}
+
+			bundle.showCatalog(bundles)
+		}); iErr != nil {
+			log.Warning("Failed to show the bundle catalog: %v", iErr)
+		}
+	}()
+}
+
+// showCatalog creates the checks of bundles, selected as in the model
+func (bundle *Bundle) showCatalog(bundles []*swupd.Bundle) {
+	for _, b := range bundles {
+		wid, label, err := createBundleWidget(b)
 		if err != nil {
-			return nil, err
+			log.Warning("Failed to create the %s bundle widget: %v", b.Name, err)
+			continue
+		}
+
+		curr, currLabel := b, label
+		if _, err := wid.Connect("toggled", func(check *gtk.CheckButton) {
+			if check.GetActive() {
+				bundle.fetchSize(curr, currLabel)
+			}
+			bundle.updateSize()
+		}); err != nil {
+			log.Warning("Failed to connect the %s bundle widget: %v", b.Name, err)
 		}
+
 		bundle.checks.Add(wid)
+		bundle.bundles = append(bundle.bundles, b)
 		bundle.selections = append(bundle.selections, wid)
+		bundle.labels = append(bundle.labels, label)
 	}
 
-	return bundle, nil
+	bundle.checks.ShowAll()
+	bundle.ResetChanges()
+}
+
+// fetchSize reads the size of a selected bundle from its manifest in the
+// background, its label and the total are updated when it's done
+func (bundle *Bundle) fetchSize(b *swupd.Bundle, label *gtk.Label) {
+	if b.Size > 0 {
+		return
+	}
+
+	go func() {
+		if err := swupd.FetchBundleSize(bundle.model, b); err != nil {
+			log.Warning("Could not fetch the %s bundle size: %v", b.Name, err)
+			return
+		}
+
+		if _, err := glib.IdleAdd(func() {
+			label.SetMarkup(bundleMarkup(b))
+			bundle.updateSize()
+		}); err != nil {
+			log.Warning("Failed to show the %s bundle size: %v", b.Name, err)
+		}
+	}()
+}
+
+// updateSize shows the estimated download size of the selected bundles
+func (bundle *Bundle) updateSize() {
+	total := uint64(0)
+	unknown := false
+
+	for n, b := range bundle.bundles {
+		if !bundle.selections[n].GetActive() {
+			continue
+		}
+
+		if b.Size == 0 {
+			unknown = true
+		}
+		total += b.Size
+	}
+
+	size, _ := storage.HumanReadableSize(total)
+	msg := utils.Locale.Get("Estimated download size: %s", size)
+	if unknown {
+		msg = msg + " " + utils.Locale.Get("(some sizes unknown)")
+	}
+
+	bundle.sizeLabel.SetText(msg)
+}
+
+// onSearch shows the bundles matching the search
+func (bundle *Bundle) onSearch(entry *gtk.SearchEntry) {
+	search := getTextFromSearchEntry(entry)
+
+	for n, b := range bundle.bundles {
+		child := bundle.checks.GetChildAtIndex(n)
+		if child == nil {
+			continue
+		}
+
+		if b.Matches(search) {
+			child.Show()
+		} else {
+			child.Hide()
+		}
+	}
 }
 
 // IsDone checks if all the steps are completed
@@ -210,19 +349,29 @@ func (bundle *Bundle) StoreChanges() {
 	}
 }
 
-// ResetChanges will reset this page to match the model
+// ResetChanges will reset this page to match the model, the catalog is
+// loaded the first time
 func (bundle *Bundle) ResetChanges() {
+	if !bundle.loading {
+		bundle.loadCatalog()
+	}
+
 	// Match selection to what's in the model
 	for n, b := range bundle.bundles {
 		bundle.selections[n].SetActive(bundle.model.ContainsUserBundle(b.Name))
 	}
+	bundle.search.SetText("")
+	if len(bundle.bundles) > 0 {
+		bundle.updateSize()
+	}
 	bundle.controller.SetButtonState(ButtonConfirm, true)
 }
 
 // GetConfiguredValue returns our current config
 func (bundle *Bundle) GetConfiguredValue() string {
-	if len(bundle.model.UserBundles) == 0 {
-		return utils.Locale.Get("No additional bundles selected")
+	item := bundle.model.SummaryOf(model.SummaryBundles)
+	if len(item.Values) == 0 {
+		return item.Value
 	}
-	return " • " + strings.Join(bundle.model.UserBundles, "\n • ")
+	return " • " + strings.Join(item.Values, "\n • ")
 }
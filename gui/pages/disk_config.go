@@ -6,23 +6,30 @@ package pages
 
 import (
 	"fmt"
+	"html"
+	"strings"
 
 	"github.com/gotk3/gotk3/gdk"
 	"github.com/gotk3/gotk3/glib"
 	"github.com/gotk3/gotk3/gtk"
 
+	"github.com/clearlinux/clr-installer/controller"
 	"github.com/clearlinux/clr-installer/gui/common"
 	"github.com/clearlinux/clr-installer/log"
 	"github.com/clearlinux/clr-installer/model"
 	"github.com/clearlinux/clr-installer/storage"
+	"github.com/clearlinux/clr-installer/swupd"
 	"github.com/clearlinux/clr-installer/utils"
 )
 
 // DiskConfig is a simple page to help with DiskConfig settings
 type DiskConfig struct {
 	devs               []*storage.BlockDevice
+	diagnostics        []*storage.MediaDiagnostic
 	safeTargets        []storage.InstallTarget
 	destructiveTargets []storage.InstallTarget
+	shrinkTargets      []storage.InstallTarget
+	space              *storage.SpaceRequirements
 	activeDisk         *storage.BlockDevice
 	activeSerial       string
 	controller         Controller
@@ -33,15 +40,41 @@ type DiskConfig struct {
 	mediaGrid          *gtk.Grid
 	safeButton         *gtk.RadioButton
 	destructiveButton  *gtk.RadioButton
+	shrinkButton       *gtk.RadioButton
 	chooserCombo       *gtk.ComboBox
 	errorMessage       *gtk.Label
 	rescanButton       *gtk.Button
+	wipeButton         *gtk.Button
 	encryptCheck       *gtk.CheckButton
+	homeCheck          *gtk.CheckButton
+	fscryptCheck       *gtk.CheckButton
+	lvmCheck           *gtk.CheckButton
+	swapFileCheck      *gtk.CheckButton
+	mbrCheck           *gtk.CheckButton
+	mirrorBox          *gtk.Box
+	mirrorCheck        *gtk.CheckButton
+	mirrorCombo        *gtk.ComboBoxText
+	mirrorTargets      []storage.InstallTarget
+	dataExpander       *gtk.Expander
+	dataGrid           *gtk.Grid
+	dataCombos         []*gtk.ComboBoxText
+	dataTargets        []storage.InstallTarget
+	shrinkBox          *gtk.Box
+	shrinkScale        *gtk.Scale
+	shrinkLabel        *gtk.Label
+	tableWarning       *gtk.Label
+	espBox             *gtk.Box
+	espCombo           *gtk.ComboBoxText
+	bootBox            *gtk.Box
+	bootCombo          *gtk.ComboBoxText
 	passphraseDialog   *gtk.Dialog
 	passphrase         *gtk.Entry
 	passphraseConfirm  *gtk.Entry
 	passphraseChanged  bool
 	passphraseWarning  *gtk.Label
+	passphraseStrength *gtk.LevelBar
+	strengthLabel      *gtk.Label
+	recoveryCheck      *gtk.CheckButton
 	passphraseOK       *gtk.Button
 	passphraseCancel   *gtk.Button
 }
@@ -51,6 +84,7 @@ func NewDiskConfigPage(controller Controller, model *model.SystemInstall) (Page,
 	disk := &DiskConfig{
 		controller: controller,
 		model:      model,
+		space:      storage.NewSpaceRequirements(0),
 	}
 	var err error
 
@@ -169,6 +203,45 @@ func NewDiskConfigPage(controller Controller, model *model.SystemInstall) (Page,
 	destructiveBox.ShowAll()
 	disk.mediaGrid.Attach(destructiveBox, 0, 1, 1, 1)
 
+	// Build the Shrink Install Section, alongside another operating system
+	disk.shrinkButton, err = gtk.RadioButtonNewFromWidget(disk.safeButton)
+	if err != nil {
+		return nil, err
+	}
+
+	shrinkBox, err := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 0)
+	if err != nil {
+		return nil, err
+	}
+	shrinkBox.SetMarginStart(common.StartEndMargin)
+	shrinkBox.PackStart(disk.shrinkButton, false, false, 10)
+	if _, err := disk.shrinkButton.Connect("toggled", func() {
+		if err := disk.populateComboBoxes(); err != nil {
+			log.Warning("Problem populating possible disk selections")
+		}
+	}); err != nil {
+		return nil, err
+	}
+
+	shrinkVerticalBox, _ := gtk.BoxNew(gtk.ORIENTATION_VERTICAL, 10)
+	shrinkBox.PackStart(shrinkVerticalBox, true, true, 0)
+	shrinkTitle := utils.Locale.Get("Shrink Installation")
+	shrinkDescription := utils.Locale.Get("Shrink an existing partition and install alongside its operating system.")
+	text = fmt.Sprintf("<big>%s</big>\n", shrinkTitle)
+	text = text + shrinkDescription
+	shrinkLabel, err := gtk.LabelNew(text)
+	if err != nil {
+		return nil, err
+	}
+	shrinkLabel.SetXAlign(0.0)
+	shrinkLabel.SetLineWrap(true)
+	shrinkLabel.SetHAlign(gtk.ALIGN_START)
+	shrinkLabel.SetUseMarkup(true)
+	shrinkVerticalBox.PackStart(shrinkLabel, false, false, 0)
+
+	shrinkBox.ShowAll()
+	disk.mediaGrid.Attach(shrinkBox, 0, 2, 1, 1)
+
 	log.Debug("Before making ComboBox")
 	disk.chooserCombo, err = gtk.ComboBoxNew()
 	if err != nil {
@@ -193,7 +266,7 @@ func NewDiskConfigPage(controller Controller, model *model.SystemInstall) (Page,
 	disk.chooserCombo.PackStart(sizeRenderer, true)
 	disk.chooserCombo.AddAttribute(sizeRenderer, "text", 3)
 
-	disk.mediaGrid.Attach(disk.chooserCombo, 1, 0, 1, 2)
+	disk.mediaGrid.Attach(disk.chooserCombo, 1, 0, 1, 3)
 
 	disk.mediaGrid.SetRowSpacing(10)
 	disk.mediaGrid.SetColumnSpacing(10)
@@ -232,6 +305,233 @@ func NewDiskConfigPage(controller Controller, model *model.SystemInstall) (Page,
 		return nil, err
 	}
 
+	// Encrypt only a separate /home partition button
+	disk.homeCheck, err = gtk.CheckButtonNew()
+	if err != nil {
+		return nil, err
+	}
+
+	disk.homeCheck.SetLabel("  " + utils.Locale.Get("Encrypt /home only"))
+	disk.homeCheck.SetMarginStart(2 * common.StartEndMargin)
+	disk.homeCheck.SetHAlign(gtk.ALIGN_START)
+	disk.homeCheck.SetSensitive(false)
+	disk.scrollBox.PackStart(disk.homeCheck, false, false, 0)
+
+	// Encrypt the home directory of each user with their login password
+	disk.fscryptCheck, err = gtk.CheckButtonNew()
+	if err != nil {
+		return nil, err
+	}
+
+	disk.fscryptCheck.SetLabel("  " + utils.Locale.Get("Encrypt home directories per user"))
+	disk.fscryptCheck.SetMarginStart(common.StartEndMargin)
+	disk.fscryptCheck.SetHAlign(gtk.ALIGN_START)
+	disk.fscryptCheck.SetActive(disk.model.HomeEncryption == storage.HomeEncryptionFscrypt)
+	disk.scrollBox.PackStart(disk.fscryptCheck, false, false, 0)
+
+	// LVM button, encrypted physical volumes are not supported
+	disk.lvmCheck, err = gtk.CheckButtonNew()
+	if err != nil {
+		return nil, err
+	}
+
+	disk.lvmCheck.SetLabel("  " + utils.Locale.Get("Use LVM"))
+	disk.lvmCheck.SetMarginStart(common.StartEndMargin)
+	disk.lvmCheck.SetHAlign(gtk.ALIGN_START)
+	disk.scrollBox.PackStart(disk.lvmCheck, false, false, 0)
+
+	if _, err := disk.lvmCheck.Connect("clicked", disk.updateLayoutChoice); err != nil {
+		return nil, err
+	}
+
+	// Swap file button, the root partition takes the space of the swap one
+	disk.swapFileCheck, err = gtk.CheckButtonNew()
+	if err != nil {
+		return nil, err
+	}
+
+	disk.swapFileCheck.SetLabel("  " + utils.Locale.Get("Use a swap file instead of a swap partition"))
+	disk.swapFileCheck.SetMarginStart(common.StartEndMargin)
+	disk.swapFileCheck.SetHAlign(gtk.ALIGN_START)
+	disk.swapFileCheck.SetActive(disk.model.SwapFileSize != "")
+	disk.scrollBox.PackStart(disk.swapFileCheck, false, false, 0)
+
+	// Mirror button, whole disk installs only, the mirrored root partition
+	// is neither encrypted nor on LVM
+	disk.mirrorBox, err = gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 10)
+	if err != nil {
+		return nil, err
+	}
+	disk.mirrorBox.SetMarginStart(common.StartEndMargin)
+	disk.mirrorBox.SetSensitive(false)
+
+	disk.mirrorCheck, err = gtk.CheckButtonNew()
+	if err != nil {
+		return nil, err
+	}
+
+	disk.mirrorCheck.SetLabel("  " + utils.Locale.Get("Mirror across two disks"))
+	disk.mirrorCheck.SetHAlign(gtk.ALIGN_START)
+	disk.mirrorBox.PackStart(disk.mirrorCheck, false, false, 0)
+
+	disk.mirrorCombo, err = gtk.ComboBoxTextNew()
+	if err != nil {
+		return nil, err
+	}
+	disk.mirrorCombo.SetSensitive(false)
+	disk.mirrorBox.PackStart(disk.mirrorCombo, false, false, 0)
+	disk.scrollBox.PackStart(disk.mirrorBox, false, false, 0)
+
+	if _, err := disk.mirrorCheck.Connect("clicked", disk.updateLayoutChoice); err != nil {
+		return nil, err
+	}
+
+	// Advanced view, the other disks may hold /home, /var or the swap of
+	// the same install
+	disk.dataExpander, err = gtk.ExpanderNew(utils.Locale.Get("Use other disks for the same install"))
+	if err != nil {
+		return nil, err
+	}
+	disk.dataExpander.SetMarginStart(common.StartEndMargin)
+	disk.dataExpander.SetSensitive(false)
+
+	disk.dataGrid, err = gtk.GridNew()
+	if err != nil {
+		return nil, err
+	}
+	disk.dataGrid.SetRowSpacing(5)
+	disk.dataGrid.SetColumnSpacing(10)
+	disk.dataGrid.SetMarginStart(common.StartEndMargin)
+	disk.dataExpander.Add(disk.dataGrid)
+	disk.scrollBox.PackStart(disk.dataExpander, false, false, 0)
+
+	// New size of the partition to shrink, only for shrink installs
+	disk.shrinkBox, err = gtk.BoxNew(gtk.ORIENTATION_VERTICAL, 5)
+	if err != nil {
+		return nil, err
+	}
+	disk.shrinkBox.SetMarginStart(common.StartEndMargin)
+	disk.shrinkBox.SetMarginEnd(common.StartEndMargin)
+	disk.shrinkBox.SetSensitive(false)
+
+	disk.shrinkScale, err = gtk.ScaleNewWithRange(gtk.ORIENTATION_HORIZONTAL, 0, 1, 1)
+	if err != nil {
+		return nil, err
+	}
+	disk.shrinkScale.SetDrawValue(false)
+	disk.shrinkBox.PackStart(disk.shrinkScale, false, false, 0)
+
+	disk.shrinkLabel, err = gtk.LabelNew("")
+	if err != nil {
+		return nil, err
+	}
+	disk.shrinkLabel.SetHAlign(gtk.ALIGN_START)
+	disk.shrinkBox.PackStart(disk.shrinkLabel, false, false, 0)
+	disk.scrollBox.PackStart(disk.shrinkBox, false, false, 0)
+
+	if _, err := disk.shrinkScale.Connect("value-changed", disk.updateShrinkLabel); err != nil {
+		return nil, err
+	}
+
+	// Keep the MBR partition table button, legacy BIOS only
+	disk.mbrCheck, err = gtk.CheckButtonNew()
+	if err != nil {
+		return nil, err
+	}
+
+	disk.mbrCheck.SetLabel("  " + utils.Locale.Get("Keep MBR partition table"))
+	disk.mbrCheck.SetMarginStart(common.StartEndMargin)
+	disk.mbrCheck.SetHAlign(gtk.ALIGN_START)
+	disk.mbrCheck.SetSensitive(false)
+	disk.scrollBox.PackStart(disk.mbrCheck, false, false, 0)
+
+	if _, err := disk.mbrCheck.Connect("clicked", disk.updateTableChoice); err != nil {
+		return nil, err
+	}
+
+	// What happens to the MBR or hybrid partition table of the selected target
+	disk.tableWarning, err = gtk.LabelNew("")
+	if err != nil {
+		return nil, err
+	}
+	disk.tableWarning.SetUseMarkup(true)
+	disk.tableWarning.SetHAlign(gtk.ALIGN_START)
+	disk.tableWarning.SetMarginStart(common.StartEndMargin)
+	disk.scrollBox.PackStart(disk.tableWarning, false, false, 0)
+
+	// Existing EFI System Partition policy, only for partial installs
+	disk.espBox, err = gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 10)
+	if err != nil {
+		return nil, err
+	}
+	disk.espBox.SetMarginStart(common.StartEndMargin)
+	disk.espBox.SetSensitive(false)
+
+	espLabel, err := gtk.LabelNew(utils.Locale.Get("Existing EFI System Partition"))
+	if err != nil {
+		return nil, err
+	}
+	disk.espBox.PackStart(espLabel, false, false, 0)
+
+	disk.espCombo, err = gtk.ComboBoxTextNew()
+	if err != nil {
+		return nil, err
+	}
+	disk.espCombo.Append(storage.ESPPolicyCreate, utils.Locale.Get("Keep it and create a new one"))
+	disk.espCombo.Append(storage.ESPPolicyReuse, utils.Locale.Get("Reuse it"))
+	disk.espCombo.Append(storage.ESPPolicyReplace, utils.Locale.Get("Replace it"))
+	disk.espBox.PackStart(disk.espCombo, false, false, 0)
+	disk.scrollBox.PackStart(disk.espBox, false, false, 0)
+
+	// Default boot entry, only when sharing the EFI System Partition
+	disk.bootBox, err = gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 10)
+	if err != nil {
+		return nil, err
+	}
+	disk.bootBox.SetMarginStart(common.StartEndMargin)
+	disk.bootBox.SetSensitive(false)
+
+	bootLabel, err := gtk.LabelNew(utils.Locale.Get("Boot by default"))
+	if err != nil {
+		return nil, err
+	}
+	disk.bootBox.PackStart(bootLabel, false, false, 0)
+
+	disk.bootCombo, err = gtk.ComboBoxTextNew()
+	if err != nil {
+		return nil, err
+	}
+	disk.bootBox.PackStart(disk.bootCombo, false, false, 0)
+	disk.scrollBox.PackStart(disk.bootBox, false, false, 0)
+
+	if _, err = disk.espCombo.Connect("changed", disk.onESPChanged); err != nil {
+		return nil, err
+	}
+
+	if _, err = disk.chooserCombo.Connect("changed", disk.updateESPChoice); err != nil {
+		return nil, err
+	}
+
+	if _, err = disk.chooserCombo.Connect("changed", disk.updateWipeChoice); err != nil {
+		return nil, err
+	}
+
+	if _, err = disk.chooserCombo.Connect("changed", disk.updateTableChoice); err != nil {
+		return nil, err
+	}
+
+	if _, err = disk.chooserCombo.Connect("changed", disk.updateMirrorChoice); err != nil {
+		return nil, err
+	}
+
+	if _, err = disk.chooserCombo.Connect("changed", disk.updateShrinkChoice); err != nil {
+		return nil, err
+	}
+
+	if _, err = disk.chooserCombo.Connect("changed", disk.updateDataDiskChoice); err != nil {
+		return nil, err
+	}
+
 	// Buttons
 	disk.rescanButton, err = setButton(utils.Locale.Get("RESCAN MEDIA"), "button-page")
 	if err != nil {
@@ -241,7 +541,12 @@ func NewDiskConfigPage(controller Controller, model *model.SystemInstall) (Page,
 
 	if _, err = disk.rescanButton.Connect("clicked", func() {
 		log.Debug("rescan")
-		_ = disk.scanMediaDevices()
+		if storage.HasDiagnosedModules(disk.diagnostics) {
+			if err := storage.LoadDiagnosedModules(disk.diagnostics); err != nil {
+				log.Warning("Failed to load the storage drivers: %v", err)
+			}
+		}
+		_ = disk.rescanMediaDevices()
 		// Check if the active device is still present
 		var found bool
 		for _, bd := range disk.devs {
@@ -268,6 +573,18 @@ func NewDiskConfigPage(controller Controller, model *model.SystemInstall) (Page,
 	rescanBox.SetMarginStart(common.StartEndMargin)
 	rescanBox.PackStart(disk.rescanButton, false, false, 10)
 
+	disk.wipeButton, err = setButton(utils.Locale.Get("DEACTIVATE AND WIPE"), "button-page")
+	if err != nil {
+		return nil, err
+	}
+	disk.wipeButton.SetTooltipText(utils.Locale.Get("Stop and erase the existing LUKS, LVM and RAID devices of the selected media."))
+	disk.wipeButton.SetSensitive(false)
+
+	if _, err = disk.wipeButton.Connect("clicked", disk.onWipeClicked); err != nil {
+		return nil, err
+	}
+	rescanBox.PackStart(disk.wipeButton, false, false, 10)
+
 	rescanBox.ShowAll()
 	disk.scrollBox.Add(rescanBox)
 
@@ -373,6 +690,30 @@ func (disk *DiskConfig) createPassphraseDialog() {
 	disk.passphraseConfirm.SetMarginBottom(common.TopBottomMargin)
 	contentBox.PackStart(disk.passphraseConfirm, true, true, 0)
 
+	// Passphrase strength meter
+	strengthBox, err := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 10)
+	if err != nil {
+		log.Warning("Error creating box")
+		return
+	}
+	strengthBox.SetMarginBottom(common.TopBottomMargin)
+	contentBox.PackStart(strengthBox, true, true, 0)
+
+	disk.passphraseStrength, err = gtk.LevelBarNewForInterval(0, storage.MaxPassphraseStrength)
+	if err != nil {
+		log.Warning("Error creating level bar")
+		return
+	}
+	disk.passphraseStrength.SetMode(gtk.LEVEL_BAR_MODE_DISCRETE)
+	strengthBox.PackStart(disk.passphraseStrength, true, true, 0)
+
+	disk.strengthLabel, err = gtk.LabelNew("")
+	if err != nil {
+		log.Warning("Error creating label")
+		return
+	}
+	strengthBox.PackStart(disk.strengthLabel, false, false, 0)
+
 	disk.passphraseWarning, err = setLabel("", "label-warning", 0.0)
 	if err != nil {
 		log.Warning("Error creating label")
@@ -380,6 +721,15 @@ func (disk *DiskConfig) createPassphraseDialog() {
 	}
 	contentBox.PackStart(disk.passphraseWarning, true, true, 0)
 
+	disk.recoveryCheck, err = gtk.CheckButtonNew()
+	if err != nil {
+		log.Warning("Error creating check button")
+		return
+	}
+	disk.recoveryCheck.SetLabel("  " + utils.Locale.Get("Generate a recovery key"))
+	disk.recoveryCheck.SetActive(disk.model.CryptKeys != nil && disk.model.CryptKeys.Recovery)
+	contentBox.PackStart(disk.recoveryCheck, true, true, 0)
+
 	disk.passphraseCancel, err = common.SetButton(utils.Locale.Get("CANCEL"), "button-cancel")
 	disk.passphraseCancel.SetMarginEnd(common.ButtonSpacing)
 	if err != nil {
@@ -473,6 +823,10 @@ func (disk *DiskConfig) validatePassphrase() {
 		return
 	}
 
+	strength, name := storage.PassphraseStrength(getTextFromEntry(disk.passphrase))
+	disk.passphraseStrength.SetValue(float64(strength))
+	disk.strengthLabel.SetText(name)
+
 	if ok, msg := storage.IsValidPassphrase(getTextFromEntry(disk.passphrase)); !ok {
 		disk.passphraseWarning.SetText(msg)
 		disk.passphraseOK.SetSensitive(false)
@@ -489,6 +843,15 @@ func (disk *DiskConfig) validatePassphrase() {
 func (disk *DiskConfig) dialogResponse(msgDialog *gtk.Dialog, responseType gtk.ResponseType) {
 	if responseType == gtk.RESPONSE_OK {
 		disk.model.CryptPass = getTextFromEntry(disk.passphrase)
+
+		if disk.recoveryCheck.GetActive() {
+			if disk.model.CryptKeys == nil {
+				disk.model.CryptKeys = &storage.CryptKeys{}
+			}
+			disk.model.CryptKeys.Recovery = true
+		} else if disk.model.CryptKeys != nil {
+			disk.model.CryptKeys.Recovery = false
+		}
 	} else {
 		disk.encryptCheck.SetActive(false)
 	}
@@ -499,14 +862,439 @@ func (disk *DiskConfig) onEncryptClick(button *gtk.CheckButton) {
 	if disk.encryptCheck.GetActive() {
 		disk.createPassphraseDialog()
 		disk.passphraseDialog.ShowAll()
+	} else {
+		disk.homeCheck.SetActive(false)
+	}
+	disk.homeCheck.SetSensitive(disk.encryptCheck.GetActive())
+	disk.updateLayoutChoice()
+}
+
+// updateLayoutChoice keeps the encryption, LVM and mirror options exclusive
+func (disk *DiskConfig) updateLayoutChoice() {
+	encrypt := disk.encryptCheck.GetActive()
+	lvm := disk.lvmCheck.GetActive()
+	mirror := disk.mirrorCheck.GetActive()
+
+	disk.encryptCheck.SetSensitive(!lvm && !mirror)
+	disk.lvmCheck.SetSensitive(!encrypt && !mirror)
+	disk.mirrorBox.SetSensitive(len(disk.mirrorTargets) > 0 && !encrypt && !lvm)
+	disk.mirrorCombo.SetSensitive(mirror)
+}
+
+// updateMirrorChoice lists the disks the selected whole disk target can be
+// mirrored to
+func (disk *DiskConfig) updateMirrorChoice() {
+	disk.mirrorTargets = nil
+	disk.mirrorCombo.RemoveAll()
+
+	if target, found := disk.selectedTarget(); found && target.WholeDisk {
+		for _, curr := range disk.destructiveTargets {
+			if curr.WholeDisk && curr.Name != target.Name {
+				disk.mirrorTargets = append(disk.mirrorTargets, curr)
+				disk.mirrorCombo.Append(curr.Name, fmt.Sprintf("%s (%s)", curr.Friendly, curr.Name))
+			}
+		}
+	}
+
+	if len(disk.mirrorTargets) > 0 {
+		disk.mirrorCombo.SetActive(0)
+	} else {
+		disk.mirrorCheck.SetActive(false)
+	}
+
+	disk.updateLayoutChoice()
+}
+
+// updateDataDiskChoice lists the whole disks, other than the one of the
+// selected target, which can contribute a partition to the install
+func (disk *DiskConfig) updateDataDiskChoice() {
+	for range disk.dataCombos {
+		disk.dataGrid.RemoveRow(0)
+	}
+	disk.dataCombos = nil
+	disk.dataTargets = nil
+
+	if target, found := disk.selectedTarget(); found {
+		for _, curr := range disk.destructiveTargets {
+			if !curr.WholeDisk || curr.Name == target.Name {
+				continue
+			}
+
+			label, err := gtk.LabelNew(fmt.Sprintf("%s (%s)", curr.Friendly, curr.Name))
+			if err != nil {
+				log.Warning("Failed to list the data disk %s: %s", curr.Name, err)
+				continue
+			}
+			label.SetHAlign(gtk.ALIGN_START)
+
+			combo, err := gtk.ComboBoxTextNew()
+			if err != nil {
+				log.Warning("Failed to list the data disk %s: %s", curr.Name, err)
+				continue
+			}
+			combo.Append("", utils.Locale.Get("Not used"))
+			for _, use := range storage.DataDiskUses {
+				combo.Append(use, use)
+			}
+			combo.SetActive(0)
+
+			row := len(disk.dataCombos)
+			disk.dataGrid.Attach(label, 0, row, 1, 1)
+			disk.dataGrid.Attach(combo, 1, row, 1, 1)
+			disk.dataCombos = append(disk.dataCombos, combo)
+			disk.dataTargets = append(disk.dataTargets, curr)
+		}
+	}
+
+	disk.dataGrid.ShowAll()
+	disk.dataExpander.SetSensitive(len(disk.dataTargets) > 0)
+}
+
+// storeDataDisks adds to the model the data disks chosen in the advanced
+// view, the mirror disk is never one of them
+func (disk *DiskConfig) storeDataDisks(bds []*storage.BlockDevice, mirror string) {
+	for i, combo := range disk.dataCombos {
+		use := combo.GetActiveID()
+		if use == "" || disk.dataTargets[i].Name == mirror {
+			continue
+		}
+
+		for _, curr := range bds {
+			if curr.Name != disk.dataTargets[i].Name {
+				continue
+			}
+
+			data := curr.Clone()
+			if _, err := storage.NewDataDiskPartition(data, use); err != nil {
+				log.Error("Failed to use %s for %s: %s", curr.Name, use, err)
+				break
+			}
+			disk.model.AddTargetMedia(data)
+			break
+		}
+	}
+}
+
+// selectedESP returns the existing EFI System Partition of the selected
+// target, nil unless it's a partial install on a disk having one
+func (disk *DiskConfig) selectedESP() *storage.BlockDevice {
+	idx := disk.chooserCombo.GetActive()
+	if !disk.safeButton.GetActive() || idx < 0 || idx >= len(disk.safeTargets) {
+		return nil
+	}
+
+	target := disk.safeTargets[idx]
+	if target.WholeDisk {
+		return nil
+	}
+
+	for _, bd := range disk.devs {
+		if bd.Name == target.Name {
+			return bd.FindESP()
+		}
+	}
+
+	return nil
+}
+
+// updateESPChoice only lets the user choose the EFI System Partition policy
+// when the selected target has one
+func (disk *DiskConfig) updateESPChoice() {
+	esp := disk.selectedESP()
+	disk.espBox.SetSensitive(esp != nil)
+
+	policy := disk.model.ESPPolicy
+	if policy == "" {
+		policy = storage.ESPPolicyCreate
+	}
+	disk.espCombo.SetActiveID(policy)
+}
+
+// selectedSignatures returns the selected destructive target device and the
+// descriptions of its LUKS, LVM and RAID signatures
+func (disk *DiskConfig) selectedSignatures() (*storage.BlockDevice, []string) {
+	idx := disk.chooserCombo.GetActive()
+	if !disk.destructiveButton.GetActive() || idx < 0 || idx >= len(disk.destructiveTargets) {
+		return nil, nil
+	}
+
+	target := disk.destructiveTargets[idx]
+	for _, bd := range disk.devs {
+		if bd.Name == target.Name {
+			return bd, target.Signatures
+		}
+	}
+
+	return nil, nil
+}
+
+// updateWipeChoice refuses the selected destructive target while it has LUKS,
+// LVM or RAID signatures, they must be explicitly deactivated and wiped first
+func (disk *DiskConfig) updateWipeChoice() {
+	bd, signatures := disk.selectedSignatures()
+	disk.wipeButton.SetSensitive(len(signatures) > 0)
+
+	if bd == nil {
+		return
+	}
+
+	if len(signatures) == 0 {
+		disk.errorMessage.SetMarkup("")
+		disk.controller.SetButtonState(ButtonConfirm, true)
+		return
+	}
+
+	warning := utils.Locale.Get("Existing signatures must be deactivated and wiped first")
+	warning = "<big><b><span foreground=\"#FDB814\">" + html.EscapeString(utils.Locale.Get("Warning: %s", warning)) + "</span></b></big>"
+	for _, curr := range signatures {
+		warning = warning + "\n<small>" + html.EscapeString(curr) + "</small>"
 	}
+
+	disk.errorMessage.SetMarkup(warning)
+	disk.controller.SetButtonState(ButtonConfirm, false)
 }
 
-// This is time intensive, mitigate calls
+// selectedTarget returns the selected install target, false if none is
+func (disk *DiskConfig) selectedTarget() (storage.InstallTarget, bool) {
+	idx := disk.chooserCombo.GetActive()
+
+	if disk.safeButton.GetActive() && idx >= 0 && idx < len(disk.safeTargets) {
+		return disk.safeTargets[idx], true
+	}
+
+	if disk.destructiveButton.GetActive() && idx >= 0 && idx < len(disk.destructiveTargets) {
+		return disk.destructiveTargets[idx], true
+	}
+
+	if disk.shrinkButton.GetActive() && idx >= 0 && idx < len(disk.shrinkTargets) {
+		return disk.shrinkTargets[idx], true
+	}
+
+	return storage.InstallTarget{}, false
+}
+
+// updateShrinkChoice sets the slider range to the sizes the partition of the
+// selected shrink target can have, leaving room for a desktop install
+func (disk *DiskConfig) updateShrinkChoice() {
+	target, found := disk.selectedTarget()
+	if !found || target.Shrink == "" {
+		disk.shrinkBox.SetSensitive(false)
+		disk.shrinkLabel.SetText("")
+		return
+	}
+
+	low := float64(target.ShrinkMinimum / storage.MinimumPartitionSize)
+	high := float64((target.FreeEnd - disk.space.Total()) / storage.MinimumPartitionSize)
+	if high < low {
+		high = low
+	}
+
+	disk.shrinkScale.SetRange(low, high)
+	disk.shrinkScale.SetIncrements(1024, 10240)
+	disk.shrinkScale.SetValue(high)
+	disk.shrinkBox.SetSensitive(true)
+	disk.updateShrinkLabel()
+}
+
+// shrinkSize returns the new size of the partition to shrink
+func (disk *DiskConfig) shrinkSize() uint64 {
+	return uint64(disk.shrinkScale.GetValue()) * storage.MinimumPartitionSize
+}
+
+// updateShrinkLabel shows the space left to the other operating system and
+// the space freed for the install
+func (disk *DiskConfig) updateShrinkLabel() {
+	target, found := disk.selectedTarget()
+	if !found || target.Shrink == "" {
+		return
+	}
+
+	name := target.OS
+	if name == "" {
+		name = target.Shrink
+	}
+
+	keep, _ := storage.HumanReadableSizeWithPrecision(disk.shrinkSize(), 1)
+	free, _ := storage.HumanReadableSizeWithPrecision(target.FreeEnd-disk.shrinkSize(), 1)
+	disk.shrinkLabel.SetText(utils.Locale.Get("Keep %s for %s, free %s for Clear Linux* OS", keep, name, free))
+}
+
+// partitionTablePolicy returns the partition table policy chosen by the user
+func (disk *DiskConfig) partitionTablePolicy() string {
+	if disk.mbrCheck.GetActive() {
+		return storage.PartitionTablePolicyPreserve
+	}
+
+	return storage.PartitionTablePolicyConvert
+}
+
+// updateTableChoice warns about the MBR or hybrid partition table of the
+// selected target, the MBR one can only be kept for legacy BIOS installs
+func (disk *DiskConfig) updateTableChoice() {
+	target, found := disk.selectedTarget()
+
+	disk.mbrCheck.SetSensitive(found && disk.model.LegacyBios && target.LegacyTable == storage.PartitionTableMBR)
+	if !found || target.LegacyTable == "" {
+		disk.tableWarning.SetMarkup("")
+		return
+	}
+
+	warning := ""
+	for _, curr := range storage.PartitionTableWarnings(target, disk.partitionTablePolicy(), disk.model.LegacyBios) {
+		warning = warning + "<span foreground=\"#FDB814\">" + html.EscapeString(curr) + "</span>\n"
+	}
+
+	disk.tableWarning.SetMarkup(strings.TrimSuffix(warning, "\n"))
+}
+
+// onWipeClicked deactivates and wipes the LUKS, LVM and RAID signatures of the
+// selected media after the user confirmed it, then rescans the media
+func (disk *DiskConfig) onWipeClicked() {
+	bd, signatures := disk.selectedSignatures()
+	if bd == nil || len(signatures) == 0 {
+		return
+	}
+
+	contentBox, err := gtk.BoxNew(gtk.ORIENTATION_VERTICAL, 0)
+	if err != nil {
+		log.Warning("Error creating box")
+		return
+	}
+
+	text := utils.Locale.Get("Deactivate and wipe the LUKS, LVM and RAID signatures of %s? All their data will be lost.", bd.Name)
+	label, err := gtk.LabelNew(text + "\n\n" + strings.Join(signatures, "\n"))
+	if err != nil {
+		log.Warning("Error creating label")
+		return
+	}
+	label.SetHAlign(gtk.ALIGN_START)
+	contentBox.PackStart(label, true, true, 0)
+
+	dialog, err := common.CreateDialogOkCancel(contentBox, utils.Locale.Get("Deactivate and Wipe"),
+		utils.Locale.Get("WIPE"), utils.Locale.Get("CANCEL"))
+	if err != nil {
+		log.Warning("Error creating dialog")
+		return
+	}
+
+	_, err = dialog.Connect("response", func(msgDialog *gtk.Dialog, responseType gtk.ResponseType) {
+		msgDialog.Destroy()
+
+		if responseType != gtk.RESPONSE_OK {
+			return
+		}
+
+		log.Warning("Deactivating and wiping the signatures of %s: %s", bd.Name, strings.Join(signatures, ", "))
+		wipeErr := controller.WipeMedia(bd)
+
+		_ = disk.rescanMediaDevices()
+		disk.ResetChanges()
+
+		if wipeErr != nil {
+			log.Error("Failed to wipe %s: %s", bd.Name, wipeErr)
+			warning := utils.Locale.Get("Failed to wipe %s: %s", bd.Name, wipeErr.Error())
+			disk.errorMessage.SetMarkup("<big><b><span foreground=\"#FDB814\">" + html.EscapeString(warning) + "</span></b></big>")
+		}
+	})
+	if err != nil {
+		log.Warning("Error connecting to dialog")
+	}
+	dialog.ShowAll()
+	dialog.Run()
+}
+
+// updateBootChoice lists the boot entries of the other operating systems
+// sharing esp, the installed one is the default unless another is chosen
+func (disk *DiskConfig) updateBootChoice(esp *storage.BlockDevice) {
+	disk.bootCombo.RemoveAll()
+	disk.bootCombo.Append("", utils.Locale.Get("Clear Linux OS"))
+
+	entries, err := storage.DetectBootEntries(esp)
+	if err != nil {
+		log.Warning("Could not detect the boot entries: %v", err)
+	}
+
+	for _, curr := range entries {
+		disk.bootCombo.Append(curr.ID, curr.Title)
+	}
+
+	active := ""
+	if disk.model.BootMenu != nil {
+		active = disk.model.BootMenu.Default
+	}
+
+	if !disk.bootCombo.SetActiveID(active) {
+		disk.bootCombo.SetActiveID("")
+	}
+
+	disk.bootBox.SetSensitive(len(entries) > 0)
+}
+
+// onESPChanged checks the selected EFI System Partition can be reused
+func (disk *DiskConfig) onESPChanged() {
+	disk.bootBox.SetSensitive(false)
+
+	esp := disk.selectedESP()
+	if esp == nil {
+		return
+	}
+
+	switch disk.espCombo.GetActiveID() {
+	case storage.ESPPolicyReuse:
+		if err := storage.CheckESPFreeSpace(esp); err != nil {
+			log.Warning("Can not reuse the EFI System Partition: %v", err)
+			warning := utils.Locale.Get("Can not reuse the EFI System Partition: %s", err.Error())
+			disk.errorMessage.SetMarkup("<span foreground=\"#FDB814\">" + html.EscapeString(warning) + "</span>")
+			disk.espCombo.SetActiveID(storage.ESPPolicyCreate)
+			return
+		}
+		disk.errorMessage.SetMarkup("")
+		disk.updateBootChoice(esp)
+		return
+	case storage.ESPPolicyReplace:
+		warning := utils.Locale.Get("Other operating systems booting from %s will no longer boot", esp.GetDeviceFile())
+		disk.errorMessage.SetMarkup("<span foreground=\"#FDB814\">" + html.EscapeString(warning) + "</span>")
+	default:
+		disk.errorMessage.SetMarkup("")
+	}
+}
+
+// storeBootChoice sets the default boot entry chosen when sharing the
+// EFI System Partition, keeping the configured boot menu title and timeout
+func (disk *DiskConfig) storeBootChoice() {
+	entry := ""
+	if disk.model.ESPPolicy == storage.ESPPolicyReuse {
+		entry = disk.bootCombo.GetActiveID()
+	}
+
+	if disk.model.BootMenu == nil {
+		if entry == "" {
+			return
+		}
+		disk.model.BootMenu = &model.BootMenu{}
+	}
+
+	disk.model.BootMenu.Default = entry
+}
+
+// This is time intensive, the scan is cached by the controller until
+// invalidated or a block device is plugged or removed
 func (disk *DiskConfig) scanMediaDevices() error {
 	var err error
 
-	disk.devs, err = storage.RescanBlockDevices(disk.model.TargetMedias)
+	disk.devs, err = controller.ScanMedia(disk.model.TargetMedias)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// rescanMediaDevices drops the cached scan, i.e. on the user request
+func (disk *DiskConfig) rescanMediaDevices() error {
+	var err error
+
+	disk.devs, err = controller.RescanMedia(disk.model.TargetMedias)
 	if err != nil {
 		return err
 	}
@@ -532,10 +1320,25 @@ func (disk *DiskConfig) populateComboBoxes() error {
 		return err
 	}
 
+	disk.diagnostics = nil
+	disk.rescanButton.SetLabel(utils.Locale.Get("RESCAN MEDIA"))
+
 	if len(disk.devs) < 1 {
 		warning := utils.Locale.Get("No media found for installation")
 		log.Warning(warning)
 		warning = fmt.Sprintf("<big><b><span foreground=\"#FDB814\">" + utils.Locale.Get("Warning: %s", warning) + "</span></b></big>")
+
+		// Tell why the scan may have found nothing and offer to fix it
+		disk.diagnostics = storage.DiagnoseMediaScan()
+		for _, diag := range disk.diagnostics {
+			log.Warning("Media scan: %s", diag)
+			warning = warning + "\n<small>" + html.EscapeString(diag.String()) + "</small>"
+		}
+
+		if storage.HasDiagnosedModules(disk.diagnostics) {
+			disk.rescanButton.SetLabel(utils.Locale.Get("LOAD DRIVERS AND RESCAN"))
+		}
+
 		disk.errorMessage.SetMarkup(warning)
 		emptyStore, err := newListStoreMedia()
 		if err != nil {
@@ -548,7 +1351,12 @@ func (disk *DiskConfig) populateComboBoxes() error {
 		return nil
 	}
 
-	disk.safeTargets = storage.FindSafeInstallTargets(storage.MinimumDesktopInstallSize, disk.devs)
+	// the same requirements the model validation and the pre-checks use, the
+	// desktop installs need room for the desktop applications
+	disk.space = swupd.LoadSpaceRequirements(disk.model)
+	disk.space.Minimum = storage.MinimumDesktopInstallSize
+
+	disk.safeTargets = storage.FindSafeInstallTargets(disk.space.Total(), disk.devs)
 	disk.destructiveTargets = storage.FindAllInstallTargets(disk.devs)
 
 	if disk.safeButton.GetActive() {
@@ -565,7 +1373,7 @@ func (disk *DiskConfig) populateComboBoxes() error {
 			disk.chooserCombo.SetActive(0)
 		} else {
 			disk.chooserCombo.SetModel(safeStore)
-			warning := utils.Locale.Get("No safe media found for installation")
+			warning := utils.Locale.Get("No safe media found for installation, it needs %s", disk.space.String())
 			log.Warning(warning)
 			warning = fmt.Sprintf("<big><b><span foreground=\"#FDB814\">" + utils.Locale.Get("Warning: %s", warning) + "</span></b></big>")
 			disk.errorMessage.SetMarkup(warning)
@@ -582,6 +1390,33 @@ func (disk *DiskConfig) populateComboBoxes() error {
 		}
 		disk.chooserCombo.SetModel(destructiveStore)
 		disk.chooserCombo.SetActive(0)
+	} else if disk.shrinkButton.GetActive() {
+		shrinkStore, err := newListStoreMedia()
+		if err != nil {
+			log.Warning("ListStoreNew shrinkStore failed")
+			return err
+		}
+
+		disk.shrinkTargets = storage.FindShrinkInstallTargets(disk.space.Total(), disk.devs)
+		for _, target := range disk.shrinkTargets {
+			log.Debug("Adding shrink install target %s", target.Shrink)
+			err := addListStoreMediaRow(shrinkStore, target)
+			if err != nil {
+				log.Warning("SetValue shrinkStore")
+				return err
+			}
+		}
+		disk.chooserCombo.SetModel(shrinkStore)
+
+		if len(disk.shrinkTargets) > 0 {
+			disk.chooserCombo.SetActive(0)
+		} else {
+			warning := utils.Locale.Get("No partition found to shrink")
+			log.Warning(warning)
+			warning = fmt.Sprintf("<big><b><span foreground=\"#FDB814\">" + utils.Locale.Get("Warning: %s", warning) + "</span></b></big>")
+			disk.errorMessage.SetMarkup(warning)
+			disk.controller.SetButtonState(ButtonConfirm, false)
+		}
 	}
 
 	return nil
@@ -622,6 +1457,43 @@ func (disk *DiskConfig) GetTitle() string {
 	return disk.GetSummary()
 }
 
+// showError shows msg in a dialog, the page changes which could not be
+// stored are reported this way
+func (disk *DiskConfig) showError(msg string) {
+	contentBox, err := gtk.BoxNew(gtk.ORIENTATION_VERTICAL, 0)
+	if err != nil {
+		log.Warning("Error creating box")
+		return
+	}
+	contentBox.SetHAlign(gtk.ALIGN_FILL)
+	contentBox.SetMarginBottom(common.TopBottomMargin)
+
+	label, err := gtk.LabelNew(msg)
+	if err != nil {
+		log.Warning("Error creating label")
+		return
+	}
+	label.SetLineWrap(true)
+	label.SetHAlign(gtk.ALIGN_START)
+	contentBox.PackStart(label, false, true, 0)
+
+	title := utils.Locale.Get("Select Installation Media")
+	dialog, err := common.CreateDialogOneButton(contentBox, title, utils.Locale.Get("OK"), "button-confirm")
+	if err != nil {
+		log.Warning("Error creating dialog")
+		return
+	}
+
+	if _, err = dialog.Connect("response", func(msgDialog *gtk.Dialog, responseType gtk.ResponseType) {
+		msgDialog.Destroy()
+	}); err != nil {
+		log.Warning("Error connecting to dialog")
+	}
+
+	dialog.ShowAll()
+	dialog.Run()
+}
+
 // StoreChanges will store this pages changes into the model
 func (disk *DiskConfig) StoreChanges() {
 	var installBlockDevice *storage.BlockDevice
@@ -634,10 +1506,28 @@ func (disk *DiskConfig) StoreChanges() {
 		log.Debug("Destructive Install chooserCombo selected %v", disk.chooserCombo.GetActive())
 		disk.model.InstallSelected = disk.destructiveTargets[disk.chooserCombo.GetActive()]
 		log.Debug("Destructive Install Target %v", disk.model.InstallSelected)
+	} else if disk.shrinkButton.GetActive() {
+		log.Debug("Shrink Install chooserCombo selected %v", disk.chooserCombo.GetActive())
+		disk.model.InstallSelected = disk.shrinkTargets[disk.chooserCombo.GetActive()]
+		log.Debug("Shrink Install Target %v", disk.model.InstallSelected)
 	} else {
 		log.Warning("Failed to find and save the selected installation media")
 	}
 
+	// the user was warned about the MBR or hybrid partition table
+	disk.model.PartitionTable = ""
+	if disk.model.InstallSelected.LegacyTable != "" {
+		disk.model.PartitionTable = disk.partitionTablePolicy()
+	}
+
+	// a swap file of the configuration file keeps its size
+	swapFile := disk.swapFileCheck.GetActive()
+	if !swapFile {
+		disk.model.SwapFileSize = ""
+	} else if disk.model.SwapFileSize == "" {
+		disk.model.SwapFileSize = storage.DefaultSwapFileSize
+	}
+
 	bds, err := storage.ListAvailableBlockDevices(disk.model.TargetMedias)
 	if err != nil {
 		log.Error("Failed to find storage media for install during save: %s", err)
@@ -646,14 +1536,31 @@ func (disk *DiskConfig) StoreChanges() {
 	for _, curr := range bds {
 		if curr.Name == disk.model.InstallSelected.Name {
 			installBlockDevice = curr.Clone()
+			// Shrink the partition, the freed space is a partial disk
+			if shrink := disk.model.InstallSelected.Shrink; shrink != "" {
+				target, err := installBlockDevice.ShrinkPartition(shrink, disk.shrinkSize())
+				if err != nil {
+					log.Error("Failed to shrink the partition %s: %s", shrink, err)
+					return
+				}
+				disk.model.InstallSelected = target
+			}
 			// Using the whole disk
 			if disk.model.InstallSelected.WholeDisk {
-				storage.NewStandardPartitions(installBlockDevice)
+				if swapFile {
+					storage.NewStandardPartitionsNoSwap(installBlockDevice)
+				} else {
+					storage.NewStandardPartitions(installBlockDevice)
+				}
 			} else {
 				// Partial Disk, Add our partitions
 				size := disk.model.InstallSelected.FreeEnd - disk.model.InstallSelected.FreeStart
-				size = size - storage.AddBootStandardPartition(installBlockDevice)
-				if !installBlockDevice.DeviceHasSwap() {
+				if disk.selectedESP() != nil {
+					disk.model.ESPPolicy = disk.espCombo.GetActiveID()
+					disk.storeBootChoice()
+				}
+				size = size - disk.model.AddBootPartition(installBlockDevice)
+				if !swapFile && !installBlockDevice.DeviceHasSwap() {
 					size = size - storage.AddSwapStandardPartition(installBlockDevice)
 				}
 				storage.AddRootStandardPartition(installBlockDevice, size)
@@ -665,11 +1572,63 @@ func (disk *DiskConfig) StoreChanges() {
 		}
 	}
 
+	disk.model.HomeEncryption = ""
+	if disk.fscryptCheck.GetActive() {
+		disk.model.HomeEncryption = storage.HomeEncryptionFscrypt
+	}
+
 	if disk.encryptCheck.GetActive() {
-		for _, child := range installBlockDevice.Children {
-			if child.MountPoint == "/" {
-				child.Type = storage.BlockDeviceTypeCrypt
+		if err := storage.EncryptStandardPartitions(installBlockDevice, disk.homeCheck.GetActive()); err != nil {
+			// never install unencrypted, nor encrypted otherwise than asked
+			log.Error("Failed to encrypt the install media: %s", err)
+			disk.model.TargetMedias = nil
+			disk.showError(utils.Locale.Get("Failed to encrypt the install media: %s", err))
+			return
+		}
+	}
+
+	if disk.lvmCheck.GetActive() {
+		vg, err := storage.LVMStandardPartitions(installBlockDevice)
+		if err != nil {
+			// never install with other volumes than asked
+			log.Error("Failed to use LVM on the install media: %s", err)
+			disk.model.TargetMedias = nil
+			disk.showError(utils.Locale.Get("Failed to use LVM on the install media: %s", err))
+			return
+		}
+		disk.model.AddTargetMedia(vg)
+	}
+
+	mirror := ""
+	if disk.mirrorCheck.GetActive() && disk.model.InstallSelected.WholeDisk {
+		if idx := disk.mirrorCombo.GetActive(); idx >= 0 && idx < len(disk.mirrorTargets) {
+			mirror = disk.mirrorTargets[idx].Name
+		}
+	}
+
+	disk.storeDataDisks(bds, mirror)
+
+	if disk.mirrorCheck.GetActive() && disk.model.InstallSelected.WholeDisk {
+		idx := disk.mirrorCombo.GetActive()
+		if idx < 0 || idx >= len(disk.mirrorTargets) {
+			log.Error("Failed to find the mirror disk")
+			return
+		}
+
+		for _, curr := range bds {
+			if curr.Name != disk.mirrorTargets[idx].Name {
+				continue
 			}
+
+			mirror := curr.Clone()
+			array, err := storage.MirrorStandardPartitions(installBlockDevice, mirror)
+			if err != nil {
+				log.Error("Failed to mirror the install media: %s", err)
+				return
+			}
+			disk.model.AddTargetMedia(mirror)
+			disk.model.AddTargetMedia(array)
+			break
 		}
 	}
 }
@@ -708,25 +1667,5 @@ func (disk *DiskConfig) ResetChanges() {
 
 // GetConfiguredValue returns our current config
 func (disk *DiskConfig) GetConfiguredValue() string {
-	tm := disk.model.TargetMedias
-	if len(tm) == 0 {
-		return utils.Locale.Get("No Media Selected")
-	}
-
-	target := disk.model.InstallSelected
-	portion := storage.FormatInstallPortion(target)
-
-	// Size string
-	size, _ := storage.HumanReadableSizeWithPrecision(target.FreeEnd-target.FreeStart, 1)
-
-	encrypted := ""
-	for _, bd := range tm {
-		for _, ch := range bd.Children {
-			if ch.Type == storage.BlockDeviceTypeCrypt {
-				encrypted = " " + utils.Locale.Get("Encryption")
-			}
-		}
-	}
-
-	return fmt.Sprintf("%s (%s) %s%s %s", target.Friendly, target.Name, portion, encrypted, size)
+	return disk.model.SummaryValue(model.SummaryMedia)
 }
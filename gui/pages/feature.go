@@ -0,0 +1,271 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package pages
+
+import (
+	"github.com/gotk3/gotk3/gtk"
+
+	"github.com/clearlinux/clr-installer/gui/common"
+	"github.com/clearlinux/clr-installer/log"
+	"github.com/clearlinux/clr-installer/model"
+	"github.com/clearlinux/clr-installer/utils"
+)
+
+// FeaturePage is a page generated from a model feature descriptor, for the
+// features with no dedicated page
+type FeaturePage struct {
+	controller Controller
+	model      *model.SystemInstall
+	feature    *model.Feature
+	id         int
+	box        *gtk.Box
+	entries    []*gtk.Entry
+	checks     []*gtk.CheckButton
+	combos     []*gtk.ComboBoxText
+	warning    *gtk.Label
+	form       *Form
+}
+
+// featurePages are the features with a dedicated GUI page
+var featurePages = []string{model.FeatureX11Keyboard}
+
+// NewFeaturePages returns a generated page for every model feature with no
+// dedicated page
+func NewFeaturePages(controller Controller, md *model.SystemInstall) ([]Page, error) {
+	result := []Page{}
+
+	for i, curr := range model.Features {
+		if utils.StringSliceContains(featurePages, curr.ID) {
+			continue
+		}
+
+		page, err := newFeaturePage(controller, md, curr, PageIDFeatures+i)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, page)
+	}
+
+	return result, nil
+}
+
+func newFeaturePage(controller Controller, md *model.SystemInstall, feature *model.Feature, id int) (*FeaturePage, error) {
+	page := &FeaturePage{
+		controller: controller,
+		model:      md,
+		feature:    feature,
+		id:         id,
+		entries:    make([]*gtk.Entry, len(feature.Fields)),
+		checks:     make([]*gtk.CheckButton, len(feature.Fields)),
+		combos:     make([]*gtk.ComboBoxText, len(feature.Fields)),
+	}
+	var err error
+
+	// Box
+	page.box, err = setBox(gtk.ORIENTATION_VERTICAL, 0, "box-page-new")
+	if err != nil {
+		return nil, err
+	}
+
+	// Warning label, shared by the fields
+	page.warning, err = setErrorLabel(common.StartEndMargin)
+	if err != nil {
+		return nil, err
+	}
+	page.warning.SetMarginEnd(common.StartEndMargin)
+
+	page.form = NewForm(controller, ButtonConfirm)
+
+	for i, field := range feature.Fields {
+		if field.Kind == model.FieldBool {
+			if page.checks[i], err = page.addCheck(field); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if page.entries[i], page.combos[i], err = page.addEntry(field); err != nil {
+			return nil, err
+		}
+
+		if err = page.form.AddField(page.entries[i], page.warning, page.validate); err != nil {
+			return nil, err
+		}
+	}
+
+	page.box.PackStart(page.warning, false, false, 10)
+
+	return page, nil
+}
+
+// addEntry adds the entry of a text field, a choice field also gets a combo
+// box filling the entry with the selected choice
+func (page *FeaturePage) addEntry(field *model.FeatureField) (*gtk.Entry, *gtk.ComboBoxText, error) {
+	var combo *gtk.ComboBoxText
+
+	boxEntry, entry, err := setLabelAndEntry(utils.Locale.Get(field.Label), 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	boxEntry.SetMarginStart(common.StartEndMargin)
+	boxEntry.SetMarginEnd(common.StartEndMargin)
+	page.box.PackStart(boxEntry, false, false, 0)
+
+	if field.Kind == model.FieldPassword {
+		entry.SetVisibility(false)
+	}
+
+	if field.Kind == model.FieldChoice {
+		if combo, err = gtk.ComboBoxTextNew(); err != nil {
+			return nil, nil, err
+		}
+		combo.SetMarginStart(common.StartEndMargin)
+		boxEntry.PackStart(combo, false, false, 0)
+
+		if _, err = combo.Connect("changed", func() {
+			if text := combo.GetActiveText(); text != "" {
+				setTextInEntry(entry, text)
+			}
+		}); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if field.Help == "" {
+		return entry, combo, nil
+	}
+
+	rules, err := setLabel(utils.Locale.Get(field.Help), "label-rules", 0.0)
+	if err != nil {
+		return nil, nil, err
+	}
+	rules.SetMarginStart(CommonSetting + common.StartEndMargin)
+	rules.SetHAlign(gtk.ALIGN_START)
+	page.box.PackStart(rules, false, false, 0)
+
+	return entry, combo, nil
+}
+
+func (page *FeaturePage) addCheck(field *model.FeatureField) (*gtk.CheckButton, error) {
+	check, err := gtk.CheckButtonNew()
+	if err != nil {
+		return nil, err
+	}
+
+	check.SetLabel("  " + utils.Locale.Get(field.Label))
+	check.SetMarginStart(common.StartEndMargin)
+	check.SetHAlign(gtk.ALIGN_START)
+	page.box.PackStart(check, false, false, 0)
+
+	if _, err := check.Connect("toggled", func() {
+		page.form.Validate()
+	}); err != nil {
+		return nil, err
+	}
+
+	return check, nil
+}
+
+// values returns the values of the fields, in the feature fields order
+func (page *FeaturePage) values() []string {
+	result := []string{}
+
+	for i := range page.feature.Fields {
+		value := ""
+
+		if page.checks[i] != nil {
+			if page.checks[i].GetActive() {
+				value = model.FieldTrue
+			}
+		} else {
+			value = getTextFromEntry(page.entries[i])
+		}
+
+		result = append(result, value)
+	}
+
+	return result
+}
+
+// validate is the form validator, the values are applied to a scratch model
+func (page *FeaturePage) validate(text string) string {
+	if err := page.feature.Apply(&model.SystemInstall{}, page.values()); err != nil {
+		return err.Error()
+	}
+
+	return ""
+}
+
+// IsRequired will return false as we have default values
+func (page *FeaturePage) IsRequired() bool {
+	return false
+}
+
+// IsDone checks if the feature is configured
+func (page *FeaturePage) IsDone() bool {
+	return page.feature.IsConfigured(page.model)
+}
+
+// GetID returns the ID for this page
+func (page *FeaturePage) GetID() int {
+	return page.id
+}
+
+// GetIcon returns the icon for this page
+func (page *FeaturePage) GetIcon() string {
+	return "preferences-system"
+}
+
+// GetRootWidget returns the root embeddable widget for this page
+func (page *FeaturePage) GetRootWidget() gtk.IWidget {
+	return page.box
+}
+
+// GetSummary will return the summary for this page
+func (page *FeaturePage) GetSummary() string {
+	return utils.Locale.Get(page.feature.Title)
+}
+
+// GetTitle will return the title for this page
+func (page *FeaturePage) GetTitle() string {
+	return page.GetSummary()
+}
+
+// StoreChanges will store this pages changes into the model
+func (page *FeaturePage) StoreChanges() {
+	if err := page.feature.Apply(page.model, page.values()); err != nil {
+		log.Warning("Failed to store %s: %v", page.feature.ID, err)
+	}
+}
+
+// ResetChanges will reset this page to match the model
+func (page *FeaturePage) ResetChanges() {
+	for i, value := range page.feature.Values(page.model) {
+		if page.checks[i] != nil {
+			page.checks[i].SetActive(value == model.FieldTrue)
+		} else {
+			setTextInEntry(page.entries[i], value)
+		}
+
+		if page.combos[i] != nil {
+			page.combos[i].RemoveAll()
+			for _, curr := range page.feature.Fields[i].Choices() {
+				page.combos[i].AppendText(curr)
+			}
+		}
+	}
+
+	page.form.Reset()
+}
+
+// GetConfiguredValue returns our current config
+func (page *FeaturePage) GetConfiguredValue() string {
+	if value := page.feature.Summary(page.model); value != "" {
+		return value
+	}
+
+	return utils.Locale.Get("Not configured")
+}
@@ -0,0 +1,190 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package pages
+
+import (
+	"net/url"
+
+	"github.com/gotk3/gotk3/gtk"
+
+	"github.com/clearlinux/clr-installer/log"
+)
+
+// Validator checks the text of an entry and returns a warning message
+// to be displayed, or an empty string if the text is valid
+type Validator func(text string) string
+
+// formField is an entry with its validators and inline error label
+type formField struct {
+	entry      *gtk.Entry
+	label      *gtk.Label
+	validators []Validator
+	touched    bool
+}
+
+// Form groups the validated entries of a page and drives the state of
+// a controller button based on the aggregate validity of its fields
+type Form struct {
+	controller  Controller
+	button      Button
+	fields      []*formField
+	requirement func() bool
+}
+
+// NewForm returns a new Form driving the given controller button
+func NewForm(controller Controller, button Button) *Form {
+	return &Form{
+		controller: controller,
+		button:     button,
+	}
+}
+
+// SetRequirement sets an additional page specific condition which must
+// hold, together with the fields validity, to enable the form button
+func (form *Form) SetRequirement(requirement func() bool) {
+	form.requirement = requirement
+}
+
+// AddField attaches the validators to the entry; warnings are displayed in the
+// label, which may be shared by several fields, the first warning is displayed
+func (form *Form) AddField(entry *gtk.Entry, label *gtk.Label, validators ...Validator) error {
+	field := &formField{
+		entry:      entry,
+		label:      label,
+		validators: validators,
+	}
+	form.fields = append(form.fields, field)
+
+	if _, err := entry.Connect("changed", func() {
+		field.touched = true
+		form.Validate()
+	}); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// IsValid runs the validators of all fields without updating the
+// error labels nor the form button
+func (form *Form) IsValid() bool {
+	for _, field := range form.fields {
+		if field.check() != "" {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Validate runs the validators of all fields, updates the error labels of the
+// fields changed since the last Reset and sets the form button state, it
+// returns true if all fields are valid
+func (form *Form) Validate() bool {
+	valid := true
+	warnings := map[*gtk.Label]string{}
+
+	for _, field := range form.fields {
+		warning := field.check()
+		if warning != "" {
+			valid = false
+		}
+
+		if !field.touched {
+			warning = ""
+		}
+
+		if warnings[field.label] == "" {
+			warnings[field.label] = warning
+		}
+	}
+
+	for label, warning := range warnings {
+		label.SetText(warning)
+	}
+
+	enabled := valid
+	if form.requirement != nil {
+		enabled = enabled && form.requirement()
+	}
+	form.controller.SetButtonState(form.button, enabled)
+
+	return valid
+}
+
+// Reset clears all the error labels, warnings are displayed again
+// once the fields are changed
+func (form *Form) Reset() {
+	for _, field := range form.fields {
+		field.touched = false
+		field.label.SetText("")
+	}
+}
+
+// check returns the first warning produced by the field validators
+func (field *formField) check() string {
+	text := getTextFromEntry(field.entry)
+
+	for _, validator := range field.validators {
+		if warning := validator(text); warning != "" {
+			return warning
+		}
+	}
+
+	return ""
+}
+
+// setErrorLabel creates an inline error label for a form field
+func setErrorLabel(margin int) (*gtk.Label, error) {
+	label, err := setLabel("", "label-error", 0.0)
+	if err != nil {
+		return nil, err
+	}
+	label.SetMarginStart(margin)
+	label.SetLineWrap(true)
+
+	return label, nil
+}
+
+// optional wraps a validator so that an empty text is always valid
+func optional(validator Validator) Validator {
+	return func(text string) string {
+		if text == "" {
+			return ""
+		}
+		return validator(text)
+	}
+}
+
+// required returns a validator failing with msg on empty text
+func required(msg string) Validator {
+	return func(text string) string {
+		if text == "" {
+			return msg
+		}
+		return ""
+	}
+}
+
+// validURL returns a validator failing with msg if the text is not a valid URL
+func validURL(msg string) Validator {
+	return func(text string) string {
+		if _, err := url.ParseRequestURI(text); err != nil {
+			log.Debug("Invalid URL %q: %v", text, err)
+			return msg
+		}
+		return ""
+	}
+}
+
+// matches returns a validator failing with msg if the text differs from the other entry
+func matches(other *gtk.Entry, msg string) Validator {
+	return func(text string) string {
+		if text != getTextFromEntry(other) {
+			return msg
+		}
+		return ""
+	}
+}
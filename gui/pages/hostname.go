@@ -21,6 +21,7 @@ type HostnamePage struct {
 	entry      *gtk.Entry
 	rules      *gtk.Label
 	warning    *gtk.Label
+	form       *Form
 }
 
 // NewHostnamePage returns a new NewHostnamePage
@@ -58,36 +59,22 @@ func NewHostnamePage(controller Controller, model *model.SystemInstall) (Page, e
 	page.box.PackStart(page.rules, false, false, 10)
 
 	// Warning label
-	page.warning, err = setLabel("", "label-warning", 0.0)
+	page.warning, err = setErrorLabel(common.StartEndMargin)
 	if err != nil {
 		return nil, err
 	}
-	page.warning.SetMarginStart(common.StartEndMargin)
 	page.warning.SetMarginEnd(common.StartEndMargin)
 	page.box.PackStart(page.warning, false, false, 10)
 
-	// Generate signal on Hostname entry change
-	if _, err := page.entry.Connect("changed", page.onChange); err != nil {
+	// Validate the Hostname entry on change
+	page.form = NewForm(controller, ButtonConfirm)
+	if err := page.form.AddField(page.entry, page.warning, optional(hostname.IsValidHostname)); err != nil {
 		return nil, err
 	}
 
 	return page, nil
 }
 
-func (page *HostnamePage) onChange(entry *gtk.Entry) {
-	host := getTextFromEntry(entry)
-	warning := ""
-	warning = hostname.IsValidHostname(host)
-	if host != "" && warning != "" {
-		page.warning.SetLabel(warning)
-		page.controller.SetButtonState(ButtonConfirm, false)
-
-	} else {
-		page.warning.SetLabel("")
-		page.controller.SetButtonState(ButtonConfirm, true)
-	}
-}
-
 // IsRequired will return false as we have default values
 func (page *HostnamePage) IsRequired() bool {
 	return false
@@ -133,13 +120,10 @@ func (page *HostnamePage) StoreChanges() {
 func (page *HostnamePage) ResetChanges() {
 	host := page.model.Hostname
 	setTextInEntry(page.entry, host)
-	page.warning.SetLabel("")
+	page.form.Reset()
 }
 
 // GetConfiguredValue returns our current config
 func (page *HostnamePage) GetConfiguredValue() string {
-	if page.model.Hostname == "" {
-		return utils.Locale.Get("No target system hostname assigned")
-	}
-	return page.model.Hostname
+	return page.model.SummaryValue(model.SummaryHostname)
 }
@@ -12,6 +12,7 @@ import (
 
 	"github.com/clearlinux/clr-installer/args"
 	"github.com/clearlinux/clr-installer/log"
+	"github.com/clearlinux/clr-installer/sanitize"
 )
 
 // Button allows us to flag up different buttons
@@ -62,6 +63,7 @@ type Controller interface {
 	SetButtonVisible(flags Button, enabled bool)
 	GetRootDir() string
 	GetOptions() args.Args
+	MissingRequirements() []string
 }
 
 const (
@@ -89,8 +91,18 @@ const (
 	// PageIDHostname is the hostname page key
 	PageIDHostname = iota
 
+	// PageIDProxy is the proxy page key
+	PageIDProxy = iota
+
+	// PageIDSwupdMirror is the swupd mirror page key
+	PageIDSwupdMirror = iota
+
 	// PageIDInstall is the special installation page key
 	PageIDInstall = iota
+
+	// PageIDFeatures is the key of the first generated feature page, the
+	// others follow in the model features order
+	PageIDFeatures = iota
 )
 
 // Private helper to assist in the ugliness of forcibly scrolling a GtkListBox
@@ -115,6 +127,50 @@ func scrollToView(scroll *gtk.ScrolledWindow, container gtk.IWidget, widget *gtk
 	}
 }
 
+// setListHeaders adds the group header of every row of list, groups holds the
+// group name of each row, see updateListHeaders()
+func setListHeaders(list *gtk.ListBox, groups []string) ([]*gtk.Label, error) {
+	headers := []*gtk.Label{}
+
+	for i, group := range groups {
+		header, err := setLabel(group, "list-label-header", 0.0)
+		if err != nil {
+			return nil, err
+		}
+		// the header visibility is managed by updateListHeaders()
+		header.SetNoShowAll(true)
+
+		list.GetRowAtIndex(i).SetHeader(header)
+		headers = append(headers, header)
+	}
+
+	updateListHeaders(list, headers, groups)
+
+	return headers, nil
+}
+
+// updateListHeaders shows the header of the first visible row of each group
+// and hides the others, it must be called whenever the rows visibility changes
+func updateListHeaders(list *gtk.ListBox, headers []*gtk.Label, groups []string) {
+	first := true
+	prev := ""
+
+	for i, header := range headers {
+		if !list.GetRowAtIndex(i).GetVisible() {
+			continue
+		}
+
+		if first || groups[i] != prev {
+			header.Show()
+		} else {
+			header.Hide()
+		}
+
+		first = false
+		prev = groups[i]
+	}
+}
+
 // getTextFromEntry reads the text from an Entry buffer
 func getTextFromEntry(entry *gtk.Entry) string {
 	buffer, err := entry.GetBuffer()
@@ -128,7 +184,13 @@ func getTextFromEntry(entry *gtk.Entry) string {
 		log.Warning("Error reading buffer: ", err) // Just log trivial error
 		return ""
 	}
-	return text
+
+	// Passwords are taken as typed
+	if !entry.GetVisibility() {
+		return text
+	}
+
+	return sanitize.String(text)
 }
 
 // setTextInEntry writes the text to an Entry buffer
@@ -154,7 +216,13 @@ func getTextFromSearchEntry(entry *gtk.SearchEntry) string {
 		log.Warning("Error reading buffer: ", err) // Just log trivial error
 		return ""
 	}
-	return text
+
+	// Passwords are taken as typed
+	if !entry.GetVisibility() {
+		return text
+	}
+
+	return sanitize.String(text)
 }
 
 // setBox creates and styles a new gtk Box
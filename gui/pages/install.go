@@ -6,15 +6,22 @@ package pages
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
+	"github.com/gotk3/gotk3/glib"
 	"github.com/gotk3/gotk3/gtk"
 
+	"github.com/clearlinux/clr-installer/cmd"
 	ctrl "github.com/clearlinux/clr-installer/controller"
+	"github.com/clearlinux/clr-installer/log"
 	"github.com/clearlinux/clr-installer/model"
 	"github.com/clearlinux/clr-installer/network"
 	"github.com/clearlinux/clr-installer/progress"
+	"github.com/clearlinux/clr-installer/qrcode"
+	"github.com/clearlinux/clr-installer/remote"
 	"github.com/clearlinux/clr-installer/utils"
 )
 
@@ -36,6 +43,7 @@ type InstallPage struct {
 
 	widgets map[int]*InstallWidget // mapping of widgets
 	warning *gtk.Label             // Display errors during install
+	qrcode  *gtk.Image             // Failure details for a phone camera
 }
 
 // NewInstallPage constructs a new InstallPage.
@@ -87,6 +95,13 @@ func NewInstallPage(controller Controller, model *model.SystemInstall) (Page, er
 	page.warning.SetMarginStart(24)
 	page.layout.PackStart(page.warning, false, false, 0)
 
+	page.qrcode, err = gtk.ImageNew()
+	if err != nil {
+		return nil, err
+	}
+	page.qrcode.SetMarginTop(12)
+	page.layout.PackStart(page.qrcode, false, false, 0)
+
 	// Create progressbar
 	page.pbar, err = gtk.ProgressBarNew()
 	if err != nil {
@@ -164,12 +179,14 @@ func (install *InstallPage) ResetChanges() {
 	// TODO: Disable closing of the installer
 	go func() {
 		// Become the progress hook
-		progress.Set(install)
+		progress.Set(progress.NewThrottle(remote.NewProgress(install), progress.DefaultUpdateInterval))
 
-		go func() {
-			_ = network.DownloadInstallerMessage("Pre-Installation",
-				network.PreGuiInstallConf)
-		}()
+		if !install.model.Offline {
+			go func() {
+				_ = network.DownloadInstallerMessage("Pre-Installation",
+					network.PreGuiInstallConf)
+			}()
+		}
 
 		// Go install it
 		err := ctrl.Install(install.controller.GetRootDir(),
@@ -185,19 +202,70 @@ func (install *InstallPage) ResetChanges() {
 			// For the time being, get only the first line of the error.
 			text = text + " " + strings.Split(err.Error(), "\n")[0]
 			install.warning.SetText(text)
+			install.showFailureCode(err)
 			install.controller.SetButtonState(ButtonQuit, true)
+		} else if install.model.CryptKeys != nil && install.model.CryptKeys.RecoveryKey != "" {
+			install.warning.SetSelectable(true)
+			install.warning.SetText(utils.Locale.Get("Recovery key: %s", install.model.CryptKeys.RecoveryKey))
 		}
 
-		go func() {
-			_ = network.DownloadInstallerMessage("Post-Installation",
-				network.PostGuiInstallConf)
-		}()
+		notifyDesktop(err)
+
+		if !install.model.Offline {
+			go func() {
+				_ = network.DownloadInstallerMessage("Post-Installation",
+					network.PostGuiInstallConf)
+			}()
+		}
 
 		install.controller.SetButtonState(ButtonQuit, true)
 	}()
 
 }
 
+// showFailureCode displays the failure details as a QR code so users can
+// continue troubleshooting from a phone
+func (install *InstallPage) showFailureCode(instError error) {
+	file := filepath.Join(os.TempDir(), "clr-installer-failure.png")
+
+	if err := qrcode.WritePNG(qrcode.FailurePayload(instError), file); err != nil {
+		log.Warning("Failed to show the failure QR code: %v", err)
+		return
+	}
+
+	if _, err := glib.IdleAdd(func() {
+		install.qrcode.SetFromFile(file)
+	}); err != nil {
+		log.Warning("Failed to show the failure QR code: %v", err)
+	}
+}
+
+// notifyDesktop emits a desktop notification with the install result, so
+// users who walked away from a long install know when it finished
+func notifyDesktop(instError error) {
+	summary := utils.Locale.Get("Installation complete")
+	body := utils.Locale.Get("Clear Linux* OS was successfully installed.")
+	icon := "dialog-information"
+
+	if instError != nil {
+		summary = utils.Locale.Get("Installation failed.")
+		body = strings.Split(instError.Error(), "\n")[0]
+		icon = "dialog-error"
+	}
+
+	args := []string{
+		"notify-send",
+		"--app-name=clr-installer",
+		"--icon=" + icon,
+		summary,
+		body,
+	}
+
+	if err := cmd.RunAndLog(args...); err != nil {
+		log.Warning("Failed to send the desktop notification: %v", err)
+	}
+}
+
 // Following methods are for the progress.Client API
 
 // Desc will push a description box into the view for later marking
@@ -9,6 +9,7 @@ import (
 
 	"github.com/gotk3/gotk3/gtk"
 
+	"github.com/clearlinux/clr-installer/gui/common"
 	"github.com/clearlinux/clr-installer/keyboard"
 	"github.com/clearlinux/clr-installer/model"
 	"github.com/clearlinux/clr-installer/utils"
@@ -24,6 +25,16 @@ type KeyboardPage struct {
 	searchEntry *gtk.SearchEntry
 	scroll      *gtk.ScrolledWindow
 	list        *gtk.ListBox
+	suggestion  *gtk.Label
+
+	// Advanced view, the X11 keyboard
+	x11Expander   *gtk.Expander
+	x11Layout     *gtk.Entry
+	x11Variant    *gtk.Entry
+	composeCheck  *gtk.CheckButton
+	capsCtrlCheck *gtk.CheckButton
+	x11Warning    *gtk.Label
+	form          *Form
 }
 
 // NewKeyboardPage returns a new KeyboardPage
@@ -51,6 +62,14 @@ func NewKeyboardPage(controller Controller, model *model.SystemInstall) (Page, e
 		return nil, err
 	}
 	page.box.PackStart(page.searchEntry, false, false, 0)
+
+	// Suggested keyboards for the chosen language
+	page.suggestion, err = setLabel("", "label-rules", 0.0)
+	if err != nil {
+		return nil, err
+	}
+	page.suggestion.SetMarginStart(common.StartEndMargin)
+	page.box.PackStart(page.suggestion, false, false, 0)
 	if _, err := page.searchEntry.Connect("search-changed", page.onChange); err != nil {
 		return nil, err
 	}
@@ -88,9 +107,114 @@ func NewKeyboardPage(controller Controller, model *model.SystemInstall) (Page, e
 		page.list.Add(box)
 	}
 
+	if err = page.addX11Options(); err != nil {
+		return nil, err
+	}
+
 	return page, nil
 }
 
+// addX11Options adds the expander of the X11 keyboard, it may differ from the
+// console keymap
+func (page *KeyboardPage) addX11Options() error {
+	var err error
+
+	page.x11Expander, err = gtk.ExpanderNew(utils.Locale.Get("Advanced keyboard options"))
+	if err != nil {
+		return err
+	}
+	page.x11Expander.SetMarginStart(common.StartEndMargin)
+	page.x11Expander.SetMarginEnd(common.StartEndMargin)
+	page.box.PackStart(page.x11Expander, false, false, 0)
+
+	box, err := setBox(gtk.ORIENTATION_VERTICAL, 5, "")
+	if err != nil {
+		return err
+	}
+	page.x11Expander.Add(box)
+
+	rules, err := setLabel(utils.Locale.Get("The graphical sessions keyboard, the console keymap is kept"),
+		"label-rules", 0.0)
+	if err != nil {
+		return err
+	}
+	box.PackStart(rules, false, false, 0)
+
+	boxEntry, entry, err := setLabelAndEntry(utils.Locale.Get("X11 layout"), 0)
+	if err != nil {
+		return err
+	}
+	page.x11Layout = entry
+	box.PackStart(boxEntry, false, false, 0)
+
+	boxEntry, entry, err = setLabelAndEntry(utils.Locale.Get("X11 variant"), 0)
+	if err != nil {
+		return err
+	}
+	page.x11Variant = entry
+	box.PackStart(boxEntry, false, false, 0)
+
+	if page.composeCheck, err = gtk.CheckButtonNewWithLabel(
+		utils.Locale.Get("Use the right Alt as the Compose key")); err != nil {
+		return err
+	}
+	box.PackStart(page.composeCheck, false, false, 0)
+
+	if page.capsCtrlCheck, err = gtk.CheckButtonNewWithLabel(
+		utils.Locale.Get("Use Caps Lock as another Ctrl")); err != nil {
+		return err
+	}
+	box.PackStart(page.capsCtrlCheck, false, false, 0)
+
+	if page.x11Warning, err = setErrorLabel(0); err != nil {
+		return err
+	}
+	box.PackStart(page.x11Warning, false, false, 0)
+
+	page.form = NewForm(page.controller, ButtonConfirm)
+	page.form.SetRequirement(func() bool { return page.selected != nil })
+
+	validate := func(string) string {
+		if k := page.x11Keymap(); !k.IsEmpty() {
+			if err := k.Validate(); err != nil {
+				return err.Error()
+			}
+		}
+		return ""
+	}
+
+	for _, curr := range []*gtk.Entry{page.x11Layout, page.x11Variant} {
+		if err = page.form.AddField(curr, page.x11Warning, validate); err != nil {
+			return err
+		}
+	}
+
+	for _, curr := range []*gtk.CheckButton{page.composeCheck, page.capsCtrlCheck} {
+		if _, err = curr.Connect("toggled", func() { page.form.Validate() }); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// x11Keymap returns the X11 keyboard of the advanced view, the options set by
+// a config file are kept
+func (page *KeyboardPage) x11Keymap() *keyboard.X11Keymap {
+	k := &keyboard.X11Keymap{}
+	if page.model.X11Keyboard != nil {
+		k.Model = page.model.X11Keyboard.Model
+		k.Options = page.model.X11Keyboard.Options
+	}
+
+	k.Layout = getTextFromEntry(page.x11Layout)
+	k.Variant = getTextFromEntry(page.x11Variant)
+	k.SetOption(keyboard.OptionCompose, page.composeCheck.GetActive())
+	k.SetOption(keyboard.OptionCapsAsCtrl, page.capsCtrlCheck.GetActive())
+
+	return k
+}
+
 func (page *KeyboardPage) getCode() string {
 	code := page.GetConfiguredValue()
 	if code == "" {
@@ -101,7 +225,7 @@ func (page *KeyboardPage) getCode() string {
 
 func (page *KeyboardPage) onRowActivated(box *gtk.ListBox, row *gtk.ListBoxRow) {
 	page.selected = page.data[row.GetIndex()]
-	page.controller.SetButtonState(ButtonConfirm, true)
+	page.form.Validate()
 }
 
 // Select row in the box, activate it and scroll to it
@@ -139,7 +263,7 @@ func (page *KeyboardPage) onChange(entry *gtk.SearchEntry) {
 		page.activateRow(index)
 	} else {
 		page.selected = nil
-		page.controller.SetButtonState(ButtonConfirm, false)
+		page.form.Validate()
 	}
 }
 
@@ -180,7 +304,15 @@ func (page *KeyboardPage) GetTitle() string {
 
 // StoreChanges will store this pages changes into the model
 func (page *KeyboardPage) StoreChanges() {
-	page.model.Keyboard = page.selected
+	if page.selected != nil {
+		page.model.Keyboard = page.selected.AsUserDefined()
+	}
+
+	if k := page.x11Keymap(); k.IsEmpty() {
+		page.model.X11Keyboard = nil
+	} else if k.Validate() == nil {
+		page.model.X11Keyboard = k
+	}
 }
 
 // ResetChanges will reset this page to match the model
@@ -193,12 +325,40 @@ func (page *KeyboardPage) ResetChanges() {
 		}
 	}
 	page.searchEntry.SetText("")
+	page.setSuggestion()
+
+	k := page.model.X11Keyboard
+	if k == nil {
+		k = &keyboard.X11Keymap{}
+	}
+	setTextInEntry(page.x11Layout, k.Layout)
+	setTextInEntry(page.x11Variant, k.Variant)
+	page.composeCheck.SetActive(k.HasOption(keyboard.OptionCompose))
+	page.capsCtrlCheck.SetActive(k.HasOption(keyboard.OptionCapsAsCtrl))
+	page.x11Expander.SetExpanded(!k.IsEmpty())
+	page.form.Reset()
+	page.form.Validate()
+}
+
+// setSuggestion lists the keyboards suggested for the chosen language
+func (page *KeyboardPage) setSuggestion() {
+	suggested := []string{}
+	if locale := page.model.GetTargetLocale(); locale != nil {
+		for _, curr := range keyboard.Suggest(locale.Code) {
+			suggested = append(suggested, curr.Code)
+		}
+	}
+
+	if len(suggested) == 0 {
+		page.suggestion.SetText("")
+		return
+	}
+
+	page.suggestion.SetText(utils.Locale.Get("Suggested for the chosen language: %s",
+		strings.Join(suggested, ", ")))
 }
 
 // GetConfiguredValue returns our current config
 func (page *KeyboardPage) GetConfiguredValue() string {
-	if page.model.Keyboard == nil {
-		return ""
-	}
-	return page.model.Keyboard.Code
+	return page.model.SummaryValue(model.SummaryKeyboard)
 }
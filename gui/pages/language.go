@@ -5,9 +5,6 @@
 package pages
 
 import (
-	"fmt"
-	"strings"
-
 	"github.com/gotk3/gotk3/gtk"
 
 	"github.com/clearlinux/clr-installer/language"
@@ -25,6 +22,8 @@ type LanguagePage struct {
 	searchEntry *gtk.SearchEntry
 	scroll      *gtk.ScrolledWindow
 	list        *gtk.ListBox
+	headers     []*gtk.Label
+	groups      []string
 }
 
 // NewLanguagePage returns a new LanguagePage
@@ -95,6 +94,11 @@ func NewLanguagePage(controller Controller, model *model.SystemInstall) (Page, e
 		box.PackStart(labelCode, false, false, 0)
 
 		page.list.Add(box)
+		page.groups = append(page.groups, v.Group())
+	}
+
+	if page.headers, err = setListHeaders(page.list, page.groups); err != nil {
+		return nil, err
 	}
 
 	return page, nil
@@ -102,8 +106,8 @@ func NewLanguagePage(controller Controller, model *model.SystemInstall) (Page, e
 
 func (page *LanguagePage) getCode() string {
 	code := ""
-	if page.model.Language != nil {
-		code = page.model.Language.Code
+	if lang := page.model.GetInstallerLanguage(); lang != nil {
+		code = lang.Code
 	}
 
 	if code == "" {
@@ -134,8 +138,7 @@ func (page *LanguagePage) onChange(entry *gtk.SearchEntry) {
 	code := page.getCode() // Get current language
 	for i, v := range page.data {
 		vDesc, vCode := v.GetConfValues()
-		term := fmt.Sprintf("%s %s", vDesc, vCode)
-		if search != "" && !strings.Contains(strings.ToLower(term), strings.ToLower(search)) {
+		if !utils.SearchMatch(search, vDesc, vCode, v.Group()) {
 			page.list.GetRowAtIndex(i).Hide()
 		} else {
 			page.list.GetRowAtIndex(i).Show()
@@ -152,6 +155,8 @@ func (page *LanguagePage) onChange(entry *gtk.SearchEntry) {
 			}
 		}
 	}
+	updateListHeaders(page.list, page.headers, page.groups)
+
 	if setIndex == true {
 		page.activateRow(index)
 	} else {
@@ -199,6 +204,8 @@ func (page *LanguagePage) GetTitle() string {
 func (page *LanguagePage) StoreChanges() {
 	page.controller.SetButtonState(ButtonNext, false) // TODO: Determine why the button is not actually being disabled
 	page.model.Language = page.selected
+	page.model.InstallerLanguage = nil
+	page.model.SuggestKeyboard()
 	language.SetSelectionLanguage(page.model.Language.Code)
 	utils.SetLocale(page.model.Language.Code)
 }
@@ -217,9 +224,5 @@ func (page *LanguagePage) ResetChanges() {
 
 // GetConfiguredValue returns our current config
 func (page *LanguagePage) GetConfiguredValue() string {
-	if page.model.Language == nil {
-		return ""
-	}
-	desc, code := page.model.Language.GetConfValues()
-	return fmt.Sprintf("%s  [%s]", desc, code)
+	return page.model.SummaryValue(model.SummaryLanguage)
 }
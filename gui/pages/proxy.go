@@ -0,0 +1,168 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package pages
+
+import (
+	"strings"
+
+	"github.com/gotk3/gotk3/gtk"
+
+	"github.com/clearlinux/clr-installer/gui/common"
+	"github.com/clearlinux/clr-installer/model"
+	"github.com/clearlinux/clr-installer/network"
+	"github.com/clearlinux/clr-installer/utils"
+)
+
+// ProxyPage is a simple page to enter the HTTPS proxy
+type ProxyPage struct {
+	controller Controller
+	model      *model.SystemInstall
+	box        *gtk.Box
+	entry      *gtk.Entry
+	warning    *gtk.Label
+	noProxy    *gtk.Entry
+	npWarning  *gtk.Label
+	form       *Form
+}
+
+// NewProxyPage returns a new ProxyPage
+func NewProxyPage(controller Controller, model *model.SystemInstall) (Page, error) {
+	page := &ProxyPage{
+		controller: controller,
+		model:      model,
+	}
+	var err error
+
+	// Box
+	page.box, err = setBox(gtk.ORIENTATION_VERTICAL, 0, "box-page-new")
+	if err != nil {
+		return nil, err
+	}
+
+	// Entry
+	page.entry, err = setEntry("entry")
+	if err != nil {
+		return nil, err
+	}
+	page.entry.SetMarginStart(common.StartEndMargin)
+	page.entry.SetMarginEnd(common.StartEndMargin)
+	page.box.PackStart(page.entry, false, false, 0)
+
+	// Rules label
+	rules, err := setLabel(utils.Locale.Get("HTTPS proxy URL, leave empty for a direct connection."), "label-rules", 0.0)
+	if err != nil {
+		return nil, err
+	}
+	rules.SetMarginStart(common.StartEndMargin)
+	rules.SetHAlign(gtk.ALIGN_START)
+	page.box.PackStart(rules, false, false, 10)
+
+	// Warning label
+	page.warning, err = setErrorLabel(common.StartEndMargin)
+	if err != nil {
+		return nil, err
+	}
+	page.warning.SetMarginEnd(common.StartEndMargin)
+	page.box.PackStart(page.warning, false, false, 10)
+
+	// Proxy exceptions entry
+	page.noProxy, err = setEntry("entry")
+	if err != nil {
+		return nil, err
+	}
+	page.noProxy.SetMarginStart(common.StartEndMargin)
+	page.noProxy.SetMarginEnd(common.StartEndMargin)
+	page.box.PackStart(page.noProxy, false, false, 0)
+
+	rules, err = setLabel(utils.Locale.Get("Hosts, domains and networks reached without the proxy, separated by commas."), "label-rules", 0.0)
+	if err != nil {
+		return nil, err
+	}
+	rules.SetMarginStart(common.StartEndMargin)
+	rules.SetHAlign(gtk.ALIGN_START)
+	page.box.PackStart(rules, false, false, 10)
+
+	page.npWarning, err = setErrorLabel(common.StartEndMargin)
+	if err != nil {
+		return nil, err
+	}
+	page.npWarning.SetMarginEnd(common.StartEndMargin)
+	page.box.PackStart(page.npWarning, false, false, 10)
+
+	// Validate the Proxy entries on change
+	page.form = NewForm(controller, ButtonConfirm)
+	if err := page.form.AddField(page.entry, page.warning,
+		optional(validURL(utils.Locale.Get("Invalid URL for Proxy Server")))); err != nil {
+		return nil, err
+	}
+
+	if err := page.form.AddField(page.noProxy, page.npWarning, validNoProxy); err != nil {
+		return nil, err
+	}
+
+	return page, nil
+}
+
+// IsRequired will return false as we have default values
+func (page *ProxyPage) IsRequired() bool {
+	return false
+}
+
+// IsDone checks if all the steps are completed
+func (page *ProxyPage) IsDone() bool {
+	return page.model.HTTPSProxy != ""
+}
+
+// GetID returns the ID for this page
+func (page *ProxyPage) GetID() int {
+	return PageIDProxy
+}
+
+// GetIcon returns the icon for this page
+func (page *ProxyPage) GetIcon() string {
+	return "preferences-system-network-proxy"
+}
+
+// GetRootWidget returns the root embeddable widget for this page
+func (page *ProxyPage) GetRootWidget() gtk.IWidget {
+	return page.box
+}
+
+// GetSummary will return the summary for this page
+func (page *ProxyPage) GetSummary() string {
+	return utils.Locale.Get("Configure Proxy")
+}
+
+// GetTitle will return the title for this page
+func (page *ProxyPage) GetTitle() string {
+	return page.GetSummary()
+}
+
+// StoreChanges will store this pages changes into the model
+func (page *ProxyPage) StoreChanges() {
+	page.model.HTTPSProxy = getTextFromEntry(page.entry)
+	page.model.NoProxy = network.ParseNoProxy(getTextFromEntry(page.noProxy))
+}
+
+// ResetChanges will reset this page to match the model
+func (page *ProxyPage) ResetChanges() {
+	setTextInEntry(page.entry, page.model.HTTPSProxy)
+	setTextInEntry(page.noProxy, strings.Join(page.model.NoProxy, ", "))
+	page.form.Reset()
+}
+
+// GetConfiguredValue returns our current config
+func (page *ProxyPage) GetConfiguredValue() string {
+	return page.model.SummaryValue(model.SummaryProxy)
+}
+
+func validNoProxy(text string) string {
+	for _, curr := range network.ParseNoProxy(text) {
+		if err := network.ValidateNoProxyEntry(curr); err != nil {
+			return utils.Locale.Get("Invalid proxy exception: %s", curr)
+		}
+	}
+	return ""
+}
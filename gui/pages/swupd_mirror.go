@@ -0,0 +1,147 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package pages
+
+import (
+	"github.com/gotk3/gotk3/gtk"
+
+	"github.com/clearlinux/clr-installer/gui/common"
+	"github.com/clearlinux/clr-installer/log"
+	"github.com/clearlinux/clr-installer/model"
+	"github.com/clearlinux/clr-installer/swupd"
+	"github.com/clearlinux/clr-installer/utils"
+)
+
+// SwupdMirrorPage is a simple page to enter the swupd mirror
+type SwupdMirrorPage struct {
+	controller Controller
+	model      *model.SystemInstall
+	box        *gtk.Box
+	entry      *gtk.Entry
+	warning    *gtk.Label
+	form       *Form
+}
+
+// NewSwupdMirrorPage returns a new SwupdMirrorPage
+func NewSwupdMirrorPage(controller Controller, model *model.SystemInstall) (Page, error) {
+	page := &SwupdMirrorPage{
+		controller: controller,
+		model:      model,
+	}
+	var err error
+
+	// Box
+	page.box, err = setBox(gtk.ORIENTATION_VERTICAL, 0, "box-page-new")
+	if err != nil {
+		return nil, err
+	}
+
+	// Entry
+	page.entry, err = setEntry("entry")
+	if err != nil {
+		return nil, err
+	}
+	page.entry.SetMarginStart(common.StartEndMargin)
+	page.entry.SetMarginEnd(common.StartEndMargin)
+	page.box.PackStart(page.entry, false, false, 0)
+
+	// Rules label
+	rules, err := setLabel(utils.Locale.Get("HTTPS sites must use a publicly signed CA"), "label-rules", 0.0)
+	if err != nil {
+		return nil, err
+	}
+	rules.SetMarginStart(common.StartEndMargin)
+	rules.SetHAlign(gtk.ALIGN_START)
+	page.box.PackStart(rules, false, false, 10)
+
+	// Warning label
+	page.warning, err = setErrorLabel(common.StartEndMargin)
+	if err != nil {
+		return nil, err
+	}
+	page.warning.SetMarginEnd(common.StartEndMargin)
+	page.box.PackStart(page.warning, false, false, 10)
+
+	// Validate the Mirror entry on change
+	page.form = NewForm(controller, ButtonConfirm)
+	if err := page.form.AddField(page.entry, page.warning, optional(validURL(utils.Locale.Get("Invalid URL")))); err != nil {
+		return nil, err
+	}
+
+	return page, nil
+}
+
+// IsRequired will return false as we have default values
+func (page *SwupdMirrorPage) IsRequired() bool {
+	return false
+}
+
+// IsDone checks if all the steps are completed
+func (page *SwupdMirrorPage) IsDone() bool {
+	return page.model.SwupdMirror != ""
+}
+
+// GetID returns the ID for this page
+func (page *SwupdMirrorPage) GetID() int {
+	return PageIDSwupdMirror
+}
+
+// GetIcon returns the icon for this page
+func (page *SwupdMirrorPage) GetIcon() string {
+	return "network-server"
+}
+
+// GetRootWidget returns the root embeddable widget for this page
+func (page *SwupdMirrorPage) GetRootWidget() gtk.IWidget {
+	return page.box
+}
+
+// GetSummary will return the summary for this page
+func (page *SwupdMirrorPage) GetSummary() string {
+	return utils.Locale.Get("Swupd Mirror")
+}
+
+// GetTitle will return the title for this page
+func (page *SwupdMirrorPage) GetTitle() string {
+	return utils.Locale.Get("Configure the Installation Source (swupd) Mirror")
+}
+
+// StoreChanges will store this pages changes into the model
+func (page *SwupdMirrorPage) StoreChanges() {
+	mirror := getTextFromEntry(page.entry)
+
+	if mirror == "" {
+		if page.model.SwupdMirror != "" {
+			if _, err := swupd.UnSetHostMirror(); err != nil {
+				log.Warning("Failed to unset swupd mirror: %v", err)
+			}
+			page.model.SwupdMirror = mirror
+		}
+		return
+	}
+
+	url, err := swupd.SetHostMirror(mirror)
+	if err != nil {
+		log.Warning("Failed to set swupd mirror: %v", err)
+		return
+	}
+	if url != mirror {
+		log.Warning("Mirror not set correctly: %s", url)
+		return
+	}
+
+	page.model.SwupdMirror = mirror
+}
+
+// ResetChanges will reset this page to match the model
+func (page *SwupdMirrorPage) ResetChanges() {
+	setTextInEntry(page.entry, page.model.SwupdMirror)
+	page.form.Reset()
+}
+
+// GetConfiguredValue returns our current config
+func (page *SwupdMirrorPage) GetConfiguredValue() string {
+	return page.model.SummaryValue(model.SummarySwupdMirror)
+}
@@ -106,10 +106,7 @@ func (t *Telemetry) ResetChanges() {
 
 // GetConfiguredValue returns our current config
 func (t *Telemetry) GetConfiguredValue() string {
-	if t.model.IsTelemetryEnabled() {
-		return utils.Locale.Get("Enabled")
-	}
-	return utils.Locale.Get("Disabled")
+	return t.model.SummaryValue(model.SummaryTelemetry)
 }
 
 // GetTelemetryMessage gets the telemetry message
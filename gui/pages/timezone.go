@@ -6,10 +6,10 @@ package pages
 
 import (
 	"github.com/clearlinux/clr-installer/utils"
-	"strings"
 
 	"github.com/gotk3/gotk3/gtk"
 
+	"github.com/clearlinux/clr-installer/log"
 	"github.com/clearlinux/clr-installer/model"
 	"github.com/clearlinux/clr-installer/timezone"
 )
@@ -24,6 +24,9 @@ type TimezonePage struct {
 	searchEntry *gtk.SearchEntry
 	scroll      *gtk.ScrolledWindow
 	list        *gtk.ListBox
+	headers     []*gtk.Label
+	groups      []string
+	tzMap       *TimezoneMap
 }
 
 // NewTimezonePage returns a new TimezonePage
@@ -55,6 +58,16 @@ func NewTimezonePage(controller Controller, model *model.SystemInstall) (Page, e
 		return nil, err
 	}
 
+	// World map, the list below remains the accessible way to choose
+	if _, err := timezone.LoadLocations(); err != nil {
+		log.Warning("No time zone locations, not showing the map: %v", err)
+	} else {
+		if page.tzMap, err = NewTimezoneMap(page.data, page.onMapSelect); err != nil {
+			return nil, err
+		}
+		page.box.PackStart(page.tzMap.GetRootWidget(), false, false, 5)
+	}
+
 	// ScrolledWindow
 	page.scroll, err = setScrolledWindow(gtk.POLICY_NEVER, gtk.POLICY_AUTOMATIC, "scroller")
 	if err != nil {
@@ -86,6 +99,11 @@ func NewTimezonePage(controller Controller, model *model.SystemInstall) (Page, e
 		box.PackStart(labelDesc, false, false, 0)
 
 		page.list.Add(box)
+		page.groups = append(page.groups, v.Region())
+	}
+
+	if page.headers, err = setListHeaders(page.list, page.groups); err != nil {
+		return nil, err
 	}
 
 	return page, nil
@@ -102,6 +120,20 @@ func (page *TimezonePage) getCode() string {
 func (page *TimezonePage) onRowActivated(box *gtk.ListBox, row *gtk.ListBoxRow) {
 	page.selected = page.data[row.GetIndex()]
 	page.controller.SetButtonState(ButtonConfirm, true)
+
+	if page.tzMap != nil {
+		page.tzMap.SetSelected(page.selected)
+	}
+}
+
+// onMapSelect selects in the list the time zone picked on the map
+func (page *TimezonePage) onMapSelect(tz *timezone.TimeZone) {
+	for i, v := range page.data {
+		if v.Equals(tz) {
+			page.activateRow(i)
+			return
+		}
+	}
 }
 
 // Select row in the box, activate it and scroll to it
@@ -119,7 +151,7 @@ func (page *TimezonePage) onChange(entry *gtk.SearchEntry) {
 	search := getTextFromSearchEntry(entry)
 	code := page.getCode() // Get current timezone
 	for i, v := range page.data {
-		if search != "" && !strings.Contains(strings.ToLower(v.Code), strings.ToLower(search)) {
+		if !utils.SearchMatch(search, v.Code) {
 			page.list.GetRowAtIndex(i).Hide()
 		} else {
 			page.list.GetRowAtIndex(i).Show()
@@ -136,6 +168,8 @@ func (page *TimezonePage) onChange(entry *gtk.SearchEntry) {
 			}
 		}
 	}
+	updateListHeaders(page.list, page.headers, page.groups)
+
 	if setIndex == true {
 		page.activateRow(index)
 	} else {
@@ -198,8 +232,5 @@ func (page *TimezonePage) ResetChanges() {
 
 // GetConfiguredValue returns our current config
 func (page *TimezonePage) GetConfiguredValue() string {
-	if page.model.Timezone == nil {
-		return ""
-	}
-	return page.model.Timezone.Code
+	return page.model.SummaryValue(model.SummaryTimezone)
 }
@@ -0,0 +1,258 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package pages
+
+import (
+	"math"
+
+	"github.com/gotk3/gotk3/cairo"
+	"github.com/gotk3/gotk3/gdk"
+	"github.com/gotk3/gotk3/gtk"
+
+	"github.com/clearlinux/clr-installer/timezone"
+)
+
+const (
+	// timezoneMapHeight is the height requested by the map, its width
+	// follows the page
+	timezoneMapHeight = 220
+
+	// timezoneMapPadding is the margin, in degrees, around a zoomed region
+	timezoneMapPadding = 5.0
+
+	// timezoneDotRadius is the radius of a time zone dot, in pixels
+	timezoneDotRadius = 2.5
+
+	// mouseButtonSecondary is the right mouse button, zooming out
+	mouseButtonSecondary = 3
+)
+
+// mapBounds is the area of the world displayed by the map, in degrees
+type mapBounds struct {
+	west, east, south, north float64
+}
+
+// worldBounds leaves out the poles, there are no time zones to pick there
+var worldBounds = mapBounds{west: -180, east: 180, south: -60, north: 85}
+
+// TimezoneMap is a world map of the time zones, a click on a region zooms
+// into it and a click in a zoomed region picks the nearest time zone
+type TimezoneMap struct {
+	area     *gtk.DrawingArea
+	zones    []*timezone.TimeZone
+	selected *timezone.TimeZone
+	region   string
+	bounds   mapBounds
+	onSelect func(tz *timezone.TimeZone)
+}
+
+// NewTimezoneMap returns a map of zones, onSelect is called when the user
+// picks a time zone on the map
+func NewTimezoneMap(zones []*timezone.TimeZone, onSelect func(tz *timezone.TimeZone)) (*TimezoneMap, error) {
+	var err error
+
+	tzMap := &TimezoneMap{
+		zones:    zones,
+		bounds:   worldBounds,
+		onSelect: onSelect,
+	}
+
+	tzMap.area, err = gtk.DrawingAreaNew()
+	if err != nil {
+		return nil, err
+	}
+	tzMap.area.SetSizeRequest(-1, timezoneMapHeight)
+	tzMap.area.AddEvents(int(gdk.BUTTON_PRESS_MASK))
+
+	if _, err = tzMap.area.Connect("draw", tzMap.onDraw); err != nil {
+		return nil, err
+	}
+
+	if _, err = tzMap.area.Connect("button-press-event", tzMap.onButtonPress); err != nil {
+		return nil, err
+	}
+
+	return tzMap, nil
+}
+
+// GetRootWidget returns the root embeddable widget for the map
+func (tzMap *TimezoneMap) GetRootWidget() gtk.IWidget {
+	return tzMap.area
+}
+
+// SetSelected highlights tz and zooms into its region, onSelect is not called
+func (tzMap *TimezoneMap) SetSelected(tz *timezone.TimeZone) {
+	tzMap.selected = tz
+
+	if tz != nil && tz.Location() != nil {
+		tzMap.zoom(tz.Region())
+	}
+
+	tzMap.area.QueueDraw()
+}
+
+// zoom displays region, the whole world if region is empty or has no
+// located time zone
+func (tzMap *TimezoneMap) zoom(region string) {
+	tzMap.region = ""
+	tzMap.bounds = worldBounds
+
+	if region == "" {
+		return
+	}
+
+	bounds := mapBounds{west: 180, east: -180, south: 90, north: -90}
+	found := false
+
+	for _, curr := range tzMap.zones {
+		loc := curr.Location()
+		if loc == nil || curr.Region() != region {
+			continue
+		}
+
+		found = true
+		bounds.west = math.Min(bounds.west, loc.Longitude)
+		bounds.east = math.Max(bounds.east, loc.Longitude)
+		bounds.south = math.Min(bounds.south, loc.Latitude)
+		bounds.north = math.Max(bounds.north, loc.Latitude)
+	}
+
+	if !found {
+		return
+	}
+
+	tzMap.region = region
+	tzMap.bounds = mapBounds{
+		west:  math.Max(bounds.west-timezoneMapPadding, -180),
+		east:  math.Min(bounds.east+timezoneMapPadding, 180),
+		south: math.Max(bounds.south-timezoneMapPadding, -90),
+		north: math.Min(bounds.north+timezoneMapPadding, 90),
+	}
+}
+
+// project returns the position of loc on the map, equirectangular projection
+func (tzMap *TimezoneMap) project(loc *timezone.Location) (float64, float64) {
+	width := float64(tzMap.area.GetAllocatedWidth())
+	height := float64(tzMap.area.GetAllocatedHeight())
+	b := tzMap.bounds
+
+	x := (loc.Longitude - b.west) / (b.east - b.west) * width
+	y := (b.north - loc.Latitude) / (b.north - b.south) * height
+
+	return x, y
+}
+
+// unproject returns the location of the map position x, y
+func (tzMap *TimezoneMap) unproject(x float64, y float64) *timezone.Location {
+	width := float64(tzMap.area.GetAllocatedWidth())
+	height := float64(tzMap.area.GetAllocatedHeight())
+	b := tzMap.bounds
+
+	return &timezone.Location{
+		Longitude: b.west + x/width*(b.east-b.west),
+		Latitude:  b.north - y/height*(b.north-b.south),
+	}
+}
+
+func (tzMap *TimezoneMap) onDraw(area *gtk.DrawingArea, cr *cairo.Context) bool {
+	width := float64(area.GetAllocatedWidth())
+	height := float64(area.GetAllocatedHeight())
+
+	// Ocean
+	cr.SetSourceRGB(0.13, 0.16, 0.2)
+	cr.Rectangle(0, 0, width, height)
+	cr.Fill()
+
+	// Meridians and parallels every 30 degrees
+	cr.SetSourceRGB(0.2, 0.24, 0.3)
+	cr.SetLineWidth(1)
+	for deg := -180.0; deg <= 180; deg += 30 {
+		x, _ := tzMap.project(&timezone.Location{Longitude: deg})
+		cr.MoveTo(x, 0)
+		cr.LineTo(x, height)
+	}
+	for deg := -90.0; deg <= 90; deg += 30 {
+		_, y := tzMap.project(&timezone.Location{Latitude: deg})
+		cr.MoveTo(0, y)
+		cr.LineTo(width, y)
+	}
+	cr.Stroke()
+
+	// Time zones, the ones of the zoomed region stand out
+	for _, curr := range tzMap.zones {
+		loc := curr.Location()
+		if loc == nil || curr.Equals(tzMap.selected) {
+			continue
+		}
+
+		if tzMap.region == "" || curr.Region() == tzMap.region {
+			cr.SetSourceRGB(0.6, 0.65, 0.7)
+		} else {
+			cr.SetSourceRGB(0.35, 0.38, 0.42)
+		}
+
+		x, y := tzMap.project(loc)
+		cr.Arc(x, y, timezoneDotRadius, 0, 2*math.Pi)
+		cr.Fill()
+	}
+
+	if tzMap.selected == nil || tzMap.selected.Location() == nil {
+		return false
+	}
+
+	x, y := tzMap.project(tzMap.selected.Location())
+	cr.SetSourceRGB(0.2, 0.6, 1.0)
+	cr.Arc(x, y, timezoneDotRadius*2, 0, 2*math.Pi)
+	cr.Fill()
+
+	cr.SetSourceRGB(1, 1, 1)
+	cr.SetFontSize(12)
+	cr.MoveTo(x+timezoneDotRadius*3, y-timezoneDotRadius*2)
+	cr.ShowText(tzMap.selected.Code)
+
+	return false
+}
+
+// onButtonPress zooms into the clicked region, picks the nearest time zone of
+// a zoomed region or, for the secondary button, zooms out
+func (tzMap *TimezoneMap) onButtonPress(area *gtk.DrawingArea, event *gdk.Event) bool {
+	ev := gdk.EventButtonNewFromEvent(event)
+
+	if ev.Button() == mouseButtonSecondary {
+		tzMap.zoom("")
+		area.QueueDraw()
+		return true
+	}
+
+	candidates := tzMap.zones
+	if tzMap.region != "" {
+		candidates = []*timezone.TimeZone{}
+		for _, curr := range tzMap.zones {
+			if curr.Region() == tzMap.region {
+				candidates = append(candidates, curr)
+			}
+		}
+	}
+
+	nearest := timezone.Nearest(candidates, tzMap.unproject(ev.X(), ev.Y()))
+	if nearest == nil {
+		return true
+	}
+
+	if tzMap.region == "" {
+		tzMap.zoom(nearest.Region())
+		area.QueueDraw()
+		return true
+	}
+
+	tzMap.selected = nearest
+	area.QueueDraw()
+
+	if tzMap.onSelect != nil {
+		tzMap.onSelect(nearest)
+	}
+
+	return true
+}
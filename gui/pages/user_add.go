@@ -19,6 +19,9 @@ import (
 const (
 	// CommonSetting is a common setting used by widgets
 	CommonSetting int = 150
+
+	// MaxListLength is the longest comma separated list of an entry
+	MaxListLength int = 255
 )
 
 // UserAddPage is a simple page to add/modify the user
@@ -46,9 +49,18 @@ type UserAddPage struct {
 	adminCheck   *gtk.CheckButton
 	adminChanged bool
 
+	groups        *gtk.Entry
+	groupsWarning *gtk.Label
+
+	sudo            *gtk.Entry
+	sudoWarning     *gtk.Label
+	noPasswordCheck *gtk.CheckButton
+
 	justLoaded bool
 
 	addMode bool
+
+	form *Form
 }
 
 // NewUserAddPage returns a new User Add page
@@ -89,8 +101,7 @@ func NewUserAddPage(controller Controller, model *model.SystemInstall) (Page, er
 
 	// Password
 	page.password, page.passwordConfirm, page.passwordWarning, err =
-		page.setPasswordWidgets(utils.Locale.Get("Min %d and Max %d characters.", user.MinPasswordLength, user.MaxPasswordLength),
-			user.MaxPasswordLength)
+		page.setPasswordWidgets(model.PasswordPolicy.Description(), user.MaxPasswordLength)
 	if err != nil {
 		return nil, err
 	}
@@ -112,6 +123,31 @@ func NewUserAddPage(controller Controller, model *model.SystemInstall) (Page, er
 	page.adminCheck.SetSensitive(false) // MUST have an admin user
 	page.box.PackStart(page.adminCheck, false, false, 0)
 
+	// Supplementary groups
+	page.groups, page.groupsWarning, err = page.setSimilarWidgets(utils.Locale.Get("Groups"),
+		utils.Locale.Get("Comma separated, i.e: docker, dialout. Missing groups are created."),
+		MaxListLength)
+	if err != nil {
+		return nil, err
+	}
+
+	// Sudo policy
+	page.sudo, page.sudoWarning, err = page.setSimilarWidgets(utils.Locale.Get("Sudo Commands"),
+		utils.Locale.Get("Comma separated absolute paths the user may run with sudo, all if empty."),
+		MaxListLength)
+	if err != nil {
+		return nil, err
+	}
+
+	page.noPasswordCheck, err = gtk.CheckButtonNew()
+	if err != nil {
+		return nil, err
+	}
+	page.noPasswordCheck.SetLabel("   " + utils.Locale.Get("Run sudo without password"))
+	page.noPasswordCheck.SetMarginStart(CommonSetting + common.StartEndMargin)
+	page.noPasswordCheck.SetMarginEnd(common.StartEndMargin)
+	page.box.PackStart(page.noPasswordCheck, false, false, 0)
+
 	// Generate signal on Name change
 	if _, err := page.name.Connect("changed", page.onNameChange); err != nil {
 		return nil, err
@@ -137,58 +173,129 @@ func NewUserAddPage(controller Controller, model *model.SystemInstall) (Page, er
 		return nil, err
 	}
 
-	return page, nil
-}
+	// The groups and sudo policy changes are found by accessChanged
+	if _, err := page.noPasswordCheck.Connect("clicked", func() { page.form.Validate() }); err != nil {
+		return nil, err
+	}
 
-func (page *UserAddPage) onNameChange(entry *gtk.Entry) {
-	name := getTextFromEntry(page.name)
-	if name != page.user.UserName {
-		page.nameChanged = true
-	} else {
-		page.nameChanged = false
+	// Validate the entries on change, the signals above are connected first
+	// so the changed flags are up to date when the form is validated
+	page.form = NewForm(controller, ButtonConfirm)
+	page.form.SetRequirement(func() bool {
+		return page.nameChanged || page.loginChanged || page.passwordChanged || page.adminChanged ||
+			page.accessChanged()
+	})
+
+	if err := page.form.AddField(page.name, page.nameWarning, validUsername); err != nil {
+		return nil, err
 	}
 
-	if ok, msg := user.IsValidUsername(getTextFromEntry(page.name)); !ok {
-		page.nameWarning.SetText(msg)
-	} else {
-		page.nameWarning.SetText("")
+	if err := page.form.AddField(page.login, page.loginWarning, validLogin, page.uniqueLogin); err != nil {
+		return nil, err
+	}
+
+	if err := page.form.AddField(page.password, page.passwordWarning, page.validPassword); err != nil {
+		return nil, err
+	}
+
+	if err := page.form.AddField(page.passwordConfirm, page.passwordWarning,
+		matches(page.password, utils.Locale.Get("Passwords do not match"))); err != nil {
+		return nil, err
 	}
 
-	page.setConfirmButton()
+	if err := page.form.AddField(page.groups, page.groupsWarning, validGroups); err != nil {
+		return nil, err
+	}
+
+	if err := page.form.AddField(page.sudo, page.sudoWarning, page.validSudoCommands); err != nil {
+		return nil, err
+	}
+
+	return page, nil
 }
 
-func (page *UserAddPage) onLoginChange(entry *gtk.Entry) error {
-	login := getTextFromEntry(page.login)
-	if login != page.user.Login {
-		page.loginChanged = true
-	} else {
-		page.loginChanged = false
+func validUsername(text string) string {
+	_, msg := user.IsValidUsername(text)
+	return msg
+}
+
+func validLogin(text string) string {
+	_, msg := user.IsValidLogin(text)
+	return msg
+}
+
+func (page *UserAddPage) validPassword(text string) string {
+	_, msg := page.model.PasswordPolicy.Check(text)
+	return msg
+}
+
+func validGroups(text string) string {
+	_, msg := user.IsValidGroups(text)
+	return msg
+}
+
+func (page *UserAddPage) validSudoCommands(text string) string {
+	_, msg := user.IsValidSudoCommands(text, page.adminCheck.GetActive())
+	return msg
+}
+
+// accessChanged returns true if the groups or the sudo policy differ from
+// the user ones
+func (page *UserAddPage) accessChanged() bool {
+	if strings.Join(user.ParseList(getTextFromEntry(page.groups)), ",") != strings.Join(page.user.Groups, ",") {
+		return true
 	}
 
-	page.loginWarning.SetText("")
-	if ok, msg := user.IsValidLogin(getTextFromEntry(page.login)); !ok {
-		page.loginWarning.SetText(msg)
+	sudo := user.NewSudoPolicy(page.noPasswordCheck.GetActive(), getTextFromEntry(page.sudo))
+	if sudo == nil || page.user.Sudo == nil {
+		return sudo != page.user.Sudo
 	}
 
+	return sudo.NoPassword != page.user.Sudo.NoPassword ||
+		strings.Join(sudo.Commands, ",") != strings.Join(page.user.Sudo.Commands, ",")
+}
+
+// storeAccess stores the groups and the sudo policy into usr
+func (page *UserAddPage) storeAccess(usr *user.User) {
+	usr.Groups = user.ParseList(getTextFromEntry(page.groups))
+	usr.Sudo = user.NewSudoPolicy(page.noPasswordCheck.GetActive(), getTextFromEntry(page.sudo))
+}
+
+func (page *UserAddPage) uniqueLogin(login string) string {
 	isDefaultUser, err := user.IsSysDefaultUser(login)
 	if err != nil {
-		return err
+		log.Warning("Failed to check system default users: %v", err)
 	}
 	if isDefaultUser {
-		page.loginWarning.SetText(utils.Locale.Get("Specified login is a system default user"))
+		return utils.Locale.Get("Specified login is a system default user")
 	}
 
 	// TODO: Remove this until multi user is implemented
 	for _, curr := range page.definedUsers {
 		if curr == login {
-			page.loginWarning.SetText(utils.Locale.Get("User must be unique"))
-			break
+			return utils.Locale.Get("User must be unique")
 		}
 	}
 
-	page.setConfirmButton()
+	return ""
+}
+
+func (page *UserAddPage) onNameChange(entry *gtk.Entry) {
+	name := getTextFromEntry(page.name)
+	if name != page.user.UserName {
+		page.nameChanged = true
+	} else {
+		page.nameChanged = false
+	}
+}
 
-	return nil
+func (page *UserAddPage) onLoginChange(entry *gtk.Entry) {
+	login := getTextFromEntry(page.login)
+	if login != page.user.Login {
+		page.loginChanged = true
+	} else {
+		page.loginChanged = false
+	}
 }
 
 func (page *UserAddPage) onPasswordChange(entry *gtk.Entry) {
@@ -197,7 +304,6 @@ func (page *UserAddPage) onPasswordChange(entry *gtk.Entry) {
 		setTextInEntry(page.passwordConfirm, "")
 		page.fakePassword = false
 		page.passwordChanged = true
-		page.setConfirmButton()
 		return
 	}
 
@@ -207,18 +313,6 @@ func (page *UserAddPage) onPasswordChange(entry *gtk.Entry) {
 	} else {
 		page.passwordChanged = false
 	}
-
-	passwordConfirm := getTextFromEntry(page.passwordConfirm)
-
-	if ok, msg := user.IsValidPassword(password); !ok {
-		page.passwordWarning.SetText(msg)
-	} else if password != passwordConfirm {
-		page.passwordWarning.SetText(utils.Locale.Get("Passwords do not match"))
-	} else {
-		page.passwordWarning.SetText("")
-	}
-
-	page.setConfirmButton()
 }
 
 func (page *UserAddPage) onAdminClick(button *gtk.CheckButton) {
@@ -227,7 +321,7 @@ func (page *UserAddPage) onAdminClick(button *gtk.CheckButton) {
 	} else {
 		page.adminChanged = false
 	}
-	page.setConfirmButton()
+	page.form.Validate()
 }
 
 // IsRequired will return false as we have default values
@@ -275,6 +369,7 @@ func (page *UserAddPage) StoreChanges() {
 			Login:    getTextFromEntry(page.login),
 			Admin:    page.adminCheck.GetActive(),
 		}
+		page.storeAccess(newUser)
 
 		page.model.AddUser(newUser)
 	} else {
@@ -286,6 +381,7 @@ func (page *UserAddPage) StoreChanges() {
 		page.model.Users[0].UserName = getTextFromEntry(page.name)
 		page.model.Users[0].Login = getTextFromEntry(page.login)
 		page.model.Users[0].Admin = page.adminCheck.GetActive()
+		page.storeAccess(page.model.Users[0])
 	}
 
 	log.Debug("page.model.Users[0]: %+v", page.model.Users[0]) // RemoveMe
@@ -323,6 +419,11 @@ func (page *UserAddPage) ResetChanges() {
 
 	setTextInEntry(page.name, page.user.UserName)
 	setTextInEntry(page.login, page.user.Login)
+	setTextInEntry(page.groups, strings.Join(page.user.Groups, ", "))
+	if page.user.Sudo != nil {
+		setTextInEntry(page.sudo, strings.Join(page.user.Sudo.Commands, ", "))
+		page.noPasswordCheck.SetActive(page.user.Sudo.NoPassword)
+	}
 
 	if page.addMode {
 		log.Debug("Starting in addMode")
@@ -341,45 +442,13 @@ func (page *UserAddPage) ResetChanges() {
 		page.adminCheck.SetActive(page.user.Admin)
 	}
 
+	page.form.Reset()
 	page.justLoaded = true
 }
 
 // GetConfiguredValue returns our current config
 func (page *UserAddPage) GetConfiguredValue() string {
-	users := page.model.Users
-	result := []string{}
-
-	if len(users) == 0 {
-		return utils.Locale.Get("No users added")
-	}
-
-	for _, curr := range users {
-		text := []string{curr.Login}
-		if curr.Admin {
-			text = append(text, utils.Locale.Get("admin"))
-		}
-		result = append(result, strings.Join(text, ": "))
-	}
-
-	return strings.Join(result, ", ")
-}
-
-func (page *UserAddPage) setConfirmButton() {
-	page.controller.SetButtonState(ButtonConfirm, false)
-
-	if page.nameChanged || page.loginChanged || page.passwordChanged || page.adminChanged {
-		userWarning, _ := page.nameWarning.GetText()
-		loginWarning, _ := page.loginWarning.GetText()
-		passwordWarning, _ := page.passwordWarning.GetText()
-		login := getTextFromEntry(page.login)
-		password := getTextFromEntry(page.password)
-
-		if userWarning == "" && loginWarning == "" && passwordWarning == "" && login != "" && password != "" {
-			page.controller.SetButtonState(ButtonConfirm, true)
-		} else {
-			page.controller.SetButtonState(ButtonConfirm, false)
-		}
-	}
+	return page.model.SummaryValue(model.SummaryUsers)
 }
 
 func (page *UserAddPage) clearForm() {
@@ -387,7 +456,10 @@ func (page *UserAddPage) clearForm() {
 	setTextInEntry(page.login, "")
 	setTextInEntry(page.password, "")
 	setTextInEntry(page.passwordConfirm, "")
+	setTextInEntry(page.groups, "")
+	setTextInEntry(page.sudo, "")
 	page.adminCheck.SetActive(true)
+	page.noPasswordCheck.SetActive(false)
 
 	page.nameChanged = false
 	page.loginChanged = false
@@ -441,11 +513,10 @@ func (page *UserAddPage) setSimilarWidgets(entryText, rulesText string, maxSize
 	page.box.PackStart(rulesLabel, false, false, 0)
 
 	// Warning
-	warningLabel, err := setLabel("", "label-warning", 0.0)
+	warningLabel, err := setErrorLabel(CommonSetting + common.StartEndMargin)
 	if err != nil {
 		return nil, nil, err
 	}
-	warningLabel.SetMarginStart(CommonSetting + common.StartEndMargin)
 	page.box.PackStart(warningLabel, false, false, 0)
 
 	return entry, warningLabel, err
@@ -479,11 +550,10 @@ func (page *UserAddPage) setPasswordWidgets(rulesText string, maxSize int) (*gtk
 	page.box.PackStart(boxPasswordConfirm, false, false, 0)
 
 	// Warning
-	warningLabel, err := setLabel("", "label-warning", 0.0)
+	warningLabel, err := setErrorLabel(CommonSetting + common.StartEndMargin)
 	if err != nil {
 		return nil, nil, nil, err
 	}
-	warningLabel.SetMarginStart(CommonSetting + common.StartEndMargin)
 	page.box.PackStart(warningLabel, false, false, 0)
 
 	return password, passwordConfirm, warningLabel, err
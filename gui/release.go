@@ -0,0 +1,132 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package gui
+
+import (
+	"html"
+	"strconv"
+
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+
+	"github.com/clearlinux/clr-installer/gui/common"
+	"github.com/clearlinux/clr-installer/log"
+	"github.com/clearlinux/clr-installer/model"
+	"github.com/clearlinux/clr-installer/network"
+	"github.com/clearlinux/clr-installer/utils"
+)
+
+const (
+	// staleReleases is the number of releases behind the latest one above
+	// which the install media is considered outdated
+	staleReleases = 10
+
+	// releaseNotesLines is the number of release notes lines displayed
+	releaseNotesLines = 8
+)
+
+var (
+	// latestRelease is the latest released Clear Linux version, empty
+	// until the update check completes
+	latestRelease string
+)
+
+// checkLatestRelease fetches the latest release version and its release notes
+// in the background, updates the welcome message and warns the user when the
+// install media is outdated
+func (window *Window) checkLatestRelease() {
+	if model.Version == model.DemoVersion || window.model.Version != 0 {
+		return
+	}
+
+	go func() {
+		latest, err := network.GetLatestVersion()
+		if err != nil {
+			log.Warning("Could not check the latest release: %v", err)
+			return
+		}
+
+		notes, err := network.GetReleaseNotes(latest, releaseNotesLines)
+		if err != nil {
+			log.Warning("Could not fetch the %s release notes: %v", latest, err)
+		}
+
+		behind, err := network.ReleasesBehind(utils.ClearVersion, latest)
+		if err != nil {
+			log.Warning("Could not compare the media version %s to %s: %v", utils.ClearVersion, latest, err)
+			return
+		}
+
+		_, err = glib.IdleAdd(func() {
+			latestRelease = latest
+			window.banner.labelText.SetMarkup(GetWelcomeMessage())
+			window.banner.labelText.SetTooltipText(notes)
+
+			if behind >= staleReleases {
+				window.warnOutdatedRelease(latest, behind, notes)
+			}
+		})
+		if err != nil {
+			log.Warning("Error updating the release information: %v", err)
+		}
+	}()
+}
+
+// warnOutdatedRelease offers to install the latest release instead of the
+// outdated media version, the user may continue with the media version
+func (window *Window) warnOutdatedRelease(latest string, behind int, notes string) {
+	text := utils.Locale.Get("This install media is Clear Linux* OS %s, %d releases behind the latest %s.",
+		utils.ClearVersion, behind, latest)
+	text = text + "\n" + utils.Locale.Get("Install the latest version instead?")
+
+	if notes != "" {
+		text = text + "\n\n<small>" + html.EscapeString(notes) + "</small>"
+	}
+
+	contentBox, err := gtk.BoxNew(gtk.ORIENTATION_VERTICAL, 0)
+	if err != nil {
+		log.Warning("Error creating box")
+		return
+	}
+	contentBox.SetHAlign(gtk.ALIGN_FILL)
+	contentBox.SetMarginBottom(common.TopBottomMargin)
+
+	label, err := gtk.LabelNew(text)
+	if err != nil {
+		log.Warning("Error creating label")
+		return
+	}
+	label.SetUseMarkup(true)
+	label.SetLineWrap(true)
+	label.SetHAlign(gtk.ALIGN_START)
+	contentBox.PackStart(label, false, true, 0)
+
+	title := utils.Locale.Get("Outdated install media")
+	dialog, err := common.CreateDialogOkCancel(contentBox, title,
+		utils.Locale.Get("INSTALL LATEST"), utils.Locale.Get("CONTINUE"))
+	if err != nil {
+		log.Warning("Error creating dialog")
+		return
+	}
+
+	_, err = dialog.Connect("response", func(msgDialog *gtk.Dialog, responseType gtk.ResponseType) {
+		if responseType == gtk.RESPONSE_OK {
+			version, err := strconv.ParseUint(latest, 10, 32)
+			if err != nil {
+				log.ErrorError(err)
+			} else {
+				log.Info("Installing the latest version %s instead of %s", latest, utils.ClearVersion)
+				window.model.Version = uint(version)
+			}
+		}
+		msgDialog.Destroy()
+	})
+	if err != nil {
+		log.Warning("Error connecting to dialog")
+	}
+
+	dialog.ShowAll()
+	dialog.Run()
+}
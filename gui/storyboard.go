@@ -0,0 +1,144 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package gui
+
+import (
+	"fmt"
+
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+
+	"github.com/clearlinux/clr-installer/log"
+	"github.com/clearlinux/clr-installer/utils"
+)
+
+const (
+	// storyboardStepDuration is how long a step is shown, in milliseconds
+	storyboardStepDuration = 2500
+)
+
+// storyboardIcons are the icons of the disk wipe, partitioning and OS install
+// steps of the destructive install storyboard
+var storyboardIcons = []string{
+	"edit-delete-symbolic",
+	"drive-harddisk-symbolic",
+	"system-software-install-symbolic",
+}
+
+// Storyboard shows, one after the other and in a loop, the steps of the
+// destructive install so the user sees what will happen before confirming
+type Storyboard struct {
+	box     *gtk.Box
+	stack   *gtk.Stack
+	counter *gtk.Label
+	steps   int
+	current int
+	stopped bool
+}
+
+// newStoryboardStep creates the widget of the idx step
+func newStoryboardStep(idx int, text string) (*gtk.Box, error) {
+	box, err := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 12)
+	if err != nil {
+		return nil, err
+	}
+
+	image, err := gtk.ImageNewFromIconName(storyboardIcons[idx%len(storyboardIcons)], gtk.ICON_SIZE_DIALOG)
+	if err != nil {
+		return nil, err
+	}
+	box.PackStart(image, false, false, 0)
+
+	label, err := gtk.LabelNew(text)
+	if err != nil {
+		return nil, err
+	}
+	label.SetLineWrap(true)
+	label.SetMaxWidthChars(60)
+	label.SetHAlign(gtk.ALIGN_START)
+	label.SetXAlign(0)
+	box.PackStart(label, true, true, 0)
+
+	return box, nil
+}
+
+// NewStoryboard creates the storyboard of steps, it's animated once started
+func NewStoryboard(steps []string) (*Storyboard, error) {
+	var err error
+
+	board := &Storyboard{steps: len(steps)}
+
+	if board.box, err = gtk.BoxNew(gtk.ORIENTATION_VERTICAL, 4); err != nil {
+		return nil, err
+	}
+	board.box.SetMarginTop(8)
+
+	// the animation stops with the dialog showing the storyboard
+	if _, err = board.box.Connect("destroy", func() { board.stopped = true }); err != nil {
+		return nil, err
+	}
+
+	title, err := gtk.LabelNew(utils.Locale.Get("What will happen"))
+	if err != nil {
+		return nil, err
+	}
+	title.SetHAlign(gtk.ALIGN_START)
+	board.box.PackStart(title, false, false, 0)
+
+	if board.stack, err = gtk.StackNew(); err != nil {
+		return nil, err
+	}
+	board.stack.SetTransitionType(gtk.STACK_TRANSITION_TYPE_SLIDE_LEFT)
+	board.stack.SetTransitionDuration(400)
+	board.box.PackStart(board.stack, false, false, 0)
+
+	for idx, text := range steps {
+		step, err := newStoryboardStep(idx, text)
+		if err != nil {
+			return nil, err
+		}
+		board.stack.AddNamed(step, fmt.Sprintf("%d", idx))
+	}
+
+	if board.counter, err = gtk.LabelNew(""); err != nil {
+		return nil, err
+	}
+	board.counter.SetHAlign(gtk.ALIGN_END)
+	board.box.PackStart(board.counter, false, false, 0)
+	board.show(0)
+
+	return board, nil
+}
+
+// GetRootWidget returns the root widget of the storyboard
+func (board *Storyboard) GetRootWidget() gtk.IWidget {
+	return board.box
+}
+
+// show shows the idx step
+func (board *Storyboard) show(idx int) {
+	board.current = idx
+	board.stack.SetVisibleChildName(fmt.Sprintf("%d", idx))
+	board.counter.SetMarkup("<small>" + utils.Locale.Get("Step %d of %d", idx+1, board.steps) + "</small>")
+}
+
+// Start animates the storyboard until its widgets are destroyed
+func (board *Storyboard) Start() {
+	if board.steps < 2 {
+		return
+	}
+
+	_, err := glib.TimeoutAdd(storyboardStepDuration, func() bool {
+		if board.stopped {
+			return false
+		}
+
+		board.show((board.current + 1) % board.steps)
+		return true
+	})
+	if err != nil {
+		log.Warning("Failed to animate the storyboard: %v", err)
+	}
+}
@@ -138,14 +138,15 @@ func (s *SummaryWidget) GetRowIndex() int {
 }
 
 // Update will alter the view to show the currently configured values
+// and the completion state of the page
 func (s *SummaryWidget) Update() {
-	value := s.page.GetConfiguredValue()
-	if value == "" {
+	if value := s.page.GetConfiguredValue(); value == "" {
 		s.value.Hide()
-		return
+	} else {
+		s.value.SetText(value)
+		s.value.Show()
 	}
-	s.value.SetText(value)
-	s.value.Show()
+
 	if s.page.IsDone() {
 		s.tick.SetFromIconName("object-select-symbolic", gtk.ICON_SIZE_BUTTON)
 		s.layout.SetTooltipText("")
@@ -154,3 +155,18 @@ func (s *SummaryWidget) Update() {
 		s.layout.SetTooltipText(utils.Locale.Get("This task has not yet completed"))
 	}
 }
+
+// SetHighlight highlights the widget as a required task to complete
+// before installing
+func (s *SummaryWidget) SetHighlight(highlight bool) {
+	st, err := s.handle.GetStyleContext()
+	if err != nil {
+		return
+	}
+
+	if highlight {
+		st.AddClass("summary-widget-incomplete")
+	} else {
+		st.RemoveClass("summary-widget-incomplete")
+	}
+}
@@ -5,17 +5,24 @@
 package gui
 
 import (
+	"html"
 	"strings"
 
+	"github.com/gotk3/gotk3/glib"
 	"github.com/gotk3/gotk3/gtk"
 
 	"github.com/clearlinux/clr-installer/args"
+	"github.com/clearlinux/clr-installer/controller"
 	"github.com/clearlinux/clr-installer/gui/common"
 	"github.com/clearlinux/clr-installer/gui/pages"
 	"github.com/clearlinux/clr-installer/log"
 	"github.com/clearlinux/clr-installer/model"
+	"github.com/clearlinux/clr-installer/power"
+	"github.com/clearlinux/clr-installer/remote"
 	"github.com/clearlinux/clr-installer/storage"
+	"github.com/clearlinux/clr-installer/swupd"
 	"github.com/clearlinux/clr-installer/syscheck"
+	"github.com/clearlinux/clr-installer/telemetry"
 	"github.com/clearlinux/clr-installer/utils"
 )
 
@@ -25,6 +32,13 @@ const (
 
 	// WindowHeight specifies the default height of the window
 	WindowHeight int = 600
+
+	// maxReviewChanges is the number of the changes from the defaults listed
+	// by the install confirmation, the others are counted only
+	maxReviewChanges = 8
+
+	// maxReviewChangeWidth is the width the listed changes are cut to
+	maxReviewChangeWidth = 80
 )
 
 // PageConstructor is a typedef of the constructors for our pages
@@ -43,6 +57,8 @@ type Window struct {
 	options args.Args            // installer args
 	rootDir string               // root directory
 
+	sizeProblem *swupd.ContentSizeProblem // selected bundles not fitting the root partition
+
 	// Menu
 	menu struct {
 		switcher    *Switcher             // Allow switching between main menu
@@ -51,6 +67,7 @@ type Window struct {
 		welcomePage pages.Page            // Pointer to the welcome page
 		currentPage pages.Page            // Pointer to the currently open page
 		installPage pages.Page            // Pointer to the installer page
+		menuPages   []pages.Page          // The pages listed in the menu
 	}
 
 	// Buttons
@@ -137,7 +154,7 @@ func NewWindow(model *model.SystemInstall, rootDir string, options args.Args) (*
 	window.handle.Add(window.mainLayout)
 
 	// Set locale
-	utils.SetLocale(model.Language.Code)
+	utils.SetLocale(model.GetInstallerLanguage().Code)
 
 	// Create welcome page
 	window, err = window.createWelcomePage()
@@ -145,6 +162,8 @@ func NewWindow(model *model.SystemInstall, rootDir string, options args.Args) (*
 		return nil, err
 	}
 
+	window.checkLatestRelease()
+
 	return window, nil
 }
 
@@ -251,6 +270,8 @@ func (window *Window) createMenuPages() (*Window, error) {
 		// advanced
 		pages.NewBundlePage,
 		pages.NewHostnamePage,
+		pages.NewProxyPage,
+		pages.NewSwupdMirrorPage,
 
 		// always last
 		pages.NewInstallPage,
@@ -267,6 +288,21 @@ func (window *Window) createMenuPages() (*Window, error) {
 		}
 	}
 
+	// The features with no dedicated page get a generated one
+	featurePages, err := pages.NewFeaturePages(window, window.model)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, page := range featurePages {
+		if err = window.AddPage(page); err != nil {
+			return nil, err
+		}
+	}
+
+	// Let the read-write remote session clients switch the pages
+	window.navigateRemote()
+
 	// Show the whole window now
 	window.handle.ShowAll()
 
@@ -276,10 +312,48 @@ func (window *Window) createMenuPages() (*Window, error) {
 	return window, nil
 }
 
+// navigateRemote lets the read-write remote session clients switch to the
+// menu pages, as the local user does from the menu
+func (window *Window) navigateRemote() {
+	titles := []string{}
+	for _, page := range window.menu.menuPages {
+		titles = append(titles, page.GetTitle())
+	}
+
+	remote.Navigate(titles, func(title string) {
+		if _, err := glib.IdleAdd(func() {
+			window.activateRemotePage(title)
+		}); err != nil {
+			log.Warning("Error switching to the remote page: %v", err)
+		}
+	})
+}
+
+// activateRemotePage switches to the menu page picked by a remote session
+// client, the changes of the page being displayed are discarded
+func (window *Window) activateRemotePage(title string) {
+	current := window.menu.currentPage
+	if current != nil && current.GetID() == pages.PageIDInstall {
+		log.Warning("Not switching to %q, the install is running", title)
+		return
+	}
+
+	for _, page := range window.menu.menuPages {
+		if page.GetTitle() != title {
+			continue
+		}
+
+		if current != nil && current.GetID() != pages.PageIDWelcome {
+			window.pageClosed(false)
+		}
+		window.ActivatePage(page)
+		return
+	}
+}
+
 // ShowMenuView displays the menu view
 func (window *Window) ShowMenuView() {
-	done := window.menu.screens[ContentViewRequired].IsDone()
-	window.buttons.install.SetSensitive(done)
+	window.updateMenuState()
 
 	window.banner.Show()
 	window.menu.switcher.Show()
@@ -289,6 +363,34 @@ func (window *Window) ShowMenuView() {
 	window.buttons.stack.SetVisibleChildName("primary")
 }
 
+// MissingRequirements returns the summaries of the required pages not yet
+// completed, the installation is only allowed once it's empty
+func (window *Window) MissingRequirements() []string {
+	if window.menu.screens == nil {
+		return []string{}
+	}
+
+	return window.menu.screens[ContentViewRequired].GetIncomplete()
+}
+
+// updateMenuState refreshes the summary of every page and only allows the
+// installation once the required pages are completed, the missing ones
+// are highlighted and listed in the install button tooltip
+func (window *Window) updateMenuState() {
+	window.menu.screens[ContentViewRequired].UpdateAll()
+	window.menu.screens[ContentViewAdvanced].UpdateAll()
+
+	missing := window.MissingRequirements()
+	window.buttons.install.SetSensitive(len(missing) == 0)
+
+	if len(missing) == 0 {
+		window.buttons.install.SetTooltipText("")
+	} else {
+		window.buttons.install.SetTooltipText(utils.Locale.Get("Complete the required tasks first") +
+			": " + strings.Join(missing, ", "))
+	}
+}
+
 // InitScreens initializes the switcher screens
 func (window *Window) InitScreens() error {
 	var err error
@@ -326,6 +428,7 @@ func (window *Window) AddPage(page pages.Page) error {
 		if err != nil {
 			return err
 		}
+		window.menu.menuPages = append(window.menu.menuPages, page)
 	}
 
 	// Create a header page wrap for the page
@@ -484,16 +587,14 @@ func (window *Window) pageClosed(applied bool) {
 	// otherwise, reset from existing model
 	if applied {
 		window.menu.currentPage.StoreChanges()
+		telemetry.UsageLeave(telemetry.UsageActionConfirm)
 	} else {
 		window.menu.currentPage.ResetChanges()
+		telemetry.UsageLeave(telemetry.UsageActionCancel)
 	}
 
-	// Let installation continue if possible
-	done := window.menu.screens[ContentViewRequired].IsDone()
-	window.buttons.install.SetSensitive(done)
-
-	// Reset the SummaryWidget for responsible controller
-	window.menu.screens[window.menu.currentPage.IsRequired()].UpdateView(window.menu.currentPage)
+	// Refresh the summaries and let installation continue if possible
+	window.updateMenuState()
 
 	// Reset currentPage
 	window.menu.currentPage = nil
@@ -509,6 +610,8 @@ func (window *Window) pageClosed(applied bool) {
 func (window *Window) ActivatePage(page pages.Page) {
 	window.menu.currentPage = page
 	id := page.GetID()
+	telemetry.UsageEnter(page)
+	remote.Publish(remote.EventPage, page.GetTitle())
 
 	if id == pages.PageIDWelcome { // Welcome Page
 		window.banner.Show()
@@ -605,61 +708,124 @@ func (window *Window) launchWelcomeView() {
 func (window *Window) launchMenuView() {
 	window.menu.currentPage.StoreChanges()
 
-	// If syscheck fails, launch a dialog box and force the user to exit
-	if retErr := syscheck.RunSystemCheck(true); retErr != nil {
-		contentBox, err := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 10)
-		contentBox.SetHAlign(gtk.ALIGN_FILL)
-		contentBox.SetMarginBottom(common.TopBottomMargin)
-		if err != nil {
-			log.Warning("Error creating box")
-			return
+	results := syscheck.RunPreChecks(window.model.PreChecks)
+	for _, curr := range results {
+		if !curr.Passed() {
+			log.Warning("Pre-check %s", curr)
 		}
+	}
 
-		st, err := contentBox.GetStyleContext()
-		if err != nil {
-			log.Warning("Error getting style context")
-			return
-		}
+	if len(syscheck.BlockingResults(results)) == 0 {
+		window.launchMenuPages()
+		return
+	}
 
-		// Style the dialog
-		st.AddClass("dialog-warning")
+	// If a blocking pre-check fails the user must exit, or an administrator
+	// overrides it after a confirmation
+	lines := []string{}
+	for _, curr := range results {
+		lines = append(lines, html.EscapeString(curr.String()))
+	}
 
-		icon, err := gtk.ImageNewFromIconName("dialog-error-symbolic", gtk.ICON_SIZE_DIALOG)
-		if err != nil {
-			log.Warning("gtk.ImageNewFromIconName failed for icon dialog-error-symbolic")
-			return
-		}
+	text := utils.Locale.Get("System failed to pass pre-install checks.") + "\n\n" + strings.Join(lines, "\n")
+	dialog, err := createPreCheckDialog(text, utils.Locale.Get("System Check Failed"), utils.Locale.Get("OVERRIDE"))
+	if err != nil {
+		log.Warning("Error creating dialog")
+		return
+	}
 
-		icon.SetMarginEnd(12)
-		icon.SetHAlign(gtk.ALIGN_START)
-		icon.SetVAlign(gtk.ALIGN_START)
-		contentBox.PackStart(icon, false, true, 0)
+	_, err = dialog.Connect("response", func(msgDialog *gtk.Dialog, responseType gtk.ResponseType) {
+		msgDialog.Destroy()
 
-		label, err := gtk.LabelNew(utils.Locale.Get("System failed to pass pre-install checks.") + "\n\n" + retErr.Error())
-		if err != nil {
-			log.Warning("Error creating label")
+		if responseType != gtk.RESPONSE_OK {
+			gtk.MainQuit()
 			return
 		}
-		label.SetUseMarkup(true)
-		label.SetHAlign(gtk.ALIGN_END)
-		contentBox.PackStart(label, false, true, 0)
 
-		dialog, err := common.CreateDialogOneButton(contentBox, utils.Locale.Get("System Check Failed"), utils.Locale.Get("EXIT"), "button-cancel")
-		if err != nil {
-			log.Warning("Error creating dialog")
+		window.confirmPreCheckOverride(results)
+	})
+	if err != nil {
+		log.Warning("Error connecting to dialog")
+	}
+	dialog.ShowAll()
+	dialog.Run()
+}
+
+// confirmPreCheckOverride asks the administrator to confirm installing on a
+// system failing the blocking pre-checks of results
+func (window *Window) confirmPreCheckOverride(results []*syscheck.CheckResult) {
+	text := utils.Locale.Get("The installed system may not boot or work properly. Override the failed checks and continue?")
+	dialog, err := createPreCheckDialog(text, utils.Locale.Get("Override System Checks"), utils.Locale.Get("CONTINUE"))
+	if err != nil {
+		log.Warning("Error creating dialog")
+		return
+	}
+
+	_, err = dialog.Connect("response", func(msgDialog *gtk.Dialog, responseType gtk.ResponseType) {
+		msgDialog.Destroy()
+
+		if responseType != gtk.RESPONSE_OK {
+			gtk.MainQuit()
 			return
 		}
 
-		_, err = dialog.Connect("response", func() { gtk.MainQuit() })
-		if err != nil {
-			log.Warning("Error connecting to dialog")
-		}
-		dialog.ShowAll()
-		dialog.Run()
-	} else {
-		if _, err := window.createMenuPages(); err != nil {
-			log.ErrorError(err) // TODO: Handle error
+		for _, curr := range syscheck.BlockingResults(results) {
+			log.Warning("Pre-check %s overridden by the user", curr.Check.Name)
 		}
+
+		window.model.PreChecks = syscheck.OverridePolicies(window.model.PreChecks, results)
+		window.launchMenuPages()
+	})
+	if err != nil {
+		log.Warning("Error connecting to dialog")
+	}
+	dialog.ShowAll()
+	dialog.Run()
+}
+
+// createPreCheckDialog creates the warning dialog of the failed pre-checks,
+// cancelling exits the installer
+func createPreCheckDialog(text string, title string, ok string) (*gtk.Dialog, error) {
+	contentBox, err := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 10)
+	if err != nil {
+		return nil, err
+	}
+	contentBox.SetHAlign(gtk.ALIGN_FILL)
+	contentBox.SetMarginBottom(common.TopBottomMargin)
+
+	st, err := contentBox.GetStyleContext()
+	if err != nil {
+		return nil, err
+	}
+
+	// Style the dialog
+	st.AddClass("dialog-warning")
+
+	icon, err := gtk.ImageNewFromIconName("dialog-error-symbolic", gtk.ICON_SIZE_DIALOG)
+	if err != nil {
+		return nil, err
+	}
+
+	icon.SetMarginEnd(12)
+	icon.SetHAlign(gtk.ALIGN_START)
+	icon.SetVAlign(gtk.ALIGN_START)
+	contentBox.PackStart(icon, false, true, 0)
+
+	label, err := gtk.LabelNew(text)
+	if err != nil {
+		return nil, err
+	}
+	label.SetUseMarkup(true)
+	label.SetHAlign(gtk.ALIGN_END)
+	contentBox.PackStart(label, false, true, 0)
+
+	return common.CreateDialogOkCancel(contentBox, title, ok, utils.Locale.Get("EXIT"))
+}
+
+// launchMenuPages creates the menu pages once the pre-checks passed
+func (window *Window) launchMenuPages() {
+	if _, err := window.createMenuPages(); err != nil {
+		log.ErrorError(err) // TODO: Handle error
 	}
 }
 
@@ -689,6 +855,43 @@ func (window *Window) confirmInstall() {
 	}
 	secondaryText = utils.Locale.Get("Target Media") + ": " + strings.Join(targets, ", ")
 
+	if firmware := syscheck.FirmwareBundlesMessage(controller.FirmwareBundles(window.model)); firmware != "" {
+		secondaryText = secondaryText + "\n" + firmware
+	}
+
+	if console := syscheck.SerialConsoleMessage(controller.SerialConsole(window.model)); console != "" {
+		secondaryText = secondaryText + "\n" + console
+	}
+
+	if warning := power.BatteryWarning(); warning != "" {
+		secondaryText = secondaryText + "\n" + warning
+	}
+
+	for _, warning := range storage.HWRAIDWarnings(window.model.TargetMedias) {
+		secondaryText = secondaryText + "\n" + html.EscapeString(warning)
+	}
+
+	if changes, err := model.ReviewChanges(window.model, maxReviewChanges, maxReviewChangeWidth); err != nil {
+		log.Warning("Could not compare the configuration with the defaults: %v", err)
+	} else if len(changes) > 0 {
+		secondaryText = secondaryText + "\n" + utils.Locale.Get("Changes from the defaults") + ":"
+		for _, change := range changes {
+			secondaryText = secondaryText + "\n" + html.EscapeString(change)
+		}
+	}
+
+	window.sizeProblem = nil
+	if bundles, err := swupd.LoadBundleList(window.model); err == nil {
+		window.sizeProblem = swupd.CheckContentSize(window.model, bundles)
+	}
+
+	okLabel := utils.Locale.Get("CONFIRM")
+	if window.sizeProblem != nil {
+		primaryText = primaryText + "\n" + "<span foreground=\"#FDB814\">" +
+			html.EscapeString(window.sizeProblem.Message()) + "</span>"
+		okLabel = utils.Locale.Get("DROP BUNDLES AND INSTALL")
+	}
+
 	title := utils.Locale.Get(storage.ConfirmInstallation)
 	text = primaryText + "\n" + "<small>" + secondaryText + "</small>"
 
@@ -709,22 +912,67 @@ func (window *Window) confirmInstall() {
 	label.SetHAlign(gtk.ALIGN_START)
 	contentBox.PackStart(label, false, true, 0)
 
-	dialog, err := common.CreateDialogOkCancel(contentBox, title, utils.Locale.Get("CONFIRM"), utils.Locale.Get("CANCEL"))
+	var board *Storyboard
+	if window.model.InstallSelected.EraseDisk {
+		if steps := storage.DestructiveSteps(window.model.TargetMedias); len(steps) > 0 {
+			if board, err = NewStoryboard(steps); err != nil {
+				log.Warning("Error creating the install storyboard: %v", err)
+				board = nil
+			} else {
+				contentBox.PackStart(board.GetRootWidget(), false, true, 0)
+			}
+		}
+	}
+
+	var dialog *gtk.Dialog
+	choices := []string{utils.Locale.Get("CANCEL")}
+	responses := []gtk.ResponseType{gtk.RESPONSE_CANCEL}
+	if window.sizeProblem != nil && !window.sizeProblem.Resolved {
+		// nothing to drop, the root partition must be grown first
+		dialog, err = common.CreateDialogOneButton(contentBox, title, utils.Locale.Get("CANCEL"), "button-cancel")
+	} else {
+		dialog, err = common.CreateDialogOkCancel(contentBox, title, okLabel, utils.Locale.Get("CANCEL"))
+		choices = append(choices, okLabel)
+		responses = append(responses, gtk.RESPONSE_OK)
+	}
 	if err != nil {
 		log.Warning("Error creating dialog")
 		return
 	}
-	_, err = dialog.Connect("response", window.dialogResponse)
+
+	// the read-write remote session clients may answer too
+	closed := false
+	answered := remote.Prompt(title, choices, func(choice int) {
+		if _, err := glib.IdleAdd(func() {
+			if !closed {
+				dialog.Response(responses[choice])
+			}
+		}); err != nil {
+			log.Warning("Error answering the remote prompt: %v", err)
+		}
+	})
+
+	_, err = dialog.Connect("response", func(msgDialog *gtk.Dialog, responseType gtk.ResponseType) {
+		closed = true
+		answered()
+		window.dialogResponse(msgDialog, responseType)
+	})
 	if err != nil {
 		log.Warning("Error connecting to dialog")
 	}
 	dialog.ShowAll()
+	if board != nil {
+		board.Start()
+	}
 	dialog.Run()
 }
 
 // dialogResponse handles the response from the dialog message
 func (window *Window) dialogResponse(msgDialog *gtk.Dialog, responseType gtk.ResponseType) {
 	if responseType == gtk.RESPONSE_OK {
+		if window.sizeProblem != nil {
+			window.sizeProblem.DropBundles(window.model)
+		}
 		window.ActivatePage(window.menu.installPage)
 	}
 	msgDialog.Destroy()
@@ -745,6 +993,11 @@ func GetWelcomeMessage() string {
 	text := "<span font-size='xx-large'>" + utils.Locale.Get("Welcome to Clear Linux* OS Desktop Installation") + "</span>"
 	if model.Version != model.DemoVersion {
 		text += "\n\n<small>" + utils.Locale.Get("VERSION %s", model.Version) + "</small>"
+		text += "\n<small>" + utils.Locale.Get("Clear Linux* OS %s", utils.ClearVersion) + "</small>"
+
+		if latestRelease != "" && latestRelease != utils.ClearVersion {
+			text += "\n<small>" + utils.Locale.Get("Latest release %s", latestRelease) + "</small>"
+		}
 	}
 
 	return text
@@ -0,0 +1,250 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package kernel
+
+import (
+	"fmt"
+	"io/ioutil"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/log"
+	"github.com/clearlinux/clr-installer/utils"
+)
+
+const (
+	// HugepageSize2M is the default huge page size of the x86_64 CPUs
+	HugepageSize2M = "2M"
+
+	// HugepageSize1G is the gigantic page size, only allocated at boot time
+	HugepageSize1G = "1G"
+
+	// HPCPresetThroughput reserves gigantic pages for the memory bound jobs
+	HPCPresetThroughput = "throughput"
+
+	// HPCPresetLowLatency reserves huge pages and isolates all but the
+	// first CPU from the scheduler and the timer ticks
+	HPCPresetLowLatency = "low-latency"
+
+	// onlineCPUsFile lists the online CPUs of the running system
+	onlineCPUsFile = "/sys/devices/system/cpu/online"
+)
+
+// HPC holds the huge pages reservation and the CPU isolation kernel
+// arguments of the high performance computing installs
+type HPC struct {
+	// HugepageSize is the size of the reserved huge pages, one of
+	// HugepageSizes, defaults to HugepageSize2M
+	HugepageSize string `yaml:"hugepageSize,omitempty,flow"`
+
+	// Hugepages is the number of huge pages reserved at boot time
+	Hugepages uint `yaml:"hugepages,omitempty,flow"`
+
+	// IsolCPUs is the list of the CPUs isolated from the scheduler, i.e "2-7"
+	IsolCPUs string `yaml:"isolcpus,omitempty,flow"`
+
+	// NohzFull is the list of the CPUs without timer ticks, i.e "2-7"
+	NohzFull string `yaml:"nohzFull,omitempty,flow"`
+}
+
+// HPCPreset is a named HPC configuration built from the CPU topology
+type HPCPreset struct {
+	Name string
+	Desc string
+}
+
+var (
+	// HugepageSizes is the list of the supported huge page sizes
+	HugepageSizes = []string{HugepageSize2M, HugepageSize1G}
+
+	// HPCPresets is the list of the supported HPC presets
+	HPCPresets = []*HPCPreset{
+		{
+			Name: HPCPresetThroughput,
+			Desc: "Gigantic pages for the memory bound jobs",
+		},
+		{
+			Name: HPCPresetLowLatency,
+			Desc: "Huge pages, all but the first CPU isolated and tickless",
+		},
+	}
+)
+
+// OnlineCPUs returns the online CPUs of the running system, the CPUs
+// known to the go runtime if the sysfs list can't be read
+func OnlineCPUs() []int {
+	content, err := ioutil.ReadFile(onlineCPUsFile)
+	if err == nil {
+		var cpus []int
+
+		if cpus, err = ParseCPUList(strings.TrimSpace(string(content))); err == nil {
+			return cpus
+		}
+	}
+
+	log.Debug("Could not read the online CPUs, using the runtime count: %s", err)
+
+	result := []int{}
+	for i := 0; i < runtime.NumCPU(); i++ {
+		result = append(result, i)
+	}
+
+	return result
+}
+
+// ParseCPUList returns the sorted CPUs of a kernel CPU list, i.e "0,2-5"
+func ParseCPUList(list string) ([]int, error) {
+	found := map[int]bool{}
+
+	for _, curr := range strings.Split(list, ",") {
+		bounds := strings.SplitN(curr, "-", 2)
+
+		first, err := strconv.Atoi(bounds[0])
+		if err != nil || first < 0 {
+			return nil, errors.ValidationErrorf("Invalid CPU list %q, i.e: 2-7 or 1,3,5", list)
+		}
+
+		last := first
+		if len(bounds) == 2 {
+			if last, err = strconv.Atoi(bounds[1]); err != nil || last < first {
+				return nil, errors.ValidationErrorf("Invalid CPU list %q, i.e: 2-7 or 1,3,5", list)
+			}
+		}
+
+		for i := first; i <= last; i++ {
+			found[i] = true
+		}
+	}
+
+	result := []int{}
+	for cpu := range found {
+		result = append(result, cpu)
+	}
+	sort.Ints(result)
+
+	return result, nil
+}
+
+// NewHPCPreset returns the configuration of the preset named name for the
+// cpus topology, nil if not supported
+func NewHPCPreset(name string, cpus []int) *HPC {
+	switch name {
+	case HPCPresetThroughput:
+		return &HPC{HugepageSize: HugepageSize1G, Hugepages: 4}
+	case HPCPresetLowLatency:
+		result := &HPC{HugepageSize: HugepageSize2M, Hugepages: 1024}
+
+		// the first CPU is kept for the housekeeping
+		if len(cpus) > 1 {
+			isolated := []string{}
+			for _, curr := range cpus[1:] {
+				isolated = append(isolated, strconv.Itoa(curr))
+			}
+
+			result.IsolCPUs = strings.Join(isolated, ",")
+			result.NohzFull = result.IsolCPUs
+		}
+
+		return result
+	}
+
+	return nil
+}
+
+// Validate checks the huge page size is supported and the CPU lists can be
+// parsed
+func (hpc *HPC) Validate() error {
+	if hpc.HugepageSize != "" && !utils.StringSliceContains(HugepageSizes, hpc.HugepageSize) {
+		return errors.ValidationErrorf("Invalid huge page size %q, must be one of: %s",
+			hpc.HugepageSize, strings.Join(HugepageSizes, ", "))
+	}
+
+	for _, curr := range []string{hpc.IsolCPUs, hpc.NohzFull} {
+		if curr == "" {
+			continue
+		}
+
+		if _, err := ParseCPUList(curr); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ValidateTopology checks the isolated and tickless CPUs exist in cpus and
+// at least one of them is left for the housekeeping
+func (hpc *HPC) ValidateTopology(cpus []int) error {
+	online := map[int]bool{}
+	for _, curr := range cpus {
+		online[curr] = true
+	}
+
+	for _, curr := range []struct {
+		name string
+		list string
+	}{
+		{"isolcpus", hpc.IsolCPUs},
+		{"nohz_full", hpc.NohzFull},
+	} {
+		if curr.list == "" {
+			continue
+		}
+
+		selected, err := ParseCPUList(curr.list)
+		if err != nil {
+			return err
+		}
+
+		for _, cpu := range selected {
+			if !online[cpu] {
+				return errors.ValidationErrorf("Invalid %s CPU %d, the system has %d CPUs", curr.name, cpu, len(cpus))
+			}
+		}
+
+		if len(selected) >= len(cpus) {
+			return errors.ValidationErrorf("Invalid %s %q, at least one CPU must be left for the housekeeping",
+				curr.name, curr.list)
+		}
+	}
+
+	return nil
+}
+
+// IsEmpty returns true if no huge page is reserved and no CPU isolated
+func (hpc *HPC) IsEmpty() bool {
+	return hpc.Hugepages == 0 && hpc.IsolCPUs == "" && hpc.NohzFull == ""
+}
+
+// KernelArguments returns the kernel arguments reserving the huge pages and
+// isolating the CPUs
+func (hpc *HPC) KernelArguments() []string {
+	result := []string{}
+
+	if hpc.Hugepages > 0 {
+		size := hpc.HugepageSize
+		if size == "" {
+			size = HugepageSize2M
+		}
+
+		result = append(result,
+			"default_hugepagesz="+size,
+			"hugepagesz="+size,
+			fmt.Sprintf("hugepages=%d", hpc.Hugepages))
+	}
+
+	if hpc.IsolCPUs != "" {
+		result = append(result, "isolcpus="+hpc.IsolCPUs)
+	}
+
+	if hpc.NohzFull != "" {
+		result = append(result, "nohz_full="+hpc.NohzFull)
+	}
+
+	return result
+}
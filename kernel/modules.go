@@ -0,0 +1,140 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package kernel
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/clearlinux/clr-installer/cmd"
+	"github.com/clearlinux/clr-installer/errors"
+)
+
+const (
+	// ModprobeConfFile is the modprobe configuration file, relative to the
+	// system root, holding the configured module blacklist and options
+	ModprobeConfFile = "etc/modprobe.d/clr-installer.conf"
+)
+
+var (
+	moduleNameExp = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+	// sysModuleDir is the sysfs directory holding the loaded modules
+	sysModuleDir = "/sys/module"
+)
+
+// ModuleOptions defines the parameters a kernel module is loaded with
+type ModuleOptions struct {
+	Name    string // Name is the kernel module name
+	Options string // Options are the module parameters, i.e "power_save=0"
+}
+
+// Modules defines the kernel modules configuration, the modules never
+// loaded automatically and the parameters modules are loaded with
+type Modules struct {
+	Blacklist []string         // Blacklist is the set of modules never loaded automatically
+	Options   []*ModuleOptions // Options is the set of module parameters
+}
+
+// Validate checks the module names and options can be written to a
+// modprobe configuration file
+func (m *Modules) Validate() error {
+	for _, curr := range m.Blacklist {
+		if !moduleNameExp.MatchString(curr) {
+			return errors.ValidationErrorf("Invalid blacklisted kernel module name: %q", curr)
+		}
+	}
+
+	for _, curr := range m.Options {
+		if !moduleNameExp.MatchString(curr.Name) {
+			return errors.ValidationErrorf("Invalid kernel module name: %q", curr.Name)
+		}
+
+		if strings.TrimSpace(curr.Options) == "" || strings.ContainsAny(curr.Options, "\n\r") {
+			return errors.ValidationErrorf("Invalid %s module options: %q", curr.Name, curr.Options)
+		}
+	}
+
+	return nil
+}
+
+// IsEmpty returns true if there's no module blacklisted nor module options
+func (m *Modules) IsEmpty() bool {
+	return len(m.Blacklist) == 0 && len(m.Options) == 0
+}
+
+// ModprobeConf returns the modprobe configuration file content
+func (m *Modules) ModprobeConf() string {
+	lines := []string{"# Generated by clr-installer"}
+
+	for _, curr := range m.Blacklist {
+		lines = append(lines, fmt.Sprintf("blacklist %s", curr))
+	}
+
+	for _, curr := range m.Options {
+		lines = append(lines, fmt.Sprintf("options %s %s", curr.Name, strings.TrimSpace(curr.Options)))
+	}
+
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// Write writes the modprobe configuration file to the system at rootDir
+func (m *Modules) Write(rootDir string) error {
+	file := filepath.Join(rootDir, ModprobeConfFile)
+
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return errors.Wrap(err)
+	}
+
+	if err := ioutil.WriteFile(file, []byte(m.ModprobeConf()), 0644); err != nil {
+		return errors.Wrap(err)
+	}
+
+	return nil
+}
+
+// Apply applies the configuration to the running system: the blacklisted
+// modules are unloaded and the loaded modules having options are reloaded
+func (m *Modules) Apply() error {
+	if err := m.Write("/"); err != nil {
+		return err
+	}
+
+	for _, curr := range m.Blacklist {
+		if !IsModuleLoaded(curr) {
+			continue
+		}
+
+		if err := cmd.RunAndLog("modprobe", "-r", curr); err != nil {
+			return errors.Wrap(err)
+		}
+	}
+
+	for _, curr := range m.Options {
+		if !IsModuleLoaded(curr.Name) {
+			continue
+		}
+
+		if err := cmd.RunAndLog("modprobe", "-r", curr.Name); err != nil {
+			return errors.Wrap(err)
+		}
+
+		if err := cmd.RunAndLog("modprobe", curr.Name); err != nil {
+			return errors.Wrap(err)
+		}
+	}
+
+	return nil
+}
+
+// IsModuleLoaded returns true if module is loaded in the running kernel
+func IsModuleLoaded(module string) bool {
+	_, err := os.Stat(filepath.Join(sysModuleDir, strings.Replace(module, "-", "_", -1)))
+	return err == nil
+}
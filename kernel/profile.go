@@ -0,0 +1,74 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package kernel
+
+import (
+	"strings"
+
+	"github.com/clearlinux/clr-installer/errors"
+)
+
+const (
+	// ProfileRealTime selects the preempt-rt kernel for the industrial
+	// deployments needing a bounded latency
+	ProfileRealTime = "realtime"
+
+	// RealTimeBundle is the bundle of the preempt-rt kernel
+	RealTimeBundle = "kernel-iot-lts2018-preempt-rt"
+)
+
+// Profile is a named kernel configuration: the kernel bundle, used when
+// available for the installed version, its kernel arguments and the sysctl
+// profile applied unless another one is configured
+type Profile struct {
+	Name          string
+	Desc          string
+	Bundle        string
+	Arguments     []string
+	SysctlProfile string
+}
+
+// Profiles is the list of the supported kernel profiles
+var Profiles = []*Profile{
+	{
+		Name:   ProfileRealTime,
+		Desc:   "Preempt-rt kernel, bounded latency for the industrial deployments",
+		Bundle: RealTimeBundle,
+		Arguments: []string{
+			"nosoftlockup",
+			"nmi_watchdog=0",
+			"skew_tick=1",
+			"processor.max_cstate=1",
+			"intel_idle.max_cstate=1",
+		},
+		SysctlProfile: SysctlProfileLowLatency,
+	},
+}
+
+// GetProfile returns the kernel profile named name, nil if not supported
+func GetProfile(name string) *Profile {
+	for _, curr := range Profiles {
+		if curr.Name == name {
+			return curr
+		}
+	}
+
+	return nil
+}
+
+// ValidateProfile checks the kernel profile is supported
+func ValidateProfile(name string) error {
+	if name == "" || GetProfile(name) != nil {
+		return nil
+	}
+
+	names := []string{}
+	for _, curr := range Profiles {
+		names = append(names, curr.Name)
+	}
+
+	return errors.ValidationErrorf("Invalid kernel profile %q, must be one of: %s",
+		name, strings.Join(names, ", "))
+}
@@ -0,0 +1,175 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package kernel
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/clearlinux/clr-installer/errors"
+)
+
+const (
+	// SysctlConfFile is the sysctl configuration file, relative to the
+	// system root, holding the configured kernel parameters
+	SysctlConfFile = "etc/sysctl.d/60-clr-installer.conf"
+
+	// SysctlProfileDesktop favors the interactive responsiveness
+	SysctlProfileDesktop = "desktop"
+
+	// SysctlProfileServer favors the network throughput and many open files
+	SysctlProfileServer = "server"
+
+	// SysctlProfileLowLatency favors the latency over the throughput and power
+	SysctlProfileLowLatency = "low-latency"
+)
+
+// SysctlProfile is a named set of kernel parameters
+type SysctlProfile struct {
+	Name     string
+	Desc     string
+	Settings map[string]string
+}
+
+var (
+	// SysctlProfiles is the list of the supported sysctl tuning profiles
+	SysctlProfiles = []*SysctlProfile{
+		{
+			Name: SysctlProfileDesktop,
+			Desc: "Responsive desktop, less swapping",
+			Settings: map[string]string{
+				"vm.swappiness":                  "10",
+				"vm.vfs_cache_pressure":          "50",
+				"kernel.sched_autogroup_enabled": "1",
+			},
+		},
+		{
+			Name: SysctlProfileServer,
+			Desc: "Network services with many connections and open files",
+			Settings: map[string]string{
+				"fs.file-max":                  "2097152",
+				"net.core.somaxconn":           "4096",
+				"net.ipv4.tcp_max_syn_backlog": "4096",
+				"net.ipv4.tcp_fin_timeout":     "15",
+			},
+		},
+		{
+			Name: SysctlProfileLowLatency,
+			Desc: "Low latency workloads, at the expense of throughput and power",
+			Settings: map[string]string{
+				"vm.swappiness":          "1",
+				"vm.stat_interval":       "10",
+				"kernel.timer_migration": "0",
+				"net.core.busy_poll":     "50",
+				"net.core.busy_read":     "50",
+			},
+		},
+	}
+
+	// sysctlKeyExp matches the sysctl keys, dot or slash separated, i.e
+	// "net.ipv4.conf.eth0.rp_filter" or "net/ipv4/ip_forward"
+	sysctlKeyExp = regexp.MustCompile(`^[a-zA-Z0-9_-]+([./][a-zA-Z0-9_:@*-]+)+$`)
+)
+
+// GetSysctlProfile returns the sysctl profile named name, nil if not supported
+func GetSysctlProfile(name string) *SysctlProfile {
+	for _, curr := range SysctlProfiles {
+		if curr.Name == name {
+			return curr
+		}
+	}
+
+	return nil
+}
+
+// ValidateSysctl checks the sysctl profile is supported and the settings
+// keys and values can be written to a sysctl configuration file
+func ValidateSysctl(profile string, settings map[string]string) error {
+	if profile != "" && GetSysctlProfile(profile) == nil {
+		names := []string{}
+		for _, curr := range SysctlProfiles {
+			names = append(names, curr.Name)
+		}
+
+		return errors.ValidationErrorf("Invalid sysctl profile %q, must be one of: %s",
+			profile, strings.Join(names, ", "))
+	}
+
+	for key, value := range settings {
+		if !sysctlKeyExp.MatchString(key) {
+			return errors.ValidationErrorf("Invalid sysctl key: %q", key)
+		}
+
+		if strings.TrimSpace(value) == "" || strings.ContainsAny(value, "\n\r") {
+			return errors.ValidationErrorf("Invalid sysctl %s value: %q", key, value)
+		}
+	}
+
+	return nil
+}
+
+// SysctlSettings returns the profile settings overridden by settings
+func SysctlSettings(profile string, settings map[string]string) map[string]string {
+	result := map[string]string{}
+
+	if pr := GetSysctlProfile(profile); pr != nil {
+		for key, value := range pr.Settings {
+			result[key] = value
+		}
+	}
+
+	for key, value := range settings {
+		result[key] = value
+	}
+
+	return result
+}
+
+// SysctlConf returns the sysctl configuration file content, sorted by key
+func SysctlConf(profile string, settings map[string]string) string {
+	merged := SysctlSettings(profile, settings)
+
+	keys := []string{}
+	for key := range merged {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	lines := []string{"# Generated by clr-installer"}
+	if profile != "" {
+		lines = append(lines, fmt.Sprintf("# Profile: %s", profile))
+	}
+
+	for _, key := range keys {
+		lines = append(lines, fmt.Sprintf("%s = %s", key, strings.TrimSpace(merged[key])))
+	}
+
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// WriteSysctl writes the sysctl configuration file to the system at rootDir,
+// nothing is written if there is no profile nor settings
+func WriteSysctl(rootDir string, profile string, settings map[string]string) error {
+	if profile == "" && len(settings) == 0 {
+		return nil
+	}
+
+	file := filepath.Join(rootDir, SysctlConfFile)
+
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return errors.Wrap(err)
+	}
+
+	if err := ioutil.WriteFile(file, []byte(SysctlConf(profile, settings)), 0644); err != nil {
+		return errors.Wrap(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,126 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package kernel
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/clearlinux/clr-installer/errors"
+)
+
+const (
+	// UdevRulesDir is the directory, relative to the system root, holding
+	// the local udev rules
+	UdevRulesDir = "etc/udev/rules.d"
+)
+
+var (
+	// udevRuleNameExp matches a rules file name, i.e 70-can-bus.rules
+	udevRuleNameExp = regexp.MustCompile(`^[A-Za-z0-9_.@+-]+\.rules$`)
+
+	// udevKeyExp matches the next key of a rule, i.e ATTR{address}=="aa:bb"
+	udevKeyExp = regexp.MustCompile(`^\s*[A-Z_]+(\{[^{}"]*\})?\s*(==|!=|\+=|-=|:=|=)\s*"(?:[^"\\]|\\.)*"\s*`)
+)
+
+// UdevRule is a udev rules file installed as is to the target, i.e the
+// persistent names of the NICs or the permissions of a serial adapter
+type UdevRule struct {
+	Name    string `yaml:"name,omitempty,flow"`    // Name is the rules file name
+	Content string `yaml:"content,omitempty,flow"` // Content are the rules
+}
+
+// validateUdevLine checks line is a comma separated list of udev keys
+func validateUdevLine(line string) bool {
+	for {
+		loc := udevKeyExp.FindStringIndex(line)
+		if loc == nil {
+			return false
+		}
+
+		line = line[loc[1]:]
+		if line == "" {
+			return true
+		}
+
+		if line[0] != ',' {
+			return false
+		}
+		line = line[1:]
+	}
+}
+
+// Validate checks the file name and the syntax of the rules
+func (r *UdevRule) Validate() error {
+	if !udevRuleNameExp.MatchString(r.Name) {
+		return errors.ValidationErrorf("Invalid udev rules file name %q, i.e: 70-local.rules", r.Name)
+	}
+
+	if strings.TrimSpace(r.Content) == "" {
+		return errors.ValidationErrorf("The udev rules file %s is empty", r.Name)
+	}
+
+	// a rule is continued by a trailing backslash
+	content := strings.Replace(r.Content, "\\\n", "", -1)
+
+	for i, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if !validateUdevLine(line) {
+			return errors.ValidationErrorf("Invalid udev rule %s:%d: %q", r.Name, i+1, line)
+		}
+	}
+
+	return nil
+}
+
+// ValidateUdevRules checks the rules files and that their names are unique
+func ValidateUdevRules(rules []*UdevRule) error {
+	seen := map[string]bool{}
+
+	for _, curr := range rules {
+		if err := curr.Validate(); err != nil {
+			return err
+		}
+
+		if seen[curr.Name] {
+			return errors.ValidationErrorf("The udev rules file %s is declared more than once", curr.Name)
+		}
+		seen[curr.Name] = true
+	}
+
+	return nil
+}
+
+// WriteUdevRules writes the rules files to the system at rootDir
+func WriteUdevRules(rootDir string, rules []*UdevRule) error {
+	if len(rules) == 0 {
+		return nil
+	}
+
+	dir := filepath.Join(rootDir, UdevRulesDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return errors.Wrap(err)
+	}
+
+	for _, curr := range rules {
+		content := curr.Content
+		if !strings.HasSuffix(content, "\n") {
+			content = content + "\n"
+		}
+
+		if err := ioutil.WriteFile(filepath.Join(dir, curr.Name), []byte(content), 0644); err != nil {
+			return errors.Wrap(err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,312 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package kernel
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/clearlinux/clr-installer/cmd"
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/log"
+	"github.com/clearlinux/clr-installer/utils"
+)
+
+const (
+	// UKIScriptFile builds the unified kernel images of the target, it's
+	// outside of /usr so swupd leaves it alone
+	UKIScriptFile = "/usr/local/sbin/clr-installer-uki"
+
+	// UKIService runs UKIScriptFile after the updates, once clr-boot-manager
+	// installed the new kernels
+	UKIService = "clr-installer-uki.service"
+
+	// UKIKeyFile and UKICertFile are where the administrator provisions the
+	// target's own signing key and certificate, the updated kernels are
+	// signed with them. The installer only writes them with PersistKey.
+	UKIKeyFile  = "/etc/clr-installer/uki/db.key"
+	UKICertFile = "/etc/clr-installer/uki/db.crt"
+
+	// ukiInstallDir holds the signing key and certificate while the images
+	// are built at install time, it's a tmpfs so the key never hits the disk
+	ukiInstallDir = "/run/clr-installer-uki"
+
+	// UKIBundle provides objcopy, used to assemble the unified kernel images
+	UKIBundle = "binutils"
+
+	// UKISigningBundle provides sbsign, used to sign the unified kernel images
+	UKISigningBundle = "sbsigntools"
+
+	// ukiServiceDir is the systemd units directory of the target
+	ukiServiceDir = "/etc/systemd/system"
+
+	// ukiUpdateTarget is started by swupd once an update is installed
+	ukiUpdateTarget = "update-triggers.target"
+
+	ukiServiceUnit = `[Unit]
+Description=Build the unified kernel images
+After=clr-boot-manager.service
+
+[Service]
+Type=oneshot
+ExecStart=%s
+
+[Install]
+WantedBy=%s
+`
+
+	// ukiScript assembles a unified kernel image of each Clear Linux boot
+	// entry written by clr-boot-manager, the image replaces the entry
+	ukiScript = `#!/bin/sh
+# Generated by clr-installer, builds the unified kernel images of the boot
+# entries written by clr-boot-manager, signed with KEY and CERT if given or
+# with the key provisioned for this machine
+set -e
+
+stub=/usr/lib/systemd/boot/efi/linuxx64.efi.stub
+key=${1:-%s}
+cert=${2:-%s}
+signed=%s
+unmount=
+
+if [ -n "$signed" ] && [ ! -f "$key" ]; then
+	echo "No secure boot signing key in $key, provision the key of this machine to build the updated unified kernel images" >&2
+	exit 0
+fi
+
+if [ ! -d /boot/loader ]; then
+	clr-boot-manager mount-boot
+	unmount=1
+fi
+
+mkdir -p /boot/EFI/Linux
+rm -f /boot/EFI/Linux/Clear-linux-*.efi
+
+for entry in /boot/loader/entries/Clear-linux-*.conf; do
+	[ -f "$entry" ] || continue
+
+	name=$(basename "$entry" .conf)
+	work=$(mktemp -d)
+
+	linux=$(sed -n 's/^linux[[:space:]]\+//p' "$entry")
+	sed -n 's/^options[[:space:]]\+//p' "$entry" > "$work/cmdline"
+
+	touch "$work/initrd"
+	for initrd in $(sed -n 's/^initrd[[:space:]]\+//p' "$entry"); do
+		cat "/boot$initrd" >> "$work/initrd"
+	done
+
+	set --
+	if [ -s "$work/initrd" ]; then
+		set -- --add-section .initrd="$work/initrd" --change-section-vma .initrd=0x3000000
+	fi
+
+	objcopy \
+		--add-section .osrel=/usr/lib/os-release --change-section-vma .osrel=0x20000 \
+		--add-section .cmdline="$work/cmdline" --change-section-vma .cmdline=0x30000 \
+		--add-section .linux="/boot$linux" --change-section-vma .linux=0x2000000 \
+		"$@" "$stub" "$work/$name.efi"
+
+	if [ -f "$key" ]; then
+		sbsign --key "$key" --cert "$cert" --output "/boot/EFI/Linux/$name.efi" "$work/$name.efi"
+	else
+		cp "$work/$name.efi" "/boot/EFI/Linux/$name.efi"
+	fi
+
+	rm -rf "$work" "$entry"
+done
+
+if [ -f /boot/loader/loader.conf ]; then
+	sed -i 's/^default Clear-linux-.*/default Clear-linux-*/' /boot/loader/loader.conf
+fi
+
+if [ -n "$unmount" ]; then
+	umount /boot
+fi
+`
+)
+
+// UKI configures the unified kernel images: the kernel, initrd and kernel
+// command line in a single EFI binary, signed for the secure boot
+type UKI struct {
+	// Enabled builds the unified kernel images at install time and after
+	// every update
+	Enabled bool `yaml:"enabled,omitempty,flow"`
+
+	// SigningKey is a secret reference to the PEM signing key, see
+	// utils.ReadSecret; the images are not signed if unset
+	SigningKey string `yaml:"signingKey,omitempty,flow"`
+
+	// SigningCert is the PEM file of the signing certificate
+	SigningCert string `yaml:"signingCert,omitempty,flow"`
+
+	// PersistKey copies the signing key to the target so the updated kernels
+	// are signed with it. Root on the target can then sign binaries trusted
+	// by every machine enrolling the key; by default the key is only used
+	// at install time and the administrator provisions a per-machine key
+	// in UKIKeyFile for the updates.
+	PersistKey bool `yaml:"persistKey,omitempty,flow"`
+}
+
+// Validate checks the signing key and certificate are both set and the key
+// is a secret reference, the secret is only read when installing
+func (uki *UKI) Validate() error {
+	if (uki.SigningKey == "") != (uki.SigningCert == "") {
+		return errors.ValidationErrorf("The unified kernel image signing key and certificate must be set together")
+	}
+
+	if uki.SigningKey != "" && !strings.HasPrefix(uki.SigningKey, "env:") &&
+		!strings.HasPrefix(uki.SigningKey, "file:") {
+		return errors.ValidationErrorf("Invalid secret reference %q, expected env:NAME or file:PATH", uki.SigningKey)
+	}
+
+	if uki.PersistKey && uki.SigningKey == "" {
+		return errors.ValidationErrorf("The unified kernel image signing key must be set to persist it")
+	}
+
+	return nil
+}
+
+// RequiredBundles returns the bundles building and signing the images
+func (uki *UKI) RequiredBundles() []string {
+	if uki.SigningKey != "" {
+		return []string{UKIBundle, UKISigningBundle}
+	}
+
+	return []string{UKIBundle}
+}
+
+// WriteUKIConfig writes to rootDir the script building the unified kernel
+// images and the service running the script after the updates, the signing
+// key and certificate are only copied with PersistKey
+func WriteUKIConfig(rootDir string, uki *UKI) error {
+	if uki.PersistKey {
+		log.Warning("Persisting the secure boot signing key to the target, root on the " +
+			"target can sign binaries trusted by every machine enrolling it")
+
+		if err := writeUKIKey(rootDir, UKIKeyFile, UKICertFile, uki); err != nil {
+			return err
+		}
+	}
+
+	signed := ""
+	if uki.SigningKey != "" {
+		signed = "1"
+	}
+
+	script := fmt.Sprintf(ukiScript, UKIKeyFile, UKICertFile, signed)
+	if err := writeUKIFile(rootDir, UKIScriptFile, script, 0755); err != nil {
+		return err
+	}
+
+	unit := fmt.Sprintf(ukiServiceUnit, UKIScriptFile, ukiUpdateTarget)
+	if err := writeUKIFile(rootDir, filepath.Join(ukiServiceDir, UKIService), unit, 0644); err != nil {
+		return err
+	}
+
+	// the same as "systemctl enable", without a target systemctl
+	wantsDir := filepath.Join(rootDir, ukiServiceDir, ukiUpdateTarget+".wants")
+	if err := utils.MkdirAll(wantsDir, 0755); err != nil {
+		return err
+	}
+
+	link := filepath.Join(wantsDir, UKIService)
+	if err := os.Remove(link); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err)
+	}
+
+	if err := os.Symlink(filepath.Join(ukiServiceDir, UKIService), link); err != nil {
+		return errors.Wrap(err)
+	}
+
+	return nil
+}
+
+// writeUKIKey writes the signing key and certificate of uki to the keyFile
+// and certFile of rootDir
+func writeUKIKey(rootDir string, keyFile string, certFile string, uki *UKI) error {
+	key, err := utils.ReadSecret(uki.SigningKey)
+	if err != nil {
+		return err
+	}
+
+	cert, err := ioutil.ReadFile(uki.SigningCert)
+	if err != nil {
+		return errors.Wrap(err)
+	}
+
+	if err = writeUKIFile(rootDir, keyFile, string(key), 0600); err != nil {
+		return err
+	}
+
+	return writeUKIFile(rootDir, certFile, string(cert), 0644)
+}
+
+// writeUKIFile writes content to the file of rootDir with mode
+func writeUKIFile(rootDir string, file string, content string, mode os.FileMode) error {
+	path := filepath.Join(rootDir, file)
+
+	if err := utils.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(path, []byte(content), mode); err != nil {
+		return errors.Wrap(err)
+	}
+
+	// WriteFile doesn't change the mode of an existing file
+	if err := os.Chmod(path, mode); err != nil {
+		return errors.Wrap(err)
+	}
+
+	return nil
+}
+
+// GenerateUKI builds the unified kernel images of rootDir, from a chroot so
+// the target tools and boot stub are used. The images are signed with the
+// key of uki, only exposed to the chroot from a tmpfs while signing.
+func GenerateUKI(rootDir string, uki *UKI) error {
+	if uki.SigningKey == "" || uki.PersistKey {
+		if err := cmd.RunAndLog("chroot", rootDir, UKIScriptFile); err != nil {
+			return errors.Wrap(err)
+		}
+
+		return nil
+	}
+
+	dir := filepath.Join(rootDir, ukiInstallDir)
+	if err := utils.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	if err := syscall.Mount("tmpfs", dir, "tmpfs", 0, "mode=0700"); err != nil {
+		return errors.Errorf("mount tmpfs %s: %v", dir, err)
+	}
+
+	defer func() {
+		if err := syscall.Unmount(dir, 0); err != nil {
+			log.Warning("Failed to unmount %s: %v", dir, err)
+			return
+		}
+
+		_ = os.Remove(dir)
+	}()
+
+	keyFile := filepath.Join(ukiInstallDir, "db.key")
+	certFile := filepath.Join(ukiInstallDir, "db.crt")
+	if err := writeUKIKey(rootDir, keyFile, certFile, uki); err != nil {
+		return err
+	}
+
+	if err := cmd.RunAndLog("chroot", rootDir, UKIScriptFile, keyFile, certFile); err != nil {
+		return errors.Wrap(err)
+	}
+
+	return nil
+}
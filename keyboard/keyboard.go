@@ -18,6 +18,7 @@ import (
 type Keymap struct {
 	Code        string
 	userDefined bool
+	suggested   bool
 }
 
 const (
@@ -32,12 +33,65 @@ const (
 // validKeyboards stores the list of all valid, known keyboards
 var validKeyboards []*Keymap
 
+// localeKeymaps are the keymaps most likely used with a locale, the most
+// likely first; a locale not listed falls back to its language entry
+var localeKeymaps = map[string][]string{
+	"be":    {"be-latin1"},
+	"cs":    {"cz", "cz-qwerty"},
+	"da":    {"dk", "dk-latin1"},
+	"de":    {"de-latin1", "de", "de-latin1-nodeadkeys"},
+	"de_AT": {"de-latin1", "de"},
+	"de_CH": {"de_CH-latin1", "ch"},
+	"el":    {"gr", "us"},
+	"en":    {"us"},
+	"en_CA": {"us", "cf"},
+	"en_GB": {"uk", "gb"},
+	"en_IE": {"ie", "uk"},
+	"es":    {"es", "es-cp850"},
+	"es_MX": {"la-latin1", "es"},
+	"es_AR": {"la-latin1", "es"},
+	"fi":    {"fi", "fi-latin1"},
+	"fr":    {"fr-latin9", "fr", "fr-latin1"},
+	"fr_BE": {"be-latin1", "fr"},
+	"fr_CA": {"cf", "ca", "us"},
+	"fr_CH": {"fr_CH-latin1", "fr_CH"},
+	"hu":    {"hu", "hu101"},
+	"it":    {"it", "it2"},
+	"ja":    {"jp106", "us"},
+	"ko":    {"kr", "us"},
+	"nb":    {"no", "no-latin1"},
+	"nl":    {"nl", "us"},
+	"nl_BE": {"be-latin1", "nl"},
+	"pl":    {"pl2", "pl"},
+	"pt":    {"pt-latin1", "pt-latin9"},
+	"pt_BR": {"br-abnt2", "br-latin1-abnt2", "us-acentos"},
+	"ro":    {"ro", "ro_std"},
+	"ru":    {"ru", "us"},
+	"sk":    {"sk-qwertz", "sk-qwerty"},
+	"sv":    {"se-lat6", "sv-latin1"},
+	"tr":    {"trq", "trf"},
+	"uk":    {"ua-utf", "ua"},
+	"zh":    {"us"},
+}
+
 // IsUserDefined returns true if the configuration was interactively
 // defined by the user
 func (k *Keymap) IsUserDefined() bool {
 	return k.userDefined
 }
 
+// IsSuggested returns true if the keymap was suggested for the target
+// locale rather than picked by the user or loaded from a config
+func (k *Keymap) IsSuggested() bool {
+	return k.suggested
+}
+
+// AsUserDefined returns a copy of k marked as interactively defined by
+// the user
+func (k *Keymap) AsUserDefined() *Keymap {
+	return &Keymap{Code: k.Code, userDefined: true}
+}
+
 // MarshalYAML marshals Keymap into YAML format
 func (k *Keymap) MarshalYAML() (interface{}, error) {
 	return k.Code, nil
@@ -136,3 +190,42 @@ func SetTargetKeyboard(rootDir string, keyboard string) error {
 
 	return nil
 }
+
+// SuggestedCodes returns the codes of the keymaps most likely used with
+// locale, the most likely first, nil if the locale is unknown
+func SuggestedCodes(locale string) []string {
+	code := strings.Split(locale, ".")[0]
+
+	if codes, ok := localeKeymaps[code]; ok {
+		return codes
+	}
+
+	return localeKeymaps[strings.Split(code, "_")[0]]
+}
+
+// Suggest returns the available keymaps most likely used with locale, the
+// most likely first; the suggestions are not filtered if the system keymaps
+// can't be listed
+func Suggest(locale string) []*Keymap {
+	result := []*Keymap{}
+	codes := SuggestedCodes(locale)
+
+	kmaps, err := LoadKeymaps()
+	if err != nil || len(kmaps) == 0 {
+		for _, code := range codes {
+			result = append(result, &Keymap{Code: code, suggested: true})
+		}
+		return result
+	}
+
+	for _, code := range codes {
+		for _, curr := range kmaps {
+			if curr.Code == code {
+				result = append(result, &Keymap{Code: code, suggested: true})
+				break
+			}
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,146 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package keyboard
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/utils"
+)
+
+const (
+	// OptionCompose is the XKB option of the compose key on the right Alt
+	OptionCompose = "compose:ralt"
+
+	// OptionCapsAsCtrl is the XKB option of the Caps Lock as another Ctrl
+	OptionCapsAsCtrl = "ctrl:nocaps"
+
+	// x11ConfigFile is the X11 keyboard configuration of the target, the
+	// one written by localectl set-x11-keymap
+	x11ConfigFile = "etc/X11/xorg.conf.d/00-keyboard.conf"
+)
+
+var (
+	// x11NameExp matches a comma separated list of XKB layouts, variants or
+	// a model; the variants of a multi layout may be empty
+	x11NameExp = regexp.MustCompile(`^[A-Za-z0-9_-]*(,[A-Za-z0-9_-]*)*$`)
+
+	// x11OptionExp matches a XKB option, i.e: compose:ralt
+	x11OptionExp = regexp.MustCompile(`^[a-z0-9_]+:[A-Za-z0-9_]+$`)
+)
+
+// X11Keymap is the X11 keyboard of the target, it may differ from the console
+// keymap; the values are the XKB ones, i.e: layout "de" variant "nodeadkeys"
+type X11Keymap struct {
+	Layout  string   `yaml:"layout,omitempty"`
+	Variant string   `yaml:"variant,omitempty"`
+	Model   string   `yaml:"model,omitempty"`
+	Options []string `yaml:"options,omitempty,flow"`
+}
+
+// Validate checks the XKB values of k, a layout is required
+func (k *X11Keymap) Validate() error {
+	if k.Layout == "" || strings.Contains(k.Layout, ",,") || !x11NameExp.MatchString(k.Layout) {
+		return errors.ValidationErrorf("Invalid X11 keyboard layout %q, i.e: de or us,ru", k.Layout)
+	}
+
+	if !x11NameExp.MatchString(k.Variant) {
+		return errors.ValidationErrorf("Invalid X11 keyboard variant %q, i.e: nodeadkeys", k.Variant)
+	}
+
+	if strings.Contains(k.Model, ",") || !x11NameExp.MatchString(k.Model) {
+		return errors.ValidationErrorf("Invalid X11 keyboard model %q, i.e: pc105", k.Model)
+	}
+
+	for _, curr := range k.Options {
+		if !x11OptionExp.MatchString(curr) {
+			return errors.ValidationErrorf("Invalid X11 keyboard option %q, i.e: %s", curr, OptionCompose)
+		}
+	}
+
+	return nil
+}
+
+// HasOption returns true if the XKB option is set
+func (k *X11Keymap) HasOption(option string) bool {
+	return utils.StringSliceContains(k.Options, option)
+}
+
+// SetOption adds or removes the XKB option, the other options are kept
+func (k *X11Keymap) SetOption(option string, enabled bool) {
+	options := []string{}
+	for _, curr := range k.Options {
+		if curr != option {
+			options = append(options, curr)
+		}
+	}
+
+	if enabled {
+		options = append(options, option)
+	}
+
+	k.Options = options
+}
+
+// IsEmpty returns true if k configures nothing
+func (k *X11Keymap) IsEmpty() bool {
+	return k.Layout == "" && k.Variant == "" && k.Model == "" && len(k.Options) == 0
+}
+
+// String returns the summary of k, i.e: de (nodeadkeys)
+func (k *X11Keymap) String() string {
+	result := k.Layout
+	if k.Variant != "" {
+		result = fmt.Sprintf("%s (%s)", result, k.Variant)
+	}
+
+	if len(k.Options) > 0 {
+		result = result + " " + strings.Join(k.Options, ",")
+	}
+
+	return result
+}
+
+// SetTargetX11Keyboard writes the X11 keyboard configuration of the target,
+// localectl can't reach the target so the file is written the way it does
+func SetTargetX11Keyboard(rootDir string, k *X11Keymap) error {
+	lines := []string{
+		"# Written by clr-installer",
+		`Section "InputClass"`,
+		`        Identifier "system-keyboard"`,
+		`        MatchIsKeyboard "on"`,
+		fmt.Sprintf(`        Option "XkbLayout" "%s"`, k.Layout),
+	}
+
+	if k.Model != "" {
+		lines = append(lines, fmt.Sprintf(`        Option "XkbModel" "%s"`, k.Model))
+	}
+
+	if k.Variant != "" {
+		lines = append(lines, fmt.Sprintf(`        Option "XkbVariant" "%s"`, k.Variant))
+	}
+
+	if len(k.Options) > 0 {
+		lines = append(lines, fmt.Sprintf(`        Option "XkbOptions" "%s"`, strings.Join(k.Options, ",")))
+	}
+
+	lines = append(lines, "EndSection", "")
+
+	file := filepath.Join(rootDir, x11ConfigFile)
+	if err := utils.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(file, []byte(strings.Join(lines, "\n")), 0644); err != nil {
+		return errors.Wrap(err)
+	}
+
+	return nil
+}
@@ -14,6 +14,7 @@ import (
 
 	"github.com/clearlinux/clr-installer/cmd"
 	"github.com/clearlinux/clr-installer/log"
+	"github.com/clearlinux/clr-installer/utils"
 
 	"golang.org/x/text/language"
 	"golang.org/x/text/language/display"
@@ -98,6 +99,32 @@ func (l *Language) GetConfValues() (string, string) {
 	return name, l.Code
 }
 
+// Group returns the name of l's base language, i.e "English" for both en_US
+// and en_GB, the languages of a selection list are grouped by it
+func (l *Language) Group() string {
+	base, _ := l.Tag.Base()
+
+	if name := displayLanguage.Languages().Name(base); name != "" {
+		return name
+	}
+
+	return base.String()
+}
+
+// less sorts the languages by group then by description, following the
+// collation order rather than the byte order
+func (l *Language) less(other *Language) bool {
+	lGroup, oGroup := l.Group(), other.Group()
+	if utils.CollationKey(lGroup) != utils.CollationKey(oGroup) {
+		return utils.CollateLess(lGroup, oGroup)
+	}
+
+	lDesc, _ := l.GetConfValues()
+	oDesc, _ := other.GetConfValues()
+
+	return utils.CollateLess(lDesc, oDesc)
+}
+
 // MarshalYAML marshals Language into YAML format
 func (l *Language) MarshalYAML() (interface{}, error) {
 	return l.Code, nil
@@ -194,7 +221,9 @@ func Load() ([]*Language, error) {
 			sortedKeys = append(sortedKeys, k)
 		}
 	}
-	sort.Strings(sortedKeys)
+	sort.Slice(sortedKeys, func(i, j int) bool {
+		return uniqLang[sortedKeys[i]].less(uniqLang[sortedKeys[j]])
+	})
 
 	for _, value := range sortedKeys {
 		validLanguages = append(validLanguages, uniqLang[value])
@@ -305,3 +305,210 @@ func TestGetPreConfFile(t *testing.T) {
 func TestRequestCrashInfo(t *testing.T) {
 	RequestCrashInfo()
 }
+
+func setRunLog(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "clr-installer-log-")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = SetOutputFilename(filepath.Join(dir, "test.log")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = StartRun(); err != nil {
+		t.Fatal(err)
+	}
+
+	return dir
+}
+
+func readTaskLog(t *testing.T, file string) string {
+	content, err := ioutil.ReadFile(filepath.Join(GetRunDir(), file))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(content)
+}
+
+func TestTaskLogs(t *testing.T) {
+	dir := setRunLog(t)
+	defer func() {
+		EndRun()
+		_ = os.RemoveAll(dir)
+	}()
+
+	if !strings.HasPrefix(filepath.Base(GetRunDir()), RunDirPrefix) {
+		t.Fatalf("Unexpected run directory: %s", GetRunDir())
+	}
+
+	SetLogLevel(LogLevelInfo)
+	Info("before any task")
+
+	partitioning := TaskWriter("partitioning")
+	swupd := TaskWriter("swupd")
+
+	BeginTask("partitioning")
+	fmt.Fprintln(partitioning, "partitioning line")
+	BeginTask("partitioning")
+	fmt.Fprint(partitioning, "second disk line\nthird disk line\n")
+	EndTask("partitioning", nil)
+
+	// swupd runs concurrently, only the lines written to a task are in its
+	// log file
+	BeginTask("swupd")
+	fmt.Fprintln(swupd, "swupd line")
+	Info("concurrent line")
+	fmt.Fprintln(partitioning, "partitioning command line")
+	EndTask("swupd", nil)
+	EndTask("partitioning", errors.Errorf("format failed"))
+
+	fmt.Fprintln(swupd, "swupd ended line")
+
+	BeginTask("hooks/post-install")
+	TaskPrintf("hooks/post-install", "hook: %s", "hook line")
+	EndTask("hooks/post-install", nil)
+
+	Info("after the tasks")
+
+	content := readTaskLog(t, "partitioning.log")
+	for _, curr := range []string{"partitioning line", "second disk line", "third disk line",
+		"partitioning command line", "format failed"} {
+		if !strings.Contains(content, curr) {
+			t.Fatalf("partitioning.log should contain %q: %s", curr, content)
+		}
+	}
+
+	for _, curr := range []string{"before any task", "swupd line", "concurrent line", "after the tasks"} {
+		if strings.Contains(content, curr) {
+			t.Fatalf("partitioning.log should not contain %q: %s", curr, content)
+		}
+	}
+
+	content = readTaskLog(t, "swupd.log")
+	if !strings.Contains(content, "swupd line") || strings.Contains(content, "concurrent line") ||
+		strings.Contains(content, "partitioning") || strings.Contains(content, "swupd ended line") {
+		t.Fatalf("Unexpected swupd.log: %s", content)
+	}
+
+	if hook := readTaskLog(t, "hooks/post-install.log"); !strings.Contains(hook, "hook: hook line") {
+		t.Fatalf("Unexpected hooks/post-install.log: %s", hook)
+	}
+
+	// the task lines are logged with the debug level, the hook ones are not
+	if str := readLog(t).String(); strings.Contains(str, "swupd line") || strings.Contains(str, "hook line") {
+		t.Fatalf("The log file should not contain the task lines: %s", str)
+	}
+
+	SetLogLevel(LogLevelDebug)
+	fmt.Fprintln(swupd, "debug line")
+	if str := readLog(t).String(); !strings.Contains(str, "debug line") {
+		t.Fatalf("The log file should contain the task debug lines: %s", str)
+	}
+
+	index, err := ReadIndex(GetRunDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []struct {
+		name   string
+		file   string
+		status string
+	}{
+		{"partitioning", "partitioning.log", TaskFailed},
+		{"swupd", "swupd.log", TaskSucceeded},
+		{"hooks/post-install", "hooks/post-install.log", TaskSucceeded},
+	}
+
+	if len(index) != len(expected) {
+		t.Fatalf("Expected %d index entries, got: %d", len(expected), len(index))
+	}
+
+	for i, curr := range expected {
+		entry := index[i]
+		if entry.Name != curr.name || entry.File != curr.file || entry.Status != curr.status {
+			t.Fatalf("Expected %s %s %s, got: %+v", curr.name, curr.file, curr.status, entry)
+		}
+
+		if entry.End.Before(entry.Start) {
+			t.Fatalf("The %s task ends before its start", entry.Name)
+		}
+	}
+}
+
+func TestEndRunFailsRunningTasks(t *testing.T) {
+	dir := setRunLog(t)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	runDir := GetRunDir()
+	BeginTask("swupd")
+	EndRun()
+
+	if GetRunDir() != "" {
+		t.Fatal("The run directory should be reset")
+	}
+
+	// no longer logged
+	BeginTask("partitioning")
+	EndTask("partitioning", nil)
+
+	index, err := ReadIndex(runDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(index) != 1 || index[0].Status != TaskFailed {
+		t.Fatalf("The interrupted swupd task should be failed: %+v", index)
+	}
+}
+
+func TestExportTasks(t *testing.T) {
+	dir := setRunLog(t)
+	defer func() {
+		EndRun()
+		_ = os.RemoveAll(dir)
+	}()
+
+	for _, curr := range []string{"partitioning", "swupd", "hooks/pre-install"} {
+		BeginTask(curr)
+		TaskPrintf(curr, "%s line", curr)
+		EndTask(curr, nil)
+	}
+
+	dest := filepath.Join(dir, "export")
+	if err := ExportTasks(dest, []string{"swupd", "hooks/pre-install"}); err != nil {
+		t.Fatal(err)
+	}
+
+	index, err := ReadIndex(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(index) != 2 || index[0].Name != "swupd" || index[1].Name != "hooks/pre-install" {
+		t.Fatalf("Unexpected exported index: %+v", index)
+	}
+
+	for _, curr := range []string{"swupd.log", "hooks/pre-install.log"} {
+		if _, err = os.Stat(filepath.Join(dest, curr)); err != nil {
+			t.Fatalf("%s should be exported: %v", curr, err)
+		}
+	}
+
+	if _, err = os.Stat(filepath.Join(dest, "partitioning.log")); !os.IsNotExist(err) {
+		t.Fatal("partitioning.log should not be exported")
+	}
+}
+
+func TestNoRun(t *testing.T) {
+	EndRun()
+
+	BeginTask("swupd")
+	EndTask("swupd", nil)
+
+	if err := ExportTasks(os.TempDir(), nil); err == nil {
+		t.Fatal("Exporting without a run should fail")
+	}
+}
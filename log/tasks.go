@@ -0,0 +1,317 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package log
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/utils"
+)
+
+const (
+	// RunDirPrefix is the prefix of the run directory created next to the
+	// log file, the task log files of an install are written to it
+	RunDirPrefix = "clr-installer-run-"
+
+	// IndexFile is the run directory index of the task log files
+	IndexFile = "index.json"
+
+	// TaskRunning is the status of a task not completed yet
+	TaskRunning = "running"
+
+	// TaskSucceeded is the status of a successfully completed task
+	TaskSucceeded = "success"
+
+	// TaskFailed is the status of a failed task
+	TaskFailed = "failed"
+)
+
+// TaskEntry is the index entry of a task log file
+type TaskEntry struct {
+	Name   string    `json:"name"`
+	File   string    `json:"file"`
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+	Status string    `json:"status"`
+}
+
+// taskLog is a task log file, a task may be begun multiple times: i.e the
+// partitioning of each target media, its file is closed once all have ended
+type taskLog struct {
+	entry  *TaskEntry
+	file   *os.File
+	logger *log.Logger
+	count  int
+	failed bool
+}
+
+var (
+	runDir     string
+	runIndex   []*TaskEntry
+	runTasks   = map[string]*taskLog{}
+	tasksMutex = &sync.Mutex{}
+)
+
+// StartRun creates a new run directory next to the log file, the tasks begun
+// from now on are logged to their own file in it besides the log file
+func StartRun() error {
+	if logFileName == "" {
+		return errors.Errorf("Log output should be set, see log.SetOutputFilename()")
+	}
+
+	EndRun()
+
+	dir := filepath.Join(filepath.Dir(logFileName),
+		RunDirPrefix+time.Now().Format("20060102-150405"))
+
+	if err := utils.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	tasksMutex.Lock()
+	defer tasksMutex.Unlock()
+
+	runDir = dir
+	runIndex = []*TaskEntry{}
+
+	return writeIndex()
+}
+
+// EndRun closes the task log files still open, they are marked as failed
+func EndRun() {
+	tasksMutex.Lock()
+	defer tasksMutex.Unlock()
+
+	for name, curr := range runTasks {
+		curr.entry.Status = TaskFailed
+		curr.entry.End = time.Now()
+		_ = curr.file.Close()
+		delete(runTasks, name)
+	}
+
+	if runDir != "" {
+		_ = writeIndex()
+	}
+	runDir = ""
+}
+
+// GetRunDir returns the current run directory, empty if no run was started
+func GetRunDir() string {
+	tasksMutex.Lock()
+	defer tasksMutex.Unlock()
+
+	return runDir
+}
+
+// BeginTask starts logging to the name task log file, i.e: "swupd" is logged
+// to swupd.log and "hooks/post-install" to hooks/post-install.log. Only the
+// lines written to the task, see TaskWriter() and TaskPrintf(), are in its log
+// file: the tasks run concurrently. A task begun again is appended to its log
+// file.
+func BeginTask(name string) {
+	tasksMutex.Lock()
+	defer tasksMutex.Unlock()
+
+	if runDir == "" {
+		return
+	}
+
+	if curr, ok := runTasks[name]; ok {
+		curr.count++
+		return
+	}
+
+	var entry *TaskEntry
+	for _, curr := range runIndex {
+		if curr.Name == name {
+			entry = curr
+		}
+	}
+
+	if entry == nil {
+		entry = &TaskEntry{Name: name, File: name + ".log", Start: time.Now()}
+		runIndex = append(runIndex, entry)
+	}
+
+	file := filepath.Join(runDir, entry.File)
+	if err := utils.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		log.Printf("[WRN] Failed to create the %s task log directory: %v\n", name, err)
+		return
+	}
+
+	fh, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		log.Printf("[WRN] Failed to create the %s task log file: %v\n", name, err)
+		return
+	}
+
+	entry.Status = TaskRunning
+	entry.End = time.Time{}
+
+	runTasks[name] = &taskLog{
+		entry:  entry,
+		file:   fh,
+		logger: log.New(fh, "", log.LstdFlags),
+		count:  1,
+	}
+
+	_ = writeIndex()
+}
+
+// EndTask ends the name task begun by BeginTask, err is the task result; the
+// task is failed if any of its beginnings failed
+func EndTask(name string, err error) {
+	tasksMutex.Lock()
+	defer tasksMutex.Unlock()
+
+	curr, ok := runTasks[name]
+	if !ok {
+		return
+	}
+
+	if err != nil {
+		curr.logger.Printf("[ERR] %v", err)
+	}
+
+	curr.failed = curr.failed || err != nil
+	curr.count--
+
+	if curr.count > 0 {
+		return
+	}
+
+	curr.entry.Status = TaskSucceeded
+	if curr.failed {
+		curr.entry.Status = TaskFailed
+	}
+	curr.entry.End = time.Now()
+
+	_ = curr.file.Close()
+	delete(runTasks, name)
+
+	_ = writeIndex()
+}
+
+// TaskPrintf writes a line to the name task log file while the task is begun,
+// the line is not written to the log file
+func TaskPrintf(name string, format string, a ...interface{}) {
+	tasksMutex.Lock()
+	defer tasksMutex.Unlock()
+
+	if curr, ok := runTasks[name]; ok {
+		curr.logger.Printf(format, a...)
+	}
+}
+
+// taskWriter is the io.Writer of a task, see TaskWriter()
+type taskWriter string
+
+func (tw taskWriter) Write(p []byte) (int, error) {
+	for _, curr := range strings.Split(string(p), "\n") {
+		if curr == "" {
+			continue
+		}
+
+		Debug("%s", curr)
+		TaskPrintf(string(tw), "%s", curr)
+	}
+
+	return len(p), nil
+}
+
+// TaskWriter returns the writer of the name task, i.e. the writer of the task
+// commands output, see cmd.Run(). The lines written to it are logged with the
+// debug level and written to the task log file while the task is begun.
+func TaskWriter(name string) io.Writer {
+	return taskWriter(name)
+}
+
+// writeIndex writes the run directory index, it's rewritten whenever a task
+// begins or ends so an interrupted install still has a valid index
+func writeIndex() error {
+	data, err := json.MarshalIndent(runIndex, "", "  ")
+	if err != nil {
+		return errors.Wrap(err)
+	}
+
+	if err = ioutil.WriteFile(filepath.Join(runDir, IndexFile), data, 0644); err != nil {
+		return errors.Wrap(err)
+	}
+
+	return nil
+}
+
+// ReadIndex returns the index of the run directory dir
+func ReadIndex(dir string) ([]*TaskEntry, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, IndexFile))
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+
+	result := []*TaskEntry{}
+	if err = json.Unmarshal(data, &result); err != nil {
+		return nil, errors.Wrap(err)
+	}
+
+	return result, nil
+}
+
+// ExportTasks copies the index and the log files of the names tasks of the
+// current run to dest, every task is exported if names is empty; the index
+// only lists the exported tasks
+func ExportTasks(dest string, names []string) error {
+	tasksMutex.Lock()
+	defer tasksMutex.Unlock()
+
+	if runDir == "" {
+		return errors.Errorf("No install run started, see log.StartRun()")
+	}
+
+	for _, curr := range runTasks {
+		_ = curr.file.Sync()
+	}
+
+	exported := []*TaskEntry{}
+	for _, curr := range runIndex {
+		if len(names) == 0 || utils.StringSliceContains(names, curr.Name) {
+			exported = append(exported, curr)
+		}
+	}
+
+	for _, curr := range exported {
+		file := filepath.Join(dest, curr.File)
+		if err := utils.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			return err
+		}
+
+		if err := utils.CopyFile(filepath.Join(runDir, curr.File), file); err != nil {
+			return err
+		}
+	}
+
+	data, err := json.MarshalIndent(exported, "", "  ")
+	if err != nil {
+		return errors.Wrap(err)
+	}
+
+	if err = utils.MkdirAll(dest, 0755); err != nil {
+		return err
+	}
+
+	if err = ioutil.WriteFile(filepath.Join(dest, IndexFile), data, 0644); err != nil {
+		return errors.Wrap(err)
+	}
+
+	return nil
+}
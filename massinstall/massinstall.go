@@ -6,6 +6,8 @@ package massinstall
 
 import (
 	"fmt"
+	"io"
+	"os"
 	"strings"
 	"time"
 
@@ -13,7 +15,9 @@ import (
 	"github.com/clearlinux/clr-installer/controller"
 	"github.com/clearlinux/clr-installer/errors"
 	"github.com/clearlinux/clr-installer/log"
+	"github.com/clearlinux/clr-installer/metrics"
 	"github.com/clearlinux/clr-installer/model"
+	"github.com/clearlinux/clr-installer/power"
 	"github.com/clearlinux/clr-installer/progress"
 	"github.com/clearlinux/clr-installer/storage"
 	"github.com/clearlinux/clr-installer/utils"
@@ -113,7 +117,7 @@ func (mi *MassInstall) Failure() {
 // MustRun is part of the Frontend implementation and tells the core implementation that this
 // frontend wants or should be executed
 func (mi *MassInstall) MustRun(args *args.Args) bool {
-	return args.ConfigFile != "" && !args.ForceTUI
+	return (args.ConfigFile != "" || args.Kickstart != "") && !args.ForceTUI && args.GenerateConfig == ""
 }
 
 func shouldReboot() (bool, bool, error) {
@@ -146,6 +150,42 @@ func shouldReboot() (bool, bool, error) {
 	return valid, reboot, nil
 }
 
+// postActionCanceled counts down before running the post install action, the
+// user may cancel it by pressing enter, there's no countdown when not reading
+// from a terminal (i.e headless installs)
+func postActionCanceled(action string) bool {
+	if !utils.IsStdinTTY() {
+		return false
+	}
+
+	// buffered, the reader is not waited for once the countdown is over
+	canceled := make(chan bool, 1)
+	go func() {
+		var answer string
+		if _, err := fmt.Scanln(&answer); err == io.EOF {
+			return
+		}
+		canceled <- true
+	}()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for remaining := controller.PostActionCountdown; remaining > 0; remaining-- {
+		fmt.Printf("\rRunning %s in %2d seconds, press enter to cancel...", action, remaining)
+
+		select {
+		case <-canceled:
+			fmt.Printf("\n%s canceled\n", action)
+			return true
+		case <-ticker.C:
+		}
+	}
+
+	fmt.Println()
+	return false
+}
+
 // Run is part of the Frontend implementation and is the actual entry point for the
 // "mass installer" frontend
 func (mi *MassInstall) Run(md *model.SystemInstall, rootDir string, options args.Args) (bool, error) {
@@ -155,7 +195,18 @@ func (mi *MassInstall) Run(md *model.SystemInstall, rootDir string, options args
 	// the command line and will be using the whole disk
 	md.InstallSelected = storage.InstallTarget{WholeDisk: true}
 
-	progress.Set(mi)
+	plain, err := usePlainProgress(options.Progress)
+	if err != nil {
+		return false, err
+	}
+
+	var client progress.Client = mi
+	if plain {
+		client = NewPlainProgress(os.Stdout)
+	}
+
+	// the metrics are only recorded if the server was started
+	progress.Set(metrics.NewProgress(client))
 
 	log.Debug("Starting install")
 
@@ -163,7 +214,12 @@ func (mi *MassInstall) Run(md *model.SystemInstall, rootDir string, options args
 		fmt.Println("Config file specifies a target \"version\", forcing auto-update off.")
 	}
 
+	if warning := power.BatteryWarning(); warning != "" {
+		fmt.Printf("WARNING: %s\n", warning)
+	}
+
 	instError = controller.Install(rootDir, md, options)
+	metrics.Finish(instError)
 	if instError != nil {
 		if !errors.IsValidationError(instError) {
 			fmt.Printf("ERROR: Installation has failed!\n")
@@ -171,11 +227,30 @@ func (mi *MassInstall) Run(md *model.SystemInstall, rootDir string, options args
 		return false, instError
 	}
 
+	if md.CryptKeys != nil && md.CryptKeys.RecoveryKey != "" {
+		fmt.Printf("Disk encryption recovery key: %s\n", md.CryptKeys.RecoveryKey)
+	}
+
 	var reboot bool
 
 	if instError != nil {
 		return false, instError
+	} else if options.InstallToDir != "" {
+		// the installing system is not the one installed
+		fmt.Printf("Installed to %s\n", options.InstallToDir)
+		return false, nil
+	} else if md.PostAction != "" {
+		reboot = md.PostAction != model.PostActionStay && !postActionCanceled(md.PostAction)
 	} else if md.PostReboot {
+		var answered bool
+		var err error
+
+		if reboot, answered, err = md.Confirm(model.PromptReboot); err != nil {
+			return false, err
+		} else if answered {
+			return reboot, nil
+		}
+
 		for {
 			var valid bool
 			var err error
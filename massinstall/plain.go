@@ -0,0 +1,148 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package massinstall
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/utils"
+)
+
+const (
+	// ProgressAuto prints the plain progress when stdout is not a terminal
+	ProgressAuto = "auto"
+
+	// ProgressPlain always prints the plain progress
+	ProgressPlain = "plain"
+
+	// ProgressTTY always prints the interactive progress
+	ProgressTTY = "tty"
+
+	// plainHeartbeat is how often a long task is reported still running, so
+	// the CI jobs killed when quiet survive a slow download
+	plainHeartbeat = time.Minute
+
+	// plainTimeFormat is the timestamp of the plain progress lines
+	plainTimeFormat = "2006-01-02 15:04:05"
+)
+
+// ProgressModes are the supported progress outputs
+var ProgressModes = []string{ProgressAuto, ProgressPlain, ProgressTTY}
+
+// PlainProgress is a progress.Client printing timestamped lines, without any
+// cursor control, suitable for the CI logs
+type PlainProgress struct {
+	writer  io.Writer
+	mutex   sync.Mutex
+	desc    string
+	start   time.Time
+	last    time.Time
+	percent int
+}
+
+// NewPlainProgress returns a PlainProgress client printing to writer
+func NewPlainProgress(writer io.Writer) *PlainProgress {
+	return &PlainProgress{writer: writer}
+}
+
+// usePlainProgress returns true if the mode progress output is the plain one
+func usePlainProgress(mode string) (bool, error) {
+	switch mode {
+	case "", ProgressAuto:
+		return !utils.IsStdoutTTY(), nil
+	case ProgressPlain:
+		return true, nil
+	case ProgressTTY:
+		return false, nil
+	}
+
+	return false, errors.ValidationErrorf("Invalid progress output %q, must be one of: %s",
+		mode, strings.Join(ProgressModes, ", "))
+}
+
+// println prints a timestamped line, the caller holds the mutex
+func (pp *PlainProgress) println(format string, a ...interface{}) {
+	now := time.Now()
+	pp.last = now
+
+	fmt.Fprintf(pp.writer, "%s %s\n", now.Format(plainTimeFormat), fmt.Sprintf(format, a...))
+}
+
+// elapsed returns the duration of the current task, rounded for display
+func (pp *PlainProgress) elapsed() time.Duration {
+	return time.Now().Sub(pp.start).Round(100 * time.Millisecond)
+}
+
+// Desc is part of the progress.Client implementation
+func (pp *PlainProgress) Desc(desc string) {
+	pp.mutex.Lock()
+	defer pp.mutex.Unlock()
+
+	pp.desc = desc
+	pp.start = time.Now()
+	pp.percent = 0
+	pp.println("%s", desc)
+}
+
+// Partial is part of the progress.Client implementation, the progress is
+// printed by steps of 10%
+func (pp *PlainProgress) Partial(total int, step int) {
+	if total <= 0 {
+		return
+	}
+
+	pp.mutex.Lock()
+	defer pp.mutex.Unlock()
+
+	percent := step * 100 / total / 10 * 10
+	if percent <= pp.percent {
+		return
+	}
+
+	pp.percent = percent
+	pp.println("%s: %d%%", pp.desc, percent)
+}
+
+// Step is part of the progress.Client implementation, a long task is
+// reported still running every plainHeartbeat
+func (pp *PlainProgress) Step() {
+	pp.mutex.Lock()
+	defer pp.mutex.Unlock()
+
+	if pp.desc == "" || time.Now().Sub(pp.last) < plainHeartbeat {
+		return
+	}
+
+	pp.println("%s: running for %s", pp.desc, pp.elapsed().Round(time.Second))
+}
+
+// Success is part of the progress.Client implementation
+func (pp *PlainProgress) Success() {
+	pp.mutex.Lock()
+	defer pp.mutex.Unlock()
+
+	pp.println("%s: done in %s", pp.desc, pp.elapsed())
+	pp.desc = ""
+}
+
+// Failure is part of the progress.Client implementation
+func (pp *PlainProgress) Failure() {
+	pp.mutex.Lock()
+	defer pp.mutex.Unlock()
+
+	pp.println("%s: failed after %s", pp.desc, pp.elapsed())
+	pp.desc = ""
+}
+
+// LoopWaitDuration is part of the progress.Client implementation, the loop
+// steps only check the heartbeat
+func (pp *PlainProgress) LoopWaitDuration() time.Duration {
+	return time.Second
+}
@@ -0,0 +1,217 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/log"
+)
+
+const (
+	// Path is where the metrics are served
+	Path = "/metrics"
+
+	// contentType is the Prometheus text exposition format
+	contentType = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+var (
+	// sysNetDir is the sysfs directory holding the network interfaces
+	sysNetDir = "/sys/class/net"
+
+	current *Server
+)
+
+// Server exposes the state of the running install in the Prometheus text
+// format, so a provisioning farm can scrape its concurrent installs
+type Server struct {
+	listener net.Listener
+	http     *http.Server
+	mutex    sync.Mutex
+
+	phase     string
+	percent   float64
+	succeeded int
+	failed    int
+	errors    int
+	done      bool
+
+	// received is the network interfaces received bytes when the server
+	// started, the downloaded bytes are counted from there
+	received uint64
+}
+
+// Start serves the install metrics on address, i.e ":9100"; the progress
+// recorded from now on is exposed
+func Start(address string) (*Server, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+
+	server := &Server{
+		listener: listener,
+		received: receivedBytes(),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(Path, server.serve)
+	server.http = &http.Server{Handler: mux, ReadTimeout: 10 * time.Second}
+
+	go func() {
+		if errServe := server.http.Serve(listener); errServe != nil && errServe != http.ErrServerClosed {
+			log.Warning("Metrics server stopped: %v", errServe)
+		}
+	}()
+
+	current = server
+	log.Info("Serving the install metrics on %s%s", listener.Addr(), Path)
+
+	return server, nil
+}
+
+// Close stops serving the metrics
+func (server *Server) Close() error {
+	if current == server {
+		current = nil
+	}
+
+	if err := server.http.Close(); err != nil {
+		return errors.Wrap(err)
+	}
+
+	return nil
+}
+
+// Addr returns the address the metrics are served on
+func (server *Server) Addr() net.Addr {
+	return server.listener.Addr()
+}
+
+// record applies fn to the running server, if any
+func record(fn func(server *Server)) {
+	server := current
+	if server == nil {
+		return
+	}
+
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	fn(server)
+}
+
+// Finish records the install result, err is nil if it succeeded
+func Finish(err error) {
+	record(func(server *Server) {
+		server.done = true
+		server.percent = 100
+
+		if err != nil {
+			server.errors++
+		}
+	})
+}
+
+// receivedBytes returns the bytes received by the network interfaces, the
+// loopback excluded
+func receivedBytes() uint64 {
+	var total uint64
+
+	stats, _ := filepath.Glob(filepath.Join(sysNetDir, "*", "statistics", "rx_bytes"))
+
+	for _, curr := range stats {
+		if filepath.Base(filepath.Dir(filepath.Dir(curr))) == "lo" {
+			continue
+		}
+
+		content, err := ioutil.ReadFile(curr)
+		if err != nil {
+			continue
+		}
+
+		value, err := strconv.ParseUint(strings.TrimSpace(string(content)), 10, 64)
+		if err == nil {
+			total += value
+		}
+	}
+
+	return total
+}
+
+// escapeLabel escapes a label value of the Prometheus text format
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+// writeMetric writes the name metric samples preceded by their help and type
+func writeMetric(buf *bytes.Buffer, name string, kind string, help string, samples ...string) {
+	fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+
+	for _, curr := range samples {
+		fmt.Fprintf(buf, "%s%s\n", name, curr)
+	}
+}
+
+// format returns the metrics in the Prometheus text format
+func (server *Server) format() string {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	buf := &bytes.Buffer{}
+
+	downloaded := uint64(0)
+	if received := receivedBytes(); received > server.received {
+		downloaded = received - server.received
+	}
+
+	done := 0
+	if server.done {
+		done = 1
+	}
+
+	writeMetric(buf, "clr_installer_phase", "gauge",
+		"Current install phase, the phase label is the running task.",
+		fmt.Sprintf("{phase=\"%s\"} 1", escapeLabel(server.phase)))
+	writeMetric(buf, "clr_installer_progress_percent", "gauge",
+		"Progress of the current install phase.",
+		fmt.Sprintf(" %g", server.percent))
+	writeMetric(buf, "clr_installer_downloaded_bytes_total", "counter",
+		"Bytes received from the network since the install started.",
+		fmt.Sprintf(" %d", downloaded))
+	writeMetric(buf, "clr_installer_tasks_total", "counter",
+		"Completed install tasks by result.",
+		fmt.Sprintf("{result=\"success\"} %d", server.succeeded),
+		fmt.Sprintf("{result=\"failure\"} %d", server.failed))
+	writeMetric(buf, "clr_installer_errors_total", "counter",
+		"Install errors, failed tasks and install failures.",
+		fmt.Sprintf(" %d", server.errors))
+	writeMetric(buf, "clr_installer_done", "gauge",
+		"1 once the install finished, successfully or not.",
+		fmt.Sprintf(" %d", done))
+
+	return buf.String()
+}
+
+func (server *Server) serve(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	_, _ = w.Write([]byte(server.format()))
+}
@@ -0,0 +1,130 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package metrics
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/clearlinux/clr-installer/errors"
+)
+
+type fakeClient struct{}
+
+func (fc *fakeClient) Desc(desc string)            {}
+func (fc *fakeClient) Partial(total int, step int) {}
+func (fc *fakeClient) Step()                       {}
+func (fc *fakeClient) Success()                    {}
+func (fc *fakeClient) Failure()                    {}
+func (fc *fakeClient) LoopWaitDuration() time.Duration {
+	return time.Second
+}
+
+func writeReceived(t *testing.T, dir string, iface string, value uint64) {
+	stats := filepath.Join(dir, iface, "statistics")
+	if err := os.MkdirAll(stats, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(stats, "rx_bytes"), []byte(fmt.Sprintf("%d\n", value)), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func scrape(t *testing.T, server *Server) string {
+	resp, err := http.Get("http://" + server.Addr().String() + Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain") {
+		t.Fatalf("Unexpected metrics response: %s %s", resp.Status, resp.Header.Get("Content-Type"))
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(body)
+}
+
+func TestMetrics(t *testing.T) {
+	dir, err := ioutil.TempDir("", "clr-installer-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	saveNetDir := sysNetDir
+	defer func() { sysNetDir = saveNetDir }()
+
+	sysNetDir = dir
+	writeReceived(t, dir, "lo", 100)
+	writeReceived(t, dir, "eth0", 1000)
+
+	prg := NewProgress(&fakeClient{})
+
+	// nothing is recorded without a server
+	prg.Desc("Not recorded")
+	Finish(nil)
+
+	server, err := Start("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = server.Close() }()
+
+	prg.Desc("Writing the \"sda\" partitions")
+	prg.Success()
+	prg.Desc("Installing base OS")
+	prg.Partial(4, 1)
+
+	writeReceived(t, dir, "lo", 5000)
+	writeReceived(t, dir, "eth0", 3048)
+
+	body := scrape(t, server)
+	for _, curr := range []string{
+		"# TYPE clr_installer_phase gauge",
+		`clr_installer_phase{phase="Installing base OS"} 1`,
+		"clr_installer_progress_percent 25",
+		"clr_installer_downloaded_bytes_total 2048",
+		`clr_installer_tasks_total{result="success"} 1`,
+		`clr_installer_tasks_total{result="failure"} 0`,
+		"clr_installer_errors_total 0",
+		"clr_installer_done 0",
+	} {
+		if !strings.Contains(body, curr+"\n") {
+			t.Fatalf("Expected %q in:\n%s", curr, body)
+		}
+	}
+
+	prg.Failure()
+	Finish(errors.Errorf("Install failed"))
+
+	body = scrape(t, server)
+	for _, curr := range []string{
+		`clr_installer_tasks_total{result="failure"} 1`,
+		"clr_installer_errors_total 2",
+		"clr_installer_done 1",
+	} {
+		if !strings.Contains(body, curr+"\n") {
+			t.Fatalf("Expected %q in:\n%s", curr, body)
+		}
+	}
+}
+
+func TestEscapeLabel(t *testing.T) {
+	if escaped := escapeLabel("a \"b\" \\c\nd"); escaped != `a \"b\" \\c\nd` {
+		t.Fatalf("Unexpected escaped label: %s", escaped)
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package metrics
+
+import (
+	"time"
+
+	"github.com/clearlinux/clr-installer/progress"
+)
+
+// Progress is a progress.Client wrapper recording the install tasks to the
+// metrics before delivering them to the frontend
+type Progress struct {
+	client progress.Client
+}
+
+// NewProgress returns a Progress client wrapping client
+func NewProgress(client progress.Client) *Progress {
+	return &Progress{client: client}
+}
+
+// Desc is part of the progress.Client implementation
+func (prg *Progress) Desc(desc string) {
+	record(func(server *Server) {
+		server.phase = desc
+		server.percent = 0
+	})
+
+	prg.client.Desc(desc)
+}
+
+// Partial is part of the progress.Client implementation
+func (prg *Progress) Partial(total int, step int) {
+	if total > 0 {
+		record(func(server *Server) {
+			server.percent = float64(step) / float64(total) * 100
+		})
+	}
+
+	prg.client.Partial(total, step)
+}
+
+// Step is part of the progress.Client implementation
+func (prg *Progress) Step() {
+	prg.client.Step()
+}
+
+// Success is part of the progress.Client implementation
+func (prg *Progress) Success() {
+	record(func(server *Server) {
+		server.succeeded++
+		server.percent = 100
+	})
+
+	prg.client.Success()
+}
+
+// Failure is part of the progress.Client implementation
+func (prg *Progress) Failure() {
+	record(func(server *Server) {
+		server.failed++
+		server.errors++
+	})
+
+	prg.client.Failure()
+}
+
+// LoopWaitDuration is part of the progress.Client implementation
+func (prg *Progress) LoopWaitDuration() time.Duration {
+	return prg.client.LoopWaitDuration()
+}
@@ -0,0 +1,107 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package model
+
+import (
+	"strings"
+
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/utils"
+)
+
+const (
+	// PromptReboot is the yes/no prompt asking to reboot after the install
+	PromptReboot = "reboot"
+
+	// PromptCryptPassphrase is the prompt asking for the encryption passphrase,
+	// its response is a secret reference: "env:NAME" or "file:PATH"
+	PromptCryptPassphrase = "crypt-passphrase"
+
+	// PromptPolicyAbort fails the install when a prompt has no response
+	PromptPolicyAbort = "abort"
+
+	// PromptPolicyAssumeYes answers "yes" to the yes/no prompts with no
+	// response, the other prompts still fail the install
+	PromptPolicyAssumeYes = "assume-yes"
+)
+
+// PromptPolicies is the list of supported policies for unanswered prompts
+var PromptPolicies = []string{PromptPolicyAbort, PromptPolicyAssumeYes}
+
+// PromptAnswers holds the scripted responses to the interactive prompts, once
+// declared the prompts are never asked so unattended installs never block
+type PromptAnswers struct {
+	// Policy applies to the prompts with no response, defaults to PromptPolicyAbort
+	Policy string `yaml:"policy,omitempty,flow"`
+
+	// Responses maps the prompt ids to their responses
+	Responses map[string]string `yaml:"responses,omitempty,flow"`
+}
+
+// Validate checks the answers policy and the yes/no responses
+func (pa *PromptAnswers) Validate() error {
+	if pa.Policy != "" && !utils.StringSliceContains(PromptPolicies, pa.Policy) {
+		return errors.ValidationErrorf("Invalid prompt policy %q, must be one of: %s",
+			pa.Policy, strings.Join(PromptPolicies, ", "))
+	}
+
+	if answer, ok := pa.Responses[PromptReboot]; ok {
+		if _, valid := parseYesNo(answer); !valid {
+			return errors.ValidationErrorf("Invalid %s response %q, must be yes or no", PromptReboot, answer)
+		}
+	}
+
+	return nil
+}
+
+// Answer returns the scripted response of the prompt id, ok is false if the
+// model has no answers and the prompt must be asked interactively
+func (si *SystemInstall) Answer(id string) (string, bool, error) {
+	if si.Answers == nil {
+		return "", false, nil
+	}
+
+	if answer, found := si.Answers.Responses[id]; found {
+		return answer, true, nil
+	}
+
+	return "", true, errors.Errorf("No response to the %q prompt", id)
+}
+
+// Confirm returns the scripted response of the yes/no prompt id, unanswered
+// prompts follow the answers policy; ok is false if the model has no answers
+// and the prompt must be asked interactively
+func (si *SystemInstall) Confirm(id string) (bool, bool, error) {
+	answer, ok, err := si.Answer(id)
+	if !ok {
+		return false, false, nil
+	}
+
+	if err != nil {
+		if si.Answers.Policy == PromptPolicyAssumeYes {
+			return true, true, nil
+		}
+		return false, true, err
+	}
+
+	yes, valid := parseYesNo(answer)
+	if !valid {
+		return false, true, errors.Errorf("Invalid %q prompt response %q, must be yes or no", id, answer)
+	}
+
+	return yes, true, nil
+}
+
+// parseYesNo parses a yes/no response, valid is false if it is neither
+func parseYesNo(answer string) (bool, bool) {
+	switch strings.ToLower(answer) {
+	case "y", "yes":
+		return true, true
+	case "n", "no":
+		return false, true
+	}
+
+	return false, false
+}
@@ -0,0 +1,335 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package model
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/kernel"
+	"github.com/clearlinux/clr-installer/utils"
+)
+
+// ChangeType identifies the kind of a model Change
+type ChangeType int
+
+const (
+	// ChangeAdded is a field set in the new model only
+	ChangeAdded ChangeType = iota
+
+	// ChangeRemoved is a field set in the old model only
+	ChangeRemoved
+
+	// ChangeModified is a field set in both models with different values
+	ChangeModified
+)
+
+// Change is a single difference between two models, Field is the yaml
+// path of the changed field, i.e: "kernel-arguments.add"
+type Change struct {
+	Type  ChangeType
+	Field string
+	Old   string
+	New   string
+}
+
+// String returns a human readable representation of the change
+func (c Change) String() string {
+	switch c.Type {
+	case ChangeAdded:
+		return fmt.Sprintf("+ %s: %s", c.Field, c.New)
+	case ChangeRemoved:
+		return fmt.Sprintf("- %s: %s", c.Field, c.Old)
+	}
+
+	return fmt.Sprintf("~ %s: %s -> %s", c.Field, c.Old, c.New)
+}
+
+// Diff compares the yaml representation of the models a and b and returns the
+// list of changes required to go from a to b, sorted by field
+func Diff(a, b *SystemInstall) ([]Change, error) {
+	am, err := toYAMLMap(a)
+	if err != nil {
+		return nil, err
+	}
+
+	bm, err := toYAMLMap(b)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := []Change{}
+	diffMaps("", am, bm, &changes)
+
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].Field < changes[j].Field
+	})
+
+	return changes, nil
+}
+
+// DefaultChanges returns the changes of si from a model holding the section
+// defaults only, as listed by the install review pages. The target medias are
+// left out, the review pages list them on their own.
+func DefaultChanges(si *SystemInstall) ([]Change, error) {
+	defaults := &SystemInstall{}
+	defaults.Default()
+
+	changes, err := Diff(defaults, si)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []Change{}
+	for _, curr := range changes {
+		if curr.Field != "targetMedia" && !strings.HasPrefix(curr.Field, "targetMedia.") {
+			result = append(result, curr)
+		}
+	}
+
+	return result, nil
+}
+
+// ReviewChanges renders the first max changes of si from the defaults, cut
+// to width, the last line counts the changes left out
+func ReviewChanges(si *SystemInstall, max int, width int) ([]string, error) {
+	changes, err := DefaultChanges(si)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []string{}
+	for idx, curr := range changes {
+		if idx == max {
+			result = append(result, fmt.Sprintf("... and %d more", len(changes)-max))
+			break
+		}
+
+		line := curr.String()
+		if len(line) > width {
+			line = line[:width-3] + "..."
+		}
+
+		result = append(result, line)
+	}
+
+	return result, nil
+}
+
+// toYAMLMap converts a model to its generic yaml representation
+func toYAMLMap(si *SystemInstall) (map[interface{}]interface{}, error) {
+	result := map[interface{}]interface{}{}
+
+	if si == nil {
+		return result, nil
+	}
+
+	// the changes may be logged, never render the secret values
+	b, err := yaml.Marshal(si.redacted())
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+
+	if err = yaml.Unmarshal(b, &result); err != nil {
+		return nil, errors.Wrap(err)
+	}
+
+	return result, nil
+}
+
+func diffMaps(prefix string, a, b map[interface{}]interface{}, changes *[]Change) {
+	keys := map[string]interface{}{}
+
+	for k := range a {
+		keys[fmt.Sprintf("%v", k)] = k
+	}
+
+	for k := range b {
+		keys[fmt.Sprintf("%v", k)] = k
+	}
+
+	for name, key := range keys {
+		field := name
+		if prefix != "" {
+			field = prefix + "." + name
+		}
+
+		av, aok := a[key]
+		bv, bok := b[key]
+
+		// the false booleans are omitted, turning one off is a change of its
+		// value rather than a removal
+		if _, ok := av.(bool); ok && !bok {
+			bv, bok = false, true
+		}
+
+		if _, ok := bv.(bool); ok && !aok {
+			av, aok = false, true
+		}
+
+		switch {
+		case !aok:
+			*changes = append(*changes, Change{Type: ChangeAdded, Field: field, New: renderValue(bv)})
+		case !bok:
+			*changes = append(*changes, Change{Type: ChangeRemoved, Field: field, Old: renderValue(av)})
+		default:
+			amap, amok := av.(map[interface{}]interface{})
+			bmap, bmok := bv.(map[interface{}]interface{})
+
+			if amok && bmok {
+				diffMaps(field, amap, bmap, changes)
+			} else if !reflect.DeepEqual(av, bv) {
+				*changes = append(*changes, Change{
+					Type:  ChangeModified,
+					Field: field,
+					Old:   renderValue(av),
+					New:   renderValue(bv),
+				})
+			}
+		}
+	}
+}
+
+// renderValue returns a single line, yaml flow like, representation of a value
+func renderValue(value interface{}) string {
+	switch v := value.(type) {
+	case []interface{}:
+		items := []string{}
+		for _, curr := range v {
+			items = append(items, renderValue(curr))
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	case map[interface{}]interface{}:
+		items := []string{}
+		for k, curr := range v {
+			items = append(items, fmt.Sprintf("%v: %s", k, renderValue(curr)))
+		}
+		sort.Strings(items)
+		return "{" + strings.Join(items, ", ") + "}"
+	}
+
+	return fmt.Sprintf("%v", value)
+}
+
+// Merge returns a new model with the overlay descriptor, in yaml, applied on
+// top of base. Only the keys present in overlay are applied, so an overlay may
+// also reset a base value, i.e: "autoUpdate: false". The precedence rules are:
+//   - the values of overlay take precedence over the base values
+//   - bundles, user bundles and kernel arguments are the union of both
+//   - environment variables are merged, overlay wins on conflicting keys
+//   - pre and post install hooks of overlay run after the base ones
+//
+// Note the resulting model may share references with base.
+func Merge(base *SystemInstall, overlay []byte) (*SystemInstall, error) {
+	if base == nil {
+		return nil, errors.Errorf("Cannot merge into a nil model")
+	}
+
+	result := *base
+
+	om := &SystemInstall{}
+	if err := yaml.Unmarshal(overlay, om); err != nil {
+		return nil, errors.Wrap(err)
+	}
+
+	if err := checkEmptyEntries(reflect.ValueOf(*om)); err != nil {
+		return nil, err
+	}
+
+	// the overlay keys tell a value explicitly set to false or empty from
+	// a missing one
+	keys := map[string]interface{}{}
+	if err := yaml.Unmarshal(overlay, &keys); err != nil {
+		return nil, errors.Wrap(err)
+	}
+
+	mergeKeys(reflect.ValueOf(&result).Elem(), reflect.ValueOf(om).Elem(), keys)
+
+	result.Bundles = unionStrings(base.Bundles, om.Bundles)
+	result.UserBundles = unionStrings(base.UserBundles, om.UserBundles)
+
+	if base.KernelArguments != nil || om.KernelArguments != nil {
+		result.KernelArguments = &kernel.Arguments{}
+
+		for _, curr := range []*kernel.Arguments{base.KernelArguments, om.KernelArguments} {
+			if curr != nil {
+				result.KernelArguments.Add = unionStrings(result.KernelArguments.Add, curr.Add)
+				result.KernelArguments.Remove = unionStrings(result.KernelArguments.Remove, curr.Remove)
+			}
+		}
+	}
+
+	if base.Environment != nil || om.Environment != nil {
+		result.Environment = map[string]string{}
+
+		for _, curr := range []map[string]string{base.Environment, om.Environment} {
+			for k, v := range curr {
+				result.Environment[k] = v
+			}
+		}
+	}
+
+	result.PreInstall = append(append([]*InstallHook{}, base.PreInstall...), om.PreInstall...)
+	result.PostInstall = append(append([]*InstallHook{}, base.PostInstall...), om.PostInstall...)
+
+	if len(result.PreInstall) == 0 {
+		result.PreInstall = nil
+	}
+
+	if len(result.PostInstall) == 0 {
+		result.PostInstall = nil
+	}
+
+	return &result, nil
+}
+
+// mergeKeys copies the exported fields of the src struct whose yaml key is in
+// keys into the dst struct, the inline sections are walked too
+func mergeKeys(dst reflect.Value, src reflect.Value, keys map[string]interface{}) {
+	for i := 0; i < src.NumField(); i++ {
+		field := dst.Field(i)
+		sf := src.Type().Field(i)
+
+		if !field.CanSet() {
+			continue
+		}
+
+		if sf.Anonymous && field.Kind() == reflect.Struct {
+			mergeKeys(field, src.Field(i), keys)
+			continue
+		}
+
+		name := strings.Split(sf.Tag.Get("yaml"), ",")[0]
+		if name == "" {
+			name = strings.ToLower(sf.Name)
+		}
+
+		if _, ok := keys[name]; ok {
+			field.Set(src.Field(i))
+		}
+	}
+}
+
+// unionStrings returns a followed by the elements of b not in a
+func unionStrings(a, b []string) []string {
+	if a == nil && b == nil {
+		return nil
+	}
+
+	result := append([]string{}, a...)
+
+	for _, curr := range b {
+		if !utils.StringSliceContains(result, curr) {
+			result = append(result, curr)
+		}
+	}
+
+	return result
+}
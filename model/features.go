@@ -0,0 +1,552 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package model
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/kernel"
+	"github.com/clearlinux/clr-installer/keyboard"
+	"github.com/clearlinux/clr-installer/log"
+	"github.com/clearlinux/clr-installer/network"
+	"github.com/clearlinux/clr-installer/storage"
+)
+
+const (
+	// FieldText is a single line text field
+	FieldText = iota
+
+	// FieldBool is a check box field, its value is FieldTrue or empty
+	FieldBool
+
+	// FieldChoice is a single line text field offering the field Choices
+	FieldChoice
+
+	// FieldPassword is a masked single line text field, its value is never
+	// part of the summary
+	FieldPassword
+)
+
+const (
+	// FieldTrue is the value of a checked FieldBool
+	FieldTrue = "true"
+
+	// FeatureKernelArguments is the feature of the kernel arguments
+	FeatureKernelArguments = "kernel-arguments"
+
+	// FeatureEncryption is the feature of the encryption recovery and key files
+	FeatureEncryption = "encryption"
+
+	// FeatureSwupdTLS is the feature of the swupd mirror client certificates
+	FeatureSwupdTLS = "swupd-tls"
+
+	// FeatureDiagnostics is the feature of the target diagnostics
+	FeatureDiagnostics = "diagnostics"
+
+	// FeatureUpdatePolicy is the feature of the automatic update policy
+	FeatureUpdatePolicy = "update-policy"
+
+	// FeatureBootMenu is the feature of the boot loader menu
+	FeatureBootMenu = "boot-menu"
+
+	// FeatureWireless is the feature of the wireless network
+	FeatureWireless = "wireless"
+
+	// FeatureX11Keyboard is the feature of the X11 keyboard
+	FeatureX11Keyboard = "x11-keyboard"
+)
+
+// FeatureField is a configurable value of a feature, the frontends generate
+// an entry or a check box for it given its Kind
+type FeatureField struct {
+	Label string
+	Kind  int
+	Help  string
+
+	// Choices returns the values offered by a FieldChoice, called every
+	// time the feature form is displayed
+	Choices func() []string
+}
+
+// Feature describes a configurable model section so every frontend can reach
+// it through a generated form, a frontend with a dedicated page for the
+// feature simply skips it
+type Feature struct {
+	ID     string
+	Title  string
+	Fields []*FeatureField
+
+	// get returns the configured values, one per field
+	get func(si *SystemInstall) []string
+
+	// set validates the values, one per field, and stores them in the model
+	set func(si *SystemInstall, values []string) error
+}
+
+// Features are the model sections reachable from every frontend, in the
+// order they're presented
+var Features = []*Feature{
+	{
+		ID:    FeatureKernelArguments,
+		Title: "Kernel Command Line",
+		Fields: []*FeatureField{
+			{Label: "Add Extra Arguments", Kind: FieldText, Help: "Space separated"},
+			{Label: "Remove Arguments", Kind: FieldText, Help: "Space separated"},
+		},
+		get: getKernelArguments,
+		set: setKernelArguments,
+	},
+	{
+		ID:    FeatureEncryption,
+		Title: "Encryption Keys",
+		Fields: []*FeatureField{
+			{Label: "Add a recovery key", Kind: FieldBool},
+			{Label: "Recovery key file", Kind: FieldText, Help: "Where the recovery key is exported"},
+			{Label: "Key file", Kind: FieldText, Help: "env:NAME or file:PATH"},
+			{Label: "Key file device", Kind: FieldText, Help: "Device storing a generated key file"},
+			{Label: "Passphrase policy", Kind: FieldChoice, Help: "prompt, usb-keyfile or tpm",
+				Choices: passphrasePolicyChoices},
+			{Label: "Passphrase device", Kind: FieldText, Help: "Device storing the usb-keyfile passphrase"},
+		},
+		get: getCryptKeys,
+		set: setCryptKeys,
+	},
+	{
+		ID:    FeatureSwupdTLS,
+		Title: "Swupd Mirror Certificates",
+		Fields: []*FeatureField{
+			{Label: "CA certificate", Kind: FieldText, Help: "PEM file"},
+			{Label: "Client certificate", Kind: FieldText, Help: "env:NAME or file:PATH"},
+			{Label: "Client key", Kind: FieldText, Help: "env:NAME or file:PATH"},
+		},
+		get: getSwupdTLS,
+		set: setSwupdTLS,
+	},
+	{
+		ID:    FeatureDiagnostics,
+		Title: "Diagnostics",
+		Fields: []*FeatureField{
+			{Label: "Persistent journal", Kind: FieldBool},
+			{Label: "Store core dumps", Kind: FieldBool},
+			{Label: "Kdump", Kind: FieldBool},
+			{Label: "Crash kernel", Kind: FieldText, Help: "i.e: 256M, sized with the memory if empty"},
+		},
+		get: getDiagnostics,
+		set: setDiagnostics,
+	},
+	{
+		ID:    FeatureUpdatePolicy,
+		Title: "Update Policy",
+		Fields: []*FeatureField{
+			{Label: "Schedule", Kind: FieldText, Help: "systemd calendar event, i.e: Sat *-*-* 03:00:00"},
+			{Label: "Reboot", Kind: FieldText, Help: strings.Join(RebootPolicies, " or ")},
+		},
+		get: getUpdatePolicy,
+		set: setUpdatePolicy,
+	},
+	{
+		ID:    FeatureBootMenu,
+		Title: "Boot Menu",
+		Fields: []*FeatureField{
+			{Label: "Title", Kind: FieldText},
+			{Label: "Default entry", Kind: FieldText},
+			{Label: "Timeout", Kind: FieldText, Help: "Seconds"},
+		},
+		get: getBootMenu,
+		set: setBootMenu,
+	},
+	{
+		ID:    FeatureWireless,
+		Title: "Wireless Network",
+		Fields: []*FeatureField{
+			{Label: "Network", Kind: FieldChoice, Help: "SSID", Choices: wirelessChoices},
+			{
+				Label: "Security",
+				Kind:  FieldText,
+				Help:  strings.Join(network.WirelessSecurities, ", ") + ", the scanned one if empty",
+			},
+			{Label: "Passphrase", Kind: FieldPassword, Help: "8 to 63 characters, env:NAME or file:PATH"},
+		},
+		get: getWireless,
+		set: setWireless,
+	},
+	{
+		ID:    FeatureX11Keyboard,
+		Title: "X11 Keyboard",
+		Fields: []*FeatureField{
+			{Label: "Layout", Kind: FieldText, Help: "i.e: de or us,ru, the console keymap is kept"},
+			{Label: "Variant", Kind: FieldText, Help: "i.e: nodeadkeys"},
+			{Label: "Model", Kind: FieldText, Help: "i.e: pc105"},
+			{Label: "Options", Kind: FieldText, Help: "i.e: " + keyboard.OptionCompose + "," + keyboard.OptionCapsAsCtrl},
+		},
+		get: getX11Keyboard,
+		set: setX11Keyboard,
+	},
+}
+
+// Values returns the configured values of the feature, one per field
+func (ft *Feature) Values(si *SystemInstall) []string {
+	return ft.get(si)
+}
+
+// Apply validates values, one per field, and stores them in the model; the
+// model is left untouched if the values are invalid
+func (ft *Feature) Apply(si *SystemInstall, values []string) error {
+	if len(values) != len(ft.Fields) {
+		return errors.Errorf("%s expects %d values, got %d", ft.ID, len(ft.Fields), len(values))
+	}
+
+	trimmed := []string{}
+	for _, curr := range values {
+		trimmed = append(trimmed, strings.TrimSpace(curr))
+	}
+
+	return ft.set(si, trimmed)
+}
+
+// IsConfigured returns true if any field of the feature is set
+func (ft *Feature) IsConfigured(si *SystemInstall) bool {
+	for _, curr := range ft.get(si) {
+		if curr != "" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Summary returns the human readable configured values, empty if none
+func (ft *Feature) Summary(si *SystemInstall) string {
+	result := []string{}
+
+	for i, curr := range ft.get(si) {
+		if curr == "" {
+			continue
+		}
+
+		field := ft.Fields[i]
+		if field.Kind == FieldBool || field.Kind == FieldPassword {
+			result = append(result, summaryText("%s", field.Label))
+		} else {
+			result = append(result, summaryText("%s", field.Label)+": "+curr)
+		}
+	}
+
+	return strings.Join(result, ", ")
+}
+
+// GetFeature returns the feature with id, nil if unknown
+func GetFeature(id string) *Feature {
+	for _, curr := range Features {
+		if curr.ID == id {
+			return curr
+		}
+	}
+
+	return nil
+}
+
+func boolValue(value bool) string {
+	if value {
+		return FieldTrue
+	}
+	return ""
+}
+
+func getKernelArguments(si *SystemInstall) []string {
+	if si.KernelArguments == nil {
+		return []string{"", ""}
+	}
+
+	return []string{
+		strings.Join(si.KernelArguments.Add, " "),
+		strings.Join(si.KernelArguments.Remove, " "),
+	}
+}
+
+func setKernelArguments(si *SystemInstall, values []string) error {
+	args := &kernel.Arguments{
+		Add:    strings.Fields(values[0]),
+		Remove: strings.Fields(values[1]),
+	}
+
+	if len(args.Add) == 0 && len(args.Remove) == 0 {
+		args = nil
+	}
+
+	si.KernelArguments = args
+	return nil
+}
+
+func getCryptKeys(si *SystemInstall) []string {
+	keys := si.CryptKeys
+	if keys == nil {
+		keys = &storage.CryptKeys{}
+	}
+
+	return []string{boolValue(keys.Recovery), keys.RecoveryFile, keys.KeyFile, keys.KeyFileDevice,
+		keys.Passphrase, keys.PassphraseDevice}
+}
+
+func passphrasePolicyChoices() []string {
+	return storage.PassphrasePolicies
+}
+
+func setCryptKeys(si *SystemInstall, values []string) error {
+	keys := &storage.CryptKeys{
+		Recovery:         values[0] == FieldTrue,
+		RecoveryFile:     values[1],
+		KeyFile:          values[2],
+		KeyFileDevice:    values[3],
+		Passphrase:       values[4],
+		PassphraseDevice: values[5],
+	}
+
+	if keys.RecoveryFile != "" && !strings.HasPrefix(keys.RecoveryFile, "/") {
+		return errors.ValidationErrorf("Invalid recovery key file %q, must be an absolute path", keys.RecoveryFile)
+	}
+
+	if keys.KeyFile != "" && !isSecretReference(keys.KeyFile) {
+		return errors.ValidationErrorf("Invalid secret reference %q, expected env:NAME or file:PATH", keys.KeyFile)
+	}
+
+	if keys.KeyFileDevice != "" && !strings.HasPrefix(keys.KeyFileDevice, "/dev/") {
+		return errors.ValidationErrorf("Invalid key file device %q, i.e: /dev/sdb1", keys.KeyFileDevice)
+	}
+
+	if err := keys.Validate(); err != nil {
+		return err
+	}
+
+	if !keys.Recovery && keys.RecoveryFile == "" && keys.KeyFile == "" && keys.KeyFileDevice == "" &&
+		keys.Passphrase == "" {
+		keys = nil
+	}
+
+	si.CryptKeys = keys
+	return nil
+}
+
+func getSwupdTLS(si *SystemInstall) []string {
+	tls := si.SwupdTLS
+	if tls == nil {
+		tls = &SwupdTLS{}
+	}
+
+	return []string{tls.CACert, tls.ClientCert, tls.ClientKey}
+}
+
+func setSwupdTLS(si *SystemInstall, values []string) error {
+	tls := &SwupdTLS{CACert: values[0], ClientCert: values[1], ClientKey: values[2]}
+
+	if err := tls.Validate(); err != nil {
+		return err
+	}
+
+	if tls.CACert == "" && tls.ClientCert == "" {
+		tls = nil
+	}
+
+	si.SwupdTLS = tls
+	return nil
+}
+
+func getDiagnostics(si *SystemInstall) []string {
+	dg := si.Diagnostics
+	if dg == nil {
+		dg = &Diagnostics{}
+	}
+
+	return []string{
+		boolValue(dg.PersistentJournal),
+		boolValue(dg.CoreDumps),
+		boolValue(dg.Kdump),
+		dg.CrashKernel,
+	}
+}
+
+func setDiagnostics(si *SystemInstall, values []string) error {
+	dg := &Diagnostics{
+		PersistentJournal: values[0] == FieldTrue,
+		CoreDumps:         values[1] == FieldTrue,
+		Kdump:             values[2] == FieldTrue,
+		CrashKernel:       values[3],
+	}
+
+	if err := dg.Validate(); err != nil {
+		return err
+	}
+
+	if dg.IsEmpty() {
+		dg = nil
+	}
+
+	si.Diagnostics = dg
+	return nil
+}
+
+func getUpdatePolicy(si *SystemInstall) []string {
+	up := si.UpdatePolicy
+	if up == nil {
+		up = &UpdatePolicy{}
+	}
+
+	return []string{up.Schedule, up.Reboot}
+}
+
+func setUpdatePolicy(si *SystemInstall, values []string) error {
+	up := &UpdatePolicy{Schedule: values[0], Reboot: values[1]}
+
+	if err := up.Validate(); err != nil {
+		return err
+	}
+
+	if up.Schedule == "" && up.Reboot == "" {
+		up = nil
+	}
+
+	si.UpdatePolicy = up
+	return nil
+}
+
+func getBootMenu(si *SystemInstall) []string {
+	bm := si.BootMenu
+	if bm == nil {
+		bm = &BootMenu{}
+	}
+
+	timeout := ""
+	if bm.Timeout > 0 {
+		timeout = strconv.FormatUint(uint64(bm.Timeout), 10)
+	}
+
+	return []string{bm.Title, bm.Default, timeout}
+}
+
+func setBootMenu(si *SystemInstall, values []string) error {
+	bm := &BootMenu{Title: values[0], Default: values[1]}
+
+	if values[2] != "" {
+		timeout, err := strconv.ParseUint(values[2], 10, 32)
+		if err != nil {
+			return errors.ValidationErrorf("Invalid boot menu timeout %q, must be a number of seconds", values[2])
+		}
+		bm.Timeout = uint(timeout)
+	}
+
+	if err := bm.Validate(); err != nil {
+		return err
+	}
+
+	if bm.Title == "" && bm.Default == "" && bm.Timeout == 0 {
+		bm = nil
+	}
+
+	si.BootMenu = bm
+	return nil
+}
+
+// wirelessChoices returns the SSIDs of the scanned wireless networks
+func wirelessChoices() []string {
+	aps, err := network.ScanWireless()
+	if err != nil {
+		log.Debug("Could not scan the wireless networks: %v", err)
+		return nil
+	}
+
+	result := []string{}
+	for _, curr := range aps {
+		result = append(result, curr.SSID)
+	}
+
+	return result
+}
+
+func getWireless(si *SystemInstall) []string {
+	w := si.Wireless
+	if w == nil {
+		w = &network.Wireless{}
+	}
+
+	passphrase := w.Passphrase
+	if w.PSK != "" {
+		passphrase = w.PSK
+	}
+
+	return []string{w.SSID, w.Security, passphrase}
+}
+
+func setWireless(si *SystemInstall, values []string) error {
+	w := &network.Wireless{SSID: values[0], Security: values[1]}
+
+	if isSecretReference(values[2]) {
+		w.Passphrase = values[2]
+	} else {
+		w.PSK = values[2]
+	}
+
+	if w.SSID == "" {
+		if w.Security != "" || values[2] != "" {
+			return errors.ValidationErrorf("The wireless network SSID is required")
+		}
+
+		si.Wireless = nil
+		return nil
+	}
+
+	if ap := network.ScannedAccessPoint(w.SSID); ap != nil && w.Security == "" {
+		w.Security = ap.Security
+	}
+
+	if w.GetSecurity() == network.WirelessOpen {
+		w.Passphrase, w.PSK = "", ""
+	} else if w.Passphrase == "" && w.PSK == "" {
+		return errors.ValidationErrorf("The wireless network %s requires a passphrase", w.SSID)
+	}
+
+	if err := w.Validate(); err != nil {
+		return err
+	}
+
+	si.Wireless = w
+	return nil
+}
+
+func getX11Keyboard(si *SystemInstall) []string {
+	k := si.X11Keyboard
+	if k == nil {
+		k = &keyboard.X11Keymap{}
+	}
+
+	return []string{k.Layout, k.Variant, k.Model, strings.Join(k.Options, ",")}
+}
+
+func setX11Keyboard(si *SystemInstall, values []string) error {
+	k := &keyboard.X11Keymap{Layout: values[0], Variant: values[1], Model: values[2]}
+
+	for _, curr := range strings.Split(values[3], ",") {
+		if curr = strings.TrimSpace(curr); curr != "" {
+			k.Options = append(k.Options, curr)
+		}
+	}
+
+	if k.IsEmpty() {
+		si.X11Keyboard = nil
+		return nil
+	}
+
+	if err := k.Validate(); err != nil {
+		return err
+	}
+
+	si.X11Keyboard = k
+	return nil
+}
+
+func isSecretReference(ref string) bool {
+	return strings.HasPrefix(ref, "env:") || strings.HasPrefix(ref, "file:")
+}
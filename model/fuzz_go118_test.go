@@ -0,0 +1,46 @@
+//go:build go1.18
+// +build go1.18
+
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package model
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// FuzzLoadFile is seeded with the test descriptors and the generated fixtures,
+// the native fuzzing requires go 1.18
+func FuzzLoadFile(f *testing.F) {
+	descriptors, err := filepath.Glob(filepath.Join(testsDir, "*.yaml"))
+	if err != nil {
+		f.Fatal(err)
+	}
+
+	for _, curr := range descriptors {
+		data, err := ioutil.ReadFile(curr)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+
+	for _, curr := range generateFixtures("") {
+		f.Add([]byte(curr))
+	}
+
+	dir, err := ioutil.TempDir("", "clr-installer-test")
+	if err != nil {
+		f.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		loadFixture(t, dir, data)
+	})
+}
@@ -0,0 +1,111 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package model
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/clearlinux/clr-installer/args"
+)
+
+// fixtureKeys are the descriptor keys the generated fixtures set to
+// malformed values
+var fixtureKeys = []string{
+	"targetMedia", "bundles", "userBundles", "keyboard", "language",
+	"installerLanguage", "targetLocale", "timezone", "kernel", "telemetry",
+	"telemetryURL", "telemetryPolicy", "users", "hostname", "httpsProxy",
+	"noProxy", "postReboot", "postArchive", "postAction", "autoUpdate",
+	"kernel-arguments", "kernel-modules", "block-devices", "networkInterfaces",
+	"installerHosts", "installerDNS", "pre-install", "post-install",
+	"swupdMirror", "swupdTLS", "version", "copyNetwork", "cryptKeys",
+	"diagnostics", "updatePolicy", "bootMenu", "sysctl", "sysctlProfile",
+	"tmpfiles", "targetEnv", "webhook", "answers", "preChecks", "espPolicy",
+	"legacyBios", "iso", "keepImage",
+}
+
+// fixtureValues are the malformed values of the generated fixtures: wrong
+// types, huge values and unicode
+var fixtureValues = []string{
+	"~",
+	"true",
+	"-1",
+	"18446744073709551616",
+	"1e400",
+	"[]",
+	"{}",
+	"[[[[[[[[[[]]]]]]]]]]",
+	"{a: {b: {c: {d: {}}}}}",
+	"[~, ~]",
+	"[{name: ~, size: -1}]",
+	"[{children: [{children: [{size: 99999999999999999999T}]}]}]",
+	"\"\\u0000\"",
+	"\"ñ€𝄞\u202e\"",
+	"\"" + strings.Repeat("ä", 4096) + "\"",
+	"!!binary AAAA",
+	"&a [*a]",
+}
+
+// generateFixtures returns the descriptors of the LoadFile battery: the test
+// descriptors with every key of fixtureKeys set to every value of
+// fixtureValues, plus syntactically broken documents
+func generateFixtures(base string) []string {
+	result := []string{
+		"",
+		"---",
+		"- a\n- b",
+		":",
+		"targetMedia: [",
+		"\t\ttabs: 1",
+		"a: &a [*a, *a]\nb: *a",
+		strings.Repeat("- ", 1000) + "x",
+		"targetMedia:\n- children:\n  -",
+	}
+
+	for _, key := range fixtureKeys {
+		for _, value := range fixtureValues {
+			result = append(result, fmt.Sprintf("%s\n%s: %s\n", base, key, value))
+		}
+	}
+
+	return result
+}
+
+// loadFixture loads and validates a descriptor, the result doesn't matter
+// but the parser must not crash
+func loadFixture(t testing.TB, dir string, data []byte) {
+	file := filepath.Join(dir, "fixture.yaml")
+	if err := ioutil.WriteFile(file, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	si, err := LoadFile(file, args.Args{ConfigFile: file})
+	if err != nil {
+		return
+	}
+
+	_ = si.Validate()
+}
+
+func TestLoadFileFixtures(t *testing.T) {
+	base, err := ioutil.ReadFile(filepath.Join(testsDir, "valid-minimal.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "clr-installer-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	for _, curr := range generateFixtures(string(base)) {
+		loadFixture(t, dir, []byte(curr))
+	}
+}
@@ -0,0 +1,226 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/clearlinux/clr-installer/args"
+	"github.com/clearlinux/clr-installer/storage"
+)
+
+// updateGolden regenerates the golden plans of the tests/golden cases, each
+// case directory holds the install descriptor.yaml, the hardware.json lsblk
+// output of the installing system and the expected plan.golden partition
+// plan, mount files and kernel arguments: go test ./model -update-golden
+var updateGolden = flag.Bool("update-golden", false, "Regenerate the golden plan files")
+
+// loadGoldenHardware returns the current block devices of the case dir
+func loadGoldenHardware(dir string) ([]*storage.BlockDevice, error) {
+	content, err := ioutil.ReadFile(filepath.Join(dir, "hardware.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	root := struct {
+		BlockDevices []*storage.BlockDevice `json:"blockdevices"`
+	}{}
+
+	if err = json.Unmarshal(content, &root); err != nil {
+		return nil, err
+	}
+
+	return root.BlockDevices, nil
+}
+
+// mapGoldenMedias sets the mapped names of the encrypted partitions and the
+// logical volumes as they're set when the medias are written
+func mapGoldenMedias(medias []*storage.BlockDevice) {
+	for _, curr := range medias {
+		for _, ch := range curr.Children {
+			switch {
+			case curr.IsVolumeGroup():
+				ch.MappedName = filepath.Join(curr.Name, ch.Name)
+			case ch.Type == storage.BlockDeviceTypeCrypt && ch.FsType == "swap":
+				ch.MappedName = filepath.Join("mapper", "eswap-"+ch.Name)
+			case ch.Type == storage.BlockDeviceTypeCrypt && ch.MountPoint == "/":
+				ch.MappedName = filepath.Join("mapper", "root")
+			case ch.Type == storage.BlockDeviceTypeCrypt:
+				mapped := strings.TrimPrefix(ch.MountPoint, "/")
+				ch.MappedName = filepath.Join("mapper", strings.Replace(mapped, "/", "_", -1))
+			}
+		}
+	}
+}
+
+// writeGoldenMedia writes the planned bd and its children to buf
+func writeGoldenMedia(buf *bytes.Buffer, bd *storage.BlockDevice, indent string) {
+	fields := []string{bd.Name, bd.Type.String()}
+
+	values := []struct {
+		key   string
+		value string
+	}{
+		{"pttype", bd.PtType},
+		{"fstype", bd.FsType},
+		{"mountpoint", bd.MountPoint},
+		{"label", bd.Label},
+		{"encryption", bd.Encryption},
+		{"volumeGroup", bd.VolumeGroup},
+		{"level", bd.RAIDLevel},
+		{"members", strings.Join(bd.Members, ",")},
+	}
+
+	for _, curr := range values {
+		if curr.value != "" {
+			fields = append(fields, curr.key+"="+curr.value)
+		}
+	}
+
+	fields = append(fields, fmt.Sprintf("size=%d", bd.Size))
+
+	if bd.MakePartition {
+		fields = append(fields, "make")
+	}
+
+	if bd.FormatPartition {
+		fields = append(fields, "format")
+	}
+
+	if bd.Discard {
+		fields = append(fields, "discard")
+	}
+
+	fmt.Fprintf(buf, "%s%s\n", indent, strings.Join(fields, " "))
+
+	for _, ch := range bd.Children {
+		writeGoldenMedia(buf, ch, indent+"  ")
+	}
+}
+
+// writeGoldenFile writes the mount file of rootDir to buf, if any
+func writeGoldenFile(buf *bytes.Buffer, rootDir string, file string) error {
+	fmt.Fprintf(buf, "# %s\n", file)
+
+	content, err := ioutil.ReadFile(filepath.Join(rootDir, "etc", file))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	_, err = buf.Write(content)
+	return err
+}
+
+// planGolden plans the install of the case dir as the controller does for a
+// descriptor install and returns the resulting plan
+func planGolden(dir string) (string, error) {
+	md, err := LoadFile(filepath.Join(dir, "descriptor.yaml"), args.Args{})
+	if err != nil {
+		return "", err
+	}
+
+	// the passphrase is asked at install time
+	md.CryptPass = "golden-passphrase"
+
+	if err = md.Validate(); err != nil {
+		return "", err
+	}
+
+	current, err := loadGoldenHardware(dir)
+	if err != nil {
+		return "", err
+	}
+
+	// the descriptor installs use the whole disks
+	if err = storage.PlanPartitionTables(md.TargetMedias, current, true, md.PartitionTable); err != nil {
+		return "", err
+	}
+
+	if md.Trim == "" {
+		md.Trim = storage.SuggestTrimPolicy(md.TargetMedias, current)
+	}
+	storage.ApplyTrimPolicy(md.TargetMedias, md.Trim)
+	mapGoldenMedias(md.TargetMedias)
+
+	rootDir, err := ioutil.TempDir("", "clr-installer-golden")
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = os.RemoveAll(rootDir) }()
+
+	if err = storage.GenerateTabFiles(rootDir, md.TargetMedias); err != nil {
+		return "", err
+	}
+
+	buf := &bytes.Buffer{}
+
+	fmt.Fprintf(buf, "# partitions\n")
+	for _, curr := range md.TargetMedias {
+		writeGoldenMedia(buf, curr, "")
+	}
+
+	fmt.Fprintf(buf, "# trim\n%s\n", md.Trim)
+
+	for _, curr := range []string{"fstab", "crypttab"} {
+		if err = writeGoldenFile(buf, rootDir, curr); err != nil {
+			return "", err
+		}
+	}
+
+	fmt.Fprintf(buf, "# kernel arguments\n")
+	for _, curr := range storage.KernelArguments(md.TargetMedias) {
+		fmt.Fprintf(buf, "%s\n", curr)
+	}
+
+	return buf.String(), nil
+}
+
+func TestGoldenPlans(t *testing.T) {
+	cases, err := filepath.Glob(filepath.Join(testsDir, "golden", "*", "descriptor.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(cases) == 0 {
+		t.Fatal("No golden plan case found")
+	}
+
+	for _, curr := range cases {
+		dir := filepath.Dir(curr)
+		name := filepath.Base(dir)
+		goldenFile := filepath.Join(dir, "plan.golden")
+
+		plan, err := planGolden(dir)
+		if err != nil {
+			t.Fatalf("Failed to plan the %s case: %v", name, err)
+		}
+
+		if *updateGolden {
+			if err = ioutil.WriteFile(goldenFile, []byte(plan), 0644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+
+		expected, err := ioutil.ReadFile(goldenFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if plan != string(expected) {
+			t.Fatalf("The %s plan differs from %s, got:\n%s", name, goldenFile, plan)
+		}
+	}
+}
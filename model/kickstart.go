@@ -0,0 +1,494 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package model
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/clearlinux/clr-installer/args"
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/kernel"
+	"github.com/clearlinux/clr-installer/keyboard"
+	"github.com/clearlinux/clr-installer/language"
+	"github.com/clearlinux/clr-installer/log"
+	"github.com/clearlinux/clr-installer/storage"
+	"github.com/clearlinux/clr-installer/telemetry"
+	"github.com/clearlinux/clr-installer/timezone"
+	"github.com/clearlinux/clr-installer/user"
+	"github.com/clearlinux/clr-installer/utils"
+)
+
+const (
+	// kickstartKernel is the kernel installed from a kickstart descriptor,
+	// the kickstart kernel packages don't map to a Clear Linux kernel
+	kickstartKernel = "kernel-native"
+
+	// kickstartAdminGroup is the group of the kickstart administrators
+	kickstartAdminGroup = "wheel"
+)
+
+// kickstartBaseBundles are always installed, the base system of a kickstart
+// install is implicit
+var kickstartBaseBundles = []string{"os-core", "os-core-update"}
+
+// kickstartPackages maps the common kickstart packages and groups to the
+// Clear Linux bundles, an empty bundle means the package is part of the
+// base bundles; the other packages are installed as the same named bundle
+var kickstartPackages = map[string]string{
+	"@core":                        "",
+	"@base":                        "",
+	"@^minimal-environment":        "",
+	"@^server-product-environment": "",
+	"kernel":                       "",
+	"@development-tools":           "c-basic",
+	"@development":                 "c-basic",
+	"@container-management":        "containers-basic",
+	"podman":                       "containers-basic",
+	"docker":                       "containers-basic",
+	"python3":                      "python3-basic",
+	"vim-enhanced":                 "vim",
+}
+
+// kickstartFlags are the kickstart options without a value, the other
+// options may be written either as --name=value or --name value
+var kickstartFlags = []string{
+	"all", "encrypted", "erroronfail", "grow", "iscrypted", "lock",
+	"noformat", "nochroot", "none", "plaintext", "recommended", "utc", "isUtc",
+}
+
+// kickstartAutoPartitions is the autopart layout, the same as the standard
+// partitions of storage.NewStandardPartitions
+var kickstartAutoPartitions = []*storage.BlockDevice{
+	{FsType: "vfat", MountPoint: "/boot", Size: 150 * (1000 * 1000)},
+	{FsType: "swap", Size: 256 * (1000 * 1000)},
+	{FsType: "ext4", MountPoint: "/"},
+}
+
+// kickstart is the state of a kickstart descriptor conversion
+type kickstart struct {
+	si       *SystemInstall
+	drives   []string
+	autopart bool
+	parts    []*kickstartPart
+}
+
+// kickstartPart is a partition of a kickstart descriptor and its disk, the
+// disk may be set later by the ignoredisk or clearpart directives
+type kickstartPart struct {
+	disk string
+	bd   *storage.BlockDevice
+}
+
+// LoadKickstart loads a model from the kickstart (Anaconda) descriptor pointed
+// by path, the partitioning, users, hostname, packages and scripts are
+// converted; the unsupported directives are ignored with a warning
+func LoadKickstart(path string, options args.Args) (*SystemInstall, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+
+	result := &SystemInstall{}
+	result.Default()
+
+	// the kickstart installs have no telemetry acknowledgement
+	result.Telemetry = &telemetry.Telemetry{Enabled: false}
+	result.Kernel = &kernel.Kernel{Bundle: kickstartKernel}
+	for _, curr := range kickstartBaseBundles {
+		result.AddBundle(curr)
+	}
+
+	ks := &kickstart{si: result}
+	if err = ks.parse(strings.Split(string(content), "\n")); err != nil {
+		return nil, errors.ValidationErrorf("Invalid kickstart file %s: %v", path, err)
+	}
+
+	if err = ks.addTargetMedias(); err != nil {
+		return nil, errors.ValidationErrorf("Invalid kickstart file %s: %v", path, err)
+	}
+
+	if err = result.expandStorageAliases(options); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// parse converts the kickstart lines, the %sections span to their %end line
+func (ks *kickstart) parse(lines []string) error {
+	for idx := 0; idx < len(lines); idx++ {
+		words, err := splitKickstartLine(lines[idx])
+		if err != nil {
+			return errors.ValidationErrorf("line %d: %v", idx+1, err)
+		}
+
+		if len(words) == 0 {
+			continue
+		}
+
+		if !strings.HasPrefix(words[0], "%") {
+			if err = ks.directive(words); err != nil {
+				return errors.ValidationErrorf("line %d: %v", idx+1, err)
+			}
+			continue
+		}
+
+		start := idx
+		body := []string{}
+
+		for idx++; idx < len(lines) && strings.TrimSpace(lines[idx]) != "%end"; idx++ {
+			body = append(body, lines[idx])
+		}
+
+		if idx == len(lines) {
+			return errors.ValidationErrorf("line %d: %s section without %%end", start+1, words[0])
+		}
+
+		ks.section(words, body)
+	}
+
+	return nil
+}
+
+// directive converts a single kickstart command
+func (ks *kickstart) directive(words []string) error {
+	opts, pos := parseKickstartOptions(words[1:])
+
+	switch words[0] {
+	case "lang":
+		if len(pos) > 0 {
+			ks.si.Language = &language.Language{Code: pos[0]}
+		}
+	case "keyboard":
+		code := opts["vckeymap"]
+		if code == "" && len(pos) > 0 {
+			code = pos[0]
+		}
+		if code == "" && opts["xlayouts"] != "" {
+			code = strings.Split(opts["xlayouts"], ",")[0]
+		}
+		if code != "" {
+			ks.si.Keyboard = &keyboard.Keymap{Code: code}
+		}
+	case "timezone":
+		if len(pos) > 0 {
+			ks.si.Timezone = &timezone.TimeZone{Code: pos[0]}
+		}
+	case "network":
+		if opts["hostname"] != "" {
+			ks.si.Hostname = opts["hostname"]
+		}
+	case "user":
+		return ks.user(opts)
+	case "sshkey":
+		return ks.sshKey(opts, pos)
+	case "part", "partition":
+		return ks.partition(opts, pos)
+	case "autopart":
+		ks.autopart = true
+	case "ignoredisk":
+		ks.addDrives(opts["only-use"])
+	case "clearpart":
+		ks.addDrives(opts["drives"])
+	case "bootloader":
+		if opts["append"] != "" {
+			ks.si.KernelArguments = &kernel.Arguments{Add: strings.Fields(opts["append"])}
+		}
+	case "reboot":
+		ks.si.PostAction = PostActionReboot
+	case "poweroff", "shutdown":
+		ks.si.PostAction = PostActionPoweroff
+	case "halt":
+		ks.si.PostAction = PostActionStay
+	default:
+		log.Warning("Ignoring the unsupported kickstart directive: %s", words[0])
+	}
+
+	return nil
+}
+
+// section converts a kickstart %section, the packages and the scripts
+func (ks *kickstart) section(words []string, body []string) {
+	opts, _ := parseKickstartOptions(words[1:])
+
+	switch words[0] {
+	case "%packages":
+		ks.packages(body)
+	case "%pre":
+		ks.si.PreInstall = append(ks.si.PreInstall, kickstartHook(opts, body, false))
+	case "%post":
+		_, nochroot := opts["nochroot"]
+		ks.si.PostInstall = append(ks.si.PostInstall, kickstartHook(opts, body, !nochroot))
+	default:
+		log.Warning("Ignoring the unsupported kickstart section: %s", words[0])
+	}
+}
+
+// packages adds the bundles of the %packages section, the excluded packages
+// are ignored
+func (ks *kickstart) packages(body []string) {
+	for _, curr := range body {
+		pkg := strings.TrimSpace(curr)
+
+		if pkg == "" || strings.HasPrefix(pkg, "#") || strings.HasPrefix(pkg, "-") {
+			continue
+		}
+
+		bundle, ok := kickstartPackages[pkg]
+		if !ok {
+			bundle = strings.TrimLeft(pkg, "@^")
+		}
+
+		if bundle != "" {
+			ks.si.AddBundle(bundle)
+		}
+	}
+}
+
+// kickstartHook returns the install hook running a kickstart script, the
+// scripts with an interpreter read their body from stdin
+func kickstartHook(opts map[string]string, body []string, chroot bool) *InstallHook {
+	script := strings.Join(body, "\n")
+
+	if interp := opts["interpreter"]; interp != "" && !strings.HasSuffix(interp, "bash") {
+		script = fmt.Sprintf("%s <<'KICKSTART_EOF'\n%s\nKICKSTART_EOF", interp, script)
+	}
+
+	if _, ok := opts["log"]; ok {
+		log.Warning("Ignoring the kickstart script log, the output is in the installer log")
+	}
+
+	return &InstallHook{Chroot: chroot, Cmd: script}
+}
+
+// user adds the user of a user directive, members of the wheel group are
+// administrators
+func (ks *kickstart) user(opts map[string]string) error {
+	if opts["name"] == "" {
+		return errors.ValidationErrorf("user requires --name")
+	}
+
+	usr := &user.User{
+		Login:    opts["name"],
+		UserName: opts["gecos"],
+	}
+
+	for _, curr := range strings.Split(opts["groups"], ",") {
+		if strings.TrimSpace(curr) == kickstartAdminGroup {
+			usr.Admin = true
+		}
+	}
+
+	if _, ok := opts["iscrypted"]; ok {
+		usr.Password = opts["password"]
+	} else if opts["password"] != "" {
+		if err := usr.SetPassword(opts["password"]); err != nil {
+			return err
+		}
+	}
+
+	ks.si.AddUser(usr)
+	return nil
+}
+
+// sshKey adds the key of a sshkey directive to its, previously declared, user
+func (ks *kickstart) sshKey(opts map[string]string, pos []string) error {
+	if len(pos) == 0 {
+		return errors.ValidationErrorf("sshkey requires a key")
+	}
+
+	for _, curr := range ks.si.Users {
+		if curr.Login == opts["username"] {
+			curr.SSHKeys = append(curr.SSHKeys, pos[0])
+			return nil
+		}
+	}
+
+	log.Warning("Ignoring the ssh key of the undeclared user: %s", opts["username"])
+	return nil
+}
+
+// partition adds the partition of a part directive, the sizes are in MiB and
+// the growing partition uses the rest of the disk
+func (ks *kickstart) partition(opts map[string]string, pos []string) error {
+	if len(pos) == 0 {
+		return errors.ValidationErrorf("part requires a mount point")
+	}
+
+	bd := &storage.BlockDevice{
+		Type:   storage.BlockDeviceTypePart,
+		FsType: opts["fstype"],
+		Label:  opts["label"],
+	}
+
+	switch mnt := pos[0]; {
+	case mnt == "swap":
+		bd.FsType = "swap"
+	case mnt == "biosboot":
+		log.Warning("Ignoring the kickstart biosboot partition")
+		return nil
+	case mnt == "/boot/efi" || bd.FsType == "efi":
+		bd.FsType = "vfat"
+		bd.MountPoint = "/boot"
+	case strings.HasPrefix(mnt, "/"):
+		bd.MountPoint = mnt
+	default:
+		return errors.ValidationErrorf("Unsupported partition %q, RAID and LVM members are not converted", mnt)
+	}
+
+	if bd.FsType == "" {
+		bd.FsType = "ext4"
+	}
+
+	if _, ok := opts["grow"]; !ok {
+		size, err := strconv.ParseUint(opts["size"], 10, 64)
+		if err != nil {
+			return errors.ValidationErrorf("part %s requires --size or --grow", pos[0])
+		}
+
+		bd.Size = size * 1024 * 1024
+	}
+
+	disk := opts["ondisk"]
+	if disk == "" {
+		disk = opts["ondrive"]
+	}
+
+	ks.parts = append(ks.parts, &kickstartPart{disk: strings.TrimPrefix(disk, "/dev/"), bd: bd})
+	return nil
+}
+
+// addDrives adds the comma separated drives of the ignoredisk and clearpart
+// directives, the first one is the default disk
+func (ks *kickstart) addDrives(drives string) {
+	for _, curr := range strings.Split(drives, ",") {
+		if curr = strings.TrimPrefix(strings.TrimSpace(curr), "/dev/"); curr != "" {
+			ks.drives = append(ks.drives, curr)
+		}
+	}
+}
+
+// addTargetMedias adds the disks of the partitions as storage aliases of
+// their device file, the autopart layout is used if no partition is declared
+func (ks *kickstart) addTargetMedias() error {
+	if ks.autopart && len(ks.parts) == 0 {
+		for _, curr := range kickstartAutoPartitions {
+			bd := curr.Clone()
+			bd.Type = storage.BlockDeviceTypePart
+			ks.parts = append(ks.parts, &kickstartPart{bd: bd})
+		}
+	}
+
+	disks := map[string]*storage.BlockDevice{}
+
+	for _, curr := range ks.parts {
+		name := curr.disk
+		if name == "" {
+			if len(ks.drives) == 0 {
+				return errors.ValidationErrorf("The partitions disk must be set with --ondisk, ignoredisk or clearpart")
+			}
+			name = ks.drives[0]
+		}
+
+		disk, ok := disks[name]
+		if !ok {
+			disk = &storage.BlockDevice{
+				Name: fmt.Sprintf("${%s}", name),
+				Type: storage.BlockDeviceTypeDisk,
+			}
+			disks[name] = disk
+
+			ks.si.StorageAlias = append(ks.si.StorageAlias, &StorageAlias{Name: name, File: "/dev/" + name})
+			ks.si.AddTargetMedia(disk)
+		}
+
+		curr.bd.Name = fmt.Sprintf("${%s}%d", name, len(disk.Children)+1)
+		curr.bd.MakePartition = true
+		curr.bd.FormatPartition = true
+		disk.AddChild(curr.bd)
+	}
+
+	return nil
+}
+
+// parseKickstartOptions splits the words of a kickstart command in its
+// options, by name without the dashes, and its positional arguments
+func parseKickstartOptions(words []string) (map[string]string, []string) {
+	opts := map[string]string{}
+	pos := []string{}
+
+	for idx := 0; idx < len(words); idx++ {
+		curr := words[idx]
+
+		if !strings.HasPrefix(curr, "--") {
+			pos = append(pos, curr)
+			continue
+		}
+
+		name := strings.TrimPrefix(curr, "--")
+		if tks := strings.SplitN(name, "=", 2); len(tks) == 2 {
+			opts[tks[0]] = tks[1]
+			continue
+		}
+
+		value := ""
+		if !utils.StringSliceContains(kickstartFlags, name) && idx+1 < len(words) && !strings.HasPrefix(words[idx+1], "--") {
+			idx++
+			value = words[idx]
+		}
+
+		opts[name] = value
+	}
+
+	return opts, pos
+}
+
+// splitKickstartLine splits a kickstart line in its shell like words, the
+// quotes are removed and the comments dropped
+func splitKickstartLine(line string) ([]string, error) {
+	var word strings.Builder
+
+	words := []string{}
+	inWord := false
+	quote := rune(0)
+
+	for _, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t' || r == '\r':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		case r == '#' && !inWord:
+			return words, nil
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, errors.ValidationErrorf("Unterminated quote: %s", strings.TrimSpace(line))
+	}
+
+	if inWord {
+		words = append(words, word.String())
+	}
+
+	return words, nil
+}
@@ -9,21 +9,22 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"time"
 
 	"gopkg.in/yaml.v2"
 
 	"github.com/clearlinux/clr-installer/args"
+	"github.com/clearlinux/clr-installer/bmc"
+	"github.com/clearlinux/clr-installer/conf"
 	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/facts"
 	"github.com/clearlinux/clr-installer/kernel"
-	"github.com/clearlinux/clr-installer/keyboard"
-	"github.com/clearlinux/clr-installer/language"
-	"github.com/clearlinux/clr-installer/network"
+	"github.com/clearlinux/clr-installer/sanitize"
 	"github.com/clearlinux/clr-installer/storage"
+	"github.com/clearlinux/clr-installer/syscheck"
 	"github.com/clearlinux/clr-installer/telemetry"
-	"github.com/clearlinux/clr-installer/timezone"
-	"github.com/clearlinux/clr-installer/user"
 	"github.com/clearlinux/clr-installer/utils"
 )
 
@@ -32,8 +33,23 @@ const (
 	// when running in demo (aka documentation mode). We will
 	// now use this as a flag to not include the version in UI.
 	DemoVersion = "X.Y.Z"
+
+	// PostActionStay keeps the installer running after a successful install
+	PostActionStay = "stay"
+
+	// PostActionReboot reboots the system after a successful install
+	PostActionReboot = "reboot"
+
+	// PostActionPoweroff powers off the system after a successful install
+	PostActionPoweroff = "poweroff"
+
+	// PostActionKexec boots the installed kernel with kexec after a successful install
+	PostActionKexec = "kexec"
 )
 
+// PostActions is the list of supported post install actions
+var PostActions = []string{PostActionStay, PostActionReboot, PostActionPoweroff, PostActionKexec}
+
 // Version of Clear Installer.
 // Also used by the Makefile for releases.
 // Default to the version of the program
@@ -48,42 +64,28 @@ var testAlias = []string{}
 // SystemInstall represents the system install "configuration", the target
 // medias, bundles to install and whatever state a install may require
 type SystemInstall struct {
-	// Even though TargetMedias is an array, we currently only support
-	// it containing a single BlockDevice which matches/maps to the InstallTarget
-	// TODO: Change InstallSelected to be a map with the key being the
-	// device name for which it holds InstallTarget information when/if
-	// we add support for installing across multiple disks.
-	InstallSelected   storage.InstallTarget  `yaml:"-"`
-	TargetMedias      []*storage.BlockDevice `yaml:"targetMedia"`
-	NetworkInterfaces []*network.Interface   `yaml:"networkInterfaces,omitempty,flow"`
-	Keyboard          *keyboard.Keymap       `yaml:"keyboard,omitempty,flow"`
-	Language          *language.Language     `yaml:"language,omitempty,flow"`
-	Bundles           []string               `yaml:"bundles,omitempty,flow"`
-	UserBundles       []string               `yaml:"userBundles,omitempty,flow"`
-	HTTPSProxy        string                 `yaml:"httpsProxy,omitempty,flow"`
-	Telemetry         *telemetry.Telemetry   `yaml:"telemetry,omitempty,flow"`
-	Timezone          *timezone.TimeZone     `yaml:"timezone,omitempty,flow"`
-	Users             []*user.User           `yaml:"users,omitempty,flow"`
-	KernelArguments   *kernel.Arguments      `yaml:"kernel-arguments,omitempty,flow"`
-	Kernel            *kernel.Kernel         `yaml:"kernel,omitempty,flow"`
-	PostReboot        bool                   `yaml:"postReboot,omitempty,flow"`
-	SwupdMirror       string                 `yaml:"swupdMirror,omitempty,flow"`
-	PostArchive       bool                   `yaml:"postArchive,omitempty,flow"`
-	Hostname          string                 `yaml:"hostname,omitempty,flow"`
-	AutoUpdate        bool                   `yaml:"autoUpdate,omitempty,flow"`
-	TelemetryURL      string                 `yaml:"telemetryURL,omitempty,flow"`
-	TelemetryTID      string                 `yaml:"telemetryTID,omitempty,flow"`
-	TelemetryPolicy   string                 `yaml:"telemetryPolicy,omitempty,flow"`
-	PreInstall        []*InstallHook         `yaml:"pre-install,omitempty,flow"`
-	PostInstall       []*InstallHook         `yaml:"post-install,omitempty,flow"`
-	Version           uint                   `yaml:"version,omitempty,flow"`
-	StorageAlias      []*StorageAlias        `yaml:"block-devices,omitempty,flow"`
-	LegacyBios        bool                   `yaml:"legacyBios,omitempty,flow"`
-	CopyNetwork       bool                   `yaml:"copyNetwork,omitempty,flow"`
-	Environment       map[string]string      `yaml:"env,omitempty,flow"`
-	CryptPass         string                 `yaml:"-"`
-	MakeISO           bool                   `yaml:"iso,omitempty,flow"`
-	KeepImage         bool                   `yaml:"keepImage,omitempty,flow"`
+	StorageConfig  `yaml:",inline"`
+	NetworkConfig  `yaml:",inline"`
+	SoftwareConfig `yaml:",inline"`
+	IdentityConfig `yaml:",inline"`
+
+	Telemetry       *telemetry.Telemetry `yaml:"telemetry,omitempty,flow"`
+	PostReboot      bool                 `yaml:"postReboot,omitempty,flow"`
+	PostArchive     bool                 `yaml:"postArchive,omitempty,flow"`
+	PostAction      string               `yaml:"postAction,omitempty,flow"`
+	TelemetryURL    string               `yaml:"telemetryURL,omitempty,flow"`
+	TelemetryTID    string               `yaml:"telemetryTID,omitempty,flow"`
+	TelemetryPolicy string               `yaml:"telemetryPolicy,omitempty,flow"`
+	Webhook         string               `yaml:"webhook,omitempty,flow"`
+	Answers         *PromptAnswers       `yaml:"answers,omitempty,flow"`
+	PreInstall      []*InstallHook       `yaml:"pre-install,omitempty,flow"`
+	PostInstall     []*InstallHook       `yaml:"post-install,omitempty,flow"`
+	Environment     map[string]string    `yaml:"env,omitempty,flow"`
+	PreChecks       map[string]string    `yaml:"preChecks,omitempty,flow"`
+	Offline         bool                 `yaml:"offline,omitempty,flow"`
+	OfflineContent  string               `yaml:"offlineContent,omitempty,flow"`
+	MeasuredBoot    string               `yaml:"measuredBoot,omitempty,flow"`
+	BMC             *bmc.Config          `yaml:"bmc,omitempty,flow"`
 }
 
 // InstallHook is a commands to be executed in a given point of the install process
@@ -105,213 +107,152 @@ type StorageAlias struct {
 	DeviceFile bool   `yaml:"devicefile,omitempty,flow"`
 }
 
-// AddExtraKernelArguments adds a set of custom extra kernel arguments to be added to the
-// clr-boot-manager configuration
-func (si *SystemInstall) AddExtraKernelArguments(args []string) {
-	if si.KernelArguments == nil {
-		si.KernelArguments = &kernel.Arguments{}
-	}
-
-	for _, curr := range args {
-		if utils.StringSliceContains(si.KernelArguments.Add, curr) {
-			continue
-		}
-
-		si.KernelArguments.Add = append(si.KernelArguments.Add, curr)
+// Sections returns the composable sections of the model
+func (si *SystemInstall) Sections() []Section {
+	return []Section{
+		&si.StorageConfig,
+		&si.NetworkConfig,
+		&si.IdentityConfig,
+		&si.SoftwareConfig,
 	}
 }
 
-// RemoveKernelArguments adds a set of kernel arguments to be "black listed" on
-// clear-boot-manager, meaning these arguments will never end up in the boot manager
-// entry configuration
-func (si *SystemInstall) RemoveKernelArguments(args []string) {
-	if si.KernelArguments == nil {
-		si.KernelArguments = &kernel.Arguments{}
+// Default sets the model default values, including the default values of
+// all its sections
+func (si *SystemInstall) Default() {
+	for _, section := range si.Sections() {
+		section.Default()
 	}
 
-	for _, curr := range args {
-		if utils.StringSliceContains(si.KernelArguments.Remove, curr) {
-			continue
-		}
-
-		si.KernelArguments.Remove = append(si.KernelArguments.Remove, curr)
-	}
+	// Default to archiving by default
+	si.PostArchive = true
 }
 
-// ContainsBundle returns true if the data model has a bundle and false otherwise
-func (si *SystemInstall) ContainsBundle(bundle string) bool {
-	for _, curr := range si.Bundles {
-		if curr == bundle {
-			return true
-		}
+// Validate checks the model for possible inconsistencies or "minimum required"
+// information
+func (si *SystemInstall) Validate() error {
+	// si will be nil if we fail to unmarshall (coverage tests has a case for that)
+	if si == nil {
+		return errors.ValidationErrorf("model is nil")
 	}
 
-	return false
-}
-
-// RemoveBundle removes a bundle from the data model
-func (si *SystemInstall) RemoveBundle(bundle string) {
-	bundles := []string{}
-
-	for _, curr := range si.Bundles {
-		if curr != bundle {
-			bundles = append(bundles, curr)
-		}
+	if err := si.StorageConfig.Validate(); err != nil {
+		return err
 	}
 
-	si.Bundles = bundles
+	return si.ValidateContent()
 }
 
-// AddBundle adds a new bundle to the data model, we make sure to not duplicate entries
-func (si *SystemInstall) AddBundle(bundle string) {
-	for _, curr := range si.Bundles {
-		if curr == bundle {
-			return
-		}
+// ValidateContent checks the model but its storage configuration, that is what
+// an install to a directory requires
+func (si *SystemInstall) ValidateContent() error {
+	if si == nil {
+		return errors.ValidationErrorf("model is nil")
 	}
 
-	si.Bundles = append(si.Bundles, bundle)
-}
-
-// ContainsUserBundle returns true if the data model has a user bundle and false otherwise
-func (si *SystemInstall) ContainsUserBundle(bundle string) bool {
-	for _, curr := range si.UserBundles {
-		if curr == bundle {
-			return true
-		}
+	if err := si.NetworkConfig.Validate(); err != nil {
+		return err
 	}
 
-	return false
-}
-
-// RemoveUserBundle removes a user bundle from the data model
-func (si *SystemInstall) RemoveUserBundle(bundle string) {
-	bundles := []string{}
-
-	for _, curr := range si.UserBundles {
-		if curr != bundle {
-			bundles = append(bundles, curr)
-		}
+	if err := si.IdentityConfig.Validate(); err != nil {
+		return err
 	}
 
-	si.UserBundles = bundles
-}
-
-// AddUserBundle adds a new user bundle to the data model, we make sure to not duplicate entries
-func (si *SystemInstall) AddUserBundle(bundle string) {
-	for _, curr := range si.UserBundles {
-		if curr == bundle {
-			return
-		}
+	if si.Telemetry == nil {
+		return errors.ValidationErrorf("Telemetry not acknowledged")
 	}
 
-	si.UserBundles = append([]string{bundle}, si.UserBundles...)
-}
-
-// RemoveAllUsers remove from the data model all previously added user
-func (si *SystemInstall) RemoveAllUsers() {
-	si.Users = []*user.User{}
-}
-
-// AddUser adds a new user to the data model, this function also prevents duplicate entries
-func (si *SystemInstall) AddUser(usr *user.User) {
-	for _, curr := range si.Users {
-		if curr.Equals(usr) {
-			return
-		}
+	if err := si.SoftwareConfig.Validate(); err != nil {
+		return err
 	}
 
-	si.Users = append(si.Users, usr)
-}
-
-// EncryptionRequiresPassphrase checks all partition to see if encryption was enabled
-func (si *SystemInstall) EncryptionRequiresPassphrase() bool {
-	enabled := false
-
-	for _, curr := range si.TargetMedias {
-		enabled = enabled || curr.EncryptionRequiresPassphrase()
+	if si.PostAction != "" && !utils.StringSliceContains(PostActions, si.PostAction) {
+		return errors.ValidationErrorf("Invalid post install action %q, must be one of: %s",
+			si.PostAction, strings.Join(PostActions, ", "))
 	}
 
-	return enabled
-}
+	if err := sanitize.Check("telemetry URL", si.TelemetryURL, sanitize.MaxURLLength); err != nil {
+		return err
+	}
 
-// Validate checks the model for possible inconsistencies or "minimum required"
-// information
-func (si *SystemInstall) Validate() error {
-	// si will be nil if we fail to unmarshall (coverage tests has a case for that)
-	if si == nil {
-		return errors.ValidationErrorf("model is nil")
+	if err := sanitize.Check("webhook URL", si.Webhook, sanitize.MaxURLLength); err != nil {
+		return err
 	}
 
-	if si.TargetMedias == nil || len(si.TargetMedias) == 0 {
-		return errors.ValidationErrorf("System Installation must provide a target media")
+	if si.Webhook != "" && !strings.HasPrefix(si.Webhook, "http://") &&
+		!strings.HasPrefix(si.Webhook, "https://") {
+		return errors.ValidationErrorf("Invalid webhook URL %q, only http and https are supported", si.Webhook)
 	}
 
-	for _, curr := range si.TargetMedias {
-		if err := curr.Validate(si.LegacyBios, si.CryptPass); err != nil {
+	if si.Answers != nil {
+		if err := si.Answers.Validate(); err != nil {
 			return err
 		}
 	}
 
-	if si.Timezone == nil {
-		return errors.ValidationErrorf("Timezone not set")
+	if si.Offline && si.SwupdMirror != "" {
+		return errors.ValidationErrorf("The swupd mirror can not be used by an offline install")
 	}
 
-	if si.Keyboard == nil {
-		return errors.ValidationErrorf("Keyboard not set")
+	if si.OfflineContent != "" && !filepath.IsAbs(si.OfflineContent) {
+		return errors.ValidationErrorf("Invalid offline content %q, must be an absolute path", si.OfflineContent)
 	}
 
-	if si.Language == nil {
-		return errors.ValidationErrorf("System Language not set")
-	}
+	if si.MeasuredBoot != "" {
+		if si.MeasuredBoot != syscheck.PolicyWarn && si.MeasuredBoot != syscheck.PolicyFail {
+			return errors.ValidationErrorf("Invalid measured boot policy %q, must be one of: %s, %s",
+				si.MeasuredBoot, syscheck.PolicyWarn, syscheck.PolicyFail)
+		}
 
-	if si.Telemetry == nil {
-		return errors.ValidationErrorf("Telemetry not acknowledged")
+		if si.LegacyBios {
+			return errors.ValidationErrorf("The measured boot requires an EFI install")
+		}
 	}
 
-	if si.Kernel == nil {
-		return errors.ValidationErrorf("A kernel must be provided")
+	if si.BMC != nil {
+		if err := si.BMC.Validate(); err != nil {
+			return err
+		}
 	}
 
-	return nil
-}
+	if err := validateHooks("pre-install", si.PreInstall); err != nil {
+		return err
+	}
 
-// AddTargetMedia adds a BlockDevice instance to the list of TargetMedias
-// if bd was previously added to as a target media its pointer is updated
-func (si *SystemInstall) AddTargetMedia(bd *storage.BlockDevice) {
-	if si.TargetMedias == nil {
-		si.TargetMedias = []*storage.BlockDevice{}
+	if err := validateHooks("post-install", si.PostInstall); err != nil {
+		return err
 	}
 
-	nList := []*storage.BlockDevice{bd}
+	return syscheck.ValidatePolicies(si.PreChecks)
+}
 
-	for _, curr := range si.TargetMedias {
-		if !bd.Equals(curr) {
-			nList = append(nList, curr)
+// validateHooks checks every hook of the name section has a command
+func validateHooks(name string, hooks []*InstallHook) error {
+	for idx, curr := range hooks {
+		if curr == nil || strings.TrimSpace(curr.Cmd) == "" {
+			return errors.ValidationErrorf("The %s hook %d has no command", name, idx+1)
 		}
 	}
 
-	si.TargetMedias = nList
+	return nil
 }
 
-// AddNetworkInterface adds an Interface instance to the list of NetworkInterfaces
-func (si *SystemInstall) AddNetworkInterface(iface *network.Interface) {
-	if si.NetworkInterfaces == nil {
-		si.NetworkInterfaces = []*network.Interface{}
+// OfflineContentDir returns the swupd content directory used by the offline
+// installs, the install media one if not configured
+func (si *SystemInstall) OfflineContentDir() string {
+	if si.OfflineContent != "" {
+		return si.OfflineContent
 	}
 
-	si.NetworkInterfaces = append(si.NetworkInterfaces, iface)
+	return conf.OfflineContentDir
 }
 
 // LoadFile loads a model from a yaml file pointed by path
 func LoadFile(path string, options args.Args) (*SystemInstall, error) {
 	var result SystemInstall
 
-	// Default to archiving by default
-	result.PostArchive = true
-
-	// Default to Auto Updating enabled by default
-	result.AutoUpdate = true
+	// Set the defaults first, the loaded values take precedence
+	result.Default()
 
 	if _, err := os.Stat(path); err == nil {
 		configStr, err := ioutil.ReadFile(path)
@@ -323,21 +264,14 @@ func LoadFile(path string, options args.Args) (*SystemInstall, error) {
 		if err != nil {
 			return nil, errors.Wrap(err)
 		}
-	}
-
-	// Set default Timezone if not defined
-	if result.Timezone == nil {
-		result.Timezone = &timezone.TimeZone{Code: timezone.DefaultTimezone}
-	}
 
-	// Set default Keyboard if not defined
-	if result.Keyboard == nil {
-		result.Keyboard = &keyboard.Keymap{Code: keyboard.DefaultKeyboard}
-	}
+		if err = checkEmptyEntries(reflect.ValueOf(result)); err != nil {
+			return nil, err
+		}
 
-	// Set default Language if not defined
-	if result.Language == nil {
-		result.Language = &language.Language{Code: language.DefaultLanguage}
+		if err = expandFacts(&result, configStr, options); err != nil {
+			return nil, err
+		}
 	}
 
 	// Running in VirtualBox force the default to 'kernel-lts' if
@@ -347,9 +281,126 @@ func LoadFile(path string, options args.Args) (*SystemInstall, error) {
 		result.Kernel = &kernel.Kernel{Bundle: "kernel-lts"}
 	}
 
+	if err := result.expandStorageAliases(options); err != nil {
+		return nil, err
+	}
+
+	if result.Version > 0 {
+		result.AutoUpdate = false
+	}
+
+	return &result, nil
+}
+
+// LoadOverlay loads the overlay descriptor of path on top of base, see Merge
+// for the precedence rules
+func LoadOverlay(base *SystemInstall, path string, options args.Args) (*SystemInstall, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+
+	result, err := Merge(base, content)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = expandFacts(result, content, options); err != nil {
+		return nil, err
+	}
+
+	// the base target medias are expanded already, their aliases would be
+	// dropped as not in use anymore
+	keys := map[string]interface{}{}
+	if err = yaml.Unmarshal(content, &keys); err != nil {
+		return nil, errors.Wrap(err)
+	}
+
+	if _, ok := keys["targetMedia"]; ok {
+		if err = result.expandStorageAliases(options); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// expandFacts expands the machine facts template variables, i.e ${dmiSerial}
+// or the mapping file columns, of the string fields of the loaded si. They're
+// expanded once content is parsed so a value never changes the descriptor
+// structure, the facts are only read if content uses a variable.
+func expandFacts(si *SystemInstall, content []byte, options args.Args) error {
+	if !strings.Contains(string(content), "${") {
+		return nil
+	}
+
+	mf, err := facts.Load(options.FactsMap)
+	if err != nil {
+		return err
+	}
+
+	return expandStrings(reflect.ValueOf(si).Elem(), mf.Expand, map[uintptr]bool{})
+}
+
+// expandStrings replaces the settable strings of v, and of the structs,
+// pointers, slices and string maps it holds, with their expand result
+func expandStrings(v reflect.Value, expand func(string) (string, error), visited map[uintptr]bool) error {
+	switch v.Kind() {
+	case reflect.String:
+		if !v.CanSet() {
+			return nil
+		}
+
+		expanded, err := expand(v.String())
+		if err != nil {
+			return err
+		}
+
+		v.SetString(expanded)
+	case reflect.Ptr:
+		// the block devices point back to their parent
+		if v.IsNil() || visited[v.Pointer()] {
+			return nil
+		}
+
+		visited[v.Pointer()] = true
+		return expandStrings(v.Elem(), expand, visited)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if err := expandStrings(v.Field(i), expand, visited); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			if err := expandStrings(v.Index(i), expand, visited); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if !v.CanInterface() || v.Type().Elem().Kind() != reflect.String {
+			return nil
+		}
+
+		for _, key := range v.MapKeys() {
+			expanded, err := expand(v.MapIndex(key).String())
+			if err != nil {
+				return err
+			}
+
+			v.SetMapIndex(key, reflect.ValueOf(expanded).Convert(v.Type().Elem()))
+		}
+	}
+
+	return nil
+}
+
+// expandStorageAliases merges the block devices aliases of options and
+// expands the target medias names with the aliases in use
+func (si *SystemInstall) expandStorageAliases(options args.Args) error {
 	tmp := map[string]*StorageAlias{}
 
-	for _, bds := range result.StorageAlias {
+	for _, bds := range si.StorageAlias {
 		tmp[bds.Name] = bds
 	}
 
@@ -363,18 +414,18 @@ func LoadFile(path string, options args.Args) (*SystemInstall, error) {
 		tmp[tks[0]] = &StorageAlias{Name: tks[0], File: tks[1]}
 	}
 
-	result.StorageAlias = []*StorageAlias{}
+	si.StorageAlias = []*StorageAlias{}
 
 	for _, bds := range tmp {
-		result.StorageAlias = append(result.StorageAlias, bds)
+		si.StorageAlias = append(si.StorageAlias, bds)
 	}
 
-	if len(result.StorageAlias) > 0 {
+	if len(si.StorageAlias) > 0 {
 		alias := map[string]string{}
 		keepMe := []*StorageAlias{}
 
-		for _, curr := range result.StorageAlias {
-			if !isAliasInUse(result.TargetMedias, curr) {
+		for _, curr := range si.StorageAlias {
+			if !isAliasInUse(si.TargetMedias, curr) {
 				continue
 			}
 
@@ -384,7 +435,7 @@ func LoadFile(path string, options args.Args) (*SystemInstall, error) {
 			// could be an image file to be created so we fail only if the error doesn't
 			// indicate the image file doesn't exist
 			if err != nil && !inTestAlias && !os.IsNotExist(err) {
-				return nil, errors.Wrap(err)
+				return errors.Wrap(err)
 			}
 
 			keepMe = append(keepMe, curr)
@@ -402,18 +453,14 @@ func LoadFile(path string, options args.Args) (*SystemInstall, error) {
 		}
 
 		// keep only the aliases we're using
-		result.StorageAlias = keepMe
+		si.StorageAlias = keepMe
 
-		for _, bd := range result.TargetMedias {
+		for _, bd := range si.TargetMedias {
 			bd.ExpandName(alias)
 		}
 	}
 
-	if result.Version > 0 {
-		result.AutoUpdate = false
-	}
-
-	return &result, nil
+	return nil
 }
 
 func isAliasInUse(bds []*storage.BlockDevice, alias *StorageAlias) bool {
@@ -459,6 +506,20 @@ func (si *SystemInstall) IsTelemetryEnabled() bool {
 	return si.Telemetry.Enabled
 }
 
+// redacted returns a shallow copy of si with the secret values redacted
+func (si *SystemInstall) redacted() *SystemInstall {
+	result := *si
+
+	if si.TargetEnv != nil {
+		result.TargetEnv = []*EnvVariable{}
+		for _, curr := range si.TargetEnv {
+			result.TargetEnv = append(result.TargetEnv, curr.Redacted())
+		}
+	}
+
+	return &result
+}
+
 // WriteFile writes a yaml formatted representation of si into the provided file path
 func (si *SystemInstall) WriteFile(path string) error {
 	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
@@ -470,7 +531,7 @@ func (si *SystemInstall) WriteFile(path string) error {
 		_ = f.Close()
 	}()
 
-	b, err := yaml.Marshal(si)
+	b, err := yaml.Marshal(si.redacted())
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,1115 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package model
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/hostname"
+	"github.com/clearlinux/clr-installer/kernel"
+	"github.com/clearlinux/clr-installer/keyboard"
+	"github.com/clearlinux/clr-installer/language"
+	"github.com/clearlinux/clr-installer/log"
+	"github.com/clearlinux/clr-installer/network"
+	"github.com/clearlinux/clr-installer/pwpolicy"
+	"github.com/clearlinux/clr-installer/sanitize"
+	"github.com/clearlinux/clr-installer/storage"
+	"github.com/clearlinux/clr-installer/timezone"
+	"github.com/clearlinux/clr-installer/user"
+	"github.com/clearlinux/clr-installer/utils"
+)
+
+// Section is a composable part of the SystemInstall configuration, sections are
+// inlined in the SystemInstall so the yaml representation is kept flat
+type Section interface {
+	// Default sets the section default values, it's called before the
+	// configuration is loaded so the loaded values take precedence
+	Default()
+
+	// Validate checks the section for possible inconsistencies or
+	// "minimum required" information
+	Validate() error
+}
+
+// StorageConfig is the section holding the target medias and how they're
+// partitioned, encrypted and imaged
+type StorageConfig struct {
+	// TargetMedias may hold several disks, i.e the members of a RAID array
+	// or of a LVM volume group. InstallSelected is the InstallTarget picked
+	// by the guided install, which still targets a single disk.
+	InstallSelected storage.InstallTarget  `yaml:"-"`
+	TargetMedias    []*storage.BlockDevice `yaml:"targetMedia"`
+	StorageAlias    []*StorageAlias        `yaml:"block-devices,omitempty,flow"`
+	LegacyBios      bool                   `yaml:"legacyBios,omitempty,flow"`
+	CryptPass       string                 `yaml:"-"`
+	CryptKeys       *storage.CryptKeys     `yaml:"cryptKeys,omitempty,flow"`
+	MakeISO         bool                   `yaml:"iso,omitempty,flow"`
+	KeepImage       bool                   `yaml:"keepImage,omitempty,flow"`
+
+	// ESPPolicy is how a partial install handles an existing EFI System
+	// Partition, one of storage.ESPPolicies, defaults to ESPPolicyCreate
+	ESPPolicy string `yaml:"espPolicy,omitempty,flow"`
+
+	// WipeSignatures deactivates and wipes the existing LUKS, LVM and RAID
+	// signatures of the target medias, otherwise the install is refused
+	WipeSignatures bool `yaml:"wipeSignatures,omitempty,flow"`
+
+	// PartitionTable is how the MBR and hybrid GPT/MBR partition tables of
+	// the target medias are handled, one of storage.PartitionTablePolicies.
+	// It must be set to install to such a disk.
+	PartitionTable string `yaml:"partitionTable,omitempty,flow"`
+
+	// Trim is how the freed blocks of the target file systems are trimmed,
+	// one of storage.TrimPolicies, suggested from the target disks if unset
+	Trim string `yaml:"trim,omitempty,flow"`
+
+	// Snapshots configures snapper to take the automatic snapshots of the
+	// btrfs root partition
+	Snapshots bool `yaml:"snapshots,omitempty,flow"`
+
+	// SwapFileSize is the size of a swap file allocated on the root file
+	// system, i.e 512M, it replaces the swap partition
+	SwapFileSize string `yaml:"swap-file-size,omitempty,flow"`
+
+	// HomeEncryption encrypts the home directory of each user, one of
+	// storage.HomeEncryptions; a LUKS encrypted /home partition is set up
+	// in the target medias instead
+	HomeEncryption string `yaml:"homeEncryption,omitempty,flow"`
+}
+
+// NetworkConfig is the section holding the network configuration
+type NetworkConfig struct {
+	NetworkInterfaces []*network.Interface `yaml:"networkInterfaces,omitempty,flow"`
+	HTTPSProxy        string               `yaml:"httpsProxy,omitempty,flow"`
+	NoProxy           []string             `yaml:"noProxy,omitempty,flow"`
+	CopyNetwork       bool                 `yaml:"copyNetwork,omitempty,flow"`
+	Wireless          *network.Wireless    `yaml:"wireless,omitempty,flow"`
+
+	// InstallerDNS and InstallerHosts are the DNS servers and static host
+	// entries used by the installer environment only, they are not copied
+	// to the target
+	InstallerDNS   []string             `yaml:"installerDNS,omitempty,flow"`
+	InstallerHosts []*network.HostEntry `yaml:"installerHosts,omitempty,flow"`
+
+	// NetworkdFiles are the systemd-networkd files and drop-ins installed
+	// as is to the target, after the copied network configuration
+	NetworkdFiles []*network.NetworkdFile `yaml:"networkdFiles,omitempty"`
+}
+
+// SoftwareConfig is the section holding the software content to install
+// and how it is kept up to date
+type SoftwareConfig struct {
+	Bundles         []string           `yaml:"bundles,omitempty,flow"`
+	UserBundles     []string           `yaml:"userBundles,omitempty,flow"`
+	KernelArguments *kernel.Arguments  `yaml:"kernel-arguments,omitempty,flow"`
+	KernelModules   *kernel.Modules    `yaml:"kernel-modules,omitempty,flow"`
+	SysctlProfile   string             `yaml:"sysctlProfile,omitempty,flow"`
+	Sysctl          map[string]string  `yaml:"sysctl,omitempty,flow"`
+	HPC             *kernel.HPC        `yaml:"hpc,omitempty,flow"`
+	Kernel          *kernel.Kernel     `yaml:"kernel,omitempty,flow"`
+	KernelProfile   string             `yaml:"kernelProfile,omitempty,flow"`
+	UKI             *kernel.UKI        `yaml:"uki,omitempty,flow"`
+	SwupdMirror     string             `yaml:"swupdMirror,omitempty,flow"`
+	SwupdTLS        *SwupdTLS          `yaml:"swupdTLS,omitempty,flow"`
+	AutoUpdate      bool               `yaml:"autoUpdate,omitempty,flow"`
+	UpdatePolicy    *UpdatePolicy      `yaml:"updatePolicy,omitempty,flow"`
+	BootMenu        *BootMenu          `yaml:"bootMenu,omitempty,flow"`
+	Diagnostics     *Diagnostics       `yaml:"diagnostics,omitempty,flow"`
+	Tmpfiles        []*Directory       `yaml:"tmpfiles,omitempty,flow"`
+	TargetEnv       []*EnvVariable     `yaml:"targetEnv,omitempty,flow"`
+	UdevRules       []*kernel.UdevRule `yaml:"udevRules,omitempty"`
+	Version         uint               `yaml:"version,omitempty,flow"`
+
+	// SkipFirmwareBundles opts out of the microcode and firmware bundles
+	// automatically added for the installing hardware
+	SkipFirmwareBundles bool `yaml:"skipFirmwareBundles,omitempty,flow"`
+
+	// SkipSerialConsole opts out of the serial console automatically
+	// configured when the installing system is headless
+	SkipSerialConsole bool `yaml:"skipSerialConsole,omitempty,flow"`
+}
+
+// UpdatePolicy controls how the target system is automatically updated, it's
+// only applied if AutoUpdate is enabled
+type UpdatePolicy struct {
+	// Schedule is a systemd calendar event expression replacing the
+	// default swupd-update.timer schedule, i.e: "Sat *-*-* 03:00:00"
+	Schedule string `yaml:"schedule,omitempty,flow"`
+
+	// Reboot is the reboot policy after an automatic update, one of
+	// RebootPolicies, defaults to RebootNever
+	Reboot string `yaml:"reboot,omitempty,flow"`
+}
+
+// SwupdTLS holds the certificates of a swupd mirror requiring mutual TLS,
+// they're used by the installer and kept in the target for its updates
+type SwupdTLS struct {
+	// CACert is the PEM file of the certificate authority signing the
+	// mirror certificate, added to the trusted certificates
+	CACert string `yaml:"caCert,omitempty,flow"`
+
+	// ClientCert and ClientKey are secret references to the PEM client
+	// certificate and key, see utils.ReadSecret
+	ClientCert string `yaml:"clientCert,omitempty,flow"`
+	ClientKey  string `yaml:"clientKey,omitempty,flow"`
+}
+
+// BootMenu customizes the boot loader menu, mostly for multi-boot systems
+// sharing the EFI System Partition with other operating systems
+type BootMenu struct {
+	// Title replaces the title of the installed boot entries
+	Title string `yaml:"title,omitempty,flow"`
+
+	// Default is the id of the entry booted by default, i.e "auto-windows",
+	// defaults to the installed entry
+	Default string `yaml:"default,omitempty,flow"`
+
+	// Timeout is the number of seconds the menu is shown, 0 keeps the
+	// boot loader default
+	Timeout uint `yaml:"timeout,omitempty,flow"`
+}
+
+// Diagnostics keeps on the target what is needed to investigate a failure:
+// the logs of the previous boots, the core dumps and the kernel crash dumps
+type Diagnostics struct {
+	// PersistentJournal keeps the systemd journal across reboots
+	PersistentJournal bool `yaml:"persistentJournal,omitempty,flow"`
+
+	// CoreDumps stores the core dumps of the crashing processes with
+	// systemd-coredump
+	CoreDumps bool `yaml:"coreDumps,omitempty,flow"`
+
+	// Kdump reserves the memory of a crash kernel capturing the kernel
+	// crash dumps
+	Kdump bool `yaml:"kdump,omitempty,flow"`
+
+	// CrashKernel is the crashkernel= memory reservation, defaults to
+	// DefaultCrashKernel, i.e "256M" or "1G-4G:192M,4G-:256M"
+	CrashKernel string `yaml:"crashKernel,omitempty,flow"`
+}
+
+// Directory is a directory created in the target and maintained afterwards
+// by systemd-tmpfiles, i.e the data directory of a service
+type Directory struct {
+	// Path is the absolute path of the directory, i.e "/srv/app"
+	Path string `yaml:"path,omitempty,flow"`
+
+	// Mode is the octal access mode, defaults to DefaultDirectoryMode
+	Mode string `yaml:"mode,omitempty,flow"`
+
+	// User and Group own the directory, default to root
+	User  string `yaml:"user,omitempty,flow"`
+	Group string `yaml:"group,omitempty,flow"`
+}
+
+// EnvVariable is an environment variable set in the target system, i.e a
+// corporate proxy or a locale override
+type EnvVariable struct {
+	Name  string `yaml:"name,omitempty,flow"`
+	Value string `yaml:"value,omitempty,flow"`
+
+	// Secret redacts the value from the saved configurations and logs
+	Secret bool `yaml:"secret,omitempty,flow"`
+
+	// Profile writes the variable to a profile.d script, exported by the
+	// login shells only, rather than /etc/environment
+	Profile bool `yaml:"profile,omitempty,flow"`
+}
+
+const (
+	// RedactedValue replaces the secret values in the saved configurations
+	RedactedValue = "<redacted>"
+)
+
+var (
+	// envNameExp matches an environment variable name
+	envNameExp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+const (
+	// DefaultDirectoryMode is the access mode of the directories with none
+	DefaultDirectoryMode = "0755"
+)
+
+var (
+	// directoryModeExp matches an octal access mode, i.e "750" or "2775"
+	directoryModeExp = regexp.MustCompile(`^[0-7]?[0-7]{3}$`)
+
+	// ownerExp matches a user or group name, or numeric id
+	ownerExp = regexp.MustCompile(`^([a-z_][a-z0-9_-]*\$?|[0-9]+)$`)
+)
+
+const (
+	// DefaultCrashKernel sizes the crash kernel reservation with the
+	// installed memory, there's no reservation under 1G
+	DefaultCrashKernel = "1G-4G:192M,4G-64G:256M,64G-:512M"
+)
+
+var (
+	// crashKernelExp matches a crashkernel= size, or list of size ranges
+	crashKernelExp = regexp.MustCompile(`^([0-9]+[KMG]-([0-9]+[KMG])?:[0-9]+[KMG],)*([0-9]+[KMG]-([0-9]+[KMG])?:)?[0-9]+[KMG]$`)
+)
+
+const (
+	// RebootNever never reboots the target after an automatic update
+	RebootNever = "never"
+
+	// RebootOnUpdate reboots the target when an automatic update installed a new version
+	RebootOnUpdate = "on-update"
+)
+
+// RebootPolicies is the list of supported automatic update reboot policies
+var RebootPolicies = []string{RebootNever, RebootOnUpdate}
+
+// IdentityConfig is the section holding the target system identity, its
+// localization settings, users and hostname
+type IdentityConfig struct {
+	Keyboard *keyboard.Keymap   `yaml:"keyboard,omitempty,flow"`
+	Language *language.Language `yaml:"language,omitempty,flow"`
+	Timezone *timezone.TimeZone `yaml:"timezone,omitempty,flow"`
+	Users    []*user.User       `yaml:"users,omitempty,flow"`
+	Hostname string             `yaml:"hostname,omitempty,flow"`
+
+	// InstallerLanguage and TargetLocale override Language for the
+	// installer user interface and the installed system respectively, i.e
+	// to run the installer in English for a machine localized in German
+	InstallerLanguage *language.Language `yaml:"installerLanguage,omitempty,flow"`
+	TargetLocale      *language.Language `yaml:"targetLocale,omitempty,flow"`
+
+	// Banners are the login banners and message of the day of the target
+	Banners *Banners `yaml:"banners,omitempty,flow"`
+
+	// X11Keyboard is the X11 keyboard of the target, Keyboard only sets
+	// the console keymap
+	X11Keyboard *keyboard.X11Keymap `yaml:"x11Keyboard,omitempty,flow"`
+
+	// PasswordPolicy is the strength policy of the users passwords, the
+	// default one if nil
+	PasswordPolicy *pwpolicy.Policy `yaml:"passwordPolicy,omitempty,flow"`
+}
+
+// Banners are the texts shown to the users of the target, i.e the terms of
+// use of a lab or the instructions of a kiosk. Their ${hostname},
+// ${installDate} and ${version} variables are resolved at install time.
+type Banners struct {
+	// Issue is the /etc/issue text shown by the console login prompt
+	Issue string `yaml:"issue,omitempty,flow"`
+
+	// Motd is the /etc/motd message of the day shown after login
+	Motd string `yaml:"motd,omitempty,flow"`
+
+	// GDM is the banner of the graphical login screen
+	GDM string `yaml:"gdm,omitempty,flow"`
+}
+
+const (
+	// BannerHostname is the banner variable of the target hostname
+	BannerHostname = "hostname"
+
+	// BannerInstallDate is the banner variable of the install date
+	BannerInstallDate = "installDate"
+
+	// BannerVersion is the banner variable of the installed OS version
+	BannerVersion = "version"
+)
+
+var (
+	// BannerVariables are the variables resolved in the banners
+	BannerVariables = []string{BannerHostname, BannerInstallDate, BannerVersion}
+
+	// bannerVariableExp matches a banner ${name} variable
+	bannerVariableExp = regexp.MustCompile(`\$\{([A-Za-z0-9_]+)\}`)
+)
+
+// Default is part of the Section interface implementation, storage has no defaults
+func (sc *StorageConfig) Default() {}
+
+// Validate is part of the Section interface implementation
+func (sc *StorageConfig) Validate() error {
+	if sc.TargetMedias == nil || len(sc.TargetMedias) == 0 {
+		return errors.ValidationErrorf("System Installation must provide a target media")
+	}
+
+	if sc.ESPPolicy != "" && !utils.StringSliceContains(storage.ESPPolicies, sc.ESPPolicy) {
+		return errors.ValidationErrorf("Invalid EFI System Partition policy %q, must be one of: %s",
+			sc.ESPPolicy, strings.Join(storage.ESPPolicies, ", "))
+	}
+
+	if sc.PartitionTable != "" && !utils.StringSliceContains(storage.PartitionTablePolicies, sc.PartitionTable) {
+		return errors.ValidationErrorf("Invalid partition table policy %q, must be one of: %s",
+			sc.PartitionTable, strings.Join(storage.PartitionTablePolicies, ", "))
+	}
+
+	if sc.Trim != "" && !utils.StringSliceContains(storage.TrimPolicies, sc.Trim) {
+		return errors.ValidationErrorf("Invalid TRIM policy %q, must be one of: %s",
+			sc.Trim, strings.Join(storage.TrimPolicies, ", "))
+	}
+
+	if err := storage.ValidatePartitionTablePolicy(sc.TargetMedias, sc.PartitionTable, sc.LegacyBios); err != nil {
+		return err
+	}
+
+	if err := storage.ValidateTargetMedias(sc.TargetMedias, sc.LegacyBios, sc.CryptPass); err != nil {
+		return err
+	}
+
+	if sc.CryptKeys != nil {
+		if err := sc.CryptKeys.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if sc.Snapshots && !storage.BtrfsRoot(sc.TargetMedias) {
+		return errors.ValidationErrorf("The automatic snapshots require a btrfs root partition")
+	}
+
+	if sc.SwapFileSize != "" {
+		if err := storage.ValidateSwapFile(sc.TargetMedias, sc.SwapFileSize); err != nil {
+			return err
+		}
+
+		// a subvolume holding an active swap file can not be snapshotted
+		if sc.Snapshots {
+			return errors.ValidationErrorf("The automatic snapshots can not be used with a swap file")
+		}
+	}
+
+	if sc.HomeEncryption != "" {
+		if !utils.StringSliceContains(storage.HomeEncryptions, sc.HomeEncryption) {
+			return errors.ValidationErrorf("Invalid home encryption %q, must be one of: %s",
+				sc.HomeEncryption, strings.Join(storage.HomeEncryptions, ", "))
+		}
+
+		if err := storage.ValidateFscrypt(sc.TargetMedias); err != nil {
+			return err
+		}
+	}
+
+	if err := sc.SpaceRequirements(0).Check(sc.TargetMedias); err != nil {
+		return err
+	}
+
+	if err := storage.ValidateVolumeGroups(sc.TargetMedias, sc.LegacyBios); err != nil {
+		return err
+	}
+
+	if err := storage.ValidateRAIDArrays(sc.TargetMedias, sc.LegacyBios); err != nil {
+		return err
+	}
+
+	return storage.ValidateFilesystemIDs(sc.TargetMedias)
+}
+
+// SpaceRequirements returns the disk space of installing content bytes, the
+// base content if 0, with the planned partitions and swap file
+func (sc *StorageConfig) SpaceRequirements(content uint64) *storage.SpaceRequirements {
+	sr := storage.NewSpaceRequirements(content)
+
+	swapFile := uint64(0)
+	if sc.SwapFileSize != "" {
+		// an invalid size is reported by ValidateSwapFile
+		swapFile, _ = storage.ParseVolumeSize(sc.SwapFileSize)
+	}
+
+	sr.Plan(sc.TargetMedias, swapFile)
+	return sr
+}
+
+// EncryptionRequiresPassphrase checks all partition to see if encryption was enabled
+func (sc *StorageConfig) EncryptionRequiresPassphrase() bool {
+	enabled := false
+
+	for _, curr := range sc.TargetMedias {
+		enabled = enabled || curr.EncryptionRequiresPassphrase()
+	}
+
+	return enabled
+}
+
+// AddBootPartition adds the boot partition of a partial install to disk
+// following ESPPolicy, a new partition is created if the existing EFI System
+// Partition can not be reused. Returns the size taken from the free space.
+func (sc *StorageConfig) AddBootPartition(disk *storage.BlockDevice) uint64 {
+	size, err := storage.AddBootPartition(disk, sc.ESPPolicy)
+	if err != nil {
+		log.Warning("Creating a new EFI System Partition: %s", err)
+		return storage.AddBootStandardPartition(disk)
+	}
+
+	// the other operating systems booting from the replaced ESP are lost
+	if sc.ESPPolicy == storage.ESPPolicyReplace && disk.FindESP() != nil {
+		sc.InstallSelected.DataLoss = true
+	}
+
+	return size
+}
+
+// AddTargetMedia adds a BlockDevice instance to the list of TargetMedias
+// if bd was previously added to as a target media its pointer is updated
+func (sc *StorageConfig) AddTargetMedia(bd *storage.BlockDevice) {
+	if sc.TargetMedias == nil {
+		sc.TargetMedias = []*storage.BlockDevice{}
+	}
+
+	nList := []*storage.BlockDevice{bd}
+
+	for _, curr := range sc.TargetMedias {
+		if !bd.Equals(curr) {
+			nList = append(nList, curr)
+		}
+	}
+
+	sc.TargetMedias = nList
+}
+
+// Default is part of the Section interface implementation, network has no defaults
+func (nc *NetworkConfig) Default() {}
+
+// Validate is part of the Section interface implementation, only the static
+// configuration of the network interfaces is validated
+func (nc *NetworkConfig) Validate() error {
+	for _, curr := range nc.NetworkInterfaces {
+		if err := curr.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if nc.Wireless != nil {
+		if err := nc.Wireless.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if err := sanitize.Check("HTTPS proxy", nc.HTTPSProxy, sanitize.MaxURLLength); err != nil {
+		return err
+	}
+
+	for _, curr := range nc.NoProxy {
+		if err := network.ValidateNoProxyEntry(curr); err != nil {
+			return err
+		}
+	}
+
+	for _, curr := range nc.InstallerDNS {
+		if err := network.ValidateDNSServer(curr); err != nil {
+			return err
+		}
+	}
+
+	for _, curr := range nc.InstallerHosts {
+		if err := network.ValidateHostEntry(curr); err != nil {
+			return err
+		}
+	}
+
+	return network.ValidateNetworkdFiles(nc.NetworkdFiles)
+}
+
+// AddNetworkInterface adds an Interface instance to the list of NetworkInterfaces
+func (nc *NetworkConfig) AddNetworkInterface(iface *network.Interface) {
+	if nc.NetworkInterfaces == nil {
+		nc.NetworkInterfaces = []*network.Interface{}
+	}
+
+	nc.NetworkInterfaces = append(nc.NetworkInterfaces, iface)
+}
+
+// Default is part of the Section interface implementation
+func (sc *SoftwareConfig) Default() {
+	// Default to Auto Updating enabled by default
+	sc.AutoUpdate = true
+}
+
+// Validate is part of the Section interface implementation
+func (sc *SoftwareConfig) Validate() error {
+	if sc.Kernel == nil {
+		return errors.ValidationErrorf("A kernel must be provided")
+	}
+
+	for _, curr := range append(sc.Bundles, sc.UserBundles...) {
+		if err := sanitize.Check("bundle name", curr, sanitize.MaxBundleNameLength); err != nil {
+			return err
+		}
+	}
+
+	if err := sanitize.Check("swupd mirror", sc.SwupdMirror, sanitize.MaxURLLength); err != nil {
+		return err
+	}
+
+	if sc.KernelModules != nil {
+		if err := sc.KernelModules.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if err := kernel.ValidateSysctl(sc.SysctlProfile, sc.Sysctl); err != nil {
+		return err
+	}
+
+	if sc.HPC != nil {
+		if err := sc.HPC.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if err := kernel.ValidateProfile(sc.KernelProfile); err != nil {
+		return err
+	}
+
+	if sc.UKI != nil {
+		if err := sc.UKI.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if sc.UpdatePolicy != nil {
+		if err := sc.UpdatePolicy.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if sc.SwupdTLS != nil {
+		if err := sc.SwupdTLS.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if sc.Diagnostics != nil {
+		if err := sc.Diagnostics.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if err := ValidateDirectories(sc.Tmpfiles); err != nil {
+		return err
+	}
+
+	if err := ValidateEnvVariables(sc.TargetEnv); err != nil {
+		return err
+	}
+
+	if err := kernel.ValidateUdevRules(sc.UdevRules); err != nil {
+		return err
+	}
+
+	if sc.BootMenu != nil {
+		return sc.BootMenu.Validate()
+	}
+
+	return nil
+}
+
+// ApplyKernelProfile selects the kernel bundle of the kernel profile if it's
+// available for the installed version, and adds the profile kernel arguments
+// and sysctl profile
+func (sc *SoftwareConfig) ApplyKernelProfile(available bool) {
+	pr := kernel.GetProfile(sc.KernelProfile)
+	if pr == nil {
+		return
+	}
+
+	if available {
+		sc.Kernel = &kernel.Kernel{Bundle: pr.Bundle}
+	}
+
+	sc.AddExtraKernelArguments(pr.Arguments)
+
+	if sc.SysctlProfile == "" {
+		sc.SysctlProfile = pr.SysctlProfile
+	}
+}
+
+// AddExtraKernelArguments adds a set of custom extra kernel arguments to be added to the
+// clr-boot-manager configuration
+func (sc *SoftwareConfig) AddExtraKernelArguments(args []string) {
+	if sc.KernelArguments == nil {
+		sc.KernelArguments = &kernel.Arguments{}
+	}
+
+	for _, curr := range args {
+		if utils.StringSliceContains(sc.KernelArguments.Add, curr) {
+			continue
+		}
+
+		sc.KernelArguments.Add = append(sc.KernelArguments.Add, curr)
+	}
+}
+
+// RemoveKernelArguments adds a set of kernel arguments to be "black listed" on
+// clear-boot-manager, meaning these arguments will never end up in the boot manager
+// entry configuration
+func (sc *SoftwareConfig) RemoveKernelArguments(args []string) {
+	if sc.KernelArguments == nil {
+		sc.KernelArguments = &kernel.Arguments{}
+	}
+
+	for _, curr := range args {
+		if utils.StringSliceContains(sc.KernelArguments.Remove, curr) {
+			continue
+		}
+
+		sc.KernelArguments.Remove = append(sc.KernelArguments.Remove, curr)
+	}
+}
+
+// ContainsBundle returns true if the data model has a bundle and false otherwise
+func (sc *SoftwareConfig) ContainsBundle(bundle string) bool {
+	for _, curr := range sc.Bundles {
+		if curr == bundle {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RemoveBundle removes a bundle from the data model
+func (sc *SoftwareConfig) RemoveBundle(bundle string) {
+	bundles := []string{}
+
+	for _, curr := range sc.Bundles {
+		if curr != bundle {
+			bundles = append(bundles, curr)
+		}
+	}
+
+	sc.Bundles = bundles
+}
+
+// AddBundle adds a new bundle to the data model, we make sure to not duplicate entries
+func (sc *SoftwareConfig) AddBundle(bundle string) {
+	for _, curr := range sc.Bundles {
+		if curr == bundle {
+			return
+		}
+	}
+
+	sc.Bundles = append(sc.Bundles, bundle)
+}
+
+// ContainsUserBundle returns true if the data model has a user bundle and false otherwise
+func (sc *SoftwareConfig) ContainsUserBundle(bundle string) bool {
+	for _, curr := range sc.UserBundles {
+		if curr == bundle {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RemoveUserBundle removes a user bundle from the data model
+func (sc *SoftwareConfig) RemoveUserBundle(bundle string) {
+	bundles := []string{}
+
+	for _, curr := range sc.UserBundles {
+		if curr != bundle {
+			bundles = append(bundles, curr)
+		}
+	}
+
+	sc.UserBundles = bundles
+}
+
+// AddUserBundle adds a new user bundle to the data model, we make sure to not duplicate entries
+func (sc *SoftwareConfig) AddUserBundle(bundle string) {
+	for _, curr := range sc.UserBundles {
+		if curr == bundle {
+			return
+		}
+	}
+
+	sc.UserBundles = append([]string{bundle}, sc.UserBundles...)
+}
+
+// Validate checks the update policy schedule and reboot policy
+func (up *UpdatePolicy) Validate() error {
+	if strings.ContainsAny(up.Schedule, "\n\r") {
+		return errors.ValidationErrorf("Invalid update schedule %q, must be a single line", up.Schedule)
+	}
+
+	if up.Reboot != "" && !utils.StringSliceContains(RebootPolicies, up.Reboot) {
+		return errors.ValidationErrorf("Invalid update reboot policy %q, must be one of: %s",
+			up.Reboot, strings.Join(RebootPolicies, ", "))
+	}
+
+	return nil
+}
+
+// Validate checks the boot menu title is a single line and the default entry
+// is a single word
+func (bm *BootMenu) Validate() error {
+	if strings.ContainsAny(bm.Title, "\n\r") {
+		return errors.ValidationErrorf("Invalid boot menu title %q, must be a single line", bm.Title)
+	}
+
+	if strings.ContainsAny(bm.Default, " \t\n\r") {
+		return errors.ValidationErrorf("Invalid default boot entry %q, must be an entry id", bm.Default)
+	}
+
+	return nil
+}
+
+// Validate checks the client certificate and key are both set, as secret
+// references; the secrets are only read when installing
+func (st *SwupdTLS) Validate() error {
+	if (st.ClientCert == "") != (st.ClientKey == "") {
+		return errors.ValidationErrorf("The swupd client certificate and key must be set together")
+	}
+
+	for _, curr := range []string{st.ClientCert, st.ClientKey} {
+		if curr != "" && !strings.HasPrefix(curr, "env:") && !strings.HasPrefix(curr, "file:") {
+			return errors.ValidationErrorf("Invalid secret reference %q, expected env:NAME or file:PATH", curr)
+		}
+	}
+
+	return nil
+}
+
+// Validate checks the banners only use the supported variables, so a
+// misspelled one doesn't end up verbatim on every login screen
+func (bn *Banners) Validate() error {
+	for name, text := range map[string]string{"issue": bn.Issue, "motd": bn.Motd, "gdm": bn.GDM} {
+		for _, match := range bannerVariableExp.FindAllStringSubmatch(text, -1) {
+			if !utils.StringSliceContains(BannerVariables, match[1]) {
+				return errors.ValidationErrorf("Unknown variable %s of the %s banner, supported: %s",
+					match[0], name, strings.Join(BannerVariables, ", "))
+			}
+		}
+	}
+
+	return nil
+}
+
+// IsEmpty returns true if no banner is set
+func (bn *Banners) IsEmpty() bool {
+	return bn.Issue == "" && bn.Motd == "" && bn.GDM == ""
+}
+
+// Expand returns text with its banner variables replaced by their vars value
+func (bn *Banners) Expand(text string, vars map[string]string) string {
+	return bannerVariableExp.ReplaceAllStringFunc(text, func(match string) string {
+		if value, ok := vars[bannerVariableExp.FindStringSubmatch(match)[1]]; ok {
+			return value
+		}
+
+		return match
+	})
+}
+
+// Validate checks the crash kernel memory reservation
+func (dg *Diagnostics) Validate() error {
+	if dg.CrashKernel != "" && !crashKernelExp.MatchString(dg.CrashKernel) {
+		return errors.ValidationErrorf("Invalid crash kernel reservation %q, i.e: 256M or 1G-4G:192M,4G-:256M",
+			dg.CrashKernel)
+	}
+
+	return nil
+}
+
+// IsEmpty returns true if no diagnostic is enabled
+func (dg *Diagnostics) IsEmpty() bool {
+	return !dg.PersistentJournal && !dg.CoreDumps && !dg.Kdump
+}
+
+// EnableAll enables every diagnostic, the rescue friendly defaults
+func (dg *Diagnostics) EnableAll() {
+	dg.PersistentJournal = true
+	dg.CoreDumps = true
+	dg.Kdump = true
+}
+
+// CrashKernelArgument returns the crashkernel= kernel argument
+func (dg *Diagnostics) CrashKernelArgument() string {
+	size := dg.CrashKernel
+	if size == "" {
+		size = DefaultCrashKernel
+	}
+
+	return "crashkernel=" + size
+}
+
+// Validate checks the directory path is absolute and clean, and its mode
+// and owners can be written to a tmpfiles.d line
+func (dir *Directory) Validate() error {
+	if !filepath.IsAbs(dir.Path) || filepath.Clean(dir.Path) != dir.Path || dir.Path == "/" {
+		return errors.ValidationErrorf("Invalid directory %q, must be an absolute and clean path", dir.Path)
+	}
+
+	if strings.ContainsAny(dir.Path, " \t\n\r%\\") {
+		return errors.ValidationErrorf("Invalid directory %q, must not contain spaces, %% or \\", dir.Path)
+	}
+
+	if dir.Mode != "" && !directoryModeExp.MatchString(dir.Mode) {
+		return errors.ValidationErrorf("Invalid mode %q for directory %s, must be octal i.e: 0750",
+			dir.Mode, dir.Path)
+	}
+
+	for _, curr := range []string{dir.User, dir.Group} {
+		if curr != "" && !ownerExp.MatchString(curr) {
+			return errors.ValidationErrorf("Invalid owner %q for directory %s", curr, dir.Path)
+		}
+	}
+
+	return nil
+}
+
+// TmpfilesLine returns the tmpfiles.d line creating the directory
+func (dir *Directory) TmpfilesLine() string {
+	mode, user, group := dir.Mode, dir.User, dir.Group
+
+	if mode == "" {
+		mode = DefaultDirectoryMode
+	}
+
+	if user == "" {
+		user = "root"
+	}
+
+	if group == "" {
+		group = "root"
+	}
+
+	return fmt.Sprintf("d %s %s %s %s -", dir.Path, mode, user, group)
+}
+
+// ValidateDirectories validates every directory and checks none is declared twice
+func ValidateDirectories(dirs []*Directory) error {
+	seen := map[string]bool{}
+
+	for _, curr := range dirs {
+		if err := curr.Validate(); err != nil {
+			return err
+		}
+
+		if seen[curr.Path] {
+			return errors.ValidationErrorf("Directory %s declared more than once", curr.Path)
+		}
+		seen[curr.Path] = true
+	}
+
+	return nil
+}
+
+// Validate checks the variable name and value can be written to
+// /etc/environment or a shell script
+func (ev *EnvVariable) Validate() error {
+	if !envNameExp.MatchString(ev.Name) {
+		return errors.ValidationErrorf("Invalid environment variable name %q", ev.Name)
+	}
+
+	if ev.Secret && ev.Value == RedactedValue {
+		return errors.ValidationErrorf("The secret value of %s was redacted, it must be set again", ev.Name)
+	}
+
+	if strings.ContainsAny(ev.Value, "\n\r") {
+		return errors.ValidationErrorf("Invalid value for %s, must be a single line", ev.Name)
+	}
+
+	// pam_env doesn't support escaping the quotes
+	if !ev.Profile && strings.ContainsAny(ev.Value, "\"'") {
+		return errors.ValidationErrorf("Invalid value for %s, /etc/environment values can't have quotes",
+			ev.Name)
+	}
+
+	return nil
+}
+
+// Redacted returns a copy of ev with its value redacted if secret
+func (ev *EnvVariable) Redacted() *EnvVariable {
+	result := *ev
+
+	if result.Secret {
+		result.Value = RedactedValue
+	}
+
+	return &result
+}
+
+// ValidateEnvVariables validates every variable and checks none is set twice
+func ValidateEnvVariables(vars []*EnvVariable) error {
+	seen := map[string]bool{}
+
+	for _, curr := range vars {
+		if err := curr.Validate(); err != nil {
+			return err
+		}
+
+		if seen[curr.Name] {
+			return errors.ValidationErrorf("Environment variable %s set more than once", curr.Name)
+		}
+		seen[curr.Name] = true
+	}
+
+	return nil
+}
+
+// Default is part of the Section interface implementation
+func (ic *IdentityConfig) Default() {
+	ic.Timezone = &timezone.TimeZone{Code: timezone.DefaultTimezone}
+	ic.Keyboard = &keyboard.Keymap{Code: keyboard.DefaultKeyboard}
+	ic.Language = &language.Language{Code: language.DefaultLanguage}
+}
+
+// Validate is part of the Section interface implementation
+func (ic *IdentityConfig) Validate() error {
+	if ic.Timezone == nil {
+		return errors.ValidationErrorf("Timezone not set")
+	}
+
+	if ic.Keyboard == nil {
+		return errors.ValidationErrorf("Keyboard not set")
+	}
+
+	if ic.Language == nil {
+		return errors.ValidationErrorf("System Language not set")
+	}
+
+	if ic.X11Keyboard != nil {
+		if err := ic.X11Keyboard.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if ic.PasswordPolicy != nil {
+		if err := ic.PasswordPolicy.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if err := sanitize.Check("hostname", ic.Hostname, hostname.MaxHostnameLength); err != nil {
+		return err
+	}
+
+	for _, curr := range ic.Users {
+		if err := sanitize.Check("user login", curr.Login, user.MaxLoginLength); err != nil {
+			return err
+		}
+
+		if err := sanitize.Check("user name", curr.UserName, user.MaxUsernameLength); err != nil {
+			return err
+		}
+
+		if err := curr.Validate(); err != nil {
+			return err
+		}
+
+		if err := curr.ReadPasswordSecret(); err != nil {
+			return err
+		}
+
+		if err := curr.CheckPassword(ic.PasswordPolicy); err != nil {
+			return err
+		}
+	}
+
+	if ic.Banners != nil {
+		if err := ic.Banners.Validate(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetInstallerLanguage returns the language of the installer user interface
+func (ic *IdentityConfig) GetInstallerLanguage() *language.Language {
+	if ic.InstallerLanguage != nil {
+		return ic.InstallerLanguage
+	}
+
+	return ic.Language
+}
+
+// GetTargetLocale returns the locale of the installed system
+func (ic *IdentityConfig) GetTargetLocale() *language.Language {
+	if ic.TargetLocale != nil {
+		return ic.TargetLocale
+	}
+
+	return ic.Language
+}
+
+// SuggestKeyboard preselects the keyboard most likely used with the target
+// locale, unless the user picked one or a config file set a non default one
+func (ic *IdentityConfig) SuggestKeyboard() {
+	kbd := ic.Keyboard
+	if kbd != nil && !kbd.IsSuggested() &&
+		(kbd.IsUserDefined() || kbd.Code != keyboard.DefaultKeyboard) {
+		return
+	}
+
+	locale := ic.GetTargetLocale()
+	if locale == nil {
+		return
+	}
+
+	if suggested := keyboard.Suggest(locale.Code); len(suggested) > 0 {
+		ic.Keyboard = suggested[0]
+	}
+}
+
+// RemoveAllUsers remove from the data model all previously added user
+func (ic *IdentityConfig) RemoveAllUsers() {
+	ic.Users = []*user.User{}
+}
+
+// AddUser adds a new user to the data model, this function also prevents duplicate entries
+func (ic *IdentityConfig) AddUser(usr *user.User) {
+	for _, curr := range ic.Users {
+		if curr.Equals(usr) {
+			return
+		}
+	}
+
+	ic.Users = append(ic.Users, usr)
+}
+
+// checkEmptyEntries fails if a list of the struct v, of its embedded
+// sections or of the list entries, has an empty entry; a descriptor with "- ~" or "- " list items
+// would otherwise crash the code walking the lists
+func checkEmptyEntries(v reflect.Value) error {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		sf := v.Type().Field(i)
+
+		if sf.Anonymous && field.Kind() == reflect.Struct {
+			if err := checkEmptyEntries(field); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if field.Kind() != reflect.Slice || sf.Type.Elem().Kind() != reflect.Ptr {
+			continue
+		}
+
+		name := strings.Split(sf.Tag.Get("yaml"), ",")[0]
+		if name == "" {
+			name = sf.Name
+		}
+
+		for j := 0; j < field.Len(); j++ {
+			entry := field.Index(j)
+			if entry.IsNil() {
+				return errors.ValidationErrorf("Invalid empty %s entry", name)
+			}
+
+			// the entries may have lists too, i.e: the block devices children
+			if entry.Elem().Kind() == reflect.Struct {
+				if err := checkEmptyEntries(entry.Elem()); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
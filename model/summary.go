@@ -0,0 +1,220 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package model
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/clearlinux/clr-installer/storage"
+	"github.com/clearlinux/clr-installer/utils"
+)
+
+const (
+	// SummaryLanguage is the summary section of the target language
+	SummaryLanguage = "language"
+
+	// SummaryKeyboard is the summary section of the target keyboard
+	SummaryKeyboard = "keyboard"
+
+	// SummaryTimezone is the summary section of the target timezone
+	SummaryTimezone = "timezone"
+
+	// SummaryMedia is the summary section of the target medias
+	SummaryMedia = "media"
+
+	// SummaryUsers is the summary section of the target users
+	SummaryUsers = "users"
+
+	// SummaryTelemetry is the summary section of the telemetry enablement
+	SummaryTelemetry = "telemetry"
+
+	// SummaryBundles is the summary section of the user selected bundles
+	SummaryBundles = "bundles"
+
+	// SummaryKernel is the summary section of the target kernel
+	SummaryKernel = "kernel"
+
+	// SummaryHostname is the summary section of the target hostname
+	SummaryHostname = "hostname"
+
+	// SummaryProxy is the summary section of the HTTPS proxy
+	SummaryProxy = "proxy"
+
+	// SummarySwupdMirror is the summary section of the swupd mirror
+	SummarySwupdMirror = "swupd-mirror"
+
+	// SummaryAutoUpdate is the summary section of the automatic updates
+	SummaryAutoUpdate = "auto-update"
+)
+
+// SummaryItem is the configured value of a model section, Value is the human
+// readable representation, Values the raw configured values and Done tells
+// whether the section is complete for the install to proceed
+type SummaryItem struct {
+	Section string   `json:"section"`
+	Value   string   `json:"value"`
+	Values  []string `json:"values,omitempty"`
+	Done    bool     `json:"done"`
+}
+
+// summaryText returns the localized text, the model may be used before a
+// locale is set, in which case the text is simply formatted
+func summaryText(format string, a ...interface{}) string {
+	if utils.Locale == nil {
+		return fmt.Sprintf(format, a...)
+	}
+	return utils.Locale.Get(format, a...)
+}
+
+// Summary returns the configured value of every model section, the required
+// sections not yet configured have an empty Value and are not Done
+func (si *SystemInstall) Summary() []*SummaryItem {
+	keyboard := ""
+	if si.Keyboard != nil {
+		keyboard = si.Keyboard.Code
+	}
+
+	timezone := ""
+	if si.Timezone != nil {
+		timezone = si.Timezone.Code
+	}
+
+	kernel := ""
+	if si.Kernel != nil {
+		kernel = si.Kernel.Bundle
+	}
+	if si.KernelProfile != "" {
+		kernel = fmt.Sprintf("%s (%s)", kernel, si.KernelProfile)
+	}
+
+	bundles := newSummaryItem(SummaryBundles, strings.Join(si.UserBundles, ", "),
+		summaryText("No additional bundles selected"), false)
+	bundles.Values = si.UserBundles
+
+	return []*SummaryItem{
+		si.languageSummary(),
+		newSummaryItem(SummaryKeyboard, keyboard, "", true),
+		newSummaryItem(SummaryTimezone, timezone, "", true),
+		si.mediaSummary(),
+		si.usersSummary(),
+		enabledSummaryItem(SummaryTelemetry, si.IsTelemetryEnabled()),
+		bundles,
+		newSummaryItem(SummaryKernel, kernel, "", false),
+		newSummaryItem(SummaryHostname, si.Hostname, summaryText("No target system hostname assigned"), false),
+		newSummaryItem(SummaryProxy, si.HTTPSProxy, summaryText("No HTTPS proxy URL set"), false),
+		newSummaryItem(SummarySwupdMirror, si.SwupdMirror, summaryText("No swupd mirror set"), false),
+		enabledSummaryItem(SummaryAutoUpdate, si.AutoUpdate),
+	}
+}
+
+// newSummaryItem returns the summary item of a single value section, unset is
+// the value shown when the section is not configured
+func newSummaryItem(section string, value string, unset string, required bool) *SummaryItem {
+	if value == "" {
+		return &SummaryItem{Section: section, Value: unset, Done: !required}
+	}
+
+	return &SummaryItem{Section: section, Value: value, Values: []string{value}, Done: true}
+}
+
+// enabledSummaryItem returns the summary item of an on/off section
+func enabledSummaryItem(section string, enabled bool) *SummaryItem {
+	if enabled {
+		return &SummaryItem{Section: section, Value: summaryText("Enabled"), Values: []string{"true"}, Done: true}
+	}
+
+	return &SummaryItem{Section: section, Value: summaryText("Disabled"), Values: []string{"false"}, Done: true}
+}
+
+// SummaryOf returns the summary item of section, nil if the section is unknown
+func (si *SystemInstall) SummaryOf(section string) *SummaryItem {
+	for _, curr := range si.Summary() {
+		if curr.Section == section {
+			return curr
+		}
+	}
+
+	return nil
+}
+
+// SummaryValue returns the human readable configured value of section
+func (si *SystemInstall) SummaryValue(section string) string {
+	if item := si.SummaryOf(section); item != nil {
+		return item.Value
+	}
+
+	return ""
+}
+
+func (si *SystemInstall) languageSummary() *SummaryItem {
+	item := &SummaryItem{Section: SummaryLanguage}
+
+	if locale := si.GetTargetLocale(); locale != nil {
+		desc, code := locale.GetConfValues()
+		item.Value = fmt.Sprintf("%s  [%s]", desc, code)
+		item.Values = []string{code}
+		item.Done = true
+	}
+
+	return item
+}
+
+func (si *SystemInstall) mediaSummary() *SummaryItem {
+	item := &SummaryItem{Section: SummaryMedia, Value: summaryText("No Media Selected")}
+
+	if len(si.TargetMedias) == 0 {
+		return item
+	}
+
+	target := si.InstallSelected
+	portion := storage.FormatInstallPortion(target)
+	size, _ := storage.HumanReadableSizeWithPrecision(target.FreeEnd-target.FreeStart, 1)
+
+	layout := ""
+	for _, bd := range si.TargetMedias {
+		item.Values = append(item.Values, bd.Name)
+
+		if bd.IsVolumeGroup() {
+			layout = " " + summaryText("LVM")
+		}
+
+		if bd.IsRAIDArray() {
+			layout = " " + summaryText("RAID")
+		}
+
+		for _, ch := range bd.Children {
+			if ch.Type == storage.BlockDeviceTypeCrypt {
+				layout = " " + summaryText("Encryption")
+			}
+		}
+	}
+
+	item.Value = fmt.Sprintf("%s (%s) %s%s %s", target.Friendly, target.Name, portion, layout, size)
+	item.Done = true
+
+	return item
+}
+
+func (si *SystemInstall) usersSummary() *SummaryItem {
+	item := &SummaryItem{Section: SummaryUsers, Value: summaryText("No users added"), Done: true}
+
+	if len(si.Users) == 0 {
+		return item
+	}
+
+	result := []string{}
+	for _, curr := range si.Users {
+		text := []string{curr.Login}
+		if curr.Admin {
+			text = append(text, summaryText("admin"))
+		}
+		result = append(result, strings.Join(text, ": "))
+		item.Values = append(item.Values, curr.Login)
+	}
+	item.Value = strings.Join(result, ", ")
+
+	return item
+}
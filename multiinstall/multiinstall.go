@@ -0,0 +1,326 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package multiinstall
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/clearlinux/clr-installer/args"
+	"github.com/clearlinux/clr-installer/cmd"
+	"github.com/clearlinux/clr-installer/controller"
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/log"
+	"github.com/clearlinux/clr-installer/model"
+	"github.com/clearlinux/clr-installer/utils"
+)
+
+// targetFlags are the options set per target, they're dropped from the
+// options passed along to the target installs; the REST API is only served
+// by the orchestrating process
+var targetFlags = []string{
+	"--target", "--config", "-c", "--kickstart", "--log-file", "--swupd-state", "--metrics-address",
+	"--api-server", "--api-token-file",
+}
+
+// Target is one of the installs driven concurrently, each is run by its own
+// installer process as the install state (mounts, progress, swupd state) is
+// global to a process
+type Target struct {
+	Name     string
+	Config   string
+	LogFile  string
+	StateDir string
+	Model    *model.SystemInstall
+}
+
+// loadTargets loads and validates the descriptors of the targets, their
+// names are the descriptors file names
+func loadTargets(configs []string, options args.Args) ([]*Target, error) {
+	targets := []*Target{}
+	names := map[string]bool{}
+
+	for _, curr := range configs {
+		md, err := model.LoadFile(curr, options)
+		if err != nil {
+			return nil, err
+		}
+
+		if err = md.Validate(); err != nil {
+			return nil, errors.ValidationErrorf("%s: %s", curr, err)
+		}
+
+		targets = append(targets, &Target{Name: targetName(curr, names), Config: curr, Model: md})
+	}
+
+	return targets, nil
+}
+
+// targetName returns the name of the config target, its file name unless
+// already in names
+func targetName(config string, names map[string]bool) string {
+	base := strings.TrimSuffix(filepath.Base(config), filepath.Ext(config))
+	name := base
+
+	for idx := 2; names[name]; idx++ {
+		name = fmt.Sprintf("%s-%d", base, idx)
+	}
+	names[name] = true
+
+	return name
+}
+
+// mediaKeys returns the block devices, image files, volume groups and RAID
+// arrays written by the install of md, they can't be shared by the targets
+func mediaKeys(md *model.SystemInstall) []string {
+	keys := []string{}
+
+	for _, curr := range md.StorageAlias {
+		file, err := filepath.Abs(curr.File)
+		if err != nil {
+			file = curr.File
+		}
+		keys = append(keys, file)
+	}
+
+	for _, curr := range md.TargetMedias {
+		// the aliased medias are their alias files
+		if !strings.Contains(curr.Name, "${") {
+			keys = append(keys, curr.GetDeviceFile())
+		}
+	}
+
+	return keys
+}
+
+// validateTargets checks the targets install to independent medias
+func validateTargets(targets []*Target) error {
+	used := map[string]string{}
+
+	for _, target := range targets {
+		for _, curr := range mediaKeys(target.Model) {
+			if other, found := used[curr]; found && other != target.Name {
+				return errors.ValidationErrorf("The targets %s and %s both install to %s", other, target.Name, curr)
+			}
+			used[curr] = target.Name
+		}
+	}
+
+	return nil
+}
+
+// childArgs returns the arguments of the target installer process, the
+// options of parentArgs apply to all the targets except the target ones
+func childArgs(parentArgs []string, target *Target) []string {
+	result := []string{}
+
+	for idx := 0; idx < len(parentArgs); idx++ {
+		curr := parentArgs[idx]
+		drop := false
+
+		for _, flag := range targetFlags {
+			if curr == flag {
+				// the value is the next argument
+				drop = true
+				idx++
+				break
+			}
+
+			if strings.HasPrefix(curr, flag+"=") || (flag == "-c" && strings.HasPrefix(curr, flag)) {
+				drop = true
+				break
+			}
+		}
+
+		if !drop {
+			result = append(result, curr)
+		}
+	}
+
+	// the targets never reboot the orchestrating system
+	return append(result,
+		"--config", target.Config,
+		"--log-file", target.LogFile,
+		"--swupd-state", target.StateDir,
+		"--reboot=false",
+		"--post-action", model.PostActionStay,
+	)
+}
+
+// prefixWriter writes the lines of a target output prefixed by its name
+type prefixWriter struct {
+	mutex *sync.Mutex
+	out   io.Writer
+	name  string
+}
+
+func (pw *prefixWriter) copy(r io.Reader) {
+	scanner := bufio.NewScanner(r)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		pw.mutex.Lock()
+		_, _ = fmt.Fprintf(pw.out, "[%s] %s\n", pw.name, line)
+		pw.mutex.Unlock()
+	}
+}
+
+// seedStateDir copies the shared download cache to the target state
+// directory, the files are hard linked as swupd never modifies them
+func seedStateDir(cacheDir string, stateDir string) error {
+	if err := utils.MkdirAll(stateDir, 0755); err != nil {
+		return err
+	}
+
+	return cmd.RunAndLog("cp", "-al", cacheDir+"/.", stateDir)
+}
+
+// runTarget runs the install of target and streams its output to out
+func runTarget(exe string, parentArgs []string, target *Target, mutex *sync.Mutex, out io.Writer) error {
+	child := exec.Command(exe, childArgs(parentArgs, target)...)
+
+	reader, writer := io.Pipe()
+	child.Stdout = writer
+	child.Stderr = writer
+
+	done := make(chan bool)
+	go func() {
+		(&prefixWriter{mutex: mutex, out: out, name: target.Name}).copy(reader)
+		done <- true
+	}()
+
+	err := child.Run()
+	_ = writer.Close()
+	<-done
+
+	if err != nil {
+		return errors.Errorf("%s install failed (%v), see: %s", target.Name, err, target.LogFile)
+	}
+
+	return nil
+}
+
+// Validate checks the configs descriptors are valid and install to
+// independent medias
+func Validate(configs []string, options args.Args) error {
+	targets, err := loadTargets(configs, options)
+	if err != nil {
+		return err
+	}
+
+	return validateTargets(targets)
+}
+
+// Run drives the installs of the configs descriptors concurrently, the
+// content common to the targets is downloaded once to a shared cache, the
+// swupd state directory of options if set. Each target output is prefixed
+// by its name, their logs are written next to the options log file.
+func Run(configs []string, options args.Args, parentArgs []string) error {
+	return RunTo(configs, options, parentArgs, os.Stdout)
+}
+
+// RunTo is Run writing the targets output to out, i.e the REST API progress
+// stream. The targets are installed by child installer processes started
+// with parentArgs, the target options excluded, as the install state is
+// global to a process.
+func RunTo(configs []string, options args.Args, parentArgs []string, out io.Writer) error {
+	targets, err := loadTargets(configs, options)
+	if err != nil {
+		return err
+	}
+
+	if err = validateTargets(targets); err != nil {
+		return err
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return errors.Wrap(err)
+	}
+
+	if err = utils.ParseOSClearVersion(); err != nil {
+		return err
+	}
+
+	workDir, err := ioutil.TempDir("", "clr-installer-targets-")
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	defer func() { _ = os.RemoveAll(workDir) }()
+
+	cacheDir := options.SwupdStateDir
+	if cacheDir == "" {
+		cacheDir = filepath.Join(workDir, "cache")
+		options.SwupdStateDir = cacheDir
+	}
+
+	if err = utils.MkdirAll(cacheDir, 0755); err != nil {
+		return err
+	}
+
+	// the targets content is fetched one after the other, the content they
+	// share is only downloaded once
+	for _, curr := range targets {
+		_, _ = fmt.Fprintf(out, "[%s] Downloading the content to the shared cache\n", curr.Name)
+		controller.PrefetchContent(curr.Model, options)
+	}
+
+	logDir := filepath.Dir(options.LogFile)
+
+	for _, curr := range targets {
+		curr.LogFile = filepath.Join(logDir, "clr-installer-"+curr.Name+".log")
+		curr.StateDir = filepath.Join(workDir, curr.Name)
+
+		if err = seedStateDir(cacheDir, curr.StateDir); err != nil {
+			return err
+		}
+	}
+
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	results := make([]error, len(targets))
+
+	for idx, curr := range targets {
+		wg.Add(1)
+
+		go func(idx int, target *Target) {
+			defer wg.Done()
+
+			log.Info("Starting the %s install: %s", target.Name, target.Config)
+			results[idx] = runTarget(exe, parentArgs, target, &mutex, out)
+		}(idx, curr)
+	}
+
+	wg.Wait()
+
+	failed := []string{}
+	for idx, curr := range targets {
+		if results[idx] != nil {
+			log.Error("%s", results[idx])
+			_, _ = fmt.Fprintf(out, "[%s] Failed, see: %s\n", curr.Name, curr.LogFile)
+			failed = append(failed, curr.Name)
+			continue
+		}
+
+		_, _ = fmt.Fprintf(out, "[%s] Installed\n", curr.Name)
+	}
+
+	if len(failed) > 0 {
+		return errors.Errorf("%d of %d targets failed: %s", len(failed), len(targets), strings.Join(failed, ", "))
+	}
+
+	return nil
+}
@@ -0,0 +1,110 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package multiinstall
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/clearlinux/clr-installer/model"
+	"github.com/clearlinux/clr-installer/storage"
+)
+
+func TestTargetName(t *testing.T) {
+	names := map[string]bool{}
+
+	tests := []struct {
+		config string
+		name   string
+	}{
+		{"/etc/targets/web.yaml", "web"},
+		{"db.yaml", "db"},
+		{"/other/web.yaml", "web-2"},
+		{"web", "web-3"},
+	}
+
+	for _, curr := range tests {
+		if name := targetName(curr.config, names); name != curr.name {
+			t.Fatalf("Expected %s target name %q, got: %q", curr.config, curr.name, name)
+		}
+	}
+}
+
+func TestChildArgs(t *testing.T) {
+	target := &Target{
+		Name:     "web",
+		Config:   "web.yaml",
+		LogFile:  "/var/log/clr-installer-web.log",
+		StateDir: "/tmp/state/web",
+	}
+
+	parent := []string{
+		"--target", "web.yaml", "--target=db.yaml", "--log-file", "/var/log/clr-installer.log",
+		"--swupd-state=/var/cache", "--metrics-address", ":9100", "-l", "4", "--offline",
+		"--api-server", ":8080", "--api-token-file=/root/api-token",
+	}
+
+	expected := []string{
+		"-l", "4", "--offline",
+		"--config", "web.yaml",
+		"--log-file", "/var/log/clr-installer-web.log",
+		"--swupd-state", "/tmp/state/web",
+		"--reboot=false",
+		"--post-action", model.PostActionStay,
+	}
+
+	result := childArgs(parent, target)
+	if strings.Join(result, " ") != strings.Join(expected, " ") {
+		t.Fatalf("Expected the child args %v, got: %v", expected, result)
+	}
+}
+
+func TestValidateTargets(t *testing.T) {
+	newTarget := func(name string, disk string, alias string) *Target {
+		md := &model.SystemInstall{}
+
+		if alias != "" {
+			md.StorageAlias = []*model.StorageAlias{{Name: "img", File: alias}}
+		}
+
+		if disk != "" {
+			md.TargetMedias = []*storage.BlockDevice{{Name: disk, Type: storage.BlockDeviceTypeDisk}}
+		}
+
+		return &Target{Name: name, Model: md}
+	}
+
+	tests := []struct {
+		targets []*Target
+		valid   bool
+	}{
+		{[]*Target{newTarget("a", "sdx", ""), newTarget("b", "sdy", "")}, true},
+		{[]*Target{newTarget("a", "sdx", ""), newTarget("b", "sdx", "")}, false},
+		{[]*Target{newTarget("a", "", "/tmp/a.img"), newTarget("b", "", "/tmp/b.img")}, true},
+		{[]*Target{newTarget("a", "", "/tmp/a.img"), newTarget("b", "", "/tmp/../tmp/a.img")}, false},
+	}
+
+	for idx, curr := range tests {
+		err := validateTargets(curr.targets)
+		if curr.valid && err != nil {
+			t.Fatalf("Test %d: expected the targets to be valid, got: %v", idx, err)
+		} else if !curr.valid && err == nil {
+			t.Fatalf("Test %d: expected the targets to conflict", idx)
+		}
+	}
+}
+
+func TestPrefixWriter(t *testing.T) {
+	out := &bytes.Buffer{}
+	pw := &prefixWriter{mutex: &sync.Mutex{}, out: out, name: "web"}
+
+	pw.copy(strings.NewReader("Installing\n\n  Done  \n"))
+
+	if out.String() != "[web] Installing\n[web] Done\n" {
+		t.Fatalf("Unexpected prefixed output: %q", out.String())
+	}
+}
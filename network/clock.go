@@ -0,0 +1,152 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package network
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/clearlinux/clr-installer/cmd"
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/log"
+)
+
+const (
+	// MaxClockSkew is the largest difference to the update server clock
+	// tolerated before correcting the installer clock
+	MaxClockSkew = time.Hour
+)
+
+var (
+	// ntpSyncAttempts is how many seconds to wait for the NTP synchronization
+	// before falling back to the update server time
+	ntpSyncAttempts = 30
+)
+
+// parseDateHeader returns the time of the last Date header of a response
+// headers dump, curl dumps the headers of every redirect followed
+func parseDateHeader(headers string) (time.Time, error) {
+	var result time.Time
+	found := false
+
+	for _, curr := range strings.Split(headers, "\n") {
+		fields := strings.SplitN(strings.TrimSpace(curr), ":", 2)
+		if len(fields) != 2 || !strings.EqualFold(fields[0], "Date") {
+			continue
+		}
+
+		date, err := http.ParseTime(strings.TrimSpace(fields[1]))
+		if err != nil {
+			return result, errors.Wrap(err)
+		}
+
+		result = date
+		found = true
+	}
+
+	if !found {
+		return result, errors.Errorf("No Date header in the response")
+	}
+
+	return result, nil
+}
+
+// GetServerTime returns the url server time as reported by its Date header;
+// the certificate is not verified since a skewed clock is precisely what
+// breaks its validation, the response is only used to read the time
+func GetServerTime(url string) (time.Time, error) {
+	w := bytes.NewBuffer(nil)
+
+	args := []string{
+		"/usr/bin/timeout",
+		"--kill-after=10s",
+		"10s",
+		"/usr/bin/curl",
+		"--no-sessionid",
+		"--insecure",
+		"-s",
+		"-L",
+		"-I",
+		url,
+	}
+
+	if err := cmd.Run(w, args...); err != nil {
+		return time.Time{}, errors.Wrap(err)
+	}
+
+	return parseDateHeader(w.String())
+}
+
+// ClockSkew returns how far the local clock is behind, or ahead if negative,
+// the update server one
+func ClockSkew() (time.Duration, error) {
+	versionURL, err := ioutil.ReadFile(versionURLPath)
+	if err != nil {
+		return 0, errors.Errorf("Read version file %s: %v", versionURLPath, err)
+	}
+
+	server, err := GetServerTime(strings.TrimSpace(string(versionURL)))
+	if err != nil {
+		return 0, err
+	}
+
+	return time.Until(server), nil
+}
+
+// IsClockSkewed returns true if skew is large enough to break TLS
+func IsClockSkewed(skew time.Duration) bool {
+	return skew > MaxClockSkew || skew < -MaxClockSkew
+}
+
+// CorrectClock synchronizes the installer clock with NTP, falling back to
+// the update server time if NTP is not reachable
+func CorrectClock() error {
+	err := syncNTP()
+	if err == nil {
+		return nil
+	}
+	log.Warning("NTP synchronization failed, using the update server time: %v", err)
+
+	skew, err := ClockSkew()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().Add(skew)
+	if err = cmd.RunAndLog("date", "--utc", fmt.Sprintf("--set=@%d", now.Unix())); err != nil {
+		return errors.Wrap(err)
+	}
+
+	// keep the corrected time across the installer reboots, not fatal
+	if err = cmd.RunAndLog("hwclock", "--systohc", "--utc"); err != nil {
+		log.Warning("Could not update the hardware clock: %v", err)
+	}
+
+	return nil
+}
+
+// syncNTP enables the NTP synchronization and waits for it to complete
+func syncNTP() error {
+	if err := cmd.RunAndLog("timedatectl", "set-ntp", "true"); err != nil {
+		return errors.Wrap(err)
+	}
+
+	// count the attempts, the clock jumps once synchronized
+	for i := 0; i < ntpSyncAttempts; i++ {
+		w := bytes.NewBuffer(nil)
+		err := cmd.Run(w, "timedatectl", "show", "--property=NTPSynchronized", "--value")
+		if err == nil && strings.TrimSpace(w.String()) == "yes" {
+			return nil
+		}
+
+		time.Sleep(time.Second)
+	}
+
+	return errors.Errorf("Timed out waiting for the NTP synchronization")
+}
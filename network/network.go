@@ -33,6 +33,8 @@ type Interface struct {
 	DHCP        bool
 	Gateway     string `json:"gateway,omitempty"`
 	DNSServer   string
+	Gateway6    string
+	DNSServer6  string
 	DNSDomain   string
 	UserDefined bool
 	Metric      uint32 `json:"metric,omitempty"`
@@ -40,21 +42,27 @@ type Interface struct {
 
 // Version used for reading and writing YAML
 type interfaceYAMLMarshal struct {
-	Name      string  `yaml:"name,omitempty"`
-	Addrs     []*Addr `yaml:"addrs,omitempty"`
-	DHCP      string  `yaml:"dhcp,omitempty"`
-	Gateway   string  `yaml:"gateway,omitempty"`
-	DNSServer string  `yaml:"dns,omitempty"`
-	DNSDomain string  `yaml:"domain,omitempty"`
+	Name       string  `yaml:"name,omitempty"`
+	Addrs      []*Addr `yaml:"addrs,omitempty"`
+	DHCP       string  `yaml:"dhcp,omitempty"`
+	Gateway    string  `yaml:"gateway,omitempty"`
+	DNSServer  string  `yaml:"dns,omitempty"`
+	Gateway6   string  `yaml:"gateway6,omitempty"`
+	DNSServer6 string  `yaml:"dns6,omitempty"`
+	DNSDomain  string  `yaml:"domain,omitempty"`
 }
 
-// Addr wraps the net' package Addr struct
+// Addr wraps the net' package Addr struct, NetMask is either a mask or a
+// prefix length
 type Addr struct {
 	IP      string
 	NetMask string
 	Version int
 }
 
+// Version used for reading YAML, Addr has no yaml tags
+type addrYAMLUnmarshal Addr
+
 // LangString hold strings for each translated language
 // and one for default if the current language is unavailable
 type LangString struct {
@@ -172,6 +180,8 @@ func (i *Interface) MarshalYAML() (interface{}, error) {
 	im.DHCP = strconv.FormatBool(i.DHCP)
 	im.Gateway = i.Gateway
 	im.DNSServer = i.DNSServer
+	im.Gateway6 = i.Gateway6
+	im.DNSServer6 = i.DNSServer6
 	im.DNSDomain = i.DNSDomain
 
 	return im, nil
@@ -189,8 +199,9 @@ func (i *Interface) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	i.Addrs = im.Addrs
 	i.Gateway = im.Gateway
 	i.DNSServer = im.DNSServer
+	i.Gateway6 = im.Gateway6
+	i.DNSServer6 = im.DNSServer6
 	i.DNSDomain = im.DNSDomain
-	i.UserDefined = false
 
 	if im.DHCP != "" {
 		dhcp, err := strconv.ParseBool(im.DHCP)
@@ -201,6 +212,10 @@ func (i *Interface) UnmarshalYAML(unmarshal func(interface{}) error) error {
 		i.DHCP = dhcp
 	}
 
+	// the static interfaces of a descriptor are applied by the unattended
+	// installs, the DHCP ones are left as is
+	i.UserDefined = !i.DHCP
+
 	return nil
 }
 
@@ -220,6 +235,58 @@ func (i *Interface) HasIPv4Addr() bool {
 	return false
 }
 
+// HasIPv6Addr will lookup an addr with Version set to ipv6
+func (i *Interface) HasIPv6Addr() bool {
+	for _, curr := range i.Addrs {
+		if curr.Version == IPv6 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Validate checks the static configuration of the interface, the addresses
+// and the gateway and DNS server of each family; DHCP interfaces are not
+// checked
+func (i *Interface) Validate() error {
+	if i.DHCP {
+		return nil
+	}
+
+	if len(i.Addrs) == 0 {
+		return errors.ValidationErrorf("Interface %s: a static interface requires an address", i.Name)
+	}
+
+	for _, curr := range i.Addrs {
+		ip := net.ParseIP(curr.IP)
+		if ip == nil || (ip.To4() != nil) != (curr.Version == IPv4) {
+			return errors.ValidationErrorf("Interface %s: invalid %s address: %q",
+				i.Name, curr.VersionString(), curr.IP)
+		}
+
+		if _, err := curr.PrefixLength(); err != nil {
+			return errors.ValidationErrorf("Interface %s: invalid %s netmask: %q",
+				i.Name, curr.VersionString(), curr.NetMask)
+		}
+	}
+
+	if i.Gateway6 != "" && IsValidIPv6(i.Gateway6) != "" {
+		return errors.ValidationErrorf("Interface %s: invalid ipv6 gateway: %q", i.Name, i.Gateway6)
+	}
+
+	if i.DNSServer6 != "" && IsValidIPv6(i.DNSServer6) != "" {
+		return errors.ValidationErrorf("Interface %s: invalid ipv6 DNS server: %q", i.Name, i.DNSServer6)
+	}
+
+	if (i.Gateway6 != "" || i.DNSServer6 != "") && !i.HasIPv6Addr() {
+		return errors.ValidationErrorf("Interface %s: the ipv6 gateway and DNS server require an ipv6 address",
+			i.Name)
+	}
+
+	return nil
+}
+
 // GetGateway returns the best gateway for the interface
 func (i *Interface) GetGateway() (string, error) {
 	const (
@@ -305,6 +372,93 @@ func (a *Addr) VersionString() string {
 	return "ipv6"
 }
 
+// UnmarshalYAML unmarshals Addr from YAML format, the version is taken from
+// the IP address family when it's a valid one
+func (a *Addr) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var am addrYAMLUnmarshal
+
+	if err := unmarshal(&am); err != nil {
+		return err
+	}
+
+	*a = Addr(am)
+
+	if ip := net.ParseIP(a.IP); ip != nil {
+		a.Version = IPv4
+
+		if ip.To4() == nil {
+			a.Version = IPv6
+		}
+	}
+
+	return nil
+}
+
+// PrefixLength returns the prefix length of the address, NetMask is either a
+// prefix length or a mask of the address family
+func (a *Addr) PrefixLength() (int, error) {
+	bits := 32
+	if a.Version == IPv6 {
+		bits = 128
+	}
+
+	if numericOnlyExp.MatchString(a.NetMask) {
+		prefix, err := strconv.Atoi(a.NetMask)
+		if err != nil || prefix > bits {
+			return 0, errors.Errorf("Invalid prefix length: %s", a.NetMask)
+		}
+
+		return prefix, nil
+	}
+
+	if a.Version == IPv4 {
+		return netMaskToCIDR(a.NetMask)
+	}
+
+	mask := net.ParseIP(a.NetMask)
+	if mask == nil || mask.To4() != nil {
+		return 0, errors.Errorf("Invalid mask: %s", a.NetMask)
+	}
+
+	prefix, size := net.IPMask(mask).Size()
+	if size == 0 {
+		return 0, errors.Errorf("Invalid mask: %s", a.NetMask)
+	}
+
+	return prefix, nil
+}
+
+// CIDR returns the address in the CIDR notation, i.e 10.0.0.1/24
+func (a *Addr) CIDR() (string, error) {
+	prefix, err := a.PrefixLength()
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s/%d", a.IP, prefix), nil
+}
+
+// cidrAddrs returns the addresses of the interface with the given version
+// in the CIDR notation
+func (i *Interface) cidrAddrs(version int) ([]string, error) {
+	result := []string{}
+
+	for _, curr := range i.Addrs {
+		if curr.Version != version {
+			continue
+		}
+
+		address, err := curr.CIDR()
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, address)
+	}
+
+	return result, nil
+}
+
 func isDHCP(iface string) (bool, error) {
 	w := bytes.NewBuffer(nil)
 	err := cmd.Run(w, "/usr/bin/ip", "route", "show")
@@ -474,40 +628,35 @@ func (i *Interface) applyNetworkDStatic(root string, file *os.File) error {
 Name={{.Name}}
 
 [Network]
-DNS={{.DNSServer}}
-Address={{.Address}}
-Gateway={{.Gateway}}
-Domains={{.DNSDomain}}
+{{range .DNSServers}}DNS={{.}}
+{{end}}{{range .Addresses}}Address={{.}}
+{{end}}{{range .Gateways}}Gateway={{.}}
+{{end}}Domains={{.DNSDomain}}
 `
 
-	var address string
-
-	for _, curr := range i.Addrs {
-		if curr.Version != IPv4 {
-			continue
-		}
-
-		cidrd, err := netMaskToCIDR(curr.NetMask)
-		if err != nil {
-			return err
-		}
+	addresses, err := i.cidrAddrs(IPv4)
+	if err != nil {
+		return err
+	}
 
-		address = fmt.Sprintf("%s/%d", curr.IP, cidrd)
+	addresses6, err := i.cidrAddrs(IPv6)
+	if err != nil {
+		return err
 	}
 
 	template := template.Must(template.New("").Parse(config))
-	err := template.Execute(file, struct {
-		Name      string
-		DNSServer string
-		Address   string
-		Gateway   string
-		DNSDomain string
+	err = template.Execute(file, struct {
+		Name       string
+		DNSServers []string
+		Addresses  []string
+		Gateways   []string
+		DNSDomain  string
 	}{
-		Name:      i.Name,
-		DNSServer: i.DNSServer,
-		Gateway:   i.Gateway,
-		DNSDomain: i.DNSDomain,
-		Address:   address,
+		Name:       i.Name,
+		DNSServers: nonEmpty(i.DNSServer, i.DNSServer6),
+		Addresses:  append(addresses, addresses6...),
+		Gateways:   nonEmpty(i.Gateway, i.Gateway6),
+		DNSDomain:  i.DNSDomain,
 	})
 
 	if err != nil {
@@ -543,22 +692,30 @@ func (i *Interface) ApplyNetworkD(root string) error {
 	return i.applyNetworkDStatic(root, f)
 }
 
-func (i *Interface) applyNetworkManagerStatic(root string, file *os.File) error {
-	needPacDiscover = true
+// nonEmpty returns the non empty values
+func nonEmpty(values ...string) []string {
+	result := []string{}
 
-	var address string
-
-	for _, curr := range i.Addrs {
-		if curr.Version != IPv4 {
-			continue
+	for _, curr := range values {
+		if curr != "" {
+			result = append(result, curr)
 		}
+	}
 
-		cidrd, err := netMaskToCIDR(curr.NetMask)
-		if err != nil {
-			return err
-		}
+	return result
+}
 
-		address = fmt.Sprintf("%s/%d", curr.IP, cidrd)
+func (i *Interface) applyNetworkManagerStatic(root string, file *os.File) error {
+	needPacDiscover = true
+
+	addresses, err := i.cidrAddrs(IPv4)
+	if err != nil {
+		return err
+	}
+
+	addresses6, err := i.cidrAddrs(IPv6)
+	if err != nil {
+		return err
 	}
 
 	args := []string{
@@ -571,19 +728,49 @@ func (i *Interface) applyNetworkManagerStatic(root string, file *os.File) error
 		i.Name,
 		"con-name",
 		fmt.Sprintf("Wired-%s", i.Name),
-		"ip4",
-		address,
-		"gw4",
-		i.Gateway,
-		"ipv4.method",
-		"manual",
-		"ipv4.dns",
-		i.DNSServer,
-		"ipv4.dns-search",
-		i.DNSDomain,
-	}
-
-	err := cmd.RunAndLog(args...)
+	}
+
+	// the ip4 and ip6 aliases append to the addresses, one per address
+	if len(addresses) > 0 {
+		for _, curr := range addresses {
+			args = append(args, "ip4", curr)
+		}
+
+		args = append(args,
+			"gw4",
+			i.Gateway,
+			"ipv4.method",
+			"manual",
+			"ipv4.dns",
+			i.DNSServer,
+			"ipv4.dns-search",
+			i.DNSDomain,
+		)
+	} else {
+		args = append(args, "ipv4.method", "disabled")
+	}
+
+	if len(addresses6) > 0 {
+		for _, curr := range addresses6 {
+			args = append(args, "ip6", curr)
+		}
+
+		args = append(args, "ipv6.method", "manual")
+
+		if i.Gateway6 != "" {
+			args = append(args, "gw6", i.Gateway6)
+		}
+
+		if i.DNSServer6 != "" {
+			args = append(args, "ipv6.dns", i.DNSServer6)
+		}
+
+		if len(addresses) == 0 {
+			args = append(args, "ipv6.dns-search", i.DNSDomain)
+		}
+	}
+
+	err = cmd.RunAndLog(args...)
 	if err != nil {
 		return errors.Wrap(err)
 	}
@@ -770,6 +957,36 @@ func FetchRemoteConfigFile(url string) (string, error) {
 	return out.Name(), nil
 }
 
+// PostJSON POSTs the JSON encoded payload to url, as FetchRemoteConfigFile
+// curl is used so the system proxy configuration is honored
+func PostJSON(url string, payload []byte) error {
+	args := []string{
+		"timeout",
+		"--kill-after=30s",
+		"30s",
+		"curl",
+		"--no-sessionid",
+		"-o",
+		"/dev/null",
+		"-s",
+		"-f",
+		"-X",
+		"POST",
+		"-H",
+		"Content-Type: application/json",
+		"--data-binary",
+		"@-",
+		url,
+	}
+
+	if err := cmd.PipeRunAndLog(string(payload), args...); err != nil {
+		log.Debug("PostJSON failed : %q", err)
+		return errors.Wrap(err)
+	}
+
+	return nil
+}
+
 // DownloadInstallerMessage pulls down a message from a URL
 // Intended for getting a message to display before or after
 // the installation process
@@ -829,6 +1046,16 @@ func IsValidIP(str string) string {
 	return ""
 }
 
+// IsValidIPv6 returns empty string if the IPv6 address is valid
+func IsValidIPv6(str string) string {
+	ip := net.ParseIP(str)
+	if ip == nil || ip.To4() != nil || !strings.Contains(str, ":") {
+		return "Invalid IPv6 Addr"
+	}
+
+	return ""
+}
+
 // EnablePacDiscovery turns on the pacdiscovery service
 // Normally this service is enabled by a DHCP lease path, but
 // it must be manually enabled if we set a static IP
@@ -8,7 +8,11 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+
+	"gopkg.in/yaml.v2"
 
 	"github.com/clearlinux/clr-installer/utils"
 )
@@ -251,6 +255,312 @@ func TestHasIPv4Addr(t *testing.T) {
 	}
 }
 
+func TestHasIPv6Addr(t *testing.T) {
+	iface := &Interface{}
+
+	iface.AddAddr("10.0.0.1", "255.255.255.0", IPv4)
+	if iface.HasIPv6Addr() == true {
+		t.Fatalf("Interface has no ipv6 but HasIPv6Addr() returned true")
+	}
+
+	iface.AddAddr("2001:db8::10", "64", IPv6)
+	if iface.HasIPv6Addr() == false {
+		t.Fatalf("Interface has an ipv6 but HasIPv6Addr() returned false")
+	}
+}
+
+func TestIPv6Address(t *testing.T) {
+	tests := []struct {
+		addr     string
+		expected string
+	}{
+		{"2001:db8::10", ""},
+		{"fe80::1adb:f2ff:fe5c:664b", ""},
+		{"::1", ""},
+		{"10.0.0.1", "Invalid IPv6 Addr"},
+		{"::ffff:10.0.0.1", "Invalid IPv6 Addr"},
+		{"2001:db8::g", "Invalid IPv6 Addr"},
+		{"", "Invalid IPv6 Addr"},
+	}
+
+	for _, curr := range tests {
+		msg := IsValidIPv6(curr.addr)
+
+		if msg != curr.expected {
+			t.Fatalf("IsValidIPv6(%q) expected to return %q but returned %q", curr.addr, curr.expected, msg)
+		}
+	}
+}
+
+func TestPrefixLength(t *testing.T) {
+	tests := []struct {
+		addr   *Addr
+		prefix int
+		valid  bool
+	}{
+		{&Addr{"10.0.0.1", "255.255.255.0", IPv4}, 24, true},
+		{&Addr{"10.0.0.1", "16", IPv4}, 16, true},
+		{&Addr{"10.0.0.1", "33", IPv4}, 0, false},
+		{&Addr{"10.0.0.1", "ffff::", IPv4}, 0, false},
+		{&Addr{"2001:db8::10", "64", IPv6}, 64, true},
+		{&Addr{"2001:db8::10", "ffff:ffff:ffff:ffff::", IPv6}, 64, true},
+		{&Addr{"2001:db8::10", "129", IPv6}, 0, false},
+		{&Addr{"2001:db8::10", "ffff::ffff", IPv6}, 0, false},
+		{&Addr{"2001:db8::10", "255.255.255.0", IPv6}, 0, false},
+	}
+
+	for _, curr := range tests {
+		prefix, err := curr.addr.PrefixLength()
+		if curr.valid && err != nil {
+			t.Fatalf("PrefixLength() of %s should pass: %v", curr.addr.NetMask, err)
+		}
+
+		if !curr.valid && err == nil {
+			t.Fatalf("PrefixLength() of %s should fail", curr.addr.NetMask)
+		}
+
+		if prefix != curr.prefix {
+			t.Fatalf("PrefixLength() of %s expected %d, got: %d", curr.addr.NetMask, curr.prefix, prefix)
+		}
+	}
+}
+
+func TestDualStackYaml(t *testing.T) {
+	content := `name: eth0
+addrs:
+- ip: 10.0.0.5
+  netmask: 255.255.255.0
+  version: 0
+- ip: 2001:db8::5
+  netmask: "64"
+dhcp: "false"
+gateway: 10.0.0.1
+dns: 10.0.0.1
+gateway6: 2001:db8::1
+dns6: 2001:db8::53
+`
+	iface := &Interface{}
+	if err := yaml.Unmarshal([]byte(content), iface); err != nil {
+		t.Fatal(err)
+	}
+
+	if iface.Addrs[0].Version != IPv4 || iface.Addrs[1].Version != IPv6 {
+		t.Fatalf("The address versions should be set by the address family: %+v %+v",
+			iface.Addrs[0], iface.Addrs[1])
+	}
+
+	if iface.Gateway6 != "2001:db8::1" || iface.DNSServer6 != "2001:db8::53" {
+		t.Fatalf("Unexpected ipv6 gateway and DNS server: %q %q", iface.Gateway6, iface.DNSServer6)
+	}
+
+	if err := iface.Validate(); err != nil {
+		t.Fatalf("Dual stack interface should be valid: %v", err)
+	}
+
+	if !iface.IsUserDefined() {
+		t.Fatalf("A static interface should be applied")
+	}
+
+	marshaled, err := yaml.Marshal(iface)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := &Interface{}
+	if err = yaml.Unmarshal(marshaled, loaded); err != nil {
+		t.Fatal(err)
+	}
+
+	if loaded.Gateway6 != iface.Gateway6 || loaded.DNSServer6 != iface.DNSServer6 ||
+		len(loaded.Addrs) != 2 || loaded.Addrs[1].Version != IPv6 {
+		t.Fatalf("Unexpected reloaded interface: %+v", loaded)
+	}
+}
+
+func TestValidateInterface(t *testing.T) {
+	tests := []struct {
+		iface *Interface
+		valid bool
+	}{
+		{&Interface{Name: "eth0", DHCP: true}, true},
+		{&Interface{Name: "eth0"}, false},
+		{&Interface{Name: "eth0", Addrs: []*Addr{{"2001:db8::5", "64", IPv6}}, Gateway6: "2001:db8::1"}, true},
+		{&Interface{Name: "eth0", Addrs: []*Addr{{"2001:db8::5", "64", IPv4}}}, false},
+		{&Interface{Name: "eth0", Addrs: []*Addr{{"10.0.0.5", "64", IPv4}}}, false},
+		{&Interface{Name: "eth0", Addrs: []*Addr{{"2001:db8::5", "64", IPv6}}, Gateway6: "10.0.0.1"}, false},
+		{&Interface{Name: "eth0", Addrs: []*Addr{{"2001:db8::5", "64", IPv6}}, DNSServer6: "dns"}, false},
+		{&Interface{Name: "eth0", Addrs: []*Addr{{"10.0.0.5", "24", IPv4}}, Gateway6: "2001:db8::1"}, false},
+	}
+
+	for i, curr := range tests {
+		err := curr.iface.Validate()
+
+		if curr.valid && err != nil {
+			t.Fatalf("Test %d should pass: %v", i, err)
+		}
+
+		if !curr.valid && err == nil {
+			t.Fatalf("Test %d should fail", i)
+		}
+	}
+}
+
+func TestApplyNetworkDDualStack(t *testing.T) {
+	file, err := ioutil.TempFile("", "clr-installer-utest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.Remove(file.Name()) }()
+	defer func() { _ = file.Close() }()
+
+	iface := &Interface{
+		Name: "eth0",
+		Addrs: []*Addr{
+			{"10.0.0.5", "255.255.255.0", IPv4},
+			{"2001:db8::5", "64", IPv6},
+		},
+		Gateway:    "10.0.0.1",
+		DNSServer:  "10.0.0.1",
+		Gateway6:   "2001:db8::1",
+		DNSServer6: "2001:db8::53",
+	}
+
+	if err = iface.applyNetworkDStatic("", file); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := ioutil.ReadFile(file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, curr := range []string{"DNS=10.0.0.1\n", "DNS=2001:db8::53\n", "Address=10.0.0.5/24\n",
+		"Address=2001:db8::5/64\n", "Gateway=10.0.0.1\n", "Gateway=2001:db8::1\n"} {
+		if !strings.Contains(string(content), curr) {
+			t.Fatalf("The network file should contain %q:\n%s", curr, content)
+		}
+	}
+}
+
+func TestWirelessValidate(t *testing.T) {
+	tests := []struct {
+		w     *Wireless
+		valid bool
+	}{
+		{&Wireless{SSID: "home", Passphrase: "env:WIFI_PASSPHRASE"}, true},
+		{&Wireless{SSID: "home", Security: WirelessWPA3, PSK: "passphrase"}, true},
+		{&Wireless{SSID: "cafe", Security: WirelessOpen}, true},
+		{&Wireless{SSID: "", Passphrase: "env:WIFI_PASSPHRASE"}, false},
+		{&Wireless{SSID: "012345678901234567890123456789012"}, false},
+		{&Wireless{SSID: "home", Security: "wep"}, false},
+		{&Wireless{SSID: "home", Passphrase: "passphrase"}, false},
+		{&Wireless{SSID: "home", PSK: "short"}, false},
+	}
+
+	for i, curr := range tests {
+		err := curr.w.Validate()
+
+		if curr.valid && err != nil {
+			t.Fatalf("Test %d should pass: %v", i, err)
+		}
+
+		if !curr.valid && err == nil {
+			t.Fatalf("Test %d should fail", i)
+		}
+	}
+}
+
+func TestWirelessProfile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "clr-installer-utest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	if err = os.Setenv("CLR_INSTALLER_TEST_WIFI", "pass\\phrase\n"); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.Unsetenv("CLR_INSTALLER_TEST_WIFI") }()
+
+	w := &Wireless{SSID: "my home", Security: WirelessWPA3, Passphrase: "env:CLR_INSTALLER_TEST_WIFI"}
+	if err = w.WriteProfile(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	file := filepath.Join(dir, networkManagerDir, "Wireless-my_home.nmconnection")
+
+	fi, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fi.Mode().Perm() != 0600 {
+		t.Fatalf("The profile holds the passphrase, it must be readable by root only: %v", fi.Mode())
+	}
+
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, curr := range []string{"id=Wireless-my home\n", "ssid=my home\n", "key-mgmt=sae\n", "psk=pass\\\\phrase\n"} {
+		if !strings.Contains(string(content), curr) {
+			t.Fatalf("The profile should contain %q:\n%s", curr, content)
+		}
+	}
+
+	w = &Wireless{SSID: "cafe", Security: WirelessOpen}
+	if content, err := w.profile(); err != nil || strings.Contains(content, "wifi-security") {
+		t.Fatalf("An open network should have no security: %v\n%s", err, content)
+	}
+
+	w = &Wireless{SSID: "home"}
+	if _, err = w.profile(); err == nil {
+		t.Fatal("A WPA2 network without passphrase should fail")
+	}
+
+	if ssid := keyfileSSID("a;b"); ssid != "97;59;98;" {
+		t.Fatalf("An SSID with a separator should be written as bytes: %s", ssid)
+	}
+}
+
+func TestWirelessSecurity(t *testing.T) {
+	tests := []struct {
+		keyMgmt  []string
+		security string
+	}{
+		{[]string{}, WirelessOpen},
+		{[]string{"wpa-psk"}, WirelessWPA2},
+		{[]string{"wpa-psk", "sae"}, WirelessWPA2},
+		{[]string{"sae"}, WirelessWPA3},
+		{[]string{"wpa-eap"}, ""},
+	}
+
+	for _, curr := range tests {
+		if security := wpaSecurity(curr.keyMgmt); security != curr.security {
+			t.Fatalf("wpaSecurity(%v) expected %q, got: %q", curr.keyMgmt, curr.security, security)
+		}
+	}
+
+	if iwdSecurity("psk") != WirelessWPA2 || iwdSecurity("open") != WirelessOpen || iwdSecurity("8021x") != "" {
+		t.Fatal("Unexpected iwd security")
+	}
+}
+
+func TestMergeAccessPoints(t *testing.T) {
+	aps := mergeAccessPoints([]*AccessPoint{
+		{SSID: "home", Security: WirelessWPA2, Signal: -70},
+		{SSID: "cafe", Security: WirelessOpen, Signal: -60},
+		{SSID: "home", Security: WirelessWPA2, Signal: -50},
+		{SSID: "", Security: WirelessWPA2, Signal: -40},
+		{SSID: "corp", Security: "", Signal: -30},
+	})
+
+	if len(aps) != 2 || aps[0].SSID != "home" || aps[0].Signal != -50 || aps[1].SSID != "cafe" {
+		t.Fatalf("Unexpected access points: %+v %+v", aps[0], aps[1])
+	}
+}
+
 func TestGoodDomains(t *testing.T) {
 	tests := []struct {
 		domain string
@@ -329,3 +639,219 @@ func TestGoodDownload(t *testing.T) {
 		t.Fatalf("Good Clear Linux HTTPS URL failed: %s", err)
 	}
 }
+
+func TestReleasesBehind(t *testing.T) {
+	tests := []struct {
+		version string
+		latest  string
+		behind  int
+	}{
+		{"31000", "31000", 0},
+		{"31010", "31000", 0},
+		{"31000", "31010", 1},
+		{"31000", "31205", 21},
+	}
+
+	for _, curr := range tests {
+		behind, err := ReleasesBehind(curr.version, curr.latest)
+		if err != nil {
+			t.Fatalf("Should not fail for %s and %s: %v", curr.version, curr.latest, err)
+		}
+
+		if behind != curr.behind {
+			t.Fatalf("%s should be %d releases behind %s, got: %d", curr.version, curr.behind, curr.latest, behind)
+		}
+	}
+
+	if _, err := ReleasesBehind("latest", "31000"); err == nil {
+		t.Fatal("Should fail for a non numeric version")
+	}
+}
+
+func TestWriteHostsBlock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "clr-installer-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	file := filepath.Join(dir, "hosts")
+	if err = ioutil.WriteFile(file, []byte("127.0.0.1 localhost\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	entries := []*HostEntry{{IP: "10.0.0.5", Names: []string{"mirror.example.com", "mirror"}}}
+	if err = writeHostsBlock(file, entries); err != nil {
+		t.Fatal(err)
+	}
+
+	// writing again replaces the previous block
+	entries[0].IP = "10.0.0.6"
+	if err = writeHostsBlock(file, entries); err != nil {
+		t.Fatal(err)
+	}
+
+	content, _ := ioutil.ReadFile(file)
+	expected := "127.0.0.1 localhost\n# clr-installer begin\n10.0.0.6 mirror.example.com mirror\n# clr-installer end\n"
+	if string(content) != expected {
+		t.Fatalf("Expected hosts file %q, got: %q", expected, content)
+	}
+}
+
+func TestValidateHostEntry(t *testing.T) {
+	valid := []*HostEntry{
+		{IP: "10.0.0.5", Names: []string{"mirror.example.com"}},
+		{IP: "fd00::5", Names: []string{"mirror"}},
+	}
+
+	for _, curr := range valid {
+		if err := ValidateHostEntry(curr); err != nil {
+			t.Fatalf("Hosts entry %+v should be valid: %v", curr, err)
+		}
+	}
+
+	invalid := []*HostEntry{
+		{IP: "10.0.0", Names: []string{"mirror"}},
+		{IP: "10.0.0.5"},
+		{IP: "10.0.0.5", Names: []string{"mirror example"}},
+	}
+
+	for _, curr := range invalid {
+		if err := ValidateHostEntry(curr); err == nil {
+			t.Fatalf("Hosts entry %+v should be invalid", curr)
+		}
+	}
+
+	if err := ValidateDNSServer("1.1.1.1"); err != nil {
+		t.Fatalf("DNS server should be valid: %v", err)
+	}
+
+	if err := ValidateDNSServer("dns.example.com"); err == nil {
+		t.Fatal("DNS server host names should be invalid")
+	}
+}
+
+func TestNoProxy(t *testing.T) {
+	entries := ParseNoProxy("localhost, *.example.com,.corp.net 10.0.0.0/8,fd00::/8,[::1]:8080")
+
+	for _, curr := range entries {
+		if err := ValidateNoProxyEntry(curr); err != nil {
+			t.Fatalf("Proxy exception %q should be valid: %v", curr, err)
+		}
+	}
+
+	for _, curr := range []string{"bad_host!", "*.-example.com"} {
+		if err := ValidateNoProxyEntry(curr); err == nil {
+			t.Fatalf("Proxy exception %q should be invalid", curr)
+		}
+	}
+
+	matches := []string{"localhost", "mirror.example.com", "example.com", "a.corp.net",
+		"10.1.2.3", "[fd00::5]:443", "::1"}
+	for _, curr := range matches {
+		if !NoProxyMatches(curr, entries) {
+			t.Fatalf("Host %q should bypass the proxy", curr)
+		}
+	}
+
+	for _, curr := range []string{"notexample.com", "192.168.1.1", "fe80::1"} {
+		if NoProxyMatches(curr, entries) {
+			t.Fatalf("Host %q should use the proxy", curr)
+		}
+	}
+
+	value := NoProxyValue(entries, "https://10.0.0.5/update", "https://mirror.example.com")
+	expected := "localhost,.example.com,.corp.net,10.0.0.0/8,fd00::/8,[::1]:8080,10.0.0.5"
+	if value != expected {
+		t.Fatalf("Expected no_proxy %q, got: %q", expected, value)
+	}
+}
+
+func TestWriteNoProxy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "clr-installer-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	if err = WriteNoProxy(dir, []string{"localhost"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// writing again replaces the previous value
+	if err = WriteNoProxy(dir, []string{"*.example.com"}); err != nil {
+		t.Fatal(err)
+	}
+
+	content, _ := ioutil.ReadFile(filepath.Join(dir, "etc", "environment"))
+	expected := "no_proxy=.example.com\nNO_PROXY=.example.com\n"
+	if string(content) != expected {
+		t.Fatalf("Expected environment file %q, got: %q", expected, content)
+	}
+}
+
+func TestParseDateHeader(t *testing.T) {
+	headers := "HTTP/1.1 301 Moved Permanently\r\nDate: Mon, 01 Jan 2018 00:00:00 GMT\r\n\r\n" +
+		"HTTP/1.1 200 OK\r\ndate: Tue, 15 Jan 2019 10:30:00 GMT\r\nContent-Length: 5\r\n"
+
+	date, err := parseDateHeader(headers)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := time.Date(2019, 1, 15, 10, 30, 0, 0, time.UTC); !date.Equal(expected) {
+		t.Fatalf("Expected the last Date header %v, got: %v", expected, date)
+	}
+
+	if _, err = parseDateHeader("HTTP/1.1 200 OK\r\n"); err == nil {
+		t.Fatal("Should have failed without Date header")
+	}
+
+	if !IsClockSkewed(-48*time.Hour) || IsClockSkewed(5*time.Minute) {
+		t.Fatal("Wrong clock skew tolerance")
+	}
+}
+
+func TestNetworkdFiles(t *testing.T) {
+	valid := []*NetworkdFile{
+		{Name: "10-fieldbus.link", Content: "[Match]\nMACAddress=00:a0:45:12:34:56\n\n[Link]\nName=fieldbus0"},
+		{Name: "20-wired.network.d/mtu.conf", Content: "# jumbo frames\n[Link]\nMTUBytes=9000\n"},
+	}
+
+	if err := ValidateNetworkdFiles(valid); err != nil {
+		t.Fatalf("The networkd files should be valid: %v", err)
+	}
+
+	invalid := []*NetworkdFile{
+		{Name: "../../passwd.network", Content: "[Match]\nName=eth0\n"},
+		{Name: "20-wired.conf", Content: "[Match]\nName=eth0\n"},
+		{Name: "20-wired.network", Content: ""},
+		{Name: "20-wired.network", Content: "Name=eth0\n[Match]\n"},
+		{Name: "20-wired.network", Content: "[Match]\nName eth0\n"},
+	}
+
+	for _, curr := range invalid {
+		if err := curr.Validate(); err == nil {
+			t.Fatalf("The networkd file %q should be invalid: %q", curr.Name, curr.Content)
+		}
+	}
+
+	if err := ValidateNetworkdFiles(append(valid, valid[0])); err == nil {
+		t.Fatal("Should have failed with a duplicated file")
+	}
+
+	dir, err := ioutil.TempDir("", "clr-installer-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	if err = WriteNetworkdFiles(dir, valid); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(dir, systemdNetworkdDir, "20-wired.network.d", "mtu.conf"))
+	if err != nil || string(content) != valid[1].Content {
+		t.Fatalf("Unexpected drop-in content: %q %v", content, err)
+	}
+}
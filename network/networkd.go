@@ -0,0 +1,111 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package network
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/clearlinux/clr-installer/errors"
+)
+
+var (
+	// networkdFileNameExp matches a networkd configuration file name, i.e
+	// 20-wired.network, or a drop-in of a configuration file, i.e
+	// 20-wired.network.d/mtu.conf
+	networkdFileNameExp = regexp.MustCompile(
+		`^[A-Za-z0-9_.@+-]+\.(network|netdev|link)(\.d/[A-Za-z0-9_.@+-]+\.conf)?$`)
+
+	// networkdSectionExp and networkdKeyExp match the section headers and
+	// the assignments of a networkd configuration file
+	networkdSectionExp = regexp.MustCompile(`^\[[A-Za-z][A-Za-z0-9]*\]$`)
+	networkdKeyExp     = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9]*\s*=`)
+)
+
+// NetworkdFile is a systemd-networkd configuration file, or drop-in, installed
+// as is to the target, i.e a .link file naming an exotic NIC
+type NetworkdFile struct {
+	// Name is the file name relative to /etc/systemd/network
+	Name string `yaml:"name,omitempty"`
+
+	// Content is the file content
+	Content string `yaml:"content,omitempty"`
+}
+
+// Validate checks the file name and the syntax of its content
+func (nf *NetworkdFile) Validate() error {
+	if !networkdFileNameExp.MatchString(nf.Name) {
+		return errors.ValidationErrorf("Invalid networkd file name %q, i.e: 20-wired.network or 20-wired.network.d/mtu.conf",
+			nf.Name)
+	}
+
+	if strings.TrimSpace(nf.Content) == "" {
+		return errors.ValidationErrorf("The networkd file %s is empty", nf.Name)
+	}
+
+	section := false
+
+	for i, line := range strings.Split(nf.Content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+
+		if networkdSectionExp.MatchString(line) {
+			section = true
+			continue
+		}
+
+		if !section || !networkdKeyExp.MatchString(line) {
+			return errors.ValidationErrorf("Invalid networkd file %s:%d: %q", nf.Name, i+1, line)
+		}
+	}
+
+	return nil
+}
+
+// ValidateNetworkdFiles checks the networkd files and that their names are
+// unique
+func ValidateNetworkdFiles(files []*NetworkdFile) error {
+	seen := map[string]bool{}
+
+	for _, curr := range files {
+		if err := curr.Validate(); err != nil {
+			return err
+		}
+
+		if seen[curr.Name] {
+			return errors.ValidationErrorf("The networkd file %s is declared more than once", curr.Name)
+		}
+		seen[curr.Name] = true
+	}
+
+	return nil
+}
+
+// WriteNetworkdFiles writes the networkd files to the system at rootDir
+func WriteNetworkdFiles(rootDir string, files []*NetworkdFile) error {
+	for _, curr := range files {
+		path := filepath.Join(rootDir, systemdNetworkdDir, curr.Name)
+
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return errors.Wrap(err)
+		}
+
+		content := curr.Content
+		if !strings.HasSuffix(content, "\n") {
+			content = content + "\n"
+		}
+
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			return errors.Wrap(err)
+		}
+	}
+
+	return nil
+}
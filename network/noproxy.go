@@ -0,0 +1,159 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package network
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/clearlinux/clr-installer/errors"
+)
+
+// ParseNoProxy splits a comma or space separated proxy exceptions list
+func ParseNoProxy(value string) []string {
+	return strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t'
+	})
+}
+
+// ValidateNoProxyEntry checks entry is a proxy exception: a host name, a
+// domain suffix (".example.com" or "*.example.com"), an IPv4 or IPv6
+// address or a CIDR network, optionally followed by a port
+func ValidateNoProxyEntry(entry string) error {
+	if entry == "*" {
+		return nil
+	}
+
+	if _, _, err := net.ParseCIDR(entry); err == nil {
+		return nil
+	}
+
+	host := splitNoProxyPort(entry)
+
+	if net.ParseIP(strings.Trim(host, "[]")) != nil {
+		return nil
+	}
+
+	host = strings.TrimPrefix(strings.TrimPrefix(host, "*"), ".")
+	if msg := IsValidDomainName(host); msg != "" {
+		return errors.ValidationErrorf("Invalid proxy exception %q: %s", entry, msg)
+	}
+
+	return nil
+}
+
+// splitNoProxyPort returns entry without its port, if any
+func splitNoProxyPort(entry string) string {
+	if host, _, err := net.SplitHostPort(entry); err == nil {
+		return host
+	}
+
+	return entry
+}
+
+// NoProxyMatches returns true if host bypasses the proxy according to entries,
+// the entries are matched as domain suffixes, IP addresses or CIDR networks
+func NoProxyMatches(host string, entries []string) bool {
+	host = strings.ToLower(strings.Trim(splitNoProxyPort(host), "[]"))
+	ip := net.ParseIP(host)
+
+	for _, curr := range entries {
+		curr = strings.ToLower(curr)
+
+		if curr == "*" {
+			return true
+		}
+
+		if _, ipNet, err := net.ParseCIDR(curr); err == nil {
+			if ip != nil && ipNet.Contains(ip) {
+				return true
+			}
+			continue
+		}
+
+		curr = strings.Trim(splitNoProxyPort(curr), "[]")
+
+		if ip != nil {
+			if entryIP := net.ParseIP(curr); entryIP != nil && entryIP.Equal(ip) {
+				return true
+			}
+			continue
+		}
+
+		suffix := strings.TrimPrefix(strings.TrimPrefix(curr, "*"), ".")
+		if host == suffix || strings.HasSuffix(host, "."+suffix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// NoProxyValue returns the no_proxy environment variable value of entries,
+// as understood by curl: the wildcards are turned into domain suffixes and,
+// since curl may not match CIDR networks, urls hosts matching a network are
+// added literally
+func NoProxyValue(entries []string, urls ...string) string {
+	result := []string{}
+
+	for _, curr := range entries {
+		if strings.HasPrefix(curr, "*.") {
+			curr = strings.TrimPrefix(curr, "*")
+		}
+		result = append(result, curr)
+	}
+
+	for _, curr := range urls {
+		u, err := url.Parse(curr)
+		if err != nil || u.Hostname() == "" || net.ParseIP(u.Hostname()) == nil {
+			continue
+		}
+
+		if NoProxyMatches(u.Hostname(), entries) {
+			result = append(result, u.Hostname())
+		}
+	}
+
+	return strings.Join(result, ",")
+}
+
+// WriteNoProxy persists the proxy exceptions to the target system environment
+func WriteNoProxy(rootDir string, entries []string) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	file := filepath.Join(rootDir, "etc", "environment")
+	value := NoProxyValue(entries)
+
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return errors.Wrap(err)
+	}
+
+	content, err := ioutil.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err)
+	}
+
+	lines := []string{}
+	for _, curr := range strings.Split(strings.TrimRight(string(content), "\n"), "\n") {
+		if curr != "" && !strings.HasPrefix(curr, "no_proxy=") && !strings.HasPrefix(curr, "NO_PROXY=") {
+			lines = append(lines, curr)
+		}
+	}
+
+	lines = append(lines, fmt.Sprintf("no_proxy=%s", value), fmt.Sprintf("NO_PROXY=%s", value))
+
+	if err = ioutil.WriteFile(file, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		return errors.Wrap(err)
+	}
+
+	return nil
+}
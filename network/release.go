@@ -0,0 +1,97 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package network
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/clearlinux/clr-installer/errors"
+)
+
+const (
+	// ReleaseVersionStep is the version number increment between two
+	// consecutive Clear Linux releases
+	ReleaseVersionStep = 10
+
+	latestVersionURL    = "https://cdn.download.clearlinux.org/latest"
+	releaseNotesURLBase = "https://cdn.download.clearlinux.org/releases/%s/clear/RELEASENOTES"
+)
+
+// fetchRemoteText downloads the content of url
+func fetchRemoteText(url string) (string, error) {
+	file, err := FetchRemoteConfigFile(url)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = os.Remove(file) }()
+
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", errors.Wrap(err)
+	}
+
+	return string(content), nil
+}
+
+// GetLatestVersion returns the latest released Clear Linux version
+func GetLatestVersion() (string, error) {
+	content, err := fetchRemoteText(latestVersionURL)
+	if err != nil {
+		return "", err
+	}
+
+	version := strings.TrimSpace(content)
+	if !numericOnlyExp.MatchString(version) {
+		return "", errors.Errorf("Invalid latest version: %q", version)
+	}
+
+	return version, nil
+}
+
+// GetReleaseNotes returns the first maxLines non empty lines of the
+// release notes of version
+func GetReleaseNotes(version string, maxLines int) (string, error) {
+	content, err := fetchRemoteText(fmt.Sprintf(releaseNotesURLBase, version))
+	if err != nil {
+		return "", err
+	}
+
+	lines := []string{}
+	for _, line := range strings.Split(content, "\n") {
+		if len(lines) == maxLines {
+			break
+		}
+
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
+
+// ReleasesBehind returns the approximate number of releases published
+// between version and latest
+func ReleasesBehind(version string, latest string) (int, error) {
+	curr, err := strconv.Atoi(version)
+	if err != nil {
+		return 0, errors.Wrap(err)
+	}
+
+	last, err := strconv.Atoi(latest)
+	if err != nil {
+		return 0, errors.Wrap(err)
+	}
+
+	if last <= curr {
+		return 0, nil
+	}
+
+	return (last - curr + ReleaseVersionStep - 1) / ReleaseVersionStep, nil
+}
@@ -0,0 +1,140 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package network
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/clearlinux/clr-installer/cmd"
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/log"
+)
+
+const (
+	hostsBlockBegin = "# clr-installer begin"
+	hostsBlockEnd   = "# clr-installer end"
+)
+
+var (
+	// hostsFile is the installer environment hosts file
+	hostsFile = "/etc/hosts"
+
+	// resolvedDropInFile is the systemd-resolved drop-in overriding the
+	// installer environment DNS servers
+	resolvedDropInFile = "/etc/systemd/resolved.conf.d/clr-installer.conf"
+)
+
+// HostEntry is a static host name resolution added to the installer
+// environment hosts file
+type HostEntry struct {
+	IP    string   `yaml:"ip"`
+	Names []string `yaml:"names,flow"`
+}
+
+// ValidateHostEntry checks the entry address and host names
+func ValidateHostEntry(entry *HostEntry) error {
+	if net.ParseIP(entry.IP) == nil {
+		return errors.ValidationErrorf("Invalid hosts entry address: %q", entry.IP)
+	}
+
+	if len(entry.Names) == 0 {
+		return errors.ValidationErrorf("The hosts entry %s has no host name", entry.IP)
+	}
+
+	for _, curr := range entry.Names {
+		if msg := IsValidDomainName(curr); msg != "" {
+			return errors.ValidationErrorf("Invalid hosts entry name %q: %s", curr, msg)
+		}
+	}
+
+	return nil
+}
+
+// ValidateDNSServer checks server is an IP address
+func ValidateDNSServer(server string) error {
+	if net.ParseIP(server) == nil {
+		return errors.ValidationErrorf("Invalid DNS server address: %q", server)
+	}
+
+	return nil
+}
+
+// ApplyInstallerResolution makes the installer environment, not the target,
+// resolve names with servers and entries; systemd-resolved is restarted if
+// the DNS servers changed
+func ApplyInstallerResolution(servers []string, entries []*HostEntry) error {
+	if len(entries) > 0 {
+		if err := writeHostsBlock(hostsFile, entries); err != nil {
+			return err
+		}
+	}
+
+	if len(servers) == 0 {
+		return nil
+	}
+
+	content := fmt.Sprintf("[Resolve]\nDNS=%s\nDomains=~.\n", strings.Join(servers, " "))
+
+	// avoid restarting resolved, and loosing its cache, when nothing changed
+	if current, err := ioutil.ReadFile(resolvedDropInFile); err == nil && string(current) == content {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(resolvedDropInFile), 0755); err != nil {
+		return errors.Wrap(err)
+	}
+
+	if err := ioutil.WriteFile(resolvedDropInFile, []byte(content), 0644); err != nil {
+		return errors.Wrap(err)
+	}
+
+	log.Info("Using the DNS servers: %s", strings.Join(servers, " "))
+
+	if err := cmd.RunAndLog("systemctl", "restart", "systemd-resolved"); err != nil {
+		return errors.Wrap(err)
+	}
+
+	return nil
+}
+
+// writeHostsBlock replaces the installer block of the hosts file with
+// entries, keeping the other entries
+func writeHostsBlock(file string, entries []*HostEntry) error {
+	lines := []string{}
+
+	content, err := ioutil.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err)
+	}
+
+	inBlock := false
+	for _, curr := range strings.Split(strings.TrimRight(string(content), "\n"), "\n") {
+		switch {
+		case curr == hostsBlockBegin:
+			inBlock = true
+		case curr == hostsBlockEnd:
+			inBlock = false
+		case !inBlock && curr != "":
+			lines = append(lines, curr)
+		}
+	}
+
+	lines = append(lines, hostsBlockBegin)
+	for _, curr := range entries {
+		lines = append(lines, fmt.Sprintf("%s %s", curr.IP, strings.Join(curr.Names, " ")))
+	}
+	lines = append(lines, hostsBlockEnd)
+
+	if err = ioutil.WriteFile(file, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		return errors.Wrap(err)
+	}
+
+	return nil
+}
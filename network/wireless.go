@@ -0,0 +1,462 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package network
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/godbus/dbus"
+
+	"github.com/clearlinux/clr-installer/cmd"
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/log"
+	"github.com/clearlinux/clr-installer/utils"
+)
+
+const (
+	// WirelessWPA2 is a WPA2 personal network, joined with a pre-shared key
+	WirelessWPA2 = "wpa2"
+
+	// WirelessWPA3 is a WPA3 personal network, joined with SAE
+	WirelessWPA3 = "wpa3"
+
+	// WirelessOpen is an open network, joined without a passphrase
+	WirelessOpen = "open"
+
+	iwdDest        = "net.connman.iwd"
+	iwdStation     = iwdDest + ".Station"
+	iwdNetwork     = iwdDest + ".Network"
+	wpaDest        = "fi.w1.wpa_supplicant1"
+	wpaPath        = "/fi/w1/wpa_supplicant1"
+	wpaInterface   = wpaDest + ".Interface"
+	wpaBSS         = wpaDest + ".BSS"
+	objectManager  = "org.freedesktop.DBus.ObjectManager"
+	propertiesIntf = "org.freedesktop.DBus.Properties"
+)
+
+// WirelessSecurities are the supported wireless network securities
+var WirelessSecurities = []string{WirelessWPA2, WirelessWPA3, WirelessOpen}
+
+var (
+	// profileNameExp matches the characters replaced in the profile file names
+	profileNameExp = regexp.MustCompile(`[^0-9A-Za-z_-]`)
+
+	// scanned are the access points found by the latest scan
+	scanned = []*AccessPoint{}
+)
+
+// AccessPoint is a wireless network found by a scan, Signal is in dBm
+type AccessPoint struct {
+	SSID     string
+	Security string
+	Signal   int
+}
+
+// Wireless is the wireless network joined by the installer and the installed
+// system, Passphrase is a secret reference: "env:NAME" or "file:PATH"
+type Wireless struct {
+	SSID       string `yaml:"ssid,omitempty,flow"`
+	Security   string `yaml:"security,omitempty,flow"`
+	Passphrase string `yaml:"passphrase,omitempty,flow"`
+
+	// PSK is the passphrase entered interactively, it's never saved
+	PSK string `yaml:"-"`
+}
+
+// Validate checks the SSID, the security and the passphrase reference, the
+// passphrase itself is only read when joining the network
+func (w *Wireless) Validate() error {
+	if len(w.SSID) == 0 || len(w.SSID) > 32 {
+		return errors.ValidationErrorf("Invalid wireless SSID %q, must be 1 to 32 bytes long", w.SSID)
+	}
+
+	if !utils.StringSliceContains(WirelessSecurities, w.GetSecurity()) {
+		return errors.ValidationErrorf("Invalid wireless security %q, must be one of: %s",
+			w.Security, strings.Join(WirelessSecurities, ", "))
+	}
+
+	if w.Passphrase != "" && !strings.HasPrefix(w.Passphrase, "env:") && !strings.HasPrefix(w.Passphrase, "file:") {
+		return errors.ValidationErrorf("Invalid secret reference %q, expected env:NAME or file:PATH", w.Passphrase)
+	}
+
+	if w.PSK != "" {
+		return validatePassphrase(w.PSK)
+	}
+
+	return nil
+}
+
+// GetSecurity returns the security of the network, WPA2 if not set
+func (w *Wireless) GetSecurity() string {
+	if w.Security == "" {
+		return WirelessWPA2
+	}
+
+	return w.Security
+}
+
+// validatePassphrase checks the passphrase length, a WPA passphrase has 8 to
+// 63 characters
+func validatePassphrase(passphrase string) error {
+	if len(passphrase) < 8 || len(passphrase) > 63 {
+		return errors.ValidationErrorf("Invalid wireless passphrase, must be 8 to 63 characters long")
+	}
+
+	return nil
+}
+
+// readPassphrase returns the passphrase entered interactively or read from
+// the secret reference, empty for the open networks
+func (w *Wireless) readPassphrase() (string, error) {
+	if w.GetSecurity() == WirelessOpen {
+		return "", nil
+	}
+
+	passphrase := w.PSK
+
+	if passphrase == "" {
+		if w.Passphrase == "" {
+			return "", errors.Errorf("No passphrase for the wireless network %s", w.SSID)
+		}
+
+		secret, err := utils.ReadSecret(w.Passphrase)
+		if err != nil {
+			return "", err
+		}
+
+		passphrase = strings.TrimRight(string(secret), "\n")
+	}
+
+	if err := validatePassphrase(passphrase); err != nil {
+		return "", err
+	}
+
+	return passphrase, nil
+}
+
+// ProfileID returns the NetworkManager connection id of the network
+func (w *Wireless) ProfileID() string {
+	return "Wireless-" + w.SSID
+}
+
+// profileFile returns the NetworkManager keyfile of the network in root
+func (w *Wireless) profileFile(root string) string {
+	name := profileNameExp.ReplaceAllString(w.SSID, "_")
+	return filepath.Join(root, networkManagerDir, fmt.Sprintf("Wireless-%s.nmconnection", name))
+}
+
+// profile returns the NetworkManager keyfile content of the network
+func (w *Wireless) profile() (string, error) {
+	passphrase, err := w.readPassphrase()
+	if err != nil {
+		return "", err
+	}
+
+	lines := []string{
+		"[connection]",
+		"id=" + keyfileEscape(w.ProfileID()),
+		"type=wifi",
+		"",
+		"[wifi]",
+		"mode=infrastructure",
+		"ssid=" + keyfileSSID(w.SSID),
+		"",
+	}
+
+	switch w.GetSecurity() {
+	case WirelessWPA2:
+		lines = append(lines, "[wifi-security]", "key-mgmt=wpa-psk", "psk="+keyfileEscape(passphrase), "")
+	case WirelessWPA3:
+		lines = append(lines, "[wifi-security]", "key-mgmt=sae", "psk="+keyfileEscape(passphrase), "")
+	}
+
+	lines = append(lines, "[ipv4]", "method=auto", "", "[ipv6]", "method=auto", "")
+
+	return strings.Join(lines, "\n"), nil
+}
+
+// keyfileEscape escapes a keyfile value, the backslashes and the leading
+// space which would be stripped
+func keyfileEscape(value string) string {
+	value = strings.Replace(value, `\`, `\\`, -1)
+
+	if strings.HasPrefix(value, " ") {
+		value = `\s` + value[1:]
+	}
+
+	return value
+}
+
+// keyfileSSID returns the keyfile SSID value, the SSIDs which are not plain
+// printable strings are written as a list of bytes
+func keyfileSSID(ssid string) string {
+	plain := true
+
+	for _, curr := range []byte(ssid) {
+		if curr < 0x20 || curr > 0x7e || curr == ';' || curr == '\\' {
+			plain = false
+			break
+		}
+	}
+
+	if plain && !strings.HasPrefix(ssid, " ") {
+		return ssid
+	}
+
+	bytes := []string{}
+	for _, curr := range []byte(ssid) {
+		bytes = append(bytes, fmt.Sprintf("%d", curr))
+	}
+
+	return strings.Join(bytes, ";") + ";"
+}
+
+// WriteProfile writes the NetworkManager connection profile of the network
+// to root, readable by root only since it holds the passphrase
+func (w *Wireless) WriteProfile(root string) error {
+	content, err := w.profile()
+	if err != nil {
+		return err
+	}
+
+	file := w.profileFile(root)
+
+	if err = utils.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+
+	if err = ioutil.WriteFile(file, []byte(content), 0600); err != nil {
+		return errors.Wrap(err)
+	}
+
+	return nil
+}
+
+// Connect joins the wireless network with NetworkManager, the profile is
+// written rather than passing the passphrase to nmcli
+func (w *Wireless) Connect() error {
+	if err := w.WriteProfile("/"); err != nil {
+		return err
+	}
+
+	if err := cmd.RunAndLog("nmcli", "connection", "reload"); err != nil {
+		return errors.Wrap(err)
+	}
+
+	if err := cmd.RunAndLog("nmcli", "connection", "up", "id", w.ProfileID()); err != nil {
+		return errors.Wrap(err)
+	}
+
+	return nil
+}
+
+// ScanWireless returns the wireless networks found by iwd or, if it's not
+// running, wpa_supplicant; the strongest first. The latest scan results are
+// returned and a new scan is requested so a later call finds the networks
+// which just appeared
+func ScanWireless() ([]*AccessPoint, error) {
+	conn, err := dbus.SystemBus()
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+
+	aps, err := scanIWD(conn)
+	if err != nil {
+		log.Debug("Could not scan with iwd: %v", err)
+
+		if aps, err = scanWPASupplicant(conn); err != nil {
+			return nil, err
+		}
+	}
+
+	scanned = mergeAccessPoints(aps)
+
+	return scanned, nil
+}
+
+// ScannedAccessPoint returns the access point with ssid found by the latest
+// scan, nil if not found
+func ScannedAccessPoint(ssid string) *AccessPoint {
+	for _, curr := range scanned {
+		if curr.SSID == ssid {
+			return curr
+		}
+	}
+
+	return nil
+}
+
+// mergeAccessPoints returns a single access point per SSID, the strongest,
+// sorted by signal; the hidden and unsupported networks are dropped
+func mergeAccessPoints(aps []*AccessPoint) []*AccessPoint {
+	bySSID := map[string]*AccessPoint{}
+
+	for _, curr := range aps {
+		if curr.SSID == "" || curr.Security == "" {
+			continue
+		}
+
+		if prev, ok := bySSID[curr.SSID]; !ok || curr.Signal > prev.Signal {
+			bySSID[curr.SSID] = curr
+		}
+	}
+
+	result := []*AccessPoint{}
+	for _, curr := range bySSID {
+		result = append(result, curr)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Signal == result[j].Signal {
+			return result[i].SSID < result[j].SSID
+		}
+		return result[i].Signal > result[j].Signal
+	})
+
+	return result
+}
+
+// scanIWD returns the networks ordered by the iwd stations
+func scanIWD(conn *dbus.Conn) ([]*AccessPoint, error) {
+	objects := map[dbus.ObjectPath]map[string]map[string]dbus.Variant{}
+
+	err := conn.Object(iwdDest, "/").Call(objectManager+".GetManagedObjects", 0).Store(&objects)
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+
+	result := []*AccessPoint{}
+
+	for path, intfs := range objects {
+		if _, ok := intfs[iwdStation]; !ok {
+			continue
+		}
+
+		station := conn.Object(iwdDest, path)
+
+		// iwd refuses a scan while it's already scanning
+		if call := station.Call(iwdStation+".Scan", 0); call.Err != nil {
+			log.Debug("Could not request an iwd scan: %v", call.Err)
+		}
+
+		var networks []struct {
+			Path   dbus.ObjectPath
+			Signal int16
+		}
+
+		if err = station.Call(iwdStation+".GetOrderedNetworks", 0).Store(&networks); err != nil {
+			return nil, errors.Wrap(err)
+		}
+
+		for _, curr := range networks {
+			props := objects[curr.Path][iwdNetwork]
+
+			name, _ := props["Name"].Value().(string)
+			kind, _ := props["Type"].Value().(string)
+
+			// the signal strength is reported in 100 * dBm
+			result = append(result, &AccessPoint{SSID: name, Security: iwdSecurity(kind), Signal: int(curr.Signal) / 100})
+		}
+	}
+
+	return result, nil
+}
+
+// iwdSecurity returns the security of an iwd network type, empty if not
+// supported; iwd joins the WPA3 networks as psk ones
+func iwdSecurity(kind string) string {
+	switch kind {
+	case "psk":
+		return WirelessWPA2
+	case "open":
+		return WirelessOpen
+	}
+
+	return ""
+}
+
+// scanWPASupplicant returns the BSSs found by the wpa_supplicant interfaces
+func scanWPASupplicant(conn *dbus.Conn) ([]*AccessPoint, error) {
+	intfs, err := conn.Object(wpaDest, wpaPath).GetProperty(wpaDest + ".Interfaces")
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+
+	paths, ok := intfs.Value().([]dbus.ObjectPath)
+	if !ok {
+		return nil, errors.Errorf("Invalid wpa_supplicant interfaces: %s", intfs)
+	}
+
+	result := []*AccessPoint{}
+
+	for _, path := range paths {
+		intf := conn.Object(wpaDest, path)
+
+		args := map[string]dbus.Variant{"Type": dbus.MakeVariant("active")}
+		if call := intf.Call(wpaInterface+".Scan", 0, args); call.Err != nil {
+			log.Debug("Could not request a wpa_supplicant scan: %v", call.Err)
+		}
+
+		bsss, err := intf.GetProperty(wpaInterface + ".BSSs")
+		if err != nil {
+			return nil, errors.Wrap(err)
+		}
+
+		bssPaths, _ := bsss.Value().([]dbus.ObjectPath)
+
+		for _, bssPath := range bssPaths {
+			props := map[string]dbus.Variant{}
+
+			err = conn.Object(wpaDest, bssPath).Call(propertiesIntf+".GetAll", 0, wpaBSS).Store(&props)
+			if err != nil {
+				log.Debug("Could not read the BSS %s: %v", bssPath, err)
+				continue
+			}
+
+			ssid, _ := props["SSID"].Value().([]byte)
+			signal, _ := props["Signal"].Value().(int16)
+
+			keyMgmt := []string{}
+			for _, curr := range []string{"RSN", "WPA"} {
+				if info, ok := props[curr].Value().(map[string]dbus.Variant); ok {
+					mgmt, _ := info["KeyMgmt"].Value().([]string)
+					keyMgmt = append(keyMgmt, mgmt...)
+				}
+			}
+
+			result = append(result, &AccessPoint{
+				SSID:     string(ssid),
+				Security: wpaSecurity(keyMgmt),
+				Signal:   int(signal),
+			})
+		}
+	}
+
+	return result, nil
+}
+
+// wpaSecurity returns the security of a BSS given its key managements,
+// empty if not supported; the WPA3 transition networks are joined as WPA2
+// ones since every driver supports it
+func wpaSecurity(keyMgmt []string) string {
+	if len(keyMgmt) == 0 {
+		return WirelessOpen
+	}
+
+	if utils.StringSliceContains(keyMgmt, "wpa-psk") || utils.StringSliceContains(keyMgmt, "wpa-psk-sha256") {
+		return WirelessWPA2
+	}
+
+	if utils.StringSliceContains(keyMgmt, "sae") {
+		return WirelessWPA3
+	}
+
+	return ""
+}
@@ -0,0 +1,277 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package oci
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"time"
+
+	"github.com/clearlinux/clr-installer/errors"
+)
+
+const (
+	// MediaTypeManifest is the media type of an image manifest
+	MediaTypeManifest = "application/vnd.oci.image.manifest.v1+json"
+
+	// MediaTypeConfig is the media type of an image configuration
+	MediaTypeConfig = "application/vnd.oci.image.config.v1+json"
+
+	// MediaTypeLayer is the media type of a gzip compressed layer
+	MediaTypeLayer = "application/vnd.oci.image.layer.v1.tar+gzip"
+
+	// DefaultTag is the reference name of an image without a tag
+	DefaultTag = "latest"
+
+	// RefNameAnnotation is the index annotation holding the image tag
+	RefNameAnnotation = "org.opencontainers.image.ref.name"
+
+	// layoutVersion is the version of the image layout written
+	layoutVersion = "1.0.0"
+
+	// blobsDir is the content addressable blobs directory of a layout
+	blobsDir = "blobs/sha256"
+)
+
+var (
+	// tagExp matches a valid image tag, as accepted by the registries
+	tagExp = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]{0,127}$`)
+
+	// defaultCmd is the command of a container run without one
+	defaultCmd = []string{"/usr/bin/bash"}
+
+	// defaultEnv is the environment of the image processes
+	defaultEnv = []string{"PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"}
+)
+
+// Descriptor references a blob of the image layout
+type Descriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// Index is the entry point of the image layout, listing the image manifests
+type Index struct {
+	SchemaVersion int           `json:"schemaVersion"`
+	Manifests     []*Descriptor `json:"manifests"`
+}
+
+// manifest is the image manifest, the configuration and the layers of an image
+type manifest struct {
+	SchemaVersion int           `json:"schemaVersion"`
+	MediaType     string        `json:"mediaType"`
+	Config        *Descriptor   `json:"config"`
+	Layers        []*Descriptor `json:"layers"`
+}
+
+// imageConfig is the image configuration, the layers uncompressed digests and
+// the defaults of the containers
+type imageConfig struct {
+	Created      string `json:"created"`
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+	Config       struct {
+		Env []string `json:"Env"`
+		Cmd []string `json:"Cmd"`
+	} `json:"config"`
+	RootFS struct {
+		Type    string   `json:"type"`
+		DiffIDs []string `json:"diff_ids"`
+	} `json:"rootfs"`
+}
+
+// ValidateTag checks tag is a valid image tag
+func ValidateTag(tag string) error {
+	if !tagExp.MatchString(tag) {
+		return errors.Errorf("Invalid image tag %q, i.e: latest or 31200", tag)
+	}
+
+	return nil
+}
+
+// digest returns the digest string of the sha256 hash h
+func digest(h hash.Hash) string {
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))
+}
+
+// blobPath returns the path of the blob digest in the layout at dir
+func blobPath(dir string, digest string) string {
+	return filepath.Join(dir, blobsDir, digest[len("sha256:"):])
+}
+
+// writeLayer compresses the layer tarball into the layout at dir, its
+// descriptor and uncompressed digest are returned
+func writeLayer(dir string, layer string) (*Descriptor, string, error) {
+	in, err := os.Open(layer)
+	if err != nil {
+		return nil, "", errors.Wrap(err)
+	}
+	defer func() { _ = in.Close() }()
+
+	out, err := ioutil.TempFile(filepath.Join(dir, blobsDir), "layer-")
+	if err != nil {
+		return nil, "", errors.Wrap(err)
+	}
+	tmpFile := out.Name()
+	defer func() { _ = os.Remove(tmpFile) }()
+
+	diffID := sha256.New()
+	compressed := sha256.New()
+	counter := &countWriter{}
+
+	gz := gzip.NewWriter(io.MultiWriter(out, compressed, counter))
+	if _, err = io.Copy(io.MultiWriter(gz, diffID), in); err != nil {
+		_ = out.Close()
+		return nil, "", errors.Wrap(err)
+	}
+
+	if err = gz.Close(); err != nil {
+		_ = out.Close()
+		return nil, "", errors.Wrap(err)
+	}
+
+	if err = out.Close(); err != nil {
+		return nil, "", errors.Wrap(err)
+	}
+
+	desc := &Descriptor{MediaType: MediaTypeLayer, Digest: digest(compressed), Size: counter.size}
+	if err = os.Rename(tmpFile, blobPath(dir, desc.Digest)); err != nil {
+		return nil, "", errors.Wrap(err)
+	}
+
+	return desc, digest(diffID), nil
+}
+
+// countWriter counts the bytes written to it
+type countWriter struct {
+	size int64
+}
+
+func (cw *countWriter) Write(p []byte) (int, error) {
+	cw.size += int64(len(p))
+	return len(p), nil
+}
+
+// writeJSONBlob writes the JSON encoding of value to the layout at dir, its
+// descriptor of mediaType is returned
+func writeJSONBlob(dir string, mediaType string, value interface{}) (*Descriptor, error) {
+	content, err := json.Marshal(value)
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+
+	h := sha256.New()
+	_, _ = h.Write(content)
+
+	desc := &Descriptor{MediaType: mediaType, Digest: digest(h), Size: int64(len(content))}
+	if err = ioutil.WriteFile(blobPath(dir, desc.Digest), content, 0644); err != nil {
+		return nil, errors.Wrap(err)
+	}
+
+	return desc, nil
+}
+
+// loadIndex reads the index of the layout at dir, an empty index is returned
+// for a new layout
+func loadIndex(dir string) (*Index, error) {
+	index := &Index{SchemaVersion: 2, Manifests: []*Descriptor{}}
+
+	content, err := ioutil.ReadFile(filepath.Join(dir, "index.json"))
+	if os.IsNotExist(err) {
+		return index, nil
+	} else if err != nil {
+		return nil, errors.Wrap(err)
+	}
+
+	if err = json.Unmarshal(content, index); err != nil {
+		return nil, errors.Errorf("Invalid image layout index %s: %v", dir, err)
+	}
+
+	return index, nil
+}
+
+// WriteLayout adds the single layer image of the root file system tarball
+// layer to the OCI image layout at dir, tagged tag; an image of the same tag
+// is replaced, the other images of the layout are kept
+func WriteLayout(dir string, layer string, tag string) error {
+	if err := ValidateTag(tag); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Join(dir, blobsDir), 0755); err != nil {
+		return errors.Wrap(err)
+	}
+
+	index, err := loadIndex(dir)
+	if err != nil {
+		return err
+	}
+
+	layerDesc, diffID, err := writeLayer(dir, layer)
+	if err != nil {
+		return err
+	}
+
+	config := &imageConfig{
+		Created:      time.Now().UTC().Format(time.RFC3339),
+		Architecture: runtime.GOARCH,
+		OS:           "linux",
+	}
+	config.Config.Env = defaultEnv
+	config.Config.Cmd = defaultCmd
+	config.RootFS.Type = "layers"
+	config.RootFS.DiffIDs = []string{diffID}
+
+	configDesc, err := writeJSONBlob(dir, MediaTypeConfig, config)
+	if err != nil {
+		return err
+	}
+
+	manifestDesc, err := writeJSONBlob(dir, MediaTypeManifest, &manifest{
+		SchemaVersion: 2,
+		MediaType:     MediaTypeManifest,
+		Config:        configDesc,
+		Layers:        []*Descriptor{layerDesc},
+	})
+	if err != nil {
+		return err
+	}
+	manifestDesc.Annotations = map[string]string{RefNameAnnotation: tag}
+
+	manifests := []*Descriptor{}
+	for _, curr := range index.Manifests {
+		if curr.Annotations[RefNameAnnotation] != tag {
+			manifests = append(manifests, curr)
+		}
+	}
+	index.Manifests = append(manifests, manifestDesc)
+
+	content, err := json.Marshal(index)
+	if err != nil {
+		return errors.Wrap(err)
+	}
+
+	if err = ioutil.WriteFile(filepath.Join(dir, "index.json"), content, 0644); err != nil {
+		return errors.Wrap(err)
+	}
+
+	layout := []byte(`{"imageLayoutVersion":"` + layoutVersion + `"}`)
+	if err = ioutil.WriteFile(filepath.Join(dir, "oci-layout"), layout, 0644); err != nil {
+		return errors.Wrap(err)
+	}
+
+	return nil
+}
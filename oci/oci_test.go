@@ -0,0 +1,148 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package oci
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidateTag(t *testing.T) {
+	tests := []struct {
+		tag   string
+		valid bool
+	}{
+		{"latest", true},
+		{"31200", true},
+		{"v1.2_rc-3", true},
+		{"", false},
+		{".hidden", false},
+		{"with space", false},
+		{"repo:tag", false},
+	}
+
+	for i, curr := range tests {
+		err := ValidateTag(curr.tag)
+
+		if curr.valid && err != nil {
+			t.Fatalf("Test %d should pass: %v", i, err)
+		}
+
+		if !curr.valid && err == nil {
+			t.Fatalf("Test %d should fail", i)
+		}
+	}
+}
+
+func writeTestLayer(t *testing.T, file string) {
+	out, err := os.Create(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = out.Close() }()
+
+	content := []byte("NAME=\"Clear Linux OS\"\n")
+	tw := tar.NewWriter(out)
+	if err = tw.WriteHeader(&tar.Header{Name: "usr/lib/os-release", Mode: 0644,
+		Size: int64(len(content))}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = tw.Write(content); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readJSON(t *testing.T, file string, value interface{}) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = json.Unmarshal(content, value); err != nil {
+		t.Fatalf("Invalid JSON %s: %v", file, err)
+	}
+}
+
+func TestWriteLayout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "clr-installer-oci-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	layer := filepath.Join(dir, "rootfs.tar")
+	writeTestLayer(t, layer)
+	layout := filepath.Join(dir, "image")
+
+	if err = WriteLayout(layout, layer, "no:tag"); err == nil {
+		t.Fatal("An invalid tag should fail")
+	}
+
+	// the latest image is replaced, the tagged one kept
+	for _, tag := range []string{DefaultTag, "31200", DefaultTag} {
+		if err = WriteLayout(layout, layer, tag); err != nil {
+			t.Fatalf("Failed to write the image layout: %v", err)
+		}
+	}
+
+	index := &Index{}
+	readJSON(t, filepath.Join(layout, "index.json"), index)
+
+	if len(index.Manifests) != 2 {
+		t.Fatalf("Expected 2 images, got: %d", len(index.Manifests))
+	}
+
+	desc := index.Manifests[1]
+	if desc.Annotations[RefNameAnnotation] != DefaultTag {
+		t.Fatalf("Expected the %s image last, got: %v", DefaultTag, desc.Annotations)
+	}
+
+	m := &manifest{}
+	readJSON(t, blobPath(layout, desc.Digest), m)
+
+	if len(m.Layers) != 1 || m.Layers[0].MediaType != MediaTypeLayer {
+		t.Fatalf("Expected a single compressed layer, got: %v", m.Layers)
+	}
+
+	config := &imageConfig{}
+	readJSON(t, blobPath(layout, m.Config.Digest), config)
+
+	// the diff id is the digest of the uncompressed layer
+	in, err := os.Open(blobPath(layout, m.Layers[0].Digest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = in.Close() }()
+
+	gz, err := gzip.NewReader(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := sha256.New()
+	if _, err = io.Copy(h, gz); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(config.RootFS.DiffIDs) != 1 || config.RootFS.DiffIDs[0] != digest(h) {
+		t.Fatalf("Unexpected diff ids: %v", config.RootFS.DiffIDs)
+	}
+
+	if _, err = os.Stat(filepath.Join(layout, "oci-layout")); err != nil {
+		t.Fatalf("The oci-layout file is missing: %v", err)
+	}
+}
@@ -0,0 +1,176 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package power
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/godbus/dbus"
+
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/log"
+)
+
+const (
+	// LowBatteryPercentage is the battery charge below which the battery
+	// is considered too low to safely complete an install
+	LowBatteryPercentage = 30
+
+	upowerDest          = "org.freedesktop.UPower"
+	upowerPath          = "/org/freedesktop/UPower"
+	upowerDisplayDevice = "/org/freedesktop/UPower/devices/DisplayDevice"
+
+	logindDest = "org.freedesktop.login1"
+	logindPath = "/org/freedesktop/login1"
+
+	gnomeSessionDest = "org.gnome.SessionManager"
+	gnomeSessionPath = "/org/gnome/SessionManager"
+
+	// gnomeInhibitFlags inhibits the session suspend (4) and idle (8)
+	gnomeInhibitFlags = uint32(4 | 8)
+)
+
+// Battery is the system power supply state as reported by UPower
+type Battery struct {
+	OnBattery  bool
+	Present    bool
+	Percentage float64
+}
+
+// IsLow returns true if running on a battery charged below LowBatteryPercentage
+func (bt *Battery) IsLow() bool {
+	return bt.OnBattery && bt.Present && bt.Percentage < LowBatteryPercentage
+}
+
+// GetBattery queries UPower for the battery state
+func GetBattery() (*Battery, error) {
+	conn, err := dbus.SystemBus()
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+
+	result := &Battery{}
+
+	onBattery, err := conn.Object(upowerDest, upowerPath).GetProperty(upowerDest + ".OnBattery")
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+
+	if result.OnBattery, err = variantBool(onBattery); err != nil {
+		return nil, err
+	}
+
+	device := conn.Object(upowerDest, upowerDisplayDevice)
+
+	present, err := device.GetProperty(upowerDest + ".Device.IsPresent")
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+
+	if result.Present, err = variantBool(present); err != nil {
+		return nil, err
+	}
+
+	percentage, err := device.GetProperty(upowerDest + ".Device.Percentage")
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+
+	var ok bool
+	if result.Percentage, ok = percentage.Value().(float64); !ok {
+		return nil, errors.Errorf("Invalid UPower battery percentage: %s", percentage)
+	}
+
+	return result, nil
+}
+
+// BatteryWarning returns a warning message if the system is running on
+// battery, empty if it's on AC or the battery state is unknown
+func BatteryWarning() string {
+	bt, err := GetBattery()
+	if err != nil {
+		log.Debug("Could not get the battery state: %v", err)
+		return ""
+	}
+
+	if !bt.OnBattery {
+		return ""
+	}
+
+	if bt.IsLow() {
+		return fmt.Sprintf("Low battery (%.0f%%), connect the AC adapter before installing", bt.Percentage)
+	}
+
+	return fmt.Sprintf("Running on battery (%.0f%%), connecting the AC adapter is recommended", bt.Percentage)
+}
+
+// Inhibitor holds the locks preventing the system from suspending and the
+// session from locking the screen
+type Inhibitor struct {
+	fd      int
+	session *dbus.Conn
+	cookie  uint32
+}
+
+// Inhibit takes a systemd-logind sleep and idle inhibitor lock and, when a
+// GNOME session is reachable, a session suspend and idle inhibitor; failing
+// to take the GNOME inhibitor is not an error since the installer may run
+// outside of any user session
+func Inhibit(who string, why string) (*Inhibitor, error) {
+	conn, err := dbus.SystemBus()
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+
+	var fd dbus.UnixFD
+	err = conn.Object(logindDest, logindPath).Call(logindDest+".Manager.Inhibit", 0,
+		"sleep:idle:handle-lid-switch", who, why, "block").Store(&fd)
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+
+	result := &Inhibitor{fd: int(fd)}
+
+	if result.session, err = dbus.SessionBus(); err != nil {
+		log.Debug("No session bus, skipping the GNOME inhibitor: %v", err)
+		return result, nil
+	}
+
+	err = result.session.Object(gnomeSessionDest, gnomeSessionPath).Call(gnomeSessionDest+".Inhibit", 0,
+		who, uint32(0), why, gnomeInhibitFlags).Store(&result.cookie)
+	if err != nil {
+		log.Debug("Could not take the GNOME inhibitor: %v", err)
+		result.session = nil
+	}
+
+	return result, nil
+}
+
+// Release releases the inhibitor locks
+func (in *Inhibitor) Release() error {
+	if in.session != nil {
+		call := in.session.Object(gnomeSessionDest, gnomeSessionPath).Call(gnomeSessionDest+".Uninhibit", 0, in.cookie)
+		if call.Err != nil {
+			log.Debug("Could not release the GNOME inhibitor: %v", call.Err)
+		}
+	}
+
+	// logind releases its lock once the file descriptor is closed
+	if err := os.NewFile(uintptr(in.fd), "inhibitor").Close(); err != nil {
+		return errors.Wrap(err)
+	}
+
+	return nil
+}
+
+func variantBool(v dbus.Variant) (bool, error) {
+	value, ok := v.Value().(bool)
+	if !ok {
+		return false, errors.Errorf("Invalid UPower boolean property: %s", v)
+	}
+
+	return value, nil
+}
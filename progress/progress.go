@@ -133,3 +133,35 @@ func (prg *BaseProgress) Success() {
 func (prg *BaseProgress) Failure() {
 	impl.Failure()
 }
+
+// quiet is the Progress of the operations which must not report progress
+type quiet struct{}
+
+func (quiet) Partial(step int) {}
+func (quiet) Success()         {}
+func (quiet) Failure()         {}
+
+// Reporter creates the progress of an operation, a Quiet one reports nothing:
+// the operations running concurrently with the one reporting progress, i.e the
+// background install tasks, use it
+type Reporter struct {
+	Quiet bool
+}
+
+// NewLoop creates a new Loop based progress, see NewLoop
+func (rep Reporter) NewLoop(format string, a ...interface{}) Progress {
+	if rep.Quiet {
+		return quiet{}
+	}
+
+	return NewLoop(format, a...)
+}
+
+// MultiStep creates a new MultiStep progress, see MultiStep
+func (rep Reporter) MultiStep(total int, format string, a ...interface{}) Progress {
+	if rep.Quiet {
+		return quiet{}
+	}
+
+	return MultiStep(total, format, a...)
+}
@@ -0,0 +1,37 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package progress
+
+import (
+	"testing"
+)
+
+func TestReporterQuiet(t *testing.T) {
+	fc := &fakeClient{}
+	Set(fc)
+	defer Set(nil)
+
+	// the quiet progresses report nothing
+	rep := Reporter{Quiet: true}
+
+	prg := rep.NewLoop("loop %s", "quiet")
+	prg.Success()
+
+	prg = rep.MultiStep(2, "steps %s", "quiet")
+	prg.Partial(1)
+	prg.Failure()
+
+	if fc.recorded() != "" {
+		t.Fatalf("A quiet reporter should not report progress, got: %q", fc.recorded())
+	}
+
+	prg = Reporter{}.MultiStep(2, "steps %s", "reported")
+	prg.Partial(1)
+	prg.Success()
+
+	if expected := "desc steps reported, partial 1/2, success"; fc.recorded() != expected {
+		t.Fatalf("Expected %q, got: %q", expected, fc.recorded())
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package progress
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultUpdateInterval is the minimum interval between two frontend updates
+// of a Throttle client, coalescing the updates to ~10Hz
+const DefaultUpdateInterval = 100 * time.Millisecond
+
+// Throttle is a Client wrapper which coalesces high frequency Partial and Step
+// calls, Partial calls arriving too early are held and only the latest one is
+// delivered once the interval elapses; the final Partial, Desc, Success and
+// Failure calls are always delivered and flush any pending Partial first
+type Throttle struct {
+	client   Client
+	interval time.Duration
+	mutex    sync.Mutex
+	last     time.Time
+	pending  bool
+	total    int
+	step     int
+	timer    *time.Timer
+}
+
+// NewThrottle returns a Throttle client delivering at most one update to
+// client per interval
+func NewThrottle(client Client, interval time.Duration) *Throttle {
+	return &Throttle{client: client, interval: interval}
+}
+
+// Desc is part of the Client implementation
+func (th *Throttle) Desc(desc string) {
+	th.flush()
+	th.client.Desc(desc)
+}
+
+// Partial is part of the Client implementation, the updates are coalesced
+// except the final one (step == total) which is delivered immediately
+func (th *Throttle) Partial(total int, step int) {
+	th.mutex.Lock()
+	defer th.mutex.Unlock()
+
+	th.total = total
+	th.step = step
+	th.pending = true
+
+	wait := th.interval - time.Since(th.last)
+	if step >= total || wait <= 0 {
+		th.deliver()
+		return
+	}
+
+	if th.timer == nil {
+		th.timer = time.AfterFunc(wait, th.flush)
+	}
+}
+
+// Step is part of the Client implementation, steps are only visual feedback
+// therefore the ones arriving too early are dropped
+func (th *Throttle) Step() {
+	th.mutex.Lock()
+	defer th.mutex.Unlock()
+
+	if time.Since(th.last) < th.interval {
+		return
+	}
+
+	th.last = time.Now()
+	th.client.Step()
+}
+
+// Success is part of the Client implementation
+func (th *Throttle) Success() {
+	th.flush()
+	th.client.Success()
+}
+
+// Failure is part of the Client implementation
+func (th *Throttle) Failure() {
+	th.flush()
+	th.client.Failure()
+}
+
+// LoopWaitDuration is part of the Client implementation
+func (th *Throttle) LoopWaitDuration() time.Duration {
+	return th.client.LoopWaitDuration()
+}
+
+// flush delivers the pending Partial update, if any
+func (th *Throttle) flush() {
+	th.mutex.Lock()
+	defer th.mutex.Unlock()
+
+	if th.pending {
+		th.deliver()
+	}
+}
+
+// deliver sends the latest Partial update to the client, th.mutex must be held
+func (th *Throttle) deliver() {
+	if th.timer != nil {
+		th.timer.Stop()
+		th.timer = nil
+	}
+
+	th.pending = false
+	th.last = time.Now()
+	th.client.Partial(th.total, th.step)
+}
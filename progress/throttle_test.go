@@ -0,0 +1,135 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package progress
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClient records the calls delivered by a Throttle
+type fakeClient struct {
+	mutex sync.Mutex
+	calls []string
+}
+
+func (fc *fakeClient) record(format string, a ...interface{}) {
+	fc.mutex.Lock()
+	defer fc.mutex.Unlock()
+
+	fc.calls = append(fc.calls, fmt.Sprintf(format, a...))
+}
+
+func (fc *fakeClient) recorded() string {
+	fc.mutex.Lock()
+	defer fc.mutex.Unlock()
+
+	return strings.Join(fc.calls, ", ")
+}
+
+func (fc *fakeClient) Desc(desc string) {
+	fc.record("desc %s", desc)
+}
+
+func (fc *fakeClient) Partial(total int, step int) {
+	fc.record("partial %d/%d", step, total)
+}
+
+func (fc *fakeClient) Step() {
+	fc.record("step")
+}
+
+func (fc *fakeClient) Success() {
+	fc.record("success")
+}
+
+func (fc *fakeClient) Failure() {
+	fc.record("failure")
+}
+
+func (fc *fakeClient) LoopWaitDuration() time.Duration {
+	return time.Millisecond
+}
+
+func TestThrottleFinalPartial(t *testing.T) {
+	fc := &fakeClient{}
+	th := NewThrottle(fc, time.Hour)
+
+	// the first update is delivered, the next ones wait for the interval
+	// but the final one
+	th.Partial(10, 1)
+	th.Partial(10, 5)
+	th.Partial(10, 10)
+
+	if expected := "partial 1/10, partial 10/10"; fc.recorded() != expected {
+		t.Fatalf("Expected %q, got: %q", expected, fc.recorded())
+	}
+}
+
+func TestThrottleFlush(t *testing.T) {
+	tests := []struct {
+		name     string
+		call     func(th *Throttle)
+		expected string
+	}{
+		{"desc", func(th *Throttle) { th.Desc("next") }, "partial 1/10, partial 3/10, desc next"},
+		{"success", func(th *Throttle) { th.Success() }, "partial 1/10, partial 3/10, success"},
+		{"failure", func(th *Throttle) { th.Failure() }, "partial 1/10, partial 3/10, failure"},
+	}
+
+	for _, curr := range tests {
+		fc := &fakeClient{}
+		th := NewThrottle(fc, time.Hour)
+
+		th.Partial(10, 1)
+		th.Partial(10, 2)
+		th.Partial(10, 3)
+		curr.call(th)
+
+		if fc.recorded() != curr.expected {
+			t.Fatalf("%s: expected %q, got: %q", curr.name, curr.expected, fc.recorded())
+		}
+
+		// nothing is left to deliver
+		th.Success()
+		if expected := curr.expected + ", success"; fc.recorded() != expected {
+			t.Fatalf("%s: expected %q, got: %q", curr.name, expected, fc.recorded())
+		}
+	}
+}
+
+func TestThrottleCoalescing(t *testing.T) {
+	fc := &fakeClient{}
+	th := NewThrottle(fc, 50*time.Millisecond)
+
+	th.Partial(10, 1)
+	th.Partial(10, 2)
+	th.Partial(10, 3)
+	th.Partial(10, 4)
+
+	if expected := "partial 1/10"; fc.recorded() != expected {
+		t.Fatalf("The early updates should be held, expected %q, got: %q", expected, fc.recorded())
+	}
+
+	// the timer delivers the latest held update only
+	time.Sleep(200 * time.Millisecond)
+
+	if expected := "partial 1/10, partial 4/10"; fc.recorded() != expected {
+		t.Fatalf("Expected %q, got: %q", expected, fc.recorded())
+	}
+
+	// the steps arriving too early are dropped
+	th.Step()
+	th.Step()
+	time.Sleep(60 * time.Millisecond)
+	th.Step()
+
+	if expected := "partial 1/10, partial 4/10, step, step"; fc.recorded() != expected {
+		t.Fatalf("Expected %q, got: %q", expected, fc.recorded())
+	}
+}
@@ -0,0 +1,332 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package pwpolicy
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/clearlinux/clr-installer/cmd"
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/utils"
+)
+
+const (
+	// DefaultMinLength is the shortest password of the default policy
+	DefaultMinLength = 8
+
+	// MaxLength is the longest possible password
+	MaxLength = 255
+
+	// MaxClasses is the number of character classes: lower case, upper
+	// case, digits and the other characters
+	MaxClasses = 4
+
+	// crackLibCheck is the cracklib tool checking a password against its
+	// dictionary, it reads the passwords from its stdin
+	crackLibCheck = "cracklib-check"
+)
+
+// Rule is a password strength rule, Check returns the warning of a password
+// breaking the rule or an empty string
+type Rule interface {
+	Check(pwd string) string
+}
+
+// RuleFunc adapts a plain function to a Rule
+type RuleFunc func(pwd string) string
+
+// Check is part of the Rule interface implementation
+func (f RuleFunc) Check(pwd string) string {
+	return f(pwd)
+}
+
+// Policy is the password strength policy of the target users, the zero
+// value is the default policy
+type Policy struct {
+	// MinLength is the shortest accepted password, DefaultMinLength if 0
+	MinLength int `yaml:"minLength,omitempty"`
+
+	// MinClasses is the number of character classes the password must mix
+	MinClasses int `yaml:"minClasses,omitempty"`
+
+	// Dictionary rejects the passwords cracklib finds weak, i.e based on a
+	// dictionary word
+	Dictionary bool `yaml:"dictionary,omitempty"`
+
+	// BreachedList is an offline list of the breached passwords SHA-1, the
+	// "ordered by hash" download of Have I Been Pwned: HASH:COUNT lines
+	BreachedList string `yaml:"breachedList,omitempty"`
+
+	rules []Rule
+}
+
+// Validate checks the policy parameters, a policy can not be weaker than
+// the default one and its tools and lists must be available
+func (p *Policy) Validate() error {
+	if p.MinLength != 0 && (p.MinLength < DefaultMinLength || p.MinLength > MaxLength) {
+		return errors.ValidationErrorf("Invalid password minimum length %d, must be between %d and %d",
+			p.MinLength, DefaultMinLength, MaxLength)
+	}
+
+	if p.MinClasses < 0 || p.MinClasses > MaxClasses {
+		return errors.ValidationErrorf("Invalid password character classes %d, must be between 0 and %d",
+			p.MinClasses, MaxClasses)
+	}
+
+	if p.Dictionary {
+		if _, err := exec.LookPath(crackLibCheck); err != nil {
+			return errors.ValidationErrorf("The password dictionary check requires %s", crackLibCheck)
+		}
+	}
+
+	if p.BreachedList != "" {
+		if !filepath.IsAbs(p.BreachedList) {
+			return errors.ValidationErrorf("Invalid breached password list %q, must be an absolute path",
+				p.BreachedList)
+		}
+
+		if ok, _ := utils.FileExists(p.BreachedList); !ok {
+			return errors.ValidationErrorf("Breached password list %s not found", p.BreachedList)
+		}
+	}
+
+	return nil
+}
+
+// AddRule adds a rule checked after the ones of the policy parameters
+func (p *Policy) AddRule(rule Rule) {
+	p.rules = append(p.rules, rule)
+}
+
+// Rules returns the rules of the policy, in the order they're checked
+func (p *Policy) Rules() []Rule {
+	result := []Rule{RuleFunc(p.checkLength)}
+
+	if p.MinClasses > 0 {
+		result = append(result, RuleFunc(p.checkClasses))
+	}
+
+	if p.Dictionary {
+		result = append(result, RuleFunc(checkDictionary))
+	}
+
+	if p.BreachedList != "" {
+		result = append(result, RuleFunc(p.checkBreached))
+	}
+
+	return append(result, p.rules...)
+}
+
+// Check returns false and the warning of the first rule pwd breaks, p may
+// be nil for the default policy
+func (p *Policy) Check(pwd string) (bool, string) {
+	if p == nil {
+		p = &Policy{}
+	}
+
+	if pwd == "" {
+		return false, utils.Locale.Get("Password is required")
+	}
+
+	for _, curr := range p.Rules() {
+		if msg := curr.Check(pwd); msg != "" {
+			return false, msg
+		}
+	}
+
+	return true, ""
+}
+
+// Description returns the short description of the policy requirements, i.e
+// the rules of a password entry
+func (p *Policy) Description() string {
+	if p == nil {
+		p = &Policy{}
+	}
+
+	result := utils.Locale.Get("Min %d and Max %d characters.", p.minLength(), MaxLength)
+
+	if p.MinClasses > 1 {
+		result = result + " " + utils.Locale.Get("Mix %d of lower case, upper case, digits and symbols.",
+			p.MinClasses)
+	}
+
+	if p.Dictionary || p.BreachedList != "" {
+		result = result + " " + utils.Locale.Get("No common or breached passwords.")
+	}
+
+	return result
+}
+
+func (p *Policy) minLength() int {
+	if p.MinLength == 0 {
+		return DefaultMinLength
+	}
+
+	return p.MinLength
+}
+
+func (p *Policy) checkLength(pwd string) string {
+	if len(pwd) < p.minLength() {
+		return utils.Locale.Get("Password must be at least %d characters long", p.minLength())
+	}
+
+	if len(pwd) > MaxLength {
+		return utils.Locale.Get("Password may be at most %d characters long", MaxLength)
+	}
+
+	return ""
+}
+
+func (p *Policy) checkClasses(pwd string) string {
+	if classes(pwd) < p.MinClasses {
+		return utils.Locale.Get("Password must mix at least %d of lower case, upper case, digits and symbols",
+			p.MinClasses)
+	}
+
+	return ""
+}
+
+// classes returns the number of character classes pwd mixes
+func classes(pwd string) int {
+	var lower, upper, digit, other int
+
+	for _, r := range pwd {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			other = 1
+		}
+	}
+
+	return lower + upper + digit + other
+}
+
+// checkDictionary runs cracklib, it answers "PASSWORD: OK" for a strong
+// password; neither the password nor the answer are logged
+func checkDictionary(pwd string) string {
+	if strings.ContainsAny(pwd, "\r\n") {
+		return utils.Locale.Get("Password can not contain line breaks")
+	}
+
+	w := bytes.NewBuffer(nil)
+	if err := cmd.PipeRun(pwd+"\n", w, crackLibCheck); err != nil {
+		return utils.Locale.Get("Password dictionary check failed")
+	}
+
+	answer := strings.TrimSpace(strings.TrimPrefix(w.String(), pwd+": "))
+	if answer == "OK" {
+		return ""
+	}
+
+	return utils.Locale.Get("Password is too weak: %s", answer)
+}
+
+func (p *Policy) checkBreached(pwd string) string {
+	found, err := IsBreached(p.BreachedList, pwd)
+	if err != nil {
+		return utils.Locale.Get("Password breached list check failed")
+	}
+
+	if found {
+		return utils.Locale.Get("Password appears in a list of breached passwords")
+	}
+
+	return ""
+}
+
+// IsBreached returns true if pwd is in the breached passwords list file, the
+// list is ordered by hash so it's binary searched rather than read
+func IsBreached(file string, pwd string) (bool, error) {
+	sum := sha1.Sum([]byte(pwd))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	f, err := os.Open(file)
+	if err != nil {
+		return false, errors.Wrap(err)
+	}
+	defer func() { _ = f.Close() }()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return false, errors.Wrap(err)
+	}
+
+	// low is always the start of a line, the first line at or after high
+	// has a hash greater than hash
+	low, high := int64(0), fi.Size()
+	for high-low > 0 {
+		mid := low + (high-low)/2
+
+		start, next, line, err := lineAfter(f, mid, low)
+		if err != nil {
+			return false, err
+		}
+
+		if start >= high || line == "" {
+			high = mid
+			continue
+		}
+
+		curr := strings.ToUpper(strings.SplitN(line, ":", 2)[0])
+		switch {
+		case curr == hash:
+			return true, nil
+		case curr < hash:
+			low = next
+		default:
+			high = mid
+		}
+	}
+
+	return false, nil
+}
+
+// lineAfter returns the offset, the next line offset and the content of the
+// first line starting at or after offset, offset is a line start if it's low
+func lineAfter(f *os.File, offset int64, low int64) (int64, int64, string, error) {
+	if offset > low {
+		offset--
+	}
+
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return 0, 0, "", errors.Wrap(err)
+	}
+
+	rd := bufio.NewReader(f)
+	start := offset
+
+	if offset > low {
+		skipped, err := rd.ReadString('\n')
+		if err == io.EOF {
+			end := offset + int64(len(skipped))
+			return end, end, "", nil
+		} else if err != nil {
+			return 0, 0, "", errors.Wrap(err)
+		}
+		start += int64(len(skipped))
+	}
+
+	line, err := rd.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return 0, 0, "", errors.Wrap(err)
+	}
+
+	return start, start + int64(len(line)), strings.TrimRight(line, "\r\n"), nil
+}
@@ -0,0 +1,148 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package pwpolicy
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/clearlinux/clr-installer/utils"
+)
+
+func init() {
+	utils.SetLocale("en_US.UTF-8")
+}
+
+func TestCheck(t *testing.T) {
+	policy := &Policy{MinLength: 10, MinClasses: 3}
+	policy.AddRule(RuleFunc(func(pwd string) string {
+		if strings.Contains(strings.ToLower(pwd), "clear") {
+			return "Password can not contain the OS name"
+		}
+		return ""
+	}))
+
+	tests := []struct {
+		pwd   string
+		valid bool
+	}{
+		{"", false},
+		{"Short1!", false},
+		{"alllowercase", false},
+		{"lower-and-digits-123", true},
+		{"MixedCase123", true},
+		{"ClearLinux123", false},
+	}
+
+	for _, curr := range tests {
+		ok, msg := policy.Check(curr.pwd)
+
+		if curr.valid && !ok {
+			t.Fatalf("Password %q should pass: %s", curr.pwd, msg)
+		}
+
+		if !curr.valid && (ok || msg == "") {
+			t.Fatalf("Password %q should fail with a warning", curr.pwd)
+		}
+	}
+
+	var defaultPolicy *Policy
+	if ok, msg := defaultPolicy.Check("password"); !ok {
+		t.Fatalf("The default policy should only check the length: %s", msg)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		policy *Policy
+		valid  bool
+	}{
+		{&Policy{}, true},
+		{&Policy{MinLength: 12, MinClasses: 4}, true},
+		{&Policy{MinLength: 6}, false},
+		{&Policy{MinLength: MaxLength + 1}, false},
+		{&Policy{MinClasses: 5}, false},
+		{&Policy{BreachedList: "pwned.txt"}, false},
+		{&Policy{BreachedList: "/nonexistent/pwned.txt"}, false},
+	}
+
+	for i, curr := range tests {
+		err := curr.policy.Validate()
+
+		if curr.valid && err != nil {
+			t.Fatalf("Test %d should pass: %v", i, err)
+		}
+
+		if !curr.valid && err == nil {
+			t.Fatalf("Test %d should fail", i)
+		}
+	}
+}
+
+func TestIsBreached(t *testing.T) {
+	dir, err := ioutil.TempDir("", "clr-installer-pwpolicy-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	breached := []string{"password", "123456", "qwerty", "letmein", "dragon", "monkey", "iloveyou"}
+	lines := []string{}
+	for i, curr := range breached {
+		sum := sha1.Sum([]byte(curr))
+		lines = append(lines, fmt.Sprintf("%s:%d", strings.ToUpper(hex.EncodeToString(sum[:])), i+1))
+	}
+	sort.Strings(lines)
+
+	// the lists are published with CRLF line endings
+	file := filepath.Join(dir, "pwned.txt")
+	if err = ioutil.WriteFile(file, []byte(strings.Join(lines, "\r\n")+"\r\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, curr := range breached {
+		if found, err := IsBreached(file, curr); err != nil || !found {
+			t.Fatalf("Password %q should be found: %v", curr, err)
+		}
+	}
+
+	for _, curr := range []string{"correct horse battery staple", "Tr0ub4dor&3", ""} {
+		if found, err := IsBreached(file, curr); err != nil || found {
+			t.Fatalf("Password %q should not be found: %v", curr, err)
+		}
+	}
+
+	policy := &Policy{BreachedList: file}
+	if err = policy.Validate(); err != nil {
+		t.Fatalf("Should have validated the breached list: %v", err)
+	}
+
+	if ok, _ := policy.Check("iloveyou"); ok {
+		t.Fatal("A breached password should fail")
+	}
+}
+
+func TestDictionary(t *testing.T) {
+	if _, err := exec.LookPath(crackLibCheck); err != nil {
+		t.Skip(crackLibCheck + " not available")
+	}
+
+	policy := &Policy{Dictionary: true}
+	if ok, _ := policy.Check("password"); ok {
+		t.Fatal("A dictionary word should fail")
+	}
+
+	if ok, msg := policy.Check("v8#Kq2!zLm"); !ok {
+		t.Fatalf("A random password should pass: %s", msg)
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package qrcode
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/clearlinux/clr-installer/cmd"
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/log"
+)
+
+const (
+	// IssuesURL is where the install failures are reported
+	IssuesURL = "https://github.com/clearlinux/clr-installer/issues"
+
+	// maxErrorLen limits the error in the payload so the code stays readable
+	// by a phone camera from a screen
+	maxErrorLen = 160
+
+	// pngModuleSize is the size in pixels of a PNG code module
+	pngModuleSize = "6"
+)
+
+// FailurePayload returns the text encoded in the failure QR code: the error,
+// the log location and where to report it
+func FailurePayload(err error) string {
+	text := "unknown error"
+	if err != nil {
+		text = strings.Split(err.Error(), "\n")[0]
+	}
+
+	if len(text) > maxErrorLen {
+		text = text[:maxErrorLen] + "..."
+	}
+
+	return fmt.Sprintf("Clear Linux* OS install failed: %s\nLog: %s\nReport: %s",
+		text, log.GetLogFileName(), IssuesURL)
+}
+
+// Text returns payload encoded as a QR code drawn with unicode blocks, for
+// the terminal frontends
+func Text(payload string) (string, error) {
+	w := bytes.NewBuffer(nil)
+
+	if err := cmd.Run(w, "qrencode", "-t", "UTF8", "-m", "1", payload); err != nil {
+		return "", errors.Errorf("Could not generate the QR code: %v", err)
+	}
+
+	return strings.TrimRight(w.String(), "\n"), nil
+}
+
+// WritePNG writes payload encoded as a QR code image to file
+func WritePNG(payload string, file string) error {
+	if err := cmd.RunAndLog("qrencode", "-t", "PNG", "-s", pngModuleSize, "-o", file, payload); err != nil {
+		return errors.Errorf("Could not generate the QR code: %v", err)
+	}
+
+	return nil
+}
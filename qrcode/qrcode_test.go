@@ -0,0 +1,33 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package qrcode
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/clearlinux/clr-installer/errors"
+)
+
+func TestFailurePayload(t *testing.T) {
+	payload := FailurePayload(errors.Errorf("swupd failed\ndetails"))
+
+	if !strings.Contains(payload, "swupd failed") || strings.Contains(payload, "details") {
+		t.Fatalf("Only the first error line should be encoded, got: %q", payload)
+	}
+
+	if !strings.Contains(payload, IssuesURL) {
+		t.Fatalf("The payload should tell where to report the failure, got: %q", payload)
+	}
+
+	payload = FailurePayload(errors.Errorf(strings.Repeat("q", maxErrorLen*2)))
+	if strings.Count(payload, "q") != maxErrorLen {
+		t.Fatalf("The error should be truncated to %d characters", maxErrorLen)
+	}
+
+	if !strings.Contains(FailurePayload(nil), "unknown error") {
+		t.Fatal("A nil error should still produce a payload")
+	}
+}
@@ -0,0 +1,277 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package remote
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/mattn/go-runewidth"
+	"github.com/nsf/termbox-go"
+
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/log"
+)
+
+// historyLines is how many of the last install tasks the mirror displays
+const historyLines = 6
+
+// Mirror is the state of the running install as displayed by an attached
+// client, it's updated with the session events
+type Mirror struct {
+	Mode    string
+	Pages   []string
+	Page    string
+	Prompt  *Event
+	History []*Event
+	cursor  int
+}
+
+// NewMirror returns an empty mirror, the session fills it once attached
+func NewMirror() *Mirror {
+	return &Mirror{Mode: ModeReadOnly}
+}
+
+// Update applies a session event to the mirror
+func (mirror *Mirror) Update(ev *Event) {
+	switch ev.Kind {
+	case EventHello:
+		mirror.Mode = ev.Text
+	case EventPages:
+		mirror.Pages = ev.Choices
+		if mirror.cursor >= len(mirror.Pages) {
+			mirror.cursor = 0
+		}
+	case EventPage:
+		mirror.Page = ev.Text
+		if idx := indexOf(mirror.Pages, ev.Text); idx >= 0 {
+			mirror.cursor = idx
+		}
+	case EventPrompt:
+		mirror.Prompt = ev
+	case EventPromptDone:
+		mirror.Prompt = nil
+	case EventProgress, EventSuccess, EventFailure:
+		// a task finishing replaces its progress line
+		last := len(mirror.History) - 1
+		if ev.Kind != EventProgress && last >= 0 &&
+			mirror.History[last].Kind == EventProgress && mirror.History[last].Text == ev.Text {
+			mirror.History[last] = ev
+		} else {
+			mirror.History = append(mirror.History, ev)
+		}
+
+		if len(mirror.History) > historyLines {
+			mirror.History = mirror.History[len(mirror.History)-historyLines:]
+		}
+	}
+}
+
+// Move moves the page cursor by delta
+func (mirror *Mirror) Move(delta int) {
+	if len(mirror.Pages) == 0 {
+		return
+	}
+
+	mirror.cursor = (mirror.cursor + delta + len(mirror.Pages)) % len(mirror.Pages)
+}
+
+// Select returns the command switching the local frontend to the page under
+// the cursor, nil if the session is read-only
+func (mirror *Mirror) Select() *Command {
+	if mirror.Mode != ModeReadWrite || len(mirror.Pages) == 0 {
+		return nil
+	}
+
+	return &Command{Kind: CommandGoto, Text: mirror.Pages[mirror.cursor]}
+}
+
+// Answer returns the command answering the current question with its choice
+// at idx, nil if the session is read-only or there's no such choice
+func (mirror *Mirror) Answer(idx int) *Command {
+	if mirror.Mode != ModeReadWrite || mirror.Prompt == nil ||
+		idx < 0 || idx >= len(mirror.Prompt.Choices) {
+		return nil
+	}
+
+	return &Command{Kind: CommandAnswer, Text: mirror.Prompt.Choices[idx]}
+}
+
+// Lines renders the mirror as the lines of a width x height screen
+func (mirror *Mirror) Lines(width int, height int) []string {
+	lines := []string{
+		fmt.Sprintf("Clear Linux* OS Installer - remote session (%s)", mirror.modeName()),
+		"",
+		"Page: " + mirror.Page,
+		"",
+	}
+
+	// the question is displayed first so it fits small screens
+	if mirror.Prompt != nil {
+		lines = append(lines, strings.Split(mirror.Prompt.Text, "\n")...)
+		choices := []string{}
+		for idx, choice := range mirror.Prompt.Choices {
+			choices = append(choices, fmt.Sprintf("%d) %s", idx+1, choice))
+		}
+		lines = append(lines, strings.Join(choices, "   "), "")
+	}
+
+	for idx, page := range mirror.Pages {
+		marker := "  "
+		if idx == mirror.cursor {
+			marker = "> "
+		}
+		if page == mirror.Page {
+			page = page + " *"
+		}
+		lines = append(lines, marker+page)
+	}
+
+	if len(mirror.History) > 0 {
+		lines = append(lines, "")
+		for _, ev := range mirror.History {
+			lines = append(lines, ev.String())
+		}
+	}
+
+	help := "[q] detach"
+	if mirror.Mode == ModeReadWrite {
+		help = "[Up/Down] select a page  [Enter] switch to it  [1-9] answer  " + help
+	}
+
+	// the help line always stays at the bottom of the screen
+	for len(lines) < height-1 {
+		lines = append(lines, "")
+	}
+	if height > 0 {
+		lines = append(lines[:height-1], help)
+	}
+
+	for idx, line := range lines {
+		lines[idx] = runewidth.Truncate(line, width, "")
+	}
+
+	return lines
+}
+
+func (mirror *Mirror) modeName() string {
+	if mirror.Mode == ModeReadWrite {
+		return "read-write"
+	}
+
+	return "read-only"
+}
+
+// readEvents decodes the session events of conn until it's closed
+func readEvents(conn net.Conn, events chan<- *Event) {
+	defer close(events)
+
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		ev := &Event{}
+		if err := json.Unmarshal(scanner.Bytes(), ev); err != nil {
+			log.Warning("Ignoring invalid remote event: %v", err)
+			continue
+		}
+
+		events <- ev
+	}
+}
+
+func sendCommand(conn net.Conn, cmd *Command) error {
+	data, err := json.Marshal(cmd)
+	if err != nil {
+		return errors.Wrap(err)
+	}
+
+	if _, err = conn.Write(append(data, '\n')); err != nil {
+		return errors.Wrap(err)
+	}
+
+	return nil
+}
+
+func drawMirror(mirror *Mirror) {
+	width, height := termbox.Size()
+	_ = termbox.Clear(termbox.ColorDefault, termbox.ColorDefault)
+
+	for y, line := range mirror.Lines(width, height) {
+		x := 0
+		for _, ch := range line {
+			termbox.SetCell(x, y, ch, termbox.ColorDefault, termbox.ColorDefault)
+			x += runewidth.RuneWidth(ch)
+		}
+	}
+
+	_ = termbox.Flush()
+}
+
+// Attach connects to the session of a running install on file and mirrors it
+// on the terminal until the install exits or the user detaches
+func Attach(file string) error {
+	conn, err := net.Dial("unix", file)
+	if err != nil {
+		return errors.Errorf("No running install to attach to: %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	if err = termbox.Init(); err != nil {
+		return errors.Wrap(err)
+	}
+	defer termbox.Close()
+
+	events := make(chan *Event)
+	go readEvents(conn, events)
+
+	keys := make(chan termbox.Event)
+	go func() {
+		for {
+			keys <- termbox.PollEvent()
+		}
+	}()
+
+	mirror := NewMirror()
+	drawMirror(mirror)
+
+	for {
+		var cmd *Command
+
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				return nil
+			}
+			mirror.Update(ev)
+		case key := <-keys:
+			if key.Type != termbox.EventKey {
+				break
+			}
+
+			switch {
+			case key.Ch == 'q' || key.Key == termbox.KeyEsc || key.Key == termbox.KeyCtrlC:
+				return nil
+			case key.Key == termbox.KeyArrowUp:
+				mirror.Move(-1)
+			case key.Key == termbox.KeyArrowDown:
+				mirror.Move(1)
+			case key.Key == termbox.KeyEnter:
+				cmd = mirror.Select()
+			case key.Ch >= '1' && key.Ch <= '9':
+				cmd = mirror.Answer(int(key.Ch - '1'))
+			}
+		}
+
+		if cmd != nil {
+			if err = sendCommand(conn, cmd); err != nil {
+				return err
+			}
+		}
+
+		drawMirror(mirror)
+	}
+}
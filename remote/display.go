@@ -0,0 +1,228 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package remote
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/log"
+	"github.com/clearlinux/clr-installer/utils"
+)
+
+const (
+	// DisplayNumber is the X display the VNC server provides to the GUI
+	DisplayNumber = 1
+
+	// DisplayStartTimeout is how long we wait for the VNC server to accept
+	// X clients
+	DisplayStartTimeout = 10 * time.Second
+
+	// displayGeometry is the VNC server screen size
+	displayGeometry = "1280x800"
+
+	// displayPasswordBytes is the amount of random bytes of a display
+	// password, the VNC authentication only uses its first 8 characters
+	displayPasswordBytes = 5
+)
+
+var (
+	displayPasswordFile = "/run/clr-installer/vnc.passwd"
+	displaySocketDir    = "/tmp/.X11-unix"
+	consoleFile         = "/dev/console"
+)
+
+// Display is a VNC server the GUI runs on, for machines with no attached
+// display
+type Display struct {
+	server   *exec.Cmd
+	Password string
+	Port     int
+}
+
+// StartDisplay starts a VNC server protected by a random password and makes
+// it the X display of the GUI, the password is printed on the console so it
+// reaches the serial line of a headless server. It's valid until the display
+// is closed, the clients may reconnect.
+func StartDisplay() (*Display, error) {
+	password, err := generateDisplayPassword()
+	if err != nil {
+		return nil, err
+	}
+
+	if err = removeStaleDisplay(); err != nil {
+		return nil, err
+	}
+
+	if err = writeDisplayPassword(password); err != nil {
+		return nil, err
+	}
+
+	display := fmt.Sprintf(":%d", DisplayNumber)
+	dp := &Display{
+		Password: password,
+		Port:     5900 + DisplayNumber,
+	}
+
+	dp.server = exec.Command("Xvnc", display,
+		"-rfbport", fmt.Sprintf("%d", dp.Port),
+		"-SecurityTypes", "VncAuth",
+		"-PasswordFile", displayPasswordFile,
+		"-geometry", displayGeometry,
+		"-AlwaysShared=0",
+		"-nolisten", "tcp")
+
+	log.Debug("%s", strings.Join(dp.server.Args, " "))
+
+	if err = dp.server.Start(); err != nil {
+		_ = os.Remove(displayPasswordFile)
+		return nil, errors.Wrap(err)
+	}
+
+	if err = waitDisplay(DisplayStartTimeout); err != nil {
+		_ = dp.Close()
+		return nil, err
+	}
+
+	if err = os.Setenv("DISPLAY", display); err != nil {
+		_ = dp.Close()
+		return nil, errors.Wrap(err)
+	}
+
+	dp.announce()
+	log.Info("GUI available over VNC on port %d", dp.Port)
+
+	return dp, nil
+}
+
+// Close stops the VNC server and removes its password
+func (dp *Display) Close() error {
+	_ = os.Remove(displayPasswordFile)
+
+	if dp.server.Process == nil {
+		return nil
+	}
+
+	if err := dp.server.Process.Kill(); err != nil {
+		return errors.Wrap(err)
+	}
+
+	_ = dp.server.Wait()
+	return nil
+}
+
+// announce prints how to connect to the display on the standard output and,
+// for the serial console, on the system console
+func (dp *Display) announce() {
+	msg := fmt.Sprintf("\nThe installer is available over VNC on port %d\n"+
+		"Password, valid until the installer exits: %s\n\n", dp.Port, dp.Password)
+
+	fmt.Print(msg)
+
+	console, err := os.OpenFile(consoleFile, os.O_WRONLY, 0)
+	if err != nil {
+		return
+	}
+	defer func() { _ = console.Close() }()
+
+	_, _ = console.WriteString(msg)
+}
+
+// generateDisplayPassword returns a random password made of characters easy
+// to read from a console and type back
+func generateDisplayPassword() (string, error) {
+	buf := make([]byte, displayPasswordBytes)
+
+	if _, err := rand.Read(buf); err != nil {
+		return "", errors.Wrap(err)
+	}
+
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(buf), nil
+}
+
+// writeDisplayPassword stores password in the VNC server's obfuscated format,
+// readable by root only
+func writeDisplayPassword(password string) error {
+	cmd := exec.Command("vncpasswd", "-f")
+	cmd.Stdin = strings.NewReader(password + "\n")
+
+	out, err := cmd.Output()
+	if err != nil {
+		return errors.Errorf("Could not generate the VNC password: %v", err)
+	}
+
+	if err = utils.MkdirAll(filepath.Dir(displayPasswordFile), 0700); err != nil {
+		return err
+	}
+
+	if err = ioutil.WriteFile(displayPasswordFile, out, 0600); err != nil {
+		return errors.Wrap(err)
+	}
+
+	return nil
+}
+
+func displaySocket() string {
+	return filepath.Join(displaySocketDir, fmt.Sprintf("X%d", DisplayNumber))
+}
+
+// acceptsClients returns true if an X server accepts the clients on socket
+func acceptsClients(socket string) bool {
+	conn, err := net.DialTimeout("unix", socket, time.Second)
+	if err != nil {
+		return false
+	}
+
+	_ = conn.Close()
+	return true
+}
+
+// removeStaleDisplay removes the X socket left behind by a previous X server
+// of the display, it fails if a running one still owns the display
+func removeStaleDisplay() error {
+	socket := displaySocket()
+
+	if _, err := os.Lstat(socket); os.IsNotExist(err) {
+		return nil
+	}
+
+	if acceptsClients(socket) {
+		return errors.Errorf("The display :%d is already used by another X server", DisplayNumber)
+	}
+
+	log.Debug("Removing the stale X socket %s", socket)
+	if err := os.Remove(socket); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err)
+	}
+
+	return nil
+}
+
+// waitDisplay waits for the VNC server to accept the X clients on its socket
+func waitDisplay(timeout time.Duration) error {
+	socket := displaySocket()
+	deadline := time.Now().Add(timeout)
+
+	for {
+		if acceptsClients(socket) {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return errors.Errorf("Timeout waiting for the VNC server display %s", socket)
+		}
+
+		time.Sleep(100 * time.Millisecond)
+	}
+}
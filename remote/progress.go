@@ -0,0 +1,57 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package remote
+
+import (
+	"time"
+
+	"github.com/clearlinux/clr-installer/progress"
+)
+
+// Progress is a progress.Client wrapper publishing the install tasks to the
+// remote session before delivering them to the local frontend
+type Progress struct {
+	client progress.Client
+	desc   string
+}
+
+// NewProgress returns a Progress client wrapping client
+func NewProgress(client progress.Client) *Progress {
+	return &Progress{client: client}
+}
+
+// Desc is part of the progress.Client implementation
+func (prg *Progress) Desc(desc string) {
+	prg.desc = desc
+	Publish(EventProgress, desc)
+	prg.client.Desc(desc)
+}
+
+// Partial is part of the progress.Client implementation
+func (prg *Progress) Partial(total int, step int) {
+	prg.client.Partial(total, step)
+}
+
+// Step is part of the progress.Client implementation
+func (prg *Progress) Step() {
+	prg.client.Step()
+}
+
+// Success is part of the progress.Client implementation
+func (prg *Progress) Success() {
+	Publish(EventSuccess, prg.desc)
+	prg.client.Success()
+}
+
+// Failure is part of the progress.Client implementation
+func (prg *Progress) Failure() {
+	Publish(EventFailure, prg.desc)
+	prg.client.Failure()
+}
+
+// LoopWaitDuration is part of the progress.Client implementation
+func (prg *Progress) LoopWaitDuration() time.Duration {
+	return prg.client.LoopWaitDuration()
+}
@@ -0,0 +1,435 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package remote
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/log"
+)
+
+const (
+	// SocketFile is where a running install accepts the remote session
+	// clients, root only so attaching requires a root SSH login
+	SocketFile = "/run/clr-installer/remote.sock"
+
+	// ModeReadOnly only mirrors the install to the attached clients
+	ModeReadOnly = "ro"
+
+	// ModeReadWrite also lets the attached clients switch the pages and
+	// answer the prompts of the local frontend
+	ModeReadWrite = "rw"
+
+	// EventHello is sent to a new client with the session mode
+	EventHello = "hello"
+
+	// EventPages is published with the menu pages a client may switch to
+	EventPages = "pages"
+
+	// EventPage is published when the local user enters a page
+	EventPage = "page"
+
+	// EventProgress is published when an install task starts
+	EventProgress = "progress"
+
+	// EventSuccess is published when an install task succeeds
+	EventSuccess = "success"
+
+	// EventFailure is published when an install task fails
+	EventFailure = "failure"
+
+	// EventPrompt is published when the local frontend asks a question
+	EventPrompt = "prompt"
+
+	// EventPromptDone is published once the question was answered
+	EventPromptDone = "prompt-done"
+
+	// CommandGoto asks the local frontend to switch to a menu page
+	CommandGoto = "goto"
+
+	// CommandAnswer answers the question asked by the local frontend
+	CommandAnswer = "answer"
+
+	// clientEvents is how many events a client may lag behind before it is
+	// dropped, a stalled client must never block the frontend
+	clientEvents = 64
+
+	// writeTimeout is how long writing an event to a client may take
+	writeTimeout = 5 * time.Second
+)
+
+// Modes are the supported remote session modes
+var Modes = []string{ModeReadOnly, ModeReadWrite}
+
+// Event is a change of the install state mirrored to the attached clients
+type Event struct {
+	Time    time.Time `json:"time"`
+	Kind    string    `json:"kind"`
+	Text    string    `json:"text"`
+	Choices []string  `json:"choices,omitempty"`
+}
+
+// Command is sent by a read-write client to drive the local frontend
+type Command struct {
+	Kind string `json:"kind"`
+	Text string `json:"text"`
+}
+
+// Session accepts the clients attaching to the running install and mirrors
+// the published events to them, the read-write clients may also switch the
+// pages and answer the prompts
+type Session struct {
+	listener net.Listener
+	mode     string
+	mutex    sync.Mutex
+	closed   bool
+	clients  map[net.Conn]chan *Event
+	pages    *Event
+	page     *Event
+	task     *Event
+	prompt   *Event
+	navigate func(page string)
+	answer   func(choice int)
+}
+
+var (
+	current      *Session
+	currentMutex sync.Mutex
+)
+
+func getCurrent() *Session {
+	currentMutex.Lock()
+	defer currentMutex.Unlock()
+
+	return current
+}
+
+func setCurrent(session *Session) {
+	currentMutex.Lock()
+	defer currentMutex.Unlock()
+
+	current = session
+}
+
+// String returns the event as displayed by the attached clients
+func (ev *Event) String() string {
+	text := ev.Text
+	if len(ev.Choices) > 0 {
+		text = fmt.Sprintf("%s [%s]", text, strings.Join(ev.Choices, ", "))
+	}
+
+	return fmt.Sprintf("[%s] %-8s %s", ev.Time.Format("15:04:05"), ev.Kind, text)
+}
+
+// Start listens for the remote session clients on file in the given mode,
+// the events published from now on are mirrored to them
+func Start(file string, mode string) (*Session, error) {
+	if mode != ModeReadOnly && mode != ModeReadWrite {
+		return nil, errors.Errorf("Invalid remote session mode %q, must be one of: %s",
+			mode, strings.Join(Modes, ", "))
+	}
+
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return nil, errors.Wrap(err)
+	}
+
+	// a previous installer run may have left its socket behind
+	_ = os.Remove(file)
+
+	listener, err := net.Listen("unix", file)
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+
+	if err = os.Chmod(file, 0600); err != nil {
+		_ = listener.Close()
+		return nil, errors.Wrap(err)
+	}
+
+	session := &Session{
+		listener: listener,
+		mode:     mode,
+		clients:  map[net.Conn]chan *Event{},
+	}
+
+	go session.accept()
+
+	setCurrent(session)
+	log.Info("Remote %s session listening on %s", mode, file)
+
+	return session, nil
+}
+
+// Close stops accepting clients and disconnects the attached ones
+func (session *Session) Close() error {
+	currentMutex.Lock()
+	if current == session {
+		current = nil
+	}
+	currentMutex.Unlock()
+
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+
+	session.closed = true
+	for conn := range session.clients {
+		session.drop(conn)
+	}
+
+	if err := session.listener.Close(); err != nil {
+		return errors.Wrap(err)
+	}
+
+	return nil
+}
+
+// Publish mirrors an event to the clients of the running session, if any
+func Publish(kind string, text string) {
+	if session := getCurrent(); session != nil {
+		session.publish(&Event{Time: time.Now(), Kind: kind, Text: text}, nil)
+	}
+}
+
+// Navigate mirrors the menu pages the read-write clients may switch to, fn
+// is called from the session goroutine with the page a client picked
+func Navigate(pages []string, fn func(page string)) {
+	session := getCurrent()
+	if session == nil {
+		return
+	}
+
+	session.publish(&Event{Time: time.Now(), Kind: EventPages, Choices: pages}, func() bool {
+		session.navigate = fn
+		return true
+	})
+}
+
+// Prompt mirrors a question of the local frontend and its choices, answer is
+// called from the session goroutine with the index of the choice a read-write
+// client picked. The returned function must be called once the question is
+// answered, either locally or remotely.
+func Prompt(question string, choices []string, answer func(choice int)) func() {
+	session := getCurrent()
+	if session == nil {
+		return func() {}
+	}
+
+	ev := &Event{Time: time.Now(), Kind: EventPrompt, Text: question, Choices: choices}
+	session.publish(ev, func() bool {
+		session.answer = answer
+		return true
+	})
+
+	return func() {
+		// a newer question may have replaced this one already
+		session.publish(&Event{Time: time.Now(), Kind: EventPromptDone, Text: question}, func() bool {
+			return session.prompt == ev
+		})
+	}
+}
+
+// publish updates the session state and queues ev to every client, update is
+// called first under the session lock and may cancel the event
+func (session *Session) publish(ev *Event, update func() bool) {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+
+	if update != nil && !update() {
+		return
+	}
+
+	switch ev.Kind {
+	case EventPages:
+		session.pages = ev
+	case EventPage:
+		session.page = ev
+	case EventProgress, EventSuccess, EventFailure:
+		session.task = ev
+	case EventPrompt:
+		session.prompt = ev
+	case EventPromptDone:
+		session.prompt = nil
+		session.answer = nil
+	}
+
+	for conn, events := range session.clients {
+		select {
+		case events <- ev:
+		default:
+			log.Warning("Remote session client dropped, it is not reading the events")
+			session.drop(conn)
+		}
+	}
+}
+
+// drop disconnects a client, the session lock must be held
+func (session *Session) drop(conn net.Conn) {
+	events, ok := session.clients[conn]
+	if !ok {
+		return
+	}
+
+	delete(session.clients, conn)
+	close(events)
+	_ = conn.Close()
+}
+
+func (session *Session) accept() {
+	for {
+		conn, err := session.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		log.Info("Remote session client attached")
+
+		events := make(chan *Event, clientEvents)
+
+		session.mutex.Lock()
+		if session.closed {
+			session.mutex.Unlock()
+			_ = conn.Close()
+			return
+		}
+
+		// bring the new client up to date with the current state
+		events <- &Event{Time: time.Now(), Kind: EventHello, Text: session.mode}
+		for _, ev := range []*Event{session.pages, session.page, session.task, session.prompt} {
+			if ev != nil {
+				events <- ev
+			}
+		}
+		session.clients[conn] = events
+		session.mutex.Unlock()
+
+		go write(conn, events)
+		go session.read(conn)
+	}
+}
+
+// write sends the queued events to a client until it is dropped, a client
+// not reading them is disconnected once the write deadline expires
+func write(conn net.Conn, events <-chan *Event) {
+	for ev := range events {
+		if err := conn.SetWriteDeadline(time.Now().Add(writeTimeout)); err != nil {
+			log.Warning("Remote session client dropped: %v", err)
+			_ = conn.Close()
+			return
+		}
+
+		if err := writeEvent(conn, ev); err != nil {
+			log.Warning("Remote session client dropped: %v", err)
+			_ = conn.Close()
+			return
+		}
+	}
+}
+
+// read runs the commands of a read-write client until it detaches, the
+// read-only clients' input is discarded
+func (session *Session) read(conn net.Conn) {
+	scanner := bufio.NewScanner(conn)
+
+	for scanner.Scan() {
+		if session.mode != ModeReadWrite {
+			continue
+		}
+
+		cmd := &Command{}
+		if err := json.Unmarshal(scanner.Bytes(), cmd); err != nil {
+			log.Warning("Ignoring invalid remote command: %v", err)
+			continue
+		}
+
+		if err := session.run(cmd); err != nil {
+			log.Warning("Ignoring remote command: %v", err)
+		}
+	}
+
+	session.mutex.Lock()
+	session.drop(conn)
+	session.mutex.Unlock()
+
+	log.Info("Remote session client detached")
+}
+
+// run hands a client command to the local frontend, the callbacks are called
+// without the session lock so they may publish
+func (session *Session) run(cmd *Command) error {
+	session.mutex.Lock()
+
+	switch cmd.Kind {
+	case CommandGoto:
+		// the local frontend is modal while asking a question
+		if session.prompt != nil {
+			session.mutex.Unlock()
+			return errors.Errorf("Answer %q before switching the page", session.prompt.Text)
+		}
+
+		if session.pages == nil || session.navigate == nil || indexOf(session.pages.Choices, cmd.Text) < 0 {
+			session.mutex.Unlock()
+			return errors.Errorf("Unknown page %q", cmd.Text)
+		}
+
+		navigate := session.navigate
+		session.mutex.Unlock()
+
+		log.Info("Remote session client switched to the page %q", cmd.Text)
+		navigate(cmd.Text)
+	case CommandAnswer:
+		choice := -1
+		if session.prompt != nil {
+			choice = indexOf(session.prompt.Choices, cmd.Text)
+		}
+
+		answer := session.answer
+		if choice < 0 || answer == nil {
+			session.mutex.Unlock()
+			return errors.Errorf("No question to answer with %q", cmd.Text)
+		}
+		session.mutex.Unlock()
+
+		log.Info("Remote session client answered %q", cmd.Text)
+		answer(choice)
+	default:
+		session.mutex.Unlock()
+		return errors.Errorf("Unknown command %q", cmd.Kind)
+	}
+
+	return nil
+}
+
+func indexOf(values []string, value string) int {
+	for idx, curr := range values {
+		if curr == value {
+			return idx
+		}
+	}
+
+	return -1
+}
+
+func writeEvent(w io.Writer, ev *Event) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return errors.Wrap(err)
+	}
+
+	if _, err = w.Write(append(data, '\n')); err != nil {
+		return errors.Wrap(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,375 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package remote
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func startTestSession(t *testing.T, mode string) (*Session, string, func()) {
+	dir, err := ioutil.TempDir("", "clr-installer-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file := filepath.Join(dir, "remote.sock")
+
+	session, err := Start(file, mode)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return session, file, func() {
+		_ = session.Close()
+		_ = os.RemoveAll(dir)
+	}
+}
+
+func waitClients(t *testing.T, session *Session, count int) {
+	for i := 0; i < 100; i++ {
+		session.mutex.Lock()
+		attached := len(session.clients)
+		session.mutex.Unlock()
+
+		if attached == count {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("Expected %d attached clients", count)
+}
+
+func readEvent(t *testing.T, reader *bufio.Reader) *Event {
+	line, err := reader.ReadBytes('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ev := &Event{}
+	if err = json.Unmarshal(line, ev); err != nil {
+		t.Fatal(err)
+	}
+
+	return ev
+}
+
+func writeCommand(t *testing.T, conn net.Conn, kind string, text string) {
+	if err := sendCommand(conn, &Command{Kind: kind, Text: text}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInvalidMode(t *testing.T) {
+	if _, err := Start("/tmp/invalid.sock", "rx"); err == nil {
+		t.Fatal("Should have failed with an invalid mode")
+	}
+}
+
+func TestReadOnlySession(t *testing.T) {
+	session, file, cleanup := startTestSession(t, ModeReadOnly)
+	defer cleanup()
+
+	navigated := make(chan string, 1)
+	Navigate([]string{"Timezone", "Keyboard"}, func(page string) {
+		navigated <- page
+	})
+	Publish(EventPage, "Timezone")
+
+	conn, err := net.Dial("unix", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	reader := bufio.NewReader(conn)
+
+	if ev := readEvent(t, reader); ev.Kind != EventHello || ev.Text != ModeReadOnly {
+		t.Fatalf("The new client should get the session mode, got: %+v", ev)
+	}
+
+	if ev := readEvent(t, reader); ev.Kind != EventPages || len(ev.Choices) != 2 {
+		t.Fatalf("The new client should get the menu pages, got: %+v", ev)
+	}
+
+	if ev := readEvent(t, reader); ev.Kind != EventPage || ev.Text != "Timezone" {
+		t.Fatalf("The new client should get the current page, got: %+v", ev)
+	}
+
+	// the session is read-only, the client commands are ignored
+	writeCommand(t, conn, CommandGoto, "Keyboard")
+
+	waitClients(t, session, 1)
+	Publish(EventPage, "Select Installation Media")
+
+	if ev := readEvent(t, reader); ev.Kind != EventPage || ev.Text != "Select Installation Media" {
+		t.Fatalf("Only the published events should be mirrored, got: %+v", ev)
+	}
+
+	prg := NewProgress(&fakeClient{})
+	prg.Desc("Installing base OS")
+	prg.Success()
+
+	for _, kind := range []string{EventProgress, EventSuccess} {
+		if ev := readEvent(t, reader); ev.Kind != kind || ev.Text != "Installing base OS" {
+			t.Fatalf("Expected the %s of the task, got: %+v", kind, ev)
+		}
+	}
+
+	select {
+	case page := <-navigated:
+		t.Fatalf("A read-only client should not switch the pages, got: %s", page)
+	default:
+	}
+}
+
+func TestReadWriteSession(t *testing.T) {
+	_, file, cleanup := startTestSession(t, ModeReadWrite)
+	defer cleanup()
+
+	navigated := make(chan string, 1)
+	Navigate([]string{"Timezone", "Keyboard"}, func(page string) {
+		navigated <- page
+	})
+
+	answered := make(chan int, 1)
+	done := Prompt("Continue?", []string{"No", "Yes"}, func(choice int) {
+		answered <- choice
+	})
+
+	conn, err := net.Dial("unix", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	reader := bufio.NewReader(conn)
+	for _, kind := range []string{EventHello, EventPages, EventPrompt} {
+		if ev := readEvent(t, reader); ev.Kind != kind {
+			t.Fatalf("Expected the %s event, got: %+v", kind, ev)
+		}
+	}
+
+	// unknown choices are ignored, and the pages can't be switched until
+	// the question is answered
+	writeCommand(t, conn, CommandAnswer, "Maybe")
+	writeCommand(t, conn, CommandGoto, "Keyboard")
+	writeCommand(t, conn, CommandAnswer, "Yes")
+
+	select {
+	case choice := <-answered:
+		if choice != 1 {
+			t.Fatalf("Wrong choice: %d", choice)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("The question should have been answered")
+	}
+
+	done()
+	if ev := readEvent(t, reader); ev.Kind != EventPromptDone {
+		t.Fatalf("Expected the question to be closed, got: %+v", ev)
+	}
+
+	// the question is closed, a late answer and unknown pages are ignored
+	writeCommand(t, conn, CommandAnswer, "No")
+	writeCommand(t, conn, CommandGoto, "Hostname")
+	writeCommand(t, conn, CommandGoto, "Keyboard")
+
+	select {
+	case page := <-navigated:
+		if page != "Keyboard" {
+			t.Fatalf("Wrong page: %q", page)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("The local frontend should have switched the page")
+	}
+
+	Publish(EventPage, "Keyboard")
+
+	if ev := readEvent(t, reader); ev.Kind != EventPage {
+		t.Fatalf("Expected the page event, got: %+v", ev)
+	}
+
+	select {
+	case choice := <-answered:
+		t.Fatalf("A closed question should not be answered, got: %d", choice)
+	default:
+	}
+}
+
+func TestStalledClient(t *testing.T) {
+	session, file, cleanup := startTestSession(t, ModeReadOnly)
+	defer cleanup()
+
+	// the client never reads, the frontend must not block on it
+	conn, err := net.Dial("unix", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	waitClients(t, session, 1)
+
+	published := make(chan bool)
+	go func() {
+		text := strings.Repeat("x", 4096)
+		for i := 0; i < 10*clientEvents; i++ {
+			Publish(EventProgress, text)
+		}
+		close(published)
+	}()
+
+	select {
+	case <-published:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Publishing should not block on a stalled client")
+	}
+
+	waitClients(t, session, 0)
+}
+
+func TestMirror(t *testing.T) {
+	mirror := NewMirror()
+	now := time.Now()
+
+	for _, ev := range []*Event{
+		{Time: now, Kind: EventHello, Text: ModeReadWrite},
+		{Time: now, Kind: EventPages, Choices: []string{"Timezone", "Keyboard", "Hostname"}},
+		{Time: now, Kind: EventPage, Text: "Keyboard"},
+		{Time: now, Kind: EventProgress, Text: "Installing base OS"},
+		{Time: now, Kind: EventSuccess, Text: "Installing base OS"},
+		{Time: now, Kind: EventPrompt, Text: "Continue?", Choices: []string{"No", "Yes"}},
+	} {
+		mirror.Update(ev)
+	}
+
+	if len(mirror.History) != 1 || mirror.History[0].Kind != EventSuccess {
+		t.Fatalf("The task success should replace its progress, got: %+v", mirror.History)
+	}
+
+	mirror.Move(1)
+	if cmd := mirror.Select(); cmd == nil || cmd.Kind != CommandGoto || cmd.Text != "Hostname" {
+		t.Fatalf("Expected to switch to the page under the cursor, got: %+v", cmd)
+	}
+
+	if cmd := mirror.Answer(1); cmd == nil || cmd.Kind != CommandAnswer || cmd.Text != "Yes" {
+		t.Fatalf("Expected to answer Yes, got: %+v", cmd)
+	}
+
+	if cmd := mirror.Answer(2); cmd != nil {
+		t.Fatalf("There is no third choice, got: %+v", cmd)
+	}
+
+	lines := mirror.Lines(60, 20)
+	if len(lines) != 20 {
+		t.Fatalf("Expected the lines of the whole screen, got: %d", len(lines))
+	}
+
+	screen := strings.Join(lines, "\n")
+	for _, curr := range []string{"(read-write)", "Page: Keyboard", "> Hostname", "  Keyboard *", "1) No   2) Yes"} {
+		if !strings.Contains(screen, curr) {
+			t.Fatalf("Expected %q in:\n%s", curr, screen)
+		}
+	}
+
+	for _, line := range lines {
+		if len(line) > 60 {
+			t.Fatalf("The line should fit the screen: %q", line)
+		}
+	}
+
+	mirror.Update(&Event{Time: now, Kind: EventPromptDone})
+	mirror.Update(&Event{Time: now, Kind: EventHello, Text: ModeReadOnly})
+
+	if mirror.Select() != nil || mirror.Answer(0) != nil {
+		t.Fatal("A read-only mirror should not send commands")
+	}
+}
+
+type fakeClient struct{}
+
+func (fc *fakeClient) Desc(desc string)            {}
+func (fc *fakeClient) Partial(total int, step int) {}
+func (fc *fakeClient) Step()                       {}
+func (fc *fakeClient) Success()                    {}
+func (fc *fakeClient) Failure()                    {}
+func (fc *fakeClient) LoopWaitDuration() time.Duration {
+	return time.Second
+}
+
+func TestGenerateDisplayPassword(t *testing.T) {
+	first, err := generateDisplayPassword()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(first) != 8 {
+		t.Fatalf("The VNC authentication uses 8 characters, got %q", first)
+	}
+
+	second, err := generateDisplayPassword()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if first == second {
+		t.Fatal("The display password should be random")
+	}
+}
+
+func TestStaleDisplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "clr-installer-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	saved := displaySocketDir
+	displaySocketDir = dir
+	defer func() { displaySocketDir = saved }()
+
+	if err = removeStaleDisplay(); err != nil {
+		t.Fatalf("No socket should not fail: %v", err)
+	}
+
+	// the socket of a crashed X server is left behind
+	listener, err := net.Listen("unix", displaySocket())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = removeStaleDisplay(); err == nil {
+		t.Fatal("A running X server display should not be removed")
+	}
+
+	if err = waitDisplay(time.Second); err != nil {
+		t.Fatalf("The running X server should accept the clients: %v", err)
+	}
+
+	if ul, ok := listener.(*net.UnixListener); ok {
+		ul.SetUnlinkOnClose(false)
+	}
+	_ = listener.Close()
+
+	if err = waitDisplay(200 * time.Millisecond); err == nil {
+		t.Fatal("A stale socket should not be taken for the display")
+	}
+
+	if err = removeStaleDisplay(); err != nil {
+		t.Fatalf("The stale socket should be removed: %v", err)
+	}
+
+	if _, err = os.Lstat(displaySocket()); !os.IsNotExist(err) {
+		t.Fatalf("The stale socket should be removed, got: %v", err)
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package sanitize
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/clearlinux/clr-installer/errors"
+)
+
+const (
+	// MaxURLLength is the longest accepted URL, the common browser limit
+	MaxURLLength = 2048
+
+	// MaxBundleNameLength is the longest accepted bundle name
+	MaxBundleNameLength = 64
+)
+
+// IsAllowed returns false for the runes never accepted in a text field: the
+// control characters and the invisible format ones, i.e: the bidirectional
+// overrides or the zero width spaces
+func IsAllowed(r rune) bool {
+	return !unicode.IsControl(r) && !unicode.Is(unicode.Cf, r) && r != utf8.RuneError
+}
+
+// String returns value with the runes not allowed removed, the unicode
+// spaces turned into plain ones and the surrounding spaces trimmed
+func String(value string) string {
+	result := strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) && r != '\n' && r != '\r' && r != '\t' {
+			return ' '
+		}
+
+		if !IsAllowed(r) {
+			return -1
+		}
+
+		return r
+	}, value)
+
+	return strings.TrimSpace(result)
+}
+
+// Check returns a validation error naming the field name if value holds a
+// rune not allowed, is not valid UTF-8 or is longer than maxLen characters
+func Check(name string, value string, maxLen int) error {
+	if !utf8.ValidString(value) {
+		return errors.ValidationErrorf("Invalid %s: not valid UTF-8", name)
+	}
+
+	for _, r := range value {
+		if !IsAllowed(r) {
+			return errors.ValidationErrorf("Invalid %s: contains the control character %U", name, r)
+		}
+	}
+
+	if count := utf8.RuneCountInString(value); count > maxLen {
+		return errors.ValidationErrorf("Invalid %s: %d characters long, the maximum is %d",
+			name, count, maxLen)
+	}
+
+	return nil
+}
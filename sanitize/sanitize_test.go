@@ -0,0 +1,67 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package sanitize
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/clearlinux/clr-installer/errors"
+)
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected string
+	}{
+		{"clr-host", "clr-host"},
+		{"  clr-host\t", "clr-host"},
+		{"clr\x00-host\x1b", "clr-host"},
+		{"clr\u202e-host", "clr-host"},
+		{"clr\u200b-host", "clr-host"},
+		{"John\u00a0Doe", "John Doe"},
+		{"José Ñúñez", "José Ñúñez"},
+		{"\xff\xfeclr", "clr"},
+	}
+
+	for _, curr := range tests {
+		if result := String(curr.value); result != curr.expected {
+			t.Fatalf("String(%q) should be %q, got %q", curr.value, curr.expected, result)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	valid := []string{"", "os-core", "https://mirror.example.com/update", "José"}
+
+	for _, curr := range valid {
+		if err := Check("value", curr, MaxURLLength); err != nil {
+			t.Fatalf("%q should be valid: %v", curr, err)
+		}
+	}
+
+	invalid := []string{
+		"os-core\n",
+		"os\u202ecore",
+		"\xff",
+		strings.Repeat("a", MaxBundleNameLength+1),
+	}
+
+	for _, curr := range invalid {
+		err := Check("bundle", curr, MaxBundleNameLength)
+		if err == nil {
+			t.Fatalf("%q should be invalid", curr)
+		}
+
+		if !errors.IsValidationError(err) || !strings.Contains(err.Error(), "Invalid bundle") {
+			t.Fatalf("The error should name the field, got: %v", err)
+		}
+	}
+
+	// the length is counted in characters, not bytes
+	if err := Check("username", strings.Repeat("é", 10), 10); err != nil {
+		t.Fatalf("10 characters should be valid: %v", err)
+	}
+}
@@ -0,0 +1,270 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package storage
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/clearlinux/clr-installer/cmd"
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/log"
+)
+
+const (
+	// BtrfsRequiredBundle is the bundle with the btrfs tools
+	BtrfsRequiredBundle = "storage-utils"
+
+	// SubvolumeMountOption mounts a btrfs subvolume instead of the top level
+	SubvolumeMountOption = "subvol"
+
+	// snapperConfig is the snapper configuration of the root file system
+	snapperConfig = "root"
+)
+
+var (
+	// subvolumeNameExp matches a btrfs subvolume name of the top level
+	subvolumeNameExp = regexp.MustCompile(`^[A-Za-z0-9@._+-]+$`)
+
+	// snapperTimers are the systemd timers taking and cleaning up the
+	// automatic snapshots
+	snapperTimers = []string{"snapper-timeline.timer", "snapper-cleanup.timer"}
+)
+
+// Subvolume is a btrfs subvolume created in the top level of a partition
+type Subvolume struct {
+	Name       string `yaml:"name"`
+	MountPoint string `yaml:"mountpoint,omitempty"`
+}
+
+// DefaultSubvolumes returns the usual layout of a btrfs root: the @, @home
+// and @var subvolumes, the home and variable data are left out of the root
+// snapshots
+func DefaultSubvolumes() []*Subvolume {
+	return []*Subvolume{
+		{Name: "@", MountPoint: "/"},
+		{Name: "@home", MountPoint: "/home"},
+		{Name: "@var", MountPoint: "/var"},
+	}
+}
+
+// mainSubvolume returns the subvolume mounted to the mount point of the
+// partition bd, nil if bd has no subvolume
+func (bd *BlockDevice) mainSubvolume() *Subvolume {
+	for _, sv := range bd.Subvolumes {
+		if sv.MountPoint == bd.MountPoint {
+			return sv
+		}
+	}
+
+	return nil
+}
+
+// validateSubvolumes checks the subvolumes of the partition bd
+func (bd *BlockDevice) validateSubvolumes() error {
+	if len(bd.Subvolumes) == 0 {
+		return nil
+	}
+
+	if bd.FsType != "btrfs" {
+		return errors.Errorf("Partition %s: subvolumes require the btrfs file system", bd.Name)
+	}
+
+	if bd.MountPoint == "" || bd.mainSubvolume() == nil {
+		return errors.Errorf("Partition %s: a subvolume must be mounted to the partition mount point", bd.Name)
+	}
+
+	names := map[string]bool{}
+	mounts := map[string]bool{}
+
+	for _, sv := range bd.Subvolumes {
+		if !subvolumeNameExp.MatchString(sv.Name) {
+			return errors.Errorf("Partition %s: invalid subvolume name %q", bd.Name, sv.Name)
+		}
+
+		if names[sv.Name] {
+			return errors.Errorf("Partition %s: duplicated subvolume %s", bd.Name, sv.Name)
+		}
+		names[sv.Name] = true
+
+		if sv.MountPoint == "" {
+			continue
+		}
+
+		if msg := IsValidMount(sv.MountPoint); msg != "" {
+			return errors.Errorf("Partition %s: subvolume %s: %s", bd.Name, sv.Name, msg)
+		}
+
+		if mounts[sv.MountPoint] {
+			return errors.Errorf("Partition %s: mount point %s is set on more than one subvolume",
+				bd.Name, sv.MountPoint)
+		}
+		mounts[sv.MountPoint] = true
+	}
+
+	return nil
+}
+
+// subvolumeMountOptions returns the mount options of the subvolume sv of bd
+func (bd *BlockDevice) subvolumeMountOptions(sv *Subvolume) string {
+	options := SubvolumeMountOption + "=" + sv.Name
+
+	if mountOptions := bd.getMountOptions(); mountOptions != "" {
+		options = mountOptions + "," + options
+	}
+
+	return options
+}
+
+// createSubvolumes creates the subvolumes in the top level of the newly
+// formatted partition bd
+func (bd *BlockDevice) createSubvolumes() error {
+	if len(bd.Subvolumes) == 0 {
+		return nil
+	}
+
+	dir, err := ioutil.TempDir("", "clr-installer-btrfs-")
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	if err = syscall.Mount(bd.GetMappedDeviceFile(), dir, bd.FsType, 0, ""); err != nil {
+		return errors.Errorf("mount %s %s: %v", bd.GetMappedDeviceFile(), dir, err)
+	}
+
+	defer func() {
+		if err := syscall.Unmount(dir, 0); err != nil {
+			log.Warning("Failed to unmount %s: %v", dir, err)
+		}
+	}()
+
+	for _, sv := range bd.Subvolumes {
+		if err = bd.runAndLog("btrfs", "subvolume", "create", filepath.Join(dir, sv.Name)); err != nil {
+			return errors.Wrap(err)
+		}
+	}
+
+	return nil
+}
+
+// mountSubvolumes mounts the subvolumes of bd other than its main one, which
+// is mounted with the partition
+func (bd *BlockDevice) mountSubvolumes(root string) error {
+	main := bd.mainSubvolume()
+	subvolumes := []*Subvolume{}
+
+	for _, sv := range bd.Subvolumes {
+		if sv != main && sv.MountPoint != "" {
+			subvolumes = append(subvolumes, sv)
+		}
+	}
+
+	// the parent directories are mounted first
+	sort.Slice(subvolumes, func(i, j int) bool {
+		return subvolumes[i].MountPoint < subvolumes[j].MountPoint
+	})
+
+	for _, sv := range subvolumes {
+		if err := mountFs(bd.GetMappedDeviceFile(), filepath.Join(root, sv.MountPoint), bd.FsType,
+			syscall.MS_RELATIME, bd.subvolumeMountOptions(sv)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// subvolumeTabEntries returns the fstab entries of the subvolumes of bd
+// mounted from device; the root subvolume is mounted with the rootflags
+// kernel argument, it only needs an entry for its discard
+func (bd *BlockDevice) subvolumeTabEntries(device string) []string {
+	entries := []string{}
+
+	for _, sv := range bd.Subvolumes {
+		if sv.MountPoint == "" || (sv.MountPoint == "/" && !bd.Discard) {
+			continue
+		}
+
+		entries = append(entries, strings.Join([]string{device, sv.MountPoint, bd.FsType,
+			"defaults," + bd.subvolumeMountOptions(sv), "0", "0"}, " "))
+	}
+
+	return entries
+}
+
+// BtrfsUsed returns true if a btrfs file system is made on medias
+func BtrfsUsed(medias []*BlockDevice) bool {
+	for _, curr := range medias {
+		for _, ch := range curr.Children {
+			if ch.FsType == "btrfs" && ch.FormatPartition {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// BtrfsRoot returns true if the root partition of medias is btrfs
+func BtrfsRoot(medias []*BlockDevice) bool {
+	for _, curr := range medias {
+		for _, ch := range curr.Children {
+			if ch.MountPoint == "/" && ch.FsType == "btrfs" {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// BtrfsKernelArguments returns the kernel argument mounting the root
+// subvolume, none if the root partition has no subvolume
+func BtrfsKernelArguments(medias []*BlockDevice) []string {
+	for _, curr := range medias {
+		for _, ch := range curr.Children {
+			if ch.MountPoint != "/" {
+				continue
+			}
+
+			if sv := ch.mainSubvolume(); sv != nil {
+				return []string{fmt.Sprintf("rootflags=%s=%s", SubvolumeMountOption, sv.Name)}
+			}
+		}
+	}
+
+	return []string{}
+}
+
+// EnableSnapshots configures snapper to take the automatic snapshots of the
+// btrfs root of the target
+func EnableSnapshots(rootDir string) error {
+	// Make sure we have an installation environment
+	// and not a test environment
+	snapper := filepath.Join(rootDir, "/usr/bin/snapper")
+	if _, err := os.Stat(snapper); os.IsNotExist(err) {
+		log.Warning("Could not configure the automatic snapshots, %s not found", snapper)
+		return nil
+	}
+
+	if err := cmd.RunAndLog("chroot", rootDir, "snapper", "--no-dbus", "-c", snapperConfig,
+		"create-config", "/"); err != nil {
+		return errors.Wrap(err)
+	}
+
+	args := append([]string{"chroot", rootDir, "systemctl", "enable"}, snapperTimers...)
+	if err := cmd.RunAndLog(args...); err != nil {
+		return errors.Wrap(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,65 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package storage
+
+import (
+	"strings"
+
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/utils"
+)
+
+const (
+	// DataDiskSwap is the use of a data disk holding the swap
+	DataDiskSwap = "swap"
+)
+
+var (
+	// DataDiskUses are the mount points a data disk may hold for the same
+	// install as the disk of the root partition
+	DataDiskUses = []string{"/home", "/var", DataDiskSwap}
+)
+
+// NewDataDiskPartition replaces the partitions of disk with a single partition
+// taking the whole disk, mounted to use or a swap partition
+func NewDataDiskPartition(disk *BlockDevice, use string) (*BlockDevice, error) {
+	if !utils.StringSliceContains(DataDiskUses, use) {
+		return nil, errors.Errorf("Invalid data disk use %q, must be one of: %s",
+			use, strings.Join(DataDiskUses, ", "))
+	}
+
+	part := &BlockDevice{
+		Size:            disk.Size,
+		Type:            BlockDeviceTypePart,
+		FsType:          "ext4",
+		MountPoint:      use,
+		Label:           strings.TrimPrefix(use, "/"),
+		UserDefined:     true,
+		MakePartition:   true,
+		FormatPartition: true,
+	}
+
+	// the label of the standard swap partition is taken
+	if use == DataDiskSwap {
+		part.FsType = "swap"
+		part.MountPoint = ""
+		part.Label = "swap-" + disk.Name
+	}
+
+	disk.Children = nil
+	disk.PartTable = []*PartedPartition{
+		{
+			Number:     0,
+			Start:      0,
+			End:        disk.Size,
+			Size:       disk.Size,
+			FileSystem: "free",
+		},
+	}
+
+	disk.AddFromFreePartition(disk.findFree(disk.Size), part)
+
+	return part, nil
+}
@@ -0,0 +1,139 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/log"
+)
+
+const (
+	// DeviceWaitTimeout is the time given to udev to create a device node
+	// or symlink once the kernel knows about the device
+	DeviceWaitTimeout = 30 * time.Second
+)
+
+var (
+	// devicePollInterval is how often the device readiness is checked
+	devicePollInterval = 100 * time.Millisecond
+
+	// devByUUIDDir is where udev links the file systems by uuid
+	devByUUIDDir = "/dev/disk/by-uuid"
+
+	// udevControlFile only exists while udev is running
+	udevControlFile = "/run/udev/control"
+)
+
+// WaitForDevice waits for the device node or symlink file to show up, the
+// error lists the similar entries found to help diagnose the timeout
+func WaitForDevice(file string, timeout time.Duration) error {
+	return waitFor(file, timeout, func() bool {
+		_, err := os.Stat(file)
+		return err == nil
+	})
+}
+
+// WaitForUUID waits for the by-uuid symlink of the file system uuid, the uuid
+// is matched ignoring the case and dashes as vfat ones are shown upper case;
+// without udev running no symlink is ever created so there's nothing to wait
+func WaitForUUID(uuid string, timeout time.Duration) error {
+	file := filepath.Join(devByUUIDDir, uuid)
+
+	if _, err := os.Stat(udevControlFile); err != nil {
+		log.Debug("udev is not running, not waiting for %s", file)
+		return nil
+	}
+
+	return waitFor(file, timeout, func() bool {
+		entries, err := ioutil.ReadDir(devByUUIDDir)
+		if err != nil {
+			return false
+		}
+
+		for _, curr := range entries {
+			if normalizeUUID(curr.Name()) == normalizeUUID(uuid) {
+				return true
+			}
+		}
+
+		return false
+	})
+}
+
+// WaitForPartitions waits for the device nodes of the partitions created
+// in bd, the kernel is notified by partprobe but udev creates them later
+func (bd *BlockDevice) WaitForPartitions(timeout time.Duration) error {
+	for _, curr := range bd.Children {
+		if !curr.MakePartition {
+			continue
+		}
+
+		if err := WaitForDevice(curr.GetDeviceFile(), timeout); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// waitFor polls ready until it returns true or timeout expires
+func waitFor(file string, timeout time.Duration, ready func() bool) error {
+	start := time.Now()
+
+	for {
+		if ready() {
+			log.Debug("%s ready after %v", file, time.Since(start))
+			return nil
+		}
+
+		if time.Since(start) >= timeout {
+			break
+		}
+
+		time.Sleep(devicePollInterval)
+	}
+
+	found := similarEntries(file)
+	log.Warning("Timed out waiting for %s, found: %s", file, strings.Join(found, ", "))
+
+	return errors.Errorf("Timed out after %v waiting for %s (found: %s)",
+		timeout, file, strings.Join(found, ", "))
+}
+
+// similarEntries returns the entries of the file directory sharing its
+// name prefix, i.e. the other partitions of the same disk
+func similarEntries(file string) []string {
+	found := []string{}
+
+	entries, err := ioutil.ReadDir(filepath.Dir(file))
+	if err != nil {
+		return append(found, err.Error())
+	}
+
+	prefix := strings.TrimRight(filepath.Base(file), "0123456789")
+	prefix = strings.TrimSuffix(prefix, "p")
+
+	for _, curr := range entries {
+		if strings.HasPrefix(curr.Name(), prefix) {
+			found = append(found, curr.Name())
+		}
+	}
+
+	if len(found) == 0 {
+		found = append(found, "none")
+	}
+
+	return found
+}
+
+func normalizeUUID(uuid string) string {
+	return strings.ToLower(strings.Replace(uuid, "-", "", -1))
+}
@@ -0,0 +1,152 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package storage
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/clearlinux/clr-installer/cmd"
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/log"
+)
+
+// MediaDiagnostic is a possible cause of a media scan finding no device,
+// Module is the kernel module fixing it when it's a missing driver
+type MediaDiagnostic struct {
+	Problem string
+	Module  string
+}
+
+// storageController is a class of PCI storage controllers and its driver
+type storageController struct {
+	name   string
+	class  string
+	module string
+}
+
+var (
+	// sysPCIDevicesDir is the sysfs directory holding the PCI devices
+	sysPCIDevicesDir = "/sys/bus/pci/devices"
+
+	// sysModuleDir is the sysfs directory holding the loaded modules
+	sysModuleDir = "/sys/module"
+
+	// storageControllers are the storage controllers checked for a driver,
+	// matched by the prefix of their PCI class code
+	storageControllers = []storageController{
+		{name: "NVMe", class: "0x010802", module: "nvme"},
+		{name: "SATA AHCI", class: "0x010601", module: "ahci"},
+	}
+)
+
+// String returns the problem and, if any, the module fixing it
+func (md *MediaDiagnostic) String() string {
+	if md.Module == "" {
+		return md.Problem
+	}
+
+	return fmt.Sprintf("%s (load the %s module)", md.Problem, md.Module)
+}
+
+// DiagnoseMediaScan looks for the common reasons of a media scan finding no
+// device: missing privileges, an unreadable sysfs and storage controllers
+// with no driver loaded
+func DiagnoseMediaScan() []*MediaDiagnostic {
+	result := []*MediaDiagnostic{}
+
+	if os.Geteuid() != 0 {
+		result = append(result, &MediaDiagnostic{
+			Problem: "The installer is not running as root",
+		})
+	}
+
+	if _, err := ioutil.ReadDir(sysBlockDir); err != nil {
+		result = append(result, &MediaDiagnostic{
+			Problem: fmt.Sprintf("Could not read %s: %v", sysBlockDir, err),
+		})
+	}
+
+	pciDevs, err := ioutil.ReadDir(sysPCIDevicesDir)
+	if err != nil {
+		log.Debug("Could not read %s: %v", sysPCIDevicesDir, err)
+		return result
+	}
+
+	for _, ctrl := range storageControllers {
+		if moduleLoaded(ctrl.module) {
+			continue
+		}
+
+		for _, curr := range pciDevs {
+			content, err := ioutil.ReadFile(filepath.Join(sysPCIDevicesDir, curr.Name(), "class"))
+			if err != nil || !strings.HasPrefix(strings.TrimSpace(string(content)), ctrl.class) {
+				continue
+			}
+
+			result = append(result, &MediaDiagnostic{
+				Problem: fmt.Sprintf("%s controller %s has no driver loaded", ctrl.name, curr.Name()),
+				Module:  ctrl.module,
+			})
+			break
+		}
+	}
+
+	return result
+}
+
+// moduleLoaded returns true if module is loaded or built into the kernel,
+// both have a sysfs directory once initialized
+func moduleLoaded(module string) bool {
+	_, err := os.Stat(filepath.Join(sysModuleDir, module))
+	return err == nil
+}
+
+// LoadDiagnosedModules loads the kernel modules suggested by diagnostics and
+// waits for udev to create the new block devices
+func LoadDiagnosedModules(diagnostics []*MediaDiagnostic) error {
+	loaded := false
+
+	for _, curr := range diagnostics {
+		if curr.Module == "" {
+			continue
+		}
+
+		if err := cmd.RunAndLog("modprobe", curr.Module); err != nil {
+			return errors.Wrap(err)
+		}
+
+		loaded = true
+	}
+
+	if !loaded {
+		return nil
+	}
+
+	return settleBlockDevices()
+}
+
+// HasDiagnosedModules returns true if any of diagnostics is a missing driver
+func HasDiagnosedModules(diagnostics []*MediaDiagnostic) bool {
+	for _, curr := range diagnostics {
+		if curr.Module != "" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// settleBlockDevices waits for udev to process the pending block device events
+func settleBlockDevices() error {
+	if err := cmd.RunAndLog("udevadm", "settle", "--timeout=10"); err != nil {
+		return errors.Wrap(err)
+	}
+
+	return nil
+}
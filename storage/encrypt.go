@@ -6,8 +6,11 @@ package storage
 
 import (
 	"bytes"
+	"crypto/rand"
+	"encoding/base32"
 	"fmt"
 	"github.com/clearlinux/clr-installer/utils"
+	"io/ioutil"
 	"os"
 	"os/signal"
 	"path/filepath"
@@ -29,6 +32,9 @@ const (
 	// MaxPassphraseLength is the shortest possible password
 	MaxPassphraseLength = 94
 
+	// MaxPassphraseStrength is the strongest PassphraseStrength() rating
+	MaxPassphraseStrength = 4
+
 	// RequiredBundle the bundle needed if encrypted partitions are used
 	RequiredBundle = "boot-encrypted"
 	// KernelArgument is kernel argument needed if encrypted partitions are used
@@ -40,8 +46,87 @@ const (
 	EncryptCipher = "aes-xts-plain64"
 	// EncryptKeySize use for LUKS encryption
 	EncryptKeySize = 512
+
+	// EncryptionLUKS2 is the LUKS2 encryption format, the default
+	EncryptionLUKS2 = "luks2"
+
+	// EncryptionLUKS1 is the LUKS1 encryption format, for the boot loaders
+	// and tools not supporting LUKS2
+	EncryptionLUKS1 = "luks1"
+
+	// KeyFileSize is the size in bytes of a generated LUKS key file
+	KeyFileSize = 4096
+
+	// KeyFileName is the name of a generated LUKS key file
+	KeyFileName = "clr-installer.key"
+
+	// PassphrasePrompt prompts the passphrase on the console at install
+	// time, unless the descriptor answers it
+	PassphrasePrompt = "prompt"
+
+	// PassphraseUSBKeyFile reads the passphrase from the PassphraseFileName
+	// file of a device, i.e an usb stick partition
+	PassphraseUSBKeyFile = "usb-keyfile"
+
+	// PassphraseTPM enrolls the TPM to unlock the partitions, the generated
+	// passphrase is removed once enrolled
+	PassphraseTPM = "tpm"
+
+	// PassphraseFileName is the file of the PassphraseUSBKeyFile device
+	// holding the passphrase
+	PassphraseFileName = "clr-installer.passphrase"
+
+	// TPMKernelArgument unlocks the partitions opened by the initrd, i.e the
+	// root, with the TPM
+	TPMKernelArgument = "rd.luks.options=tpm2-device=auto"
+
+	// tpmCrypttabOption unlocks a crypttab partition with the TPM
+	tpmCrypttabOption = "tpm2-device=auto"
+
+	// generatedPassphraseBytes is the random size of a generated passphrase
+	generatedPassphraseBytes = 32
+
+	// recoveryKeyBytes is the amount of random bytes of a recovery key
+	recoveryKeyBytes = 25
+
+	// recoveryKeyGroupLen is the length of each dash separated recovery key group
+	recoveryKeyGroupLen = 5
 )
 
+// EncryptionFormats is the list of the supported LUKS formats
+var EncryptionFormats = []string{EncryptionLUKS2, EncryptionLUKS1}
+
+// luksFormat returns the LUKS format of the encrypted partition bd
+func (bd *BlockDevice) luksFormat() string {
+	if bd.Encryption == "" {
+		return EncryptionLUKS2
+	}
+
+	return bd.Encryption
+}
+
+// validateEncryption checks the encryption format of bd
+func (bd *BlockDevice) validateEncryption() error {
+	if bd.Encryption == "" {
+		return nil
+	}
+
+	if !utils.StringSliceContains(EncryptionFormats, bd.Encryption) {
+		return errors.Errorf("%s: invalid encryption %q, must be one of: %s",
+			bd.Name, bd.Encryption, strings.Join(EncryptionFormats, ", "))
+	}
+
+	if bd.Type != BlockDeviceTypeCrypt {
+		return errors.Errorf("%s: encryption is only supported on crypt partitions", bd.Name)
+	}
+
+	if bd.Encryption == EncryptionLUKS1 && bd.Label != "" {
+		return errors.Errorf("%s: LUKS1 containers can not be labeled", bd.Name)
+	}
+
+	return nil
+}
+
 // EncryptionRequiresPassphrase checks all partition to see if encryption was enabled
 func (bd *BlockDevice) EncryptionRequiresPassphrase() bool {
 	enabled := (bd.Type == BlockDeviceTypeCrypt && bd.FsType != "swap")
@@ -58,6 +143,44 @@ func (bd *BlockDevice) EncryptionRequiresPassphrase() bool {
 	return enabled
 }
 
+// EncryptionUsed returns true if any of the medias partitions is encrypted
+func EncryptionUsed(medias []*BlockDevice) bool {
+	for _, curr := range medias {
+		for _, ch := range curr.Children {
+			if ch.Type == BlockDeviceTypeCrypt {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// EncryptStandardPartitions encrypts the root partition added by the standard
+// partitioning, or if homeOnly is set, splits the root partition and encrypts
+// a new /home partition only leaving the root partition unencrypted
+func EncryptStandardPartitions(disk *BlockDevice, homeOnly bool) error {
+	if homeOnly {
+		home, err := AddHomeStandardPartition(disk)
+		if err != nil {
+			return err
+		}
+
+		home.Type = BlockDeviceTypeCrypt
+		home.Encryption = EncryptionLUKS2
+		return nil
+	}
+
+	for _, ch := range disk.Children {
+		if ch.MountPoint == "/" {
+			ch.Type = BlockDeviceTypeCrypt
+			ch.Encryption = EncryptionLUKS2
+		}
+	}
+
+	return nil
+}
+
 // MapEncrypted uses cryptsetup to format (initialize) and open (map) the
 // physical partion to an encrypted partition
 func (bd *BlockDevice) MapEncrypted(passphrase string) error {
@@ -68,6 +191,7 @@ func (bd *BlockDevice) MapEncrypted(passphrase string) error {
 	args := []string{
 		"cryptsetup",
 		"--batch-mode",
+		fmt.Sprintf("--type=%s", bd.luksFormat()),
 		fmt.Sprintf("--hash=%s", EncryptHash),
 		fmt.Sprintf("--cipher=%s", EncryptCipher),
 		fmt.Sprintf("--key-size=%d", EncryptKeySize),
@@ -79,16 +203,26 @@ func (bd *BlockDevice) MapEncrypted(passphrase string) error {
 
 	args = append(args, "luksFormat", bd.GetDeviceFile(), "-")
 
-	if err := cmd.PipeRunAndLog(passphrase, args...); err != nil {
+	if err := bd.pipeRunAndLog(passphrase, args...); err != nil {
 		return errors.Wrap(err)
 	}
 
+	return bd.OpenEncrypted(passphrase)
+}
+
+// OpenEncrypted uses cryptsetup to open (map) the already formatted
+// encrypted partition, i.e when a partitioned install is resumed
+func (bd *BlockDevice) OpenEncrypted(passphrase string) error {
+	if bd.Type != BlockDeviceTypeCrypt {
+		return errors.Errorf("Trying to run cryptsetup() against a non crypt partition")
+	}
+
 	mapped, err := bd.getMappedName()
 	if err != nil {
 		return errors.Wrap(err)
 	}
 
-	args = []string{
+	args := []string{
 		"cryptsetup",
 		"--batch-mode",
 		"luksOpen",
@@ -96,14 +230,16 @@ func (bd *BlockDevice) MapEncrypted(passphrase string) error {
 
 	args = append(args, bd.GetDeviceFile(), mapped, "-")
 
-	if err := cmd.PipeRunAndLog(passphrase, args...); err != nil {
+	if err = bd.pipeRunAndLog(passphrase, args...); err != nil {
 		return errors.Wrap(err)
 	}
 
 	log.Debug("Disk partition %q is mapped to encrypted partition %q", bd.Name, mapped)
 
 	// Store the mapped point for later unmounting
+	mountedMutex.Lock()
 	mountedEncrypts = append(mountedEncrypts, mapped)
+	mountedMutex.Unlock()
 
 	bd.MappedName = filepath.Join("mapper", mapped)
 
@@ -240,6 +376,48 @@ func IsValidPassphrase(phrase string) (bool, string) {
 	return true, ""
 }
 
+// PassphraseStrength rates phrase from 0, too short, to MaxPassphraseStrength
+// by its length and the classes of characters it mixes, its localized name
+// is returned too
+func PassphraseStrength(phrase string) (int, string) {
+	names := []string{"Very weak", "Weak", "Fair", "Good", "Strong"}
+
+	if len(phrase) < MinPassphraseLength {
+		return 0, utils.Locale.Get(names[0])
+	}
+
+	var lower, upper, digit, other bool
+	for _, r := range phrase {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		default:
+			other = true
+		}
+	}
+
+	strength := 0
+	for _, class := range []bool{lower, upper, digit, other} {
+		if class {
+			strength++
+		}
+	}
+
+	if len(phrase) >= 2*MinPassphraseLength {
+		strength++
+	}
+
+	if strength > MaxPassphraseStrength {
+		strength = MaxPassphraseStrength
+	}
+
+	return strength, utils.Locale.Get(names[strength])
+}
+
 // GetPassPhrase prompts to the user interactively for the pass phrase
 // via the command line.
 // This is intended to be used to get a pass phrase for encrypting
@@ -318,3 +496,340 @@ func isPrintable(s string) bool {
 	}
 	return true
 }
+
+// CryptKeys describes the LUKS key slots added to the encrypted partitions
+// besides the passphrase, which always uses the first key slot
+type CryptKeys struct {
+	// Recovery adds a generated recovery key
+	Recovery bool `yaml:"recovery,omitempty"`
+
+	// RecoveryFile is where the generated recovery key is exported to
+	RecoveryFile string `yaml:"recoveryFile,omitempty"`
+
+	// KeyFile is a secret reference to a key file content, see utils.ReadSecret
+	KeyFile string `yaml:"keyFile,omitempty"`
+
+	// KeyFileDevice is a device (i.e an usb stick partition) to store a generated
+	// key file into, ignored if KeyFile is set
+	KeyFileDevice string `yaml:"keyFileDevice,omitempty"`
+
+	// Passphrase is how the encryption passphrase is set, one of
+	// PassphrasePolicies, defaults to PassphrasePrompt
+	Passphrase string `yaml:"passphrase,omitempty"`
+
+	// PassphraseDevice is the device holding the PassphraseFileName file of
+	// the PassphraseUSBKeyFile policy
+	PassphraseDevice string `yaml:"passphraseDevice,omitempty"`
+
+	// RecoveryKey is the generated recovery key
+	RecoveryKey string `yaml:"-"`
+
+	keyFile []byte
+
+	// generatedPassphrase is true if the passphrase was generated by the
+	// PassphraseTPM policy, its key slot is removed once the TPM is enrolled
+	generatedPassphrase bool
+}
+
+// Validate checks the passphrase policy of keys
+func (keys *CryptKeys) Validate() error {
+	if keys.Passphrase != "" && !utils.StringSliceContains(PassphrasePolicies, keys.Passphrase) {
+		return errors.ValidationErrorf("Invalid passphrase policy %q, must be one of: %s",
+			keys.Passphrase, strings.Join(PassphrasePolicies, ", "))
+	}
+
+	if keys.Passphrase == PassphraseUSBKeyFile && !strings.HasPrefix(keys.PassphraseDevice, "/dev/") {
+		return errors.ValidationErrorf("The %s passphrase policy requires a passphrase device, i.e: /dev/sdb1",
+			PassphraseUSBKeyFile)
+	}
+
+	if keys.Passphrase != PassphraseUSBKeyFile && keys.PassphraseDevice != "" {
+		return errors.ValidationErrorf("The passphrase device requires the %s passphrase policy",
+			PassphraseUSBKeyFile)
+	}
+
+	return nil
+}
+
+// PassphrasePolicy returns the passphrase policy of keys, keys may be nil
+func (keys *CryptKeys) PassphrasePolicy() string {
+	if keys == nil || keys.Passphrase == "" {
+		return PassphrasePrompt
+	}
+
+	return keys.Passphrase
+}
+
+// ReadPassphrase returns the passphrase of the PassphraseUSBKeyFile and
+// PassphraseTPM policies, the latter is generated
+func (keys *CryptKeys) ReadPassphrase() (string, error) {
+	switch keys.PassphrasePolicy() {
+	case PassphraseUSBKeyFile:
+		return readDevicePassphrase(keys.PassphraseDevice)
+	case PassphraseTPM:
+		buf := make([]byte, generatedPassphraseBytes)
+		if _, err := rand.Read(buf); err != nil {
+			return "", errors.Wrap(err)
+		}
+
+		keys.generatedPassphrase = true
+		return fmt.Sprintf("%x", buf), nil
+	}
+
+	return "", errors.Errorf("The %s passphrase policy has no passphrase to read", keys.PassphrasePolicy())
+}
+
+// readDevicePassphrase reads the passphrase of the PassphraseFileName file in
+// the root directory of device, mounted read-only
+func readDevicePassphrase(device string) (string, error) {
+	mountPoint, err := ioutil.TempDir("", "clr-installer-passphrase-")
+	if err != nil {
+		return "", errors.Wrap(err)
+	}
+	defer func() { _ = os.RemoveAll(mountPoint) }()
+
+	if err = cmd.RunAndLog("mount", "-o", "ro", device, mountPoint); err != nil {
+		return "", errors.Wrap(err)
+	}
+	defer func() {
+		if err := syscall.Unmount(mountPoint, 0); err != nil {
+			log.Warning("Failed to unmount the passphrase device %s: %v", device, err)
+		}
+	}()
+
+	content, err := ioutil.ReadFile(filepath.Join(mountPoint, PassphraseFileName))
+	if err != nil {
+		return "", errors.Errorf("Could not read the passphrase of %s: %v", device, err)
+	}
+
+	passphrase := strings.TrimRight(string(content), "\r\n")
+	if ok, msg := IsValidPassphrase(passphrase); !ok {
+		return "", errors.Errorf("Invalid passphrase in %s: %s", device, msg)
+	}
+
+	log.Info("Read the encryption passphrase from the device %s", device)
+
+	return passphrase, nil
+}
+
+// CanPromptPassphrase returns true if the passphrase can be prompted, the
+// headless installs have no console
+func CanPromptPassphrase() bool {
+	return terminal.IsTerminal(int(syscall.Stdin))
+}
+
+// EnableTPMUnlock marks the encrypted partitions of medias to be unlocked by
+// the TPM at boot
+func EnableTPMUnlock(medias []*BlockDevice) {
+	for _, curr := range medias {
+		for _, ch := range curr.Children {
+			if ch.Type == BlockDeviceTypeCrypt && ch.FsTypeNotSwap() {
+				ch.tpmUnlock = true
+			}
+		}
+	}
+}
+
+var (
+	// PassphrasePolicies are how an unattended install gets the encryption
+	// passphrase without embedding it in the descriptor
+	PassphrasePolicies = []string{PassphrasePrompt, PassphraseUSBKeyFile, PassphraseTPM}
+)
+
+// GenerateRecoveryKey returns a new random recovery key, in groups of
+// characters easy to read and type back
+func GenerateRecoveryKey() (string, error) {
+	buf := make([]byte, recoveryKeyBytes)
+
+	if _, err := rand.Read(buf); err != nil {
+		return "", errors.Wrap(err)
+	}
+
+	encoded := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(buf)
+	groups := []string{}
+
+	for len(encoded) > 0 {
+		size := recoveryKeyGroupLen
+		if len(encoded) < size {
+			size = len(encoded)
+		}
+
+		groups = append(groups, encoded[:size])
+		encoded = encoded[size:]
+	}
+
+	return strings.Join(groups, "-"), nil
+}
+
+// Prepare generates the recovery key, exporting it if requested, and reads
+// or generates the key file, it must be called before AddKeySlots
+func (keys *CryptKeys) Prepare() error {
+	var err error
+
+	if keys.Recovery && keys.RecoveryKey == "" {
+		if keys.RecoveryKey, err = GenerateRecoveryKey(); err != nil {
+			return err
+		}
+	}
+
+	if keys.Recovery && keys.RecoveryFile != "" {
+		if err = ioutil.WriteFile(keys.RecoveryFile, []byte(keys.RecoveryKey+"\n"), 0600); err != nil {
+			return errors.Wrap(err)
+		}
+		log.Info("Exported the recovery key to: %s", keys.RecoveryFile)
+	}
+
+	if keys.KeyFile != "" {
+		if keys.keyFile, err = utils.ReadSecret(keys.KeyFile); err != nil {
+			return err
+		}
+	} else if keys.KeyFileDevice != "" {
+		if keys.keyFile, err = writeDeviceKeyFile(keys.KeyFileDevice); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeDeviceKeyFile generates a random key file and stores it in the root
+// directory of device, the key content is returned
+func writeDeviceKeyFile(device string) ([]byte, error) {
+	key := make([]byte, KeyFileSize)
+
+	if _, err := rand.Read(key); err != nil {
+		return nil, errors.Wrap(err)
+	}
+
+	mountPoint, err := ioutil.TempDir("", "clr-installer-key-")
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	defer func() { _ = os.RemoveAll(mountPoint) }()
+
+	if err = cmd.RunAndLog("mount", device, mountPoint); err != nil {
+		return nil, errors.Wrap(err)
+	}
+	defer func() {
+		if err := syscall.Unmount(mountPoint, 0); err != nil {
+			log.Warning("Failed to unmount the key file device %s: %v", device, err)
+		}
+	}()
+
+	keyPath := filepath.Join(mountPoint, KeyFileName)
+	if err = ioutil.WriteFile(keyPath, key, 0400); err != nil {
+		return nil, errors.Wrap(err)
+	}
+
+	log.Info("Stored the key file %s in the device %s", KeyFileName, device)
+
+	return key, nil
+}
+
+// AddKeySlots adds the recovery key and the key file, if any, to the LUKS
+// key slots of an encrypted partition, passphrase unlocks the partition
+func (bd *BlockDevice) AddKeySlots(passphrase string, keys *CryptKeys) error {
+	if bd.Type != BlockDeviceTypeCrypt {
+		return errors.Errorf("Trying to add key slots to a non crypt partition")
+	}
+
+	if keys == nil {
+		return nil
+	}
+
+	if keys.Recovery {
+		if err := bd.addKeySlot(passphrase, []byte(keys.RecoveryKey)); err != nil {
+			return err
+		}
+		log.Debug("Added the recovery key slot to %q", bd.Name)
+	}
+
+	if len(keys.keyFile) > 0 {
+		if err := bd.addKeySlot(passphrase, keys.keyFile); err != nil {
+			return err
+		}
+		log.Debug("Added the key file slot to %q", bd.Name)
+	}
+
+	return nil
+}
+
+// writeTempKey writes key to a new temporary file only readable by the owner,
+// the caller removes it
+func writeTempKey(key []byte) (string, error) {
+	f, err := ioutil.TempFile("", "clr-installer-key-")
+	if err != nil {
+		return "", errors.Wrap(err)
+	}
+
+	if err = f.Chmod(0600); err == nil {
+		_, err = f.Write(key)
+	}
+
+	if cErr := f.Close(); err == nil {
+		err = cErr
+	}
+
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return "", errors.Wrap(err)
+	}
+
+	return f.Name(), nil
+}
+
+// addKeySlot uses cryptsetup to add key to a new key slot, the key is written to
+// a temporary file so it's never exposed in the command line
+func (bd *BlockDevice) addKeySlot(passphrase string, key []byte) error {
+	file, err := writeTempKey(key)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(file) }()
+
+	args := []string{
+		"cryptsetup",
+		"--batch-mode",
+		"--key-file=-",
+		"luksAddKey",
+		bd.GetDeviceFile(),
+		file,
+	}
+
+	if err = bd.pipeRunAndLog(passphrase, args...); err != nil {
+		return errors.Wrap(err)
+	}
+
+	return nil
+}
+
+// EnrollTPM enrolls the TPM of the PassphraseTPM policy to a new key slot of
+// the encrypted partition bd, the slot of a generated passphrase is removed
+func (bd *BlockDevice) EnrollTPM(passphrase string, keys *CryptKeys) error {
+	if keys.PassphrasePolicy() != PassphraseTPM {
+		return nil
+	}
+
+	file, err := writeTempKey([]byte(passphrase))
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(file) }()
+
+	if err = bd.runAndLog("systemd-cryptenroll", "--tpm2-device=auto",
+		"--unlock-key-file="+file, bd.GetDeviceFile()); err != nil {
+		return errors.Wrap(err)
+	}
+	log.Debug("Enrolled the TPM to %q", bd.Name)
+
+	if !keys.generatedPassphrase {
+		return nil
+	}
+
+	if err = bd.runAndLog("cryptsetup", "--batch-mode", "luksRemoveKey", bd.GetDeviceFile(), file); err != nil {
+		return errors.Wrap(err)
+	}
+	log.Debug("Removed the generated passphrase slot of %q", bd.Name)
+
+	return nil
+}
@@ -0,0 +1,226 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package storage
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/log"
+)
+
+const (
+	// ESPPolicyCreate creates a new EFI System Partition next to the
+	// existing one, the default
+	ESPPolicyCreate = "create"
+
+	// ESPPolicyReuse installs the boot loader and kernels to the existing
+	// EFI System Partition, keeping its content
+	ESPPolicyReuse = "reuse"
+
+	// ESPPolicyReplace formats the existing EFI System Partition, the other
+	// operating systems booting from it are no longer bootable
+	ESPPolicyReplace = "replace"
+
+	// ClearBootEntryPrefix is the prefix of the boot entries installed by
+	// clr-boot-manager
+	ClearBootEntryPrefix = "Clear-linux-"
+
+	// ESPReuseMinimumFree is the free space an existing EFI System Partition
+	// must have to be reused, the kernels and the boot loader fit in it
+	ESPReuseMinimumFree = uint64(100 * (1000 * 1000))
+)
+
+// ESPPolicies is the list of the supported EFI System Partition policies
+var ESPPolicies = []string{ESPPolicyCreate, ESPPolicyReuse, ESPPolicyReplace}
+
+// FindESP returns the existing EFI System Partition of the disk bd, nil
+// if there is none
+func (bd *BlockDevice) FindESP() *BlockDevice {
+	for _, part := range bd.PartTable {
+		if part.Number == 0 || !strings.Contains(part.Flags, "esp") {
+			continue
+		}
+
+		name := fmt.Sprintf("%s%d", bd.getBasePartitionName(), part.Number)
+		for _, ch := range bd.Children {
+			if ch.Name == name && ch.FsType == "vfat" {
+				return ch
+			}
+		}
+	}
+
+	return nil
+}
+
+// BootEntry is a boot loader entry found in an existing EFI System Partition
+type BootEntry struct {
+	ID    string
+	Title string
+}
+
+// withMountedReadOnly mounts the existing partition bd read only to a
+// temporary directory and calls fn with it
+func withMountedReadOnly(bd *BlockDevice, fn func(dir string) error) error {
+	dir, err := ioutil.TempDir("", "clr-installer-mnt-")
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	// the in kernel ntfs3 driver replaced the read only ntfs one
+	fsTypes := []string{bd.FsType}
+	if bd.FsType == "ntfs" {
+		fsTypes = []string{"ntfs3", "ntfs"}
+	}
+
+	for _, fsType := range fsTypes {
+		if err = syscall.Mount(bd.GetDeviceFile(), dir, fsType, syscall.MS_RDONLY, ""); err == nil {
+			break
+		}
+	}
+
+	if err != nil {
+		return errors.Errorf("mount %s %s: %v", bd.GetDeviceFile(), dir, err)
+	}
+
+	defer func() {
+		if err := syscall.Unmount(dir, 0); err != nil {
+			log.Warning("Failed to unmount %s: %v", dir, err)
+		}
+	}()
+
+	return fn(dir)
+}
+
+// ESPFreeSpace returns the free space of the existing EFI System Partition esp
+func ESPFreeSpace(esp *BlockDevice) (uint64, error) {
+	var st syscall.Statfs_t
+
+	err := withMountedReadOnly(esp, func(dir string) error {
+		return errors.Wrap(syscall.Statfs(dir, &st))
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return st.Bavail * uint64(st.Bsize), nil
+}
+
+// DetectBootEntries returns the boot entries of the other operating systems
+// installed to the existing EFI System Partition esp: the systemd-boot entries
+// and Windows, which systemd-boot detects as "auto-windows"
+func DetectBootEntries(esp *BlockDevice) ([]*BootEntry, error) {
+	result := []*BootEntry{}
+
+	err := withMountedReadOnly(esp, func(dir string) error {
+		result = findBootEntries(dir)
+		return nil
+	})
+
+	return result, err
+}
+
+// findBootEntries looks for the boot entries in the ESP mounted at dir
+func findBootEntries(dir string) []*BootEntry {
+	result := []*BootEntry{}
+
+	entries, _ := filepath.Glob(filepath.Join(dir, "loader", "entries", "*.conf"))
+	for _, curr := range entries {
+		id := strings.TrimSuffix(filepath.Base(curr), ".conf")
+		if strings.HasPrefix(id, ClearBootEntryPrefix) {
+			continue
+		}
+
+		entry := &BootEntry{ID: id, Title: id}
+
+		if content, err := ioutil.ReadFile(curr); err == nil {
+			for _, line := range strings.Split(string(content), "\n") {
+				if fields := strings.Fields(line); len(fields) > 1 && fields[0] == "title" {
+					entry.Title = strings.Join(fields[1:], " ")
+				}
+			}
+		}
+
+		result = append(result, entry)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "EFI", "Microsoft", "Boot", "bootmgfw.efi")); err == nil {
+		result = append(result, &BootEntry{ID: "auto-windows", Title: "Windows Boot Manager"})
+	}
+
+	return result
+}
+
+// CheckESPFreeSpace returns an error if the existing EFI System Partition esp
+// has not enough free space to be reused
+func CheckESPFreeSpace(esp *BlockDevice) error {
+	free, err := ESPFreeSpace(esp)
+	if err != nil {
+		return err
+	}
+
+	if free < ESPReuseMinimumFree {
+		need, _ := HumanReadableSize(ESPReuseMinimumFree)
+		avail, _ := HumanReadableSize(free)
+		return errors.Errorf("EFI System Partition %s has %s free, %s are required to reuse it",
+			esp.Name, avail, need)
+	}
+
+	return nil
+}
+
+// AddBootPartition adds to disk the boot partition of a partial install
+// according to the EFI System Partition policy, a new partition is created if
+// the disk has no ESP. Returns the size taken from the disk free space.
+func AddBootPartition(disk *BlockDevice, policy string) (uint64, error) {
+	esp := disk.FindESP()
+
+	if esp == nil || policy == "" || policy == ESPPolicyCreate {
+		return AddBootStandardPartition(disk), nil
+	}
+
+	switch policy {
+	case ESPPolicyReuse:
+		if err := CheckESPFreeSpace(esp); err != nil {
+			return 0, err
+		}
+		esp.FormatPartition = false
+	case ESPPolicyReplace:
+		esp.FormatPartition = true
+		esp.Label = "boot"
+	default:
+		return 0, errors.Errorf("Invalid EFI System Partition policy: %s", policy)
+	}
+
+	esp.MountPoint = "/boot"
+	esp.MakePartition = false
+	esp.UserDefined = true
+
+	return 0, nil
+}
+
+// ValidateESPReuse checks the existing EFI System Partitions reused by medias,
+// not formatted, have enough free space
+func ValidateESPReuse(medias []*BlockDevice) error {
+	for _, curr := range medias {
+		for _, ch := range curr.Children {
+			if ch.MountPoint != "/boot" || ch.FsType != "vfat" || ch.MakePartition || ch.FormatPartition {
+				continue
+			}
+
+			if err := CheckESPFreeSpace(ch); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
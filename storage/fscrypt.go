@@ -0,0 +1,73 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package storage
+
+import (
+	"strings"
+
+	"github.com/clearlinux/clr-installer/errors"
+)
+
+const (
+	// HomeEncryptionFscrypt encrypts the home directory of each user with
+	// fscrypt, unlocked by the user login password
+	HomeEncryptionFscrypt = "fscrypt"
+
+	// FscryptRequiredBundle is the bundle with the fscrypt tool and its
+	// PAM module
+	FscryptRequiredBundle = "fscrypt"
+
+	// fscryptMkfsOption enables the encryption feature of an ext4 file system
+	fscryptMkfsOption = "-O encrypt"
+)
+
+// HomeEncryptions are the supported per user home encryptions
+var HomeEncryptions = []string{HomeEncryptionFscrypt}
+
+// HomeFilesystem returns the partition holding /home, the root partition if
+// /home is not a partition of its own; nil if there is none
+func HomeFilesystem(medias []*BlockDevice) *BlockDevice {
+	var root *BlockDevice
+
+	for _, curr := range medias {
+		for _, ch := range curr.Children {
+			switch ch.MountPoint {
+			case "/home":
+				return ch
+			case "/":
+				root = ch
+			}
+		}
+	}
+
+	return root
+}
+
+// ValidateFscrypt checks the home directories can be encrypted with fscrypt,
+// the file system holding /home must be a new ext4 file system
+func ValidateFscrypt(medias []*BlockDevice) error {
+	home := HomeFilesystem(medias)
+	if home == nil {
+		return errors.ValidationErrorf("The home directories encryption requires a /home or root partition")
+	}
+
+	if home.FsType != "ext4" || !home.FormatPartition {
+		return errors.ValidationErrorf("The home directories encryption requires a new ext4 file system on %s",
+			home.MountPoint)
+	}
+
+	return nil
+}
+
+// EnableFscrypt enables the encryption feature of the new file system
+// holding /home, see ValidateFscrypt
+func EnableFscrypt(medias []*BlockDevice) {
+	home := HomeFilesystem(medias)
+	if home == nil || strings.Contains(home.Options, fscryptMkfsOption) {
+		return
+	}
+
+	home.Options = strings.TrimSpace(home.Options + " " + fscryptMkfsOption)
+}
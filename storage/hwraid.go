@@ -0,0 +1,254 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/clearlinux/clr-installer/cmd"
+	"github.com/clearlinux/clr-installer/log"
+	"github.com/clearlinux/clr-installer/utils"
+)
+
+// HWRAIDInfo describes a virtual drive exposed by a hardware RAID controller
+type HWRAIDInfo struct {
+	Controller   string // controller family, i.e MegaRAID
+	Driver       string // kernel driver of the controller
+	Vendor       string // vendor reported by the virtual drive
+	VirtualDrive string // SCSI address of the virtual drive
+}
+
+// raidController is a family of hardware RAID controllers, its drivers and
+// the vendor tools reporting its cache state
+type raidController struct {
+	name    string
+	drivers []string
+	tools   []string
+	check   func(tool string) []string
+}
+
+var (
+	raidControllers = []*raidController{
+		{
+			name:    "MegaRAID",
+			drivers: []string{"megaraid_sas"},
+			tools:   []string{"storcli64", "storcli", "perccli64"},
+			check:   checkStorcliCache,
+		},
+		{
+			name:    "Smart Array",
+			drivers: []string{"hpsa", "smartpqi"},
+			tools:   []string{"ssacli", "hpssacli"},
+			check:   checkSsacliCache,
+		},
+	}
+
+	// storcliVDExp matches the virtual drives of the storcli vall listing:
+	// DG/VD TYPE State Access Consist Cache ...
+	storcliVDExp = regexp.MustCompile(`^\s*([0-9]+/[0-9]+)\s+RAID\S*\s+\S+\s+\S+\s+\S+\s+(\S+)`)
+)
+
+// String returns the controller and virtual drive description
+func (ri *HWRAIDInfo) String() string {
+	result := ri.Controller
+	if ri.Vendor != "" {
+		result = fmt.Sprintf("%s %s", ri.Vendor, result)
+	}
+
+	return fmt.Sprintf("%s virtual drive %s", result, ri.VirtualDrive)
+}
+
+// findRAIDController returns the controller family handled by driver
+func findRAIDController(driver string) *raidController {
+	for _, curr := range raidControllers {
+		if utils.StringSliceContains(curr.drivers, driver) {
+			return curr
+		}
+	}
+
+	return nil
+}
+
+// controller returns the controller family of info, if known
+func (ri *HWRAIDInfo) controller() *raidController {
+	return findRAIDController(ri.Driver)
+}
+
+// GetHWRAIDInfo returns the hardware RAID controller bd, or its disk, is
+// behind; nil is returned for the devices not behind a known controller
+func (bd *BlockDevice) GetHWRAIDInfo() *HWRAIDInfo {
+	disk := bd
+	if bd.Parent != nil {
+		disk = bd.Parent
+	}
+
+	devPath, err := filepath.EvalSymlinks(filepath.Join(sysBlockDir, disk.Name, "device"))
+	if err != nil {
+		return nil
+	}
+
+	// the SCSI device is bound to sd, the controller is one of its parents
+	for dir := devPath; dir != "/" && dir != "."; dir = filepath.Dir(dir) {
+		link, err := os.Readlink(filepath.Join(dir, "driver"))
+		if err != nil {
+			continue
+		}
+
+		ctrl := findRAIDController(filepath.Base(link))
+		if ctrl == nil {
+			continue
+		}
+
+		vendor, _ := ioutil.ReadFile(filepath.Join(devPath, "vendor"))
+
+		return &HWRAIDInfo{
+			Controller:   ctrl.name,
+			Driver:       filepath.Base(link),
+			Vendor:       strings.TrimSpace(string(vendor)),
+			VirtualDrive: filepath.Base(devPath),
+		}
+	}
+
+	return nil
+}
+
+// FriendlyModel returns the model of bd, describing the hardware RAID virtual
+// drive it may be
+func (bd *BlockDevice) FriendlyModel() string {
+	model := strings.TrimSpace(bd.Model)
+
+	if info := bd.GetHWRAIDInfo(); info != nil {
+		return fmt.Sprintf("%s (%s)", model, info)
+	}
+
+	return model
+}
+
+// HWRAIDWarnings returns the risky write cache setups reported by the vendor
+// tools of the controllers medias are behind, the controllers with no vendor
+// tool installed are not checked
+func HWRAIDWarnings(medias []*BlockDevice) []string {
+	result := []string{}
+	checked := map[*raidController]bool{}
+
+	for _, curr := range medias {
+		info := curr.GetHWRAIDInfo()
+		if info == nil {
+			continue
+		}
+
+		ctrl := info.controller()
+		if checked[ctrl] {
+			continue
+		}
+		checked[ctrl] = true
+
+		tool := findTool(ctrl.tools)
+		if tool == "" {
+			log.Debug("No %s tool found, not checking the controller cache", ctrl.name)
+			continue
+		}
+
+		result = append(result, ctrl.check(tool)...)
+	}
+
+	return result
+}
+
+// findTool returns the path of the first of tools installed
+func findTool(tools []string) string {
+	for _, curr := range tools {
+		if path, err := exec.LookPath(curr); err == nil {
+			return path
+		}
+	}
+
+	return ""
+}
+
+// runTool returns the output of a vendor tool, empty if it failed
+func runTool(args ...string) string {
+	w := bytes.NewBuffer(nil)
+
+	if err := cmd.Run(w, args...); err != nil {
+		log.Warning("%s failed: %v", strings.Join(args, " "), err)
+		return ""
+	}
+
+	return w.String()
+}
+
+// checkStorcliCache warns about the MegaRAID virtual drives caching writes
+// with no healthy battery or CacheVault protecting the cache
+func checkStorcliCache(tool string) []string {
+	backup := runTool(tool, "/call/bbu", "show") + runTool(tool, "/call/cv", "show")
+	return parseStorcliCache(runTool(tool, "/call/vall", "show"), strings.Contains(backup, "Optimal"))
+}
+
+// parseStorcliCache parses the storcli vall listing, protected tells a
+// battery or CacheVault is healthy
+func parseStorcliCache(output string, protected bool) []string {
+	result := []string{}
+
+	for _, curr := range strings.Split(output, "\n") {
+		match := storcliVDExp.FindStringSubmatch(curr)
+		if match == nil {
+			continue
+		}
+
+		vd, cache := match[1], match[2]
+
+		switch {
+		case strings.Contains(cache, "AWB"):
+			result = append(result, utils.Locale.Get("MegaRAID virtual drive %s always caches writes, even with no healthy battery", vd))
+		case strings.Contains(cache, "WB") && !protected:
+			result = append(result, utils.Locale.Get("MegaRAID virtual drive %s caches writes with no healthy battery, data may be lost on power failure", vd))
+		}
+	}
+
+	return result
+}
+
+// checkSsacliCache warns about the Smart Array controllers with a failed
+// cache or battery
+func checkSsacliCache(tool string) []string {
+	return parseSsacliStatus(runTool(tool, "ctrl", "all", "show", "status"))
+}
+
+// parseSsacliStatus parses the ssacli controllers status
+func parseSsacliStatus(output string) []string {
+	result := []string{}
+	ctrl := ""
+
+	for _, curr := range strings.Split(output, "\n") {
+		if strings.TrimSpace(curr) == "" {
+			continue
+		}
+
+		if !strings.HasPrefix(curr, " ") {
+			ctrl = strings.TrimSpace(curr)
+			continue
+		}
+
+		fields := strings.SplitN(strings.TrimSpace(curr), ":", 2)
+		if len(fields) != 2 {
+			continue
+		}
+
+		key, value := strings.TrimSpace(fields[0]), strings.TrimSpace(fields[1])
+		if (key == "Cache Status" || key == "Battery/Capacitor Status") && value != "OK" {
+			result = append(result, fmt.Sprintf("%s %s: %s", ctrl, key, value))
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,128 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package storage
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/log"
+)
+
+const (
+	// sectorSize is the unit of the sysfs block device statistics
+	sectorSize = 512
+
+	// statSectorsWritten is the index of the sectors written field of the
+	// sysfs block device stat file, see Documentation/block/stat.txt
+	statSectorsWritten = 6
+)
+
+var (
+	// sysBlockDir is the sysfs directory holding the block devices
+	sysBlockDir = "/sys/block"
+
+	// preferredSchedulers are the I/O schedulers used for large sequential
+	// writes, the first one supported by the device is selected
+	preferredSchedulers = []string{"mq-deadline", "deadline"}
+)
+
+// DeviceTuning holds the I/O settings changed on a block device so they
+// can be restored once the install completes
+type DeviceTuning struct {
+	name      string
+	scheduler string
+}
+
+// TuneDevice switches the block device I/O scheduler to a deadline scheduler,
+// which favors the large sequential writes of the install, the returned
+// DeviceTuning restores the previous scheduler
+func TuneDevice(bd *BlockDevice) (*DeviceTuning, error) {
+	schedFile := filepath.Join(sysBlockDir, bd.Name, "queue", "scheduler")
+
+	content, err := ioutil.ReadFile(schedFile)
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+
+	current, available := parseSchedulers(string(content))
+	tuning := &DeviceTuning{name: bd.Name, scheduler: current}
+
+	for _, curr := range preferredSchedulers {
+		if curr == current {
+			return tuning, nil
+		}
+
+		for _, sched := range available {
+			if sched != curr {
+				continue
+			}
+
+			if err = ioutil.WriteFile(schedFile, []byte(curr), 0644); err != nil {
+				return nil, errors.Wrap(err)
+			}
+
+			log.Debug("Switched %s I/O scheduler from %s to %s", bd.Name, current, curr)
+			return tuning, nil
+		}
+	}
+
+	log.Debug("No preferred I/O scheduler available for %s: %s", bd.Name, strings.TrimSpace(string(content)))
+	return tuning, nil
+}
+
+// Restore sets back the block device I/O scheduler
+func (dt *DeviceTuning) Restore() error {
+	if dt.scheduler == "" {
+		return nil
+	}
+
+	schedFile := filepath.Join(sysBlockDir, dt.name, "queue", "scheduler")
+	if err := ioutil.WriteFile(schedFile, []byte(dt.scheduler), 0644); err != nil {
+		return errors.Wrap(err)
+	}
+
+	return nil
+}
+
+// parseSchedulers parses the sysfs scheduler file, i.e: "none [mq-deadline] kyber",
+// returning the current scheduler and all the available ones
+func parseSchedulers(content string) (string, []string) {
+	current := ""
+	available := []string{}
+
+	for _, curr := range strings.Fields(content) {
+		if strings.HasPrefix(curr, "[") && strings.HasSuffix(curr, "]") {
+			curr = strings.Trim(curr, "[]")
+			current = curr
+		}
+		available = append(available, curr)
+	}
+
+	return current, available
+}
+
+// BytesWritten returns the number of bytes written to the block device since boot
+func BytesWritten(bd *BlockDevice) (uint64, error) {
+	content, err := ioutil.ReadFile(filepath.Join(sysBlockDir, bd.Name, "stat"))
+	if err != nil {
+		return 0, errors.Wrap(err)
+	}
+
+	fields := strings.Fields(string(content))
+	if len(fields) <= statSectorsWritten {
+		return 0, errors.Errorf("Invalid %s stat file: %q", bd.Name, content)
+	}
+
+	sectors, err := strconv.ParseUint(fields[statSectorsWritten], 10, 64)
+	if err != nil {
+		return 0, errors.Wrap(err)
+	}
+
+	return sectors * sectorSize, nil
+}
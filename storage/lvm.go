@@ -0,0 +1,345 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package storage
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/log"
+	"github.com/clearlinux/clr-installer/progress"
+	"github.com/clearlinux/clr-installer/utils"
+)
+
+const (
+	// LVMPhysicalVolume is the file system type of the partitions used as
+	// LVM physical volumes, their volume group is set in VolumeGroup
+	LVMPhysicalVolume = "LVM2_member"
+
+	// DefaultVolumeGroup is the volume group of the standard LVM partitioning
+	DefaultVolumeGroup = "clearlinux"
+
+	// LVMRequiredBundle the bundle needed if LVM is used
+	LVMRequiredBundle = "storage-utils"
+
+	// lvmGUID is the partition type of the LVM physical volumes
+	lvmGUID = "E6D6D379-F507-44C2-A23C-238F2A3DF928"
+)
+
+var (
+	// lvmNameExp matches the valid volume group and logical volume names
+	lvmNameExp = regexp.MustCompile(`^[a-zA-Z0-9+_.][a-zA-Z0-9+_.-]*$`)
+)
+
+// IsVolumeGroup returns true if bd is a LVM volume group, its children are
+// the logical volumes
+func (bd *BlockDevice) IsVolumeGroup() bool {
+	return bd.Type == BlockDeviceTypeLVM2Group
+}
+
+// IsLogicalVolume returns true if bd is a LVM logical volume
+func (bd *BlockDevice) IsLogicalVolume() bool {
+	return bd.Type == BlockDeviceTypeLVM2Volume
+}
+
+// IsPhysicalVolume returns true if bd is a partition used as LVM physical volume
+func (bd *BlockDevice) IsPhysicalVolume() bool {
+	return bd.FsType == LVMPhysicalVolume && !bd.IsVolumeGroup()
+}
+
+// NewVolumeGroup returns a new empty volume group named name
+func NewVolumeGroup(name string) *BlockDevice {
+	return &BlockDevice{
+		Name:            name,
+		Type:            BlockDeviceTypeLVM2Group,
+		UserDefined:     true,
+		MakePartition:   true,
+		FormatPartition: true,
+	}
+}
+
+// AddLogicalVolume adds a new logical volume to the volume group bd, a size of
+// 0 takes the free space left in the volume group
+func (bd *BlockDevice) AddLogicalVolume(name string, fstype string, mountPoint string, size uint64) *BlockDevice {
+	lv := &BlockDevice{
+		Name:            name,
+		Type:            BlockDeviceTypeLVM2Volume,
+		FsType:          fstype,
+		MountPoint:      mountPoint,
+		Size:            size,
+		UserDefined:     true,
+		MakePartition:   true,
+		FormatPartition: true,
+	}
+
+	bd.AddChild(lv)
+
+	return lv
+}
+
+// PhysicalVolumes returns the partitions of medias used as physical volumes of
+// the volume group vg
+func PhysicalVolumes(medias []*BlockDevice, vg string) []*BlockDevice {
+	result := []*BlockDevice{}
+
+	for _, curr := range medias {
+		for _, ch := range curr.Children {
+			if ch.IsPhysicalVolume() && ch.VolumeGroup == vg {
+				result = append(result, ch)
+			}
+		}
+	}
+
+	return result
+}
+
+// VolumeGroupsUsed returns true if any of the medias is a volume group
+func VolumeGroupsUsed(medias []*BlockDevice) bool {
+	for _, curr := range medias {
+		if curr.IsVolumeGroup() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// LVMKernelArguments returns the kernel arguments activating the volume group
+// of the root logical volume and mounting it, none if the root file system is
+// not on LVM
+func LVMKernelArguments(medias []*BlockDevice) []string {
+	for _, curr := range medias {
+		if !curr.IsVolumeGroup() {
+			continue
+		}
+
+		for _, ch := range curr.Children {
+			if ch.MountPoint == "/" {
+				return []string{
+					"rd.lvm.vg=" + curr.Name,
+					"root=" + filepath.Join("/dev", curr.Name, ch.Name),
+				}
+			}
+		}
+	}
+
+	return []string{}
+}
+
+// LVMStandardPartitions moves the new root partition of disk, as added by the
+// standard partitioning, to a logical volume of the DefaultVolumeGroup; the
+// root partition becomes its physical volume. The volume group is returned and
+// must be added to the target medias.
+func LVMStandardPartitions(disk *BlockDevice) (*BlockDevice, error) {
+	for _, ch := range disk.Children {
+		if !ch.MakePartition || ch.MountPoint != "/" {
+			continue
+		}
+
+		if ch.Type == BlockDeviceTypeCrypt {
+			return nil, errors.Errorf("Encrypted LVM physical volumes are not supported")
+		}
+
+		vg := NewVolumeGroup(DefaultVolumeGroup)
+		vg.AddLogicalVolume("root", ch.FsType, "/", 0)
+
+		ch.FsType = LVMPhysicalVolume
+		ch.MountPoint = ""
+		ch.Label = ""
+		ch.VolumeGroup = vg.Name
+
+		return vg, nil
+	}
+
+	return nil, errors.Errorf("A new root partition is required to use LVM")
+}
+
+// validateVolumeGroup checks the volume group bd and its logical volumes
+func (bd *BlockDevice) validateVolumeGroup() error {
+	if !lvmNameExp.MatchString(bd.Name) {
+		return errors.Errorf("Invalid volume group name: %q", bd.Name)
+	}
+
+	names := map[string]bool{}
+	remaining := false
+
+	for _, ch := range bd.Children {
+		if !ch.IsLogicalVolume() {
+			return errors.Errorf("Volume group %s: %s is not a logical volume", bd.Name, ch.Name)
+		}
+
+		if !lvmNameExp.MatchString(ch.Name) {
+			return errors.Errorf("Volume group %s: invalid logical volume name: %q", bd.Name, ch.Name)
+		}
+
+		if names[ch.Name] {
+			return errors.Errorf("Volume group %s: duplicated logical volume %s", bd.Name, ch.Name)
+		}
+		names[ch.Name] = true
+
+		if _, found := bdOps[ch.FsType]; !found || ch.IsPhysicalVolume() || ch.FsType == "vfat" {
+			return errors.Errorf("Volume group %s: unsupported file system %q for %s",
+				bd.Name, ch.FsType, ch.Name)
+		}
+
+		if ch.MountPoint == "/boot" {
+			return errors.Errorf("Volume group %s: /boot is not supported on a logical volume", bd.Name)
+		}
+
+		if ch.Size == 0 {
+			if remaining {
+				return errors.Errorf("Volume group %s: found more than one logical volume with size 0", bd.Name)
+			}
+			remaining = true
+		}
+	}
+
+	return nil
+}
+
+// ValidateVolumeGroups checks the physical volumes of medias belong to a volume
+// group of medias and vice versa, and that an installation using LVM has the
+// required boot and root file systems
+func ValidateVolumeGroups(medias []*BlockDevice, legacyBios bool) error {
+	groups := map[string]bool{}
+	used := false
+
+	for _, curr := range medias {
+		if curr.IsVolumeGroup() {
+			if len(PhysicalVolumes(medias, curr.Name)) == 0 {
+				return errors.Errorf("Volume group %s has no physical volume", curr.Name)
+			}
+			groups[curr.Name] = true
+			used = true
+		}
+	}
+
+	bootPartition := false
+	rootPartition := false
+
+	for _, curr := range medias {
+		for _, ch := range curr.Children {
+			if ch.IsPhysicalVolume() {
+				if !groups[ch.VolumeGroup] {
+					return errors.Errorf("Physical volume %s: unknown volume group %q", ch.Name, ch.VolumeGroup)
+				}
+
+				if ch.Type == BlockDeviceTypeCrypt {
+					return errors.Errorf("Encrypted LVM physical volumes are not supported")
+				}
+			}
+
+			if ch.FsType == "vfat" && ch.MountPoint == "/boot" {
+				bootPartition = true
+			}
+
+			if ch.MountPoint == "/" {
+				rootPartition = true
+			}
+		}
+	}
+
+	if !used {
+		return nil
+	}
+
+	if !bootPartition && !legacyBios {
+		return errors.Errorf("Could not find a suitable EFI partition")
+	}
+
+	if !rootPartition {
+		return errors.Errorf("Could not find a root partition")
+	}
+
+	return nil
+}
+
+// CreateVolumeGroup creates the volume group bd over its physical volumes in
+// medias, then its logical volumes; the sized ones first, the one of size 0
+// taking the remaining space last. Its progress is created by rep.
+func (bd *BlockDevice) CreateVolumeGroup(medias []*BlockDevice, rep progress.Reporter) error {
+	if !bd.IsVolumeGroup() {
+		return errors.Errorf("%s is not a volume group", bd.Name)
+	}
+
+	msg := utils.Locale.Get("Creating the volume group: %s", bd.Name)
+	prg := rep.NewLoop("%s", msg)
+	log.Info(msg)
+
+	args := []string{"vgcreate", "--yes", bd.Name}
+	for _, pv := range PhysicalVolumes(medias, bd.Name) {
+		args = append(args, pv.GetDeviceFile())
+	}
+
+	if err := bd.runAndLog(args...); err != nil {
+		prg.Failure()
+		return errors.Wrap(err)
+	}
+
+	volumes := []*BlockDevice{}
+	for _, ch := range bd.Children {
+		if ch.Size > 0 {
+			volumes = append(volumes, ch)
+		}
+	}
+	for _, ch := range bd.Children {
+		if ch.Size == 0 {
+			volumes = append(volumes, ch)
+		}
+	}
+
+	for _, lv := range volumes {
+		size := []string{"--extents", "100%FREE"}
+		if lv.Size > 0 {
+			size = []string{"--size", fmt.Sprintf("%db", lv.Size)}
+		}
+
+		args = []string{"lvcreate", "--yes", "--wipesignatures", "y", "--name", lv.Name}
+		args = append(args, size...)
+		args = append(args, bd.Name)
+
+		if err := bd.runAndLog(args...); err != nil {
+			prg.Failure()
+			return errors.Wrap(err)
+		}
+
+		lv.MappedName = filepath.Join(bd.Name, lv.Name)
+	}
+
+	prg.Success()
+
+	return nil
+}
+
+// ActivateVolumeGroup activates the already created volume group and maps
+// its logical volumes, i.e when a partitioned install is resumed
+func (bd *BlockDevice) ActivateVolumeGroup() error {
+	if !bd.IsVolumeGroup() {
+		return errors.Errorf("%s is not a volume group", bd.Name)
+	}
+
+	if err := bd.runAndLog("vgchange", "--activate", "y", bd.Name); err != nil {
+		return errors.Wrap(err)
+	}
+
+	for _, lv := range bd.Children {
+		lv.MappedName = filepath.Join(bd.Name, lv.Name)
+	}
+
+	return nil
+}
+
+// physicalVolumeMakeFsCommand initializes the partition as a LVM physical volume
+func physicalVolumeMakeFsCommand(bd *BlockDevice, args []string) ([]string, error) {
+	return append([]string{"pvcreate"}, args...), nil
+}
+
+// physicalVolumeMakePartCommand names the partition after its volume group
+func physicalVolumeMakePartCommand(bd *BlockDevice) (string, error) {
+	return strings.Join([]string{"mkpart", "lvm-" + bd.VolumeGroup}, " "), nil
+}
@@ -13,8 +13,8 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
-	"time"
 
 	"github.com/clearlinux/clr-installer/cmd"
 	"github.com/clearlinux/clr-installer/errors"
@@ -38,6 +38,9 @@ var (
 		"xfs":   {commonMakeFsCommand, []string{"-f"}, commonMakePartCommand},
 		"swap":  {swapMakeFsCommand, []string{}, swapMakePartCommand},
 		"vfat":  {commonMakeFsCommand, []string{"-F32"}, vfatMakePartCommand},
+
+		LVMPhysicalVolume: {physicalVolumeMakeFsCommand, []string{"-ff", "--yes"}, physicalVolumeMakePartCommand},
+		RAIDMember:        {raidMemberMakeFsCommand, []string{"--all"}, raidMemberMakePartCommand},
 	}
 
 	guidMap = map[string]string{
@@ -46,10 +49,17 @@ var (
 		"/srv":  "3B8F8425-20E0-4F3B-907F-1A25A76F98E8",
 		"swap":  "0657FD6D-A4AB-43C4-84E5-0933C84B4F4F",
 		"efi":   "C12A7328-F81F-11D2-BA4B-00A0C93EC93B",
+
+		LVMPhysicalVolume: lvmGUID,
+		RAIDMember:        raidGUID,
 	}
 
 	mountedPoints   []string
 	mountedEncrypts []string
+
+	// mountedMutex guards mountedPoints and mountedEncrypts, partitions
+	// may be mapped and mounted concurrently
+	mountedMutex sync.Mutex
 )
 
 // MakeFs runs mkfs.* commands for a BlockDevice definition
@@ -60,7 +70,11 @@ func (bd *BlockDevice) MakeFs() error {
 
 	if op, ok := bdOps[bd.FsType]; ok {
 		if cmd, err := op.makeFsCommand(bd, op.makeFsArgs); err == nil {
-			return makeFs(bd, cmd)
+			if err = makeFs(bd, cmd); err != nil {
+				return err
+			}
+
+			return bd.createSubvolumes()
 		}
 	}
 
@@ -74,7 +88,7 @@ func makeFs(bd *BlockDevice, args []string) error {
 
 	args = append(args, bd.GetMappedDeviceFile())
 
-	err := cmd.RunAndLog(args...)
+	err := bd.runAndLog(args...)
 	if err != nil {
 		return errors.Wrap(err)
 	}
@@ -102,6 +116,18 @@ func (bd *BlockDevice) getGUID() (string, error) {
 	return "none", errors.Errorf("Could not determine the guid for: %s", bd.Name)
 }
 
+// isBootDisk tells if bd holds the root or the EFI partition, systemd only
+// discovers the standard partitions of the disk the system boots from
+func (bd *BlockDevice) isBootDisk() bool {
+	for _, ch := range bd.Children {
+		if ch.MountPoint == "/" || (ch.FsType == "vfat" && ch.MountPoint == "/boot") {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (bd *BlockDevice) isStandardMount() bool {
 	standard := false
 
@@ -126,8 +152,17 @@ func (bd *BlockDevice) Mount(root string) error {
 	}
 
 	targetPath := filepath.Join(root, bd.MountPoint)
+	options := bd.getMountOptions()
+
+	if sv := bd.mainSubvolume(); sv != nil {
+		options = bd.subvolumeMountOptions(sv)
+	}
+
+	if err := mountFs(bd.GetMappedDeviceFile(), targetPath, bd.FsType, syscall.MS_RELATIME, options); err != nil {
+		return err
+	}
 
-	return mountFs(bd.GetMappedDeviceFile(), targetPath, bd.FsType, syscall.MS_RELATIME)
+	return bd.mountSubvolumes(root)
 }
 
 // UmountAll unmounts all previously mounted devices
@@ -189,25 +224,26 @@ func getStartEndMB(start uint64, end uint64) string {
 	return strStart + " " + strEnd
 }
 
-// WritePartitionLabel make a device a 'gpt' partition type
-// Only call when we are wiping and reusing the entire disk
-func (bd *BlockDevice) WritePartitionLabel() error {
-	if bd.Type != BlockDeviceTypeDisk && bd.Type != BlockDeviceTypeLoop {
+// WritePartitionLabel make a device a 'gpt' partition type, or 'msdos' if its
+// MBR partition table is kept. Only call when we are wiping and reusing the
+// entire disk. Its progress is created by rep.
+func (bd *BlockDevice) WritePartitionLabel(rep progress.Reporter) error {
+	if bd.Type != BlockDeviceTypeDisk && bd.Type != BlockDeviceTypeLoop && bd.Type != BlockDeviceTypeRAID {
 		return errors.Errorf("Type is partition, disk required")
 	}
 
 	mesg := utils.Locale.Get("Writing partition table to: %s", bd.Name)
-	prg := progress.NewLoop(mesg)
+	prg := rep.NewLoop("%s", mesg)
 	log.Info(mesg)
 	args := []string{
 		"parted",
 		"-s",
 		bd.GetDeviceFile(),
 		"mklabel",
-		"gpt",
+		bd.partitionLabel(),
 	}
 
-	err := cmd.RunAndLog(args...)
+	err := bd.runAndLog(args...)
 	if err != nil {
 		return errors.Wrap(err)
 	}
@@ -217,15 +253,16 @@ func (bd *BlockDevice) WritePartitionLabel() error {
 	return nil
 }
 
-// WritePartitionTable writes the defined partitions to the actual block device
-func (bd *BlockDevice) WritePartitionTable(legacyBios bool, wholeDisk bool) error {
-	if bd.Type != BlockDeviceTypeDisk && bd.Type != BlockDeviceTypeLoop {
+// WritePartitionTable writes the defined partitions to the actual block device,
+// its progress is created by rep
+func (bd *BlockDevice) WritePartitionTable(legacyBios bool, wholeDisk bool, rep progress.Reporter) error {
+	if bd.Type != BlockDeviceTypeDisk && bd.Type != BlockDeviceTypeLoop && bd.Type != BlockDeviceTypeRAID {
 		return errors.Errorf("Type is partition, disk required")
 	}
 
 	//write the partition label
 	if wholeDisk {
-		if err := bd.WritePartitionLabel(); err != nil {
+		if err := bd.WritePartitionLabel(rep); err != nil {
 			return err
 		}
 	} else {
@@ -233,13 +270,23 @@ func (bd *BlockDevice) WritePartitionTable(legacyBios bool, wholeDisk bool) erro
 	}
 
 	mesg := utils.Locale.Get("Updating partition table for: %s", bd.Name)
-	prg := progress.NewLoop(mesg)
+	prg := rep.NewLoop("%s", mesg)
 	log.Info(mesg)
 
 	var err error
 	var start uint64
 	maxFound := false
 
+	// Shrink the existing partitions making room for the new ones
+	for _, curr := range bd.Children {
+		if curr.Resize && !curr.MakePartition {
+			if err = bd.shrinkPartition(curr); err != nil {
+				prg.Failure()
+				return err
+			}
+		}
+	}
+
 	// First remove any user removed partitions
 	log.Debug("WritePartitionTable: remove partitions : %v", bd.removedParts)
 	if len(bd.removedParts) > 0 {
@@ -255,7 +302,7 @@ func (bd *BlockDevice) WritePartitionTable(legacyBios bool, wholeDisk bool) erro
 		for _, curr := range bd.removedParts {
 			rmArgs = append(rmArgs, fmt.Sprintf("rm %d", curr))
 		}
-		err = cmd.RunAndLog(rmArgs...)
+		err = bd.runAndLog(rmArgs...)
 		if err != nil {
 			log.Warning("Failed to remove existing partition: %v (%s)", bd.removedParts, err)
 		}
@@ -295,6 +342,11 @@ func (bd *BlockDevice) WritePartitionTable(legacyBios bool, wholeDisk bool) erro
 			return err
 		}
 
+		// the MBR partitions are primary ones, not named
+		if bd.IsMBR() {
+			mkPart = mbrMakePartCommand(curr)
+		}
+
 		size := uint64(curr.Size)
 		end := start + size
 		if !wholeDisk {
@@ -319,7 +371,7 @@ func (bd *BlockDevice) WritePartitionTable(legacyBios bool, wholeDisk bool) erro
 
 			args := append(baseArgs, mkPartCmd)
 
-			err = cmd.RunAndLog(args...)
+			err = bd.runAndLog(args...)
 
 			if err == nil || retries == 0 {
 				break
@@ -355,13 +407,13 @@ func (bd *BlockDevice) WritePartitionTable(legacyBios bool, wholeDisk bool) erro
 		// We have a /boot partition, use this
 		if curr.MountPoint == "/boot" {
 			bootPartition = curr.partition
-			if legacyBios {
+			if legacyBios && !bd.IsMBR() {
 				bootStyle = "legacy_boot"
 			}
 		}
 
-		// Only set GUIDs on newly created partitions
-		if !curr.MakePartition {
+		// Only set GUIDs on newly created GPT partitions
+		if !curr.MakePartition || bd.IsMBR() {
 			continue
 		}
 
@@ -379,7 +431,7 @@ func (bd *BlockDevice) WritePartitionTable(legacyBios bool, wholeDisk bool) erro
 	prg.Success()
 
 	msg := utils.Locale.Get("Adjusting filesystem configurations")
-	prg = progress.MultiStep(len(guids), msg)
+	prg = rep.MultiStep(len(guids), "%s", msg)
 	log.Info(msg)
 	cnt := 1
 	for idx, guid := range guids {
@@ -393,7 +445,7 @@ func (bd *BlockDevice) WritePartitionTable(legacyBios bool, wholeDisk bool) erro
 			fmt.Sprintf("--typecode=%d:%s", idx, guid),
 		}
 
-		err = cmd.RunAndLog(args...)
+		err = bd.runAndLog(args...)
 		if err != nil {
 			return errors.Wrap(err)
 		}
@@ -415,6 +467,9 @@ func (bd *BlockDevice) WritePartitionTable(legacyBios bool, wholeDisk bool) erro
 			if legacyBios && bootPartition == 0 {
 				bootPartition = curr.partition
 				bootStyle = "legacy_boot"
+				if bd.IsMBR() {
+					bootStyle = "boot"
+				}
 			}
 		}
 	}
@@ -426,7 +481,7 @@ func (bd *BlockDevice) WritePartitionTable(legacyBios bool, wholeDisk bool) erro
 			fmt.Sprintf("set %d %s on", bootPartition, bootStyle),
 		}
 
-		err = cmd.RunAndLog(args...)
+		err = bd.runAndLog(args...)
 		if err != nil {
 			return errors.Wrap(err)
 		}
@@ -437,7 +492,10 @@ func (bd *BlockDevice) WritePartitionTable(legacyBios bool, wholeDisk bool) erro
 		return err
 	}
 
-	time.Sleep(time.Duration(4) * time.Second)
+	if err = bd.WaitForPartitions(DeviceWaitTimeout); err != nil {
+		prg.Failure()
+		return err
+	}
 
 	prg.Success()
 
@@ -866,7 +924,7 @@ func MountMetaFs(rootDir string) error {
 	return nil
 }
 
-func mountFs(device string, mPointPath string, fsType string, flags uintptr) error {
+func mountFs(device string, mPointPath string, fsType string, flags uintptr, data string) error {
 	var err error
 
 	if _, err = os.Stat(mPointPath); os.IsNotExist(err) {
@@ -875,12 +933,14 @@ func mountFs(device string, mPointPath string, fsType string, flags uintptr) err
 		}
 	}
 
-	if err = syscall.Mount(device, mPointPath, fsType, flags, ""); err != nil {
+	if err = syscall.Mount(device, mPointPath, fsType, flags, data); err != nil {
 		return errors.Errorf("mount %s %s %s: %v", device, mPointPath, fsType, err)
 	}
 	log.Debug("Mounted ok: %s", mPointPath)
 	// Store the mount point for later unmounting
+	mountedMutex.Lock()
 	mountedPoints = append(mountedPoints, mPointPath)
+	mountedMutex.Unlock()
 
 	return err
 }
@@ -888,19 +948,19 @@ func mountFs(device string, mPointPath string, fsType string, flags uintptr) err
 func mountDevFs(rootDir string) error {
 	mPointPath := filepath.Join(rootDir, "dev")
 
-	return mountFs("/dev", mPointPath, "devtmpfs", syscall.MS_BIND)
+	return mountFs("/dev", mPointPath, "devtmpfs", syscall.MS_BIND, "")
 }
 
 func mountSysFs(rootDir string) error {
 	mPointPath := filepath.Join(rootDir, "sys")
 
-	return mountFs("/sys", mPointPath, "sysfs", syscall.MS_BIND)
+	return mountFs("/sys", mPointPath, "sysfs", syscall.MS_BIND, "")
 }
 
 func mountProcFs(rootDir string) error {
 	mPointPath := filepath.Join(rootDir, "proc")
 
-	return mountFs("/proc", mPointPath, "proc", syscall.MS_BIND)
+	return mountFs("/proc", mPointPath, "proc", syscall.MS_BIND, "")
 }
 
 func getMakeFsLabel(bd *BlockDevice) []string {
@@ -927,6 +987,23 @@ func getMakeFsLabel(bd *BlockDevice) []string {
 	return label
 }
 
+// getMakeFsUUID returns the mkfs.* arguments to set the file system uuid set by
+// the user, the current uuid of the partition is never reused
+func getMakeFsUUID(bd *BlockDevice) []string {
+	if bd.NewUUID == "" {
+		return []string{}
+	}
+
+	switch bd.FsType {
+	case "xfs":
+		return []string{"-m", "uuid=" + bd.NewUUID}
+	case "vfat":
+		return []string{"-i", strings.Replace(bd.NewUUID, "-", "", -1)}
+	}
+
+	return []string{"-U", bd.NewUUID}
+}
+
 func commonMakeFsCommand(bd *BlockDevice, args []string) ([]string, error) {
 	cmd := []string{
 		fmt.Sprintf("mkfs.%s", bd.FsType),
@@ -937,6 +1014,8 @@ func commonMakeFsCommand(bd *BlockDevice, args []string) ([]string, error) {
 		cmd = append(cmd, label...)
 	}
 
+	cmd = append(cmd, getMakeFsUUID(bd)...)
+
 	cmd = append(cmd, args...)
 
 	return cmd, nil
@@ -958,7 +1037,7 @@ func makeEncryptedSwap(bd *BlockDevice) error {
 		bd.GetDeviceFile(),
 	}
 
-	err := cmd.RunAndLog(args...)
+	err := bd.runAndLog(args...)
 	if err != nil {
 		return errors.Wrap(err)
 	}
@@ -971,7 +1050,7 @@ func makeEncryptedSwap(bd *BlockDevice) error {
 		"1M",
 	}
 
-	err = cmd.RunAndLog(args...)
+	err = bd.runAndLog(args...)
 	if err != nil {
 		return errors.Wrap(err)
 	}
@@ -998,6 +1077,7 @@ func swapMakeFsCommand(bd *BlockDevice, args []string) ([]string, error) {
 			cmd = append(cmd, label...)
 		}
 
+		cmd = append(cmd, getMakeFsUUID(bd)...)
 		cmd = append(cmd, args...)
 	}
 
@@ -1098,11 +1178,19 @@ func GenerateTabFiles(rootDir string, medias []*BlockDevice) error {
 	var errFound bool
 
 	for _, curr := range medias {
+		// only the standard partitions of the boot disk are auto-mounted
+		bootDisk := curr.isBootDisk()
+
 		for _, ch := range curr.Children {
 			// Handle Encrypted partitions
 			var ctab []string
 			var ftab []string
 
+			// the subvolumes are mounted from the fstab, only the root
+			// one is auto-mounted with the rootflags kernel argument
+			autoMounted := ch.isStandardMount() && bootDisk &&
+				(len(ch.Subvolumes) == 0 || ch.MountPoint == "/")
+
 			if ch.Type == BlockDeviceTypeCrypt {
 				if ch.FsType == "swap" {
 					ctab = append(ctab, filepath.Base(ch.MappedName), ch.GetDeviceID(),
@@ -1113,19 +1201,80 @@ func GenerateTabFiles(rootDir string, medias []*BlockDevice) error {
 					ftab = append(ftab, ch.GetMappedDeviceFile(), "none",
 						"swap", "defaults", "0", "0")
 				} else {
-					if !ch.isStandardMount() {
+					if !autoMounted {
+						options := "defaults"
+						ctabOptions := []string{}
 						ctab = append(ctab, filepath.Base(ch.MappedName), ch.GetDeviceID())
+
+						// allow the discards through the LUKS container
+						if ch.Discard {
+							ctabOptions = append(ctabOptions, DiscardMountOption)
+							options = options + "," + DiscardMountOption
+						}
+
+						if ch.tpmUnlock {
+							ctabOptions = append(ctabOptions, tpmCrypttabOption)
+						}
+
+						if len(ctabOptions) > 0 {
+							ctab = append(ctab, "none", strings.Join(ctabOptions, ","))
+						}
+
 						ftab = append(ftab, ch.GetMappedDeviceFile(), ch.MountPoint,
-							ch.FsType, "defaults", "0", "2")
+							ch.FsType, options, "0", "2")
+					}
+				}
+			} else if ch.IsLogicalVolume() || curr.IsRAIDArray() {
+				// the logical volumes and RAID array partitions are not
+				// auto-mounted, the root is set by the kernel command line
+				if ch.FsType == "swap" {
+					ftab = append(ftab, ch.GetMappedDeviceFile(), "none",
+						"swap", "defaults", "0", "0")
+				} else if ch.MountPoint != "" && (ch.MountPoint != "/" || ch.Discard) {
+					options := "defaults"
+					if mountOptions := ch.getMountOptions(); mountOptions != "" {
+						options = options + "," + mountOptions
 					}
+
+					ftab = append(ftab, ch.GetMappedDeviceFile(), ch.MountPoint,
+						ch.FsType, options, "0", "2")
 				}
+			} else if (curr.IsMBR() || !bootDisk) && ch.FsType == "swap" {
+				ftab = append(ftab, ch.GetDeviceID(), "none",
+					"swap", "defaults", "0", "0")
 			} else {
-				if !ch.isStandardMount() && ch.MountPoint != "" {
+				// the MBR partitions are not auto-mounted from their
+				// partition type, the root is found by the boot loader
+				autoMounted = autoMounted && !curr.IsMBR()
+				inFstab := !autoMounted && ch.MountPoint != "/"
+
+				// the auto-mounted partitions have no mount options,
+				// a fstab entry sets their discard
+				if ch.Discard {
+					inFstab = true
+				}
+
+				if inFstab && ch.MountPoint != "" {
+					options := "defaults"
+					if mountOptions := ch.getMountOptions(); mountOptions != "" {
+						options = options + "," + mountOptions
+					}
+
 					ftab = append(ftab, ch.GetDeviceID(), ch.MountPoint,
-						ch.FsType, "defaults", "0", "2")
+						ch.FsType, options, "0", "2")
 				}
 			}
 
+			if len(ch.Subvolumes) > 0 {
+				device := ch.GetDeviceID()
+				if ch.Type == BlockDeviceTypeCrypt || ch.IsLogicalVolume() || curr.IsRAIDArray() {
+					device = ch.GetMappedDeviceFile()
+				}
+
+				ftab = nil
+				fstab = append(fstab, ch.subvolumeTabEntries(device)...)
+			}
+
 			if len(ctab) > 0 {
 				crypttab = append(crypttab, strings.Join(ctab, " "))
 			}
@@ -1185,6 +1334,21 @@ type InstallTarget struct {
 	Advanced  bool   // Was this disk configured via advanced mode?
 	FreeStart uint64 // Starting position of free space
 	FreeEnd   uint64 // Ending position of free space
+
+	// Signatures describes the existing LUKS, LVM and RAID signatures
+	// which must be wiped before the disk is erased
+	Signatures []string
+
+	// LegacyTable is the existing MBR or hybrid partition table of the
+	// disk, see PartitionTableWarnings()
+	LegacyTable string
+
+	// Shrink is the name of the existing partition shrunk to make room for
+	// the install, ShrinkMinimum its smallest size and OS the operating
+	// system installed to it, see FindShrinkInstallTargets()
+	Shrink        string
+	ShrinkMinimum uint64
+	OS            string
 }
 
 const (
@@ -1239,6 +1403,13 @@ func FindSafeInstallTargets(minSize uint64, medias []*BlockDevice) []InstallTarg
 			continue
 		}
 
+		// Never silently reuse a whole disk LUKS, LVM or RAID member
+		if curr.hasDiskStackSignature() {
+			log.Debug("FindSafeInstallTargets(): ignoring disk %s with a %s signature",
+				curr.Name, curr.FsType)
+			continue
+		}
+
 		if curr.Children != nil && len(curr.Children) > 125 {
 			log.Debug("FindSafeInstallTargets(): ignoring disk %s with too many partitions (%d)",
 				curr.Name, len(curr.Children))
@@ -1248,7 +1419,7 @@ func FindSafeInstallTargets(minSize uint64, medias []*BlockDevice) []InstallTarg
 		if curr.Children == nil || len(curr.Children) == 0 {
 			// No partition type and no children we write the whole disk
 			installTargets = append(installTargets,
-				InstallTarget{Name: curr.Name, Friendly: curr.Model,
+				InstallTarget{Name: curr.Name, Friendly: curr.FriendlyModel(),
 					WholeDisk: true, Removable: curr.RemovableDevice,
 					FreeStart: 0, FreeEnd: curr.Size})
 			log.Debug("FindSafeInstallTargets(): found whole disk %s", curr.Name)
@@ -1257,8 +1428,9 @@ func FindSafeInstallTargets(minSize uint64, medias []*BlockDevice) []InstallTarg
 
 		if start, end := curr.LargestContiguousFreeSpace(minSize); start != 0 && end != 0 {
 			installTargets = append(installTargets,
-				InstallTarget{Name: curr.Name, Friendly: curr.Model,
-					Removable: curr.RemovableDevice, FreeStart: start, FreeEnd: end})
+				InstallTarget{Name: curr.Name, Friendly: curr.FriendlyModel(),
+					Removable: curr.RemovableDevice, FreeStart: start, FreeEnd: end,
+					LegacyTable: curr.legacyPartitionTable()})
 			log.Debug("FindSafeInstallTargets(): Room on disk %s: %d to %d", curr.Name, start, end)
 			continue
 		}
@@ -1273,9 +1445,10 @@ func FindAllInstallTargets(medias []*BlockDevice) []InstallTarget {
 
 	// All Disk are possible destructive installs
 	for _, curr := range medias {
-		target := InstallTarget{Name: curr.Name, Friendly: curr.Model,
+		target := InstallTarget{Name: curr.Name, Friendly: curr.FriendlyModel(),
 			WholeDisk: true, Removable: curr.RemovableDevice, EraseDisk: true,
-			FreeStart: 0, FreeEnd: curr.Size}
+			FreeStart: 0, FreeEnd: curr.Size, Signatures: curr.StackSignatureNames(),
+			LegacyTable: curr.legacyPartitionTable()}
 
 		installTargets = append(installTargets, target)
 	}
@@ -1295,7 +1468,7 @@ func FindModifyInstallTargets(medias []*BlockDevice) []InstallTarget {
 			continue
 		}
 
-		target := InstallTarget{Name: curr.Name, Friendly: curr.Model,
+		target := InstallTarget{Name: curr.Name, Friendly: curr.FriendlyModel(),
 			WholeDisk: true, Removable: curr.RemovableDevice, EraseDisk: true,
 			FreeStart: 0, FreeEnd: curr.Size}
 
@@ -1315,6 +1488,9 @@ func FormatInstallPortion(target InstallTarget) string {
 	if target.EraseDisk {
 		portion = utils.Locale.Get("Erase Disk")
 	}
+	if target.Shrink != "" {
+		portion = utils.Locale.Get("Shrink")
+	}
 	if target.Advanced {
 		portion = utils.Locale.Get("Advanced")
 	}
@@ -0,0 +1,80 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package storage
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/clearlinux/clr-installer/utils"
+)
+
+const (
+	// PersistentMemoryModel is the model of the persistent memory namespaces,
+	// the pmem driver doesn't report any
+	PersistentMemoryModel = "Persistent Memory"
+
+	// DAXMountOption is the mount option enabling the direct access to the
+	// persistent memory, bypassing the page cache
+	DAXMountOption = "dax"
+
+	// DAXKernelArgument mounts the root file system with direct access, the
+	// root partition is auto-mounted and has no fstab entry
+	DAXKernelArgument = "rootflags=dax"
+)
+
+var (
+	// pmemExp matches the namespaces in fsdax mode, the sector mode ones
+	// (i.e pmem0s) are regular block devices with no direct access
+	pmemExp = regexp.MustCompile(`^pmem[0-9]+(\.[0-9]+)?$`)
+
+	// daxFileSystems are the file systems supporting the direct access
+	daxFileSystems = []string{"ext4", "xfs"}
+)
+
+// IsPersistentMemory returns true if bd is, or is a partition of, a persistent
+// memory namespace in fsdax mode
+func (bd *BlockDevice) IsPersistentMemory() bool {
+	disk := bd
+	if bd.Parent != nil {
+		disk = bd.Parent
+	}
+
+	return pmemExp.MatchString(disk.Name)
+}
+
+// SupportsDAX returns true if bd can be mounted with direct access
+func (bd *BlockDevice) SupportsDAX() bool {
+	return bd.IsPersistentMemory() && utils.StringSliceContains(daxFileSystems, bd.FsType)
+}
+
+// getMountOptions returns the file system specific mount options of bd
+func (bd *BlockDevice) getMountOptions() string {
+	options := []string{}
+
+	if bd.SupportsDAX() {
+		options = append(options, DAXMountOption)
+	}
+
+	if bd.Discard {
+		options = append(options, DiscardMountOption)
+	}
+
+	return strings.Join(options, ",")
+}
+
+// PersistentMemoryRoot returns true if the root partition of medias is on
+// persistent memory and has to be mounted with direct access
+func PersistentMemoryRoot(medias []*BlockDevice) bool {
+	for _, curr := range medias {
+		for _, ch := range curr.Children {
+			if ch.MountPoint == "/" && ch.SupportsDAX() {
+				return true
+			}
+		}
+	}
+
+	return false
+}
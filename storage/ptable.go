@@ -0,0 +1,238 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package storage
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/log"
+)
+
+const (
+	// PartitionTableGPT is the lsblk type of the GPT partition tables
+	PartitionTableGPT = "gpt"
+
+	// PartitionTableMBR is the lsblk type of the MBR, or msdos, partition tables
+	PartitionTableMBR = "dos"
+
+	// PartitionTableHybrid describes a GPT partition table whose protective
+	// MBR also maps some of the partitions, it's never reported by lsblk
+	PartitionTableHybrid = "hybrid"
+
+	// PartitionTablePolicyConvert writes a new GPT partition table to the
+	// erased MBR disks and drops the MBR entries of the hybrid ones
+	PartitionTablePolicyConvert = "convert"
+
+	// PartitionTablePolicyPreserve keeps the MBR partition table of the
+	// erased disks, for the legacy BIOS installs only
+	PartitionTablePolicyPreserve = "preserve"
+
+	// mbrMaxPartitions is the number of primary partitions of a MBR
+	mbrMaxPartitions = 4
+
+	// mbrSize is the size of the MBR, the first sector of the disk
+	mbrSize = 512
+
+	// mbrEntriesOffset is where the 4 partition entries of 16 bytes start
+	mbrEntriesOffset = 446
+
+	// mbrProtectiveType is the MBR partition type covering a GPT disk
+	mbrProtectiveType = 0xee
+)
+
+// PartitionTablePolicies is the list of the supported partition table policies
+var PartitionTablePolicies = []string{PartitionTablePolicyConvert, PartitionTablePolicyPreserve}
+
+// IsMBR returns true if bd has, or will be written with, a MBR partition table
+func (bd *BlockDevice) IsMBR() bool {
+	return bd.PtType == PartitionTableMBR
+}
+
+// parseMBRTypes returns the types of the used partition entries of the mbr
+// sector, an error if it has no boot signature
+func parseMBRTypes(mbr []byte) ([]byte, error) {
+	if len(mbr) < mbrSize || mbr[mbrSize-2] != 0x55 || mbr[mbrSize-1] != 0xaa {
+		return nil, errors.Errorf("Invalid MBR signature")
+	}
+
+	result := []byte{}
+	for i := 0; i < mbrMaxPartitions; i++ {
+		if ptype := mbr[mbrEntriesOffset+i*16+4]; ptype != 0 {
+			result = append(result, ptype)
+		}
+	}
+
+	return result, nil
+}
+
+// isHybridMBR returns true if the MBR types map other partitions next to
+// the protective one
+func isHybridMBR(types []byte) bool {
+	protective := false
+
+	for _, curr := range types {
+		if curr == mbrProtectiveType {
+			protective = true
+		}
+	}
+
+	return protective && len(types) > 1
+}
+
+// IsHybridMBR returns true if bd is a GPT disk with a hybrid MBR, its MBR
+// entries are dropped when the partition table is written
+func (bd *BlockDevice) IsHybridMBR() bool {
+	if bd.PtType != PartitionTableGPT {
+		return false
+	}
+
+	f, err := os.Open(bd.GetDeviceFile())
+	if err != nil {
+		log.Debug("Could not read the MBR of %s: %s", bd.Name, err)
+		return false
+	}
+	defer func() { _ = f.Close() }()
+
+	mbr := make([]byte, mbrSize)
+	if _, err = io.ReadFull(f, mbr); err != nil {
+		log.Debug("Could not read the MBR of %s: %s", bd.Name, err)
+		return false
+	}
+
+	types, err := parseMBRTypes(mbr)
+	if err != nil {
+		return false
+	}
+
+	return isHybridMBR(types)
+}
+
+// legacyPartitionTable returns PartitionTableMBR or PartitionTableHybrid if bd
+// has such a partition table, an empty string otherwise
+func (bd *BlockDevice) legacyPartitionTable() string {
+	if bd.IsMBR() {
+		return PartitionTableMBR
+	}
+
+	if bd.IsHybridMBR() {
+		return PartitionTableHybrid
+	}
+
+	return ""
+}
+
+// PartitionTableWarnings describes what happens to the MBR or hybrid partition
+// table of target following policy, none if it has a GPT one
+func PartitionTableWarnings(target InstallTarget, policy string, legacyBios bool) []string {
+	result := []string{}
+
+	switch target.LegacyTable {
+	case PartitionTableMBR:
+		if policy == PartitionTablePolicyPreserve {
+			result = append(result, fmt.Sprintf("%s keeps its MBR partition table, limited to %d partitions",
+				target.Name, mbrMaxPartitions))
+			break
+		}
+
+		result = append(result, fmt.Sprintf("%s has a MBR partition table, it is converted to GPT", target.Name))
+		if legacyBios {
+			result = append(result, "Some BIOS firmwares do not boot from GPT disks, the MBR partition table can be kept")
+		}
+	case PartitionTableHybrid:
+		result = append(result, fmt.Sprintf("%s has a hybrid GPT/MBR partition table, its MBR entries are dropped", target.Name))
+		result = append(result, "The operating systems booting from them in BIOS mode will no longer boot")
+	}
+
+	return result
+}
+
+// ValidatePartitionTablePolicy checks policy is supported by medias: a MBR
+// partition table is only kept for legacy BIOS installs without encryption, its
+// partitions are not auto-mounted, and has up to 4 partitions
+func ValidatePartitionTablePolicy(medias []*BlockDevice, policy string, legacyBios bool) error {
+	if policy != PartitionTablePolicyPreserve {
+		return nil
+	}
+
+	if !legacyBios {
+		return errors.Errorf("The MBR partition table can only be kept for legacy BIOS installs")
+	}
+
+	for _, curr := range medias {
+		if curr.IsVolumeGroup() || curr.IsRAIDArray() {
+			continue
+		}
+
+		if len(curr.Children) > mbrMaxPartitions {
+			return errors.Errorf("%s: a MBR partition table has at most %d partitions", curr.Name, mbrMaxPartitions)
+		}
+
+		for _, ch := range curr.Children {
+			if ch.Type == BlockDeviceTypeCrypt {
+				return errors.Errorf("%s: encryption is not supported with a MBR partition table", curr.Name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// PlanPartitionTables sets the partition table type of the target medias from
+// their current devices: the erased disks get a GPT partition table unless
+// policy preserves their MBR one. The MBR and hybrid disks are only erased or
+// modified if a policy was explicitly chosen.
+func PlanPartitionTables(medias []*BlockDevice, current []*BlockDevice, wholeDisk bool, policy string) error {
+	for _, media := range medias {
+		disk := findCurrentDisk(media, current)
+		if disk == nil || media.IsVolumeGroup() || media.IsRAIDArray() {
+			continue
+		}
+
+		legacy := disk.legacyPartitionTable()
+		if legacy != "" && policy == "" {
+			return errors.Errorf("%s has a %s partition table, choose a partition table policy: %s",
+				disk.Name, legacy, strings.Join(PartitionTablePolicies, ", "))
+		}
+
+		media.PtType = disk.PtType
+		if wholeDisk && !(disk.IsMBR() && policy == PartitionTablePolicyPreserve) {
+			media.PtType = PartitionTableGPT
+		}
+
+		if legacy != "" {
+			log.Info("%s has a %s partition table, writing a %s one", disk.Name, legacy, media.partitionLabel())
+		}
+	}
+
+	return nil
+}
+
+// partitionLabel returns the parted label of bd's partition table
+func (bd *BlockDevice) partitionLabel() string {
+	if bd.IsMBR() {
+		return "msdos"
+	}
+
+	return "gpt"
+}
+
+// mbrMakePartCommand returns the parted command creating the primary MBR
+// partition of bd, they have no name
+func mbrMakePartCommand(bd *BlockDevice) string {
+	args := []string{"mkpart", "primary"}
+
+	switch bd.FsType {
+	case "swap":
+		args = append(args, "linux-swap")
+	case "vfat":
+		args = append(args, "fat32")
+	}
+
+	return strings.Join(args, " ")
+}
@@ -0,0 +1,455 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/clearlinux/clr-installer/cmd"
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/log"
+	"github.com/clearlinux/clr-installer/progress"
+	"github.com/clearlinux/clr-installer/utils"
+)
+
+const (
+	// RAIDMember is the file system type of the partitions used as members
+	// of a software RAID array, the array lists them in Members
+	RAIDMember = "linux_raid_member"
+
+	// DefaultRAIDArray is the array of the mirrored standard partitioning
+	DefaultRAIDArray = "md0"
+
+	// DefaultRAIDMetadata is the mdadm superblock format of the new arrays
+	DefaultRAIDMetadata = "1.2"
+
+	// RAIDRequiredBundle the bundle needed if a RAID array is used
+	RAIDRequiredBundle = "storage-utils"
+
+	// RAIDConfFile is the mdadm configuration file, relative to the system
+	// root, describing the arrays to assemble
+	RAIDConfFile = "etc/mdadm.conf"
+
+	// RAIDInitrdFile is the freestanding initrd, relative to the system root,
+	// clr-boot-manager appends to the kernel initrd so the arrays are
+	// assembled with their configured names
+	RAIDInitrdFile = "etc/kernel/initrd.d/clr-installer-mdadm.cpio"
+
+	// raidGUID is the partition type of the RAID members
+	raidGUID = "A19D880F-05FC-4D3B-A006-743F0F84911E"
+)
+
+var (
+	// RAIDLevels is the list of the supported RAID levels
+	RAIDLevels = []string{"0", "1", "5", "6", "10"}
+
+	// raidMinimumMembers maps the RAID levels to their minimum number of members
+	raidMinimumMembers = map[string]int{
+		"0":  2,
+		"1":  2,
+		"5":  3,
+		"6":  4,
+		"10": 4,
+	}
+
+	// RAIDMetadataVersions is the list of the supported mdadm superblock formats
+	RAIDMetadataVersions = []string{"1.2", "1.1", "1.0", "0.90"}
+
+	// raidNameExp matches the valid array names, the partitions of mdN
+	// are named mdNpM
+	raidNameExp = regexp.MustCompile(`^md[0-9]+$`)
+)
+
+// IsRAIDArray returns true if bd is a software RAID array, its children are
+// the partitions of the array
+func (bd *BlockDevice) IsRAIDArray() bool {
+	return bd.Type == BlockDeviceTypeRAID
+}
+
+// IsRAIDMember returns true if bd is a partition used as RAID array member
+func (bd *BlockDevice) IsRAIDMember() bool {
+	return bd.FsType == RAIDMember && !bd.IsRAIDArray()
+}
+
+// NewRAIDArray returns a new RAID array named name of level, built from the
+// members partitions
+func NewRAIDArray(name string, level string, members []*BlockDevice) *BlockDevice {
+	array := &BlockDevice{
+		Name:            name,
+		Type:            BlockDeviceTypeRAID,
+		RAIDLevel:       level,
+		RAIDMetadata:    DefaultRAIDMetadata,
+		UserDefined:     true,
+		MakePartition:   true,
+		FormatPartition: true,
+	}
+
+	for _, curr := range members {
+		array.Members = append(array.Members, curr.Name)
+	}
+
+	return array
+}
+
+// RAIDMembers returns the partitions of medias used as members of array
+func RAIDMembers(medias []*BlockDevice, array *BlockDevice) []*BlockDevice {
+	result := []*BlockDevice{}
+
+	for _, name := range array.Members {
+		for _, curr := range medias {
+			for _, ch := range curr.Children {
+				if ch.Name == name && ch.IsRAIDMember() {
+					result = append(result, ch)
+				}
+			}
+		}
+	}
+
+	return result
+}
+
+// RAIDArraysUsed returns true if any of the medias is a RAID array
+func RAIDArraysUsed(medias []*BlockDevice) bool {
+	for _, curr := range medias {
+		if curr.IsRAIDArray() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RAIDKernelArguments returns the kernel arguments assembling the arrays from
+// their mdadm.conf and mounting the root partition of an array, none if the
+// root file system is not on a RAID array
+func RAIDKernelArguments(medias []*BlockDevice) []string {
+	for _, curr := range medias {
+		if !curr.IsRAIDArray() {
+			continue
+		}
+
+		for _, ch := range curr.Children {
+			if ch.MountPoint == "/" {
+				return []string{"rd.md=1", "rd.md.conf=1", "root=" + ch.GetDeviceFile()}
+			}
+		}
+	}
+
+	return []string{}
+}
+
+// newRAIDMemberPartition replaces the partitions of disk with a single RAID
+// member taking the whole disk
+func newRAIDMemberPartition(disk *BlockDevice) *BlockDevice {
+	disk.Children = nil
+	disk.PartTable = []*PartedPartition{
+		{
+			Number:     0,
+			Start:      0,
+			End:        disk.Size,
+			Size:       disk.Size,
+			FileSystem: "free",
+		},
+	}
+
+	member := &BlockDevice{
+		Size:            disk.Size,
+		Type:            BlockDeviceTypePart,
+		FsType:          RAIDMember,
+		UserDefined:     true,
+		MakePartition:   true,
+		FormatPartition: true,
+	}
+
+	disk.AddFromFreePartition(disk.findFree(disk.Size), member)
+
+	return member
+}
+
+// MirrorStandardPartitions mirrors the new root partition of disk, as added by
+// the standard partitioning, to the whole mirror disk: both become members of
+// a RAID 1 DefaultRAIDArray holding the root partition. The array is returned
+// and must be added to the target medias after disk and mirror.
+func MirrorStandardPartitions(disk *BlockDevice, mirror *BlockDevice) (*BlockDevice, error) {
+	if disk.Name == mirror.Name {
+		return nil, errors.Errorf("The root partition must be mirrored to another disk")
+	}
+
+	for _, ch := range disk.Children {
+		if !ch.MakePartition || ch.MountPoint != "/" {
+			continue
+		}
+
+		if ch.Type == BlockDeviceTypeCrypt {
+			return nil, errors.Errorf("Encrypted RAID arrays are not supported")
+		}
+
+		array := NewRAIDArray(DefaultRAIDArray, "1", []*BlockDevice{ch, newRAIDMemberPartition(mirror)})
+		array.AddChild(&BlockDevice{
+			Name:            array.getBasePartitionName() + "1",
+			Type:            BlockDeviceTypePart,
+			FsType:          ch.FsType,
+			MountPoint:      "/",
+			Label:           ch.Label,
+			UserDefined:     true,
+			MakePartition:   true,
+			FormatPartition: true,
+		})
+
+		ch.FsType = RAIDMember
+		ch.MountPoint = ""
+		ch.Label = ""
+
+		return array, nil
+	}
+
+	return nil, errors.Errorf("A new root partition is required to mirror it")
+}
+
+// validateRAIDArray checks the level, metadata and partitions of the array bd
+func (bd *BlockDevice) validateRAIDArray() error {
+	if !raidNameExp.MatchString(bd.Name) {
+		return errors.Errorf("Invalid RAID array name %q, i.e: md0", bd.Name)
+	}
+
+	minimum, found := raidMinimumMembers[bd.RAIDLevel]
+	if !found {
+		return errors.Errorf("RAID array %s: invalid level %q, must be one of: %s",
+			bd.Name, bd.RAIDLevel, strings.Join(RAIDLevels, ", "))
+	}
+
+	if len(bd.Members) < minimum {
+		return errors.Errorf("RAID array %s: level %s requires at least %d members",
+			bd.Name, bd.RAIDLevel, minimum)
+	}
+
+	if bd.RAIDMetadata != "" && !utils.StringSliceContains(RAIDMetadataVersions, bd.RAIDMetadata) {
+		return errors.Errorf("RAID array %s: invalid metadata %q, must be one of: %s",
+			bd.Name, bd.RAIDMetadata, strings.Join(RAIDMetadataVersions, ", "))
+	}
+
+	remaining := false
+
+	for _, ch := range bd.Children {
+		if ch.Type == BlockDeviceTypeCrypt {
+			return errors.Errorf("RAID array %s: encrypted partitions are not supported", bd.Name)
+		}
+
+		if _, found := bdOps[ch.FsType]; !found || ch.IsPhysicalVolume() || ch.IsRAIDMember() {
+			return errors.Errorf("RAID array %s: unsupported file system %q for %s",
+				bd.Name, ch.FsType, ch.Name)
+		}
+
+		if ch.MountPoint == "/boot" {
+			return errors.Errorf("RAID array %s: /boot is not supported on a RAID array", bd.Name)
+		}
+
+		if ch.Size == 0 {
+			if remaining {
+				return errors.Errorf("RAID array %s: found more than one partition with size 0", bd.Name)
+			}
+			remaining = true
+		}
+	}
+
+	return nil
+}
+
+// ValidateRAIDArrays checks the members of the arrays of medias are RAID
+// member partitions used by a single array and vice versa, and that an
+// installation using RAID has the required boot and root file systems
+func ValidateRAIDArrays(medias []*BlockDevice, legacyBios bool) error {
+	used := map[string]string{}
+	arrays := false
+
+	for _, curr := range medias {
+		if !curr.IsRAIDArray() {
+			continue
+		}
+
+		for _, name := range curr.Members {
+			if array, found := used[name]; found {
+				return errors.Errorf("RAID member %s is used by both %s and %s", name, array, curr.Name)
+			}
+			used[name] = curr.Name
+		}
+
+		if len(RAIDMembers(medias, curr)) != len(curr.Members) {
+			return errors.Errorf("RAID array %s: the members must be %s partitions of the target medias",
+				curr.Name, RAIDMember)
+		}
+
+		arrays = true
+	}
+
+	bootPartition := false
+	rootPartition := false
+
+	for _, curr := range medias {
+		for _, ch := range curr.Children {
+			if ch.IsRAIDMember() {
+				if used[ch.Name] == "" {
+					return errors.Errorf("RAID member %s is not used by any RAID array", ch.Name)
+				}
+
+				if ch.Type == BlockDeviceTypeCrypt {
+					return errors.Errorf("Encrypted RAID members are not supported")
+				}
+			}
+
+			if ch.FsType == "vfat" && ch.MountPoint == "/boot" {
+				bootPartition = true
+			}
+
+			if ch.MountPoint == "/" {
+				rootPartition = true
+			}
+		}
+	}
+
+	if !arrays {
+		return nil
+	}
+
+	if !bootPartition && !legacyBios {
+		return errors.Errorf("Could not find a suitable EFI partition")
+	}
+
+	if !rootPartition {
+		return errors.Errorf("Could not find a root partition")
+	}
+
+	return nil
+}
+
+// CreateRAIDArray creates the array bd from its members in medias, then writes
+// its partition table. Its progress is created by rep.
+func (bd *BlockDevice) CreateRAIDArray(medias []*BlockDevice, rep progress.Reporter) error {
+	if !bd.IsRAIDArray() {
+		return errors.Errorf("%s is not a RAID array", bd.Name)
+	}
+
+	msg := utils.Locale.Get("Creating the RAID array: %s", bd.Name)
+	prg := rep.NewLoop("%s", msg)
+	log.Info(msg)
+
+	metadata := bd.RAIDMetadata
+	if metadata == "" {
+		metadata = DefaultRAIDMetadata
+	}
+
+	members := RAIDMembers(medias, bd)
+
+	args := []string{
+		"mdadm",
+		"--create",
+		bd.GetDeviceFile(),
+		"--run",
+		fmt.Sprintf("--level=%s", bd.RAIDLevel),
+		fmt.Sprintf("--metadata=%s", metadata),
+		fmt.Sprintf("--raid-devices=%d", len(members)),
+	}
+
+	for _, curr := range members {
+		args = append(args, curr.GetDeviceFile())
+	}
+
+	if err := bd.runAndLog(args...); err != nil {
+		prg.Failure()
+		return errors.Wrap(err)
+	}
+
+	if err := WaitForDevice(bd.GetDeviceFile(), DeviceWaitTimeout); err != nil {
+		prg.Failure()
+		return err
+	}
+
+	prg.Success()
+
+	// the array is never the legacy BIOS boot device
+	return bd.WritePartitionTable(false, true, rep)
+}
+
+// AssembleRAIDArray assembles the already created RAID array from its
+// members, i.e when a partitioned install is resumed
+func (bd *BlockDevice) AssembleRAIDArray(medias []*BlockDevice) error {
+	if !bd.IsRAIDArray() {
+		return errors.Errorf("%s is not a RAID array", bd.Name)
+	}
+
+	// udev may have assembled it already
+	if _, err := os.Stat(bd.GetDeviceFile()); err == nil {
+		return nil
+	}
+
+	args := []string{"mdadm", "--assemble", "--run", bd.GetDeviceFile()}
+	for _, curr := range RAIDMembers(medias, bd) {
+		args = append(args, curr.GetDeviceFile())
+	}
+
+	if err := bd.runAndLog(args...); err != nil {
+		return errors.Wrap(err)
+	}
+
+	return WaitForDevice(bd.GetDeviceFile(), DeviceWaitTimeout)
+}
+
+// WriteRAIDConf writes the mdadm.conf of the arrays of medias to the target
+// and a freestanding initrd holding it, so the initrd assembles the arrays
+// with the same names
+func WriteRAIDConf(rootDir string, medias []*BlockDevice) error {
+	lines := []string{"# Generated by clr-installer"}
+
+	for _, curr := range medias {
+		if !curr.IsRAIDArray() {
+			continue
+		}
+
+		w := bytes.NewBuffer(nil)
+		if err := cmd.Run(w, "mdadm", "--detail", "--brief", curr.GetDeviceFile()); err != nil {
+			return errors.Wrap(err)
+		}
+
+		lines = append(lines, strings.TrimSpace(w.String()))
+	}
+
+	confFile := filepath.Join(rootDir, RAIDConfFile)
+	if err := utils.MkdirAll(filepath.Dir(confFile), 0755); err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(confFile, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		return errors.Wrap(err)
+	}
+
+	initrdFile := filepath.Join(rootDir, RAIDInitrdFile)
+	if err := utils.MkdirAll(filepath.Dir(initrdFile), 0755); err != nil {
+		return err
+	}
+
+	script := fmt.Sprintf("cd '%s' && echo %s | cpio --quiet -o -H newc > '%s'", rootDir, RAIDConfFile, initrdFile)
+	if err := cmd.RunAndLog("sh", "-c", script); err != nil {
+		return errors.Wrap(err)
+	}
+
+	return nil
+}
+
+// raidMemberMakeFsCommand wipes the former signatures of the member, it's
+// initialized when the array is created
+func raidMemberMakeFsCommand(bd *BlockDevice, args []string) ([]string, error) {
+	return append([]string{"wipefs"}, args...), nil
+}
+
+// raidMemberMakePartCommand names the partition after its usage
+func raidMemberMakePartCommand(bd *BlockDevice) (string, error) {
+	return strings.Join([]string{"mkpart", "raid"}, " "), nil
+}
@@ -0,0 +1,397 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/clearlinux/clr-installer/cmd"
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/log"
+	"github.com/clearlinux/clr-installer/utils"
+)
+
+const (
+	// ResizeMargin is the free space left to the shrunk file system on top
+	// of its minimum size, the other operating system still needs room
+	ResizeMargin = uint64(1024 * 1024 * 1024)
+
+	// resizeAlignment is the alignment of the shrunk partition sizes
+	resizeAlignment = uint64(1024 * 1024)
+
+	// sysfsSectorSize is the unit of the partition start in the sysfs
+	sysfsSectorSize = uint64(512)
+)
+
+var (
+	// ResizableFileSystems is the list of the file systems an existing
+	// partition can be shrunk with
+	ResizableFileSystems = []string{"ext2", "ext3", "ext4", "ntfs"}
+
+	resize2fsMinimumExp = regexp.MustCompile(`Estimated minimum size of the filesystem: ([0-9]+)`)
+	e2fsBlockSizeExp    = regexp.MustCompile(`Block size:\s+([0-9]+)`)
+	ntfsMinimumExp      = regexp.MustCompile(`You might resize at ([0-9]+) bytes`)
+
+	// ntfsUncleanExp matches the ntfsresize refusals of the volumes Windows
+	// did not shut down fully, hibernated or left with a dirty journal
+	ntfsUncleanExp = regexp.MustCompile(`partition is hibernated|journal file is unclean|scheduled for check`)
+)
+
+// IsResizable returns true if bd is an existing partition which file system
+// can be shrunk
+func (bd *BlockDevice) IsResizable() bool {
+	return bd.Type == BlockDeviceTypePart && !bd.MakePartition &&
+		utils.StringSliceContains(ResizableFileSystems, bd.FsType)
+}
+
+// parseResize2fsMinimum returns the minimum size in bytes of an ext file
+// system from the output of "resize2fs -P" and "dumpe2fs -h"
+func parseResize2fsMinimum(resize2fs string, dumpe2fs string) (uint64, error) {
+	match := resize2fsMinimumExp.FindStringSubmatch(resize2fs)
+	if match == nil {
+		return 0, errors.Errorf("Could not find the minimum size in: %q", resize2fs)
+	}
+
+	blocks, err := strconv.ParseUint(match[1], 10, 64)
+	if err != nil {
+		return 0, errors.Wrap(err)
+	}
+
+	match = e2fsBlockSizeExp.FindStringSubmatch(dumpe2fs)
+	if match == nil {
+		return 0, errors.Errorf("Could not find the block size in: %q", dumpe2fs)
+	}
+
+	blockSize, err := strconv.ParseUint(match[1], 10, 64)
+	if err != nil {
+		return 0, errors.Wrap(err)
+	}
+
+	return blocks * blockSize, nil
+}
+
+// parseNtfsresizeMinimum returns the minimum size in bytes of a ntfs file
+// system from the output of "ntfsresize --info"
+func parseNtfsresizeMinimum(ntfsresize string) (uint64, error) {
+	if ntfsUncleanExp.MatchString(ntfsresize) {
+		return 0, errors.Errorf("The Windows partition was not shut down cleanly, " +
+			"shut Windows down fully, with the fast startup disabled, and retry")
+	}
+
+	match := ntfsMinimumExp.FindStringSubmatch(ntfsresize)
+	if match == nil {
+		return 0, errors.Errorf("Could not find the minimum size in: %q", ntfsresize)
+	}
+
+	result, err := strconv.ParseUint(match[1], 10, 64)
+	if err != nil {
+		return 0, errors.Wrap(err)
+	}
+
+	return result, nil
+}
+
+// alignResizeSize rounds size up to the resize alignment
+func alignResizeSize(size uint64) uint64 {
+	return (size + resizeAlignment - 1) / resizeAlignment * resizeAlignment
+}
+
+// ResizeMinimum returns the smallest size the partition bd can be shrunk to,
+// the minimum size of its file system plus ResizeMargin
+func (bd *BlockDevice) ResizeMinimum() (uint64, error) {
+	if !bd.IsResizable() {
+		return 0, errors.Errorf("Partition %s with file system %q can not be resized", bd.Name, bd.FsType)
+	}
+
+	var minimum uint64
+	var err error
+
+	devFile := bd.GetDeviceFile()
+
+	if bd.FsType == "ntfs" {
+		w := bytes.NewBuffer(nil)
+		// the volumes Windows did not shut down fully are refused, not forced
+		err = cmd.Run(w, "ntfsresize", "--info", "--no-progress-bar", devFile)
+		if err != nil && !ntfsUncleanExp.MatchString(w.String()) {
+			return 0, errors.Wrap(err)
+		}
+
+		minimum, err = parseNtfsresizeMinimum(w.String())
+	} else {
+		resize2fs := bytes.NewBuffer(nil)
+		if err = cmd.Run(resize2fs, "resize2fs", "-P", devFile); err != nil {
+			return 0, errors.Wrap(err)
+		}
+
+		dumpe2fs := bytes.NewBuffer(nil)
+		if err = cmd.Run(dumpe2fs, "dumpe2fs", "-h", devFile); err != nil {
+			return 0, errors.Wrap(err)
+		}
+
+		minimum, err = parseResize2fsMinimum(resize2fs.String(), dumpe2fs.String())
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	minimum = alignResizeSize(minimum + ResizeMargin)
+	if minimum >= bd.Size {
+		return 0, errors.Errorf("Partition %s has no free space to reclaim", bd.Name)
+	}
+
+	return minimum, nil
+}
+
+// parseOSRelease returns the PRETTY_NAME, or the NAME, of an os-release file
+func parseOSRelease(content string) string {
+	values := map[string]string{}
+
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		fields := strings.SplitN(strings.TrimSpace(scanner.Text()), "=", 2)
+		if len(fields) != 2 {
+			continue
+		}
+
+		values[fields[0]] = strings.Trim(fields[1], `"'`)
+	}
+
+	if values["PRETTY_NAME"] != "" {
+		return values["PRETTY_NAME"]
+	}
+
+	return values["NAME"]
+}
+
+// DetectOS returns the name of the operating system installed to the
+// existing partition bd, an empty string if none is found
+func (bd *BlockDevice) DetectOS() string {
+	result := ""
+
+	err := withMountedReadOnly(bd, func(dir string) error {
+		if _, err := os.Stat(filepath.Join(dir, "Windows", "System32")); err == nil {
+			result = "Windows"
+			return nil
+		}
+
+		for _, curr := range []string{"etc/os-release", "usr/lib/os-release"} {
+			content, err := ioutil.ReadFile(filepath.Join(dir, curr))
+			if err != nil {
+				continue
+			}
+
+			if result = parseOSRelease(string(content)); result != "" {
+				break
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		log.Debug("Could not detect the operating system of %s: %s", bd.Name, err)
+	}
+
+	return result
+}
+
+// ShrinkPartition shrinks the existing partition name of the disk bd to
+// size, the freed space is added to the partition table and returned as a
+// partial install target
+func (bd *BlockDevice) ShrinkPartition(name string, size uint64) (InstallTarget, error) {
+	var child *BlockDevice
+
+	for _, curr := range bd.Children {
+		if curr.Name == name {
+			child = curr
+			break
+		}
+	}
+
+	if child == nil || !child.IsResizable() {
+		return InstallTarget{}, errors.Errorf("Partition %s of %s can not be resized", name, bd.Name)
+	}
+
+	size = alignResizeSize(size)
+	if size < MinimumPartitionSize || size >= child.Size {
+		return InstallTarget{}, errors.Errorf("Invalid size %d to shrink %s of %d bytes", size, name, child.Size)
+	}
+
+	partNumber, err := strconv.ParseUint(devNameSuffixExp.FindString(name), 10, 64)
+	if err != nil {
+		return InstallTarget{}, errors.Errorf("Could not find the partition number of %s", name)
+	}
+
+	var partitionList []*PartedPartition
+	var freed *PartedPartition
+
+	// the partition table may be shared with the scanned disk, don't
+	// change it in place
+	for _, curr := range bd.PartTable {
+		part := curr.Clone()
+		partitionList = append(partitionList, part)
+
+		if part.Number != partNumber {
+			continue
+		}
+
+		freed = &PartedPartition{
+			Number:     0,
+			Start:      part.Start + size,
+			End:        part.End,
+			Size:       part.Size - size,
+			FileSystem: "free",
+		}
+
+		part.End = part.Start + size - 1
+		part.Size = size
+		partitionList = append(partitionList, freed)
+	}
+
+	if freed == nil {
+		return InstallTarget{}, errors.Errorf("Could not find the partition %d of %s", partNumber, bd.Name)
+	}
+
+	bd.PartTable = partitionList
+	bd.consolidateFree()
+
+	child.Size = size
+	child.Resize = true
+
+	target := InstallTarget{Name: bd.Name, Friendly: bd.FriendlyModel(),
+		Removable: bd.RemovableDevice, Shrink: name}
+
+	for _, part := range bd.PartTable {
+		if part.Number == 0 && part.Start <= freed.Start && part.End >= freed.Start {
+			target.FreeStart = part.Start
+			target.FreeEnd = part.End
+			break
+		}
+	}
+
+	return target, nil
+}
+
+// FindShrinkInstallTargets returns the partial install targets made by
+// shrinking an existing partition, leaving at least minSize bytes for the
+// install
+func FindShrinkInstallTargets(minSize uint64, medias []*BlockDevice) []InstallTarget {
+	var installTargets []InstallTarget
+
+	for _, curr := range medias {
+		if curr.PtType != "gpt" {
+			continue
+		}
+
+		for _, ch := range curr.Children {
+			if !ch.IsResizable() {
+				continue
+			}
+
+			minimum, err := ch.ResizeMinimum()
+			if err != nil {
+				log.Debug("FindShrinkInstallTargets(): ignoring partition %s: %s", ch.Name, err)
+				continue
+			}
+
+			if ch.Size-minimum < minSize {
+				log.Debug("FindShrinkInstallTargets(): not enough room on partition %s", ch.Name)
+				continue
+			}
+
+			installTargets = append(installTargets,
+				InstallTarget{Name: curr.Name, Friendly: curr.FriendlyModel(),
+					Removable: curr.RemovableDevice, FreeStart: minimum, FreeEnd: ch.Size,
+					Shrink: ch.Name, ShrinkMinimum: minimum, OS: ch.DetectOS()})
+			log.Debug("FindShrinkInstallTargets(): partition %s can shrink to %d", ch.Name, minimum)
+		}
+	}
+
+	return sortInstallTargets(installTargets)
+}
+
+// validateResize checks a partition to shrink is an existing one with a
+// supported file system
+func (bd *BlockDevice) validateResize() error {
+	if !bd.Resize {
+		return nil
+	}
+
+	if bd.MakePartition || bd.FormatPartition {
+		return errors.Errorf("Partition %s can not be both resized and created or formatted", bd.Name)
+	}
+
+	if !utils.StringSliceContains(ResizableFileSystems, bd.FsType) {
+		return errors.Errorf("Partition %s with file system %q can not be resized, must be one of: %s",
+			bd.Name, bd.FsType, strings.Join(ResizableFileSystems, ", "))
+	}
+
+	if bd.Size < MinimumPartitionSize {
+		return errors.Errorf("Partition %s must have a size to be resized", bd.Name)
+	}
+
+	return nil
+}
+
+// partitionStart returns the start in bytes of the existing partition bd
+func (bd *BlockDevice) partitionStart() (uint64, error) {
+	content, err := ioutil.ReadFile(filepath.Join("/sys/class/block", bd.Name, "start"))
+	if err != nil {
+		return 0, errors.Wrap(err)
+	}
+
+	start, err := strconv.ParseUint(strings.TrimSpace(string(content)), 10, 64)
+	if err != nil {
+		return 0, errors.Wrap(err)
+	}
+
+	return start * sysfsSectorSize, nil
+}
+
+// shrinkPartition shrinks the file system of the existing partition curr of
+// the disk bd and then the partition itself
+func (bd *BlockDevice) shrinkPartition(curr *BlockDevice) error {
+	partNumber, err := strconv.ParseUint(devNameSuffixExp.FindString(curr.Name), 10, 64)
+	if err != nil {
+		return errors.Errorf("Could not find the partition number of %s", curr.Name)
+	}
+
+	start, err := curr.partitionStart()
+	if err != nil {
+		return err
+	}
+
+	devFile := curr.GetDeviceFile()
+	log.Info("Shrinking %s to %d bytes", devFile, curr.Size)
+
+	if curr.FsType == "ntfs" {
+		err = bd.pipeRunAndLog("y\n", "ntfsresize", "--no-progress-bar",
+			"--size", strconv.FormatUint(curr.Size, 10), devFile)
+	} else {
+		// resize2fs refuses to shrink a file system not checked recently
+		if err = bd.runAndLog("e2fsck", "-f", "-y", devFile); err != nil {
+			log.Warning("Failed to check the file system of %s: %s", devFile, err)
+		}
+
+		err = bd.runAndLog("resize2fs", devFile, fmt.Sprintf("%dK", curr.Size/1024))
+	}
+
+	if err != nil {
+		return errors.Wrap(err)
+	}
+
+	// parted asks to confirm the shrinking even in script mode
+	return errors.Wrap(bd.pipeRunAndLog("Yes\n", "parted", "---pretend-input-tty", bd.GetDeviceFile(),
+		"unit", "B", "resizepart", strconv.FormatUint(partNumber, 10),
+		fmt.Sprintf("%dB", start+curr.Size-1)))
+}
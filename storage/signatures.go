@@ -0,0 +1,251 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/clearlinux/clr-installer/cmd"
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/log"
+	"github.com/clearlinux/clr-installer/utils"
+)
+
+// StackSignature is an existing LUKS, LVM or RAID signature found on a block
+// device, the stacked devices are stopped and the signature wiped before the
+// device is partitioned again
+type StackSignature struct {
+	Device string   // device holding the signature, i.e sda2
+	FsType string   // signature type as reported by lsblk, i.e crypto_LUKS
+	Active []string // active devices stacked on the signature, i.e md127
+
+	bd *BlockDevice
+}
+
+var (
+	// stackSignatureNames maps the signature types to their user friendly names
+	stackSignatureNames = map[string]string{
+		"crypto_LUKS":       "LUKS",
+		"LVM2_member":       "LVM",
+		"linux_raid_member": "RAID",
+	}
+
+	// runStackCommand runs the commands deactivating and wiping the stacked
+	// devices, queryStackCommand the ones reading their state
+	runStackCommand   = cmd.RunAndLog
+	queryStackCommand = cmd.Run
+
+	// stackedDeviceExists checks a stacked device is still active
+	stackedDeviceExists = utils.FileExists
+)
+
+// Name returns the user friendly name of the signature type, i.e LUKS
+func (sg *StackSignature) Name() string {
+	return stackSignatureNames[sg.FsType]
+}
+
+// String returns the device, signature type and active stacked devices
+func (sg *StackSignature) String() string {
+	result := fmt.Sprintf("%s: %s", sg.Device, sg.Name())
+
+	if len(sg.Active) > 0 {
+		result = fmt.Sprintf("%s (active %s)", result, strings.Join(sg.Active, ", "))
+	}
+
+	return result
+}
+
+// isStackSignature returns true if fstype is a LUKS, LVM or RAID signature
+func isStackSignature(fstype string) bool {
+	_, found := stackSignatureNames[fstype]
+	return found
+}
+
+// activeStack returns the names of the active devices stacked on bd
+func (bd *BlockDevice) activeStack() []string {
+	result := []string{}
+
+	for _, ch := range bd.Children {
+		if ch.Type == BlockDeviceTypeCrypt || ch.Type == BlockDeviceTypeLVM2Volume ||
+			ch.Type == BlockDeviceTypeRAID {
+			result = append(result, ch.Name)
+		}
+		result = append(result, ch.activeStack()...)
+	}
+
+	return result
+}
+
+// StackSignatures returns the LUKS, LVM and RAID signatures of bd and its
+// partitions, the devices stacked on the signatures are not looked into
+func (bd *BlockDevice) StackSignatures() []*StackSignature {
+	result := []*StackSignature{}
+
+	if isStackSignature(bd.FsType) {
+		return append(result, &StackSignature{
+			Device: bd.Name,
+			FsType: bd.FsType,
+			Active: bd.activeStack(),
+			bd:     bd,
+		})
+	}
+
+	for _, ch := range bd.Children {
+		if ch.Type == BlockDeviceTypePart {
+			result = append(result, ch.StackSignatures()...)
+		}
+	}
+
+	return result
+}
+
+// StackSignatureNames returns the descriptions of bd's stack signatures
+func (bd *BlockDevice) StackSignatureNames() []string {
+	var result []string
+
+	for _, curr := range bd.StackSignatures() {
+		result = append(result, curr.String())
+	}
+
+	return result
+}
+
+// hasDiskStackSignature returns true if the disk itself, and not one of its
+// partitions, holds a stack signature, i.e a whole disk LVM physical volume
+func (bd *BlockDevice) hasDiskStackSignature() bool {
+	return isStackSignature(bd.FsType)
+}
+
+// FindStackConflicts returns the stack signatures of the current devices the
+// target medias would overwrite, see touchedDevices()
+func FindStackConflicts(medias []*BlockDevice, current []*BlockDevice, wholeDisk bool) []*StackSignature {
+	result := []*StackSignature{}
+
+	for _, media := range medias {
+		disk := findCurrentDisk(media, current)
+		if disk == nil {
+			continue
+		}
+
+		touched := touchedDevices(media, disk, wholeDisk)
+		for _, sg := range disk.StackSignatures() {
+			if touched[sg.Device] {
+				result = append(result, sg)
+			}
+		}
+	}
+
+	return result
+}
+
+// deactivate tears down the devices stacked on bd, the top most first, and
+// stops bd itself if it's a LUKS, LVM or RAID device. See teardown().
+func (bd *BlockDevice) deactivate(stopped map[string]bool) error {
+	for _, ch := range bd.Children {
+		if err := ch.deactivate(stopped); err != nil {
+			return err
+		}
+	}
+
+	if err := bd.teardown(); err != nil {
+		return err
+	}
+
+	if stopped[bd.Name] {
+		return nil
+	}
+
+	commands := [][]string{}
+
+	// the volume group holds the physical volume open, it's deactivated
+	// before the device is closed or stopped
+	if bd.FsType == LVMPhysicalVolume {
+		vg, err := physicalVolumeGroup(bd.stackedDeviceFile())
+		if err != nil {
+			return err
+		}
+
+		if vg != "" {
+			commands = append(commands, []string{"vgchange", "--activate", "n", vg})
+		}
+	}
+
+	var stop []string
+
+	switch bd.Type {
+	case BlockDeviceTypeCrypt:
+		stop = []string{"cryptsetup", "close", bd.Name}
+	case BlockDeviceTypeRAID:
+		stop = []string{"mdadm", "--stop", bd.GetDeviceFile()}
+	}
+
+	// the device may have been stopped by a previous teardown
+	if stop != nil {
+		if exists, err := stackedDeviceExists(bd.stackedDeviceFile()); err != nil || exists {
+			commands = append(commands, stop)
+		}
+	}
+
+	if len(commands) == 0 {
+		return nil
+	}
+
+	log.Info("Deactivating %s", bd.Name)
+	for _, args := range commands {
+		if err := runStackCommand(args...); err != nil {
+			return errors.Wrap(err)
+		}
+	}
+
+	stopped[bd.Name] = true
+
+	return nil
+}
+
+// physicalVolumeGroup returns the volume group of the LVM physical volume file
+func physicalVolumeGroup(file string) (string, error) {
+	w := bytes.NewBuffer(nil)
+
+	if err := queryStackCommand(w, "pvs", "--noheadings", "-o", "vg_name", file); err != nil {
+		return "", errors.Wrap(err)
+	}
+
+	return strings.TrimSpace(w.String()), nil
+}
+
+// WipeStackSignatures stops the devices stacked on the signatures and wipes
+// them so the devices can be partitioned and formatted again
+func WipeStackSignatures(signatures []*StackSignature) error {
+	stopped := map[string]bool{}
+
+	for _, sg := range signatures {
+		if err := sg.bd.deactivate(stopped); err != nil {
+			return errors.Errorf("Could not deactivate %s: %s", sg.Device, err)
+		}
+
+		file := sg.bd.GetDeviceFile()
+
+		if sg.FsType == "linux_raid_member" {
+			if err := runStackCommand("mdadm", "--zero-superblock", file); err != nil {
+				return errors.Wrap(err)
+			}
+		}
+
+		log.Info("Wiping the %s signature of %s", sg.Name(), sg.Device)
+		if err := runStackCommand("wipefs", "--all", file); err != nil {
+			return errors.Wrap(err)
+		}
+	}
+
+	return nil
+}
+
+// DeactivateAndWipe stops the LUKS, LVM and RAID stacks of bd and wipes all
+// their signatures
+func (bd *BlockDevice) DeactivateAndWipe() error {
+	return WipeStackSignatures(bd.StackSignatures())
+}
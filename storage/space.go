@@ -0,0 +1,165 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package storage
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/clearlinux/clr-installer/errors"
+)
+
+const (
+	// BaseContentSize is the approximate installed size of the core bundles,
+	// the kernel and the bundles required by the installer configuration
+	BaseContentSize = uint64(1500 * (1000 * 1000))
+
+	// LUKSHeaderSize is the space the LUKS2 header takes from an encrypted
+	// partition, the cryptsetup default
+	LUKSHeaderSize = uint64(16 * 1024 * 1024)
+)
+
+// SpaceRequirements is the smallest disk space of an install, the sizes the
+// disk pages, the model validation and the pre-checks agree on
+type SpaceRequirements struct {
+	// Boot is the EFI System Partition of the standard partitioning
+	Boot uint64
+
+	// Swap is the swap partition, 0 if none is planned
+	Swap uint64
+
+	// Root is the root file system content: the bundles and the swap file
+	Root uint64
+
+	// Encryption is the LUKS headers of the encrypted partitions
+	Encryption uint64
+
+	// Minimum is the smallest install, the disk is never sized below it
+	Minimum uint64
+
+	// rootEncrypted is set if the root partition is encrypted
+	rootEncrypted bool
+}
+
+// NewSpaceRequirements returns the requirements of installing content bytes
+// to the standard partitions, BaseContentSize if content is 0
+func NewSpaceRequirements(content uint64) *SpaceRequirements {
+	if content == 0 {
+		content = BaseContentSize
+	}
+
+	return &SpaceRequirements{
+		Boot:    bootSize,
+		Swap:    swapSize,
+		Root:    content,
+		Minimum: MinimumServerInstallSize,
+	}
+}
+
+// Plan adapts sr to the partitions planned in medias and a swap file of
+// swapFile bytes, a swap file replaces the swap partition; medias may be
+// empty when the partitions are not planned yet
+func (sr *SpaceRequirements) Plan(medias []*BlockDevice, swapFile uint64) {
+	if swapFile > 0 {
+		sr.Swap = 0
+		sr.Root += swapFile
+	}
+
+	planned := false
+	swap := false
+	sr.Encryption = 0
+
+	for _, curr := range medias {
+		for _, ch := range curr.Children {
+			planned = true
+
+			if ch.FsType == "swap" {
+				swap = true
+			}
+
+			// the swap partitions are encrypted with a random key, no header
+			if ch.Type == BlockDeviceTypeCrypt && ch.FsTypeNotSwap() {
+				sr.Encryption += LUKSHeaderSize
+				sr.rootEncrypted = sr.rootEncrypted || ch.MountPoint == "/"
+			}
+		}
+	}
+
+	if planned && !swap {
+		sr.Swap = 0
+	}
+}
+
+// RootPartition returns the smallest root partition, the content and its
+// LUKS header if encrypted
+func (sr *SpaceRequirements) RootPartition() uint64 {
+	if sr.rootEncrypted {
+		return sr.Root + LUKSHeaderSize
+	}
+
+	return sr.Root
+}
+
+// Total returns the smallest disk of the install, never below Minimum
+func (sr *SpaceRequirements) Total() uint64 {
+	result := sr.Boot + sr.Swap + sr.Root + sr.Encryption
+	if result < sr.Minimum {
+		return sr.Minimum
+	}
+
+	return result
+}
+
+// Check checks the partitions planned in medias meet sr: the root partition
+// holds the content and a new EFI System Partition the kernels; only the
+// partitions planned interactively are checked, the ones of a configuration
+// file are sized for their own content and the ones of unknown size can't be
+func (sr *SpaceRequirements) Check(medias []*BlockDevice) error {
+	for _, curr := range medias {
+		for _, ch := range curr.Children {
+			if ch.Size == 0 || !ch.UserDefined {
+				continue
+			}
+
+			if ch.MountPoint == "/" && ch.Size < sr.RootPartition() {
+				needed, _ := HumanReadableSize(sr.RootPartition())
+				return errors.ValidationErrorf("The root partition %s is too small, it needs at least %s",
+					ch.Name, needed)
+			}
+
+			// as a reused one, a new EFI System Partition must fit the kernels
+			if ch.MountPoint == "/boot" && ch.MakePartition && ch.Size < ESPReuseMinimumFree {
+				needed, _ := HumanReadableSize(ESPReuseMinimumFree)
+				return errors.ValidationErrorf("The boot partition %s is too small, it needs at least %s",
+					ch.Name, needed)
+			}
+		}
+	}
+
+	return nil
+}
+
+// String returns the summary of sr, i.e: 4.3GB (1.5GB root, 150MB boot)
+func (sr *SpaceRequirements) String() string {
+	parts := []string{}
+
+	for _, curr := range []struct {
+		size uint64
+		name string
+	}{
+		{sr.Root, "root"},
+		{sr.Boot, "boot"},
+		{sr.Swap, "swap"},
+		{sr.Encryption, "encryption"},
+	} {
+		if curr.size > 0 {
+			size, _ := HumanReadableSize(curr.size)
+			parts = append(parts, fmt.Sprintf("%s %s", size, curr.name))
+		}
+	}
+
+	total, _ := HumanReadableSize(sr.Total())
+	return fmt.Sprintf("%s (%s)", total, strings.Join(parts, ", "))
+}
@@ -9,6 +9,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"math"
 	"path/filepath"
 	"regexp"
@@ -43,6 +44,7 @@ type BlockDevice struct {
 	PtType          string             // partition table type
 	FsType          string             // filesystem type
 	UUID            string             // filesystem uuid
+	NewUUID         string             // uuid of the new filesystem, set by the user
 	Serial          string             // device serial number
 	MountPoint      string             // where the device is mounted
 	Label           string             // label for the partition; set with mkfs
@@ -57,10 +59,21 @@ type BlockDevice struct {
 	MakePartition   bool               // Do we need to make a new partition?
 	FormatPartition bool               // Do we need to format the partition
 	Options         string             // arbitrary mkfs.* options
+	VolumeGroup     string             // volume group of a LVM physical volume
+	RAIDLevel       string             // level of a RAID array
+	RAIDMetadata    string             // mdadm superblock format of a RAID array
+	Members         []string           // member partitions of a RAID array
+	Encryption      string             // LUKS format of an encrypted partition
+	Discard         bool               // mount with the discard option
+	Resize          bool               // shrink the existing partition to Size
+	Rotational      bool               // rotational device, i.e not a SSD
+	Subvolumes      []*Subvolume       // btrfs subvolumes of the partition
 	available       bool               // was it mounted the moment we loaded?
+	tpmUnlock       bool               // unlocked by the TPM at boot
 	partition       uint64             // Assigned partition for media - can't set until after mkpart
 	PartTable       []*PartedPartition // Existing Disk partition table from parted
 	removedParts    []uint64           // List of manually removed partitions
+	taskLog         io.Writer          // writer of the commands output, see SetTaskLog
 }
 
 // Version used for reading and writing YAML
@@ -80,6 +93,14 @@ type blockDeviceYAMLMarshal struct {
 	State           string         `yaml:"state,omitempty"`
 	Children        []*BlockDevice `yaml:"children,omitempty"`
 	Options         string         `yaml:"options,omitempty"`
+	VolumeGroup     string         `yaml:"volumeGroup,omitempty"`
+	RAIDLevel       string         `yaml:"level,omitempty"`
+	RAIDMetadata    string         `yaml:"metadata,omitempty"`
+	Members         []string       `yaml:"members,omitempty,flow"`
+	Encryption      string         `yaml:"encryption,omitempty"`
+	Discard         bool           `yaml:"discard,omitempty"`
+	Resize          bool           `yaml:"resize,omitempty"`
+	Subvolumes      []*Subvolume   `yaml:"subvolumes,omitempty"`
 }
 
 // BlockDeviceState is the representation of a block device state (live, running, etc)
@@ -98,7 +119,7 @@ const (
 	// BlockDeviceTypeRom identifies a BlockDevice as a rom
 	BlockDeviceTypeRom
 
-	// BlockDeviceTypeLVM2Group identifies a BlockDevice as a lvm2 group
+	// BlockDeviceTypeLVM2Group identifies a BlockDevice as a lvm2 volume group
 	BlockDeviceTypeLVM2Group
 
 	// BlockDeviceTypeLVM2Volume identifies a BlockDevice as a lvm2 volume
@@ -110,6 +131,9 @@ const (
 	// BlockDeviceTypeLoop identifies a BlockDevice as a loop device (created with losetup)
 	BlockDeviceTypeLoop
 
+	// BlockDeviceTypeRAID identifies a BlockDevice as a software RAID array (created with mdadm)
+	BlockDeviceTypeRAID
+
 	// BlockDeviceTypeUnknown identifies a BlockDevice as unknown
 	BlockDeviceTypeUnknown
 
@@ -153,6 +177,8 @@ var (
 	storageExp          = regexp.MustCompile(`^([0-9]*(\.)?[0-9]*)([bkmgtp]{1}){0,1}$`)
 	labelExp            = regexp.MustCompile(`^([[:word:]-+_]+)$`)
 	mountExp            = regexp.MustCompile(`^(/|(/[[:word:]-+_]+)+)$`)
+	uuidExp             = regexp.MustCompile(`^[[:xdigit:]]{8}-([[:xdigit:]]{4}-){3}[[:xdigit:]]{12}$`)
+	vfatUUIDExp         = regexp.MustCompile(`^[[:xdigit:]]{4}-?[[:xdigit:]]{4}$`)
 	devNameSuffixExp    = regexp.MustCompile(`([0-9]*)$`)
 	blockDeviceStateMap = map[BlockDeviceState]string{
 		BlockDeviceStateRunning: "running",
@@ -165,14 +191,16 @@ var (
 		BlockDeviceTypeCrypt:      "crypt",
 		BlockDeviceTypeLoop:       "loop",
 		BlockDeviceTypeRom:        "rom",
-		BlockDeviceTypeLVM2Group:  "LVM2_member",
+		BlockDeviceTypeLVM2Group:  "vg",
 		BlockDeviceTypeLVM2Volume: "lvm",
+		BlockDeviceTypeRAID:       "raid",
 		BlockDeviceTypeUnknown:    "",
 	}
 	aliasPrefixTable = map[string]string{
 		"/dev/loop":   "p",
 		"/dev/nvme":   "p",
 		"/dev/mmcblk": "p",
+		"/dev/pmem":   "p",
 	}
 
 	bootSize = uint64(150 * (1000 * 1000))
@@ -254,6 +282,11 @@ func (bt BlockDeviceType) String() string {
 }
 
 func parseBlockDeviceType(bdt string) (BlockDeviceType, error) {
+	// lsblk reports the RAID level, i.e raid1, or md for containers
+	if strings.HasPrefix(bdt, "raid") || bdt == "md" {
+		return BlockDeviceTypeRAID, nil
+	}
+
 	for k, v := range blockDeviceTypeMap {
 		if v == bdt {
 			return k, nil
@@ -316,6 +349,7 @@ func (bd *BlockDevice) Clone() *BlockDevice {
 		MajorMinor:      bd.MajorMinor,
 		FsType:          bd.FsType,
 		UUID:            bd.UUID,
+		NewUUID:         bd.NewUUID,
 		Serial:          bd.Serial,
 		MountPoint:      bd.MountPoint,
 		Label:           bd.Label,
@@ -328,6 +362,15 @@ func (bd *BlockDevice) Clone() *BlockDevice {
 		UserDefined:     bd.UserDefined,
 		MakePartition:   bd.MakePartition,
 		FormatPartition: bd.FormatPartition,
+		VolumeGroup:     bd.VolumeGroup,
+		RAIDLevel:       bd.RAIDLevel,
+		RAIDMetadata:    bd.RAIDMetadata,
+		Members:         bd.Members,
+		Encryption:      bd.Encryption,
+		Discard:         bd.Discard,
+		Resize:          bd.Resize,
+		Rotational:      bd.Rotational,
+		Subvolumes:      bd.Subvolumes,
 		available:       bd.available,
 		partition:       bd.partition,
 		PartTable:       bd.PartTable,
@@ -397,6 +440,44 @@ func (bd *BlockDevice) GetConfiguredStatus() ConfigStatus {
 	return status
 }
 
+// RootPartitionSize returns the size of the root partition planned in medias,
+// 0 if there's none or its size is not known
+func RootPartitionSize(medias []*BlockDevice) uint64 {
+	for _, bd := range medias {
+		for _, ch := range bd.Children {
+			if ch.MountPoint == "/" {
+				return ch.Size
+			}
+		}
+	}
+
+	return 0
+}
+
+// KernelArguments returns the kernel arguments required to boot the medias,
+// the encrypted, LVM, RAID and persistent memory root partitions are set up
+// by the initrd from the kernel command line
+func KernelArguments(medias []*BlockDevice) []string {
+	args := []string{}
+
+	if EncryptionUsed(medias) {
+		args = append(args, KernelArgument)
+	}
+
+	args = append(args, TrimKernelArguments(medias)...)
+	args = append(args, LVMKernelArguments(medias)...)
+	args = append(args, RAIDKernelArguments(medias)...)
+	args = append(args, BtrfsKernelArguments(medias)...)
+
+	// the root partition is auto-mounted, direct access must be requested
+	// from the kernel command line
+	if PersistentMemoryRoot(medias) {
+		args = append(args, DAXKernelArgument)
+	}
+
+	return args
+}
+
 // FsTypeNotSwap returns true if the file system type is not swap
 func (bd *BlockDevice) FsTypeNotSwap() bool {
 	return bd.FsType != "swap"
@@ -416,25 +497,26 @@ func (bd *BlockDevice) DeviceHasSwap() bool {
 
 // Validate checks if the minimal requirements for a installation is met
 func (bd *BlockDevice) Validate(legacyBios bool, cryptPass string) error {
-	bootPartition := false
-	rootPartition := false
-	encrypted := false
+	return ValidateTargetMedias([]*BlockDevice{bd}, legacyBios, cryptPass)
+}
 
+// validatePartitions checks the partitions of the disk or image bd
+func (bd *BlockDevice) validatePartitions() error {
 	for _, ch := range bd.Children {
-		if ch.FsType == "vfat" && ch.MountPoint == "/boot" {
-			bootPartition = true
+		if ch.FsType == "vfat" && ch.MountPoint == "/boot" && ch.Type == BlockDeviceTypeCrypt {
+			return errors.Errorf("Encryption of /boot is not supported")
+		}
 
-			if ch.Type == BlockDeviceTypeCrypt {
-				return errors.Errorf("Encryption of /boot is not supported")
-			}
+		if err := ch.validateEncryption(); err != nil {
+			return err
 		}
 
-		if ch.MountPoint == "/" {
-			rootPartition = true
+		if err := ch.validateResize(); err != nil {
+			return err
 		}
 
-		if ch.Type == BlockDeviceTypeCrypt && ch.FsTypeNotSwap() {
-			encrypted = true
+		if err := ch.validateSubvolumes(); err != nil {
+			return err
 		}
 
 		if bd.Type != BlockDeviceTypeDisk && bd.Size == 0 && ch.Size == 0 {
@@ -442,14 +524,91 @@ func (bd *BlockDevice) Validate(legacyBios bool, cryptPass string) error {
 		}
 	}
 
-	if !bootPartition && !legacyBios {
+	return nil
+}
+
+// ValidateTargetMedias checks the minimal requirements for an installation
+// are met by the target medias together: the partitions of the same install
+// may live on different disks, but a mount point is only set once and the
+// root must be on the disk of the EFI partition the system boots from
+func ValidateTargetMedias(medias []*BlockDevice, legacyBios bool, cryptPass string) error {
+	var bootDisk *BlockDevice
+	var rootDisk *BlockDevice
+
+	mounts := map[string]*BlockDevice{}
+	encrypted := false
+	volumes := false
+
+	for _, bd := range medias {
+		// the boot and root of LVM installs are checked by ValidateVolumeGroups
+		if bd.IsVolumeGroup() {
+			volumes = true
+			if err := bd.validateVolumeGroup(); err != nil {
+				return err
+			}
+		} else if bd.IsRAIDArray() {
+			// and the ones of RAID installs by ValidateRAIDArrays
+			volumes = true
+			if err := bd.validateRAIDArray(); err != nil {
+				return err
+			}
+		} else if err := bd.validatePartitions(); err != nil {
+			return err
+		}
+
+		for _, ch := range bd.Children {
+			if ch.IsPhysicalVolume() || ch.IsRAIDMember() {
+				volumes = true
+			}
+
+			if ch.MountPoint != "" {
+				if other, found := mounts[ch.MountPoint]; found {
+					return errors.Errorf("Mount point %s is set on both %s and %s",
+						ch.MountPoint, other.Name, ch.Name)
+				}
+				mounts[ch.MountPoint] = ch
+			}
+
+			// the main subvolume is mounted to the partition mount point
+			for _, sv := range ch.Subvolumes {
+				if sv.MountPoint == "" || sv.MountPoint == ch.MountPoint {
+					continue
+				}
+
+				if other, found := mounts[sv.MountPoint]; found {
+					return errors.Errorf("Mount point %s is set on both %s and %s",
+						sv.MountPoint, other.Name, ch.Name)
+				}
+				mounts[sv.MountPoint] = ch
+			}
+
+			if ch.FsType == "vfat" && ch.MountPoint == "/boot" {
+				bootDisk = bd
+			}
+
+			if ch.MountPoint == "/" {
+				rootDisk = bd
+			}
+
+			if ch.Type == BlockDeviceTypeCrypt && ch.FsTypeNotSwap() {
+				encrypted = true
+			}
+		}
+	}
+
+	if bootDisk == nil && !legacyBios && !volumes {
 		return errors.Errorf("Could not find a suitable EFI partition")
 	}
 
-	if !rootPartition {
+	if rootDisk == nil && !volumes {
 		return errors.Errorf("Could not find a root partition")
 	}
 
+	// the root partition is discovered on the disk the system boots from
+	if bootDisk != nil && rootDisk != nil && bootDisk != rootDisk && !volumes {
+		return errors.Errorf("The root partition must be on %s, the disk of the EFI partition", bootDisk.Name)
+	}
+
 	if encrypted && cryptPass == "" {
 		return errors.Errorf("Encrypted file system enabled, but missing passphase")
 	}
@@ -482,9 +641,10 @@ func (bd *BlockDevice) addRemovePartition(part uint64) {
 func (bd *BlockDevice) getBasePartitionName() string {
 	partPrefix := ""
 
-	if bd.Type == BlockDeviceTypeLoop ||
+	if bd.Type == BlockDeviceTypeLoop || bd.Type == BlockDeviceTypeRAID ||
 		strings.Contains(bd.Name, "nvme") ||
-		strings.Contains(bd.Name, "mmcblk") {
+		strings.Contains(bd.Name, "mmcblk") ||
+		strings.HasPrefix(bd.Name, "pmem") {
 		partPrefix = "p"
 	}
 
@@ -709,12 +869,44 @@ func updateBlockDevices(toBeUpdated *BlockDevice, updates []*BlockDevice) {
 }
 
 // RescanBlockDevices Clear current list available block devices and rescans
+// if no device is found the scan is retried once udev has settled, the devices
+// of a controller just probed may not be there yet
 func RescanBlockDevices(userDefined []*BlockDevice) ([]*BlockDevice, error) {
 	avBlockDevices = nil
 
+	result, err := ListAvailableBlockDevices(userDefined)
+	if err != nil || len(result) > 0 {
+		return result, err
+	}
+
+	log.Warning("No block device found, retrying once udev has settled")
+	if err = settleBlockDevices(); err != nil {
+		log.Warning("Failed to wait for udev: %v", err)
+	}
+
+	avBlockDevices = nil
 	return ListAvailableBlockDevices(userDefined)
 }
 
+// BlockDevicesSignature returns a cheap summary of the system block devices,
+// their names and sizes, it changes when a device is plugged, removed or has
+// its media changed; the scan results are reused while it doesn't change
+func BlockDevicesSignature() string {
+	entries, err := ioutil.ReadDir(sysBlockDir)
+	if err != nil {
+		log.Debug("Could not read %s: %v", sysBlockDir, err)
+		return ""
+	}
+
+	result := []string{}
+	for _, curr := range entries {
+		size, _ := ioutil.ReadFile(filepath.Join(sysBlockDir, curr.Name(), "size"))
+		result = append(result, curr.Name()+":"+strings.TrimSpace(string(size)))
+	}
+
+	return strings.Join(result, " ")
+}
+
 // ListAvailableBlockDevices Lists only available block devices
 // where available means block devices not mounted or not in use by the host system
 // userDefined will be inserted in the resulting list rather the loaded ones
@@ -769,6 +961,10 @@ func parseBlockDevicesDescriptor(data []byte) ([]*BlockDevice, error) {
 	for _, bd := range root.BlockDevices {
 		bd.available = true
 
+		if bd.Model == "" && bd.IsPersistentMemory() {
+			bd.Model = PersistentMemoryModel
+		}
+
 		for _, ch := range bd.Children {
 			ch.Parent = bd
 			// We ignore devices with any mount partition
@@ -892,6 +1088,84 @@ func IsValidLabel(label string, fstype string) string {
 	return ""
 }
 
+// IsValidUUID returns empty string if uuid is a valid file system uuid for fstype,
+// vfat uses a 32 bit volume id in the XXXX-XXXX form instead of a standard uuid
+func IsValidUUID(uuid string, fstype string) string {
+	if uuid == "" {
+		return ""
+	}
+
+	if fstype == "vfat" {
+		if !vfatUUIDExp.MatchString(uuid) {
+			return utils.Locale.Get("Invalid volume id, expected XXXX-XXXX")
+		}
+		return ""
+	}
+
+	if !uuidExp.MatchString(uuid) {
+		return utils.Locale.Get("Invalid UUID, expected XXXXXXXX-XXXX-XXXX-XXXX-XXXXXXXXXXXX")
+	}
+
+	return ""
+}
+
+// ValidateFilesystemIDs checks the labels and uuids of the partitions to be formatted
+// are valid and unique across all medias, fstab entries are written by label or uuid so
+// a duplicate would make the target system mount the wrong partition
+func ValidateFilesystemIDs(medias []*BlockDevice) error {
+	labels := map[string][]*BlockDevice{}
+	uuids := map[string][]*BlockDevice{}
+
+	for _, bd := range medias {
+		for _, ch := range bd.Children {
+			if ch.Label != "" {
+				labels[ch.Label] = append(labels[ch.Label], ch)
+			}
+
+			if uuid := strings.ToLower(ch.filesystemUUID()); uuid != "" {
+				uuids[uuid] = append(uuids[uuid], ch)
+			}
+		}
+	}
+
+	for _, bd := range medias {
+		for _, ch := range bd.Children {
+			if !ch.FormatPartition {
+				continue
+			}
+
+			if msg := IsValidLabel(ch.Label, ch.FsType); msg != "" {
+				return errors.ValidationErrorf("Partition %s label %q: %s", ch.Name, ch.Label, msg)
+			}
+
+			if msg := IsValidUUID(ch.NewUUID, ch.FsType); msg != "" {
+				return errors.ValidationErrorf("Partition %s uuid %q: %s", ch.Name, ch.NewUUID, msg)
+			}
+
+			if ch.Label != "" && len(labels[ch.Label]) > 1 {
+				return errors.ValidationErrorf("Partition %s label %q is not unique", ch.Name, ch.Label)
+			}
+
+			if ch.NewUUID != "" && len(uuids[strings.ToLower(ch.NewUUID)]) > 1 {
+				return errors.ValidationErrorf("Partition %s uuid %q is not unique", ch.Name, ch.NewUUID)
+			}
+		}
+	}
+
+	return nil
+}
+
+// filesystemUUID returns the uuid of the file system bd has after the install:
+// the new file system uuid set by the user, empty if it's generated by mkfs, or
+// the current one of a partition which is not formatted
+func (bd *BlockDevice) filesystemUUID() string {
+	if bd.FormatPartition {
+		return bd.NewUUID
+	}
+
+	return bd.UUID
+}
+
 // IsValidMount returns empty string if mount point is a valid directory for mounting
 func IsValidMount(str string) string {
 	if !mountExp.MatchString(str) {
@@ -1144,6 +1418,11 @@ func (bd *BlockDevice) UnmarshalJSON(b []byte) error {
 			if err != nil {
 				return err
 			}
+		case "rota":
+			bd.Rotational, err = getNextBoolToken(dec, "rota")
+			if err != nil {
+				return err
+			}
 		case "children":
 			bd.Children = []*BlockDevice{}
 			err := dec.Decode(&bd.Children)
@@ -1165,7 +1444,7 @@ func (bd *BlockDevice) MarshalYAML() (interface{}, error) {
 	bdm.Model = bd.Model
 	bdm.MajorMinor = bd.MajorMinor
 	bdm.FsType = bd.FsType
-	bdm.UUID = bd.UUID
+	bdm.UUID = bd.filesystemUUID()
 	bdm.Serial = bd.Serial
 	bdm.MountPoint = bd.MountPoint
 	bdm.Label = bd.Label
@@ -1176,6 +1455,14 @@ func (bd *BlockDevice) MarshalYAML() (interface{}, error) {
 	bdm.State = bd.State.String()
 	bdm.Children = bd.Children
 	bdm.Options = bd.Options
+	bdm.VolumeGroup = bd.VolumeGroup
+	bdm.RAIDLevel = bd.RAIDLevel
+	bdm.RAIDMetadata = bd.RAIDMetadata
+	bdm.Members = bd.Members
+	bdm.Encryption = bd.Encryption
+	bdm.Discard = bd.Discard
+	bdm.Resize = bd.Resize
+	bdm.Subvolumes = bd.Subvolumes
 
 	return bdm, nil
 }
@@ -1199,6 +1486,14 @@ func (bd *BlockDevice) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	bd.Label = unmarshBlockDevice.Label
 	bd.Children = unmarshBlockDevice.Children
 	bd.Options = unmarshBlockDevice.Options
+	bd.VolumeGroup = unmarshBlockDevice.VolumeGroup
+	bd.RAIDLevel = unmarshBlockDevice.RAIDLevel
+	bd.RAIDMetadata = unmarshBlockDevice.RAIDMetadata
+	bd.Members = unmarshBlockDevice.Members
+	bd.Encryption = unmarshBlockDevice.Encryption
+	bd.Discard = unmarshBlockDevice.Discard
+	bd.Resize = unmarshBlockDevice.Resize
+	bd.Subvolumes = unmarshBlockDevice.Subvolumes
 	// Convert String to Uint64
 	if unmarshBlockDevice.Size != "" {
 		uSize, err := ParseVolumeSize(unmarshBlockDevice.Size)
@@ -1223,6 +1518,17 @@ func (bd *BlockDevice) UnmarshalYAML(unmarshal func(interface{}) error) error {
 		}
 	}
 
+	// A resized partition is an existing one, neither created nor formatted
+	if bd.Resize {
+		bd.MakePartition = false
+		bd.FormatPartition = false
+	}
+
+	// A partition with an encryption format is created as a LUKS container
+	if bd.Encryption != "" && bd.Type == BlockDeviceTypePart {
+		bd.Type = BlockDeviceTypeCrypt
+	}
+
 	// Map the BlockDeviceState
 	if unmarshBlockDevice.State != "" {
 		iState, err := parseBlockDeviceState(unmarshBlockDevice.State)
@@ -1250,6 +1556,11 @@ func (bd *BlockDevice) UnmarshalYAML(unmarshal func(interface{}) error) error {
 		bd.RemovableDevice = bRemovableDevice
 	}
 
+	// the uuid of a formatted partition is the one of its new file system
+	if bd.FormatPartition {
+		bd.NewUUID = bd.UUID
+	}
+
 	return nil
 }
 
@@ -1258,6 +1569,11 @@ func SupportedFileSystems() []string {
 	res := []string{}
 
 	for key := range bdOps {
+		// the physical volumes and RAID members are set up with LVM and
+		// mdadm, not as file systems
+		if key == LVMPhysicalVolume || key == RAIDMember {
+			continue
+		}
 		res = append(res, key)
 	}
 
@@ -1269,7 +1585,7 @@ func SupportedFileSystems() []string {
 func LargestFileSystemName() int {
 	res := 0
 
-	for key := range bdOps {
+	for _, key := range SupportedFileSystems() {
 		fsl := len(key)
 		if fsl > res {
 			res = fsl
@@ -1354,6 +1670,16 @@ func AddRootStandardPartition(disk *BlockDevice, rootSize uint64) {
 // NewStandardPartitions will add to disk a new set of partitions representing a
 // default set of partitions required for an installation
 func NewStandardPartitions(disk *BlockDevice) {
+	newStandardPartitions(disk, true)
+}
+
+// NewStandardPartitionsNoSwap adds to disk the standard partitions but the
+// swap one, the root partition takes its space; used with a swap file
+func NewStandardPartitionsNoSwap(disk *BlockDevice) {
+	newStandardPartitions(disk, false)
+}
+
+func newStandardPartitions(disk *BlockDevice, swap bool) {
 	disk.Children = nil
 	newFreePart := &PartedPartition{
 		Number:     0,
@@ -1365,7 +1691,10 @@ func NewStandardPartitions(disk *BlockDevice) {
 	disk.PartTable = nil
 	disk.PartTable = append(disk.PartTable, newFreePart)
 
-	rootSize := uint64(disk.Size - bootSize - swapSize)
+	rootSize := uint64(disk.Size - bootSize)
+	if swap {
+		rootSize = rootSize - swapSize
+	}
 
 	freePart := disk.findFree(bootSize)
 	disk.AddFromFreePartition(freePart, &BlockDevice{
@@ -1379,16 +1708,18 @@ func NewStandardPartitions(disk *BlockDevice) {
 		FormatPartition: true,
 	})
 
-	freePart = disk.findFree(swapSize)
-	disk.AddFromFreePartition(freePart, &BlockDevice{
-		Size:            swapSize,
-		Type:            BlockDeviceTypePart,
-		FsType:          "swap",
-		Label:           "swap",
-		UserDefined:     true,
-		MakePartition:   true,
-		FormatPartition: true,
-	})
+	if swap {
+		freePart = disk.findFree(swapSize)
+		disk.AddFromFreePartition(freePart, &BlockDevice{
+			Size:            swapSize,
+			Type:            BlockDeviceTypePart,
+			FsType:          "swap",
+			Label:           "swap",
+			UserDefined:     true,
+			MakePartition:   true,
+			FormatPartition: true,
+		})
+	}
 
 	freePart = disk.findFree(rootSize)
 	disk.AddFromFreePartition(freePart, &BlockDevice{
@@ -1403,6 +1734,108 @@ func NewStandardPartitions(disk *BlockDevice) {
 	})
 }
 
+// AddHomeStandardPartition splits the new root partition of disk, as added by the
+// standard partitioning, in a root partition and a /home partition using the remaining
+// space; the new /home partition is returned
+func AddHomeStandardPartition(disk *BlockDevice) (*BlockDevice, error) {
+	var root *BlockDevice
+
+	for _, ch := range disk.Children {
+		if ch.MountPoint == "/" {
+			root = ch
+			break
+		}
+	}
+
+	if root == nil || !root.MakePartition {
+		return nil, errors.Errorf("A new root partition is required to add a /home partition")
+	}
+
+	rootSize := root.Size / 2
+	if rootSize > MinimumDesktopInstallSize {
+		rootSize = MinimumDesktopInstallSize
+	}
+
+	if rootSize < MinimumServerInstallSize {
+		return nil, errors.Errorf("Not enough space for a separate /home partition")
+	}
+
+	homeSize := root.Size - rootSize
+
+	// the root partition space is split in two, it must be found in the
+	// partition table before the root partition is removed
+	partNumber, err := strconv.ParseUint(devNameSuffixExp.FindString(root.Name), 10, 64)
+	if err != nil {
+		return nil, errors.Errorf("Could not find the partition number of %s", root.Name)
+	}
+
+	var space *PartedPartition
+	for _, curr := range disk.PartTable {
+		if curr.Number == partNumber {
+			space = curr
+		}
+	}
+
+	if space == nil || space.Size < rootSize+homeSize {
+		return nil, errors.Errorf("Not enough space for a separate /home partition")
+	}
+
+	disk.RemovePartition(root)
+
+	// let the partition name be assigned again when re-added
+	root.Name = ""
+	root.Size = rootSize
+	disk.AddFromFreePartition(disk.findFree(rootSize), root)
+
+	home := &BlockDevice{
+		Size:            homeSize,
+		Type:            BlockDeviceTypePart,
+		FsType:          "ext4",
+		MountPoint:      "/home",
+		Label:           "home",
+		UserDefined:     true,
+		MakePartition:   true,
+		FormatPartition: true,
+	}
+
+	freePart := disk.findFree(homeSize)
+	if freePart == nil {
+		return nil, errors.Errorf("Not enough space for a separate /home partition")
+	}
+	disk.AddFromFreePartition(freePart, home)
+
+	return home, nil
+}
+
+// SetTaskLog sets the writer of the output of the commands run on bd and its
+// children, i.e. the log.TaskWriter() of the install task preparing them
+func (bd *BlockDevice) SetTaskLog(w io.Writer) {
+	bd.taskLog = w
+
+	for _, ch := range bd.Children {
+		ch.SetTaskLog(w)
+	}
+}
+
+// runAndLog runs a command on bd, its output is logged or written to the task
+// log of bd if set
+func (bd *BlockDevice) runAndLog(args ...string) error {
+	if bd.taskLog == nil {
+		return cmd.RunAndLog(args...)
+	}
+
+	return cmd.Run(bd.taskLog, args...)
+}
+
+// pipeRunAndLog is similar to runAndLog but also writes in to the command stdin
+func (bd *BlockDevice) pipeRunAndLog(in string, args ...string) error {
+	if bd.taskLog == nil {
+		return cmd.PipeRunAndLog(in, args...)
+	}
+
+	return cmd.PipeRun(in, bd.taskLog, args...)
+}
+
 // PartProbe runs partprobe against the block device's file
 func (bd *BlockDevice) PartProbe() error {
 	args := []string{
@@ -1410,7 +1843,7 @@ func (bd *BlockDevice) PartProbe() error {
 		bd.GetDeviceFile(),
 	}
 
-	if err := cmd.RunAndLog(args...); err != nil {
+	if err := bd.runAndLog(args...); err != nil {
 		log.Warning("PartProbe has non-zero exit status: %s", err)
 	}
 
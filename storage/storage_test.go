@@ -6,13 +6,17 @@ package storage
 
 import (
 	"bytes"
+	"io"
 	"io/ioutil"
 	"os"
 	"path"
+	"sort"
+	"strings"
 	"testing"
 	"text/template"
 	"time"
 
+	"github.com/clearlinux/clr-installer/errors"
 	"github.com/clearlinux/clr-installer/progress"
 	"github.com/clearlinux/clr-installer/utils"
 )
@@ -572,7 +576,7 @@ func TestWritePartition(t *testing.T) {
 		bd.Children = children
 
 		//write the partition table
-		if err = bd.WritePartitionTable(false, true); err != nil {
+		if err = bd.WritePartitionTable(false, true, progress.Reporter{}); err != nil {
 			t.Fatalf("Could not write partition table (%s): %s", file, err)
 		}
 
@@ -771,6 +775,138 @@ func TestInvalidLabels(t *testing.T) {
 	}
 }
 
+func TestValidUUIDs(t *testing.T) {
+	uuidInfo := []struct {
+		fstype string
+		uuid   string
+	}{
+		{"ext4", ""},
+		{"ext4", "0b6b3c1a-7f3e-4a4e-9e4f-2d3c5b6a7e8f"},
+		{"xfs", "0B6B3C1A-7F3E-4A4E-9E4F-2D3C5B6A7E8F"},
+		{"btrfs", "0b6b3c1a-7f3e-4a4e-9e4f-2d3c5b6a7e8f"},
+		{"swap", "0b6b3c1a-7f3e-4a4e-9e4f-2d3c5b6a7e8f"},
+		{"vfat", "1A2B-3C4D"},
+		{"vfat", "1a2b3c4d"},
+	}
+
+	for _, curr := range uuidInfo {
+		if result := IsValidUUID(curr.uuid, curr.fstype); result != "" {
+			t.Fatalf("UUID %q should be valid for fstype %q: %s", curr.uuid, curr.fstype, result)
+		}
+	}
+}
+
+func TestInvalidUUIDs(t *testing.T) {
+	uuidInfo := []struct {
+		fstype string
+		uuid   string
+	}{
+		{"ext4", "0b6b3c1a7f3e4a4e9e4f2d3c5b6a7e8f"},
+		{"ext4", "0b6b3c1a-7f3e-4a4e-9e4f-2d3c5b6a7e8"},
+		{"xfs", "zb6b3c1a-7f3e-4a4e-9e4f-2d3c5b6a7e8f"},
+		{"ext4", "1A2B-3C4D"},
+		{"vfat", "0b6b3c1a-7f3e-4a4e-9e4f-2d3c5b6a7e8f"},
+		{"vfat", "1A2B-3C4"},
+		{"vfat", "1A2B-3C4G"},
+	}
+
+	for _, curr := range uuidInfo {
+		if result := IsValidUUID(curr.uuid, curr.fstype); result == "" {
+			t.Fatalf("UUID %q should be INVALID for fstype %q", curr.uuid, curr.fstype)
+		}
+	}
+}
+
+func TestValidateFilesystemIDs(t *testing.T) {
+	newDisk := func() *BlockDevice {
+		return &BlockDevice{
+			Name: "sda",
+			Type: BlockDeviceTypeDisk,
+			Children: []*BlockDevice{
+				{Name: "sda1", FsType: "vfat", Label: "boot", NewUUID: "1A2B-3C4D", FormatPartition: true},
+				{Name: "sda2", FsType: "ext4", Label: "root", FormatPartition: true},
+				{Name: "sda3", FsType: "ext4", Label: "data", UUID: "0b6b3c1a-7f3e-4a4e-9e4f-2d3c5b6a7e8f"},
+			},
+		}
+	}
+
+	if err := ValidateFilesystemIDs([]*BlockDevice{newDisk()}); err != nil {
+		t.Fatalf("Unique labels and uuids should be valid: %s", err)
+	}
+
+	bd := newDisk()
+	bd.Children[1].Label = "data"
+	if err := ValidateFilesystemIDs([]*BlockDevice{bd}); err == nil {
+		t.Fatal("Duplicated label should be INVALID")
+	}
+
+	bd = newDisk()
+	bd.Children[1].NewUUID = "0B6B3C1A-7F3E-4A4E-9E4F-2D3C5B6A7E8F"
+	if err := ValidateFilesystemIDs([]*BlockDevice{bd}); err == nil {
+		t.Fatal("Duplicated uuid should be INVALID")
+	}
+
+	bd = newDisk()
+	bd.Children[1].NewUUID = "not-a-uuid"
+	if err := ValidateFilesystemIDs([]*BlockDevice{bd}); err == nil {
+		t.Fatal("Malformed uuid should be INVALID")
+	} else if !errors.IsValidationError(err) {
+		t.Fatalf("Malformed uuid should be a validation error: %v", err)
+	}
+
+	// The current uuid of a reformatted partition is dropped with its file system
+	bd = newDisk()
+	bd.Children[0].NewUUID = ""
+	bd.Children[1].UUID = "1A2B-3C4D"
+	bd.Children[2].FormatPartition = true
+	bd.Children[2].FsType = "xfs"
+	if err := ValidateFilesystemIDs([]*BlockDevice{bd}); err != nil {
+		t.Fatalf("Current uuids of reformatted partitions should not be checked: %s", err)
+	}
+
+	if args := getMakeFsUUID(bd.Children[1]); len(args) != 0 {
+		t.Fatalf("The current uuid should not be passed to mkfs, got: %v", args)
+	}
+
+	// Partitions not formatted by the install keep their ids
+	bd = newDisk()
+	bd.Children[2].Label = "bad label!"
+	if err := ValidateFilesystemIDs([]*BlockDevice{bd}); err != nil {
+		t.Fatalf("Labels of not formatted partitions should not be checked: %s", err)
+	}
+
+	other := newDisk()
+	other.Name = "sdb"
+	other.Children = other.Children[:1]
+	other.Children[0].Label = "efi"
+	if err := ValidateFilesystemIDs([]*BlockDevice{newDisk(), other}); err == nil {
+		t.Fatal("Duplicated uuid across medias should be INVALID")
+	}
+}
+
+func TestMakeFsUUID(t *testing.T) {
+	uuid := "0b6b3c1a-7f3e-4a4e-9e4f-2d3c5b6a7e8f"
+	uuidInfo := []struct {
+		fstype string
+		uuid   string
+		args   string
+	}{
+		{"ext4", "", ""},
+		{"ext4", uuid, "-U " + uuid},
+		{"btrfs", uuid, "-U " + uuid},
+		{"swap", uuid, "-U " + uuid},
+		{"xfs", uuid, "-m uuid=" + uuid},
+		{"vfat", "1A2B-3C4D", "-i 1A2B3C4D"},
+	}
+
+	for _, curr := range uuidInfo {
+		bd := &BlockDevice{FsType: curr.fstype, NewUUID: curr.uuid}
+		if args := strings.Join(getMakeFsUUID(bd), " "); args != curr.args {
+			t.Fatalf("Expected mkfs uuid arguments %q for fstype %q, got: %q", curr.args, curr.fstype, args)
+		}
+	}
+}
+
 func TestValidPassphrase(t *testing.T) {
 	passphrases := []string{
 		"password",
@@ -806,6 +942,59 @@ func TestInvalidPassphrase(t *testing.T) {
 	}
 }
 
+func TestPassphraseStrength(t *testing.T) {
+	passphrases := map[string]int{
+		"P@ss":                 0,
+		"password":             1,
+		"Password1":            3,
+		"P@ssW0rd":             MaxPassphraseStrength,
+		"correct horse staple": 3,
+	}
+
+	for phrase, expected := range passphrases {
+		if strength, name := PassphraseStrength(phrase); strength != expected || name == "" {
+			t.Fatalf("Passphrase %q should have strength %d, got: %d %q", phrase, expected, strength, name)
+		}
+	}
+}
+
+func TestEncryptionFormat(t *testing.T) {
+	var bd BlockDevice
+
+	unmarshal := func(v interface{}) error {
+		*v.(*blockDeviceYAMLMarshal) = blockDeviceYAMLMarshal{
+			Name: "sda3", Type: "part", Encryption: EncryptionLUKS1, MountPoint: "/",
+		}
+		return nil
+	}
+
+	if err := bd.UnmarshalYAML(unmarshal); err != nil {
+		t.Fatalf("Should have parsed the encrypted partition: %v", err)
+	}
+
+	if bd.Type != BlockDeviceTypeCrypt || bd.luksFormat() != EncryptionLUKS1 {
+		t.Fatalf("Expected a LUKS1 crypt partition, got: %v %s", bd.Type, bd.luksFormat())
+	}
+
+	if err := bd.validateEncryption(); err != nil {
+		t.Fatalf("Should have validated the LUKS1 partition: %v", err)
+	}
+
+	bd.Label = "root"
+	if err := bd.validateEncryption(); err == nil {
+		t.Fatal("Should have refused a labeled LUKS1 partition")
+	}
+
+	bd.Encryption = "luks3"
+	if err := bd.validateEncryption(); err == nil {
+		t.Fatal("Should have refused an unknown encryption format")
+	}
+
+	if (&BlockDevice{Type: BlockDeviceTypeCrypt}).luksFormat() != EncryptionLUKS2 {
+		t.Fatal("The crypt partitions should default to LUKS2")
+	}
+}
+
 func TestValidMakeFsCommand(t *testing.T) {
 	lsblkOutput := `{
    "blockdevices": [
@@ -1016,3 +1205,1418 @@ func TestAddPartititions(t *testing.T) {
 	rootSize := uint64(bd.Size - bootSize - swapSize)
 	AddRootStandardPartition(bd, rootSize)
 }
+
+func TestAddHomeStandardPartition(t *testing.T) {
+	var twoHundredGig uint64 = 214748364800
+
+	disk := &BlockDevice{Name: "sda", Type: BlockDeviceTypeDisk, Size: twoHundredGig}
+	NewStandardPartitions(disk)
+
+	if err := EncryptStandardPartitions(disk, true); err != nil {
+		t.Fatalf("Should have added an encrypted /home partition: %s", err)
+	}
+
+	var root, home *BlockDevice
+	for _, ch := range disk.Children {
+		switch ch.MountPoint {
+		case "/":
+			root = ch
+		case "/home":
+			home = ch
+		}
+	}
+
+	if root == nil || home == nil {
+		t.Fatalf("Both root and /home partitions are expected: %v", disk.Children)
+	}
+
+	if root.Type == BlockDeviceTypeCrypt || home.Type != BlockDeviceTypeCrypt {
+		t.Fatal("Only the /home partition should be encrypted")
+	}
+
+	if root.Size != MinimumDesktopInstallSize || root.Size+home.Size != twoHundredGig-bootSize-swapSize {
+		t.Fatalf("Unexpected root size %d and /home size %d", root.Size, home.Size)
+	}
+
+	if root.Name == home.Name {
+		t.Fatalf("Root and /home partitions must have different names: %s", root.Name)
+	}
+
+	small := &BlockDevice{Name: "sdb", Type: BlockDeviceTypeDisk, Size: MinimumServerInstallSize}
+	NewStandardPartitions(small)
+
+	if _, err := AddHomeStandardPartition(small); err == nil {
+		t.Fatal("Should not have enough space for a /home partition")
+	}
+}
+
+func TestAddHomeStandardPartitionNoSpace(t *testing.T) {
+	var twoHundredGig uint64 = 214748364800
+
+	disk := &BlockDevice{Name: "sda", Type: BlockDeviceTypeDisk, Size: twoHundredGig}
+	NewStandardPartitions(disk)
+
+	var root *BlockDevice
+	for _, ch := range disk.Children {
+		if ch.MountPoint == "/" {
+			root = ch
+		}
+	}
+
+	if root == nil {
+		t.Fatalf("A root partition is expected: %v", disk.Children)
+	}
+
+	// the partition table no longer has the root partition space
+	for _, curr := range disk.PartTable {
+		if curr.Number == 3 {
+			curr.Size = root.Size / 2
+		}
+	}
+
+	if _, err := AddHomeStandardPartition(disk); err == nil {
+		t.Fatal("Should not have enough space for a /home partition")
+	}
+
+	found := false
+	for _, ch := range disk.Children {
+		if ch == root && ch.MountPoint == "/" {
+			found = true
+		}
+	}
+
+	if !found {
+		t.Fatalf("The root partition should have been kept: %v", disk.Children)
+	}
+}
+
+func TestFscrypt(t *testing.T) {
+	root := &BlockDevice{Name: "sda3", Type: BlockDeviceTypePart, FsType: "ext4",
+		MountPoint: "/", FormatPartition: true}
+	disk := &BlockDevice{Name: "sda", Type: BlockDeviceTypeDisk, Children: []*BlockDevice{root}}
+	medias := []*BlockDevice{disk}
+
+	if home := HomeFilesystem(medias); home != root {
+		t.Fatalf("The root partition should hold /home, got: %v", home)
+	}
+
+	if err := ValidateFscrypt(medias); err != nil {
+		t.Fatalf("A new ext4 root should support fscrypt: %v", err)
+	}
+
+	home := &BlockDevice{Name: "sda4", Type: BlockDeviceTypePart, FsType: "xfs",
+		MountPoint: "/home", FormatPartition: true}
+	disk.Children = append(disk.Children, home)
+
+	if curr := HomeFilesystem(medias); curr != home {
+		t.Fatalf("The /home partition should be returned, got: %v", curr)
+	}
+
+	if err := ValidateFscrypt(medias); err == nil || !errors.IsValidationError(err) {
+		t.Fatalf("A xfs /home should fail with a validation error, got: %v", err)
+	}
+
+	home.FsType = "ext4"
+	home.FormatPartition = false
+	if err := ValidateFscrypt(medias); err == nil {
+		t.Fatal("An existing /home file system should not be supported")
+	}
+
+	home.FormatPartition = true
+	home.Options = "-m 1"
+	EnableFscrypt(medias)
+	EnableFscrypt(medias)
+
+	if home.Options != "-m 1 -O encrypt" || root.Options != "" {
+		t.Fatalf("Only the /home file system should be encrypted, got: %q", home.Options)
+	}
+
+	if err := ValidateFscrypt(nil); err == nil {
+		t.Fatal("Should fail without a /home or root partition")
+	}
+}
+
+func TestGenerateRecoveryKey(t *testing.T) {
+	key, err := GenerateRecoveryKey()
+	if err != nil {
+		t.Fatalf("Should have generated a recovery key: %v", err)
+	}
+
+	groups := strings.Split(key, "-")
+	if len(groups) != 8 {
+		t.Fatalf("Recovery key %q should have 8 groups, got: %d", key, len(groups))
+	}
+
+	for _, curr := range groups {
+		if len(curr) != recoveryKeyGroupLen {
+			t.Fatalf("Recovery key %q has an invalid group: %q", key, curr)
+		}
+	}
+
+	if ok, msg := IsValidPassphrase(key); !ok {
+		t.Fatalf("Recovery key %q should be a valid passphrase: %s", key, msg)
+	}
+
+	other, err := GenerateRecoveryKey()
+	if err != nil {
+		t.Fatalf("Should have generated a recovery key: %v", err)
+	}
+
+	if key == other {
+		t.Fatalf("Recovery keys should be random, got twice: %q", key)
+	}
+}
+
+func TestCryptKeysPrepare(t *testing.T) {
+	dir, err := ioutil.TempDir("", "clr-installer-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	keyFile := path.Join(dir, "secret.key")
+	if err = ioutil.WriteFile(keyFile, []byte("secret"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	keys := &CryptKeys{
+		Recovery:     true,
+		RecoveryFile: path.Join(dir, "recovery.txt"),
+		KeyFile:      "file:" + keyFile,
+	}
+
+	if err = keys.Prepare(); err != nil {
+		t.Fatalf("Should have prepared the keys: %v", err)
+	}
+
+	content, err := ioutil.ReadFile(keys.RecoveryFile)
+	if err != nil {
+		t.Fatalf("Should have exported the recovery key: %v", err)
+	}
+
+	if strings.TrimSpace(string(content)) != keys.RecoveryKey {
+		t.Fatalf("Exported recovery key %q doesn't match %q", content, keys.RecoveryKey)
+	}
+
+	if string(keys.keyFile) != "secret" {
+		t.Fatalf("Key file content should be \"secret\", got: %q", keys.keyFile)
+	}
+
+	keys = &CryptKeys{KeyFile: "invalid"}
+	if err = keys.Prepare(); err == nil {
+		t.Fatal("Should have failed with an invalid secret reference")
+	}
+}
+
+func TestPassphrasePolicy(t *testing.T) {
+	var keys *CryptKeys
+	if keys.PassphrasePolicy() != PassphrasePrompt {
+		t.Fatalf("Expected the %s default policy, got: %s", PassphrasePrompt, keys.PassphrasePolicy())
+	}
+
+	tests := []struct {
+		keys  *CryptKeys
+		valid bool
+	}{
+		{&CryptKeys{}, true},
+		{&CryptKeys{Passphrase: PassphraseTPM}, true},
+		{&CryptKeys{Passphrase: PassphraseUSBKeyFile, PassphraseDevice: "/dev/sdb1"}, true},
+		{&CryptKeys{Passphrase: "keyring"}, false},
+		{&CryptKeys{Passphrase: PassphraseUSBKeyFile}, false},
+		{&CryptKeys{Passphrase: PassphraseUSBKeyFile, PassphraseDevice: "sdb1"}, false},
+		{&CryptKeys{Passphrase: PassphraseTPM, PassphraseDevice: "/dev/sdb1"}, false},
+	}
+
+	for i, curr := range tests {
+		err := curr.keys.Validate()
+
+		if curr.valid && err != nil {
+			t.Fatalf("Test %d should pass: %v", i, err)
+		}
+
+		if !curr.valid && err == nil {
+			t.Fatalf("Test %d should fail", i)
+		}
+	}
+
+	keys = &CryptKeys{Passphrase: PassphraseTPM}
+	passphrase, err := keys.ReadPassphrase()
+	if err != nil || len(passphrase) != generatedPassphraseBytes*2 || !keys.generatedPassphrase {
+		t.Fatalf("Expected a generated passphrase, got: %q %v", passphrase, err)
+	}
+
+	if _, err = (&CryptKeys{}).ReadPassphrase(); err == nil {
+		t.Fatal("The prompt policy should have no passphrase to read")
+	}
+
+	rootDir, err := ioutil.TempDir("", "clr-installer-storage-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(rootDir) }()
+
+	srv := &BlockDevice{Name: "sdb1", Type: BlockDeviceTypeCrypt, FsType: "ext4", MountPoint: "/srv",
+		UUID: "a3ea1ecb-1e2f-44b4-8e23-4bbe4c4c1c59", MappedName: "/dev/mapper/luks-srv", Discard: true}
+	disk := &BlockDevice{Name: "sdb", Type: BlockDeviceTypeDisk, Children: []*BlockDevice{srv}}
+
+	EnableTPMUnlock([]*BlockDevice{disk})
+	if err = GenerateTabFiles(rootDir, []*BlockDevice{disk}); err != nil {
+		t.Fatal(err)
+	}
+
+	crypttab, err := ioutil.ReadFile(path.Join(rootDir, "etc", "crypttab"))
+	if err != nil || !strings.Contains(string(crypttab), " none discard,tpm2-device=auto") {
+		t.Fatalf("Expected the TPM unlock of the encrypted partition, got: %q %v", crypttab, err)
+	}
+}
+
+func TestParseSchedulers(t *testing.T) {
+	current, available := parseSchedulers("none [mq-deadline] kyber bfq\n")
+
+	if current != "mq-deadline" {
+		t.Fatalf("Current scheduler should be mq-deadline, got: %q", current)
+	}
+
+	if strings.Join(available, ",") != "none,mq-deadline,kyber,bfq" {
+		t.Fatalf("Unexpected available schedulers: %v", available)
+	}
+}
+
+func TestTuneDevice(t *testing.T) {
+	dir, err := ioutil.TempDir("", "clr-installer-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	prevDir := sysBlockDir
+	sysBlockDir = dir
+	defer func() { sysBlockDir = prevDir }()
+
+	queueDir := path.Join(dir, "sda", "queue")
+	if err = os.MkdirAll(queueDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	schedFile := path.Join(queueDir, "scheduler")
+	if err = ioutil.WriteFile(schedFile, []byte("[none] mq-deadline kyber\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	stat := "1 2 3 4 2048 6 7 8 9 10 11\n"
+	if err = ioutil.WriteFile(path.Join(dir, "sda", "stat"), []byte(stat), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	bd := &BlockDevice{Name: "sda"}
+
+	tuning, err := TuneDevice(bd)
+	if err != nil {
+		t.Fatalf("Should have tuned the device: %v", err)
+	}
+
+	content, _ := ioutil.ReadFile(schedFile)
+	if string(content) != "mq-deadline" {
+		t.Fatalf("Scheduler should be set to mq-deadline, got: %q", content)
+	}
+
+	if err = tuning.Restore(); err != nil {
+		t.Fatalf("Should have restored the device: %v", err)
+	}
+
+	content, _ = ioutil.ReadFile(schedFile)
+	if string(content) != "none" {
+		t.Fatalf("Scheduler should be restored to none, got: %q", content)
+	}
+
+	written, err := BytesWritten(bd)
+	if err != nil {
+		t.Fatalf("Should have read the device statistics: %v", err)
+	}
+
+	if written != 7*sectorSize {
+		t.Fatalf("Written bytes should be %d, got: %d", 7*sectorSize, written)
+	}
+}
+
+func TestDiagnoseMediaScan(t *testing.T) {
+	dir, err := ioutil.TempDir("", "clr-installer-diagnose-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	savedBlock, savedPCI, savedModule := sysBlockDir, sysPCIDevicesDir, sysModuleDir
+	defer func() {
+		sysBlockDir, sysPCIDevicesDir, sysModuleDir = savedBlock, savedPCI, savedModule
+	}()
+
+	sysBlockDir = path.Join(dir, "block")
+	sysPCIDevicesDir = path.Join(dir, "devices")
+	sysModuleDir = path.Join(dir, "module")
+
+	controllers := map[string]string{
+		"0000:00:17.0": "0x010601\n",
+		"0000:01:00.0": "0x010802\n",
+		"0000:02:00.0": "0x020000\n",
+	}
+
+	for name, class := range controllers {
+		if err = os.MkdirAll(path.Join(sysPCIDevicesDir, name), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err = ioutil.WriteFile(path.Join(sysPCIDevicesDir, name, "class"), []byte(class), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, dir := range []string{sysBlockDir, path.Join(sysModuleDir, "ahci")} {
+		if err = os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	modules := []string{}
+	for _, curr := range DiagnoseMediaScan() {
+		if curr.Module != "" {
+			modules = append(modules, curr.Module)
+		}
+	}
+
+	if len(modules) != 1 || modules[0] != "nvme" {
+		t.Fatalf("Only the nvme module should be missing, got: %v", modules)
+	}
+}
+
+func TestPersistentMemory(t *testing.T) {
+	disk := &BlockDevice{Name: "pmem0", Type: BlockDeviceTypeDisk}
+	root := &BlockDevice{Name: "pmem0p3", FsType: "ext4", MountPoint: "/", Type: BlockDeviceTypePart}
+	boot := &BlockDevice{Name: "pmem0p1", FsType: "vfat", MountPoint: "/boot", Type: BlockDeviceTypePart}
+	disk.AddChild(boot)
+	disk.AddChild(root)
+
+	if !root.IsPersistentMemory() || !root.SupportsDAX() {
+		t.Fatal("The ext4 partition of pmem0 should support DAX")
+	}
+
+	if boot.SupportsDAX() || boot.getMountOptions() != "" {
+		t.Fatal("The vfat partition of pmem0 should not support DAX")
+	}
+
+	if !PersistentMemoryRoot([]*BlockDevice{disk}) {
+		t.Fatal("The root partition should be on persistent memory")
+	}
+
+	if disk.getBasePartitionName() != "pmem0p" {
+		t.Fatalf("Invalid pmem partition name: %s", disk.getBasePartitionName())
+	}
+
+	sector := &BlockDevice{Name: "pmem0s", Type: BlockDeviceTypeDisk}
+	if sector.IsPersistentMemory() {
+		t.Fatal("A sector mode namespace has no direct access")
+	}
+}
+
+func TestESPPolicy(t *testing.T) {
+	newDisk := func() *BlockDevice {
+		disk := &BlockDevice{Name: "sda", Type: BlockDeviceTypeDisk, Size: 4000000000}
+		disk.PartTable = []*PartedPartition{
+			{Number: 1, Start: 0, End: 300000000, Size: 300000000, FileSystem: "fat32", Flags: "boot, esp"},
+			{Number: 0, Start: 300000000, End: 4000000000, Size: 3700000000, FileSystem: "free"},
+		}
+		disk.AddChild(&BlockDevice{Name: "sda1", FsType: "vfat", Type: BlockDeviceTypePart})
+		return disk
+	}
+
+	disk := newDisk()
+	esp := disk.FindESP()
+	if esp == nil || esp.Name != "sda1" {
+		t.Fatal("Should have found the sda1 EFI System Partition")
+	}
+
+	if (&BlockDevice{Name: "sdb", Type: BlockDeviceTypeDisk}).FindESP() != nil {
+		t.Fatal("A disk with no partition has no EFI System Partition")
+	}
+
+	size, err := AddBootPartition(disk, ESPPolicyReplace)
+	if err != nil || size != 0 {
+		t.Fatalf("Replacing the ESP should take no free space: %d, %v", size, err)
+	}
+
+	if esp.MountPoint != "/boot" || !esp.FormatPartition || esp.MakePartition {
+		t.Fatalf("The replaced ESP should be formatted and mounted to /boot: %+v", esp)
+	}
+
+	disk = newDisk()
+	if size, err = AddBootPartition(disk, ESPPolicyCreate); err != nil || size != bootSize {
+		t.Fatalf("Creating an ESP should take %d bytes: %d, %v", bootSize, size, err)
+	}
+
+	if len(disk.Children) != 2 || disk.FindESP().MountPoint != "" {
+		t.Fatal("The existing ESP should be kept untouched next to the new one")
+	}
+
+	if _, err = AddBootPartition(newDisk(), "bogus"); err == nil {
+		t.Fatal("Should have failed with an invalid policy")
+	}
+}
+
+func TestFindBootEntries(t *testing.T) {
+	dir, err := ioutil.TempDir("", "clr-installer-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	files := map[string]string{
+		"loader/entries/Clear-linux-native-5.3.1-850.conf": "title Clear Linux OS\n",
+		"loader/entries/fedora.conf":                       "title Fedora 31\nlinux /vmlinuz\n",
+		"loader/entries/arch.conf":                         "linux /vmlinuz-linux\n",
+		"EFI/Microsoft/Boot/bootmgfw.efi":                  "",
+	}
+
+	for file, content := range files {
+		if err = os.MkdirAll(path.Dir(path.Join(dir, file)), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err = ioutil.WriteFile(path.Join(dir, file), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	found := []string{}
+	for _, curr := range findBootEntries(dir) {
+		found = append(found, curr.ID+"="+curr.Title)
+	}
+
+	expected := "arch=arch,fedora=Fedora 31,auto-windows=Windows Boot Manager"
+	if strings.Join(found, ",") != expected {
+		t.Fatalf("Expected boot entries %q, got: %q", expected, strings.Join(found, ","))
+	}
+}
+
+func TestHWRAIDInfo(t *testing.T) {
+	dir, err := ioutil.TempDir("", "clr-installer-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	saved := sysBlockDir
+	defer func() { sysBlockDir = saved }()
+	sysBlockDir = path.Join(dir, "block")
+
+	// sda is a MegaRAID virtual drive, sdb a plain AHCI disk
+	links := map[string]string{
+		"block/sda/device":                              "../../devices/pci0/host0/target0:2:0/0:2:0:0",
+		"devices/pci0/driver":                           "../drivers/megaraid_sas",
+		"devices/pci0/host0/target0:2:0/0:2:0:0/driver": "../../../../drivers/sd",
+		"block/sdb/device":                              "../../devices/pci1/ata1/1:0:0:0",
+		"devices/pci1/driver":                           "../drivers/ahci",
+	}
+
+	for link, target := range links {
+		if err = os.MkdirAll(path.Dir(path.Join(dir, link)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err = os.Symlink(target, path.Join(dir, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, curr := range []string{"devices/pci0/host0/target0:2:0/0:2:0:0", "devices/pci1/ata1/1:0:0:0"} {
+		if err = os.MkdirAll(path.Join(dir, curr), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	vendor := path.Join(dir, "devices/pci0/host0/target0:2:0/0:2:0:0/vendor")
+	if err = ioutil.WriteFile(vendor, []byte("LSI     \n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	disk := &BlockDevice{Name: "sda", Model: "MR9361-8i "}
+	part := &BlockDevice{Name: "sda1", Parent: disk}
+
+	info := part.GetHWRAIDInfo()
+	if info == nil || info.Controller != "MegaRAID" || info.VirtualDrive != "0:2:0:0" {
+		t.Fatalf("Wrong hardware RAID info: %+v", info)
+	}
+
+	expected := "MR9361-8i (LSI MegaRAID virtual drive 0:2:0:0)"
+	if model := disk.FriendlyModel(); model != expected {
+		t.Fatalf("Expected model %q, got: %q", expected, model)
+	}
+
+	if info = (&BlockDevice{Name: "sdb"}).GetHWRAIDInfo(); info != nil {
+		t.Fatalf("sdb is not behind a RAID controller: %+v", info)
+	}
+}
+
+func TestParseHWRAIDCache(t *testing.T) {
+	storcli := `DG/VD TYPE  State Access Consist Cache Cac sCC       Size Name
+---------------------------------------------------------------
+0/0   RAID1 Optl  RW     Yes     RWBD  -   ON  446.625 GB boot
+1/1   RAID5 Optl  RW     Yes     NRWTD -   ON    7.276 TB data
+2/2   RAID0 Optl  RW     Yes     RAWBD -   ON    1.089 TB scratch
+`
+
+	if warnings := parseStorcliCache(storcli, true); len(warnings) != 1 ||
+		!strings.Contains(warnings[0], "2/2") {
+		t.Fatalf("Expected the always write back warning only, got: %v", warnings)
+	}
+
+	if warnings := parseStorcliCache(storcli, false); len(warnings) != 2 {
+		t.Fatalf("Expected the write back drives warnings, got: %v", warnings)
+	}
+
+	ssacli := `
+Smart Array P440ar in Slot 0 (Embedded)
+   Controller Status: OK
+   Cache Status: OK
+   Battery/Capacitor Status: Failed (Replace Batteries/Capacitors)
+`
+
+	warnings := parseSsacliStatus(ssacli)
+	expected := "Smart Array P440ar in Slot 0 (Embedded) Battery/Capacitor Status: Failed (Replace Batteries/Capacitors)"
+	if len(warnings) != 1 || warnings[0] != expected {
+		t.Fatalf("Expected the battery warning, got: %v", warnings)
+	}
+}
+
+func TestBlockDevicesSignature(t *testing.T) {
+	dir, err := ioutil.TempDir("", "clr-installer-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	prevDir := sysBlockDir
+	sysBlockDir = dir
+	defer func() { sysBlockDir = prevDir }()
+
+	writeSize := func(name string, size string) {
+		if err = os.MkdirAll(path.Join(dir, name), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err = ioutil.WriteFile(path.Join(dir, name, "size"), []byte(size), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writeSize("sda", "1000\n")
+	first := BlockDevicesSignature()
+
+	if first != BlockDevicesSignature() {
+		t.Fatal("The signature should be stable while the devices don't change")
+	}
+
+	writeSize("sdb", "2000\n")
+	plugged := BlockDevicesSignature()
+	if plugged == first {
+		t.Fatal("The signature should change when a device is plugged")
+	}
+
+	writeSize("sdb", "0\n")
+	if BlockDevicesSignature() == plugged {
+		t.Fatal("The signature should change when a device media is removed")
+	}
+}
+
+func TestWaitForDevice(t *testing.T) {
+	dir, err := ioutil.TempDir("", "clr-installer-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	prevInterval := devicePollInterval
+	devicePollInterval = time.Millisecond
+	defer func() { devicePollInterval = prevInterval }()
+
+	if err = ioutil.WriteFile(path.Join(dir, "sda1"), []byte{}, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		_ = ioutil.WriteFile(path.Join(dir, "sda2"), []byte{}, 0644)
+	}()
+
+	if err = WaitForDevice(path.Join(dir, "sda2"), 5*time.Second); err != nil {
+		t.Fatalf("Should have waited for the device: %v", err)
+	}
+
+	err = WaitForDevice(path.Join(dir, "sda3"), 10*time.Millisecond)
+	if err == nil {
+		t.Fatal("Should have timed out waiting for a missing device")
+	}
+
+	if !strings.Contains(err.Error(), "sda1, sda2") {
+		t.Fatalf("The error should list the found partitions: %v", err)
+	}
+}
+
+func TestWaitForUUID(t *testing.T) {
+	dir, err := ioutil.TempDir("", "clr-installer-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	prevDir, prevControl := devByUUIDDir, udevControlFile
+	devByUUIDDir = dir
+	udevControlFile = dir
+	defer func() { devByUUIDDir, udevControlFile = prevDir, prevControl }()
+
+	if err = ioutil.WriteFile(path.Join(dir, "ABCD-1234"), []byte{}, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = WaitForUUID("abcd1234", time.Second); err != nil {
+		t.Fatalf("Should have matched the vfat uuid: %v", err)
+	}
+
+	if err = WaitForUUID("ffff-0000", 10*time.Millisecond); err == nil {
+		t.Fatal("Should have timed out waiting for a missing uuid")
+	}
+
+	udevControlFile = path.Join(dir, "missing")
+	if err = WaitForUUID("ffff-0000", time.Minute); err != nil {
+		t.Fatalf("Should not wait without udev: %v", err)
+	}
+}
+
+func TestStackSignatures(t *testing.T) {
+	lsblkOutput := `{
+    "blockdevices": [
+        {"name": "sda", "size": "8053063680", "type": "disk", "pttype": "gpt",
+         "children": [
+            {"name": "sda1", "size": "524288000", "type": "part", "fstype": "vfat"},
+            {"name": "sda2", "size": "2147483648", "type": "part", "fstype": "crypto_LUKS",
+             "children": [
+                {"name": "luks-root", "size": "2147483648", "type": "crypt", "fstype": "ext4"}
+             ]
+            },
+            {"name": "sda3", "size": "2147483648", "type": "part", "fstype": "linux_raid_member",
+             "children": [
+                {"name": "md127", "size": "2147483648", "type": "raid1", "fstype": "LVM2_member",
+                 "children": [
+                    {"name": "vg-data", "size": "2147483648", "type": "lvm", "fstype": "xfs"}
+                 ]
+                }
+             ]
+            }
+         ]
+        },
+        {"name": "sdb", "size": "8053063680", "type": "disk", "fstype": "LVM2_member"}
+    ]
+}`
+
+	bds, err := parseBlockDevicesDescriptor([]byte(lsblkOutput))
+	if err != nil {
+		t.Fatalf("Should have parsed the RAID and LVM devices: %v", err)
+	}
+
+	expected := "sda2: LUKS (active luks-root); sda3: RAID (active md127, vg-data)"
+	if names := strings.Join(bds[0].StackSignatureNames(), "; "); names != expected {
+		t.Fatalf("Expected the signatures %v, got: %v", expected, names)
+	}
+
+	if names := bds[1].StackSignatureNames(); len(names) != 1 || names[0] != "sdb: LVM" {
+		t.Fatalf("Expected the whole disk LVM signature, got: %v", names)
+	}
+
+	// the whole disk physical volume must not be offered as a safe target
+	for _, target := range FindSafeInstallTargets(MinimumServerInstallSize, bds) {
+		if target.Name == "sdb" {
+			t.Fatal("The LVM physical volume should not be a safe install target")
+		}
+	}
+
+	media := &BlockDevice{Name: "sda", Children: []*BlockDevice{
+		{Name: "sda2", FormatPartition: true},
+	}}
+
+	conflicts := FindStackConflicts([]*BlockDevice{media}, bds, false)
+	if len(conflicts) != 1 || conflicts[0].Device != "sda2" {
+		t.Fatalf("Expected the formatted LUKS partition conflict, got: %v", conflicts)
+	}
+
+	if conflicts = FindStackConflicts([]*BlockDevice{media}, bds, true); len(conflicts) != 2 {
+		t.Fatalf("Expected all the signatures to conflict erasing the disk, got: %v", conflicts)
+	}
+
+	prevRun, prevQuery, prevExists := runStackCommand, queryStackCommand, stackedDeviceExists
+	defer func() {
+		runStackCommand, queryStackCommand, stackedDeviceExists = prevRun, prevQuery, prevExists
+	}()
+
+	commands := []string{}
+	runStackCommand = func(args ...string) error {
+		commands = append(commands, strings.Join(args, " "))
+		return nil
+	}
+
+	queryStackCommand = func(w io.Writer, args ...string) error {
+		if args[len(args)-1] == "/dev/md127" {
+			_, _ = w.Write([]byte("  vg\n"))
+		}
+		return nil
+	}
+
+	stackedDeviceExists = func(file string) (bool, error) {
+		return true, nil
+	}
+
+	if err = WipeStackSignatures(conflicts[1:]); err != nil {
+		t.Fatalf("Should have wiped the RAID signature: %v", err)
+	}
+
+	// the volume group is deactivated before the array holding it is stopped
+	expectedCommands := []string{
+		"vgchange --activate n vg",
+		"mdadm --stop /dev/md127",
+		"mdadm --zero-superblock /dev/sda3",
+		"wipefs --all /dev/sda3",
+	}
+
+	if strings.Join(commands, "; ") != strings.Join(expectedCommands, "; ") {
+		t.Fatalf("Expected the commands %v, got: %v", expectedCommands, commands)
+	}
+}
+
+func TestFindMountHolders(t *testing.T) {
+	dir, err := ioutil.TempDir("", "clr-installer-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	prevDir := procDir
+	procDir = dir
+	defer func() { procDir = prevDir }()
+
+	procs := map[string]map[string]string{
+		"100":  {"cwd": "/run/media/live/data", "root": "/"},
+		"200":  {"cwd": "/home/clear", "fd/3": "/run/media/live/data/notes.txt"},
+		"300":  {"cwd": "/run/media/live/database"},
+		"self": {"cwd": "/run/media/live/data"},
+	}
+
+	for pid, links := range procs {
+		if err = os.MkdirAll(path.Join(dir, pid, "fd"), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err = ioutil.WriteFile(path.Join(dir, pid, "comm"), []byte("proc"+pid+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		for link, target := range links {
+			if err = os.Symlink(target, path.Join(dir, pid, link)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	holders := FindMountHolders("/run/media/live/data")
+	found := []string{}
+	for _, curr := range holders {
+		found = append(found, curr.String())
+	}
+	sort.Strings(found)
+
+	expected := "100 (proc100) /run/media/live/data; 200 (proc200) /run/media/live/data/notes.txt"
+	if strings.Join(found, "; ") != expected {
+		t.Fatalf("Expected the holders %q, got: %q", expected, strings.Join(found, "; "))
+	}
+}
+
+func TestLVMStandardPartitions(t *testing.T) {
+	disk := &BlockDevice{Name: "sda", Size: MinimumServerInstallSize}
+	NewStandardPartitions(disk)
+
+	vg, err := LVMStandardPartitions(disk)
+	if err != nil {
+		t.Fatalf("Should have moved the root partition to LVM: %v", err)
+	}
+
+	medias := []*BlockDevice{disk, vg}
+
+	pvs := PhysicalVolumes(medias, DefaultVolumeGroup)
+	if len(pvs) != 1 || pvs[0].MountPoint != "" {
+		t.Fatalf("Expected the root partition as physical volume, got: %v", pvs)
+	}
+
+	if err = ValidateVolumeGroups(medias, false); err != nil {
+		t.Fatalf("Should have validated the volume group: %v", err)
+	}
+
+	if err = vg.validateVolumeGroup(); err != nil {
+		t.Fatalf("Should have validated the logical volumes: %v", err)
+	}
+
+	expected := "rd.lvm.vg=clearlinux root=/dev/clearlinux/root"
+	if args := strings.Join(LVMKernelArguments(medias), " "); args != expected {
+		t.Fatalf("Expected the kernel arguments %q, got: %q", expected, args)
+	}
+
+	if _, err = LVMStandardPartitions(disk); err == nil {
+		t.Fatal("Should have failed without a new root partition")
+	}
+
+	vg.AddLogicalVolume("home", "ext4", "/home", 0)
+	if err = vg.validateVolumeGroup(); err == nil {
+		t.Fatal("Should have failed with two logical volumes of size 0")
+	}
+
+	if err = ValidateVolumeGroups([]*BlockDevice{vg}, false); err == nil {
+		t.Fatal("Should have failed without physical volumes")
+	}
+
+	if err = ValidateVolumeGroups([]*BlockDevice{disk}, false); err == nil {
+		t.Fatal("Should have failed with an unknown volume group")
+	}
+}
+
+func TestMirrorStandardPartitions(t *testing.T) {
+	disk := &BlockDevice{Name: "sda", Size: MinimumServerInstallSize, Type: BlockDeviceTypeDisk}
+	mirror := &BlockDevice{Name: "sdb", Size: MinimumServerInstallSize, Type: BlockDeviceTypeDisk}
+	NewStandardPartitions(disk)
+
+	if _, err := MirrorStandardPartitions(disk, disk); err == nil {
+		t.Fatal("Should have failed to mirror a disk to itself")
+	}
+
+	array, err := MirrorStandardPartitions(disk, mirror)
+	if err != nil {
+		t.Fatalf("Should have mirrored the root partition: %v", err)
+	}
+
+	medias := []*BlockDevice{disk, mirror, array}
+
+	members := RAIDMembers(medias, array)
+	if len(members) != 2 || members[0].Name != "sda3" || members[1].Name != "sdb1" {
+		t.Fatalf("Expected sda3 and sdb1 as RAID members, got: %v", array.Members)
+	}
+
+	for _, curr := range medias {
+		if err = curr.Validate(false, ""); err != nil {
+			t.Fatalf("Should have validated %s: %v", curr.Name, err)
+		}
+	}
+
+	if err = ValidateRAIDArrays(medias, false); err != nil {
+		t.Fatalf("Should have validated the RAID array: %v", err)
+	}
+
+	expected := "rd.md=1 rd.md.conf=1 root=/dev/md0p1"
+	if args := strings.Join(RAIDKernelArguments(medias), " "); args != expected {
+		t.Fatalf("Expected the kernel arguments %q, got: %q", expected, args)
+	}
+
+	if err = ValidateRAIDArrays([]*BlockDevice{disk, array}, false); err == nil {
+		t.Fatal("Should have failed with a missing RAID member")
+	}
+
+	if err = ValidateRAIDArrays([]*BlockDevice{disk, mirror}, false); err == nil {
+		t.Fatal("Should have failed with RAID members of no array")
+	}
+
+	invalid := []*BlockDevice{
+		{Name: "raid", RAIDLevel: "1", Members: array.Members},
+		{Name: "md1", RAIDLevel: "4", Members: array.Members},
+		{Name: "md1", RAIDLevel: "5", Members: array.Members},
+		{Name: "md1", RAIDLevel: "1", RAIDMetadata: "2.0", Members: array.Members},
+	}
+
+	for _, curr := range invalid {
+		curr.Type = BlockDeviceTypeRAID
+		if err = curr.Validate(false, ""); err == nil {
+			t.Fatalf("RAID array %s level %q metadata %q should be invalid", curr.Name, curr.RAIDLevel, curr.RAIDMetadata)
+		}
+	}
+}
+
+func TestPartitionTables(t *testing.T) {
+	mbr := make([]byte, mbrSize)
+	if _, err := parseMBRTypes(mbr); err == nil {
+		t.Fatal("Should have failed without the MBR signature")
+	}
+
+	mbr[mbrSize-2], mbr[mbrSize-1] = 0x55, 0xaa
+	mbr[mbrEntriesOffset+4] = mbrProtectiveType
+
+	types, err := parseMBRTypes(mbr)
+	if err != nil || isHybridMBR(types) {
+		t.Fatalf("Expected a protective MBR, got: %v %v", types, err)
+	}
+
+	mbr[mbrEntriesOffset+16+4] = 0x83
+	if types, err = parseMBRTypes(mbr); err != nil || !isHybridMBR(types) {
+		t.Fatalf("Expected a hybrid MBR, got: %v %v", types, err)
+	}
+
+	target := InstallTarget{Name: "sdz", LegacyTable: PartitionTableMBR, EraseDisk: true}
+	if warnings := PartitionTableWarnings(target, PartitionTablePolicyConvert, true); len(warnings) != 2 {
+		t.Fatalf("Expected the GPT conversion warnings, got: %v", warnings)
+	}
+
+	if warnings := PartitionTableWarnings(InstallTarget{Name: "sdy"}, "", true); len(warnings) != 0 {
+		t.Fatalf("Expected no warning for a GPT disk, got: %v", warnings)
+	}
+
+	current := []*BlockDevice{{Name: "sdz", PtType: PartitionTableMBR}}
+	media := &BlockDevice{Name: "sdz", Size: MinimumServerInstallSize}
+	NewStandardPartitions(media)
+	medias := []*BlockDevice{media}
+
+	if err = PlanPartitionTables(medias, current, true, ""); err == nil {
+		t.Fatal("Should have refused the MBR disk without a policy")
+	}
+
+	if err = PlanPartitionTables(medias, current, true, PartitionTablePolicyConvert); err != nil || media.IsMBR() {
+		t.Fatalf("Should have converted the MBR disk to GPT: %v", err)
+	}
+
+	if err = PlanPartitionTables(medias, current, true, PartitionTablePolicyPreserve); err != nil || !media.IsMBR() {
+		t.Fatalf("Should have kept the MBR partition table: %v", err)
+	}
+
+	if err = ValidatePartitionTablePolicy(medias, PartitionTablePolicyPreserve, false); err == nil {
+		t.Fatal("Should have refused to keep the MBR partition table of an UEFI install")
+	}
+
+	if err = ValidatePartitionTablePolicy(medias, PartitionTablePolicyPreserve, true); err != nil {
+		t.Fatalf("Should have kept the MBR partition table of a legacy BIOS install: %v", err)
+	}
+}
+
+func TestTrimPolicy(t *testing.T) {
+	lsblkOutput := `{
+    "blockdevices": [
+        {"name": "sda", "size": "8053063680", "type": "disk", "rota": "1"},
+        {"name": "nvme0n1", "size": "8053063680", "type": "disk", "rota": false}
+    ]
+}`
+
+	current, err := parseBlockDevicesDescriptor([]byte(lsblkOutput))
+	if err != nil {
+		t.Fatalf("Should have parsed the rotational flags: %v", err)
+	}
+
+	hdd := &BlockDevice{Name: "sda", Size: MinimumServerInstallSize}
+	ssd := &BlockDevice{Name: "nvme0n1", Size: MinimumServerInstallSize}
+	NewStandardPartitions(ssd)
+
+	if policy := SuggestTrimPolicy([]*BlockDevice{hdd}, current); policy != TrimPolicyNone {
+		t.Fatalf("Expected no TRIM for a rotational disk, got: %s", policy)
+	}
+
+	if policy := SuggestTrimPolicy([]*BlockDevice{ssd}, current); policy != TrimPolicyTimer {
+		t.Fatalf("Expected the periodic TRIM for a SSD, got: %s", policy)
+	}
+
+	if err = EncryptStandardPartitions(ssd, false); err != nil {
+		t.Fatal(err)
+	}
+
+	ApplyTrimPolicy([]*BlockDevice{ssd}, TrimPolicyDiscard)
+
+	for _, ch := range ssd.Children {
+		if ch.Discard == (ch.FsType == "swap") {
+			t.Fatalf("Expected the discard of the file systems only, got %s: %v", ch.FsType, ch.Discard)
+		}
+	}
+
+	if args := TrimKernelArguments([]*BlockDevice{ssd}); len(args) != 1 || args[0] != LUKSDiscardKernelArgument {
+		t.Fatalf("Expected the LUKS discard of the encrypted root, got: %v", args)
+	}
+
+	rootDir, err := ioutil.TempDir("", "clr-installer-storage-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(rootDir) }()
+
+	root := &BlockDevice{Name: "nvme0n1p3", FsType: "ext4", MountPoint: "/", UUID: "a3ea1ecb-1e2f-44b4-8e23-4bbe4c4c1c59", Discard: true}
+	disk := &BlockDevice{Name: "nvme0n1", Children: []*BlockDevice{root}}
+
+	if err = GenerateTabFiles(rootDir, []*BlockDevice{disk}); err != nil {
+		t.Fatal(err)
+	}
+
+	fstab, err := ioutil.ReadFile(path.Join(rootDir, "etc", "fstab"))
+	if err != nil || !strings.Contains(string(fstab), " / ext4 defaults,discard ") {
+		t.Fatalf("Expected the discard of the auto-mounted root, got: %q %v", fstab, err)
+	}
+}
+
+func TestShrinkPartition(t *testing.T) {
+	minimum, err := parseResize2fsMinimum("Estimated minimum size of the filesystem: 262144\n",
+		"Block count:              2621440\nBlock size:               4096\n")
+	if err != nil || minimum != 262144*4096 {
+		t.Fatalf("Expected the ext4 minimum of %d bytes, got: %d %v", 262144*4096, minimum, err)
+	}
+
+	minimum, err = parseNtfsresizeMinimum("ntfsresize v2017.3.23\nYou might resize at 21474836480 bytes or 21475 MB (freeing 78525 MB).\n")
+	if err != nil || minimum != 21474836480 {
+		t.Fatalf("Expected the ntfs minimum of 21474836480 bytes, got: %d %v", minimum, err)
+	}
+
+	if _, err = parseNtfsresizeMinimum("ERROR: NTFS is inconsistent"); err == nil {
+		t.Fatal("Should have failed to find the ntfs minimum")
+	}
+
+	for _, curr := range []string{
+		"The NTFS partition is hibernated. Windows must be resumed and turned off properly",
+		"The NTFS journal file is unclean. Please shutdown Windows properly",
+		"ERROR: Volume is scheduled for check.\nRun chkdsk /f and please try again",
+	} {
+		if _, err = parseNtfsresizeMinimum(curr); err == nil || !strings.Contains(err.Error(), "shut Windows down fully") {
+			t.Fatalf("Expected the unclean Windows shut down error for %q, got: %v", curr, err)
+		}
+	}
+
+	if name := parseOSRelease("NAME=\"Fedora\"\nPRETTY_NAME=\"Fedora 30 (Workstation Edition)\"\n"); name != "Fedora 30 (Workstation Edition)" {
+		t.Fatalf("Expected the os-release PRETTY_NAME, got: %q", name)
+	}
+
+	disk := &BlockDevice{Name: "sda", Type: BlockDeviceTypeDisk, Size: 100000000000}
+	disk.PartTable = []*PartedPartition{
+		{Number: 1, Start: 1048576, End: 315621375, Size: 314572800, FileSystem: "fat32", Flags: "boot, esp"},
+		{Number: 2, Start: 315621376, End: 99999999999, Size: 99684378624, FileSystem: "ntfs"},
+	}
+	disk.AddChild(&BlockDevice{Name: "sda1", FsType: "vfat", Type: BlockDeviceTypePart, Size: 314572800})
+	disk.AddChild(&BlockDevice{Name: "sda2", FsType: "ntfs", Type: BlockDeviceTypePart, Size: 99684378624})
+
+	if _, err = disk.ShrinkPartition("sda1", 104857600); err == nil {
+		t.Fatal("Should have failed to shrink a vfat partition")
+	}
+
+	if _, err = disk.ShrinkPartition("sda2", 99684378624); err == nil {
+		t.Fatal("Should have failed to shrink a partition to its own size")
+	}
+
+	target, err := disk.ShrinkPartition("sda2", 40*1024*1024*1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if target.Shrink != "sda2" || target.WholeDisk || target.FreeStart != 315621376+40*1024*1024*1024 ||
+		target.FreeEnd != 99999999999 {
+		t.Fatalf("Expected the freed space after sda2, got: %+v", target)
+	}
+
+	if len(disk.PartTable) != 3 || disk.PartTable[1].Size != 40*1024*1024*1024 || disk.PartTable[2].Number != 0 {
+		t.Fatalf("Expected sda2 to be followed by the freed space, got: %+v", disk.PartTable)
+	}
+
+	sda2 := disk.Children[1]
+	if !sda2.Resize || sda2.Size != 40*1024*1024*1024 || sda2.validateResize() != nil {
+		t.Fatalf("Expected sda2 to be resized: %+v", sda2)
+	}
+
+	sda2.FormatPartition = true
+	if sda2.validateResize() == nil {
+		t.Fatal("A resized partition can not be formatted")
+	}
+}
+
+func TestDestructiveSteps(t *testing.T) {
+	disk := &BlockDevice{Name: "sda", Size: 256000000000, Type: BlockDeviceTypeDisk}
+	NewStandardPartitions(disk)
+
+	steps := DestructiveSteps([]*BlockDevice{disk})
+	if len(steps) != 3 {
+		t.Fatalf("Expected 3 storyboard steps, got: %v", steps)
+	}
+
+	for idx, expected := range []string{"/dev/sda (256G)", "/boot (150M vfat)", "root partition"} {
+		if !strings.Contains(steps[idx], expected) {
+			t.Fatalf("Expected the step %d %q to contain %q", idx+1, steps[idx], expected)
+		}
+	}
+
+	if steps := DestructiveSteps([]*BlockDevice{}); len(steps) != 0 {
+		t.Fatalf("Expected no storyboard without disk, got: %v", steps)
+	}
+}
+
+func TestValidateTargetMedias(t *testing.T) {
+	newDisk := func(name string, size uint64) *BlockDevice {
+		return &BlockDevice{Name: name, Type: BlockDeviceTypeDisk, Size: size}
+	}
+
+	root := newDisk("sda", 16*1024*1024*1024)
+	NewStandardPartitions(root)
+
+	home := newDisk("sdb", 64*1024*1024*1024)
+	if _, err := NewDataDiskPartition(home, "/home"); err != nil {
+		t.Fatal(err)
+	}
+
+	swap := newDisk("sdc", 4*1024*1024*1024)
+	if _, err := NewDataDiskPartition(swap, DataDiskSwap); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewDataDiskPartition(newDisk("sdd", 1024), "/boot"); err == nil {
+		t.Fatal("Should have refused a data disk holding /boot")
+	}
+
+	if err := ValidateTargetMedias([]*BlockDevice{root, home, swap}, false, ""); err != nil {
+		t.Fatalf("Data disks should be valid: %v", err)
+	}
+
+	// a data disk alone is not an install
+	if err := home.Validate(false, ""); err == nil {
+		t.Fatal("Should have failed without a root partition")
+	}
+
+	other := newDisk("sdd", 64*1024*1024*1024)
+	if _, err := NewDataDiskPartition(other, "/home"); err != nil {
+		t.Fatal(err)
+	}
+	other.Children[0].Label = "home2"
+
+	err := ValidateTargetMedias([]*BlockDevice{root, home, other}, false, "")
+	if err == nil || !strings.Contains(err.Error(), "Mount point /home is set on both sdb1 and sdd1") {
+		t.Fatalf("Should have failed with the duplicated /home, got: %v", err)
+	}
+
+	// the root partition is moved to the data disk
+	for _, ch := range root.Children {
+		if ch.MountPoint == "/" {
+			ch.MountPoint = "/srv"
+		}
+	}
+	home.Children[0].MountPoint = "/"
+
+	err = ValidateTargetMedias([]*BlockDevice{root, home}, false, "")
+	if err == nil || !strings.Contains(err.Error(), "The root partition must be on sda") {
+		t.Fatalf("Should have failed with the root off the boot disk, got: %v", err)
+	}
+}
+
+func TestDataDiskTabFiles(t *testing.T) {
+	rootDir, err := ioutil.TempDir("", "clr-installer-storage-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(rootDir) }()
+
+	root := &BlockDevice{Name: "sda", Type: BlockDeviceTypeDisk, Size: 16 * 1024 * 1024 * 1024}
+	NewStandardPartitions(root)
+
+	home := &BlockDevice{Name: "sdb", Type: BlockDeviceTypeDisk, Size: 64 * 1024 * 1024 * 1024}
+	if _, err = NewDataDiskPartition(home, "/home"); err != nil {
+		t.Fatal(err)
+	}
+
+	swap := &BlockDevice{Name: "sdc", Type: BlockDeviceTypeDisk, Size: 4 * 1024 * 1024 * 1024}
+	if _, err = NewDataDiskPartition(swap, DataDiskSwap); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = GenerateTabFiles(rootDir, []*BlockDevice{root, home, swap}); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := ioutil.ReadFile(path.Join(rootDir, "etc", "fstab"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the standard partitions of the boot disk are auto-mounted
+	expected := "LABEL=home /home ext4 defaults 0 2\nLABEL=swap-sdc none swap defaults 0 0\n"
+	if string(content) != expected {
+		t.Fatalf("Expected the fstab:\n%s\ngot:\n%s", expected, content)
+	}
+}
+
+func TestBtrfsSubvolumes(t *testing.T) {
+	root := &BlockDevice{Name: "sda", Type: BlockDeviceTypeDisk, Size: 16 * 1024 * 1024 * 1024}
+	NewStandardPartitions(root)
+
+	var part *BlockDevice
+	for _, ch := range root.Children {
+		if ch.MountPoint == "/" {
+			part = ch
+		}
+	}
+	part.FsType = "btrfs"
+	part.Subvolumes = DefaultSubvolumes()
+
+	if err := root.Validate(false, ""); err != nil {
+		t.Fatalf("The default subvolumes should be valid: %v", err)
+	}
+
+	if args := KernelArguments([]*BlockDevice{root}); len(args) != 1 || args[0] != "rootflags=subvol=@" {
+		t.Fatalf("Expected the root subvolume kernel argument, got: %v", args)
+	}
+
+	rootDir, err := ioutil.TempDir("", "clr-installer-storage-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(rootDir) }()
+
+	if err = GenerateTabFiles(rootDir, []*BlockDevice{root}); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := ioutil.ReadFile(path.Join(rootDir, "etc", "fstab"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the root subvolume is auto-mounted
+	expected := "LABEL=root /home btrfs defaults,subvol=@home 0 0\nLABEL=root /var btrfs defaults,subvol=@var 0 0\n"
+	if string(content) != expected {
+		t.Fatalf("Expected the fstab:\n%s\ngot:\n%s", expected, content)
+	}
+
+	invalid := []struct {
+		subvolumes []*Subvolume
+		msg        string
+	}{
+		{[]*Subvolume{{Name: "@home", MountPoint: "/home"}}, "a subvolume must be mounted"},
+		{[]*Subvolume{{Name: "@", MountPoint: "/"}, {Name: "@", MountPoint: "/var"}}, "duplicated subvolume"},
+		{[]*Subvolume{{Name: "@", MountPoint: "/"}, {Name: "a/b"}}, "invalid subvolume name"},
+		{[]*Subvolume{{Name: "@", MountPoint: "/"}, {Name: "@a", MountPoint: "/a"}, {Name: "@b", MountPoint: "/a"}},
+			"more than one subvolume"},
+		{[]*Subvolume{{Name: "@", MountPoint: "/"}, {Name: "@boot", MountPoint: "/boot"}}, "Mount point /boot is set on both"},
+	}
+
+	for _, curr := range invalid {
+		part.Subvolumes = curr.subvolumes
+		if err = root.Validate(false, ""); err == nil || !strings.Contains(err.Error(), curr.msg) {
+			t.Fatalf("Expected the %q error for %v, got: %v", curr.msg, curr.subvolumes, err)
+		}
+	}
+}
+
+func TestSwapFile(t *testing.T) {
+	disk := &BlockDevice{Name: "sda", Type: BlockDeviceTypeDisk, Size: 16 * 1024 * 1024 * 1024}
+	NewStandardPartitions(disk)
+
+	medias := []*BlockDevice{disk}
+	if err := ValidateSwapFile(medias, DefaultSwapFileSize); err == nil {
+		t.Fatal("A swap file should be invalid with a new swap partition")
+	}
+
+	NewStandardPartitionsNoSwap(disk)
+	if disk.DeviceHasSwap() {
+		t.Fatal("The standard partitions should have no swap partition")
+	}
+
+	root := findRoot(medias)
+	if root == nil || root.Size != disk.Size-bootSize {
+		t.Fatalf("The root partition should take the swap partition space: %v", root)
+	}
+
+	if err := ValidateSwapFile(medias, DefaultSwapFileSize); err != nil {
+		t.Fatalf("The swap file should be valid: %v", err)
+	}
+
+	for _, size := range []string{"big", "4K", "32G"} {
+		if err := ValidateSwapFile(medias, size); err == nil {
+			t.Fatalf("The swap file size %s should be invalid", size)
+		}
+	}
+
+	root.FsType = "vfat"
+	if err := ValidateSwapFile(medias, DefaultSwapFileSize); err == nil {
+		t.Fatal("A swap file should be invalid on a vfat root")
+	}
+
+	rootDir, err := ioutil.TempDir("", "clr-installer-storage-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(rootDir) }()
+
+	// the entry is added once, i.e by a resumed install
+	for i := 0; i < 2; i++ {
+		if err = addSwapFileTabEntry(rootDir); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	content, err := ioutil.ReadFile(path.Join(rootDir, "etc", "fstab"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(content) != "/swapfile none swap defaults 0 0\n" {
+		t.Fatalf("Unexpected fstab: %q", string(content))
+	}
+}
+
+func TestSpaceRequirements(t *testing.T) {
+	giga := uint64(1000 * 1000 * 1000)
+
+	sr := NewSpaceRequirements(0)
+	if sr.Root != BaseContentSize || sr.Total() != MinimumServerInstallSize {
+		t.Fatalf("The base content should be sized to the server minimum: %s", sr.String())
+	}
+
+	sr = NewSpaceRequirements(5 * giga)
+	if sr.Total() != bootSize+swapSize+5*giga {
+		t.Fatalf("Unexpected total: %s", sr.String())
+	}
+
+	disk := &BlockDevice{Name: "sda", Type: BlockDeviceTypeDisk, Size: 16 * giga}
+	NewStandardPartitionsNoSwap(disk)
+	if err := EncryptStandardPartitions(disk, false); err != nil {
+		t.Fatal(err)
+	}
+
+	sr.Plan([]*BlockDevice{disk}, giga)
+	if sr.Swap != 0 || sr.Root != 6*giga || sr.Encryption != LUKSHeaderSize {
+		t.Fatalf("The swap file and the encrypted root should be planned: %s", sr.String())
+	}
+
+	if sr.RootPartition() != 6*giga+LUKSHeaderSize {
+		t.Fatalf("The root partition should hold the LUKS header: %d", sr.RootPartition())
+	}
+
+	if err := sr.Check([]*BlockDevice{disk}); err != nil {
+		t.Fatalf("The standard partitions should fit: %v", err)
+	}
+
+	root := findRoot([]*BlockDevice{disk})
+	root.Size = 6 * giga
+	if err := sr.Check([]*BlockDevice{disk}); err == nil || !strings.Contains(err.Error(), "root partition") {
+		t.Fatalf("The root partition should be too small for the LUKS header, got: %v", err)
+	}
+
+	root.Size = 0
+	if err := sr.Check([]*BlockDevice{disk}); err != nil {
+		t.Fatalf("A root partition of unknown size should not be checked: %v", err)
+	}
+
+	for _, ch := range disk.Children {
+		if ch.MountPoint == "/boot" {
+			ch.Size = ESPReuseMinimumFree / 2
+		}
+	}
+
+	if err := sr.Check([]*BlockDevice{disk}); err == nil || !strings.Contains(err.Error(), "boot partition") {
+		t.Fatalf("The boot partition should be too small for the kernels, got: %v", err)
+	}
+
+	// i.e: the 64M EFI System Partition of the image descriptors
+	for _, ch := range disk.Children {
+		ch.UserDefined = false
+	}
+
+	if err := sr.Check([]*BlockDevice{disk}); err != nil {
+		t.Fatalf("The partitions of a configuration file should not be checked: %v", err)
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package storage
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/clearlinux/clr-installer/utils"
+)
+
+// storyboardSize returns the human readable size of bd, its size in bytes
+// if it can't be converted
+func storyboardSize(bd *BlockDevice) string {
+	size, err := bd.HumanReadableSize()
+	if err != nil {
+		return fmt.Sprintf("%dB", bd.Size)
+	}
+
+	return size
+}
+
+// storyboardPartition describes a partition created by the install
+func storyboardPartition(bd *BlockDevice) string {
+	name := bd.MountPoint
+	if name == "" {
+		name = bd.FsType
+	}
+
+	desc := name + " (" + storyboardSize(bd)
+	if bd.FsType != "" && bd.FsType != name {
+		desc = desc + " " + bd.FsType
+	}
+
+	if bd.Type == BlockDeviceTypeCrypt {
+		desc = desc + ", " + utils.Locale.Get("encrypted")
+	}
+
+	return desc + ")"
+}
+
+// DestructiveSteps returns the storyboard of the destructive install of
+// medias, the description of its disk wipe, partitioning and OS install
+// steps naming the affected devices and sizes
+func DestructiveSteps(medias []*BlockDevice) []string {
+	disks := []string{}
+	partitions := []string{}
+	root := ""
+
+	for _, curr := range medias {
+		if curr.Type != BlockDeviceTypeDisk && curr.Type != BlockDeviceTypeLoop {
+			continue
+		}
+
+		disks = append(disks, curr.GetDeviceFile()+" ("+storyboardSize(curr)+")")
+
+		created := []string{}
+		for _, ch := range curr.Children {
+			if ch.MakePartition {
+				created = append(created, storyboardPartition(ch))
+			}
+		}
+
+		if len(created) > 0 {
+			partitions = append(partitions, curr.GetDeviceFile()+": "+strings.Join(created, ", "))
+		}
+	}
+
+	for _, curr := range medias {
+		for _, ch := range append([]*BlockDevice{curr}, curr.Children...) {
+			if ch.MountPoint == "/" {
+				root = storyboardSize(ch)
+			}
+		}
+	}
+
+	if len(disks) == 0 {
+		return []string{}
+	}
+
+	steps := []string{
+		utils.Locale.Get("%s will be wiped, all of its data will be lost", strings.Join(disks, ", ")),
+	}
+
+	if len(partitions) > 0 {
+		steps = append(steps, utils.Locale.Get("New partitions will be created on %s", strings.Join(partitions, "; ")))
+	} else {
+		steps = append(steps, utils.Locale.Get("New partitions will be created"))
+	}
+
+	if root != "" {
+		steps = append(steps, utils.Locale.Get("Clear Linux* OS will be installed to the %s root partition", root))
+	} else {
+		steps = append(steps, utils.Locale.Get("Clear Linux* OS will be installed"))
+	}
+
+	return steps
+}
@@ -0,0 +1,164 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package storage
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/clearlinux/clr-installer/cmd"
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/utils"
+)
+
+const (
+	// SwapFile is the swap file path, relative to the target root
+	SwapFile = "swapfile"
+
+	// DefaultSwapFileSize is the size of the swap file replacing the
+	// standard swap partition
+	DefaultSwapFileSize = "256M"
+
+	// minSwapFileSize is the smallest swap file mkswap accepts, 10 pages
+	minSwapFileSize = 40 * 1024
+)
+
+var (
+	// swapFileFsTypes are the root file systems a swap file can be
+	// allocated on
+	swapFileFsTypes = []string{"ext4", "xfs", "btrfs"}
+)
+
+// findRoot returns the root partition of medias, nil if there is none
+func findRoot(medias []*BlockDevice) *BlockDevice {
+	for _, curr := range medias {
+		for _, ch := range curr.Children {
+			if ch.MountPoint == "/" {
+				return ch
+			}
+		}
+	}
+
+	return nil
+}
+
+// ValidateSwapFile checks a swap file of size can replace the swap partitions
+// of medias: its size, the root file system and that no swap partition is made
+func ValidateSwapFile(medias []*BlockDevice, size string) error {
+	bytes, err := ParseVolumeSize(size)
+	if err != nil {
+		return errors.Errorf("Invalid swap file size %q, i.e: 512M or 2G", size)
+	}
+
+	if bytes < minSwapFileSize {
+		return errors.Errorf("The swap file size must be at least 40K")
+	}
+
+	root := findRoot(medias)
+	if root == nil {
+		return errors.Errorf("The swap file requires a root partition")
+	}
+
+	if !utils.StringSliceContains(swapFileFsTypes, root.FsType) {
+		return errors.Errorf("The swap file requires a root file system of: %s",
+			strings.Join(swapFileFsTypes, ", "))
+	}
+
+	if root.Size > 0 && bytes >= root.Size {
+		return errors.Errorf("The swap file does not fit the root partition")
+	}
+
+	for _, curr := range medias {
+		for _, ch := range curr.Children {
+			if ch.FsType == "swap" && ch.MakePartition {
+				return errors.Errorf("The swap file replaces the swap partition %s, remove it", ch.Name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// CreateSwapFile allocates the swap file of size on the root file system of
+// the target at rootDir and adds it to the fstab; a btrfs swap file must not
+// be copied on write
+func CreateSwapFile(rootDir string, medias []*BlockDevice, size string) error {
+	bytes, err := ParseVolumeSize(size)
+	if err != nil {
+		return errors.Wrap(err)
+	}
+
+	root := findRoot(medias)
+	if root == nil {
+		return errors.Errorf("The swap file requires a root partition")
+	}
+
+	// a resumed install allocates it again
+	path := filepath.Join(rootDir, SwapFile)
+	if err = os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err)
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return errors.Wrap(err)
+	}
+
+	if err = file.Close(); err != nil {
+		return errors.Wrap(err)
+	}
+
+	if root.FsType == "btrfs" {
+		if err = cmd.RunAndLog("chattr", "+C", path); err != nil {
+			return errors.Wrap(err)
+		}
+	}
+
+	if err = cmd.RunAndLog("fallocate", "-l", fmt.Sprintf("%d", bytes), path); err != nil {
+		return errors.Wrap(err)
+	}
+
+	if err = cmd.RunAndLog("mkswap", path); err != nil {
+		return errors.Wrap(err)
+	}
+
+	return addSwapFileTabEntry(rootDir)
+}
+
+// addSwapFileTabEntry adds the swap file entry to the fstab of the target at
+// rootDir, unless already there
+func addSwapFileTabEntry(rootDir string) error {
+	entry := strings.Join([]string{"/" + SwapFile, "none", "swap", "defaults", "0", "0"}, " ")
+	fstabFile := filepath.Join(rootDir, "etc", "fstab")
+
+	content, err := ioutil.ReadFile(fstabFile)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err)
+	}
+
+	for _, line := range strings.Split(string(content), "\n") {
+		if line == entry {
+			return nil
+		}
+	}
+
+	if err = utils.MkdirAll(filepath.Dir(fstabFile), 0755); err != nil {
+		return err
+	}
+
+	if len(content) > 0 && !strings.HasSuffix(string(content), "\n") {
+		content = append(content, '\n')
+	}
+	content = append(content, []byte(entry+"\n")...)
+
+	if err = ioutil.WriteFile(fstabFile, content, 0644); err != nil {
+		return errors.Wrap(err)
+	}
+
+	return nil
+}
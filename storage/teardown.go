@@ -0,0 +1,247 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package storage
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/clearlinux/clr-installer/cmd"
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/log"
+)
+
+const (
+	// swapMountPoint is the mount point lsblk reports for the active swaps
+	swapMountPoint = "[SWAP]"
+)
+
+// MountHolder is a process keeping a mount point busy
+type MountHolder struct {
+	PID     int    // process id
+	Command string // process command name
+	Path    string // file used under the mount point
+}
+
+var (
+	procDir = "/proc"
+
+	// unmountRetries is how many times a busy mount point is unmounted
+	// again after its holders were signaled
+	unmountRetries = 3
+
+	// unmountRetryDelay is how long the holders have to exit
+	unmountRetryDelay = 500 * time.Millisecond
+)
+
+// String returns the fuser style description of the holder
+func (mh *MountHolder) String() string {
+	return fmt.Sprintf("%d (%s) %s", mh.PID, mh.Command, mh.Path)
+}
+
+// isUnder returns true if file is the mount point or under it
+func isUnder(file string, mountPoint string) bool {
+	if mountPoint == "/" {
+		return true
+	}
+
+	return file == mountPoint || strings.HasPrefix(file, mountPoint+"/")
+}
+
+// FindMountHolders returns the processes having their root, working directory,
+// executable or an open file under mountPoint, the installer is never listed
+func FindMountHolders(mountPoint string) []*MountHolder {
+	result := []*MountHolder{}
+
+	procs, err := ioutil.ReadDir(procDir)
+	if err != nil {
+		log.Warning("Could not list the processes: %s", err)
+		return result
+	}
+
+	for _, curr := range procs {
+		pid, err := strconv.Atoi(curr.Name())
+		if err != nil || pid == os.Getpid() {
+			continue
+		}
+
+		dir := filepath.Join(procDir, curr.Name())
+		links := []string{"root", "cwd", "exe"}
+
+		if fds, err := ioutil.ReadDir(filepath.Join(dir, "fd")); err == nil {
+			for _, fd := range fds {
+				links = append(links, filepath.Join("fd", fd.Name()))
+			}
+		}
+
+		for _, link := range links {
+			file, err := os.Readlink(filepath.Join(dir, link))
+			if err != nil || !isUnder(file, mountPoint) {
+				continue
+			}
+
+			command, _ := ioutil.ReadFile(filepath.Join(dir, "comm"))
+			result = append(result, &MountHolder{
+				PID:     pid,
+				Command: strings.TrimSpace(string(command)),
+				Path:    file,
+			})
+			break
+		}
+	}
+
+	return result
+}
+
+// unmountBusy unmounts mountPoint, if it's busy its holders are logged and
+// terminated, then killed if they don't exit
+func unmountBusy(mountPoint string) error {
+	for attempt := 0; ; attempt++ {
+		err := syscall.Unmount(mountPoint, 0)
+		if err == nil {
+			log.Info("Unmounted %s", mountPoint)
+			return nil
+		}
+
+		if err != syscall.EBUSY || attempt == unmountRetries {
+			return errors.Errorf("umount %s: %v", mountPoint, err)
+		}
+
+		signal := syscall.SIGTERM
+		if attempt > 0 {
+			signal = syscall.SIGKILL
+		}
+
+		holders := FindMountHolders(mountPoint)
+		if len(holders) == 0 {
+			log.Warning("%s is busy, no process holds it", mountPoint)
+		}
+
+		for _, curr := range holders {
+			log.Warning("%s is busy, sending %s to: %s", mountPoint, signal, curr)
+			if err = syscall.Kill(curr.PID, signal); err != nil && err != syscall.ESRCH {
+				log.Warning("Could not signal %d: %s", curr.PID, err)
+			}
+		}
+
+		time.Sleep(unmountRetryDelay)
+	}
+}
+
+// stackedDeviceFile returns the device file of bd, the LUKS and LVM devices are
+// under /dev/mapper
+func (bd *BlockDevice) stackedDeviceFile() string {
+	if bd.Type == BlockDeviceTypeCrypt || bd.Type == BlockDeviceTypeLVM2Volume {
+		return filepath.Join("/dev/mapper", bd.Name)
+	}
+
+	return bd.GetDeviceFile()
+}
+
+// teardown disables bd's swap or unmounts it, i.e a partition auto-mounted by
+// the live session, so it can be partitioned or formatted
+func (bd *BlockDevice) teardown() error {
+	switch bd.MountPoint {
+	case "":
+		return nil
+	case "/":
+		return errors.Errorf("%s is the running system root", bd.Name)
+	case swapMountPoint:
+		log.Info("Disabling the swap on %s", bd.Name)
+		if err := cmd.RunAndLog("swapoff", bd.stackedDeviceFile()); err != nil {
+			return errors.Wrap(err)
+		}
+	default:
+		// never pull the installer from under itself, i.e the live media
+		if exe, err := os.Executable(); err == nil && isUnder(exe, bd.MountPoint) {
+			return errors.Errorf("%s holds the running installer", bd.Name)
+		}
+
+		if err := unmountBusy(bd.MountPoint); err != nil {
+			return err
+		}
+	}
+
+	bd.MountPoint = ""
+
+	return nil
+}
+
+// touchedDevices returns the names of disk's devices the target media would
+// overwrite: the disk itself, its formatted, resized and removed partitions
+// and, if wholeDisk, all of its partitions
+func touchedDevices(media *BlockDevice, disk *BlockDevice, wholeDisk bool) map[string]bool {
+	result := map[string]bool{disk.Name: true}
+
+	for _, ch := range media.Children {
+		if ch.FormatPartition || ch.Resize {
+			result[ch.Name] = true
+		}
+	}
+
+	for _, curr := range media.removedParts {
+		result[media.GetNewPartitionName(curr)] = true
+	}
+
+	if wholeDisk {
+		for _, ch := range disk.Children {
+			result[ch.Name] = true
+		}
+	}
+
+	return result
+}
+
+// findCurrentDisk returns the current device of the target media
+func findCurrentDisk(media *BlockDevice, current []*BlockDevice) *BlockDevice {
+	for _, curr := range current {
+		if curr.Name == media.Name {
+			return curr
+		}
+	}
+
+	return nil
+}
+
+// TeardownTargets releases the current devices the target medias would
+// overwrite, see touchedDevices(): the swaps are disabled, the file systems
+// unmounted and the LUKS, LVM and RAID stacks on top of them stopped.
+func TeardownTargets(medias []*BlockDevice, current []*BlockDevice, wholeDisk bool) error {
+	stopped := map[string]bool{}
+
+	for _, media := range medias {
+		disk := findCurrentDisk(media, current)
+		if disk == nil {
+			continue
+		}
+
+		touched := touchedDevices(media, disk, wholeDisk)
+
+		devices := []*BlockDevice{}
+		if wholeDisk {
+			devices = append(devices, disk)
+		} else {
+			for _, ch := range disk.Children {
+				if touched[ch.Name] {
+					devices = append(devices, ch)
+				}
+			}
+		}
+
+		for _, bd := range devices {
+			if err := bd.deactivate(stopped); err != nil {
+				return errors.Errorf("Could not release %s: %s", bd.Name, err)
+			}
+		}
+	}
+
+	return nil
+}
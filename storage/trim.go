@@ -0,0 +1,101 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package storage
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/clearlinux/clr-installer/cmd"
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/log"
+)
+
+const (
+	// TrimPolicyTimer enables the weekly fstrim timer of the target, the
+	// default for the non-rotational disks
+	TrimPolicyTimer = "timer"
+
+	// TrimPolicyDiscard mounts all the file systems with the discard option,
+	// the freed blocks are trimmed right away
+	TrimPolicyDiscard = "discard"
+
+	// TrimPolicyNone never trims the freed blocks, the default for the
+	// rotational disks
+	TrimPolicyNone = "none"
+
+	// DiscardMountOption is the mount option trimming the freed blocks
+	DiscardMountOption = "discard"
+
+	// LUKSDiscardKernelArgument allows the discards through the LUKS
+	// containers unlocked by the initrd, i.e the encrypted root
+	LUKSDiscardKernelArgument = "rd.luks.options=discard"
+
+	// fstrimTimer is the systemd unit trimming the mounted file systems
+	fstrimTimer = "fstrim.timer"
+)
+
+// TrimPolicies is the list of the supported TRIM policies
+var TrimPolicies = []string{TrimPolicyTimer, TrimPolicyDiscard, TrimPolicyNone}
+
+// SuggestTrimPolicy returns TrimPolicyTimer if one of the current devices of
+// the target medias is non-rotational, i.e a SSD, TrimPolicyNone otherwise
+func SuggestTrimPolicy(medias []*BlockDevice, current []*BlockDevice) string {
+	for _, media := range medias {
+		if disk := findCurrentDisk(media, current); disk != nil && !disk.Rotational {
+			return TrimPolicyTimer
+		}
+	}
+
+	return TrimPolicyNone
+}
+
+// ApplyTrimPolicy sets the mount-time discard of all the new file systems of
+// medias if policy is TrimPolicyDiscard, the swaps are discarded by the kernel
+func ApplyTrimPolicy(medias []*BlockDevice, policy string) {
+	if policy != TrimPolicyDiscard {
+		return
+	}
+
+	for _, curr := range medias {
+		for _, ch := range curr.Children {
+			if ch.FormatPartition && ch.FsTypeNotSwap() && !ch.IsPhysicalVolume() && !ch.IsRAIDMember() {
+				ch.Discard = true
+			}
+		}
+	}
+}
+
+// TrimKernelArguments returns the kernel arguments allowing the discards
+// through the encrypted partitions unlocked by the initrd, none if no such
+// partition has the discard enabled
+func TrimKernelArguments(medias []*BlockDevice) []string {
+	for _, curr := range medias {
+		for _, ch := range curr.Children {
+			if ch.Type == BlockDeviceTypeCrypt && ch.Discard && ch.isStandardMount() {
+				return []string{LUKSDiscardKernelArgument}
+			}
+		}
+	}
+
+	return []string{}
+}
+
+// EnableTrimTimer enables the periodic fstrim timer of the target
+func EnableTrimTimer(rootDir string) error {
+	// Make sure we have an installation environment
+	// and not a test environment
+	systemctl := filepath.Join(rootDir, "/usr/bin/systemctl")
+	if _, err := os.Stat(systemctl); os.IsNotExist(err) {
+		log.Warning("Could not enable %s, %s not found", fstrimTimer, systemctl)
+		return nil
+	}
+
+	if err := cmd.RunAndLog("chroot", rootDir, "systemctl", "enable", fstrimTimer); err != nil {
+		return errors.Wrap(err)
+	}
+
+	return nil
+}
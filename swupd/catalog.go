@@ -0,0 +1,322 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package swupd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/log"
+	"github.com/clearlinux/clr-installer/model"
+	"github.com/clearlinux/clr-installer/utils"
+)
+
+const (
+	// OtherCategory is the category of the bundles no other category matches
+	OtherCategory = "Other"
+)
+
+var (
+	// bundleDefinitionsDir holds the upstream bundle definitions shipped
+	// with the running system, their headers describe the bundles
+	bundleDefinitionsDir = "/usr/share/clear/allbundles"
+
+	// categoryPrefixes categorize the bundles by name when their definition
+	// has no tags, the first matching prefix wins
+	categoryPrefixes = []struct {
+		prefix   string
+		category string
+	}{
+		{"devpkg-", "Development Libraries"},
+		{"desktop", "Desktop"},
+		{"font", "Desktop"},
+		{"kernel-", "Kernels"},
+		{"linux-firmware", "Kernels"},
+		{"containers", "Containers"},
+		{"docker", "Containers"},
+		{"kubernetes", "Containers"},
+		{"cloud", "Cloud"},
+		{"openstack", "Cloud"},
+		{"machine-learning", "Machine Learning"},
+		{"computer-vision", "Machine Learning"},
+		{"R-", "Programming"},
+		{"c-basic", "Programming"},
+		{"go-basic", "Programming"},
+		{"java", "Programming"},
+		{"perl", "Programming"},
+		{"python", "Programming"},
+		{"ruby", "Programming"},
+		{"rust", "Programming"},
+		{"dev-utils", "Programming"},
+		{"database", "Servers"},
+		{"mariadb", "Servers"},
+		{"postgresql", "Servers"},
+		{"web-server", "Servers"},
+		{"network", "Networking"},
+		{"wpa", "Networking"},
+		{"sysadmin", "System Administration"},
+		{"storage-utils", "System Administration"},
+		{"games", "Games"},
+	}
+
+	// manifestSizes caches the content sizes read from the bundle manifests
+	manifestSizes      = map[string]uint64{}
+	manifestSizesMutex = &sync.Mutex{}
+)
+
+// Matches returns true if search is part of the bundle name, description or
+// category, ignoring the case; an empty search matches every bundle
+func (b *Bundle) Matches(search string) bool {
+	search = strings.ToLower(strings.TrimSpace(search))
+	if search == "" {
+		return true
+	}
+
+	for _, curr := range []string{b.Name, b.Desc, b.Category} {
+		if strings.Contains(strings.ToLower(curr), search) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// BundleCategory returns the category of the bundle name
+func BundleCategory(name string) string {
+	for _, curr := range categoryPrefixes {
+		if strings.HasPrefix(name, curr.prefix) {
+			return curr.category
+		}
+	}
+
+	return OtherCategory
+}
+
+// BundleCategories returns the categories of bundles in their order, the
+// other category last
+func BundleCategories(bundles []*Bundle) []string {
+	result := []string{}
+	other := false
+
+	for _, curr := range bundles {
+		if curr.Category == OtherCategory {
+			other = true
+		} else if !utils.StringSliceContains(result, curr.Category) {
+			result = append(result, curr.Category)
+		}
+	}
+
+	if other {
+		result = append(result, OtherCategory)
+	}
+
+	return result
+}
+
+// catalogSource returns the content URL and version the bundles of md are
+// installed from
+func catalogSource(md *model.SystemInstall) (string, string) {
+	mirror := md.SwupdMirror
+	if md.Offline {
+		mirror = "file://" + md.OfflineContentDir()
+	}
+
+	version := utils.ClearVersion
+	if md.Version != 0 {
+		version = fmt.Sprintf("%d", md.Version)
+	}
+
+	if md.AutoUpdate || version == "" {
+		version = "latest"
+	}
+
+	return mirror, version
+}
+
+// readBundleHeaders returns the "# [NAME]: value" headers of a bundle
+// definition file, empty if the definition is not available
+func readBundleHeaders(file string) map[string]string {
+	result := map[string]string{}
+
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return result
+	}
+
+	for _, line := range strings.Split(string(content), "\n") {
+		if !strings.HasPrefix(line, "# [") {
+			continue
+		}
+
+		tks := strings.SplitN(strings.TrimPrefix(line, "# ["), "]:", 2)
+		if len(tks) == 2 {
+			result[tks[0]] = strings.TrimSpace(tks[1])
+		}
+	}
+
+	return result
+}
+
+// catalogNames returns the bundles published for the content md installs,
+// the definitions of the running system are listed if it can't be fetched
+func catalogNames(md *model.SystemInstall) ([]string, error) {
+	mirror, version := catalogSource(md)
+
+	content, err := fetchManifest(mirror, version, "MoM")
+	if err == nil {
+		return parseMoMBundles(content), nil
+	}
+	log.Warning("Could not fetch the bundle catalog, listing the local definitions: %v", err)
+
+	files, dErr := ioutil.ReadDir(bundleDefinitionsDir)
+	if dErr != nil {
+		return nil, err
+	}
+
+	result := []string{}
+	for _, curr := range files {
+		if !curr.IsDir() {
+			result = append(result, curr.Name())
+		}
+	}
+
+	return result, nil
+}
+
+// LoadBundleCatalog returns the full bundle catalog of the content md
+// installs: the bundles of the bundle list first, then every other published
+// bundle described by its definition; the bundles always installed and the
+// deprecated ones are left out; the bundles are sorted by category
+func LoadBundleCatalog(md *model.SystemInstall) ([]*Bundle, error) {
+	curated, err := LoadBundleList(md)
+	if err != nil {
+		return nil, err
+	}
+
+	return bundleCatalog(md, curated), nil
+}
+
+// bundleCatalog adds the published bundles to the curated ones
+func bundleCatalog(md *model.SystemInstall, curated []*Bundle) []*Bundle {
+	result := append([]*Bundle{}, curated...)
+	known := map[string]bool{}
+	for _, curr := range curated {
+		known[curr.Name] = true
+	}
+
+	names, err := catalogNames(md)
+	if err != nil {
+		log.Warning("Could not list the bundle catalog: %v", err)
+	}
+
+	for _, name := range names {
+		if known[name] || md.ContainsBundle(name) || IsCoreBundle(name) || strings.HasPrefix(name, "os-core") {
+			continue
+		}
+		known[name] = true
+
+		headers := readBundleHeaders(filepath.Join(bundleDefinitionsDir, name))
+		if strings.EqualFold(headers["STATUS"], "Deprecated") {
+			continue
+		}
+
+		bundle := &Bundle{Name: name, Desc: headers["DESCRIPTION"]}
+		if bundle.Desc == "" {
+			bundle.Desc = headers["TITLE"]
+		}
+
+		if tags := strings.Split(headers["TAGS"], ","); tags[0] != "" {
+			bundle.Category = strings.TrimSpace(tags[0])
+		}
+
+		result = append(result, bundle)
+	}
+
+	for _, curr := range result {
+		if curr.Category == "" {
+			curr.Category = BundleCategory(curr.Name)
+		}
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		ci, cj := result[i].Category, result[j].Category
+		if ci != cj {
+			return cj == OtherCategory || (ci != OtherCategory && ci < cj)
+		}
+
+		return result[i].Name < result[j].Name
+	})
+
+	return result
+}
+
+// parseContentSize returns the contentsize header of a bundle manifest, the
+// installed size of the bundle files
+func parseContentSize(content string) (uint64, error) {
+	for _, line := range strings.Split(content, "\n") {
+		if line == "" {
+			break
+		}
+
+		tks := strings.Split(line, "\t")
+		if len(tks) == 2 && tks[0] == "contentsize:" {
+			size, err := strconv.ParseUint(tks[1], 10, 64)
+			if err != nil {
+				return 0, errors.Errorf("Invalid manifest content size %q", tks[1])
+			}
+
+			return size, nil
+		}
+	}
+
+	return 0, errors.Errorf("No content size in the manifest")
+}
+
+// FetchBundleSize sets the size of bundle from its manifest, the estimate of
+// its download; a bundle of known size is left untouched
+func FetchBundleSize(md *model.SystemInstall, bundle *Bundle) error {
+	if bundle.Size > 0 {
+		return nil
+	}
+
+	manifestSizesMutex.Lock()
+	size, ok := manifestSizes[bundle.Name]
+	manifestSizesMutex.Unlock()
+
+	if !ok {
+		mirror, version := catalogSource(md)
+
+		content, err := fetchManifest(mirror, version, bundle.Name)
+		if err != nil {
+			return err
+		}
+
+		if size, err = parseContentSize(content); err != nil {
+			return err
+		}
+
+		manifestSizesMutex.Lock()
+		manifestSizes[bundle.Name] = size
+		manifestSizesMutex.Unlock()
+	}
+
+	bundle.Size = size
+	return nil
+}
+
+// fetchedSize returns the size of the bundle name read from its manifest, 0
+// if it was not fetched
+func fetchedSize(name string) uint64 {
+	manifestSizesMutex.Lock()
+	defer manifestSizesMutex.Unlock()
+
+	return manifestSizes[name]
+}
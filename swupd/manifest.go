@@ -0,0 +1,117 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package swupd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/network"
+)
+
+const (
+	// DefaultContentURL is the Clear Linux update content server
+	DefaultContentURL = "https://cdn.download.clearlinux.org/update"
+
+	// contentURLFile holds the content URL of the host swupd
+	contentURLFile = "/usr/share/defaults/swupd/contenturl"
+)
+
+// contentURL returns the content URL of the mirror, the host one if no
+// mirror is set
+func contentURL(mirror string) string {
+	if mirror != "" {
+		return strings.TrimRight(mirror, "/")
+	}
+
+	if content, err := ioutil.ReadFile(contentURLFile); err == nil {
+		if url := strings.TrimSpace(string(content)); url != "" {
+			return strings.TrimRight(url, "/")
+		}
+	}
+
+	return DefaultContentURL
+}
+
+// fetchContent downloads the content file of url, the file:// urls of the
+// offline content are read locally
+func fetchContent(url string) (string, error) {
+	if strings.HasPrefix(url, "file://") {
+		content, err := ioutil.ReadFile(strings.TrimPrefix(url, "file://"))
+		if err != nil {
+			return "", errors.Wrap(err)
+		}
+
+		return string(content), nil
+	}
+
+	file, err := network.FetchRemoteConfigFile(url)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = os.Remove(file) }()
+
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", errors.Wrap(err)
+	}
+
+	return string(content), nil
+}
+
+// parseMoMBundles returns the bundles listed in a Manifest.MoM, the
+// manifest entries are "M..." flagged and tab separated:
+// flags, hash, version and bundle name
+func parseMoMBundles(content string) []string {
+	result := []string{}
+
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) != 4 || !strings.HasPrefix(fields[0], "M") {
+			continue
+		}
+
+		result = append(result, fields[3])
+	}
+
+	return result
+}
+
+// fetchManifest returns the Manifest.<name> of the version of the mirror,
+// the "latest" version is resolved first
+func fetchManifest(mirror string, version string, name string) (string, error) {
+	url := contentURL(mirror)
+
+	if version == "latest" {
+		latest, err := fetchContent(url + "/version/latest_version")
+		if err != nil {
+			return "", err
+		}
+
+		version = strings.TrimSpace(latest)
+	}
+
+	return fetchContent(fmt.Sprintf("%s/%s/Manifest.%s", url, version, name))
+}
+
+// BundleAvailable returns true if bundle is published for the version of
+// the mirror, or the host content URL if no mirror is set
+func BundleAvailable(mirror string, version string, bundle string) (bool, error) {
+	content, err := fetchManifest(mirror, version, "MoM")
+	if err != nil {
+		return false, err
+	}
+
+	for _, curr := range parseMoMBundles(content) {
+		if curr == bundle {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
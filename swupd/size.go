@@ -0,0 +1,150 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package swupd
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/clearlinux/clr-installer/log"
+	"github.com/clearlinux/clr-installer/model"
+	"github.com/clearlinux/clr-installer/storage"
+	"github.com/clearlinux/clr-installer/utils"
+)
+
+const (
+	// BaseContentSize is the approximate installed size of the core bundles,
+	// the kernel and the bundles required by the installer configuration
+	BaseContentSize = storage.BaseContentSize
+)
+
+// ContentSizeProblem describes the selected content not fitting the planned
+// root partition, Drop is the user bundles suggested to be dropped for it to
+// fit, Resolved is false if it won't fit even dropping all of them
+type ContentSizeProblem struct {
+	Needed    uint64
+	Available uint64
+	Drop      []*Bundle
+	Resolved  bool
+}
+
+// selectedBundles returns the bundles of selected, the ones missing from
+// bundles are added if their manifest size was fetched from the catalog
+func selectedBundles(bundles []*Bundle, selected []string) []*Bundle {
+	result := []*Bundle{}
+	known := map[string]bool{}
+
+	for _, curr := range bundles {
+		known[curr.Name] = true
+
+		if utils.StringSliceContains(selected, curr.Name) {
+			result = append(result, curr)
+		}
+	}
+
+	for _, curr := range selected {
+		if size := fetchedSize(curr); !known[curr] && size > 0 {
+			result = append(result, &Bundle{Name: curr, Size: size})
+		}
+	}
+
+	return result
+}
+
+// ContentSize returns the approximate installed size of the user bundles
+// selected from bundles, the bundles of unknown size count as empty
+func ContentSize(bundles []*Bundle, selected []string) uint64 {
+	result := BaseContentSize
+
+	for _, curr := range selectedBundles(bundles, selected) {
+		result += curr.Size
+	}
+
+	return result
+}
+
+// SpaceRequirements returns the disk space of installing the user bundles
+// selected from bundles with the storage configuration of md
+func SpaceRequirements(md *model.SystemInstall, bundles []*Bundle) *storage.SpaceRequirements {
+	return md.SpaceRequirements(ContentSize(bundles, md.UserBundles))
+}
+
+// LoadSpaceRequirements returns the SpaceRequirements of md with the sizes of
+// the bundle list, the disk pages feedback
+func LoadSpaceRequirements(md *model.SystemInstall) *storage.SpaceRequirements {
+	bundles, err := LoadBundleList(md)
+	if err != nil {
+		log.Warning("Could not load the bundle sizes: %v", err)
+	}
+
+	return SpaceRequirements(md, bundles)
+}
+
+// CheckContentSize checks the selected user bundles fit the planned root
+// partition, nil is returned if they fit or the root size is not known
+func CheckContentSize(md *model.SystemInstall, bundles []*Bundle) *ContentSizeProblem {
+	available := storage.RootPartitionSize(md.TargetMedias)
+	if available == 0 {
+		return nil
+	}
+
+	needed := SpaceRequirements(md, bundles).RootPartition()
+	if needed <= available {
+		return nil
+	}
+
+	result := &ContentSizeProblem{Needed: needed, Available: available, Drop: []*Bundle{}}
+
+	// suggest the largest bundles first, dropping as few as possible
+	selected := []*Bundle{}
+	for _, curr := range selectedBundles(bundles, md.UserBundles) {
+		if curr.Size > 0 {
+			selected = append(selected, curr)
+		}
+	}
+
+	sort.SliceStable(selected, func(i, j int) bool {
+		return selected[i].Size > selected[j].Size
+	})
+
+	for _, curr := range selected {
+		result.Drop = append(result.Drop, curr)
+		needed -= curr.Size
+
+		if needed <= available {
+			result.Resolved = true
+			break
+		}
+	}
+
+	return result
+}
+
+// Message returns the human readable description of the problem and how to
+// resolve it
+func (cp *ContentSizeProblem) Message() string {
+	needed, _ := storage.HumanReadableSize(cp.Needed)
+	available, _ := storage.HumanReadableSize(cp.Available)
+
+	msg := utils.Locale.Get("The selected bundles need about %s, the root partition has %s.", needed, available)
+
+	if !cp.Resolved {
+		return msg + " " + utils.Locale.Get("Grow the root partition to install them.")
+	}
+
+	names := []string{}
+	for _, curr := range cp.Drop {
+		names = append(names, curr.Name)
+	}
+
+	return msg + " " + utils.Locale.Get("Drop the bundles %s or grow the root partition.", strings.Join(names, ", "))
+}
+
+// DropBundles removes the suggested bundles from the model user bundles
+func (cp *ContentSizeProblem) DropBundles(md *model.SystemInstall) {
+	for _, curr := range cp.Drop {
+		md.RemoveUserBundle(curr.Name)
+	}
+}
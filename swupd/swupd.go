@@ -8,6 +8,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -32,6 +33,27 @@ var (
 	}
 )
 
+const (
+	// dropInFile is the name of the systemd drop-in files written by the installer
+	dropInFile = "clr-installer.conf"
+
+	// updateTimerDropIn replaces the swupd-update.timer schedule, the empty
+	// assignments reset the default timer triggers
+	updateTimerDropIn = `[Timer]
+OnBootSec=
+OnUnitActiveSec=
+OnCalendar=
+OnCalendar=%s
+`
+
+	// updateRebootDropIn reboots the system when swupd-update.service
+	// installed a new OS version
+	updateRebootDropIn = `[Service]
+ExecStartPre=/bin/sh -c 'grep ^VERSION_ID= /usr/lib/os-release > /run/swupd-update-version'
+ExecStartPost=/bin/sh -c 'grep -qxFf /run/swupd-update-version /usr/lib/os-release || systemctl reboot'
+`
+)
+
 // SoftwareUpdater abstracts the swupd executable, environment and operations
 type SoftwareUpdater struct {
 	rootDir            string
@@ -40,12 +62,18 @@ type SoftwareUpdater struct {
 	contentURL         string
 	versionURL         string
 	skipDiskSpaceCheck bool
+	ioNice             bool
+	taskLog            io.Writer
 }
 
 // Bundle maps a map name and description with the actual checkbox
 type Bundle struct {
 	Name string // Name the bundle name or id
 	Desc string // Desc is the bundle long description
+	Size uint64 // Size is the approximate installed size in bytes, 0 if unknown
+
+	// Category groups the bundles of the catalog, i.e: Programming
+	Category string
 }
 
 // IsCoreBundle checks if bundle is in the list of core bundles
@@ -73,7 +101,25 @@ func New(rootDir string, options args.Args) *SoftwareUpdater {
 		options.SwupdContentURL,
 		options.SwupdVersionURL,
 		options.SwupdSkipDiskSpaceCheck,
+		!options.NoIOTune,
+		nil,
+	}
+}
+
+// SetTaskLog sets the writer of the swupd commands output, i.e. the
+// log.TaskWriter() of the install task
+func (s *SoftwareUpdater) SetTaskLog(w io.Writer) {
+	s.taskLog = w
+}
+
+// runAndLog runs a swupd command, its output is logged or written to the
+// task log if set
+func (s *SoftwareUpdater) runAndLog(args ...string) error {
+	if s.taskLog == nil {
+		return cmd.RunAndLog(args...)
 	}
+
+	return cmd.Run(s.taskLog, args...)
 }
 
 func (s *SoftwareUpdater) setExtraFlags(args []string) []string {
@@ -115,7 +161,7 @@ func (s *SoftwareUpdater) Verify(version string, mirror string, verifyOnly bool)
 			"--no-scripts",
 		}...)
 
-	err := cmd.RunAndLog(args...)
+	err := s.runAndLog(args...)
 	if err != nil {
 		return errors.Wrap(err)
 	}
@@ -129,7 +175,7 @@ func (s *SoftwareUpdater) Verify(version string, mirror string, verifyOnly bool)
 			mirror,
 		}
 
-		err = cmd.RunAndLog(args...)
+		err = s.runAndLog(args...)
 		if err != nil {
 			return errors.Wrap(err)
 		}
@@ -163,7 +209,7 @@ func (s *SoftwareUpdater) Verify(version string, mirror string, verifyOnly bool)
 		}
 	}
 
-	err = cmd.RunAndLog(args...)
+	err = s.runAndLog(args...)
 	if err != nil {
 		return errors.Wrap(err)
 	}
@@ -171,8 +217,9 @@ func (s *SoftwareUpdater) Verify(version string, mirror string, verifyOnly bool)
 	return nil
 }
 
-// VerifyWithBundles runs "swupd verify" operation with all bundles
-func (s *SoftwareUpdater) VerifyWithBundles(version string, mirror string, bundles []string) error {
+// verifyWithBundlesArgs returns the "swupd verify --install" command installing
+// the core bundles and bundles
+func (s *SoftwareUpdater) verifyWithBundlesArgs(version string, mirror string, bundles []string) []string {
 	args := []string{
 		"swupd",
 		"verify",
@@ -214,7 +261,37 @@ func (s *SoftwareUpdater) VerifyWithBundles(version string, mirror string, bundl
 
 	args = append(args, strings.Join(allBundles, ","))
 
-	err := cmd.RunAndLog(args...)
+	// run the content install in the best effort lowest I/O priority
+	// so the frontends are kept responsive
+	if s.ioNice {
+		args = append([]string{"ionice", "-c", "2", "-n", "7"}, args...)
+	}
+
+	return args
+}
+
+// Prefetch downloads the content VerifyWithBundles would install to the state
+// directory without installing it, a following install with the same state
+// directory reuses the downloaded content
+func (s *SoftwareUpdater) Prefetch(version string, mirror string, bundles []string) error {
+	args := s.verifyWithBundlesArgs(version, mirror, bundles)
+
+	// the bundle list must remain the last argument
+	bundleList := args[len(args)-1]
+	args = append(args[:len(args)-1], "--download", bundleList)
+
+	if err := s.runAndLog(args...); err != nil {
+		return errors.Wrap(err)
+	}
+
+	return nil
+}
+
+// VerifyWithBundles runs "swupd verify" operation with all bundles
+func (s *SoftwareUpdater) VerifyWithBundles(version string, mirror string, bundles []string) error {
+	args := s.verifyWithBundlesArgs(version, mirror, bundles)
+
+	err := s.runAndLog(args...)
 	if err != nil {
 		return errors.Wrap(err)
 	}
@@ -228,7 +305,7 @@ func (s *SoftwareUpdater) VerifyWithBundles(version string, mirror string, bundl
 			mirror,
 		}
 
-		err = cmd.RunAndLog(args...)
+		err = s.runAndLog(args...)
 		if err != nil {
 			return errors.Wrap(err)
 		}
@@ -237,6 +314,37 @@ func (s *SoftwareUpdater) VerifyWithBundles(version string, mirror string, bundl
 	return nil
 }
 
+// InstallBundle installs the bundle of version to the updater root directory,
+// along with os-core which swupd always requires, the content is verified
+// against the signed manifests
+func (s *SoftwareUpdater) InstallBundle(version string, bundle string) error {
+	args := []string{
+		"swupd",
+		"verify",
+	}
+
+	args = s.setExtraFlags(args)
+
+	args = append(args,
+		[]string{
+			fmt.Sprintf("--path=%s", s.rootDir),
+			fmt.Sprintf("--statedir=%s", s.stateDir),
+			"--install",
+			"-m",
+			version,
+			"--force",
+			"--no-boot-update",
+			"-B",
+			bundle,
+		}...)
+
+	if err := s.runAndLog(args...); err != nil {
+		return errors.Wrap(err)
+	}
+
+	return nil
+}
+
 // Update executes the "swupd update" operation
 func (s *SoftwareUpdater) Update() error {
 	args := []string{
@@ -249,7 +357,7 @@ func (s *SoftwareUpdater) Update() error {
 
 	log.Info("Checking for swupd updates")
 
-	err := cmd.RunAndLog(args...)
+	err := s.runAndLog(args...)
 	if err != nil {
 		return errors.Wrap(err)
 	}
@@ -270,7 +378,7 @@ func (s *SoftwareUpdater) DisableUpdate() error {
 		"swupd-update.timer",
 	}
 
-	err := cmd.RunAndLog(args...)
+	err := s.runAndLog(args...)
 	if err != nil {
 		return errors.Wrap(err)
 	}
@@ -278,6 +386,46 @@ func (s *SoftwareUpdater) DisableUpdate() error {
 	return nil
 }
 
+// ConfigureUpdatePolicy writes the systemd drop-ins applying policy to the
+// target's swupd-update timer and service
+func (s *SoftwareUpdater) ConfigureUpdatePolicy(policy *model.UpdatePolicy) error {
+	if policy == nil {
+		return nil
+	}
+
+	unitDir := filepath.Join(s.rootDir, "etc", "systemd", "system")
+
+	if policy.Schedule != "" {
+		content := fmt.Sprintf(updateTimerDropIn, policy.Schedule)
+		if err := writeDropIn(unitDir, "swupd-update.timer", content); err != nil {
+			return err
+		}
+	}
+
+	if policy.Reboot == model.RebootOnUpdate {
+		if err := writeDropIn(unitDir, "swupd-update.service", updateRebootDropIn); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeDropIn writes content as the clr-installer drop-in of the systemd unit
+func writeDropIn(unitDir string, unit string, content string) error {
+	dropInDir := filepath.Join(unitDir, unit+".d")
+
+	if err := os.MkdirAll(dropInDir, 0755); err != nil {
+		return errors.Wrap(err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dropInDir, dropInFile), []byte(content), 0644); err != nil {
+		return errors.Wrap(err)
+	}
+
+	return nil
+}
+
 // getMirror executes the "swupd mirror" to find the current mirror
 func getMirror(swupdArgs []string, t string) (string, error) {
 	w := bytes.NewBuffer(nil)
@@ -469,7 +617,7 @@ func (s *SoftwareUpdater) BundleAdd(bundle string) error {
 		bundle,
 	)
 
-	err := cmd.RunAndLog(args...)
+	err := s.runAndLog(args...)
 	if err != nil {
 		return errors.Wrap(err)
 	}
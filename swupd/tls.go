@@ -0,0 +1,110 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package swupd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/clearlinux/clr-installer/cmd"
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/model"
+	"github.com/clearlinux/clr-installer/utils"
+)
+
+const (
+	// ClientCertFile is where swupd looks for the client certificate and
+	// key of the mirrors requiring mutual TLS
+	ClientCertFile = "/etc/swupd/client.pem"
+)
+
+// ConfigureTLS sets up swupd in rootDir, the installer itself if "/", to
+// connect a mirror requiring mutual TLS: the client certificate and key are
+// written to ClientCertFile and the CA certificate is trusted
+func ConfigureTLS(rootDir string, tls *model.SwupdTLS) error {
+	if tls == nil {
+		return nil
+	}
+
+	if tls.ClientCert != "" {
+		if err := writeClientCert(rootDir, tls.ClientCert, tls.ClientKey); err != nil {
+			return err
+		}
+	}
+
+	if tls.CACert != "" {
+		if err := trustCACert(rootDir, tls.CACert); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeClientCert writes the client certificate and key secrets to the
+// ClientCertFile of rootDir, readable by root only
+func writeClientCert(rootDir string, certRef string, keyRef string) error {
+	cert, err := utils.ReadSecret(certRef)
+	if err != nil {
+		return err
+	}
+
+	key, err := utils.ReadSecret(keyRef)
+	if err != nil {
+		return err
+	}
+
+	file := filepath.Join(rootDir, ClientCertFile)
+	if err = os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return errors.Wrap(err)
+	}
+
+	content := append(bytes.TrimRight(cert, "\n"), '\n')
+	content = append(content, bytes.TrimRight(key, "\n")...)
+	content = append(content, '\n')
+
+	if err = ioutil.WriteFile(file, content, 0600); err != nil {
+		return errors.Wrap(err)
+	}
+
+	return nil
+}
+
+// trustCACert adds caFile to the trusted certificates of rootDir, the target
+// file is copied to its temporary directory and added from a chroot
+func trustCACert(rootDir string, caFile string) error {
+	if rootDir == "/" {
+		if err := cmd.RunAndLog("clrtrust", "add", caFile); err != nil {
+			return errors.Wrap(err)
+		}
+		return nil
+	}
+
+	content, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return errors.Wrap(err)
+	}
+
+	tmpFile, err := ioutil.TempFile(filepath.Join(rootDir, "tmp"), "clr-installer-ca-")
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	defer func() { _ = os.Remove(tmpFile.Name()) }()
+
+	if _, err = tmpFile.Write(content); err != nil {
+		_ = tmpFile.Close()
+		return errors.Wrap(err)
+	}
+	_ = tmpFile.Close()
+
+	target := filepath.Join("/tmp", filepath.Base(tmpFile.Name()))
+	if err = cmd.RunAndLog("chroot", rootDir, "clrtrust", "add", target); err != nil {
+		return errors.Wrap(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,124 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package syscheck
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/clearlinux/clr-installer/utils"
+)
+
+const (
+	// SerialConsoleSpeed is the baud rate of the serial console, the BMC
+	// serial over LAN default
+	SerialConsoleSpeed = 115200
+
+	// defaultSerialConsole is used when a BMC is found but no serial port
+	// reports its UART, the BMC serial over LAN is usually the first port
+	defaultSerialConsole = "ttyS0"
+)
+
+var (
+	// sysDRMDir is the sysfs directory holding the display connectors
+	sysDRMDir = "/sys/class/drm"
+
+	// sysTTYDir is the sysfs directory holding the serial ports
+	sysTTYDir = "/sys/class/tty"
+
+	// sysIPMIDir is the sysfs directory of the BMC IPMI interfaces
+	sysIPMIDir = "/sys/class/ipmi"
+)
+
+// SerialConsole is the serial console of a headless system, Reason tells the
+// hardware requiring it
+type SerialConsole struct {
+	Device string
+	Reason string
+}
+
+// KernelArgument returns the kernel console argument of the serial console
+func (sc *SerialConsole) KernelArgument() string {
+	return fmt.Sprintf("console=%s,%d", sc.Device, SerialConsoleSpeed)
+}
+
+// GettyService returns the getty service of the serial console
+func (sc *SerialConsole) GettyService() string {
+	return fmt.Sprintf("serial-getty@%s.service", sc.Device)
+}
+
+// String returns the kernel argument and the reason it was selected
+func (sc *SerialConsole) String() string {
+	return fmt.Sprintf("%s (%s)", sc.KernelArgument(), sc.Reason)
+}
+
+// DetectSerialConsole returns the serial console of a headless system, a
+// system with no connected display and a serial port or a BMC; nil otherwise
+func DetectSerialConsole() *SerialConsole {
+	if hasConnectedDisplay() {
+		return nil
+	}
+
+	port := firstSerialPort()
+	bmc := hasBMC()
+
+	switch {
+	case port != "" && bmc:
+		return &SerialConsole{Device: port, Reason: utils.Locale.Get("no display, BMC detected")}
+	case port != "":
+		return &SerialConsole{Device: port, Reason: utils.Locale.Get("no display, serial port detected")}
+	case bmc:
+		return &SerialConsole{Device: defaultSerialConsole, Reason: utils.Locale.Get("no display, BMC detected")}
+	}
+
+	return nil
+}
+
+// hasConnectedDisplay returns true if any display connector is connected
+func hasConnectedDisplay() bool {
+	status, _ := filepath.Glob(filepath.Join(sysDRMDir, "card*-*", "status"))
+
+	for _, curr := range status {
+		content, err := ioutil.ReadFile(curr)
+		if err == nil && strings.TrimSpace(string(content)) == "connected" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// firstSerialPort returns the first serial port backed by an UART, the
+// placeholder ports have an unknown (0) type
+func firstSerialPort() string {
+	ports, _ := filepath.Glob(filepath.Join(sysTTYDir, "ttyS*"))
+
+	for _, curr := range ports {
+		content, err := ioutil.ReadFile(filepath.Join(curr, "type"))
+		if err == nil && strings.TrimSpace(string(content)) != "0" {
+			return filepath.Base(curr)
+		}
+	}
+
+	return ""
+}
+
+// hasBMC returns true if a BMC IPMI interface is present
+func hasBMC() bool {
+	ifaces, err := ioutil.ReadDir(sysIPMIDir)
+	return err == nil && len(ifaces) > 0
+}
+
+// SerialConsoleMessage returns the review message of the serial console
+// automatically configured for the install, empty if there's none
+func SerialConsoleMessage(sc *SerialConsole) string {
+	if sc == nil {
+		return ""
+	}
+
+	return utils.Locale.Get("Serial console") + ": " + sc.String()
+}
@@ -0,0 +1,116 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package syscheck
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/clearlinux/clr-installer/log"
+	"github.com/clearlinux/clr-installer/utils"
+)
+
+const (
+	// CPUVendorIntel is the /proc/cpuinfo vendor id of the Intel processors
+	CPUVendorIntel = "GenuineIntel"
+
+	// CPUVendorAMD is the /proc/cpuinfo vendor id of the AMD processors
+	CPUVendorAMD = "AuthenticAMD"
+)
+
+// FirmwareBundle is a bundle providing the firmware or CPU microcode the
+// running hardware needs, Reason tells the hardware requiring it
+type FirmwareBundle struct {
+	Bundle string
+	Reason string
+}
+
+var (
+	// cpuMicrocodeBundles maps the CPU vendors to the bundle providing
+	// their microcode updates
+	cpuMicrocodeBundles = map[string]string{
+		CPUVendorIntel: "linux-firmware",
+		CPUVendorAMD:   "linux-firmware",
+	}
+
+	// wirelessFirmwareBundle provides the wireless adapters firmware
+	wirelessFirmwareBundle = "linux-firmware-wifi"
+
+	// sysNetDir is the sysfs directory holding the network interfaces
+	sysNetDir = "/sys/class/net"
+)
+
+// String returns the bundle and the reason it was selected
+func (fb *FirmwareBundle) String() string {
+	return fmt.Sprintf("%s (%s)", fb.Bundle, fb.Reason)
+}
+
+// GetCPUVendor returns the vendor id of the running processor
+func GetCPUVendor() string {
+	cpu, err := getCPUInfo()
+	if err != nil {
+		log.Warning("Could not detect the CPU vendor: %v", err)
+		return ""
+	}
+
+	return cpu.Vendor
+}
+
+// DetectFirmwareBundles returns the bundles providing the CPU microcode and
+// the firmware of the running hardware
+func DetectFirmwareBundles() []*FirmwareBundle {
+	result := []*FirmwareBundle{}
+	vendor := GetCPUVendor()
+
+	if bundle, ok := cpuMicrocodeBundles[vendor]; ok {
+		result = append(result, &FirmwareBundle{
+			Bundle: bundle,
+			Reason: utils.Locale.Get("%s CPU microcode", vendor),
+		})
+	}
+
+	if hasWirelessInterface() {
+		result = append(result, &FirmwareBundle{
+			Bundle: wirelessFirmwareBundle,
+			Reason: utils.Locale.Get("wireless adapter firmware"),
+		})
+	}
+
+	return result
+}
+
+// hasWirelessInterface returns true if any network interface is a wireless one
+func hasWirelessInterface() bool {
+	ifaces, err := ioutil.ReadDir(sysNetDir)
+	if err != nil {
+		return false
+	}
+
+	for _, curr := range ifaces {
+		if _, err := os.Stat(filepath.Join(sysNetDir, curr.Name(), "wireless")); err == nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// FirmwareBundlesMessage returns the review message of the firmware bundles
+// automatically added to the install, empty if there's none
+func FirmwareBundlesMessage(bundles []*FirmwareBundle) string {
+	if len(bundles) == 0 {
+		return ""
+	}
+
+	values := []string{}
+	for _, curr := range bundles {
+		values = append(values, curr.String())
+	}
+
+	return utils.Locale.Get("Firmware bundles") + ": " + strings.Join(values, ", ")
+}
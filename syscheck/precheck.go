@@ -0,0 +1,263 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package syscheck
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/clearlinux/clr-installer/conf"
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/network"
+	"github.com/clearlinux/clr-installer/storage"
+	"github.com/clearlinux/clr-installer/utils"
+)
+
+const (
+	// PolicyFail makes a failed check block the install
+	PolicyFail = "fail"
+
+	// PolicyWarn reports a failed check without blocking the install
+	PolicyWarn = "warn"
+
+	// PolicySkip doesn't run the check
+	PolicySkip = "skip"
+
+	// CheckCPU checks the CPU features required by Clear Linux
+	CheckCPU = "cpu"
+
+	// CheckEFI checks the system booted with EFI firmware
+	CheckEFI = "efi"
+
+	// CheckNetwork checks the update server is reachable
+	CheckNetwork = "network"
+
+	// CheckDiskSpace checks a disk is large enough for an install
+	CheckDiskSpace = "disk-space"
+
+	// CheckMemory checks the system memory is enough for the installer
+	CheckMemory = "memory"
+
+	// MinimumMemory is the memory under which the installer may fail
+	MinimumMemory = 1024 * 1024 * 1024
+
+	// CheckTimeout is the time a single check is given to complete
+	CheckTimeout = 30 * time.Second
+)
+
+// PreCheck is a single system check run before installing
+type PreCheck struct {
+	Name   string
+	Desc   string
+	Policy string // default policy, when not configured
+	run    func() error
+}
+
+// CheckResult is the outcome of a pre-check given its policy
+type CheckResult struct {
+	Check  *PreCheck
+	Policy string
+	Err    error
+}
+
+var (
+	// Policies are the supported pre-check policies
+	Policies = []string{PolicyFail, PolicyWarn, PolicySkip}
+
+	// PreChecks are the system checks run before installing, in order
+	PreChecks = []*PreCheck{
+		{Name: CheckCPU, Desc: "Required CPU features", Policy: PolicyFail, run: checkCPUFeatures},
+		{Name: CheckEFI, Desc: "EFI firmware", Policy: PolicyFail, run: getEFIExist},
+		{Name: CheckMemory, Desc: "System memory", Policy: PolicyWarn, run: checkMemory},
+		{Name: CheckDiskSpace, Desc: "Installation disk", Policy: PolicyFail, run: checkDiskSpace},
+		{Name: CheckNetwork, Desc: "Network connectivity", Policy: PolicyWarn, run: network.VerifyConnectivity},
+	}
+
+	// checkTimeout is CheckTimeout, shortened by the tests
+	checkTimeout = CheckTimeout
+)
+
+// ValidatePolicies checks policies maps known pre-checks to known policies
+func ValidatePolicies(policies map[string]string) error {
+	names := []string{}
+	for _, curr := range PreChecks {
+		names = append(names, curr.Name)
+	}
+
+	for name, policy := range policies {
+		if !utils.StringSliceContains(names, name) {
+			return errors.ValidationErrorf("Unknown pre-check %q, must be one of: %s",
+				name, strings.Join(names, ", "))
+		}
+
+		if !utils.StringSliceContains(Policies, policy) {
+			return errors.ValidationErrorf("Invalid %s pre-check policy %q, must be one of: %s",
+				name, policy, strings.Join(Policies, ", "))
+		}
+	}
+
+	return nil
+}
+
+// Passed returns true if the check succeeded or was skipped
+func (cr *CheckResult) Passed() bool {
+	return cr.Err == nil
+}
+
+// Blocking returns true if the failed check must block the install
+func (cr *CheckResult) Blocking() bool {
+	return cr.Err != nil && cr.Policy == PolicyFail
+}
+
+// Status returns the short status of the check
+func (cr *CheckResult) Status() string {
+	switch {
+	case cr.Policy == PolicySkip:
+		return utils.Locale.Get("skipped")
+	case cr.Passed():
+		return utils.Locale.Get("success")
+	case cr.Blocking():
+		return utils.Locale.Get("failed")
+	}
+
+	return utils.Locale.Get("warning")
+}
+
+// String returns the check description, status and error if any
+func (cr *CheckResult) String() string {
+	result := fmt.Sprintf("%s: %s", utils.Locale.Get(cr.Check.Desc), cr.Status())
+	if cr.Err != nil {
+		result = fmt.Sprintf("%s (%v)", result, cr.Err)
+	}
+
+	return result
+}
+
+// RunPreChecks runs the pre-checks following policies, the checks with no
+// policy use their default one; every check is given CheckTimeout. The
+// network is not required when the install media ships the swupd content
+func RunPreChecks(policies map[string]string) []*CheckResult {
+	result := []*CheckResult{}
+	offline := conf.LookupOfflineContent() != ""
+
+	for _, curr := range PreChecks {
+		cr := &CheckResult{Check: curr, Policy: curr.Policy}
+		if policy, ok := policies[curr.Name]; ok {
+			cr.Policy = policy
+		}
+
+		if offline && curr.Name == CheckNetwork && cr.Policy == PolicyFail {
+			cr.Policy = PolicyWarn
+		}
+
+		if cr.Policy != PolicySkip {
+			cr.Err = runTimeBoxed(curr.run, checkTimeout)
+		}
+
+		result = append(result, cr)
+	}
+
+	return result
+}
+
+// runTimeBoxed runs check and gives up waiting for it after timeout
+func runTimeBoxed(check func() error, timeout time.Duration) error {
+	done := make(chan error, 1)
+
+	go func() {
+		done <- check()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(timeout):
+		return errors.Errorf("%s", utils.Locale.Get("Timed out after %v", timeout))
+	}
+}
+
+// BlockingResults returns the failed checks blocking the install
+func BlockingResults(results []*CheckResult) []*CheckResult {
+	blocking := []*CheckResult{}
+
+	for _, curr := range results {
+		if curr.Blocking() {
+			blocking = append(blocking, curr)
+		}
+	}
+
+	return blocking
+}
+
+// OverridePolicies returns policies with the blocking checks of results
+// downgraded to warnings, an administrator decided to proceed anyway
+func OverridePolicies(policies map[string]string, results []*CheckResult) map[string]string {
+	overridden := map[string]string{}
+
+	for name, policy := range policies {
+		overridden[name] = policy
+	}
+
+	for _, curr := range BlockingResults(results) {
+		overridden[curr.Check.Name] = PolicyWarn
+		curr.Policy = PolicyWarn
+	}
+
+	return overridden
+}
+
+// checkCPUFeatures checks the CPU has all the features required
+func checkCPUFeatures() error {
+	for _, feature := range cpuFeatures {
+		if err := getCPUFeature(feature); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkMemory checks the system has MinimumMemory
+func checkMemory() error {
+	total, err := getMemTotal()
+	if err != nil {
+		return err
+	}
+
+	if total < MinimumMemory {
+		size, _ := storage.HumanReadableSize(total)
+		return errors.Errorf("%s", utils.Locale.Get("Only %s of memory, at least 1GB is recommended", size))
+	}
+
+	return nil
+}
+
+// checkDiskSpace checks a writable disk is large enough for the smallest
+// install, as the disk pages and the model validation size it
+func checkDiskSpace() error {
+	bds, err := storage.ListBlockDevices(nil)
+	if err != nil {
+		return err
+	}
+
+	sizes := []uint64{0}
+	for _, curr := range bds {
+		if curr.Type == storage.BlockDeviceTypeDisk && !curr.ReadOnly {
+			sizes = append(sizes, curr.Size)
+		}
+	}
+
+	sort.Slice(sizes, func(i, j int) bool { return sizes[i] > sizes[j] })
+
+	needed := storage.NewSpaceRequirements(0).Total()
+	if sizes[0] < needed {
+		size, _ := storage.HumanReadableSize(needed)
+		return errors.Errorf("%s", utils.Locale.Get("No disk of at least %s found", size))
+	}
+
+	return nil
+}
@@ -15,6 +15,16 @@ import (
 	"github.com/clearlinux/clr-installer/utils"
 )
 
+// cpuFeatures are the CPU features required by Clear Linux
+var cpuFeatures = []string{
+	"lm",
+	"sse4_2",
+	"sse4_1",
+	"pclmulqdq",
+	"aes",
+	"ssse3",
+}
+
 func getCPUFeature(feature string) error {
 	cpuInfo, err := ioutil.ReadFile("/proc/cpuinfo")
 	if err != nil {
@@ -36,56 +46,33 @@ func getEFIExist() error {
 	return nil
 }
 
-// RunSystemCheck checks compatibility for clear linux. (e.g. EFI firmware, CPU featureset)
-func RunSystemCheck(quiet bool) error {
+// RunSystemCheck runs the pre-checks following policies and reports each of
+// them, an error is returned if any failed check blocks the install
+func RunSystemCheck(quiet bool, policies map[string]string) error {
 	log.Info("Running system compatibility checks.")
 
-	//Check the following CPU features from /proc/cpuinfo
-	cpuFeatures := []string{
-		"lm",
-		"sse4_2",
-		"sse4_1",
-		"pclmulqdq",
-		"aes",
-		"ssse3",
-	}
-	for _, feature := range cpuFeatures {
-		if !quiet {
-			fmt.Printf("Checking for required CPU feaure: %s", feature)
-		}
+	results := RunPreChecks(policies)
 
-		err := getCPUFeature(feature)
-		if err != nil {
-			if !quiet {
-				fmt.Printf(" [*failed*]\n")
-				fmt.Println(err)
+	for _, curr := range results {
+		if !quiet {
+			fmt.Printf("Checking %s [%s]\n", curr.Check.Desc, curr.Status())
+			if curr.Err != nil {
+				fmt.Println(curr.Err)
 			}
-			log.ErrorError(err)
-
-			return err
 		}
-		if !quiet {
-			fmt.Println(" [success]")
+
+		if curr.Err != nil {
+			log.Warning("Pre-check %s", curr)
 		}
 	}
 
-	//Check if we have EFI firmware
-	if !quiet {
-		fmt.Printf("Checking for required EFI firmware")
-	}
-	err := getEFIExist()
-	if err != nil {
-		if !quiet {
-			fmt.Printf(" [*failed*]\n")
-			fmt.Println(err)
-		}
+	if blocking := BlockingResults(results); len(blocking) > 0 {
+		err := blocking[0].Err
 		log.ErrorError(err)
-
 		return err
 	}
 
 	if !quiet {
-		fmt.Println(" [success]")
 		fmt.Println("Success: System is compatible")
 	}
 	log.Info("Success: System is compatible")
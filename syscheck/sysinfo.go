@@ -0,0 +1,179 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package syscheck
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/network"
+	"github.com/clearlinux/clr-installer/storage"
+)
+
+// SystemInfo is the detected hardware, medias and network interfaces of
+// the running system
+type SystemInfo struct {
+	Firmware   string               `json:"firmware"`
+	CPU        *CPUInfo             `json:"cpu"`
+	Memory     uint64               `json:"memory"`
+	Medias     []*MediaInfo         `json:"medias"`
+	Interfaces []*network.Interface `json:"networkInterfaces"`
+}
+
+// CPUInfo describes the system processor, MissingFeatures lists the CPU
+// features required by Clear Linux the processor doesn't have
+type CPUInfo struct {
+	Vendor          string   `json:"vendor"`
+	Model           string   `json:"model"`
+	Processors      int      `json:"processors"`
+	MissingFeatures []string `json:"missingFeatures,omitempty"`
+}
+
+// MediaInfo describes a detected block device and its partitions
+type MediaInfo struct {
+	Name       string       `json:"name"`
+	Model      string       `json:"model,omitempty"`
+	Serial     string       `json:"serial,omitempty"`
+	Type       string       `json:"type"`
+	Size       uint64       `json:"size"`
+	PtType     string       `json:"ptType,omitempty"`
+	FsType     string       `json:"fsType,omitempty"`
+	MountPoint string       `json:"mountPoint,omitempty"`
+	Removable  bool         `json:"removable"`
+	ReadOnly   bool         `json:"readOnly"`
+	Available  bool         `json:"available"`
+	Partitions []*MediaInfo `json:"partitions,omitempty"`
+}
+
+// GetSystemInfo scans the running system reusing the installer's storage and
+// network detection
+func GetSystemInfo() (*SystemInfo, error) {
+	var err error
+
+	info := &SystemInfo{Firmware: "efi"}
+
+	if getEFIExist() != nil {
+		info.Firmware = "legacy"
+	}
+
+	if info.CPU, err = getCPUInfo(); err != nil {
+		return nil, err
+	}
+
+	if info.Memory, err = getMemTotal(); err != nil {
+		return nil, err
+	}
+
+	bds, err := storage.ListBlockDevices(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	info.Medias = []*MediaInfo{}
+	for _, curr := range bds {
+		info.Medias = append(info.Medias, newMediaInfo(curr))
+	}
+
+	if info.Interfaces, err = network.Interfaces(); err != nil {
+		return nil, err
+	}
+
+	return info, nil
+}
+
+// JSON returns the indented JSON representation of info
+func (info *SystemInfo) JSON() (string, error) {
+	data, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return "", errors.Wrap(err)
+	}
+
+	return string(data), nil
+}
+
+func newMediaInfo(bd *storage.BlockDevice) *MediaInfo {
+	result := &MediaInfo{
+		Name:       bd.Name,
+		Model:      bd.Model,
+		Serial:     bd.Serial,
+		Type:       bd.Type.String(),
+		Size:       bd.Size,
+		PtType:     bd.PtType,
+		FsType:     bd.FsType,
+		MountPoint: bd.MountPoint,
+		Removable:  bd.RemovableDevice,
+		ReadOnly:   bd.ReadOnly,
+		Available:  bd.IsAvailable(),
+	}
+
+	for _, ch := range bd.Children {
+		result.Partitions = append(result.Partitions, newMediaInfo(ch))
+	}
+
+	return result
+}
+
+func getCPUInfo() (*CPUInfo, error) {
+	content, err := ioutil.ReadFile("/proc/cpuinfo")
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+
+	result := &CPUInfo{}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+
+	for scanner.Scan() {
+		tks := strings.SplitN(scanner.Text(), ":", 2)
+		if len(tks) != 2 {
+			continue
+		}
+
+		switch strings.TrimSpace(tks[0]) {
+		case "processor":
+			result.Processors++
+		case "vendor_id":
+			result.Vendor = strings.TrimSpace(tks[1])
+		case "model name":
+			result.Model = strings.TrimSpace(tks[1])
+		}
+	}
+
+	for _, feature := range cpuFeatures {
+		if getCPUFeature(feature) != nil {
+			result.MissingFeatures = append(result.MissingFeatures, feature)
+		}
+	}
+
+	return result, nil
+}
+
+// getMemTotal returns the total memory in bytes as reported by /proc/meminfo
+func getMemTotal() (uint64, error) {
+	content, err := ioutil.ReadFile("/proc/meminfo")
+	if err != nil {
+		return 0, errors.Wrap(err)
+	}
+
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[0] != "MemTotal:" {
+			continue
+		}
+
+		kb, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return 0, errors.Wrap(err)
+		}
+
+		return kb * 1024, nil
+	}
+
+	return 0, errors.Errorf("Could not find the total memory in /proc/meminfo")
+}
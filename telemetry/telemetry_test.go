@@ -407,3 +407,59 @@ func TestConfigNotChanged(t *testing.T) {
 		}
 	}
 }
+
+type usageTestPage struct{}
+
+func TestUsageReport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "clr-installer-usage-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	file := filepath.Join(dir, "usage.json")
+
+	// an installed session
+	StartUsage(file, "tui")
+	UsageEnter(&usageTestPage{})
+	UsageLeave(UsageActionCancel)
+	UsageEnter(&usageTestPage{})
+	UsageInstalled()
+	StopUsage()
+
+	// an abandoned session
+	time.Sleep(time.Millisecond)
+	StartUsage(file, "gui")
+	UsageEnter(&usageTestPage{})
+	StopUsage()
+
+	// recording stopped, must be ignored
+	UsageEnter(&usageTestPage{})
+
+	events, err := ReadUsageEvents(file)
+	if err != nil {
+		t.Fatalf("Should have read the usage events: %v", err)
+	}
+
+	if len(events) != 4 {
+		t.Fatalf("Expected 4 usage events, got %d", len(events))
+	}
+
+	report := NewUsageReport(events)
+
+	if report.Sessions != 2 || report.Installed != 1 {
+		t.Fatalf("Expected 2 sessions and 1 installed, got %d and %d", report.Sessions, report.Installed)
+	}
+
+	if len(report.Pages) != 1 {
+		t.Fatalf("Expected a single page report, got %d", len(report.Pages))
+	}
+
+	pr := report.Pages[0]
+	if pr.Page != "usageTestPage" || pr.Visits != 3 || pr.Canceled != 1 || pr.Abandoned != 1 {
+		t.Fatalf("Invalid page report: %+v", pr)
+	}
+}
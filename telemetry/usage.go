@@ -0,0 +1,322 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package telemetry
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/log"
+)
+
+const (
+	// UsageActionLeave is the action of a page visit ended by navigating away
+	UsageActionLeave = "leave"
+
+	// UsageActionConfirm is the action of a page visit ended by confirming the changes
+	UsageActionConfirm = "confirm"
+
+	// UsageActionCancel is the action of a page visit ended by canceling the changes
+	UsageActionCancel = "cancel"
+
+	// UsageActionAbandon is the action of the last page visit of a session ended
+	// without starting the install
+	UsageActionAbandon = "abandon"
+
+	// UsageActionInstall is the action of the session event recorded when the
+	// install starts
+	UsageActionInstall = "install"
+)
+
+// UsageEvent is a page visit recorded to the usage metrics file, the file
+// has one json encoded event per line
+type UsageEvent struct {
+	Session  string    `json:"session"`
+	Frontend string    `json:"frontend"`
+	Seq      int       `json:"seq"`
+	Page     string    `json:"page,omitempty"`
+	Start    time.Time `json:"start"`
+	Seconds  float64   `json:"seconds"`
+	Action   string    `json:"action"`
+}
+
+// UsagePageReport aggregates the visits of a page
+type UsagePageReport struct {
+	Page           string  `json:"page"`
+	Visits         int     `json:"visits"`
+	AverageSeconds float64 `json:"averageSeconds"`
+	Canceled       int     `json:"canceled"`
+	Abandoned      int     `json:"abandoned"`
+}
+
+// UsageReport aggregates the sessions recorded to an usage metrics file
+type UsageReport struct {
+	Sessions  int                 `json:"sessions"`
+	Installed int                 `json:"installed"`
+	Pages     []*UsagePageReport  `json:"pages"`
+	Paths     map[string][]string `json:"paths"`
+}
+
+// usageRecorder appends the page visits of the running session to the
+// metrics file, the metrics are opt-in and never leave the local file
+type usageRecorder struct {
+	mutex    sync.Mutex
+	file     string
+	event    *UsageEvent
+	session  string
+	frontend string
+	seq      int
+}
+
+var (
+	usage *usageRecorder
+)
+
+// StartUsage starts recording the page visits to file, the recording is
+// disabled when file is empty
+func StartUsage(file string, frontend string) {
+	if file == "" {
+		return
+	}
+
+	usage = &usageRecorder{
+		file:     file,
+		session:  time.Now().UTC().Format(time.RFC3339Nano),
+		frontend: frontend,
+	}
+}
+
+// UsagePageName returns the name page is recorded as, the name of its type so
+// it's the same regardless of the installer language
+func UsagePageName(page interface{}) string {
+	tp := reflect.TypeOf(page)
+	if tp == nil {
+		return ""
+	}
+
+	if tp.Kind() == reflect.Ptr {
+		tp = tp.Elem()
+	}
+
+	return tp.Name()
+}
+
+// UsageEnter records the visit of page, ending the current visit if any
+func UsageEnter(page interface{}) {
+	if usage == nil {
+		return
+	}
+
+	usage.mutex.Lock()
+	defer usage.mutex.Unlock()
+
+	usage.end(UsageActionLeave)
+	usage.event = usage.newEvent(UsagePageName(page))
+}
+
+// UsageLeave ends the current page visit with action
+func UsageLeave(action string) {
+	if usage == nil {
+		return
+	}
+
+	usage.mutex.Lock()
+	defer usage.mutex.Unlock()
+
+	usage.end(action)
+}
+
+// UsageInstalled records the install start for the running session
+func UsageInstalled() {
+	if usage == nil {
+		return
+	}
+
+	usage.mutex.Lock()
+	defer usage.mutex.Unlock()
+
+	usage.end(UsageActionLeave)
+	usage.event = usage.newEvent("")
+	usage.end(UsageActionInstall)
+}
+
+// StopUsage stops the recording, a visit still open is the page the session
+// was abandoned at
+func StopUsage() {
+	if usage == nil {
+		return
+	}
+
+	usage.mutex.Lock()
+	defer usage.mutex.Unlock()
+
+	usage.end(UsageActionAbandon)
+	usage = nil
+}
+
+func (ur *usageRecorder) newEvent(page string) *UsageEvent {
+	ur.seq++
+
+	return &UsageEvent{
+		Session:  ur.session,
+		Frontend: ur.frontend,
+		Seq:      ur.seq,
+		Page:     page,
+		Start:    time.Now().UTC(),
+	}
+}
+
+func (ur *usageRecorder) end(action string) {
+	if ur.event == nil {
+		return
+	}
+
+	ur.event.Seconds = time.Since(ur.event.Start).Seconds()
+	ur.event.Action = action
+
+	if err := appendUsageEvent(ur.file, ur.event); err != nil {
+		log.Warning("Could not record the usage metrics: %v", err)
+	}
+
+	ur.event = nil
+}
+
+func appendUsageEvent(file string, event *UsageEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return errors.Wrap(err)
+	}
+
+	f, err := os.OpenFile(file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	defer func() { _ = f.Close() }()
+
+	if _, err = f.Write(append(data, '\n')); err != nil {
+		return errors.Wrap(err)
+	}
+
+	return nil
+}
+
+// ReadUsageEvents reads the events recorded to the usage metrics file
+func ReadUsageEvents(file string) ([]*UsageEvent, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	defer func() { _ = f.Close() }()
+
+	events := []*UsageEvent{}
+	scanner := bufio.NewScanner(f)
+
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		event := &UsageEvent{}
+		if err = json.Unmarshal(scanner.Bytes(), event); err != nil {
+			return nil, errors.Errorf("Invalid usage event at %s:%d: %v", file, line, err)
+		}
+
+		events = append(events, event)
+	}
+
+	if err = scanner.Err(); err != nil {
+		return nil, errors.Wrap(err)
+	}
+
+	return events, nil
+}
+
+// NewUsageReport aggregates events per page: the visits, the average time
+// spent and how often the page was canceled or was the last one visited in
+// a session that never started the install. The page visit order of every
+// session is kept in Paths, indexed by the session id.
+func NewUsageReport(events []*UsageEvent) *UsageReport {
+	report := &UsageReport{
+		Pages: []*UsagePageReport{},
+		Paths: map[string][]string{},
+	}
+
+	pages := map[string]*UsagePageReport{}
+	installed := map[string]bool{}
+	last := map[string]*UsageEvent{}
+
+	sorted := append([]*UsageEvent{}, events...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Session != sorted[j].Session {
+			return sorted[i].Session < sorted[j].Session
+		}
+		return sorted[i].Seq < sorted[j].Seq
+	})
+
+	for _, curr := range sorted {
+		if _, ok := report.Paths[curr.Session]; !ok {
+			report.Paths[curr.Session] = []string{}
+		}
+
+		if curr.Action == UsageActionInstall {
+			installed[curr.Session] = true
+			continue
+		}
+
+		pr, ok := pages[curr.Page]
+		if !ok {
+			pr = &UsagePageReport{Page: curr.Page}
+			pages[curr.Page] = pr
+			report.Pages = append(report.Pages, pr)
+		}
+
+		// AverageSeconds holds the total until all the events are counted
+		pr.Visits++
+		pr.AverageSeconds += curr.Seconds
+
+		if curr.Action == UsageActionCancel {
+			pr.Canceled++
+		}
+
+		report.Paths[curr.Session] = append(report.Paths[curr.Session], curr.Page)
+		last[curr.Session] = curr
+	}
+
+	for session, curr := range last {
+		if !installed[session] {
+			pages[curr.Page].Abandoned++
+		}
+	}
+
+	for _, pr := range report.Pages {
+		pr.AverageSeconds = pr.AverageSeconds / float64(pr.Visits)
+	}
+
+	report.Sessions = len(report.Paths)
+	report.Installed = len(installed)
+
+	return report
+}
+
+// ExportUsage returns the usage report of the metrics file as indented json
+func ExportUsage(file string) (string, error) {
+	events, err := ReadUsageEvents(file)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := json.MarshalIndent(NewUsageReport(events), "", "  ")
+	if err != nil {
+		return "", errors.Wrap(err)
+	}
+
+	return string(data), nil
+}
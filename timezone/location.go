@@ -0,0 +1,164 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package timezone
+
+import (
+	"bufio"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/clearlinux/clr-installer/errors"
+)
+
+// Location is the position of a time zone's principal city, in degrees
+type Location struct {
+	Latitude  float64
+	Longitude float64
+}
+
+var (
+	zoneTabFile = "/usr/share/zoneinfo/zone.tab"
+
+	// locations caches the parsed zone.tab, keyed by time zone code
+	locations map[string]*Location
+)
+
+// LoadLocations returns the locations of the time zones listed by the tz
+// database, the zones with no location like UTC are not included
+func LoadLocations() (map[string]*Location, error) {
+	if locations != nil {
+		return locations, nil
+	}
+
+	fh, err := os.Open(zoneTabFile)
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	defer func() { _ = fh.Close() }()
+
+	result := map[string]*Location{}
+
+	scanner := bufio.NewScanner(fh)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		if len(fields) < 3 {
+			continue
+		}
+
+		loc, err := parseCoordinates(fields[1])
+		if err != nil {
+			return nil, err
+		}
+
+		result[fields[2]] = loc
+	}
+
+	if err = scanner.Err(); err != nil {
+		return nil, errors.Wrap(err)
+	}
+
+	locations = result
+	return locations, nil
+}
+
+// Location returns the location of the time zone, nil if it has none
+func (tz *TimeZone) Location() *Location {
+	locs, err := LoadLocations()
+	if err != nil {
+		return nil
+	}
+
+	return locs[tz.Code]
+}
+
+// Nearest returns the zone of zones located the closest to loc, nil if none
+// has a location
+func Nearest(zones []*TimeZone, loc *Location) *TimeZone {
+	var result *TimeZone
+	best := math.MaxFloat64
+
+	for _, curr := range zones {
+		cl := curr.Location()
+		if cl == nil {
+			continue
+		}
+
+		// the map distance is enough to pick a zone, no need for the
+		// great circle one
+		dlon := math.Abs(cl.Longitude - loc.Longitude)
+		if dlon > 180 {
+			dlon = 360 - dlon
+		}
+		dist := math.Pow(cl.Latitude-loc.Latitude, 2) + math.Pow(dlon, 2)
+
+		if dist < best {
+			best = dist
+			result = curr
+		}
+	}
+
+	return result
+}
+
+// parseCoordinates parses the ISO 6709 coordinates of zone.tab, i.e:
+// +4230+00131 or +404251-0740023
+func parseCoordinates(coord string) (*Location, error) {
+	split := strings.IndexAny(coord[1:], "+-") + 1
+	if split <= 0 {
+		return nil, errors.Errorf("Invalid time zone coordinates %q", coord)
+	}
+
+	lat, err := parseDegrees(coord[:split], 2)
+	if err != nil {
+		return nil, err
+	}
+
+	lon, err := parseDegrees(coord[split:], 3)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Location{Latitude: lat, Longitude: lon}, nil
+}
+
+// parseDegrees parses a signed ±DDMM[SS] value, degDigits being the number
+// of digits of the degrees
+func parseDegrees(value string, degDigits int) (float64, error) {
+	digits := value[1:]
+	if len(digits) != degDigits+2 && len(digits) != degDigits+4 {
+		return 0, errors.Errorf("Invalid time zone coordinate %q", value)
+	}
+
+	// degrees, minutes then the optional seconds
+	parts := []string{digits[:degDigits], digits[degDigits : degDigits+2]}
+	if len(digits) > degDigits+2 {
+		parts = append(parts, digits[degDigits+2:])
+	}
+
+	result := 0.0
+	div := 1.0
+	for _, curr := range parts {
+		part, err := strconv.Atoi(curr)
+		if err != nil {
+			return 0, errors.Errorf("Invalid time zone coordinate %q", value)
+		}
+
+		result += float64(part) / div
+		div *= 60
+	}
+
+	if value[0] == '-' {
+		result = -result
+	}
+
+	return result, nil
+}
@@ -8,6 +8,7 @@ import (
 	"bytes"
 	"fmt"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/clearlinux/clr-installer/cmd"
@@ -66,6 +67,23 @@ func (tz *TimeZone) Equals(comp *TimeZone) bool {
 	return tz.Code == comp.Code
 }
 
+// Region returns the region of the time zone, i.e "Europe" for "Europe/Paris",
+// the time zones of a selection list are grouped by it; the zones with no
+// region, like "UTC", are their own region
+func (tz *TimeZone) Region() string {
+	return strings.SplitN(tz.Code, "/", 2)[0]
+}
+
+// less sorts the time zones by region then by code, following the collation
+// order rather than the byte order
+func (tz *TimeZone) less(other *TimeZone) bool {
+	if tz.Region() != other.Region() {
+		return utils.CollateLess(tz.Region(), other.Region())
+	}
+
+	return utils.CollateLess(tz.Code, other.Code)
+}
+
 // Load uses timedatectl to load the currently available timezones
 func Load() ([]*TimeZone, error) {
 	if validTimezones != nil {
@@ -92,6 +110,10 @@ func Load() ([]*TimeZone, error) {
 		validTimezones = append(validTimezones, tz)
 	}
 
+	sort.SliceStable(validTimezones, func(i, j int) bool {
+		return validTimezones[i].less(validTimezones[j])
+	})
+
 	return validTimezones, nil
 }
 
@@ -0,0 +1,191 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package tpm
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/log"
+	"github.com/clearlinux/clr-installer/utils"
+)
+
+const (
+	// MeasurementsFile records the expected measurements of the installed
+	// system, used by the attestation based deployments
+	MeasurementsFile = "/root/clr-installer-measurements.yaml"
+
+	// BootChainDir is the target directory of the EFI boot chain: the boot
+	// loader, the kernels and the unified kernel images
+	BootChainDir = "/boot/EFI"
+)
+
+var (
+	// FirmwarePCRs are the PCRs extended by the firmware alone, the
+	// firmware code, the option ROMs and the secure boot policy, the
+	// installer boot values are the values expected by the installed system
+	FirmwarePCRs = []int{0, 2, 7}
+
+	// sysTPMDir is the sysfs directory of the first TPM
+	sysTPMDir = "/sys/class/tpm/tpm0"
+
+	// eventLogFile is the event log of the firmware measurements
+	eventLogFile = "/sys/kernel/security/tpm0/binary_bios_measurements"
+
+	// tpmDevices are the TPM character devices, the resource manager first
+	tpmDevices = []string{"/dev/tpmrm0", "/dev/tpm0"}
+)
+
+// Measurements are the expected measurements of an installed system, the
+// firmware PCRs of the sha256 bank and the sha256 digests of the boot chain
+// files by target path
+type Measurements struct {
+	TPMVersion string            `yaml:"tpmVersion,omitempty"`
+	PCRs       map[int]string    `yaml:"pcrs,omitempty"`
+	BootChain  map[string]string `yaml:"bootChain"`
+}
+
+// Check verifies the system supports the measured boot: a TPM is present,
+// its device is writable so the PCR policies can be sealed and the firmware
+// published its event log
+func Check() error {
+	if err := CheckDevice(); err != nil {
+		return err
+	}
+
+	if ok, _ := utils.FileExists(eventLogFile); !ok {
+		return errors.Errorf("No TPM event log found, the firmware didn't measure the boot")
+	}
+
+	return nil
+}
+
+// CheckDevice verifies a TPM is present and its device is writable, so keys
+// can be sealed to it
+func CheckDevice() error {
+	if ok, _ := utils.FileExists(sysTPMDir); !ok {
+		return errors.Errorf("No TPM found")
+	}
+
+	if _, err := writableDevice(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// writableDevice returns the first read-write TPM device
+func writableDevice() (string, error) {
+	for _, curr := range tpmDevices {
+		f, err := os.OpenFile(curr, os.O_RDWR, 0)
+		if err != nil {
+			log.Debug("TPM device %s is not usable: %v", curr, err)
+			continue
+		}
+		_ = f.Close()
+
+		return curr, nil
+	}
+
+	return "", errors.Errorf("No writable TPM device, the PCR policies can not be sealed")
+}
+
+// Measure returns the expected measurements of the system installed to
+// rootDir, the PCRs are only read if the kernel publishes them
+func Measure(rootDir string) (*Measurements, error) {
+	result := &Measurements{
+		PCRs:      map[int]string{},
+		BootChain: map[string]string{},
+	}
+
+	if version, err := ioutil.ReadFile(filepath.Join(sysTPMDir, "tpm_version_major")); err == nil {
+		result.TPMVersion = strings.TrimSpace(string(version))
+	}
+
+	for _, curr := range FirmwarePCRs {
+		pcr := filepath.Join(sysTPMDir, "pcr-sha256", fmt.Sprintf("%d", curr))
+
+		value, err := ioutil.ReadFile(pcr)
+		if err != nil {
+			log.Debug("Could not read the PCR %d: %v", curr, err)
+			continue
+		}
+
+		result.PCRs[curr] = strings.ToLower(strings.TrimSpace(string(value)))
+	}
+
+	bootDir := filepath.Join(rootDir, BootChainDir)
+
+	err := filepath.Walk(bootDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		digest, err := fileDigest(path)
+		if err != nil {
+			return err
+		}
+
+		result.BootChain[strings.TrimPrefix(path, rootDir)] = digest
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+
+	if len(result.BootChain) == 0 {
+		return nil, errors.Errorf("No boot chain found in %s", BootChainDir)
+	}
+
+	return result, nil
+}
+
+// fileDigest returns the hex sha256 digest of the file content
+func fileDigest(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = f.Close() }()
+
+	hash := sha256.New()
+	if _, err = io.Copy(hash, f); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
+
+// Write records the measurements to the MeasurementsFile of rootDir
+func (ms *Measurements) Write(rootDir string) error {
+	path := filepath.Join(rootDir, MeasurementsFile)
+
+	if err := utils.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	content, err := yaml.Marshal(ms)
+	if err != nil {
+		return errors.Wrap(err)
+	}
+
+	if err = ioutil.WriteFile(path, content, 0644); err != nil {
+		return errors.Wrap(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,115 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package tpm
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func writeTestFile(t *testing.T, path string, content string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	dir, err := ioutil.TempDir("", "clr-installer-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	saveTPMDir, saveEventLog, saveDevices := sysTPMDir, eventLogFile, tpmDevices
+	defer func() {
+		sysTPMDir, eventLogFile, tpmDevices = saveTPMDir, saveEventLog, saveDevices
+	}()
+
+	sysTPMDir = filepath.Join(dir, "tpm0")
+	eventLogFile = filepath.Join(dir, "binary_bios_measurements")
+	tpmDevices = []string{filepath.Join(dir, "tpmrm0")}
+
+	if err = Check(); err == nil {
+		t.Fatal("Check should fail without a TPM")
+	}
+
+	writeTestFile(t, filepath.Join(sysTPMDir, "tpm_version_major"), "2\n")
+	if err = Check(); err == nil {
+		t.Fatal("Check should fail without a TPM device")
+	}
+
+	writeTestFile(t, tpmDevices[0], "")
+	if err = Check(); err == nil {
+		t.Fatal("Check should fail without an event log")
+	}
+
+	writeTestFile(t, eventLogFile, "")
+	if err = Check(); err != nil {
+		t.Fatalf("Check should pass: %v", err)
+	}
+}
+
+func TestMeasure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "clr-installer-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	saveTPMDir := sysTPMDir
+	defer func() { sysTPMDir = saveTPMDir }()
+
+	sysTPMDir = filepath.Join(dir, "tpm0")
+	rootDir := filepath.Join(dir, "root")
+
+	if _, err = Measure(rootDir); err == nil {
+		t.Fatal("Measure should fail without a boot chain")
+	}
+
+	writeTestFile(t, filepath.Join(sysTPMDir, "tpm_version_major"), "2\n")
+	writeTestFile(t, filepath.Join(sysTPMDir, "pcr-sha256", "7"), "ABCDEF\n")
+	writeTestFile(t, filepath.Join(rootDir, BootChainDir, "BOOT", "BOOTX64.EFI"), "boot")
+
+	ms, err := Measure(rootDir)
+	if err != nil {
+		t.Fatalf("Measure should pass: %v", err)
+	}
+
+	if ms.TPMVersion != "2" || len(ms.PCRs) != 1 || ms.PCRs[7] != "abcdef" {
+		t.Fatalf("Unexpected TPM measurements: %+v", ms)
+	}
+
+	// sha256 of "boot"
+	expected := "4509beb0ab401d71fa4a5cd94a55c9a74f13332776ae4019c5bfc4c2005157ff"
+	if ms.BootChain["/boot/EFI/BOOT/BOOTX64.EFI"] != expected {
+		t.Fatalf("Unexpected boot chain measurements: %+v", ms.BootChain)
+	}
+
+	if err = ms.Write(rootDir); err != nil {
+		t.Fatalf("Write should pass: %v", err)
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(rootDir, MeasurementsFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := &Measurements{}
+	if err = yaml.Unmarshal(content, loaded); err != nil {
+		t.Fatal(err)
+	}
+
+	if loaded.PCRs[7] != "abcdef" || len(loaded.BootChain) != 1 {
+		t.Fatalf("Unexpected recorded measurements: %+v", loaded)
+	}
+}
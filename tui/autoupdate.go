@@ -6,6 +6,8 @@ package tui
 
 import (
 	"github.com/VladimirMarkelov/clui"
+
+	"github.com/clearlinux/clr-installer/model"
 )
 
 // AutoUpdatePage is the Page implementation for the auto update enable configuration page
@@ -35,10 +37,7 @@ To enable post-installation, use:
 
 // GetConfiguredValue Returns the string representation of currently value set
 func (aup *AutoUpdatePage) GetConfiguredValue() string {
-	if aup.getModel().AutoUpdate {
-		return "Enabled"
-	}
-	return "Disabled"
+	return aup.getModel().SummaryValue(model.SummaryAutoUpdate)
 }
 
 func newAutoUpdatePage(tui *Tui) (Page, error) {
@@ -9,12 +9,18 @@ import (
 	"strings"
 
 	"github.com/VladimirMarkelov/clui"
+	"github.com/clearlinux/clr-installer/log"
+	"github.com/clearlinux/clr-installer/storage"
 	"github.com/clearlinux/clr-installer/swupd"
 )
 
 // BundlePage is the Page implementation for the proxy configuration page
 type BundlePage struct {
 	BasePage
+	searchEdit *clui.EditField
+	sizeLabel  *clui.Label
+	checkFrm   *clui.Frame
+	categories map[string]*clui.Label
 }
 
 // BundleCheck maps a map name and description with the actual checkbox
@@ -38,10 +44,18 @@ func (bp *BundlePage) GetConfiguredValue() string {
 	return strings.Join(bundles, ", ")
 }
 
-// Activate marks the checkbox selections based on the data model
+// Activate marks the checkbox selections based on the data model, the
+// catalog is loaded the first time as it may be fetched from the mirror
 func (bp *BundlePage) Activate() {
 	model := bp.getModel()
 
+	if len(bundles) == 0 {
+		if err := bp.loadCatalog(); err != nil {
+			bp.Panic(err)
+			return
+		}
+	}
+
 	for _, curr := range bundles {
 		state := 0
 
@@ -51,40 +65,154 @@ func (bp *BundlePage) Activate() {
 
 		curr.check.SetState(state)
 	}
+
+	bp.searchEdit.SetTitle("")
+	bp.filter()
+	bp.updateSize()
 }
 
-func newBundlePage(tui *Tui) (Page, error) {
-	page := &BundlePage{}
-	page.setupMenu(tui, TuiPageBundle, "Select additional bundles", NoButtons, TuiPageMenu)
+// bundleTitle returns the checkbox title of bundle, its estimated size is
+// shown once known
+func bundleTitle(bundle *swupd.Bundle) string {
+	if bundle.Size == 0 {
+		return fmt.Sprintf("%s: %s", bundle.Name, bundle.Desc)
+	}
+
+	size, _ := storage.HumanReadableSize(bundle.Size)
+	return fmt.Sprintf("%s (%s): %s", bundle.Name, size, bundle.Desc)
+}
+
+// filter shows the bundles matching the search and the categories having
+// any of them
+func (bp *BundlePage) filter() {
+	search := bp.searchEdit.Title()
+	shown := map[string]bool{}
+
+	for _, curr := range bundles {
+		visible := curr.bundle.Matches(search)
+		curr.check.SetVisible(visible)
+
+		if visible {
+			shown[curr.bundle.Category] = true
+		}
+	}
+
+	for category, lbl := range bp.categories {
+		lbl.SetVisible(shown[category])
+	}
+
+	bp.window.ResizeChildren()
+	bp.window.PlaceChildren()
+	clui.RefreshScreen()
+}
+
+// updateSize shows the estimated download size of the selected bundles
+func (bp *BundlePage) updateSize() {
+	total := uint64(0)
+	unknown := false
+
+	for _, curr := range bundles {
+		if curr.check.State() != 1 {
+			continue
+		}
+
+		if curr.bundle.Size == 0 {
+			unknown = true
+		}
+		total += curr.bundle.Size
+	}
 
-	bdls, err := swupd.LoadBundleList(page.getModel())
+	size, _ := storage.HumanReadableSize(total)
+	msg := fmt.Sprintf("Estimated download size: %s", size)
+	if unknown {
+		msg = msg + " (some sizes unknown)"
+	}
+
+	bp.sizeLabel.SetTitle(msg)
+}
+
+// fetchSize reads the size of a selected bundle from its manifest, it may
+// take a while so the page is updated when it's done
+func (bp *BundlePage) fetchSize(curr *BundleCheck) {
+	if curr.bundle.Size > 0 {
+		bp.updateSize()
+		return
+	}
+
+	go func() {
+		if err := swupd.FetchBundleSize(bp.getModel(), curr.bundle); err != nil {
+			log.Warning("Could not fetch the %s bundle size: %v", curr.bundle.Name, err)
+			return
+		}
+
+		curr.check.SetTitle(bundleTitle(curr.bundle))
+		bp.updateSize()
+		clui.RefreshScreen()
+	}()
+}
+
+// loadCatalog creates the checkboxes of the bundle catalog, grouped by
+// category
+func (bp *BundlePage) loadCatalog() error {
+	bdls, err := swupd.LoadBundleCatalog(bp.getModel())
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	for _, curr := range bdls {
-		bundles = append(bundles, &BundleCheck{curr, nil})
+		if bp.categories[curr.Category] == nil {
+			title := fmt.Sprintf("[%s]", curr.Category)
+			bp.categories[curr.Category] = clui.CreateLabel(bp.checkFrm, AutoSize, 1, title, Fixed)
+		}
+
+		bundle := &BundleCheck{curr, nil}
+		bundle.check = clui.CreateCheckBox(bp.checkFrm, AutoSize, bundleTitle(curr), AutoSize)
+		bundle.check.SetPack(clui.Horizontal)
+		bundle.check.OnChange(func(state int) {
+			if state == 1 {
+				bp.fetchSize(bundle)
+				return
+			}
+
+			bp.updateSize()
+		})
+
+		bundles = append(bundles, bundle)
 	}
 
+	return nil
+}
+
+func newBundlePage(tui *Tui) (Page, error) {
+	page := &BundlePage{categories: map[string]*clui.Label{}}
+	page.setupMenu(tui, TuiPageBundle, "Select additional bundles", NoButtons, TuiPageMenu)
+
 	clui.CreateLabel(page.content, 2, 2, "Select additional bundles", Fixed)
 
-	frm := clui.CreateFrame(page.content, AutoSize, 14, BorderNone, Fixed)
+	searchFrm := clui.CreateFrame(page.content, AutoSize, AutoSize, BorderNone, Fixed)
+	searchFrm.SetPack(clui.Horizontal)
+	searchFrm.SetPaddings(2, 0)
+
+	clui.CreateLabel(searchFrm, AutoSize, 1, "Search:", Fixed)
+	page.searchEdit = clui.CreateEditField(searchFrm, 40, "", Fixed)
+	page.searchEdit.OnChange(func(ev clui.Event) {
+		page.filter()
+	})
+
+	frm := clui.CreateFrame(page.content, AutoSize, 12, BorderNone, Fixed)
 	frm.SetPack(clui.Vertical)
 	frm.SetScrollable(true)
 
-	lblFrm := clui.CreateFrame(frm, AutoSize, AutoSize, BorderNone, Fixed)
-	lblFrm.SetPack(clui.Vertical)
-	lblFrm.SetPaddings(2, 0)
-
-	for _, curr := range bundles {
-		lbl := fmt.Sprintf("%s: %s", curr.bundle.Name, curr.bundle.Desc)
-		curr.check = clui.CreateCheckBox(lblFrm, AutoSize, lbl, AutoSize)
-		curr.check.SetPack(clui.Horizontal)
-	}
+	page.checkFrm = clui.CreateFrame(frm, AutoSize, AutoSize, BorderNone, Fixed)
+	page.checkFrm.SetPack(clui.Vertical)
+	page.checkFrm.SetPaddings(2, 0)
 
 	fldFrm := clui.CreateFrame(frm, 30, AutoSize, BorderNone, Fixed)
 	fldFrm.SetPack(clui.Vertical)
 
+	page.sizeLabel = clui.CreateLabel(page.content, AutoSize, 1, "", Fixed)
+	page.sizeLabel.SetPaddings(2, 0)
+
 	cancelBtn := CreateSimpleButton(page.cFrame, AutoSize, AutoSize, "Cancel", Fixed)
 	cancelBtn.OnClick(func(ev clui.Event) {
 		page.GotoPage(TuiPageMenu)
@@ -8,6 +8,8 @@ import (
 	"fmt"
 
 	"github.com/clearlinux/clr-installer/model"
+	"github.com/clearlinux/clr-installer/sanitize"
+	"github.com/clearlinux/clr-installer/telemetry"
 
 	"github.com/VladimirMarkelov/clui"
 	term "github.com/nsf/termbox-go"
@@ -145,6 +147,18 @@ const (
 	// TuiPageKernel is the id for the kernel selection page
 	TuiPageKernel
 
+	// TuiPageKernelModules is the id for the kernel modules page
+	TuiPageKernelModules
+
+	// TuiPageSysctl is the id for the sysctl tuning profile page
+	TuiPageSysctl
+
+	// TuiPageHPC is the id for the HPC kernel arguments page
+	TuiPageHPC
+
+	// TuiPageDiagnostics is the id for the diagnostics page
+	TuiPageDiagnostics
+
 	// TuiPageSwupdMirror is the id for the swupd mirror page
 	TuiPageSwupdMirror
 
@@ -157,6 +171,10 @@ const (
 	// TuiPageSaveConfig is the id for the save YAML configuration file page
 	TuiPageSaveConfig
 
+	// TuiPageFeatures is the id for the first generated feature page, the
+	// others follow in the model features order
+	TuiPageFeatures
+
 	// ConfigDefinedByUser is used to determine a configuration was interactively
 	// defined by the user
 	ConfigDefinedByUser = iota
@@ -369,6 +387,7 @@ func (page *BasePage) setup(tui *Tui, id int, btns int, returnID int) {
 				page.cancelBtn.ProcessEvent(clui.Event{Type: clui.EventKey, Key: term.KeyEnter})
 			} else {
 				page.action = ActionCancelButton
+				telemetry.UsageLeave(telemetry.UsageActionCancel)
 				page.GotoPage(returnID)
 				page.action = ActionNone
 				return true
@@ -399,6 +418,8 @@ func (page *BasePage) newWindow() {
 	page.window.SetMovable(false)
 
 	page.window.OnScreenResize(func(evt clui.Event) {
+		runLoopCalls()
+
 		ww, wh := page.window.Size()
 
 		x := (evt.Width - ww) / 2
@@ -427,6 +448,7 @@ func (page *BasePage) newCancelButton(pageID int) {
 
 	btn.OnClick(func(ev clui.Event) {
 		page.action = ActionCancelButton
+		telemetry.UsageLeave(telemetry.UsageActionCancel)
 		page.GotoPage(pageID)
 		page.action = ActionNone
 	})
@@ -440,6 +462,7 @@ func (page *BasePage) newConfirmButton(tui *Tui, pageID int) {
 	btn.OnClick(func(ev clui.Event) {
 		if tui.currPage.SetDone(true) {
 			page.action = ActionConfirmButton
+			telemetry.UsageLeave(telemetry.UsageActionConfirm)
 			page.GotoPage(pageID)
 			page.action = ActionNone
 		}
@@ -470,9 +493,18 @@ func newEditField(frame *clui.Frame, validation bool, cb func(k term.Key, ch run
 		label.SetTextColor(errorLabelFg)
 	}
 
-	if cb != nil {
-		edit.OnKeyPress(cb)
-	}
+	edit.OnKeyPress(func(k term.Key, ch rune) bool {
+		// Swallow the control and invisible characters, i.e: pasted ones
+		if ch != 0 && !sanitize.IsAllowed(ch) {
+			return true
+		}
+
+		if cb != nil {
+			return cb(k, ch)
+		}
+
+		return false
+	})
 
 	return edit, label
 }
@@ -9,6 +9,8 @@ import (
 
 	"github.com/VladimirMarkelov/clui"
 	term "github.com/nsf/termbox-go"
+
+	"github.com/clearlinux/clr-installer/remote"
 )
 
 // ConfirmCancelDialog is dialog window use to stop all other
@@ -18,6 +20,7 @@ type ConfirmCancelDialog struct {
 	DialogBox *clui.Window
 	Confirmed bool
 	onClose   func()
+	onAnswer  func()
 
 	message       string
 	warningLabel  *clui.Label
@@ -35,6 +38,7 @@ func (dialog *ConfirmCancelDialog) OnClose(fn func()) {
 
 // Close closes the dialog window and executes a callback if registered
 func (dialog *ConfirmCancelDialog) Close() {
+	dialog.onAnswer()
 	clui.WindowManager().DestroyWindow(dialog.DialogBox)
 	clui.WindowManager().BeginUpdate()
 	closeFn := dialog.onClose
@@ -129,6 +133,10 @@ func CreateConfirmCancelDialogBox(message string) (*ConfirmCancelDialog, error)
 		dialog.Close()
 	})
 
+	dialog.onAnswer = remote.Prompt(dialog.message, []string{"No", "Yes"}, func(choice int) {
+		answerRemotePrompt(choice, dialog.cancelButton, dialog.confirmButton)
+	})
+
 	clui.ActivateControl(dialog.DialogBox, dialog.cancelButton)
 	clui.RefreshScreen()
 
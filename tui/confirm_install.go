@@ -11,10 +11,20 @@ import (
 	"github.com/VladimirMarkelov/clui"
 	term "github.com/nsf/termbox-go"
 
+	"github.com/clearlinux/clr-installer/controller"
+	"github.com/clearlinux/clr-installer/log"
 	"github.com/clearlinux/clr-installer/model"
+	"github.com/clearlinux/clr-installer/power"
+	"github.com/clearlinux/clr-installer/remote"
 	"github.com/clearlinux/clr-installer/storage"
+	"github.com/clearlinux/clr-installer/swupd"
+	"github.com/clearlinux/clr-installer/syscheck"
 )
 
+// maxReviewChanges is the number of the changes from the defaults listed by
+// the confirmation dialog, the others are counted only
+const maxReviewChanges = 5
+
 // ConfirmInstallDialog is dialog window use to stop all other
 // user interaction and have the them confirm the destruction
 // of the target media and start the install. Last change to abort.
@@ -22,10 +32,19 @@ type ConfirmInstallDialog struct {
 	DialogBox *clui.Window
 	Confirmed bool
 	onClose   func()
+	onAnswer  func()
 
 	modelSI       *model.SystemInstall
 	warningLabel  *clui.Label
 	mediaLabel    *clui.Label
+	batteryLabel  *clui.Label
+	raidLabel     *clui.Label
+	firmwareLabel *clui.Label
+	consoleLabel  *clui.Label
+	sizeLabel     *clui.Label
+	stepsLabel    *clui.Label
+	changesLabel  *clui.Label
+	sizeProblem   *swupd.ContentSizeProblem
 	cancelButton  *SimpleButton
 	confirmButton *SimpleButton
 }
@@ -40,6 +59,7 @@ func (dialog *ConfirmInstallDialog) OnClose(fn func()) {
 
 // Close closes the dialog window and executes a callback if registered
 func (dialog *ConfirmInstallDialog) Close() {
+	dialog.onAnswer()
 	clui.WindowManager().DestroyWindow(dialog.DialogBox)
 	clui.WindowManager().BeginUpdate()
 	closeFn := dialog.onClose
@@ -55,7 +75,49 @@ func initConfirmDiaglogWindow(dialog *ConfirmInstallDialog) error {
 	const wBuff = 5
 	const hBuff = 5
 	const dWidth = 50
-	const dHeight = 8
+	dHeight := 8
+
+	battery := power.BatteryWarning()
+	if battery != "" {
+		dHeight += 2
+	}
+
+	firmware := syscheck.FirmwareBundlesMessage(controller.FirmwareBundles(dialog.modelSI))
+	if firmware != "" {
+		dHeight += 2
+	}
+
+	console := syscheck.SerialConsoleMessage(controller.SerialConsole(dialog.modelSI))
+	if console != "" {
+		dHeight += 2
+	}
+
+	raid := storage.HWRAIDWarnings(dialog.modelSI.TargetMedias)
+	dHeight += 2 * len(raid)
+
+	if bundles, err := swupd.LoadBundleList(dialog.modelSI); err == nil {
+		dialog.sizeProblem = swupd.CheckContentSize(dialog.modelSI, bundles)
+	}
+
+	if dialog.sizeProblem != nil {
+		dHeight += 4
+	}
+
+	// the text equivalent of the GUI destructive install storyboard
+	steps := []string{}
+	if dialog.modelSI.InstallSelected.EraseDisk {
+		steps = storyboardText(storage.DestructiveSteps(dialog.modelSI.TargetMedias))
+	}
+	stepsHeight := storyboardHeight(steps, dWidth-4)
+	if stepsHeight > 0 {
+		dHeight += stepsHeight + 1
+	}
+
+	changes := changesText(dialog.modelSI, maxReviewChanges, dWidth-4)
+	changesHeight := storyboardHeight(changes, dWidth-4)
+	if changesHeight > 0 {
+		dHeight += changesHeight + 1
+	}
 
 	sw, sh := clui.ScreenSize()
 
@@ -116,6 +178,44 @@ func initConfirmDiaglogWindow(dialog *ConfirmInstallDialog) error {
 		dialog.mediaLabel.SetBackColor(term.ColorRed)
 	}
 
+	if stepsHeight > 0 {
+		dialog.stepsLabel = clui.CreateLabel(borderFrame, 1, stepsHeight, strings.Join(steps, "\n"), 1)
+		dialog.stepsLabel.SetMultiline(true)
+	}
+
+	if changesHeight > 0 {
+		dialog.changesLabel = clui.CreateLabel(borderFrame, 1, changesHeight, strings.Join(changes, "\n"), 1)
+		dialog.changesLabel.SetMultiline(true)
+	}
+
+	if firmware != "" {
+		dialog.firmwareLabel = clui.CreateLabel(borderFrame, 1, 2, firmware, 1)
+		dialog.firmwareLabel.SetMultiline(true)
+	}
+
+	if console != "" {
+		dialog.consoleLabel = clui.CreateLabel(borderFrame, 1, 2, console, 1)
+		dialog.consoleLabel.SetMultiline(true)
+	}
+
+	if battery != "" {
+		dialog.batteryLabel = clui.CreateLabel(borderFrame, 1, 2, battery, 1)
+		dialog.batteryLabel.SetMultiline(true)
+		dialog.batteryLabel.SetBackColor(term.ColorRed)
+	}
+
+	if len(raid) > 0 {
+		dialog.raidLabel = clui.CreateLabel(borderFrame, 1, 2*len(raid), strings.Join(raid, "\n"), 1)
+		dialog.raidLabel.SetMultiline(true)
+		dialog.raidLabel.SetBackColor(term.ColorRed)
+	}
+
+	if dialog.sizeProblem != nil {
+		dialog.sizeLabel = clui.CreateLabel(borderFrame, 1, 3, dialog.sizeProblem.Message(), 1)
+		dialog.sizeLabel.SetMultiline(true)
+		dialog.sizeLabel.SetBackColor(term.ColorRed)
+	}
+
 	buttonFrame := clui.CreateFrame(borderFrame, AutoSize, 1, clui.BorderNone, clui.Fixed)
 	buttonFrame.SetPack(clui.Horizontal)
 	buttonFrame.SetGaps(1, 0)
@@ -123,13 +223,59 @@ func initConfirmDiaglogWindow(dialog *ConfirmInstallDialog) error {
 	dialog.cancelButton.SetEnabled(true)
 	dialog.cancelButton.SetActive(true)
 
-	dialog.confirmButton = CreateSimpleButton(buttonFrame, AutoSize, AutoSize, "Confirm Install", Fixed)
-	dialog.confirmButton.SetEnabled(true)
+	confirmTitle := "Confirm Install"
+	if dialog.sizeProblem != nil {
+		confirmTitle = "Drop Bundles and Install"
+	}
+
+	dialog.confirmButton = CreateSimpleButton(buttonFrame, AutoSize, AutoSize, confirmTitle, Fixed)
+	dialog.confirmButton.SetEnabled(dialog.sizeProblem == nil || dialog.sizeProblem.Resolved)
 	dialog.confirmButton.SetActive(false)
 
 	return nil
 }
 
+// storyboardText numbers the storyboard steps, the first line introduces them
+func storyboardText(steps []string) []string {
+	if len(steps) == 0 {
+		return steps
+	}
+
+	result := []string{"What will happen:"}
+	for idx, curr := range steps {
+		result = append(result, fmt.Sprintf("%d. %s", idx+1, curr))
+	}
+
+	return result
+}
+
+// changesText lists the first max changes of md from the defaults, cut to
+// width, the first line introduces them
+func changesText(md *model.SystemInstall, max int, width int) []string {
+	changes, err := model.ReviewChanges(md, max, width)
+	if err != nil {
+		log.Warning("Could not compare the configuration with the defaults: %v", err)
+		return nil
+	}
+
+	if len(changes) == 0 {
+		return changes
+	}
+
+	return append([]string{"Changes from the defaults:"}, changes...)
+}
+
+// storyboardHeight returns the lines needed by the lines wrapped to width
+func storyboardHeight(lines []string, width int) int {
+	height := 0
+
+	for _, curr := range lines {
+		height += len(curr)/width + 1
+	}
+
+	return height
+}
+
 // CreateConfirmInstallDialogBox creates the Network PopUp
 func CreateConfirmInstallDialogBox(modelSI *model.SystemInstall) (*ConfirmInstallDialog, error) {
 	dialog := new(ConfirmInstallDialog)
@@ -153,10 +299,19 @@ func CreateConfirmInstallDialogBox(modelSI *model.SystemInstall) (*ConfirmInstal
 	})
 
 	dialog.confirmButton.OnClick(func(ev clui.Event) {
+		if dialog.sizeProblem != nil {
+			dialog.sizeProblem.DropBundles(dialog.modelSI)
+		}
+
 		dialog.Confirmed = true
 		dialog.Close()
 	})
 
+	dialog.onAnswer = remote.Prompt(storage.ConfirmInstallation,
+		[]string{dialog.cancelButton.Title(), dialog.confirmButton.Title()}, func(choice int) {
+			answerRemotePrompt(choice, dialog.cancelButton, dialog.confirmButton)
+		})
+
 	clui.ActivateControl(dialog.DialogBox, dialog.cancelButton)
 	clui.RefreshScreen()
 
@@ -0,0 +1,161 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package tui
+
+import (
+	"strings"
+
+	"github.com/VladimirMarkelov/clui"
+
+	"github.com/clearlinux/clr-installer/model"
+)
+
+// DiagnosticsPage is the Page implementation for the diagnostics page
+type DiagnosticsPage struct {
+	BasePage
+	journalCheck  *clui.CheckBox
+	coreDumpCheck *clui.CheckBox
+	kdumpCheck    *clui.CheckBox
+	crashEdit     *clui.EditField
+	warningLabel  *clui.Label
+}
+
+const (
+	diagnosticsHelp = `Note: The crash kernel memory is only reserved if kdump is enabled,
+      leave it empty to size it with the installed memory.`
+)
+
+// GetConfiguredValue Returns the string representation of currently value set
+func (page *DiagnosticsPage) GetConfiguredValue() string {
+	dg := page.getModel().Diagnostics
+
+	if dg == nil || dg.IsEmpty() {
+		return "No diagnostics enabled"
+	}
+
+	values := []string{}
+
+	if dg.PersistentJournal {
+		values = append(values, "Persistent journal")
+	}
+
+	if dg.CoreDumps {
+		values = append(values, "Core dumps")
+	}
+
+	if dg.Kdump {
+		values = append(values, "Kdump")
+	}
+
+	return strings.Join(values, ", ")
+}
+
+// Activate sets the checkboxes with the current model's value
+func (page *DiagnosticsPage) Activate() {
+	page.warningLabel.SetTitle("")
+
+	dg := page.getModel().Diagnostics
+	if dg == nil {
+		dg = &model.Diagnostics{}
+	}
+
+	page.setChecks(dg)
+	page.crashEdit.SetTitle(dg.CrashKernel)
+}
+
+func (page *DiagnosticsPage) setChecks(dg *model.Diagnostics) {
+	for check, enabled := range map[*clui.CheckBox]bool{
+		page.journalCheck:  dg.PersistentJournal,
+		page.coreDumpCheck: dg.CoreDumps,
+		page.kdumpCheck:    dg.Kdump,
+	} {
+		state := 0
+		if enabled {
+			state = 1
+		}
+		check.SetState(state)
+	}
+}
+
+func newDiagnosticsPage(tui *Tui) (Page, error) {
+	page := &DiagnosticsPage{}
+	page.setupMenu(tui, TuiPageDiagnostics, "Diagnostics", NoButtons, TuiPageMenu)
+
+	clui.CreateLabel(page.content, 2, 2, "Keep the Logs and Crash Dumps of the Target System", Fixed)
+
+	helpLabel := clui.CreateLabel(page.content, 2, 3, diagnosticsHelp, Fixed)
+	helpLabel.SetMultiline(true)
+
+	frm := clui.CreateFrame(page.content, AutoSize, AutoSize, BorderNone, Fixed)
+	frm.SetPack(clui.Horizontal)
+
+	lblFrm := clui.CreateFrame(frm, 20, AutoSize, BorderNone, Fixed)
+	lblFrm.SetPack(clui.Vertical)
+	lblFrm.SetPaddings(1, 0)
+
+	newFieldLabel(lblFrm, "Crash Kernel:")
+
+	fldFrm := clui.CreateFrame(frm, 30, AutoSize, BorderNone, Fixed)
+	fldFrm.SetPack(clui.Vertical)
+
+	iframe := clui.CreateFrame(fldFrm, 5, 2, BorderNone, Fixed)
+	iframe.SetPack(clui.Vertical)
+
+	page.crashEdit = clui.CreateEditField(iframe, 1, "", Fixed)
+
+	page.journalCheck = clui.CreateCheckBox(fldFrm, AutoSize, "Persistent journal", AutoSize)
+	page.coreDumpCheck = clui.CreateCheckBox(fldFrm, AutoSize, "Store core dumps", AutoSize)
+	page.kdumpCheck = clui.CreateCheckBox(fldFrm, AutoSize, "Kdump", AutoSize)
+
+	page.warningLabel = clui.CreateLabel(page.content, AutoSize, 1, "", Fixed)
+	page.warningLabel.SetMultiline(true)
+	page.warningLabel.SetBackColor(errorLabelBg)
+	page.warningLabel.SetTextColor(errorLabelFg)
+
+	btnFrm := clui.CreateFrame(fldFrm, 30, 1, BorderNone, Fixed)
+	btnFrm.SetPack(clui.Horizontal)
+	btnFrm.SetGaps(1, 1)
+	btnFrm.SetPaddings(2, 0)
+
+	cancelBtn := CreateSimpleButton(btnFrm, AutoSize, AutoSize, "Cancel", Fixed)
+	cancelBtn.OnClick(func(ev clui.Event) {
+		page.GotoPage(TuiPageMenu)
+	})
+
+	rescueBtn := CreateSimpleButton(btnFrm, AutoSize, AutoSize, "Rescue Friendly", Fixed)
+	rescueBtn.OnClick(func(ev clui.Event) {
+		dg := &model.Diagnostics{}
+		dg.EnableAll()
+		page.setChecks(dg)
+	})
+
+	confirmBtn := CreateSimpleButton(btnFrm, AutoSize, AutoSize, "Confirm", Fixed)
+	confirmBtn.OnClick(func(ev clui.Event) {
+		dg := &model.Diagnostics{
+			PersistentJournal: page.journalCheck.State() == 1,
+			CoreDumps:         page.coreDumpCheck.State() == 1,
+			Kdump:             page.kdumpCheck.State() == 1,
+			CrashKernel:       strings.TrimSpace(page.crashEdit.Title()),
+		}
+
+		if err := dg.Validate(); err != nil {
+			page.warningLabel.SetTitle(err.Error())
+			return
+		}
+
+		if dg.IsEmpty() {
+			dg = nil
+		}
+
+		page.getModel().Diagnostics = dg
+		page.SetDone(dg != nil)
+
+		page.GotoPage(TuiPageMenu)
+	})
+
+	page.activated = page.journalCheck
+
+	return page, nil
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/VladimirMarkelov/clui"
 	term "github.com/nsf/termbox-go"
 
+	"github.com/clearlinux/clr-installer/controller"
 	"github.com/clearlinux/clr-installer/log"
 	"github.com/clearlinux/clr-installer/storage"
 )
@@ -182,7 +183,7 @@ func (page *DiskConfigPage) SetDone(done bool) bool {
 		page.getModel().AddTargetMedia(installBlockDevice)
 
 		page.getModel().InstallSelected = storage.InstallTarget{
-			Name: installBlockDevice.Name, Friendly: installBlockDevice.Model,
+			Name: installBlockDevice.Name, Friendly: installBlockDevice.FriendlyModel(),
 			WholeDisk: sel.wholeDisk, Removable: installBlockDevice.RemovableDevice,
 			DataLoss: sel.dataLoss, Advanced: true, FreeStart: 0, FreeEnd: installBlockDevice.Size}
 	}
@@ -364,7 +365,7 @@ func newDiskConfigPage(tui *Tui) (Page, error) {
 	page.scrollingFrame.SetPaddings(1, 0)
 
 	var err error
-	page.blockDevices, err = storage.ListAvailableBlockDevices(page.getModel().TargetMedias)
+	page.blockDevices, err = controller.ScanMedia(page.getModel().TargetMedias)
 	if err != nil {
 		page.Panic(err)
 	}
@@ -373,7 +374,7 @@ func newDiskConfigPage(tui *Tui) (Page, error) {
 	revertBtn := CreateSimpleButton(page.cFrame, AutoSize, AutoSize, "Revert", Fixed)
 	revertBtn.OnClick(func(ev clui.Event) {
 		var err error
-		page.blockDevices, err = storage.RescanBlockDevices(nil)
+		page.blockDevices, err = controller.RescanMedia(nil)
 		if err != nil {
 			page.Panic(err)
 		}
@@ -393,7 +394,7 @@ func newDiskConfigPage(tui *Tui) (Page, error) {
 	rescanBtn := CreateSimpleButton(page.cFrame, AutoSize, AutoSize, "Rescan Media", Fixed)
 	rescanBtn.OnClick(func(ev clui.Event) {
 		var err error
-		page.blockDevices, err = storage.RescanBlockDevices(page.getModel().TargetMedias)
+		page.blockDevices, err = controller.RescanMedia(page.getModel().TargetMedias)
 		if err != nil {
 			page.Panic(err)
 		}
@@ -480,7 +481,7 @@ func (page *DiskConfigPage) addDiskRow(bd *storage.BlockDevice) error {
 	rowFrame.SetPack(clui.Vertical)
 
 	diskTitle := fmt.Sprintf(page.columnFormat,
-		strings.TrimSpace(bd.Model), bd.GetDeviceFile(),
+		bd.FriendlyModel(), bd.GetDeviceFile(),
 		"", "", size)
 
 	diskButton := CreateSimpleButton(rowFrame, 1, 1, diskTitle, Fixed)
@@ -18,12 +18,14 @@ import (
 // DiskPartitionPage is the Page implementation for partition configuration page
 type DiskPartitionPage struct {
 	BasePage
-	fsList        *clui.ListBox
+	fsList        *ScrollListBox
 	fsOriginal    string
 	encryptCheck  *clui.CheckBox
 	formatCheck   *clui.CheckBox
 	labelEdit     *clui.EditField
 	labelWarning  *clui.Label
+	uuidEdit      *clui.EditField
+	uuidWarning   *clui.Label
 	mPointEdit    *clui.EditField
 	mPointWarning *clui.Label
 	sizeEdit      *clui.EditField
@@ -83,6 +85,9 @@ func (page *DiskPartitionPage) setPartitionForm(part *storage.BlockDevice) {
 	page.labelEdit.SetTitle(part.Label)
 	page.validateLabel(part.FsType)
 
+	page.uuidEdit.SetTitle(part.NewUUID)
+	page.validateUUID(part.FsType)
+
 	page.mPointEdit.SetEnabled(true)
 	if part.FsType == "swap" {
 		page.mPointEdit.SetEnabled(false)
@@ -159,6 +164,8 @@ func (page *DiskPartitionPage) Activate() {
 
 	page.labelEdit.SetTitle("")
 	page.labelWarning.SetTitle("")
+	page.uuidEdit.SetTitle("")
+	page.uuidWarning.SetTitle("")
 	page.mPointEdit.SetTitle("")
 	page.mPointWarning.SetTitle("")
 	page.sizeEdit.SetTitle("")
@@ -183,6 +190,7 @@ func (page *DiskPartitionPage) Activate() {
 
 func (page *DiskPartitionPage) setConfirmButton() {
 	if page.labelWarning.Title() == "" &&
+		page.uuidWarning.Title() == "" &&
 		page.mPointWarning.Title() == "" &&
 		page.sizeWarning.Title() == "" {
 		page.confirmBtn.SetEnabled(true)
@@ -198,6 +206,13 @@ func (page *DiskPartitionPage) validateLabel(fstype string) {
 	page.setConfirmButton()
 }
 
+func (page *DiskPartitionPage) validateUUID(fstype string) {
+	page.uuidWarning.SetTitle(
+		storage.IsValidUUID(page.uuidEdit.Title(), fstype))
+
+	page.setConfirmButton()
+}
+
 func (page *DiskPartitionPage) validateMountPoint() {
 	page.mPointWarning.SetTitle(storage.IsValidMount(page.mPointEdit.Title()))
 
@@ -227,6 +242,9 @@ func newDiskPartitionPage(tui *Tui) (Page, error) {
 	lbl = clui.CreateLabel(lblFrm, AutoSize, 2, "[Optional] Label:", Fixed)
 	lbl.SetAlign(AlignRight)
 
+	lbl = clui.CreateLabel(lblFrm, AutoSize, 2, "[Optional] UUID:", Fixed)
+	lbl.SetAlign(AlignRight)
+
 	lbl = clui.CreateLabel(lblFrm, AutoSize, 2, "Mount Point:", Fixed)
 	lbl.SetAlign(AlignRight)
 
@@ -246,7 +264,7 @@ func newDiskPartitionPage(tui *Tui) (Page, error) {
 	partFrm.SetPaddings(0, 0)
 	partFrm.SetGaps(2, 1)
 
-	page.fsList = clui.CreateListBox(partFrm, 20, 3, Fixed)
+	page.fsList = CreateScrollListBox(partFrm, 20, 3, Fixed)
 	page.fsList.SetAlign(AlignLeft)
 	page.fsList.SetStyle("List")
 
@@ -294,6 +312,20 @@ func newDiskPartitionPage(tui *Tui) (Page, error) {
 	page.labelWarning.SetBackColor(errorLabelBg)
 	page.labelWarning.SetTextColor(errorLabelFg)
 
+	uuidFrm := clui.CreateFrame(fldFrm, 4, 2, BorderNone, Fixed)
+	uuidFrm.SetPack(clui.Vertical)
+	uuidFrm.SetPaddings(0, 0)
+
+	page.uuidEdit = clui.CreateEditField(uuidFrm, 3, "", Fixed)
+	page.uuidEdit.OnChange(func(ev clui.Event) {
+		page.validateUUID(page.fsList.SelectedItemText())
+	})
+
+	page.uuidWarning = clui.CreateLabel(uuidFrm, 1, 1, "", Fixed)
+	page.uuidWarning.SetMultiline(true)
+	page.uuidWarning.SetBackColor(errorLabelBg)
+	page.uuidWarning.SetTextColor(errorLabelFg)
+
 	mPointFrm := clui.CreateFrame(fldFrm, 4, 2, BorderNone, Fixed)
 	mPointFrm.SetPack(clui.Vertical)
 	mPointFrm.SetPaddings(0, 0)
@@ -329,6 +361,7 @@ func newDiskPartitionPage(tui *Tui) (Page, error) {
 		page.setFormatCheckbox()
 
 		page.validateLabel(page.fsList.SelectedItemText())
+		page.validateUUID(page.fsList.SelectedItemText())
 	})
 
 	sizeFrm := clui.CreateFrame(fldFrm, 5, 3, BorderNone, Fixed)
@@ -394,6 +427,7 @@ func newDiskPartitionPage(tui *Tui) (Page, error) {
 				sel.part.FormatPartition = false
 			}
 			sel.part.Label = page.labelEdit.Title()
+			sel.part.NewUUID = page.uuidEdit.Title()
 			sel.part.MountPoint = page.mPointEdit.Title()
 			sizeChanged := false
 			if page.sizeEdit.Title() == page.sizeOriginal {
@@ -0,0 +1,226 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/VladimirMarkelov/clui"
+	term "github.com/nsf/termbox-go"
+
+	"github.com/clearlinux/clr-installer/model"
+	"github.com/clearlinux/clr-installer/utils"
+)
+
+// FeaturePage is the Page implementation generated from a model feature
+// descriptor, for the features with no dedicated page
+type FeaturePage struct {
+	BasePage
+	feature      *model.Feature
+	edits        []*clui.EditField
+	checks       []*clui.CheckBox
+	choices      [][]string
+	warningLabel *clui.Label
+}
+
+// featurePages are the features with a dedicated TUI page
+var featurePages = []string{model.FeatureKernelArguments, model.FeatureDiagnostics}
+
+// newFeaturePages returns a generated page for every model feature with no
+// dedicated page
+func newFeaturePages(tui *Tui) []Page {
+	result := []Page{}
+
+	for i, curr := range model.Features {
+		if utils.StringSliceContains(featurePages, curr.ID) {
+			continue
+		}
+
+		result = append(result, newFeaturePage(tui, curr, TuiPageFeatures+i))
+	}
+
+	return result
+}
+
+// GetConfiguredValue Returns the string representation of currently value set
+func (page *FeaturePage) GetConfiguredValue() string {
+	if value := page.feature.Summary(page.getModel()); value != "" {
+		return value
+	}
+
+	return "Not configured"
+}
+
+// GetConfigDefinition returns if the config was interactively defined by the user,
+// was loaded from a config file or if the config is not set.
+func (page *FeaturePage) GetConfigDefinition() int {
+	if !page.feature.IsConfigured(page.getModel()) {
+		return ConfigNotDefined
+	} else if page.GetDone() {
+		return ConfigDefinedByUser
+	}
+
+	return ConfigDefinedByConfig
+}
+
+// Activate sets the fields with the current model's values
+func (page *FeaturePage) Activate() {
+	page.warningLabel.SetTitle("")
+
+	for i, value := range page.feature.Values(page.getModel()) {
+		if page.checks[i] != nil {
+			state := 0
+			if value == model.FieldTrue {
+				state = 1
+			}
+			page.checks[i].SetState(state)
+		} else {
+			page.edits[i].SetTitle(value)
+		}
+
+		if page.feature.Fields[i].Kind == model.FieldChoice {
+			page.choices[i] = page.feature.Fields[i].Choices()
+		}
+	}
+}
+
+// nextChoice sets the edit of the choice field i with the choice following
+// its current value
+func (page *FeaturePage) nextChoice(i int) {
+	choices := page.choices[i]
+	if len(choices) == 0 {
+		return
+	}
+
+	next := 0
+	for j, curr := range choices {
+		if curr == page.edits[i].Title() {
+			next = (j + 1) % len(choices)
+			break
+		}
+	}
+
+	page.edits[i].SetTitle(choices[next])
+}
+
+// values returns the values of the fields, in the feature fields order
+func (page *FeaturePage) values() []string {
+	result := []string{}
+
+	for i := range page.feature.Fields {
+		value := ""
+
+		if page.checks[i] != nil {
+			if page.checks[i].State() == 1 {
+				value = model.FieldTrue
+			}
+		} else {
+			value = page.edits[i].Title()
+		}
+
+		result = append(result, value)
+	}
+
+	return result
+}
+
+func newFeaturePage(tui *Tui, feature *model.Feature, id int) Page {
+	page := &FeaturePage{
+		feature: feature,
+		edits:   make([]*clui.EditField, len(feature.Fields)),
+		checks:  make([]*clui.CheckBox, len(feature.Fields)),
+		choices: make([][]string, len(feature.Fields)),
+	}
+	page.setupMenu(tui, id, feature.Title, NoButtons, TuiPageMenu)
+
+	clui.CreateLabel(page.content, 2, 2, "Configure the "+feature.Title, Fixed)
+
+	help := []string{}
+	for _, field := range feature.Fields {
+		if field.Kind == model.FieldChoice {
+			help = append(help, fmt.Sprintf("%s: %s, Ctrl+N for the next choice", field.Label, field.Help))
+		} else if field.Help != "" {
+			help = append(help, fmt.Sprintf("%s: %s", field.Label, field.Help))
+		}
+	}
+
+	if len(help) > 0 {
+		helpLabel := clui.CreateLabel(page.content, 2, len(help)+1, strings.Join(help, "\n"), Fixed)
+		helpLabel.SetMultiline(true)
+	}
+
+	frm := clui.CreateFrame(page.content, AutoSize, AutoSize, BorderNone, Fixed)
+	frm.SetPack(clui.Horizontal)
+
+	lblFrm := clui.CreateFrame(frm, 22, AutoSize, BorderNone, Fixed)
+	lblFrm.SetPack(clui.Vertical)
+	lblFrm.SetPaddings(1, 0)
+
+	fldFrm := clui.CreateFrame(frm, 50, AutoSize, BorderNone, Fixed)
+	fldFrm.SetPack(clui.Vertical)
+
+	for i, field := range feature.Fields {
+		if field.Kind == model.FieldBool {
+			newFieldLabel(lblFrm, "")
+
+			checkFrm := clui.CreateFrame(fldFrm, 5, 2, BorderNone, Fixed)
+			checkFrm.SetPack(clui.Vertical)
+
+			page.checks[i] = clui.CreateCheckBox(checkFrm, 1, field.Label, Fixed)
+			continue
+		}
+
+		newFieldLabel(lblFrm, field.Label+":")
+
+		var cb func(k term.Key, ch rune) bool
+		if field.Kind == model.FieldChoice {
+			index := i
+			cb = func(k term.Key, ch rune) bool {
+				if k == term.KeyCtrlN {
+					page.nextChoice(index)
+					return true
+				}
+				return false
+			}
+		}
+
+		page.edits[i], _ = newEditField(fldFrm, false, cb)
+		page.edits[i].SetPasswordMode(field.Kind == model.FieldPassword)
+	}
+
+	page.warningLabel = clui.CreateLabel(page.content, AutoSize, 1, "", Fixed)
+	page.warningLabel.SetMultiline(true)
+	page.warningLabel.SetBackColor(errorLabelBg)
+	page.warningLabel.SetTextColor(errorLabelFg)
+
+	btnFrm := clui.CreateFrame(fldFrm, 30, 1, BorderNone, Fixed)
+	btnFrm.SetPack(clui.Horizontal)
+	btnFrm.SetGaps(1, 1)
+	btnFrm.SetPaddings(2, 0)
+
+	cancelBtn := CreateSimpleButton(btnFrm, AutoSize, AutoSize, "Cancel", Fixed)
+	cancelBtn.OnClick(func(ev clui.Event) {
+		page.GotoPage(TuiPageMenu)
+	})
+
+	confirmBtn := CreateSimpleButton(btnFrm, AutoSize, AutoSize, "Confirm", Fixed)
+	confirmBtn.OnClick(func(ev clui.Event) {
+		if err := page.feature.Apply(page.getModel(), page.values()); err != nil {
+			page.warningLabel.SetTitle(err.Error())
+			return
+		}
+
+		page.SetDone(page.feature.IsConfigured(page.getModel()))
+		page.GotoPage(TuiPageMenu)
+	})
+
+	page.activated = page.edits[0]
+	if page.checks[0] != nil {
+		page.activated = page.checks[0]
+	}
+
+	return page
+}
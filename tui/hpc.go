@@ -0,0 +1,187 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package tui
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/VladimirMarkelov/clui"
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/kernel"
+)
+
+// HPCPage is the Page implementation for the HPC kernel arguments page
+type HPCPage struct {
+	BasePage
+	cpus          []int
+	presets       []string
+	radios        []*clui.Radio
+	group         *clui.RadioGroup
+	sizeEdit      *clui.EditField
+	hugepagesEdit *clui.EditField
+	isolEdit      *clui.EditField
+	nohzEdit      *clui.EditField
+	warning       *clui.Label
+}
+
+// GetConfiguredValue Returns the string representation of currently value set
+func (page *HPCPage) GetConfiguredValue() string {
+	hpc := page.getModel().HPC
+
+	if hpc == nil || hpc.IsEmpty() {
+		return "No huge pages nor isolated CPUs"
+	}
+
+	return strings.Join(hpc.KernelArguments(), " ")
+}
+
+// Activate sets the fields with the current model's values
+func (page *HPCPage) Activate() {
+	hpc := page.getModel().HPC
+	if hpc == nil {
+		hpc = &kernel.HPC{}
+	}
+
+	page.group.SelectItem(page.radios[0])
+	page.setFields(hpc)
+}
+
+func (page *HPCPage) setFields(hpc *kernel.HPC) {
+	hugepages := ""
+	if hpc.Hugepages > 0 {
+		hugepages = strconv.FormatUint(uint64(hpc.Hugepages), 10)
+	}
+
+	page.sizeEdit.SetTitle(hpc.HugepageSize)
+	page.hugepagesEdit.SetTitle(hugepages)
+	page.isolEdit.SetTitle(hpc.IsolCPUs)
+	page.nohzEdit.SetTitle(hpc.NohzFull)
+	page.warning.SetTitle("")
+}
+
+// fieldsHPC returns the HPC configuration of the fields, validated against
+// the detected CPU topology
+func (page *HPCPage) fieldsHPC() (*kernel.HPC, error) {
+	hpc := &kernel.HPC{
+		HugepageSize: strings.TrimSpace(page.sizeEdit.Title()),
+		IsolCPUs:     strings.TrimSpace(page.isolEdit.Title()),
+		NohzFull:     strings.TrimSpace(page.nohzEdit.Title()),
+	}
+
+	if count := strings.TrimSpace(page.hugepagesEdit.Title()); count != "" {
+		value, err := strconv.ParseUint(count, 10, 32)
+		if err != nil {
+			return nil, errors.ValidationErrorf("Invalid number of huge pages: %q", count)
+		}
+
+		hpc.Hugepages = uint(value)
+	}
+
+	if err := hpc.Validate(); err != nil {
+		return nil, err
+	}
+
+	if err := hpc.ValidateTopology(page.cpus); err != nil {
+		return nil, err
+	}
+
+	return hpc, nil
+}
+
+func (page *HPCPage) newField(lblFrm *clui.Frame, fldFrm *clui.Frame, label string) *clui.EditField {
+	newFieldLabel(lblFrm, label)
+
+	iframe := clui.CreateFrame(fldFrm, 5, 2, BorderNone, Fixed)
+	iframe.SetPack(clui.Vertical)
+
+	return clui.CreateEditField(iframe, 1, "", Fixed)
+}
+
+func newHPCPage(tui *Tui) (Page, error) {
+	page := &HPCPage{
+		cpus:    kernel.OnlineCPUs(),
+		presets: []string{""},
+	}
+
+	page.setupMenu(tui, TuiPageHPC, "HPC Kernel Arguments", NoButtons, TuiPageMenu)
+	clui.CreateLabel(page.content, 2, 2,
+		fmt.Sprintf("Reserve huge pages and isolate CPUs, %d CPUs detected", len(page.cpus)), Fixed)
+
+	radioFrm := clui.CreateFrame(page.content, AutoSize, AutoSize, BorderNone, Fixed)
+	radioFrm.SetPack(clui.Vertical)
+	radioFrm.SetPaddings(2, 0)
+
+	page.group = clui.CreateRadioGroup()
+
+	labels := []string{"custom: Set the fields below"}
+	for _, curr := range kernel.HPCPresets {
+		page.presets = append(page.presets, curr.Name)
+		labels = append(labels, fmt.Sprintf("%s: %s", curr.Name, curr.Desc))
+	}
+
+	for i, lbl := range labels {
+		preset := page.presets[i]
+
+		radio := clui.CreateRadio(radioFrm, AutoSize, lbl, AutoSize)
+		radio.SetPack(clui.Horizontal)
+		radio.OnChange(func(active bool) {
+			if hpc := kernel.NewHPCPreset(preset, page.cpus); active && hpc != nil {
+				page.setFields(hpc)
+			}
+		})
+
+		page.group.AddItem(radio)
+		page.radios = append(page.radios, radio)
+	}
+
+	frm := clui.CreateFrame(page.content, AutoSize, AutoSize, BorderNone, Fixed)
+	frm.SetPack(clui.Horizontal)
+
+	lblFrm := clui.CreateFrame(frm, 20, AutoSize, BorderNone, Fixed)
+	lblFrm.SetPack(clui.Vertical)
+	lblFrm.SetPaddings(1, 0)
+
+	fldFrm := clui.CreateFrame(frm, 30, AutoSize, BorderNone, Fixed)
+	fldFrm.SetPack(clui.Vertical)
+
+	page.sizeEdit = page.newField(lblFrm, fldFrm, "Huge page size:")
+	page.hugepagesEdit = page.newField(lblFrm, fldFrm, "Huge pages:")
+	page.isolEdit = page.newField(lblFrm, fldFrm, "isolcpus:")
+	page.nohzEdit = page.newField(lblFrm, fldFrm, "nohz_full:")
+
+	page.warning = clui.CreateLabel(page.content, AutoSize, 1, "", Fixed)
+	page.warning.SetMultiline(true)
+	page.warning.SetBackColor(errorLabelBg)
+	page.warning.SetTextColor(errorLabelFg)
+
+	cancelBtn := CreateSimpleButton(page.cFrame, AutoSize, AutoSize, "Cancel", Fixed)
+	cancelBtn.OnClick(func(ev clui.Event) {
+		page.GotoPage(TuiPageMenu)
+	})
+
+	confirmBtn := CreateSimpleButton(page.cFrame, AutoSize, AutoSize, "Confirm", Fixed)
+	confirmBtn.OnClick(func(ev clui.Event) {
+		hpc, err := page.fieldsHPC()
+		if err != nil {
+			page.warning.SetTitle(err.Error())
+			return
+		}
+
+		if hpc.IsEmpty() {
+			hpc = nil
+		}
+
+		page.getModel().HPC = hpc
+		page.SetDone(hpc != nil)
+		page.GotoPage(TuiPageMenu)
+	})
+
+	page.group.SelectItem(page.radios[0])
+	page.activated = page.sizeEdit
+
+	return page, nil
+}
@@ -11,8 +11,11 @@ import (
 	term "github.com/nsf/termbox-go"
 
 	"github.com/clearlinux/clr-installer/controller"
+	"github.com/clearlinux/clr-installer/log"
+	"github.com/clearlinux/clr-installer/model"
 	"github.com/clearlinux/clr-installer/network"
 	"github.com/clearlinux/clr-installer/progress"
+	"github.com/clearlinux/clr-installer/remote"
 )
 
 // InstallPage is the Page implementation for installation progress page, it also implements
@@ -88,7 +91,7 @@ func (page *InstallPage) LoopWaitDuration() time.Duration {
 // Activate is called when the page is "shown"
 func (page *InstallPage) Activate() {
 	go func() {
-		progress.Set(page)
+		progress.Set(progress.NewThrottle(remote.NewProgress(page), progress.DefaultUpdateInterval))
 
 		err := controller.Install(page.tui.rootDir, page.getModel(), page.tui.options)
 		if err != nil {
@@ -96,19 +99,53 @@ func (page *InstallPage) Activate() {
 			return // In a panic state, do not continue
 		}
 
-		go func() {
-			_ = network.DownloadInstallerMessage("Post-Installation",
-				network.PostInstallConf)
-		}()
+		if !page.getModel().Offline {
+			go func() {
+				_ = network.DownloadInstallerMessage("Post-Installation",
+					network.PostInstallConf)
+			}()
+		}
 		page.rebootBtn.SetEnabled(true)
 		page.exitBtn.SetEnabled(true)
 		clui.ActivateControl(page.GetWindow(), page.rebootBtn)
 		clui.RefreshScreen()
 
 		page.tui.installReboot = true
+
+		if keys := page.getModel().CryptKeys; keys != nil && keys.RecoveryKey != "" {
+			dialog, err := CreateInfoDialogBox("Write down the disk encryption recovery key:\n" +
+				keys.RecoveryKey)
+			if err == nil {
+				dialog.OnClose(page.startPostAction)
+				return
+			}
+			log.Warning("Failed to show the recovery key: %v", err)
+		}
+
+		page.startPostAction()
 	}()
 }
 
+// startPostAction counts down before running the configured post install action,
+// the user may cancel it and stay in the install page
+func (page *InstallPage) startPostAction() {
+	action := page.getModel().PostAction
+	if action == "" || action == model.PostActionStay {
+		return
+	}
+
+	dialog, err := CreateCountdownDialogBox("Installation completed",
+		"Running "+action+" in %d seconds", controller.PostActionCountdown)
+	if err != nil {
+		log.Warning("Failed to show the post install countdown: %v", err)
+		return
+	}
+
+	dialog.OnExpire(func() {
+		go clui.Stop()
+	})
+}
+
 func newInstallPage(tui *Tui) (Page, error) {
 	page := &InstallPage{}
 	page.setup(tui, TuiPageInstall, NoButtons, TuiPageMenu)
@@ -129,6 +166,7 @@ func newInstallPage(tui *Tui) (Page, error) {
 
 	page.rebootBtn = CreateSimpleButton(page.cFrame, AutoSize, AutoSize, "Reboot", Fixed)
 	page.rebootBtn.OnClick(func(ev clui.Event) {
+		page.getModel().PostAction = model.PostActionReboot
 		go clui.Stop()
 	})
 	page.rebootBtn.SetEnabled(false)
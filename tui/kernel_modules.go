@@ -0,0 +1,183 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/VladimirMarkelov/clui"
+
+	"github.com/clearlinux/clr-installer/kernel"
+	"github.com/clearlinux/clr-installer/log"
+)
+
+// KernelModulesPage is the Page implementation for the kernel modules configuration page
+type KernelModulesPage struct {
+	BasePage
+	blacklistEdit *clui.EditField
+	optionsEdit   *clui.EditField
+	applyCheck    *clui.CheckBox
+	warningLabel  *clui.Label
+}
+
+const (
+	kernelModulesHelp = `Note: Separate the blacklisted modules with spaces and the module
+      options with commas, each starting with the module name, i.e:
+      "iwlwifi power_save=0, i915 enable_guc=2". Applying the changes
+      to the installer unloads the blacklisted modules and reloads
+      the modules having new options.`
+)
+
+// GetConfiguredValue Returns the string representation of currently value set
+func (page *KernelModulesPage) GetConfiguredValue() string {
+	km := page.getModel().KernelModules
+
+	if km == nil || km.IsEmpty() {
+		return "No kernel modules configuration defined"
+	}
+
+	values := []string{}
+
+	if len(km.Blacklist) > 0 {
+		values = append(values, fmt.Sprintf("Blacklist: %s", strings.Join(km.Blacklist, " ")))
+	}
+
+	if len(km.Options) > 0 {
+		values = append(values, fmt.Sprintf("Options: %s", formatModuleOptions(km.Options)))
+	}
+
+	return strings.Join(values, " | ")
+}
+
+// Activate sets the kernel modules configuration with the current model's value
+func (page *KernelModulesPage) Activate() {
+	page.warningLabel.SetTitle("")
+	page.applyCheck.SetState(0)
+
+	km := page.getModel().KernelModules
+	if km == nil {
+		return
+	}
+
+	page.blacklistEdit.SetTitle(strings.Join(km.Blacklist, " "))
+	page.optionsEdit.SetTitle(formatModuleOptions(km.Options))
+}
+
+// formatModuleOptions returns the module options as edited in the page
+func formatModuleOptions(options []*kernel.ModuleOptions) string {
+	values := []string{}
+
+	for _, curr := range options {
+		values = append(values, curr.Name+" "+curr.Options)
+	}
+
+	return strings.Join(values, ", ")
+}
+
+// parseModuleOptions parses the module options as edited in the page
+func parseModuleOptions(text string) []*kernel.ModuleOptions {
+	result := []*kernel.ModuleOptions{}
+
+	for _, curr := range strings.Split(text, ",") {
+		fields := strings.Fields(curr)
+		if len(fields) == 0 {
+			continue
+		}
+
+		result = append(result, &kernel.ModuleOptions{
+			Name:    fields[0],
+			Options: strings.Join(fields[1:], " "),
+		})
+	}
+
+	return result
+}
+
+func newKernelModulesPage(tui *Tui) (Page, error) {
+	page := &KernelModulesPage{}
+	page.setupMenu(tui, TuiPageKernelModules, "Kernel Modules", NoButtons, TuiPageMenu)
+
+	clui.CreateLabel(page.content, 2, 2, "Blacklist Kernel Modules or Set Their Options", Fixed)
+
+	helpLabel := clui.CreateLabel(page.content, 2, 5, kernelModulesHelp, Fixed)
+	helpLabel.SetMultiline(true)
+
+	frm := clui.CreateFrame(page.content, AutoSize, AutoSize, BorderNone, Fixed)
+	frm.SetPack(clui.Horizontal)
+
+	lblFrm := clui.CreateFrame(frm, 20, AutoSize, BorderNone, Fixed)
+	lblFrm.SetPack(clui.Vertical)
+	lblFrm.SetPaddings(1, 0)
+
+	newFieldLabel(lblFrm, "Blacklist:")
+
+	newFieldLabel(lblFrm, "Module Options:")
+
+	fldFrm := clui.CreateFrame(frm, 30, AutoSize, BorderNone, Fixed)
+	fldFrm.SetPack(clui.Vertical)
+
+	iframe := clui.CreateFrame(fldFrm, 5, 2, BorderNone, Fixed)
+	iframe.SetPack(clui.Vertical)
+
+	page.blacklistEdit = clui.CreateEditField(iframe, 1, "", Fixed)
+
+	iframe = clui.CreateFrame(fldFrm, 5, 2, BorderNone, Fixed)
+	iframe.SetPack(clui.Vertical)
+
+	page.optionsEdit = clui.CreateEditField(iframe, 1, "", Fixed)
+
+	page.applyCheck = clui.CreateCheckBox(fldFrm, AutoSize, "Apply to the installer now", AutoSize)
+
+	page.warningLabel = clui.CreateLabel(page.content, AutoSize, 1, "", Fixed)
+	page.warningLabel.SetMultiline(true)
+	page.warningLabel.SetBackColor(errorLabelBg)
+	page.warningLabel.SetTextColor(errorLabelFg)
+
+	btnFrm := clui.CreateFrame(fldFrm, 30, 1, BorderNone, Fixed)
+	btnFrm.SetPack(clui.Horizontal)
+	btnFrm.SetGaps(1, 1)
+	btnFrm.SetPaddings(2, 0)
+
+	cancelBtn := CreateSimpleButton(btnFrm, AutoSize, AutoSize, "Cancel", Fixed)
+	cancelBtn.OnClick(func(ev clui.Event) {
+		page.GotoPage(TuiPageMenu)
+	})
+
+	confirmBtn := CreateSimpleButton(btnFrm, AutoSize, AutoSize, "Confirm", Fixed)
+
+	confirmBtn.OnClick(func(ev clui.Event) {
+		km := &kernel.Modules{
+			Blacklist: strings.Fields(page.blacklistEdit.Title()),
+			Options:   parseModuleOptions(page.optionsEdit.Title()),
+		}
+
+		if err := km.Validate(); err != nil {
+			page.warningLabel.SetTitle(err.Error())
+			return
+		}
+
+		if page.applyCheck.State() == 1 {
+			if err := km.Apply(); err != nil {
+				log.Warning("Failed to apply the kernel modules configuration: %v", err)
+				page.warningLabel.SetTitle(fmt.Sprintf("Failed to apply to the installer: %v", err))
+				return
+			}
+		}
+
+		if km.IsEmpty() {
+			km = nil
+		}
+
+		page.getModel().KernelModules = km
+		page.SetDone(km != nil)
+
+		page.GotoPage(TuiPageMenu)
+	})
+
+	page.activated = page.blacklistEdit
+
+	return page, nil
+}
@@ -9,6 +9,7 @@ import (
 
 	"github.com/VladimirMarkelov/clui"
 	"github.com/clearlinux/clr-installer/kernel"
+	"github.com/clearlinux/clr-installer/model"
 )
 
 // KernelPage is the Page implementation for the proxy configuration page
@@ -18,15 +19,17 @@ type KernelPage struct {
 	group   *clui.RadioGroup
 }
 
-// KernelRadio maps a map name and description with the actual checkbox
+// KernelRadio maps a map name and description with the actual checkbox,
+// profile is set for the kernel profiles radios
 type KernelRadio struct {
-	kernel *kernel.Kernel
-	radio  *clui.Radio
+	kernel  *kernel.Kernel
+	radio   *clui.Radio
+	profile string
 }
 
 // GetConfiguredValue Returns the string representation of currently value set
 func (kp *KernelPage) GetConfiguredValue() string {
-	return kp.getModel().Kernel.Bundle
+	return kp.getModel().SummaryValue(model.SummaryKernel)
 }
 
 // Activate marks selects the kernel radio based on the data model
@@ -34,7 +37,8 @@ func (kp *KernelPage) Activate() {
 	model := kp.getModel()
 
 	for _, curr := range kp.kernels {
-		if !curr.kernel.Equals(model.Kernel) {
+		if curr.profile != model.KernelProfile ||
+			(curr.profile == "" && !curr.kernel.Equals(model.Kernel)) {
 			continue
 		}
 
@@ -66,7 +70,14 @@ func newKernelPage(tui *Tui) (Page, error) {
 	}
 
 	for _, curr := range kernels {
-		page.kernels = append(page.kernels, &KernelRadio{curr, nil})
+		page.kernels = append(page.kernels, &KernelRadio{curr, nil, ""})
+	}
+
+	// the profile kernel replaces the selected one at install time, if
+	// available for the installed version
+	for _, curr := range kernel.Profiles {
+		k := &kernel.Kernel{Bundle: curr.Bundle, Name: curr.Name, Desc: curr.Desc}
+		page.kernels = append(page.kernels, &KernelRadio{k, nil, curr.Name})
 	}
 
 	page.setupMenu(tui, TuiPageKernel, "Kernel Selection", NoButtons, TuiPageMenu)
@@ -98,8 +109,13 @@ func newKernelPage(tui *Tui) (Page, error) {
 
 	confirmBtn := CreateSimpleButton(page.cFrame, AutoSize, AutoSize, "Confirm", Fixed)
 	confirmBtn.OnClick(func(ev clui.Event) {
-		selected := page.group.Selected()
-		page.getModel().Kernel = page.kernels[selected].kernel
+		selected := page.kernels[page.group.Selected()]
+		model := page.getModel()
+
+		model.KernelProfile = selected.profile
+		if selected.profile == "" || model.Kernel == nil {
+			model.Kernel = selected.kernel
+		}
 		page.SetDone(true)
 		page.GotoPage(TuiPageMenu)
 	})
@@ -5,22 +5,26 @@
 package tui
 
 import (
+	"strings"
+
 	"github.com/VladimirMarkelov/clui"
 	term "github.com/nsf/termbox-go"
 
 	"github.com/clearlinux/clr-installer/keyboard"
+	"github.com/clearlinux/clr-installer/model"
 )
 
 // KeyboardPage is the Page implementation for the keyboard configuration page
 type KeyboardPage struct {
 	BasePage
-	avKeymaps  []*keyboard.Keymap
-	kbdListBox *clui.ListBox
+	avKeymaps     []*keyboard.Keymap
+	kbdListBox    *ScrollListBox
+	suggestionLbl *clui.Label
 }
 
 // GetConfiguredValue Returns the string representation of currently keyboard set
 func (page *KeyboardPage) GetConfiguredValue() string {
-	return page.getModel().Keyboard.Code
+	return page.getModel().SummaryValue(model.SummaryKeyboard)
 }
 
 // GetConfigDefinition returns if the config was interactively defined by the user,
@@ -40,10 +44,35 @@ func (page *KeyboardPage) GetConfigDefinition() int {
 // SetDone sets the keyboard page flag done, and sets back the configuration to the data model
 func (page *KeyboardPage) SetDone(done bool) bool {
 	page.done = done
-	page.getModel().Keyboard = page.avKeymaps[page.kbdListBox.SelectedItem()]
+	page.getModel().Keyboard = page.avKeymaps[page.kbdListBox.SelectedItem()].AsUserDefined()
 	return true
 }
 
+// Activate selects the model's keyboard, it may have been suggested for the
+// chosen language, and lists the suggested ones
+func (page *KeyboardPage) Activate() {
+	for idx, curr := range page.avKeymaps {
+		if curr.Equals(page.getModel().Keyboard) {
+			page.kbdListBox.SelectItem(idx)
+			break
+		}
+	}
+
+	suggested := []string{}
+	if locale := page.getModel().GetTargetLocale(); locale != nil {
+		for _, curr := range keyboard.Suggest(locale.Code) {
+			suggested = append(suggested, curr.Code)
+		}
+	}
+
+	if len(suggested) == 0 {
+		page.suggestionLbl.SetTitle("")
+		return
+	}
+
+	page.suggestionLbl.SetTitle("Suggested for the chosen language: " + strings.Join(suggested, ", "))
+}
+
 // DeActivate will reset the selection case the user has pressed cancel
 func (page *KeyboardPage) DeActivate() {
 	if page.action == ActionConfirmButton {
@@ -85,7 +114,9 @@ func newKeyboardPage(tui *Tui) (Page, error) {
 	lbl := clui.CreateLabel(page.content, 2, 2, "Select Keyboard", Fixed)
 	lbl.SetPaddings(0, 2)
 
-	page.kbdListBox = clui.CreateListBox(page.content, AutoSize, 10, Fixed)
+	page.suggestionLbl = clui.CreateLabel(page.content, AutoSize, 1, "", Fixed)
+
+	page.kbdListBox = CreateScrollListBox(page.content, AutoSize, 10, Fixed)
 	page.kbdListBox.SetStyle("List")
 
 	defKeyboard := 0
@@ -11,25 +11,25 @@ import (
 	term "github.com/nsf/termbox-go"
 
 	"github.com/clearlinux/clr-installer/language"
+	"github.com/clearlinux/clr-installer/model"
 )
 
 // LanguagePage is the Page implementation for the language configuration page
 type LanguagePage struct {
 	BasePage
 	avLanguages []*language.Language
-	langListBox *clui.ListBox
+	langListBox *ScrollListBox
 }
 
 // GetConfiguredValue Returns the string representation of currently language set
 func (page *LanguagePage) GetConfiguredValue() string {
-	desc, code := page.getModel().Language.GetConfValues()
-	return fmt.Sprintf("%-14s  %s", "["+code+"]", desc)
+	return page.getModel().SummaryValue(model.SummaryLanguage)
 }
 
 // GetConfigDefinition returns if the config was interactively defined by the user,
 // was loaded from a config file or if the config is not set.
 func (page *LanguagePage) GetConfigDefinition() int {
-	lang := page.getModel().Language
+	lang := page.getModel().GetTargetLocale()
 
 	if lang == nil {
 		return ConfigNotDefined
@@ -43,7 +43,10 @@ func (page *LanguagePage) GetConfigDefinition() int {
 // SetDone sets the keyboard page flag done, and sets back the configuration to the data model
 func (page *LanguagePage) SetDone(done bool) bool {
 	page.done = done
+	// the text installer is not localized, the choice is the target locale
 	page.getModel().Language = page.avLanguages[page.langListBox.SelectedItem()]
+	page.getModel().TargetLocale = nil
+	page.getModel().SuggestKeyboard()
 	return true
 }
 
@@ -54,7 +57,7 @@ func (page *LanguagePage) DeActivate() {
 	}
 
 	for idx, curr := range page.avLanguages {
-		if !curr.Equals(page.getModel().Language) {
+		if !curr.Equals(page.getModel().GetTargetLocale()) {
 			continue
 		}
 
@@ -82,7 +85,7 @@ func newLanguagePage(tui *Tui) (Page, error) {
 	lbl := clui.CreateLabel(page.content, 2, 2, "Select System Language", Fixed)
 	lbl.SetPaddings(0, 2)
 
-	page.langListBox = clui.CreateListBox(page.content, AutoSize, ContentHeight-1, Fixed)
+	page.langListBox = CreateScrollListBox(page.content, AutoSize, ContentHeight-1, Fixed)
 	page.langListBox.SetStyle("List")
 
 	page.langListBox.OnActive(func(active bool) {
@@ -104,7 +107,7 @@ func newLanguagePage(tui *Tui) (Page, error) {
 		return false
 	})
 
-	modelLanguage := page.getModel().Language
+	modelLanguage := page.getModel().GetTargetLocale()
 	defLanguage := 0
 	for idx, curr := range page.avLanguages {
 		desc, code := curr.GetConfValues()
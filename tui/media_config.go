@@ -6,11 +6,16 @@ package tui
 
 import (
 	"fmt"
+	"strings"
+
 	"github.com/VladimirMarkelov/clui"
 	term "github.com/nsf/termbox-go"
 
+	"github.com/clearlinux/clr-installer/controller"
 	"github.com/clearlinux/clr-installer/log"
+	"github.com/clearlinux/clr-installer/model"
 	"github.com/clearlinux/clr-installer/storage"
+	"github.com/clearlinux/clr-installer/swupd"
 )
 
 const (
@@ -28,7 +33,7 @@ type MediaConfigPage struct {
 	isSafeSelected        bool
 	isDestructiveSelected bool
 
-	chooserList   *clui.ListBox
+	chooserList   *ScrollListBox
 	listBackColor term.Attribute
 	listTextColor term.Attribute
 
@@ -37,37 +42,23 @@ type MediaConfigPage struct {
 
 	labelWarning     *clui.Label
 	labelDestructive *clui.Label
+	space            *storage.SpaceRequirements
 
 	encryptCheck *clui.CheckBox
+	homeCheck    *clui.CheckBox
+	fscryptCheck *clui.CheckBox
+	lvmCheck     *clui.CheckBox
+	mbrCheck     *clui.CheckBox
 
 	devs         []*storage.BlockDevice
+	diagnostics  []*storage.MediaDiagnostic
 	activeDisk   *storage.BlockDevice
 	activeSerial string
 }
 
 // GetConfiguredValue Returns the string representation of currently value set
 func (page *MediaConfigPage) GetConfiguredValue() string {
-	tm := page.getModel().TargetMedias
-	if len(tm) == 0 {
-		return "No -media- selected"
-	}
-
-	target := page.getModel().InstallSelected
-	portion := storage.FormatInstallPortion(target)
-
-	// Size string
-	size, _ := storage.HumanReadableSizeWithPrecision(target.FreeEnd-target.FreeStart, 1)
-
-	encrypted := ""
-	for _, bd := range tm {
-		for _, ch := range bd.Children {
-			if ch.Type == storage.BlockDeviceTypeCrypt {
-				encrypted = " Encryption"
-			}
-		}
-	}
-
-	return fmt.Sprintf("%s (%s) %s%s %s", target.Friendly, target.Name, portion, encrypted, size)
+	return page.getModel().SummaryValue(model.SummaryMedia)
 }
 
 // GetConfigDefinition returns if the config was interactively defined by the user,
@@ -96,18 +87,62 @@ func (page *MediaConfigPage) GetConfigDefinition() int {
 
 // SetDone sets the configured disk into the model and sets the page as done
 func (page *MediaConfigPage) SetDone(done bool) bool {
-	var installBlockDevice *storage.BlockDevice
-
 	if page.safeRadio.Selected() {
 		page.getModel().InstallSelected = page.safeTargets[page.chooserList.SelectedItem()]
 		log.Debug("Safe Install Target %v", page.getModel().InstallSelected)
 	} else if page.destructiveRadio.Selected() {
 		page.getModel().InstallSelected = page.destructiveTargets[page.chooserList.SelectedItem()]
 		log.Debug("Destructive Install Target %v", page.getModel().InstallSelected)
+
+		// Never silently reuse the existing LUKS, LVM and RAID stacks
+		if signatures := page.getModel().InstallSelected.Signatures; len(signatures) > 0 {
+			message := fmt.Sprintf("Selected media has existing signatures, use Deactivate and Wipe first:\n%s",
+				strings.Join(signatures, "\n"))
+			if _, err := CreateWarningDialogBox(message); err != nil {
+				log.Warning("Failed to create the warning dialog: %s", err)
+			}
+			return false
+		}
 	} else {
 		log.Warning("Failed to find and save the selected installation media")
 	}
 
+	// The MBR and hybrid partition tables are only converted, or kept, once
+	// the user is warned
+	target := page.getModel().InstallSelected
+	policy := storage.PartitionTablePolicyConvert
+	if page.mbrCheck.State() != 0 {
+		policy = storage.PartitionTablePolicyPreserve
+	}
+
+	page.getModel().PartitionTable = ""
+	if warnings := storage.PartitionTableWarnings(target, policy, page.getModel().LegacyBios); len(warnings) > 0 {
+		dialog, err := CreateConfirmCancelDialogBox(strings.Join(warnings, "\n") + "\n\nContinue?")
+		if err != nil {
+			log.Warning("Failed to create the confirmation dialog: %s", err)
+			return false
+		}
+
+		dialog.OnClose(func() {
+			if dialog.Confirmed {
+				page.getModel().PartitionTable = policy
+				page.storeSelectedMedia()
+			}
+		})
+
+		return false
+	}
+
+	page.storeSelectedMedia()
+
+	return false
+}
+
+// storeSelectedMedia partitions the selected install target and sets it into
+// the model
+func (page *MediaConfigPage) storeSelectedMedia() {
+	var installBlockDevice *storage.BlockDevice
+
 	bds, err := storage.ListAvailableBlockDevices(page.getModel().TargetMedias)
 	if err != nil {
 		log.Error("Failed to find storage media for install during save: %s", err)
@@ -118,12 +153,16 @@ func (page *MediaConfigPage) SetDone(done bool) bool {
 			installBlockDevice = curr.Clone()
 			// Using the whole disk
 			if page.getModel().InstallSelected.WholeDisk {
-				storage.NewStandardPartitions(installBlockDevice)
+				if page.getModel().SwapFileSize != "" {
+					storage.NewStandardPartitionsNoSwap(installBlockDevice)
+				} else {
+					storage.NewStandardPartitions(installBlockDevice)
+				}
 			} else {
 				// Partial Disk, Add our partitions
 				size := page.getModel().InstallSelected.FreeEnd - page.getModel().InstallSelected.FreeStart
-				size = size - storage.AddBootStandardPartition(installBlockDevice)
-				if !installBlockDevice.DeviceHasSwap() {
+				size = size - page.getModel().AddBootPartition(installBlockDevice)
+				if page.getModel().SwapFileSize == "" && !installBlockDevice.DeviceHasSwap() {
 					size = size - storage.AddSwapStandardPartition(installBlockDevice)
 				}
 				storage.AddRootStandardPartition(installBlockDevice, size)
@@ -134,19 +173,38 @@ func (page *MediaConfigPage) SetDone(done bool) bool {
 		}
 	}
 
+	page.getModel().HomeEncryption = ""
+	if page.fscryptCheck.State() != 0 {
+		page.getModel().HomeEncryption = storage.HomeEncryptionFscrypt
+	}
+
 	if page.encryptCheck.State() != 0 {
-		for _, child := range installBlockDevice.Children {
-			if child.MountPoint == "/" {
-				child.Type = storage.BlockDeviceTypeCrypt
+		if err := storage.EncryptStandardPartitions(installBlockDevice, page.homeCheck.State() != 0); err != nil {
+			log.Warning("Failed to encrypt the install media: %s", err)
+			if _, dErr := CreateWarningDialogBox(err.Error()); dErr != nil {
+				log.Warning("Failed to encrypt the install media: warning dialog failed: %s", dErr)
 			}
+			page.getModel().TargetMedias = nil
+			return
 		}
 	}
 
+	if page.lvmCheck.State() != 0 {
+		vg, err := storage.LVMStandardPartitions(installBlockDevice)
+		if err != nil {
+			log.Warning("Failed to use LVM on the install media: %s", err)
+			if _, dErr := CreateWarningDialogBox(err.Error()); dErr != nil {
+				log.Warning("Failed to use LVM on the install media: warning dialog failed: %s", dErr)
+			}
+			page.getModel().TargetMedias = nil
+			return
+		}
+		page.getModel().AddTargetMedia(vg)
+	}
+
 	// TODO start using new API page.GotoPage() when finished merging
 	// disk pages
 	page.tui.gotoPage(TuiPageMenu, page)
-
-	return false
 }
 
 // Activate updates the UI elements with the most current list of block devices
@@ -187,6 +245,7 @@ func newMediaConfigPage(tui *Tui) (Page, error) {
 			// Tag this Page as required to be complete for the Install to proceed
 			required: true,
 		},
+		space: storage.NewSpaceRequirements(0),
 	}
 	page.setupMenu(tui, TuiPageMediaConfig, mediaConfigMenuTitle, CancelButton|ConfirmButton, TuiPageMenu)
 
@@ -224,7 +283,8 @@ func newMediaConfigPage(tui *Tui) (Page, error) {
 
 		if active {
 			if len(page.safeTargets) < 1 {
-				warning := "No media or space available for installation"
+				warning := fmt.Sprintf("No media or space available for installation, it needs %s",
+					page.space.String())
 				log.Warning(warning)
 				warning = fmt.Sprintf("Warning: %s", warning)
 				page.labelWarning.SetTitle(warning)
@@ -272,7 +332,7 @@ func newMediaConfigPage(tui *Tui) (Page, error) {
 	listFrame := clui.CreateFrame(contentFrame, 60, 3, BorderNone, Fixed)
 	listFrame.SetPack(clui.Vertical)
 
-	page.chooserList = clui.CreateListBox(listFrame, 60, 3, Fixed)
+	page.chooserList = CreateScrollListBox(listFrame, 60, 3, Fixed)
 	page.chooserList.SetAlign(AlignLeft)
 	page.chooserList.SetStyle("List")
 	page.listBackColor = page.chooserList.BackColor()
@@ -321,36 +381,47 @@ func newMediaConfigPage(tui *Tui) (Page, error) {
 				})
 			}
 		}
+
+		page.homeCheck.SetEnabled(page.encryptCheck.State() != 0)
+		if page.encryptCheck.State() == 0 {
+			page.homeCheck.SetState(0)
+		}
+		page.lvmCheck.SetEnabled(page.encryptCheck.State() == 0)
+	})
+
+	// Encrypt only a separate /home partition, the root partition is left unencrypted
+	page.homeCheck = clui.CreateCheckBox(contentFrame, AutoSize, "Encrypt /home only", AutoSize)
+	page.homeCheck.SetEnabled(false)
+
+	// Encrypt the home directory of each user with their login password, no
+	// passphrase is asked at boot
+	page.fscryptCheck = clui.CreateCheckBox(contentFrame, AutoSize, "Encrypt home directories per user", AutoSize)
+	page.fscryptCheck.SetState(0)
+	if page.getModel().HomeEncryption == storage.HomeEncryptionFscrypt {
+		page.fscryptCheck.SetState(1)
+	}
+
+	// Put the root file system on a LVM logical volume, encrypted physical
+	// volumes are not supported
+	page.lvmCheck = clui.CreateCheckBox(contentFrame, AutoSize, "Use LVM", AutoSize)
+	page.lvmCheck.OnChange(func(state int) {
+		page.encryptCheck.SetEnabled(state == 0)
 	})
 
+	// Keep the MBR partition table of the erased disk, legacy BIOS only
+	page.mbrCheck = clui.CreateCheckBox(contentFrame, AutoSize, "Keep MBR partition table", AutoSize)
+	page.mbrCheck.SetEnabled(page.getModel().LegacyBios)
+
 	// Add a Rescan media button
 	rescanBtn := CreateSimpleButton(page.cFrame, AutoSize, AutoSize, "Rescan Media", Fixed)
 	rescanBtn.OnClick(func(ev clui.Event) {
-		var err error
-		page.devs, err = storage.RescanBlockDevices(page.getModel().TargetMedias)
-		if err != nil {
-			page.Panic(err)
-		}
-
-		if err := page.buildMediaLists(); err != nil {
-			page.Panic(err)
-		}
-
-		// Check if the active device is still present
-		var found bool
-		for _, bd := range page.devs {
-			if bd.Serial == page.activeSerial {
-				found = true
-				page.activeDisk = bd
-			}
-		}
-		if !found {
-			page.activeSerial = ""
-			page.activeDisk = nil
-			page.getModel().TargetMedias = nil
-		}
+		page.rescanMedia()
+	})
 
-		page.GotoPage(TuiPageMediaConfig)
+	// Add a Deactivate and Wipe button for the existing LUKS, LVM and RAID stacks
+	wipeBtn := CreateSimpleButton(page.cFrame, AutoSize, AutoSize, "Deactivate and Wipe", Fixed)
+	wipeBtn.OnClick(func(ev clui.Event) {
+		page.wipeSelectedMedia()
 	})
 
 	// Add an Advanced Configuration  button
@@ -366,6 +437,98 @@ func newMediaConfigPage(tui *Tui) (Page, error) {
 	return page, nil
 }
 
+// rescanMedia rescans the media, i.e on the user request or after a media was
+// wiped, and checks if the active device is still present
+func (page *MediaConfigPage) rescanMedia() {
+	var err error
+
+	// Load the missing storage drivers found when nothing was scanned
+	if storage.HasDiagnosedModules(page.diagnostics) {
+		if err = storage.LoadDiagnosedModules(page.diagnostics); err != nil {
+			log.Warning("Failed to load the storage drivers: %v", err)
+		}
+	}
+
+	page.devs, err = controller.RescanMedia(page.getModel().TargetMedias)
+	if err != nil {
+		page.Panic(err)
+	}
+
+	if err := page.buildMediaLists(); err != nil {
+		page.Panic(err)
+	}
+
+	// Check if the active device is still present
+	var found bool
+	for _, bd := range page.devs {
+		if bd.Serial == page.activeSerial {
+			found = true
+			page.activeDisk = bd
+		}
+	}
+	if !found {
+		page.activeSerial = ""
+		page.activeDisk = nil
+		page.getModel().TargetMedias = nil
+	}
+
+	page.GotoPage(TuiPageMediaConfig)
+}
+
+// selectedSignatures returns the selected destructive target device and the
+// descriptions of its LUKS, LVM and RAID signatures
+func (page *MediaConfigPage) selectedSignatures() (*storage.BlockDevice, []string) {
+	idx := page.chooserList.SelectedItem()
+	if !page.isDestructiveSelected || idx < 0 || idx >= len(page.destructiveTargets) {
+		return nil, nil
+	}
+
+	target := page.destructiveTargets[idx]
+	for _, bd := range page.devs {
+		if bd.Name == target.Name {
+			return bd, target.Signatures
+		}
+	}
+
+	return nil, nil
+}
+
+// wipeSelectedMedia deactivates and wipes the LUKS, LVM and RAID signatures of
+// the selected media after the user confirmed it
+func (page *MediaConfigPage) wipeSelectedMedia() {
+	bd, signatures := page.selectedSignatures()
+	if bd == nil || len(signatures) == 0 {
+		if _, err := CreateWarningDialogBox("Select a destructive installation media with LUKS, LVM or RAID signatures to wipe."); err != nil {
+			log.Warning("Failed to create the warning dialog: %s", err)
+		}
+		return
+	}
+
+	message := fmt.Sprintf("Deactivate and wipe the %d LUKS, LVM or RAID signatures of %s?\n\nAll their data will be lost!",
+		len(signatures), bd.Name)
+	dialog, err := CreateConfirmCancelDialogBox(message)
+	if err != nil {
+		log.Warning("Failed to create the confirmation dialog: %s", err)
+		return
+	}
+
+	dialog.OnClose(func() {
+		if !dialog.Confirmed {
+			return
+		}
+
+		log.Warning("Deactivating and wiping the signatures of %s: %s", bd.Name, strings.Join(signatures, ", "))
+		if err := controller.WipeMedia(bd); err != nil {
+			log.Error("Failed to wipe %s: %s", bd.Name, err)
+			if _, dErr := CreateWarningDialogBox(fmt.Sprintf("Failed to wipe %s: %s", bd.Name, err)); dErr != nil {
+				log.Warning("Failed to create the warning dialog: %s", dErr)
+			}
+		}
+
+		page.rescanMedia()
+	})
+}
+
 func (page *MediaConfigPage) buildChooserList() {
 	clui.WindowManager().BeginUpdate()
 	defer clui.WindowManager().EndUpdate()
@@ -387,6 +550,26 @@ func (page *MediaConfigPage) buildChooserList() {
 		}
 		page.chooserList.SetBackColor(errorLabelBg)
 		page.chooserList.SetTextColor(errorLabelFg)
+
+		warnings := []string{}
+		for _, target := range page.destructiveTargets {
+			if len(target.Signatures) > 0 {
+				warnings = append(warnings, "* Existing LUKS, LVM or RAID signatures, use Deactivate and Wipe")
+				break
+			}
+		}
+
+		for _, target := range page.destructiveTargets {
+			if target.FreeEnd-target.FreeStart < page.space.Total() {
+				warnings = append(warnings, fmt.Sprintf("Some media are too small, the install needs %s",
+					page.space.String()))
+				break
+			}
+		}
+
+		if len(warnings) > 0 {
+			page.labelWarning.SetTitle(strings.Join(warnings, "\n"))
+		}
 	} else {
 		log.Warning("buildChooserList: unknown radio button state")
 	}
@@ -401,12 +584,35 @@ func (page *MediaConfigPage) buildMediaLists() error {
 	page.labelDestructive.SetTitle("")
 
 	var err error
-	page.devs, err = storage.ListAvailableBlockDevices(page.getModel().TargetMedias)
+	page.devs, err = controller.ScanMedia(page.getModel().TargetMedias)
 	if err != nil {
 		page.Panic(err)
 	}
 
-	page.safeTargets = storage.FindSafeInstallTargets(storage.MinimumServerInstallSize, page.devs)
+	page.diagnostics = nil
+	if len(page.devs) == 0 {
+		page.diagnostics = storage.DiagnoseMediaScan()
+
+		problems := []string{}
+		for _, diag := range page.diagnostics {
+			log.Warning("Media scan: %s", diag)
+			problems = append(problems, diag.String())
+		}
+
+		warning := "No media found for installation"
+		if storage.HasDiagnosedModules(page.diagnostics) {
+			warning = warning + ", use Rescan Media to load the drivers"
+		}
+
+		if len(problems) > 0 {
+			warning = warning + ": " + strings.Join(problems, ", ")
+		}
+		page.labelWarning.SetTitle(warning)
+	}
+
+	// the same requirements the model validation and the pre-checks use
+	page.space = swupd.LoadSpaceRequirements(page.getModel())
+	page.safeTargets = storage.FindSafeInstallTargets(page.space.Total(), page.devs)
 	page.destructiveTargets = storage.FindAllInstallTargets(page.devs)
 
 	if len(page.safeTargets) > 0 {
@@ -434,5 +640,10 @@ func fmtInstallTarget(target storage.InstallTarget) string {
 	// Size string
 	size, _ := storage.HumanReadableSizeWithPrecision(target.FreeEnd-target.FreeStart, 1)
 
-	return fmt.Sprintf("%-32s  %10s  %-14s  %8s", target.Friendly, target.Name, portion, size)
+	result := fmt.Sprintf("%-32s  %10s  %-14s  %8s", target.Friendly, target.Name, portion, size)
+	if len(target.Signatures) > 0 {
+		result = result + " *"
+	}
+
+	return result
 }
@@ -5,11 +5,14 @@
 package tui
 
 import (
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/VladimirMarkelov/clui"
 
 	"github.com/clearlinux/clr-installer/controller"
+	"github.com/clearlinux/clr-installer/log"
 	"github.com/clearlinux/clr-installer/network"
 )
 
@@ -17,6 +20,7 @@ import (
 type MenuPage struct {
 	BasePage
 	installBtn *SimpleButton
+	missingLbl *clui.Label
 	tabGroup   *TabGroup
 	reqTab     *TabPage
 	advTab     *TabPage
@@ -99,7 +103,21 @@ func (page *MenuPage) Activate() {
 		}
 	}
 
-	if page.getModel() != nil && page.getModel().Validate() == nil {
+	// Validate is nil safe, a missing model fails the validation
+	err := page.getModel().Validate()
+
+	// tell exactly what's missing before the install is allowed
+	if missing := page.tui.MissingRequirements(); len(missing) > 0 {
+		page.missingLbl.SetTitle("Required: " + strings.Join(missing, ", "))
+		page.missingLbl.SetVisible(true)
+	} else if err != nil {
+		page.missingLbl.SetTitle(err.Error())
+		page.missingLbl.SetVisible(true)
+	} else {
+		page.missingLbl.SetVisible(false)
+	}
+
+	if err == nil {
 		page.installBtn.SetEnabled(true)
 		page.activated = page.installBtn
 	} else {
@@ -110,6 +128,34 @@ func (page *MenuPage) Activate() {
 	}
 }
 
+// saveConfig writes the configuration file requested with --generate-config and
+// exits, in the config generation mode the install is never performed
+func (page *MenuPage) saveConfig() {
+	file := page.tui.options.GenerateConfig
+
+	if err := page.getModel().WriteFile(file); err != nil {
+		msg := fmt.Sprintf("Failed to save config file: %v", err)
+		log.Warning("Generate config: %s", msg)
+		if _, err = CreateWarningDialogBox(msg); err != nil {
+			log.Warning("Generate config: warning dialog failed: %s", err)
+		}
+		return
+	}
+
+	log.Info("Generated configuration file: %s", file)
+
+	dialog, err := CreateInfoDialogBox(fmt.Sprintf("Saved configuration to %q", file))
+	if err != nil {
+		log.Warning("Generate config: info dialog failed: %s", err)
+		go clui.Stop()
+		return
+	}
+
+	dialog.OnClose(func() {
+		go clui.Stop()
+	})
+}
+
 func scrollTabToActive(activated clui.Control, group *TabGroup) {
 	if activated == nil {
 		return
@@ -155,9 +201,19 @@ func newMenuPage(tui *Tui) (Page, error) {
 		go clui.Stop()
 	})
 
-	page.installBtn = CreateSimpleButton(page.cFrame, AutoSize, AutoSize, "Install", Fixed)
+	installTitle := "Install"
+	if tui.options.GenerateConfig != "" {
+		installTitle = "Save"
+	}
+
+	page.installBtn = CreateSimpleButton(page.cFrame, AutoSize, AutoSize, installTitle, Fixed)
 	page.installBtn.OnClick(func(ev clui.Event) {
-		if !controller.NetworkPassing {
+		if page.tui.options.GenerateConfig != "" {
+			page.saveConfig()
+			return
+		}
+
+		if !controller.NetworkPassing && !page.tui.model.Offline {
 			// Network needs to be validated before the install
 			if dialog, err := CreateNetworkTestDialogBox(page.tui.model); err == nil {
 				if dialog.RunNetworkTest() {
@@ -176,10 +232,12 @@ func newMenuPage(tui *Tui) (Page, error) {
 				dialog.OnClose(func() {
 					if dialog.Confirmed {
 						page.GotoPage(TuiPageInstall)
-						go func() {
-							_ = network.DownloadInstallerMessage("Pre-Installation",
-								network.PreInstallConf)
-						}()
+						if !page.tui.model.Offline {
+							go func() {
+								_ = network.DownloadInstallerMessage("Pre-Installation",
+									network.PreInstallConf)
+							}()
+						}
 					}
 				})
 			}
@@ -188,5 +246,10 @@ func newMenuPage(tui *Tui) (Page, error) {
 
 	page.installBtn.SetEnabled(false)
 
+	page.missingLbl = clui.CreateLabel(page.cFrame, AutoSize, 1, "", 1)
+	page.missingLbl.SetBackColor(errorLabelBg)
+	page.missingLbl.SetTextColor(errorLabelFg)
+	page.missingLbl.SetVisible(false)
+
 	return page, nil
 }
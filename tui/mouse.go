@@ -0,0 +1,67 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package tui
+
+import (
+	"github.com/VladimirMarkelov/clui"
+	term "github.com/nsf/termbox-go"
+)
+
+// ScrollListBox is a clui ListBox which also scrolls with the mouse wheel,
+// clicks are already handled by the clui ListBox itself
+type ScrollListBox struct {
+	*clui.ListBox
+}
+
+// CreateScrollListBox returns an instance of ScrollListBox
+// parent - is the parent control this list is attached to
+// width - the minimum width size
+// height - the minimum height size
+// scale - the amount of space to use whenever used in an adjustable layout
+func CreateScrollListBox(parent clui.Control, width, height int, scale int) *ScrollListBox {
+	l := &ScrollListBox{ListBox: clui.CreateListBox(nil, width, height, scale)}
+
+	l.SetParent(parent)
+
+	if parent != nil {
+		parent.AddChild(l)
+	}
+
+	return l
+}
+
+// ProcessEvent translates the mouse wheel events to arrow keys and
+// delegates all events to the clui ListBox
+func (l *ScrollListBox) ProcessEvent(event clui.Event) bool {
+	return l.ListBox.ProcessEvent(wheelToKey(event))
+}
+
+// wheelToKey translates mouse wheel events to the equivalent arrow key
+// events, any other event is returned unchanged
+func wheelToKey(event clui.Event) clui.Event {
+	if event.Type != clui.EventMouse {
+		return event
+	}
+
+	switch event.Key {
+	case term.MouseWheelUp:
+		return clui.Event{Type: clui.EventKey, Key: term.KeyArrowUp}
+	case term.MouseWheelDown:
+		return clui.Event{Type: clui.EventKey, Key: term.KeyArrowDown}
+	}
+
+	return event
+}
+
+// setMouseMode enables or disables the terminal mouse events, disabling it
+// is required on serial terminals which don't handle the mouse sequences
+func setMouseMode(enabled bool) {
+	mode := term.InputEsc
+	if enabled {
+		mode |= term.InputMouse
+	}
+
+	term.SetInputMode(mode)
+}
@@ -5,7 +5,10 @@
 package tui
 
 import (
+	"fmt"
+	"net"
 	"time"
+	"unicode"
 
 	"github.com/clearlinux/clr-installer/network"
 
@@ -16,27 +19,39 @@ import (
 // NetworkInterfacePage is the Page implementation for the network configuration page
 type NetworkInterfacePage struct {
 	BasePage
-	IPEdit           *clui.EditField
-	IPWarning        *clui.Label
-	NetMaskEdit      *clui.EditField
-	NetMaskWarning   *clui.Label
-	GatewayEdit      *clui.EditField
-	GatewayWarning   *clui.Label
-	DNSServerEdit    *clui.EditField
-	DNSServerWarning *clui.Label
-	DNSDomainEdit    *clui.EditField
-	DNSDomainWarning *clui.Label
-	ifaceLbl         *clui.Label
-	DHCPCheck        *clui.CheckBox
-	confirmBtn       *SimpleButton
+	IPEdit            *clui.EditField
+	IPWarning         *clui.Label
+	NetMaskEdit       *clui.EditField
+	NetMaskWarning    *clui.Label
+	GatewayEdit       *clui.EditField
+	GatewayWarning    *clui.Label
+	DNSServerEdit     *clui.EditField
+	DNSServerWarning  *clui.Label
+	DNSDomainEdit     *clui.EditField
+	DNSDomainWarning  *clui.Label
+	IP6Edit           *clui.EditField
+	IP6Warning        *clui.Label
+	Prefix6Edit       *clui.EditField
+	Prefix6Warning    *clui.Label
+	Gateway6Edit      *clui.EditField
+	Gateway6Warning   *clui.Label
+	DNSServer6Edit    *clui.EditField
+	DNSServer6Warning *clui.Label
+	ifaceLbl          *clui.Label
+	DHCPCheck         *clui.CheckBox
+	confirmBtn        *SimpleButton
 
 	defaultValues struct {
-		IP        string
-		NetMask   string
-		Gateway   string
-		DNSServer string
-		DNSDomain string
-		DHCP      bool
+		IP         string
+		NetMask    string
+		Gateway    string
+		DNSServer  string
+		DNSDomain  string
+		IP6        string
+		Prefix6    string
+		Gateway6   string
+		DNSServer6 string
+		DHCP       bool
 	}
 }
 
@@ -58,6 +73,10 @@ func (page *NetworkInterfacePage) clearAllWarnings() {
 	page.GatewayWarning.SetTitle("")
 	page.DNSServerWarning.SetTitle("")
 	page.DNSDomainWarning.SetTitle("")
+	page.IP6Warning.SetTitle("")
+	page.Prefix6Warning.SetTitle("")
+	page.Gateway6Warning.SetTitle("")
+	page.DNSServer6Warning.SetTitle("")
 
 	page.setConfirmButton()
 }
@@ -72,11 +91,19 @@ func (page *NetworkInterfacePage) Activate() {
 	page.GatewayEdit.SetTitle(sel.Gateway)
 	page.DNSServerEdit.SetTitle(sel.DNSServer)
 	page.DNSDomainEdit.SetTitle(sel.DNSDomain)
+	page.IP6Edit.SetTitle("")
+	page.Prefix6Edit.SetTitle("")
+	page.Gateway6Edit.SetTitle(sel.Gateway6)
+	page.DNSServer6Edit.SetTitle(sel.DNSServer6)
 	page.clearAllWarnings()
 
+	page.defaultValues.IP6 = ""
+	page.defaultValues.Prefix6 = ""
 	page.defaultValues.Gateway = sel.Gateway
 	page.defaultValues.DNSServer = sel.DNSServer
 	page.defaultValues.DNSDomain = sel.DNSDomain
+	page.defaultValues.Gateway6 = sel.Gateway6
+	page.defaultValues.DNSServer6 = sel.DNSServer6
 	page.defaultValues.DHCP = sel.DHCP
 
 	showIPv4 := sel.HasIPv4Addr()
@@ -93,13 +120,44 @@ func (page *NetworkInterfacePage) Activate() {
 		break
 	}
 
+	// the link local addresses are configured by the kernel
+	if addr := globalIPv6Addr(sel); addr != nil {
+		prefix, _ := addr.PrefixLength()
+
+		page.IP6Edit.SetTitle(addr.IP)
+		page.Prefix6Edit.SetTitle(fmt.Sprintf("%d", prefix))
+
+		page.defaultValues.IP6 = page.IP6Edit.Title()
+		page.defaultValues.Prefix6 = page.Prefix6Edit.Title()
+	}
+
 	page.setDHCP(sel.DHCP)
 }
 
+// globalIPv6Addr returns the first ipv6 address of iface which is not a link
+// local one, nil if there's none
+func globalIPv6Addr(iface *network.Interface) *network.Addr {
+	for _, addr := range iface.Addrs {
+		if addr.Version != network.IPv6 {
+			continue
+		}
+
+		if ip := net.ParseIP(addr.IP); ip != nil && ip.IsLinkLocalUnicast() {
+			continue
+		}
+
+		return addr
+	}
+
+	return nil
+}
+
 func (page *NetworkInterfacePage) setConfirmButton() {
 	if page.IPWarning.Title() == "" && page.NetMaskWarning.Title() == "" &&
 		page.GatewayWarning.Title() == "" &&
-		page.DNSServerWarning.Title() == "" && page.DNSDomainWarning.Title() == "" {
+		page.DNSServerWarning.Title() == "" && page.DNSDomainWarning.Title() == "" &&
+		page.IP6Warning.Title() == "" && page.Prefix6Warning.Title() == "" &&
+		page.Gateway6Warning.Title() == "" && page.DNSServer6Warning.Title() == "" {
 		page.confirmBtn.SetEnabled(true)
 	} else {
 		page.confirmBtn.SetEnabled(false)
@@ -137,6 +195,49 @@ func (page *NetworkInterfacePage) validateDomainField(editField *clui.EditField,
 	page.setConfirmButton()
 }
 
+// validateIPv6Fields validates the optional ipv6 fields, the prefix is
+// required by the address, the gateway and DNS server require the address
+func (page *NetworkInterfacePage) validateIPv6Fields() {
+	IP6 := page.IP6Edit.Title()
+	Prefix6 := page.Prefix6Edit.Title()
+
+	page.IP6Warning.SetTitle("")
+	page.Prefix6Warning.SetTitle("")
+	page.Gateway6Warning.SetTitle("")
+	page.DNSServer6Warning.SetTitle("")
+
+	if IP6 != "" {
+		page.IP6Warning.SetTitle(network.IsValidIPv6(IP6))
+
+		addr := &network.Addr{IP: IP6, NetMask: Prefix6, Version: network.IPv6}
+		if _, err := addr.PrefixLength(); err != nil || Prefix6 == "" {
+			page.Prefix6Warning.SetTitle("Invalid prefix length")
+		}
+	} else if Prefix6 != "" {
+		page.IP6Warning.SetTitle("Required by the prefix")
+	}
+
+	for _, curr := range []struct {
+		edit    *clui.EditField
+		warning *clui.Label
+	}{
+		{page.Gateway6Edit, page.Gateway6Warning},
+		{page.DNSServer6Edit, page.DNSServer6Warning},
+	} {
+		if curr.edit.Title() == "" {
+			continue
+		}
+
+		if warning := network.IsValidIPv6(curr.edit.Title()); warning != "" {
+			curr.warning.SetTitle(warning)
+		} else if IP6 == "" {
+			page.IP6Warning.SetTitle("Required field")
+		}
+	}
+
+	page.setConfirmButton()
+}
+
 func (page *NetworkInterfacePage) getDHCP() bool {
 	state := page.DHCPCheck.State()
 	if state == 1 {
@@ -183,14 +284,27 @@ func validateIPEdit(k term.Key, ch rune) bool {
 	return true
 }
 
+func validateIPv6Edit(k term.Key, ch rune) bool {
+	if ch == ':' || unicode.Is(unicode.ASCII_Hex_Digit, ch) {
+		return false
+	}
+
+	return validateIPEdit(k, ch)
+}
+
 func newNetworkInterfacePage(tui *Tui) (Page, error) {
 	page := &NetworkInterfacePage{}
 	page.setup(tui, TuiPageInterface, NoButtons, TuiPageMenu)
 
-	frm := clui.CreateFrame(page.content, AutoSize, AutoSize, BorderNone, Fixed)
+	// the ipv6 fields don't fit the content, scroll to the active field
+	scrollFrm := clui.CreateFrame(page.content, AutoSize, ContentHeight, BorderNone, Fixed)
+	scrollFrm.SetPack(clui.Vertical)
+	scrollFrm.SetScrollable(true)
+
+	frm := clui.CreateFrame(scrollFrm, AutoSize, AutoSize, BorderNone, Fixed)
 	frm.SetPack(clui.Horizontal)
 
-	lblFrm := clui.CreateFrame(frm, 10, AutoSize, BorderNone, Fixed)
+	lblFrm := clui.CreateFrame(frm, 13, AutoSize, BorderNone, Fixed)
 	lblFrm.SetPack(clui.Vertical)
 	lblFrm.SetPaddings(1, 0)
 
@@ -200,6 +314,10 @@ func newNetworkInterfacePage(tui *Tui) (Page, error) {
 	newFieldLabel(lblFrm, "Gateway:")
 	newFieldLabel(lblFrm, "DNS Server:")
 	newFieldLabel(lblFrm, "DNS Domain:")
+	newFieldLabel(lblFrm, "IPv6 address:")
+	newFieldLabel(lblFrm, "IPv6 prefix:")
+	newFieldLabel(lblFrm, "IPv6 gateway:")
+	newFieldLabel(lblFrm, "IPv6 DNS:")
 
 	fldFrm := clui.CreateFrame(frm, 50, AutoSize, BorderNone, Fixed)
 	fldFrm.SetPack(clui.Vertical)
@@ -215,6 +333,10 @@ func newNetworkInterfacePage(tui *Tui) (Page, error) {
 	page.GatewayEdit, page.GatewayWarning = newEditField(fldFrm, true, nil)
 	page.DNSServerEdit, page.DNSServerWarning = newEditField(fldFrm, true, nil)
 	page.DNSDomainEdit, page.DNSDomainWarning = newEditField(fldFrm, true, nil)
+	page.IP6Edit, page.IP6Warning = newEditField(fldFrm, true, validateIPv6Edit)
+	page.Prefix6Edit, page.Prefix6Warning = newEditField(fldFrm, true, validateIPEdit)
+	page.Gateway6Edit, page.Gateway6Warning = newEditField(fldFrm, true, validateIPv6Edit)
+	page.DNSServer6Edit, page.DNSServer6Warning = newEditField(fldFrm, true, validateIPv6Edit)
 
 	page.IPEdit.OnChange(func(ev clui.Event) {
 		page.validateIPField(page.IPEdit, page.IPWarning)
@@ -262,6 +384,24 @@ func newNetworkInterfacePage(tui *Tui) (Page, error) {
 	})
 	page.DNSDomainWarning.SetVisible(true)
 
+	for _, curr := range []*clui.EditField{page.IP6Edit, page.Prefix6Edit,
+		page.Gateway6Edit, page.DNSServer6Edit} {
+		edit := curr
+
+		edit.OnChange(func(ev clui.Event) {
+			page.validateIPv6Fields()
+		})
+		edit.OnActive(func(active bool) {
+			if edit.Active() {
+				page.validateIPv6Fields()
+			}
+		})
+	}
+	page.IP6Warning.SetVisible(true)
+	page.Prefix6Warning.SetVisible(true)
+	page.Gateway6Warning.SetVisible(true)
+	page.DNSServer6Warning.SetVisible(true)
+
 	dhcpFrm := clui.CreateFrame(fldFrm, 5, 2, BorderNone, Fixed)
 	dhcpFrm.SetPack(clui.Vertical)
 
@@ -279,6 +419,7 @@ func newNetworkInterfacePage(tui *Tui) (Page, error) {
 			page.validateIPOrHostField(page.GatewayEdit, page.GatewayWarning)
 			page.validateIPOrHostField(page.DNSServerEdit, page.DNSServerWarning)
 			page.validateDomainField(page.DNSDomainEdit, page.DNSDomainWarning)
+			page.validateIPv6Fields()
 		}
 
 		page.IPEdit.SetEnabled(enable)
@@ -286,6 +427,10 @@ func newNetworkInterfacePage(tui *Tui) (Page, error) {
 		page.GatewayEdit.SetEnabled(enable)
 		page.DNSServerEdit.SetEnabled(enable)
 		page.DNSDomainEdit.SetEnabled(enable)
+		page.IP6Edit.SetEnabled(enable)
+		page.Prefix6Edit.SetEnabled(enable)
+		page.Gateway6Edit.SetEnabled(enable)
+		page.DNSServer6Edit.SetEnabled(enable)
 	})
 
 	btnFrm := clui.CreateFrame(fldFrm, 30, 1, BorderNone, Fixed)
@@ -307,6 +452,10 @@ func newNetworkInterfacePage(tui *Tui) (Page, error) {
 		Gateway := page.GatewayEdit.Title()
 		DNSServer := page.DNSServerEdit.Title()
 		DNSDomain := page.DNSDomainEdit.Title()
+		IP6 := page.IP6Edit.Title()
+		Prefix6 := page.Prefix6Edit.Title()
+		Gateway6 := page.Gateway6Edit.Title()
+		DNSServer6 := page.DNSServer6Edit.Title()
 		changed := false
 
 		if IP != page.defaultValues.IP {
@@ -333,6 +482,14 @@ func newNetworkInterfacePage(tui *Tui) (Page, error) {
 			changed = true
 		}
 
+		if IP6 != page.defaultValues.IP6 || Prefix6 != page.defaultValues.Prefix6 {
+			changed = true
+		}
+
+		if Gateway6 != page.defaultValues.Gateway6 || DNSServer6 != page.defaultValues.DNSServer6 {
+			changed = true
+		}
+
 		if changed {
 			sel := page.getSelectedInterface()
 			if !sel.HasIPv4Addr() {
@@ -349,9 +506,20 @@ func newNetworkInterfacePage(tui *Tui) (Page, error) {
 				}
 			}
 
+			if addr := globalIPv6Addr(sel); addr != nil && IP6 != "" {
+				addr.IP = IP6
+				addr.NetMask = Prefix6
+			} else if addr != nil {
+				sel.Addrs = removeAddr(sel.Addrs, addr)
+			} else if IP6 != "" {
+				sel.AddAddr(IP6, Prefix6, network.IPv6)
+			}
+
 			sel.DHCP = DHCP
 			sel.Gateway = Gateway
 			sel.DNSServer = DNSServer
+			sel.Gateway6 = Gateway6
+			sel.DNSServer6 = DNSServer6
 			sel.DNSDomain = DNSDomain
 			page.getModel().AddNetworkInterface(sel)
 		}
@@ -376,3 +544,16 @@ func newNetworkInterfacePage(tui *Tui) (Page, error) {
 
 	return page, nil
 }
+
+// removeAddr returns addrs without addr
+func removeAddr(addrs []*network.Addr, addr *network.Addr) []*network.Addr {
+	result := []*network.Addr{}
+
+	for _, curr := range addrs {
+		if curr != addr {
+			result = append(result, curr)
+		}
+	}
+
+	return result
+}
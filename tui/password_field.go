@@ -0,0 +1,211 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package tui
+
+import (
+	"os"
+	"syscall"
+	"unicode"
+	"unsafe"
+
+	"github.com/VladimirMarkelov/clui"
+	term "github.com/nsf/termbox-go"
+)
+
+const (
+	// kdGetLED is the KDGETLED ioctl request, see linux/kd.h
+	kdGetLED = 0x4B31
+
+	// ledCapsLock is the caps lock bit returned by KDGETLED
+	ledCapsLock = 0x04
+
+	// capsLockGuess is the number of consecutive upper case letters typed
+	// before guessing caps lock is on when the console LEDs can not be read
+	capsLockGuess = 3
+
+	// capsLockWarning is displayed when caps lock seems to be on
+	capsLockWarning = "Caps Lock is on"
+)
+
+// PasswordField is a reusable pair of masked edit fields for a password and its
+// confirmation, the masking is toggled with Ctrl+U, a warning is displayed when
+// caps lock is on and the confirmation is required to match the password
+type PasswordField struct {
+	passwordEdit *clui.EditField
+	confirmEdit  *clui.EditField
+	warning      *clui.Label
+	validate     func(string) (bool, string)
+	mismatch     string
+	changed      bool
+	valid        bool
+	revealable   bool
+	capsLock     bool
+	upperRun     int
+	onChange     func()
+}
+
+// newPasswordField wires the password and confirmation edit fields, validate checks
+// the password requirements and mismatch is the warning used when both don't match
+func newPasswordField(passwordEdit, confirmEdit *clui.EditField, warning *clui.Label,
+	validate func(string) (bool, string), mismatch string) *PasswordField {
+	pf := &PasswordField{
+		passwordEdit: passwordEdit,
+		confirmEdit:  confirmEdit,
+		warning:      warning,
+		validate:     validate,
+		mismatch:     mismatch,
+		revealable:   true,
+	}
+
+	for _, edit := range []*clui.EditField{passwordEdit, confirmEdit} {
+		edit := edit
+		edit.SetPasswordMode(true)
+
+		edit.OnChange(func(ev clui.Event) {
+			pf.Validate()
+		})
+
+		edit.OnActive(func(active bool) {
+			if edit.Active() {
+				pf.Validate()
+			}
+		})
+
+		edit.OnKeyPress(pf.processKey)
+	}
+
+	return pf
+}
+
+func (pf *PasswordField) processKey(k term.Key, ch rune) bool {
+	if k == term.KeyCtrlU {
+		pf.Reveal()
+		return true
+	}
+	if k == term.KeyArrowUp || k == term.KeyArrowDown {
+		return false
+	}
+
+	if !pf.changed {
+		pf.changed = true
+		pf.passwordEdit.SetTitle("")
+		pf.confirmEdit.SetTitle("")
+	}
+
+	if ch != 0 {
+		pf.capsLock = pf.isCapsLockOn(ch)
+	}
+
+	return false
+}
+
+// isCapsLockOn reads the caps lock LED of the virtual console, when not running
+// on a virtual console (i.e serial or ssh) it guesses based on the typed letters
+func (pf *PasswordField) isCapsLockOn(ch rune) bool {
+	var leds uint8
+
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, os.Stdin.Fd(), kdGetLED,
+		uintptr(unsafe.Pointer(&leds)))
+	if errno == 0 {
+		return leds&ledCapsLock == ledCapsLock
+	}
+
+	if unicode.IsUpper(ch) {
+		pf.upperRun++
+	} else if unicode.IsLetter(ch) {
+		pf.upperRun = 0
+	}
+
+	return pf.upperRun >= capsLockGuess
+}
+
+// OnChange sets the callback called after the password is validated
+func (pf *PasswordField) OnChange(fn func()) {
+	pf.onChange = fn
+}
+
+// SetRevealable sets if the password can be unmasked with Ctrl+U
+func (pf *PasswordField) SetRevealable(revealable bool) {
+	pf.revealable = revealable
+}
+
+// Reveal toggles the masking of both password fields
+func (pf *PasswordField) Reveal() {
+	if !pf.revealable {
+		return
+	}
+
+	mode := !pf.passwordEdit.PasswordMode()
+	pf.passwordEdit.SetPasswordMode(mode)
+	pf.confirmEdit.SetPasswordMode(mode)
+}
+
+// Validate checks the password requirements and the confirmation, updates
+// the warning label and returns true if the password is valid
+func (pf *PasswordField) Validate() bool {
+	if !pf.changed {
+		return pf.valid
+	}
+
+	password := pf.passwordEdit.Title()
+	warning := ""
+
+	if ok, msg := pf.validate(password); !ok {
+		warning = msg
+	} else if password != pf.confirmEdit.Title() {
+		warning = pf.mismatch
+	}
+
+	pf.valid = warning == ""
+
+	if pf.valid && pf.capsLock {
+		warning = capsLockWarning
+	}
+	pf.warning.SetTitle(warning)
+
+	if pf.onChange != nil {
+		pf.onChange()
+	}
+
+	return pf.valid
+}
+
+// IsValid returns true if the last validated password was valid
+func (pf *PasswordField) IsValid() bool {
+	return pf.valid
+}
+
+// Changed returns true if the password was typed by the user
+func (pf *PasswordField) Changed() bool {
+	return pf.changed
+}
+
+// Title returns the typed password
+func (pf *PasswordField) Title() string {
+	return pf.passwordEdit.Title()
+}
+
+// Reset sets both fields to a known valid password, masked and not
+// considered changed until the user types in one of the fields
+func (pf *PasswordField) Reset(password string) {
+	pf.changed = false
+	pf.passwordEdit.SetTitle(password)
+	pf.confirmEdit.SetTitle(password)
+	pf.passwordEdit.SetPasswordMode(true)
+	pf.confirmEdit.SetPasswordMode(true)
+	pf.valid = password != ""
+	pf.capsLock = false
+	pf.upperRun = 0
+	pf.warning.SetTitle("")
+}
+
+// Clear empties both fields, the empty password is validated so
+// the requirement warnings are displayed
+func (pf *PasswordField) Clear() {
+	pf.Reset("")
+	pf.changed = true
+	pf.Validate()
+	pf.changed = false
+}
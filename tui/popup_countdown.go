@@ -0,0 +1,173 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package tui
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/VladimirMarkelov/clui"
+	term "github.com/nsf/termbox-go"
+)
+
+// CountdownDialog is dialog window counting down before running an action,
+// the user may cancel the action before the countdown expires
+type CountdownDialog struct {
+	DialogBox *clui.Window
+	Canceled  bool
+	onExpire  func()
+
+	message      string
+	remaining    int
+	ticker       *time.Ticker
+	done         chan bool
+	closed       bool
+	mutex        sync.Mutex
+	infoLabel    *clui.Label
+	cancelButton *SimpleButton
+}
+
+// OnExpire sets the callback that is called when the countdown
+// expires without being canceled
+func (dialog *CountdownDialog) OnExpire(fn func()) {
+	clui.WindowManager().BeginUpdate()
+	defer clui.WindowManager().EndUpdate()
+	dialog.onExpire = fn
+}
+
+// Close stops the countdown and closes the dialog window
+func (dialog *CountdownDialog) Close() {
+	dialog.close()
+}
+
+// close returns false if the dialog was already closed, the countdown
+// may expire while the user cancels it
+func (dialog *CountdownDialog) close() bool {
+	dialog.mutex.Lock()
+	defer dialog.mutex.Unlock()
+
+	if dialog.closed {
+		return false
+	}
+	dialog.closed = true
+
+	dialog.ticker.Stop()
+	close(dialog.done)
+
+	clui.WindowManager().DestroyWindow(dialog.DialogBox)
+	clui.WindowManager().BeginUpdate()
+	_ = term.Flush() // This might be dropped once clui is fixed
+	clui.WindowManager().EndUpdate()
+	clui.RefreshScreen()
+
+	return true
+}
+
+func (dialog *CountdownDialog) updateLabel() {
+	clui.WindowManager().BeginUpdate()
+	dialog.infoLabel.SetTitle(fmt.Sprintf(dialog.message, dialog.remaining))
+	clui.WindowManager().EndUpdate()
+	clui.RefreshScreen()
+}
+
+func (dialog *CountdownDialog) run() {
+	for {
+		select {
+		case <-dialog.done:
+			return
+		case <-dialog.ticker.C:
+			dialog.remaining--
+			if dialog.remaining > 0 {
+				dialog.updateLabel()
+				continue
+			}
+
+			if dialog.close() && dialog.onExpire != nil {
+				dialog.onExpire()
+			}
+			return
+		}
+	}
+}
+
+func initCountdownDialogWindow(dialog *CountdownDialog, title string) error {
+	const wBuff = 5
+	const hBuff = 5
+	const dWidth = 50
+	const dHeight = 8
+
+	sw, sh := clui.ScreenSize()
+
+	x := (sw - WindowWidth) / 2
+	y := (sh - WindowHeight) / 2
+
+	posX := (WindowWidth - dWidth + wBuff) / 2
+	if posX < wBuff {
+		posX = wBuff
+	}
+	posX = x + posX
+	posY := (WindowHeight-dHeight+hBuff)/2 - hBuff
+	if posY < hBuff {
+		posY = hBuff
+	}
+	posY = y + posY
+
+	dialog.DialogBox = clui.AddWindow(posX, posY, dWidth, dHeight, title)
+	dialog.DialogBox.SetTitleButtons(0)
+	dialog.DialogBox.SetMovable(false)
+	dialog.DialogBox.SetSizable(false)
+	clui.WindowManager().BeginUpdate()
+	defer clui.WindowManager().EndUpdate()
+	dialog.DialogBox.SetModal(true)
+	dialog.DialogBox.SetConstraints(dWidth, dHeight)
+	dialog.DialogBox.SetPack(clui.Vertical)
+	dialog.DialogBox.SetBorder(clui.BorderAuto)
+
+	borderFrame := clui.CreateFrame(dialog.DialogBox, dWidth, dHeight, clui.BorderNone, clui.Fixed)
+	borderFrame.SetPack(clui.Vertical)
+	borderFrame.SetGaps(0, 1)
+	borderFrame.SetPaddings(1, 1)
+
+	dialog.infoLabel = clui.CreateLabel(borderFrame, 1, AutoSize,
+		fmt.Sprintf(dialog.message, dialog.remaining), 1)
+	dialog.infoLabel.SetMultiline(true)
+
+	buttonFrame := clui.CreateFrame(borderFrame, AutoSize, 1, clui.BorderNone, clui.Fixed)
+	buttonFrame.SetPack(clui.Horizontal)
+	buttonFrame.SetGaps(1, 0)
+	dialog.cancelButton = CreateSimpleButton(buttonFrame, AutoSize, AutoSize, "Cancel", Fixed)
+	dialog.cancelButton.SetEnabled(true)
+	dialog.cancelButton.SetActive(true)
+
+	return nil
+}
+
+// CreateCountdownDialogBox creates a countdown PopUp, message is a format
+// string receiving the remaining number of seconds
+func CreateCountdownDialogBox(title string, message string, seconds int) (*CountdownDialog, error) {
+	dialog := &CountdownDialog{
+		message:   message,
+		remaining: seconds,
+		done:      make(chan bool),
+	}
+
+	if err := initCountdownDialogWindow(dialog, title); err != nil {
+		return nil, fmt.Errorf("Failed to create Countdown Dialog: %v", err)
+	}
+
+	dialog.cancelButton.OnClick(func(ev clui.Event) {
+		dialog.Canceled = true
+		dialog.Close()
+	})
+
+	clui.ActivateControl(dialog.DialogBox, dialog.cancelButton)
+	clui.RefreshScreen()
+
+	dialog.ticker = time.NewTicker(time.Second)
+	go dialog.run()
+
+	return dialog, nil
+}
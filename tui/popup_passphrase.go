@@ -6,6 +6,7 @@ package tui
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/VladimirMarkelov/clui"
 	term "github.com/nsf/termbox-go"
@@ -22,13 +23,15 @@ type EncryptPassphraseDialog struct {
 	Confirmed bool
 	onClose   func()
 
-	infoLabel         *clui.Label
-	passphraseEdit    *clui.EditField
-	ppConfirmEdit     *clui.EditField
-	warningLabel      *clui.Label
-	changedPassphrase bool
-	cancelButton      *SimpleButton
-	confirmButton     *SimpleButton
+	infoLabel      *clui.Label
+	passphraseEdit *clui.EditField
+	ppConfirmEdit  *clui.EditField
+	warningLabel   *clui.Label
+	strengthLabel  *clui.Label
+	recoveryCheck  *clui.CheckBox
+	passphrase     *PasswordField
+	cancelButton   *SimpleButton
+	confirmButton  *SimpleButton
 }
 
 // OnClose sets the callback that is called when the
@@ -52,38 +55,11 @@ func (dialog *EncryptPassphraseDialog) Close() {
 	clui.RefreshScreen()
 }
 
-func (dialog *EncryptPassphraseDialog) validatePassphrase() {
-	if !dialog.changedPassphrase {
-		return
-	}
-
-	if ok, msg := storage.IsValidPassphrase(dialog.passphraseEdit.Title()); !ok {
-		dialog.warningLabel.SetTitle(msg)
-		dialog.confirmButton.SetEnabled(false)
-	} else if dialog.passphraseEdit.Title() != dialog.ppConfirmEdit.Title() {
-		dialog.warningLabel.SetTitle("Passphrases do not match")
-		dialog.confirmButton.SetEnabled(false)
-	} else {
-		dialog.warningLabel.SetTitle("")
-		dialog.confirmButton.SetEnabled(true)
-	}
-}
-
-func (dialog *EncryptPassphraseDialog) revealPassphrase() {
-	if dialog.passphraseEdit.PasswordMode() {
-		dialog.passphraseEdit.SetPasswordMode(false)
-		dialog.ppConfirmEdit.SetPasswordMode(false)
-	} else {
-		dialog.passphraseEdit.SetPasswordMode(true)
-		dialog.ppConfirmEdit.SetPasswordMode(true)
-	}
-}
-
 func initPassphraseDialogWindow(dialog *EncryptPassphraseDialog) error {
 	const wBuff = 5
 	const hBuff = 5
 	const dWidth = 50
-	const dHeight = 8
+	const dHeight = 11
 
 	sw, sh := clui.ScreenSize()
 
@@ -122,66 +98,17 @@ func initPassphraseDialogWindow(dialog *EncryptPassphraseDialog) error {
 	dialog.infoLabel.SetMultiline(true)
 
 	dialog.passphraseEdit = clui.CreateEditField(borderFrame, 1, "", Fixed)
-	dialog.passphraseEdit.SetPasswordMode(true)
-
-	dialog.passphraseEdit.OnChange(func(ev clui.Event) {
-		dialog.validatePassphrase()
-	})
-
-	dialog.passphraseEdit.OnActive(func(active bool) {
-		if dialog.passphraseEdit.Active() {
-			dialog.validatePassphrase()
-		}
-	})
-
-	dialog.passphraseEdit.OnKeyPress(func(k term.Key, ch rune) bool {
-		if k == term.KeyCtrlU {
-			dialog.revealPassphrase()
-			return true
-		}
-		if k == term.KeyArrowUp || k == term.KeyArrowDown {
-			return false
-		}
-		if !dialog.changedPassphrase {
-			dialog.changedPassphrase = true
-			dialog.passphraseEdit.SetTitle("")
-			dialog.ppConfirmEdit.SetTitle("")
-		}
-		return false
-	})
-
 	dialog.ppConfirmEdit = clui.CreateEditField(borderFrame, 1, "", Fixed)
-	dialog.ppConfirmEdit.SetPasswordMode(true)
+	dialog.strengthLabel = clui.CreateLabel(borderFrame, AutoSize, 1, "", Fixed)
 	dialog.warningLabel = clui.CreateLabel(borderFrame, AutoSize, 1, "", Fixed)
 	dialog.warningLabel.SetMultiline(true)
 	dialog.warningLabel.SetBackColor(errorLabelBg)
 	dialog.warningLabel.SetTextColor(errorLabelFg)
 
-	dialog.ppConfirmEdit.OnChange(func(ev clui.Event) {
-		dialog.validatePassphrase()
-	})
+	dialog.passphrase = newPasswordField(dialog.passphraseEdit, dialog.ppConfirmEdit, dialog.warningLabel,
+		storage.IsValidPassphrase, "Passphrases do not match")
 
-	dialog.ppConfirmEdit.OnActive(func(active bool) {
-		if dialog.ppConfirmEdit.Active() {
-			dialog.validatePassphrase()
-		}
-	})
-
-	dialog.ppConfirmEdit.OnKeyPress(func(k term.Key, ch rune) bool {
-		if k == term.KeyCtrlU {
-			dialog.revealPassphrase()
-			return true
-		}
-		if k == term.KeyArrowUp || k == term.KeyArrowDown {
-			return false
-		}
-		if !dialog.changedPassphrase {
-			dialog.changedPassphrase = true
-			dialog.passphraseEdit.SetTitle("")
-			dialog.ppConfirmEdit.SetTitle("")
-		}
-		return false
-	})
+	dialog.recoveryCheck = clui.CreateCheckBox(borderFrame, 1, "Generate a recovery key", Fixed)
 
 	buttonFrame := clui.CreateFrame(borderFrame, AutoSize, 1, clui.BorderNone, clui.Fixed)
 	buttonFrame.SetPack(clui.Horizontal)
@@ -191,9 +118,22 @@ func initPassphraseDialogWindow(dialog *EncryptPassphraseDialog) error {
 
 	dialog.confirmButton = CreateSimpleButton(buttonFrame, AutoSize, AutoSize, "Confirm", Fixed)
 
+	dialog.passphrase.OnChange(func() {
+		dialog.confirmButton.SetEnabled(dialog.passphrase.IsValid())
+		dialog.updateStrength()
+	})
+
 	return nil
 }
 
+// updateStrength shows the strength meter of the typed passphrase
+func (dialog *EncryptPassphraseDialog) updateStrength() {
+	strength, name := storage.PassphraseStrength(dialog.passphraseEdit.Title())
+
+	meter := strings.Repeat("#", strength) + strings.Repeat("-", storage.MaxPassphraseStrength-strength)
+	dialog.strengthLabel.SetTitle(fmt.Sprintf("Strength: [%s] %s", meter, name))
+}
+
 // CreateEncryptPassphraseDialogBox creates the Network PopUp
 func CreateEncryptPassphraseDialogBox(modelSI *model.SystemInstall) (*EncryptPassphraseDialog, error) {
 	dialog := new(EncryptPassphraseDialog)
@@ -218,12 +158,26 @@ func CreateEncryptPassphraseDialogBox(modelSI *model.SystemInstall) (*EncryptPas
 	dialog.confirmButton.OnClick(func(ev clui.Event) {
 		dialog.Confirmed = true
 		modelSI.CryptPass = dialog.passphraseEdit.Title()
+
+		if dialog.recoveryCheck.State() == 1 {
+			if modelSI.CryptKeys == nil {
+				modelSI.CryptKeys = &storage.CryptKeys{}
+			}
+			modelSI.CryptKeys.Recovery = true
+		} else if modelSI.CryptKeys != nil {
+			modelSI.CryptKeys.Recovery = false
+		}
+
 		dialog.Close()
 	})
 
+	if modelSI.CryptKeys != nil && modelSI.CryptKeys.Recovery {
+		dialog.recoveryCheck.SetState(1)
+	}
+
 	if modelSI.CryptPass != "" {
-		dialog.passphraseEdit.SetTitle(modelSI.CryptPass)
-		dialog.ppConfirmEdit.SetTitle(modelSI.CryptPass)
+		dialog.passphrase.Reset(modelSI.CryptPass)
+		dialog.updateStrength()
 		dialog.confirmButton.SetEnabled(true)
 		clui.ActivateControl(dialog.DialogBox, dialog.confirmButton)
 	} else {
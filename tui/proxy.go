@@ -6,9 +6,12 @@ package tui
 
 import (
 	"net/url"
+	"strings"
 	"time"
 
 	"github.com/VladimirMarkelov/clui"
+
+	"github.com/clearlinux/clr-installer/network"
 )
 
 // ProxyPage is the Page implementation for the proxy configuration page
@@ -16,6 +19,10 @@ type ProxyPage struct {
 	BasePage
 	httpsProxyEdit    *clui.EditField
 	httpsProxyWarning *clui.Label
+	noProxyEdit       *clui.EditField
+	noProxyWarning    *clui.Label
+	dnsEdit           *clui.EditField
+	dnsWarning        *clui.Label
 	confirmBtn        *SimpleButton
 }
 
@@ -24,7 +31,15 @@ func (pp *ProxyPage) GetConfiguredValue() string {
 	value := pp.getModel().HTTPSProxy
 
 	if value == "" {
-		return "No HTTPS proxy URL set"
+		value = "No HTTPS proxy URL set"
+	}
+
+	if noProxy := pp.getModel().NoProxy; len(noProxy) > 0 {
+		value = value + " | No proxy: " + strings.Join(noProxy, ",")
+	}
+
+	if dns := pp.getModel().InstallerDNS; len(dns) > 0 {
+		value = value + " | DNS: " + strings.Join(dns, " ")
 	}
 
 	return value
@@ -34,10 +49,15 @@ func (pp *ProxyPage) GetConfiguredValue() string {
 func (pp *ProxyPage) Activate() {
 	pp.httpsProxyEdit.SetTitle(pp.getModel().HTTPSProxy)
 	pp.httpsProxyWarning.SetTitle("")
+	pp.noProxyEdit.SetTitle(strings.Join(pp.getModel().NoProxy, ","))
+	pp.noProxyWarning.SetTitle("")
+	pp.dnsEdit.SetTitle(strings.Join(pp.getModel().InstallerDNS, " "))
+	pp.dnsWarning.SetTitle("")
 }
 
 func (pp *ProxyPage) setConfirmButton() {
-	if pp.httpsProxyWarning.Title() == "" {
+	if pp.httpsProxyWarning.Title() == "" && pp.noProxyWarning.Title() == "" &&
+		pp.dnsWarning.Title() == "" {
 		pp.confirmBtn.SetEnabled(true)
 	} else {
 		pp.confirmBtn.SetEnabled(false)
@@ -59,6 +79,10 @@ func newProxyPage(tui *Tui) (Page, error) {
 
 	newFieldLabel(lblFrm, "HTTPS Proxy:")
 
+	newFieldLabel(lblFrm, "No Proxy:")
+
+	newFieldLabel(lblFrm, "Installer DNS:")
+
 	fldFrm := clui.CreateFrame(frm, 30, AutoSize, BorderNone, Fixed)
 	fldFrm.SetPack(clui.Vertical)
 
@@ -86,6 +110,52 @@ func newProxyPage(tui *Tui) (Page, error) {
 	page.httpsProxyWarning.SetBackColor(errorLabelBg)
 	page.httpsProxyWarning.SetTextColor(errorLabelFg)
 
+	iframe = clui.CreateFrame(fldFrm, 5, 2, BorderNone, Fixed)
+	iframe.SetPack(clui.Vertical)
+
+	page.noProxyEdit = clui.CreateEditField(iframe, 1, "", Fixed)
+	page.noProxyEdit.OnChange(func(ev clui.Event) {
+		warning := ""
+
+		for _, curr := range network.ParseNoProxy(page.noProxyEdit.Title()) {
+			if err := network.ValidateNoProxyEntry(curr); err != nil {
+				warning = "Invalid proxy exception"
+				break
+			}
+		}
+
+		page.noProxyWarning.SetTitle(warning)
+		page.setConfirmButton()
+	})
+
+	page.noProxyWarning = clui.CreateLabel(iframe, 1, 1, "", Fixed)
+	page.noProxyWarning.SetMultiline(true)
+	page.noProxyWarning.SetBackColor(errorLabelBg)
+	page.noProxyWarning.SetTextColor(errorLabelFg)
+
+	iframe = clui.CreateFrame(fldFrm, 5, 2, BorderNone, Fixed)
+	iframe.SetPack(clui.Vertical)
+
+	page.dnsEdit = clui.CreateEditField(iframe, 1, "", Fixed)
+	page.dnsEdit.OnChange(func(ev clui.Event) {
+		warning := ""
+
+		for _, curr := range strings.Fields(page.dnsEdit.Title()) {
+			if err := network.ValidateDNSServer(curr); err != nil {
+				warning = "Invalid DNS server address"
+				break
+			}
+		}
+
+		page.dnsWarning.SetTitle(warning)
+		page.setConfirmButton()
+	})
+
+	page.dnsWarning = clui.CreateLabel(iframe, 1, 1, "", Fixed)
+	page.dnsWarning.SetMultiline(true)
+	page.dnsWarning.SetBackColor(errorLabelBg)
+	page.dnsWarning.SetTextColor(errorLabelFg)
+
 	btnFrm := clui.CreateFrame(fldFrm, 30, 1, BorderNone, Fixed)
 	btnFrm.SetPack(clui.Horizontal)
 	btnFrm.SetGaps(1, 1)
@@ -100,13 +170,17 @@ func newProxyPage(tui *Tui) (Page, error) {
 	page.confirmBtn.OnClick(func(ev clui.Event) {
 		proxy := page.httpsProxyEdit.Title()
 		currentProxy := page.getModel().HTTPSProxy
+		currentNoProxy := page.getModel().NoProxy
+		currentDNS := page.getModel().InstallerDNS
 		page.getModel().HTTPSProxy = proxy
+		page.getModel().NoProxy = network.ParseNoProxy(page.noProxyEdit.Title())
+		page.getModel().InstallerDNS = strings.Fields(page.dnsEdit.Title())
 		if dialog, err := CreateNetworkTestDialogBox(page.tui.model); err == nil {
 			dialog.OnClose(func() {
 				page.GotoPage(TuiPageMenu)
 			})
 			if dialog.RunNetworkTest() {
-				page.SetDone(proxy != "")
+				page.SetDone(proxy != "" || len(page.getModel().InstallerDNS) > 0)
 
 				// Automatically close if it worked
 				clui.RefreshScreen()
@@ -114,6 +188,8 @@ func newProxyPage(tui *Tui) (Page, error) {
 				dialog.Close()
 			} else {
 				page.getModel().HTTPSProxy = currentProxy
+				page.getModel().NoProxy = currentNoProxy
+				page.getModel().InstallerDNS = currentDNS
 				page.SetDone(false)
 			}
 		}
@@ -9,6 +9,7 @@ import (
 
 	"github.com/VladimirMarkelov/clui"
 
+	"github.com/clearlinux/clr-installer/model"
 	"github.com/clearlinux/clr-installer/swupd"
 )
 
@@ -24,13 +25,7 @@ type SwupdMirrorPage struct {
 
 // GetConfiguredValue Returns the string representation of currently value set
 func (page *SwupdMirrorPage) GetConfiguredValue() string {
-	mirror := page.getModel().SwupdMirror
-
-	if mirror == "" {
-		return "No swupd mirror set"
-	}
-
-	return mirror
+	return page.getModel().SummaryValue(model.SummarySwupdMirror)
 }
 
 // GetConfigDefinition returns if the config was interactively defined by the user,
@@ -0,0 +1,96 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package tui
+
+import (
+	"fmt"
+
+	"github.com/VladimirMarkelov/clui"
+	"github.com/clearlinux/clr-installer/kernel"
+)
+
+// SysctlPage is the Page implementation for the sysctl tuning profile page
+type SysctlPage struct {
+	BasePage
+	profiles []string
+	radios   []*clui.Radio
+	group    *clui.RadioGroup
+}
+
+// GetConfiguredValue Returns the string representation of currently value set
+func (page *SysctlPage) GetConfiguredValue() string {
+	md := page.getModel()
+
+	result := md.SysctlProfile
+	if result == "" {
+		result = "No sysctl tuning profile"
+	}
+
+	if len(md.Sysctl) > 0 {
+		result = fmt.Sprintf("%s, %d custom settings", result, len(md.Sysctl))
+	}
+
+	return result
+}
+
+// Activate selects the profile radio based on the data model
+func (page *SysctlPage) Activate() {
+	for i, curr := range page.profiles {
+		if curr == page.getModel().SysctlProfile {
+			page.group.SelectItem(page.radios[i])
+			break
+		}
+	}
+}
+
+func newSysctlPage(tui *Tui) (Page, error) {
+	page := &SysctlPage{profiles: []string{""}}
+
+	page.setupMenu(tui, TuiPageSysctl, "Sysctl Tuning Profile", NoButtons, TuiPageMenu)
+	clui.CreateLabel(page.content, 2, 2, "Select the kernel parameters tuning profile", Fixed)
+
+	frm := clui.CreateFrame(page.content, AutoSize, AutoSize, BorderNone, Fixed)
+	frm.SetPack(clui.Vertical)
+
+	lblFrm := clui.CreateFrame(frm, AutoSize, AutoSize, BorderNone, Fixed)
+	lblFrm.SetPack(clui.Vertical)
+	lblFrm.SetPaddings(2, 0)
+
+	page.group = clui.CreateRadioGroup()
+
+	labels := []string{"none: Keep the kernel defaults"}
+	for _, curr := range kernel.SysctlProfiles {
+		page.profiles = append(page.profiles, curr.Name)
+		labels = append(labels, fmt.Sprintf("%s: %s", curr.Name, curr.Desc))
+	}
+
+	for _, lbl := range labels {
+		radio := clui.CreateRadio(lblFrm, AutoSize, lbl, AutoSize)
+		radio.SetPack(clui.Horizontal)
+		page.group.AddItem(radio)
+		page.radios = append(page.radios, radio)
+	}
+
+	cancelBtn := CreateSimpleButton(page.cFrame, AutoSize, AutoSize, "Cancel", Fixed)
+	cancelBtn.OnClick(func(ev clui.Event) {
+		page.GotoPage(TuiPageMenu)
+	})
+
+	confirmBtn := CreateSimpleButton(page.cFrame, AutoSize, AutoSize, "Confirm", Fixed)
+	confirmBtn.OnClick(func(ev clui.Event) {
+		selected := page.group.Selected()
+		if selected < 0 {
+			selected = 0
+		}
+
+		page.getModel().SysctlProfile = page.profiles[selected]
+		page.SetDone(selected > 0)
+		page.GotoPage(TuiPageMenu)
+	})
+
+	page.group.SelectItem(page.radios[0])
+
+	return page, nil
+}
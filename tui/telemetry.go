@@ -5,11 +5,11 @@
 package tui
 
 import (
-	"fmt"
 	"strings"
 
 	"github.com/VladimirMarkelov/clui"
 
+	"github.com/clearlinux/clr-installer/model"
 	"github.com/clearlinux/clr-installer/telemetry"
 )
 
@@ -20,19 +20,13 @@ type TelemetryPage struct {
 
 // GetConfiguredValue Returns the string representation of currently value set
 func (tp *TelemetryPage) GetConfiguredValue() string {
-	var obs string
-	var res string
+	res := tp.getModel().SummaryValue(model.SummaryTelemetry)
 
 	if tp.getModel().Telemetry.Defined {
-		obs = " (Acknowledgment required)"
+		res = res + " (Acknowledgment required)"
 	}
 
-	res = "Disabled"
-	if tp.getModel().Telemetry.Enabled {
-		res = "Enabled"
-	}
-
-	return fmt.Sprintf("%s %s", res, obs)
+	return res
 }
 
 func newTelemetryPage(tui *Tui) (Page, error) {
@@ -8,6 +8,7 @@ import (
 	"github.com/VladimirMarkelov/clui"
 	term "github.com/nsf/termbox-go"
 
+	"github.com/clearlinux/clr-installer/model"
 	"github.com/clearlinux/clr-installer/timezone"
 )
 
@@ -15,12 +16,12 @@ import (
 type TimezonePage struct {
 	BasePage
 	avTimezones []*timezone.TimeZone
-	tzListBox   *clui.ListBox
+	tzListBox   *ScrollListBox
 }
 
 // GetConfiguredValue Returns the string representation of currently timezone set
 func (page *TimezonePage) GetConfiguredValue() string {
-	return page.getModel().Timezone.Code
+	return page.getModel().SummaryValue(model.SummaryTimezone)
 }
 
 // GetConfigDefinition returns if the config was interactively defined by the user,
@@ -79,7 +80,7 @@ func newTimezonePage(tui *Tui) (Page, error) {
 	lbl := clui.CreateLabel(page.content, 2, 2, "Select System Timezone", Fixed)
 	lbl.SetPaddings(0, 2)
 
-	page.tzListBox = clui.CreateListBox(page.content, AutoSize, ContentHeight-1, Fixed)
+	page.tzListBox = CreateScrollListBox(page.content, AutoSize, ContentHeight-1, Fixed)
 	page.tzListBox.SetStyle("List")
 
 	page.tzListBox.OnActive(func(active bool) {
@@ -5,10 +5,16 @@
 package tui
 
 import (
+	"fmt"
+	"sync"
+
 	"github.com/clearlinux/clr-installer/args"
 	"github.com/clearlinux/clr-installer/cmd"
 	"github.com/clearlinux/clr-installer/log"
 	"github.com/clearlinux/clr-installer/model"
+	"github.com/clearlinux/clr-installer/qrcode"
+	"github.com/clearlinux/clr-installer/remote"
+	"github.com/clearlinux/clr-installer/telemetry"
 	"github.com/clearlinux/clr-installer/utils"
 
 	"github.com/VladimirMarkelov/clui"
@@ -34,6 +40,10 @@ var (
 
 	// errorLabelFg is a custom theme element, it has the error label foreground color definition
 	errorLabelFg termbox.Attribute
+
+	// loopCalls are the calls queued by runOnLoop, waiting for the clui main loop
+	loopCalls      []func()
+	loopCallsMutex sync.Mutex
 )
 
 // New creates a new Tui frontend instance
@@ -65,6 +75,11 @@ func (tui *Tui) Run(md *model.SystemInstall, rootDir string, options args.Args)
 	clui.InitLibrary()
 	defer clui.DeinitLibrary()
 
+	// clui enables the mouse by default, pure serial terminals may not cope with it
+	if options.NoMouse {
+		setMouseMode(false)
+	}
+
 	tui.model = md
 	tui.options = options
 	themeDir, err := utils.LookupThemeDir()
@@ -109,6 +124,10 @@ func (tui *Tui) Run(md *model.SystemInstall, rootDir string, options args.Args)
 		{"telemetry enabling", newTelemetryPage},
 		{"kernel cmdline", newKernelCMDLine},
 		{"kernel selection", newKernelPage},
+		{"kernel modules", newKernelModulesPage},
+		{"sysctl profile", newSysctlPage},
+		{"hpc", newHPCPage},
+		{"diagnostics", newDiagnosticsPage},
 		{"install", newInstallPage},
 		{"swupd mirror", newSwupdMirrorPage},
 		{"hostname", newHostnamePage},
@@ -126,6 +145,10 @@ func (tui *Tui) Run(md *model.SystemInstall, rootDir string, options args.Args)
 		tui.pages = append(tui.pages, page)
 	}
 
+	// the features with no dedicated page get a generated one
+	tui.pages = append(tui.pages, newFeaturePages(tui)...)
+
+	tui.navigateRemote()
 	tui.gotoPage(TuiPageMenu, tui.currPage)
 
 	var paniced error
@@ -144,12 +167,98 @@ func (tui *Tui) Run(md *model.SystemInstall, rootDir string, options args.Args)
 			log.Error("Failed to log Telemetry fail record: %s", "tuipanic")
 		}
 		log.RequestCrashInfo()
+		printFailureCode(paniced)
 		return false, paniced
 	}
 
 	return tui.installReboot, nil
 }
 
+// MissingRequirements returns the menu titles of the required pages not yet
+// completed, neither by the user nor by the loaded configuration
+func (tui *Tui) MissingRequirements() []string {
+	missing := []string{}
+
+	for _, curr := range tui.pages {
+		if curr.GetMenuTitle() == "" || !curr.IsRequired() {
+			continue
+		}
+
+		if GetMenuStatus(curr) == MenuButtonStatusDefault {
+			missing = append(missing, curr.GetMenuTitle())
+		}
+	}
+
+	return missing
+}
+
+// navigateRemote lets the read-write remote session clients switch to the
+// menu pages, as the local user does from the main menu
+func (tui *Tui) navigateRemote() {
+	titles := []string{}
+	for _, curr := range tui.pages {
+		if curr.GetMenuTitle() != "" {
+			titles = append(titles, curr.GetMenuTitle())
+		}
+	}
+
+	remote.Navigate(titles, func(title string) {
+		runOnLoop(func() {
+			if tui.currPage == nil || tui.currPage.GetID() == TuiPageInstall {
+				log.Warning("Not switching to %q, the install is running", title)
+				return
+			}
+
+			for _, curr := range tui.pages {
+				if curr.GetMenuTitle() == title {
+					tui.gotoPage(curr.GetID(), tui.getPage(TuiPageMenu))
+					clui.RefreshScreen()
+					return
+				}
+			}
+		})
+	})
+}
+
+// answerRemotePrompt presses the dialog button picked by a read-write remote
+// session client, as if the local user did
+func answerRemotePrompt(choice int, buttons ...*SimpleButton) {
+	if choice < 0 || choice >= len(buttons) {
+		return
+	}
+
+	runOnLoop(func() {
+		buttons[choice].ProcessEvent(clui.Event{Type: clui.EventKey, Key: termbox.KeyEnter})
+		clui.RefreshScreen()
+	})
+}
+
+// runOnLoop queues fn to run on the clui main loop, clui is not thread safe and
+// the remote session callbacks run on the socket goroutine. clui has no custom
+// events, a resize to the current screen size wakes the loop which runs the
+// queued calls from the page windows screen resize callback
+func runOnLoop(fn func()) {
+	loopCallsMutex.Lock()
+	loopCalls = append(loopCalls, fn)
+	loopCallsMutex.Unlock()
+
+	width, height := clui.ScreenSize()
+	clui.PutEvent(clui.Event{Type: clui.EventResize, Width: width, Height: height})
+}
+
+// runLoopCalls runs the calls queued by runOnLoop, it must be called from the
+// clui main loop
+func runLoopCalls() {
+	loopCallsMutex.Lock()
+	calls := loopCalls
+	loopCalls = nil
+	loopCallsMutex.Unlock()
+
+	for _, fn := range calls {
+		fn()
+	}
+}
+
 func (tui *Tui) gotoPage(id int, currPage Page) {
 	if tui.currPage != nil && !isPopUpPage(id) {
 		if tui.currPage.GetWindow() != nil {
@@ -166,6 +275,13 @@ func (tui *Tui) gotoPage(id int, currPage Page) {
 
 	tui.currPage.Activate()
 	if !isPopUpPage(id) {
+		telemetry.UsageEnter(tui.currPage)
+
+		title := tui.currPage.GetMenuTitle()
+		if title == "" {
+			title = telemetry.UsagePageName(tui.currPage)
+		}
+		remote.Publish(remote.EventPage, title)
 		tui.currPage.GetWindow().SetVisible(true)
 		clui.ActivateControl(tui.currPage.GetWindow(), tui.currPage.GetActivated())
 	}
@@ -180,3 +296,17 @@ func (tui *Tui) getPage(page int) Page {
 
 	return nil
 }
+
+// printFailureCode prints the failure details as a QR code once the terminal
+// is restored, so users can continue troubleshooting from a phone
+func printFailureCode(err error) {
+	code, errCode := qrcode.Text(qrcode.FailurePayload(err))
+	if errCode != nil {
+		log.Warning("Failed to print the failure QR code: %v", errCode)
+		return
+	}
+
+	fmt.Println("Scan to continue troubleshooting from a phone:")
+	fmt.Println(code)
+	fmt.Println("")
+}
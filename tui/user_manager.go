@@ -12,6 +12,7 @@ import (
 	"github.com/VladimirMarkelov/clui"
 
 	"github.com/clearlinux/clr-installer/log"
+	"github.com/clearlinux/clr-installer/model"
 	"github.com/clearlinux/clr-installer/user"
 )
 
@@ -73,24 +74,7 @@ type UserManagerPage struct {
 
 // GetConfiguredValue Returns the string representation of currently value set
 func (page *UserManagerPage) GetConfiguredValue() string {
-	users := page.getModel().Users
-	res := []string{}
-
-	if len(users) == 0 {
-		return "No users added"
-	}
-
-	for _, curr := range users {
-		tks := []string{curr.Login}
-
-		if curr.Admin {
-			tks = append(tks, "admin")
-		}
-
-		res = append(res, strings.Join(tks, ":"))
-	}
-
-	return strings.Join(res, ", ")
+	return page.getModel().SummaryValue(model.SummaryUsers)
 }
 
 // GetConfigDefinition returns if the config was interactively defined by the user,
@@ -434,12 +418,9 @@ func (users ByUserName) Less(a, b int) bool { return users.Users[a].UserName < u
 func (page *UserManagerPage) addUser(addUser *user.User) {
 	page.usersChanged = true
 
-	newUser := &user.User{
-		Login:    addUser.Login,
-		UserName: addUser.UserName,
-		Password: addUser.Password,
-		Admin:    addUser.Admin,
-	}
+	// a full copy, the groups, sudo policy and password to check included
+	newUser := &user.User{}
+	*newUser = *addUser
 
 	page.users = append(page.users, newUser)
 
@@ -8,6 +8,7 @@ import (
 	"strings"
 
 	"github.com/clearlinux/clr-installer/log"
+	"github.com/clearlinux/clr-installer/model"
 	"github.com/clearlinux/clr-installer/user"
 
 	"github.com/VladimirMarkelov/clui"
@@ -26,8 +27,13 @@ type UseraddPage struct {
 	passwordEdit    *clui.EditField
 	pwConfirmEdit   *clui.EditField
 	adminCheck      *clui.CheckBox
+	groupsEdit      *clui.EditField
+	groupsWarning   *clui.Label
+	sudoEdit        *clui.EditField
+	sudoWarning     *clui.Label
+	noPasswordCheck *clui.CheckBox
 	deleteBtn       *SimpleButton
-	changedPwd      bool
+	password        *PasswordField
 	changedLogin    bool
 	loginWarning    *clui.Label
 	usernameWarning *clui.Label
@@ -37,24 +43,7 @@ type UseraddPage struct {
 
 // GetConfiguredValue Returns the string representation of currently value set
 func (page *UseraddPage) GetConfiguredValue() string {
-	users := page.getModel().Users
-	res := []string{}
-
-	if len(users) == 0 {
-		return "No users added"
-	}
-
-	for _, curr := range users {
-		tks := []string{curr.Login}
-
-		if curr.Admin {
-			tks = append(tks, "admin")
-		}
-
-		res = append(res, strings.Join(tks, ":"))
-	}
-
-	return strings.Join(res, ", ")
+	return page.getModel().SummaryValue(model.SummaryUsers)
 }
 
 // Activate updates the UI elements
@@ -79,6 +68,9 @@ func (page *UseraddPage) Activate() {
 
 	page.titleLabel.SetTitle(title)
 
+	// Only allow to reveal passwords typed for new users
+	page.password.SetRevealable(page.addMode)
+
 	page.setConfirmButton()
 }
 
@@ -89,7 +81,7 @@ func (page *UseraddPage) SetDone(done bool) bool {
 	// hence we know the data is valid
 	page.user.UserName = page.usernameEdit.Title()
 	page.user.Login = page.loginEdit.Title()
-	if page.addMode || page.changedPwd {
+	if page.addMode || page.password.Changed() {
 		if err := page.user.SetPassword(page.passwordEdit.Title()); err != nil {
 			log.Warning("Failed to encrypt password: %v", err)
 			page.clearForm()
@@ -103,6 +95,9 @@ func (page *UseraddPage) SetDone(done bool) bool {
 		page.user.Admin = false
 	}
 
+	page.user.Groups = user.ParseList(page.groupsEdit.Title())
+	page.user.Sudo = user.NewSudoPolicy(page.noPasswordCheck.State() != 0, page.sudoEdit.Title())
+
 	page.GotoPage(TuiPageUserManager)
 
 	return false
@@ -111,7 +106,9 @@ func (page *UseraddPage) SetDone(done bool) bool {
 func (page *UseraddPage) setConfirmButton() {
 	if page.usernameWarning.Title() == "" &&
 		page.loginWarning.Title() == "" &&
-		page.passwordWarning.Title() == "" &&
+		page.groupsWarning.Title() == "" &&
+		page.sudoWarning.Title() == "" &&
+		page.password.IsValid() &&
 		page.loginEdit.Title() != "" &&
 		page.passwordEdit.Title() != "" {
 		page.confirmBtn.SetEnabled(true)
@@ -131,6 +128,26 @@ func (page *UseraddPage) validateUsername() {
 	page.setConfirmButton()
 }
 
+func (page *UseraddPage) validateGroups() {
+	if ok, msg := user.IsValidGroups(page.groupsEdit.Title()); !ok {
+		page.groupsWarning.SetTitle(msg)
+	} else {
+		page.groupsWarning.SetTitle("")
+	}
+
+	page.setConfirmButton()
+}
+
+func (page *UseraddPage) validateSudo() {
+	if ok, msg := user.IsValidSudoCommands(page.sudoEdit.Title(), page.adminCheck.State() != 0); !ok {
+		page.sudoWarning.SetTitle(msg)
+	} else {
+		page.sudoWarning.SetTitle("")
+	}
+
+	page.setConfirmButton()
+}
+
 func (page *UseraddPage) validateLogin() {
 	page.loginWarning.SetTitle("")
 
@@ -157,22 +174,6 @@ func (page *UseraddPage) validateLogin() {
 	page.setConfirmButton()
 }
 
-func (page *UseraddPage) validatePassword() {
-	if !page.changedPwd {
-		return
-	}
-
-	if ok, msg := user.IsValidPassword(page.passwordEdit.Title()); !ok {
-		page.passwordWarning.SetTitle(msg)
-	} else if page.passwordEdit.Title() != page.pwConfirmEdit.Title() {
-		page.passwordWarning.SetTitle("Passwords do not match")
-	} else {
-		page.passwordWarning.SetTitle("")
-	}
-
-	page.setConfirmButton()
-}
-
 func newUseraddPage(tui *Tui) (Page, error) {
 	page := &UseraddPage{}
 	page.setup(tui, TuiPageUseradd, NoButtons, TuiPageUserManager)
@@ -189,6 +190,8 @@ func newUseraddPage(tui *Tui) (Page, error) {
 	newFieldLabel(lblFrm, "Login:")
 	newFieldLabel(lblFrm, "Password:")
 	newFieldLabel(lblFrm, "Confirm:")
+	newFieldLabel(lblFrm, "Groups:")
+	newFieldLabel(lblFrm, "Sudo Cmds:")
 
 	fldFrm := clui.CreateFrame(frm, 50, AutoSize, BorderNone, Fixed)
 	fldFrm.SetPack(clui.Vertical)
@@ -214,20 +217,18 @@ func newUseraddPage(tui *Tui) (Page, error) {
 	})
 	page.usernameWarning.SetVisible(true)
 
-	page.loginEdit, page.loginWarning = newEditField(fldFrm, true, nil)
+	// If the user types in the Login field, no longer auto-generate
+	// the login value based on the UserName
+	page.loginEdit, page.loginWarning = newEditField(fldFrm, true, func(k term.Key, ch rune) bool {
+		page.changedLogin = true
+		return false
+	})
 	page.loginEdit.OnChange(func(ev clui.Event) {
 		if len(page.loginEdit.Title()) == 0 {
 			page.changedLogin = false
 		}
 		page.validateLogin()
 	})
-	// If the user types in the Login field, no longer auto-generate
-	// the login value based on the UserName
-	page.loginEdit.OnKeyPress(func(k term.Key, ch rune) bool {
-		page.changedLogin = true
-		return false
-	})
-
 	page.loginEdit.OnActive(func(active bool) {
 		if page.loginEdit.Active() {
 			page.validateLogin()
@@ -237,68 +238,36 @@ func newUseraddPage(tui *Tui) (Page, error) {
 	page.loginWarning.SetVisible(true)
 
 	page.passwordEdit, _ = newEditField(fldFrm, false, nil)
-	page.passwordEdit.SetPasswordMode(true)
-
-	page.passwordEdit.OnChange(func(ev clui.Event) {
-		page.validatePassword()
-	})
-
-	page.passwordEdit.OnActive(func(active bool) {
-		if page.passwordEdit.Active() {
-			page.validatePassword()
-		}
-	})
-
-	page.passwordEdit.OnKeyPress(func(k term.Key, ch rune) bool {
-		if k == term.KeyCtrlU {
-			page.revealPassword()
-			return true
-		}
-		if k == term.KeyArrowUp || k == term.KeyArrowDown {
-			return false
-		}
-		if !page.changedPwd {
-			page.changedPwd = true
-			page.passwordEdit.SetTitle("")
-			page.pwConfirmEdit.SetTitle("")
-		}
-		return false
-	})
-
 	page.pwConfirmEdit, page.passwordWarning = newEditField(fldFrm, true, nil)
-	page.pwConfirmEdit.SetPasswordMode(true)
 	page.passwordWarning.SetVisible(true)
 
-	page.pwConfirmEdit.OnChange(func(ev clui.Event) {
-		page.validatePassword()
-	})
+	page.password = newPasswordField(page.passwordEdit, page.pwConfirmEdit, page.passwordWarning,
+		func(pwd string) (bool, string) { return page.getModel().PasswordPolicy.Check(pwd) },
+		"Passwords do not match")
+	page.password.OnChange(page.setConfirmButton)
 
-	page.pwConfirmEdit.OnActive(func(active bool) {
-		if page.pwConfirmEdit.Active() {
-			page.validatePassword()
-		}
+	// the supplementary groups and the sudo commands are comma separated
+	page.groupsEdit, page.groupsWarning = newEditField(fldFrm, true, nil)
+	page.groupsEdit.OnChange(func(ev clui.Event) {
+		page.validateGroups()
 	})
+	page.groupsWarning.SetVisible(true)
 
-	page.pwConfirmEdit.OnKeyPress(func(k term.Key, ch rune) bool {
-		if k == term.KeyCtrlU {
-			page.revealPassword()
-			return true
-		}
-		if k == term.KeyArrowUp || k == term.KeyArrowDown {
-			return false
-		}
-		if !page.changedPwd {
-			page.changedPwd = true
-			page.passwordEdit.SetTitle("")
-			page.pwConfirmEdit.SetTitle("")
-		}
-		return false
+	page.sudoEdit, page.sudoWarning = newEditField(fldFrm, true, nil)
+	page.sudoEdit.OnChange(func(ev clui.Event) {
+		page.validateSudo()
 	})
+	page.sudoWarning.SetVisible(true)
 
-	adminFrm := clui.CreateFrame(fldFrm, 5, 2, BorderNone, Fixed)
+	adminFrm := clui.CreateFrame(fldFrm, 5, 3, BorderNone, Fixed)
 	adminFrm.SetPack(clui.Vertical)
 
 	page.adminCheck = clui.CreateCheckBox(adminFrm, 1, "Administrator", Fixed)
+	page.adminCheck.OnChange(func(state int) {
+		page.validateSudo()
+	})
+
+	page.noPasswordCheck = clui.CreateCheckBox(adminFrm, 1, "No sudo password", Fixed)
 
 	cancelBtn := CreateSimpleButton(page.cFrame, AutoSize, AutoSize, "Cancel", Fixed)
 	cancelBtn.OnClick(func(ev clui.Event) {
@@ -320,6 +289,8 @@ func newUseraddPage(tui *Tui) (Page, error) {
 		page.user.Login = ""
 		page.user.Password = ""
 		page.user.Admin = false
+		page.user.Groups = nil
+		page.user.Sudo = nil
 		page.clearForm()
 		page.GotoPage(TuiPageUserManager)
 	})
@@ -340,34 +311,25 @@ func newUseraddPage(tui *Tui) (Page, error) {
 	return page, nil
 }
 
-func (page *UseraddPage) revealPassword() {
-	if !page.addMode {
-		return
-	}
-
-	if page.passwordEdit.PasswordMode() {
-		page.passwordEdit.SetPasswordMode(false)
-		page.pwConfirmEdit.SetPasswordMode(false)
-	} else {
-		page.passwordEdit.SetPasswordMode(true)
-		page.pwConfirmEdit.SetPasswordMode(true)
-	}
-}
-
 func (page *UseraddPage) resetForm() {
 	page.usernameEdit.SetTitle(page.user.UserName)
 	page.loginEdit.SetTitle(page.user.Login)
 	page.changedLogin = true // Assume the user wants to keep this
-	page.changedPwd = false
 	if !page.addMode {
-		page.passwordEdit.SetTitle("************")
-		page.pwConfirmEdit.SetTitle("************")
-		page.passwordWarning.SetTitle("")
+		page.password.Reset("************")
 	}
 	if page.user.Admin {
 		page.adminCheck.SetState(1)
 	}
 
+	page.groupsEdit.SetTitle(strings.Join(page.user.Groups, ", "))
+	if page.user.Sudo != nil {
+		page.sudoEdit.SetTitle(strings.Join(page.user.Sudo.Commands, ", "))
+		if page.user.Sudo.NoPassword {
+			page.noPasswordCheck.SetState(1)
+		}
+	}
+
 	page.deleteBtn.SetEnabled(true)
 
 	clui.ActivateControl(page.tui.currPage.GetWindow(), page.usernameEdit)
@@ -380,16 +342,11 @@ func (page *UseraddPage) clearForm() {
 	page.loginEdit.SetTitle(" ")
 	page.loginEdit.SetTitle("")
 	page.changedLogin = false
-	// Need to ensure there is a change in the title and
-	// change flag is set so that the validation code executes
-	page.changedPwd = true
-	page.passwordEdit.SetTitle(" ")
-	page.passwordEdit.SetTitle("")
-	page.changedPwd = false
-	page.pwConfirmEdit.SetTitle("")
-	page.passwordEdit.SetPasswordMode(true)
-	page.pwConfirmEdit.SetPasswordMode(true)
+	page.password.Clear()
 	page.adminCheck.SetState(0)
+	page.groupsEdit.SetTitle("")
+	page.sudoEdit.SetTitle("")
+	page.noPasswordCheck.SetState(0)
 	page.deleteBtn.SetEnabled(false)
 	page.confirmBtn.SetEnabled(false)
 	clui.ActivateControl(page.tui.currPage.GetWindow(), page.usernameEdit)
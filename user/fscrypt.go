@@ -0,0 +1,166 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package user
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/clearlinux/clr-installer/cmd"
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/log"
+	"github.com/clearlinux/clr-installer/progress"
+	"github.com/clearlinux/clr-installer/utils"
+)
+
+const (
+	// fscryptPAMModule is the PAM module unlocking the home directories
+	fscryptPAMModule = "pam_fscrypt.so"
+
+	// defaultPAMDir is the directory, relative to the system root, of the
+	// stateless PAM configuration
+	defaultPAMDir = "usr/share/pam.d"
+
+	// pamDir is the directory, relative to the system root, of the local
+	// PAM configuration, it overrides the stateless one
+	pamDir = "etc/pam.d"
+)
+
+// fscryptPAMRules are the rules added to the target PAM configuration: the
+// login unlocks the home directory, a password change rewraps its key and
+// the logout locks it
+var fscryptPAMRules = []struct {
+	file string
+	rule string
+}{
+	{"system-auth", "auth optional " + fscryptPAMModule},
+	{"system-session", "session optional " + fscryptPAMModule},
+	{"system-password", "password optional " + fscryptPAMModule},
+}
+
+// EncryptHomes sets up fscrypt on the target file system mounted to
+// mountPoint, holding /home, and encrypts the home directory of the users
+// with their login password; the password of the users read from a
+// configuration file is only known hashed, their home directory is left
+// unencrypted
+func EncryptHomes(rootDir string, mountPoint string, users []*User) error {
+	prg := progress.NewLoop(utils.Locale.Get("Encrypting the home directories"))
+
+	if err := cmd.RunAndLog("chroot", rootDir, "fscrypt", "setup", "--quiet", "--force"); err != nil {
+		prg.Failure()
+		return errors.Wrap(err)
+	}
+
+	// the global setup prepares the root file system
+	if mountPoint != "/" {
+		if err := cmd.RunAndLog("chroot", rootDir, "fscrypt", "setup", mountPoint, "--quiet"); err != nil {
+			prg.Failure()
+			return errors.Wrap(err)
+		}
+	}
+
+	if err := writeFscryptPAM(rootDir); err != nil {
+		prg.Failure()
+		return err
+	}
+
+	for _, curr := range users {
+		if err := curr.encryptHome(rootDir); err != nil {
+			prg.Failure()
+			return err
+		}
+	}
+
+	prg.Success()
+	return nil
+}
+
+// writeFscryptPAM adds the pam_fscrypt rules to the local PAM configuration
+// of the target, starting from its stateless configuration
+func writeFscryptPAM(rootDir string) error {
+	if err := utils.MkdirAll(filepath.Join(rootDir, pamDir), 0755); err != nil {
+		return err
+	}
+
+	for _, curr := range fscryptPAMRules {
+		dest := filepath.Join(rootDir, pamDir, curr.file)
+
+		src := dest
+		if ok, _ := utils.FileExists(src); !ok {
+			src = filepath.Join(rootDir, defaultPAMDir, curr.file)
+		}
+
+		content, err := ioutil.ReadFile(src)
+		if err != nil {
+			return errors.Errorf("Could not read the %s PAM configuration: %v", curr.file, err)
+		}
+
+		if strings.Contains(string(content), fscryptPAMModule) {
+			continue
+		}
+
+		text := strings.TrimRight(string(content), "\n") + "\n" + curr.rule + "\n"
+		if err = ioutil.WriteFile(dest, []byte(text), 0644); err != nil {
+			return errors.Wrap(err)
+		}
+	}
+
+	return nil
+}
+
+// encryptHome encrypts the home directory of u with a fscrypt protector
+// unlocked by its login password, an encrypted directory must be empty so
+// the content of the home directory is moved back once it's encrypted
+func (u *User) encryptHome(rootDir string) error {
+	if u.plainPassword == "" {
+		log.Warning("The home directory of %s is not encrypted, its password is unknown", u.Login)
+		return nil
+	}
+
+	home := u.getUserHome(rootDir)
+	targetHome := filepath.Join(rootDir, home)
+	saved := targetHome + ".clr-installer"
+
+	log.Info("Encrypting the home directory of %s", u.Login)
+
+	exists, _ := utils.FileExists(targetHome)
+	if exists {
+		if err := os.Rename(targetHome, saved); err != nil {
+			return errors.Wrap(err)
+		}
+	}
+
+	if err := utils.MkdirAll(targetHome, 0700); err != nil {
+		return err
+	}
+
+	// the output may hold the password prompt, not logged
+	w := bytes.NewBuffer(nil)
+	args := []string{"chroot", rootDir, "fscrypt", "encrypt", home, "--quiet",
+		"--source=pam_passphrase", "--user=" + u.Login}
+
+	if err := cmd.PipeRun(u.plainPassword, w, args...); err != nil {
+		return errors.Errorf("Could not encrypt the home directory of %s: %v", u.Login, err)
+	}
+
+	if exists {
+		if err := cmd.RunAndLog("cp", "-a", saved+"/.", targetHome); err != nil {
+			return errors.Wrap(err)
+		}
+
+		if err := os.RemoveAll(saved); err != nil {
+			return errors.Wrap(err)
+		}
+	}
+
+	if err := cmd.RunAndLog("chroot", rootDir, "chown", "-R", u.Login+":", home); err != nil {
+		return errors.Wrap(err)
+	}
+
+	return nil
+}
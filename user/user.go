@@ -20,16 +20,38 @@ import (
 	"github.com/clearlinux/clr-installer/errors"
 	"github.com/clearlinux/clr-installer/log"
 	"github.com/clearlinux/clr-installer/progress"
+	"github.com/clearlinux/clr-installer/pwpolicy"
 	"github.com/clearlinux/clr-installer/utils"
 )
 
 // User abstracts a target system definition
 type User struct {
-	Login    string   `yaml:"login,omitempty"`
-	UserName string   `yaml:"username,omitempty,flow"`
-	Password string   `yaml:"password,omitempty,flow"`
-	Admin    bool     `yaml:"admin,omitempty,flow"`
-	SSHKeys  []string `yaml:"ssh-keys,omitempty,flow"`
+	Login    string      `yaml:"login,omitempty"`
+	UserName string      `yaml:"username,omitempty,flow"`
+	Password string      `yaml:"password,omitempty,flow"`
+	Admin    bool        `yaml:"admin,omitempty,flow"`
+	SSHKeys  []string    `yaml:"ssh-keys,omitempty,flow"`
+	Groups   []string    `yaml:"groups,omitempty,flow"`
+	Sudo     *SudoPolicy `yaml:"sudo,omitempty,flow"`
+
+	// PasswordSecret is a secret reference to the clear text password, see
+	// utils.ReadSecret; unlike a hashed password it's checked against the
+	// password policy
+	PasswordSecret string `yaml:"password-secret,omitempty,flow"`
+
+	// plainPassword is the password set by SetPassword, kept in memory
+	// until the password policy is checked
+	plainPassword string
+}
+
+// SudoPolicy is the sudo rule of a user, on top of the full rights the
+// administrators have from the wheel group
+type SudoPolicy struct {
+	// NoPassword runs the commands without asking the user password
+	NoPassword bool `yaml:"nopasswd,omitempty,flow"`
+
+	// Commands are the only commands the user may run, all if empty
+	Commands []string `yaml:"commands,omitempty,flow"`
 }
 
 const (
@@ -39,17 +61,29 @@ const (
 	// MaxLoginLength is the longest possible login
 	MaxLoginLength = 31
 	// MinPasswordLength is the shortest possible password
-	MinPasswordLength = 8
+	MinPasswordLength = pwpolicy.DefaultMinLength
 	// MaxPasswordLength is the shortest possible password
-	MaxPasswordLength = 255
+	MaxPasswordLength = pwpolicy.MaxLength
 
 	// RequiredBundle the bundle needed to enable non-root user accounts
 	RequiredBundle = "sysadmin-basic"
+
+	// MaxGroupLength is the longest possible group name
+	MaxGroupLength = 32
+
+	// adminGroup is the group granting the full sudo rights
+	adminGroup = "wheel"
+
+	// sudoersDir is the directory, relative to the system root, of the
+	// local sudo rules
+	sudoersDir = "etc/sudoers.d"
 )
 
 var (
 	usernameExp     = regexp.MustCompile("^([a-zA-Z]+[0-9a-zA-Z-_ ,'.]*|)$")
 	loginExp        = regexp.MustCompile("^[a-z]+[0-9a-z-_]*$")
+	groupExp        = regexp.MustCompile("^[a-z_][0-9a-z-_]*$")
+	sudoCommandExp  = regexp.MustCompile(`^/[^,:=\\#"\n]+$`)
 	sysDefaultUsers = []string{}
 )
 
@@ -103,10 +137,11 @@ func NewUser(login string, username string, pwd string, admin bool) (*User, erro
 	}
 
 	return &User{
-		Login:    login,
-		UserName: username,
-		Password: hashed,
-		Admin:    admin,
+		Login:         login,
+		UserName:      username,
+		Password:      hashed,
+		Admin:         admin,
+		plainPassword: pwd,
 	}, nil
 }
 
@@ -118,6 +153,47 @@ func (u *User) SetPassword(pwd string) error {
 	}
 
 	u.Password = hashed
+	u.plainPassword = pwd
+	u.PasswordSecret = ""
+	return nil
+}
+
+// ReadPasswordSecret sets the password read from the PasswordSecret reference,
+// the reference is dropped once the password is set
+func (u *User) ReadPasswordSecret() error {
+	if u.PasswordSecret == "" {
+		return nil
+	}
+
+	if u.Password != "" {
+		return errors.ValidationErrorf("User %s: password and password-secret are mutually exclusive", u.Login)
+	}
+
+	secret, err := utils.ReadSecret(u.PasswordSecret)
+	if err != nil {
+		return err
+	}
+
+	return u.SetPassword(strings.TrimRight(string(secret), "\n"))
+}
+
+// CheckPassword checks the password set by SetPassword follows the policy, a
+// password only known hashed, i.e loaded from a config file, can't be checked:
+// it's refused if a policy is set
+func (u *User) CheckPassword(policy *pwpolicy.Policy) error {
+	if u.plainPassword == "" {
+		if policy != nil && u.Password != "" {
+			return errors.ValidationErrorf("The hashed password of the user %s can not be checked against the password policy, use password-secret",
+				u.Login)
+		}
+
+		return nil
+	}
+
+	if ok, msg := policy.Check(u.plainPassword); !ok {
+		return errors.ValidationErrorf("Invalid password of the user %s: %s", u.Login, msg)
+	}
+
 	return nil
 }
 
@@ -306,6 +382,10 @@ func (u *User) apply(rootDir string) error {
 
 	if u.userExist(rootDir) {
 		log.Info("Account '%s' already a defined system account, skipping add.", u.Login)
+
+		if err := u.appendGroups(rootDir); err != nil {
+			return err
+		}
 	} else {
 		args := []string{
 			"chroot",
@@ -316,10 +396,14 @@ func (u *User) apply(rootDir string) error {
 			u.Login,
 		}
 
-		if u.Admin {
+		if groups := u.supplementaryGroups(); len(groups) > 0 {
+			if err := createGroups(rootDir, groups); err != nil {
+				return err
+			}
+
 			args = append(args, []string{
 				"-G",
-				"wheel",
+				strings.Join(groups, ","),
 			}...)
 		}
 
@@ -369,6 +453,147 @@ func (u *User) apply(rootDir string) error {
 		}
 	}
 
+	if u.Sudo != nil {
+		if err := writeSudoers(rootDir, u); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// supplementaryGroups returns the groups of u, wheel first for an admin
+func (u *User) supplementaryGroups() []string {
+	groups := []string{}
+
+	if u.Admin {
+		groups = append(groups, adminGroup)
+	}
+
+	for _, curr := range u.Groups {
+		if !utils.StringSliceContains(groups, curr) {
+			groups = append(groups, curr)
+		}
+	}
+
+	return groups
+}
+
+// appendGroups adds the existing account u to its supplementary groups
+func (u *User) appendGroups(rootDir string) error {
+	if len(u.Groups) == 0 {
+		return nil
+	}
+
+	if err := createGroups(rootDir, u.Groups); err != nil {
+		return err
+	}
+
+	args := []string{
+		"chroot",
+		rootDir,
+		"usermod",
+		"--append",
+		"--groups",
+		strings.Join(u.Groups, ","),
+		u.Login,
+	}
+
+	if err := cmd.RunAndLog(args...); err != nil {
+		return errors.Wrap(err)
+	}
+
+	return nil
+}
+
+// createGroups adds to the target the groups it does not define yet
+func createGroups(rootDir string, groups []string) error {
+	for _, curr := range groups {
+		if err := cmd.RunAndLog("chroot", rootDir, "getent", "group", curr); err == nil {
+			continue
+		}
+
+		log.Info("Adding group '%s'", curr)
+		if err := cmd.RunAndLog("chroot", rootDir, "groupadd", curr); err != nil {
+			return errors.Wrap(err)
+		}
+	}
+
+	return nil
+}
+
+// SudoersEntry returns the sudo rule of u, empty if u has no sudo policy
+func (u *User) SudoersEntry() string {
+	if u.Sudo == nil {
+		return ""
+	}
+
+	tag := ""
+	if u.Sudo.NoPassword {
+		tag = "NOPASSWD: "
+	}
+
+	commands := "ALL"
+	if len(u.Sudo.Commands) > 0 {
+		commands = strings.Join(u.Sudo.Commands, ", ")
+	}
+
+	return fmt.Sprintf("%s ALL=(ALL) %s%s\n", u.Login, tag, commands)
+}
+
+// writeSudoers writes the sudo rule of u to the sudoers.d directory of the
+// target, sudo ignores the files not only readable
+func writeSudoers(rootDir string, u *User) error {
+	dir := filepath.Join(rootDir, sudoersDir)
+	if err := utils.MkdirAll(dir, 0750); err != nil {
+		return err
+	}
+
+	file := filepath.Join(dir, u.Login)
+	if err := ioutil.WriteFile(file, []byte(u.SudoersEntry()), 0440); err != nil {
+		return errors.Wrap(err)
+	}
+
+	// the mode of an existing file is not changed by WriteFile
+	if err := os.Chmod(file, 0440); err != nil {
+		return errors.Wrap(err)
+	}
+
+	return nil
+}
+
+// Validate checks the groups and the sudo policy of u
+func (u *User) Validate() error {
+	seen := map[string]bool{}
+
+	for _, curr := range u.Groups {
+		if ok, msg := IsValidGroup(curr); !ok {
+			return errors.ValidationErrorf("User %s: %s", u.Login, msg)
+		}
+
+		if seen[curr] {
+			return errors.ValidationErrorf("User %s: the group %s is listed more than once", u.Login, curr)
+		}
+		seen[curr] = true
+	}
+
+	if u.Sudo == nil {
+		return nil
+	}
+
+	// the wheel group rule would still grant all the commands
+	if u.Admin && len(u.Sudo.Commands) > 0 {
+		return errors.ValidationErrorf("User %s: an administrator can not be restricted to sudo commands",
+			u.Login)
+	}
+
+	for _, curr := range u.Sudo.Commands {
+		if !sudoCommandExp.MatchString(curr) {
+			return errors.ValidationErrorf("User %s: invalid sudo command %q, must be an absolute path",
+				u.Login, curr)
+		}
+	}
+
 	return nil
 }
 
@@ -447,19 +672,76 @@ func IsValidLogin(login string) (bool, string) {
 	return true, ""
 }
 
-// IsValidPassword checks the minimum password requirements
-func IsValidPassword(pwd string) (bool, string) {
-	if pwd == "" {
-		return false, utils.Locale.Get("Password is required")
+// IsValidGroup checks the group name restrictions
+func IsValidGroup(group string) (bool, string) {
+	if len(group) > MaxGroupLength {
+		return false, utils.Locale.Get("Group maximum length is %d", MaxGroupLength)
 	}
 
-	if len(pwd) < MinPasswordLength {
-		return false, utils.Locale.Get("Password must be at least %d characters long", MinPasswordLength)
+	if !groupExp.MatchString(group) {
+		return false, utils.Locale.Get("Group must contain only numbers, lower case letters, - or _")
 	}
 
-	if len(pwd) > MaxPasswordLength {
-		return false, utils.Locale.Get("Password may be at most %d characters long", MaxPasswordLength)
+	return true, ""
+}
+
+// IsValidGroups checks the comma separated list of groups text
+func IsValidGroups(text string) (bool, string) {
+	for _, curr := range ParseList(text) {
+		if ok, msg := IsValidGroup(curr); !ok {
+			return false, msg
+		}
 	}
 
 	return true, ""
 }
+
+// IsValidSudoCommands checks the comma separated list of sudo commands text,
+// an administrator can not be restricted to commands
+func IsValidSudoCommands(text string, admin bool) (bool, string) {
+	commands := ParseList(text)
+
+	if admin && len(commands) > 0 {
+		return false, utils.Locale.Get("An administrator can not be restricted to sudo commands")
+	}
+
+	for _, curr := range commands {
+		if !sudoCommandExp.MatchString(curr) {
+			return false, utils.Locale.Get("Sudo commands must be absolute paths")
+		}
+	}
+
+	return true, ""
+}
+
+// NewSudoPolicy returns the sudo policy of the comma separated list of
+// commands text, nil if the user has the default policy
+func NewSudoPolicy(noPassword bool, text string) *SudoPolicy {
+	commands := ParseList(text)
+
+	if !noPassword && len(commands) == 0 {
+		return nil
+	}
+
+	return &SudoPolicy{NoPassword: noPassword, Commands: commands}
+}
+
+// ParseList splits the comma separated list text, i.e of groups or sudo
+// commands, the empty items are dropped
+func ParseList(text string) []string {
+	result := []string{}
+
+	for _, curr := range strings.Split(text, ",") {
+		if curr = strings.TrimSpace(curr); curr != "" {
+			result = append(result, curr)
+		}
+	}
+
+	return result
+}
+
+// IsValidPassword checks the minimum password requirements, the ones of the
+// default password policy
+func IsValidPassword(pwd string) (bool, string) {
+	return (&pwpolicy.Policy{}).Check(pwd)
+}
@@ -0,0 +1,70 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package utils
+
+import (
+	"strings"
+	"unicode"
+)
+
+// collationFold maps the accented latin letters to their base letters, so they
+// collate with the base letter instead of after "z" as the byte order does
+var collationFold = map[rune]string{
+	'à': "a", 'á': "a", 'â': "a", 'ã': "a", 'ä': "a", 'å': "a", 'ā': "a", 'ă': "a", 'ą': "a",
+	'æ': "ae", 'ç': "c", 'ć': "c", 'č': "c", 'ď': "d", 'đ': "d",
+	'è': "e", 'é': "e", 'ê': "e", 'ë': "e", 'ē': "e", 'ė': "e", 'ę': "e", 'ě': "e",
+	'ğ': "g", 'ì': "i", 'í': "i", 'î': "i", 'ï': "i", 'ī': "i", 'į': "i", 'ı': "i",
+	'ł': "l", 'ľ': "l", 'ñ': "n", 'ń': "n", 'ň': "n",
+	'ò': "o", 'ó': "o", 'ô': "o", 'õ': "o", 'ö': "o", 'ø': "o", 'ō': "o", 'ő': "o", 'œ': "oe",
+	'ř': "r", 'ś': "s", 'š': "s", 'ş': "s", 'ß': "ss", 'ť': "t", 'ţ': "t",
+	'ù': "u", 'ú': "u", 'û': "u", 'ü': "u", 'ū': "u", 'ů': "u", 'ű': "u", 'ų': "u",
+	'ý': "y", 'ÿ': "y", 'ź': "z", 'ż': "z", 'ž': "z",
+}
+
+// CollationKey returns the key s is sorted and searched by: lower case, with
+// the accented latin letters folded to their base letters and '_' as a space
+func CollationKey(s string) string {
+	var key strings.Builder
+
+	for _, r := range strings.ToLower(s) {
+		if fold, ok := collationFold[r]; ok {
+			key.WriteString(fold)
+		} else if r == '_' {
+			key.WriteRune(' ')
+		} else if !unicode.Is(unicode.Mn, r) {
+			key.WriteRune(r)
+		}
+	}
+
+	return key.String()
+}
+
+// CollateLess reports whether a sorts before b, the strings are compared by
+// their collation keys and, when equivalent, by their bytes so the order is stable
+func CollateLess(a string, b string) bool {
+	ka, kb := CollationKey(a), CollationKey(b)
+	if ka != kb {
+		return ka < kb
+	}
+
+	return a < b
+}
+
+// SearchMatch returns true if any of texts contains search, ignoring the
+// case and the diacritics, an empty search matches everything
+func SearchMatch(search string, texts ...string) bool {
+	key := CollationKey(strings.TrimSpace(search))
+	if key == "" {
+		return true
+	}
+
+	for _, curr := range texts {
+		if strings.Contains(CollationKey(curr), key) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -229,9 +229,19 @@ func IsCheckCoverage() bool {
 
 // IsStdoutTTY returns true if the stdout is attached to a tty
 func IsStdoutTTY() bool {
+	return isTTY(os.Stdout)
+}
+
+// IsStdinTTY returns true if the stdin is attached to a tty
+func IsStdinTTY() bool {
+	return isTTY(os.Stdin)
+}
+
+// isTTY returns true if file is attached to a tty
+func isTTY(file *os.File) bool {
 	var termios syscall.Termios
 
-	fd := os.Stdout.Fd()
+	fd := file.Fd()
 	ptr := uintptr(unsafe.Pointer(&termios))
 	_, _, err := syscall.Syscall6(syscall.SYS_IOCTL, fd, syscall.TCGETS, ptr, 0, 0, 0)
 
@@ -255,6 +265,28 @@ func ExpandVariables(vars map[string]string, str string) string {
 	return str
 }
 
+// ReadSecret returns the content of a secret reference, the supported references are:
+// "env:NAME" for the NAME environment variable and "file:PATH" for the content of a file
+func ReadSecret(ref string) ([]byte, error) {
+	switch {
+	case strings.HasPrefix(ref, "env:"):
+		name := strings.TrimPrefix(ref, "env:")
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return nil, errors.Errorf("Secret environment variable %s is not set", name)
+		}
+		return []byte(value), nil
+	case strings.HasPrefix(ref, "file:"):
+		content, err := ioutil.ReadFile(strings.TrimPrefix(ref, "file:"))
+		if err != nil {
+			return nil, errors.Wrap(err)
+		}
+		return content, nil
+	}
+
+	return nil, errors.Errorf("Invalid secret reference %q, expected env:NAME or file:PATH", ref)
+}
+
 // IsVirtualBox returns true if the running system is executed
 // from within VirtualBox
 // Attempt to parse the System Management BIOS (SMBIOS) and